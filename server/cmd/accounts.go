@@ -0,0 +1,311 @@
+package cmd
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	models "github.com/Cprime50/Gopay/models/account"
+	"github.com/Cprime50/Gopay/service"
+	"github.com/spf13/cobra"
+)
+
+// statementDateFormat is the format of the statement --from and --to flags
+const statementDateFormat = "2006-01-02"
+
+var accountsCmd = &cobra.Command{
+	Use:   "accounts",
+	Short: "Manage accounts, every change is recorded in the audit log",
+	Long: `Manage accounts, every change is recorded in the audit log.
+
+Accounts are referred to by ID, account number or email.`,
+}
+
+var accountsCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Create an active account",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		flags := cmd.Flags()
+		email, _ := flags.GetString("email")
+		firstName, _ := flags.GetString("first-name")
+		lastName, _ := flags.GetString("last-name")
+		password, _ := flags.GetString("password")
+		roleRef, _ := flags.GetString("role")
+
+		return withAdmin(cmd, func(admin *service.AdminService, actor string) error {
+			role, err := admin.FindRole(cmd.Context(), roleRef)
+			if err != nil {
+				return err
+			}
+			generated := password == ""
+			if generated {
+				if password, err = generatePassword(); err != nil {
+					return err
+				}
+			}
+
+			account := &models.Account{Email: email, FirstName: firstName, LastName: lastName, Password: password}
+			if err := admin.CreateAccount(cmd.Context(), actor, account, role.ID); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "created account %s number %d with role %s\n", account.ID, account.AccountNumber, role.Name)
+			if generated {
+				fmt.Fprintf(cmd.OutOrStdout(), "password: %s\n", password)
+			}
+			return nil
+		})
+	},
+}
+
+var accountsActivateCmd = &cobra.Command{
+	Use:   "activate ACCOUNT",
+	Short: "Activate an account",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withAccount(cmd, args[0], func(admin *service.AdminService, actor string, account *models.Account) error {
+			if err := admin.SetActive(cmd.Context(), actor, account.ID, true); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "activated %s\n", account.Email)
+			return nil
+		})
+	},
+}
+
+var accountsDeactivateCmd = &cobra.Command{
+	Use:   "deactivate ACCOUNT",
+	Short: "Deactivate an account and revoke its sessions",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withAccount(cmd, args[0], func(admin *service.AdminService, actor string, account *models.Account) error {
+			if err := admin.SetActive(cmd.Context(), actor, account.ID, false); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "deactivated %s\n", account.Email)
+			return nil
+		})
+	},
+}
+
+var accountsResetPasswordCmd = &cobra.Command{
+	Use:   "reset-password ACCOUNT",
+	Short: "Set a new password, generated unless --password is given, and revoke sessions",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		password, _ := cmd.Flags().GetString("password")
+		return withAccount(cmd, args[0], func(admin *service.AdminService, actor string, account *models.Account) error {
+			generated := password == ""
+			if generated {
+				var err error
+				if password, err = generatePassword(); err != nil {
+					return err
+				}
+			}
+			if err := admin.ResetPassword(cmd.Context(), actor, account.ID, password); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "password reset for %s\n", account.Email)
+			if generated {
+				fmt.Fprintf(cmd.OutOrStdout(), "password: %s\n", password)
+			}
+			return nil
+		})
+	},
+}
+
+var accountsAssignRoleCmd = &cobra.Command{
+	Use:   "assign-role ACCOUNT ROLE",
+	Short: "Give an account a role, by role ID or name",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withAccount(cmd, args[0], func(admin *service.AdminService, actor string, account *models.Account) error {
+			role, err := admin.FindRole(cmd.Context(), args[1])
+			if err != nil {
+				return err
+			}
+			if err := admin.AssignRole(cmd.Context(), actor, account.ID, role.ID); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "assigned role %s to %s, it applies from the next token refresh\n", role.Name, account.Email)
+			return nil
+		})
+	},
+}
+
+var accountsRevokeSessionsCmd = &cobra.Command{
+	Use:   "revoke-sessions ACCOUNT",
+	Short: "Revoke all of an account's refresh tokens",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withAccount(cmd, args[0], func(admin *service.AdminService, actor string, account *models.Account) error {
+			if err := admin.RevokeSessions(cmd.Context(), actor, account.ID); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "revoked sessions for %s\n", account.Email)
+			return nil
+		})
+	},
+}
+
+// newLedgerCmd returns the credit or debit command
+func newLedgerCmd(entryType string, short string) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   entryType + " ACCOUNT AMOUNT",
+		Short: short,
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			reason, _ := cmd.Flags().GetString("reason")
+			amount, err := strconv.ParseFloat(args[1], 64)
+			if err != nil {
+				return fmt.Errorf("invalid amount %q", args[1])
+			}
+
+			return withAccount(cmd, args[0], func(admin *service.AdminService, actor string, account *models.Account) error {
+				apply := admin.Credit
+				if entryType == models.Debit {
+					apply = admin.Debit
+				}
+				entry, err := apply(cmd.Context(), actor, account.ID, amount, reason)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "%s %.2f on %s, balance %.2f\n", entryType, entry.Amount, account.Email, entry.BalanceAfter)
+				return nil
+			})
+		},
+	}
+	cmd.Flags().String("reason", "", "why the balance is changed (required)")
+	cmd.MarkFlagRequired("reason")
+	return cmd
+}
+
+var accountsStatementCmd = &cobra.Command{
+	Use:   "statement ACCOUNT",
+	Short: "Print an account's ledger entries for a period",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		from, to, err := statementPeriod(cmd)
+		if err != nil {
+			return err
+		}
+
+		return withAccount(cmd, args[0], func(admin *service.AdminService, actor string, account *models.Account) error {
+			statement, err := admin.Statement(cmd.Context(), account.ID, from, to)
+			if err != nil {
+				return err
+			}
+
+			out := cmd.OutOrStdout()
+			fmt.Fprintf(out, "Statement for %s %s (%d)\n", account.FirstName, account.LastName, account.AccountNumber)
+			fmt.Fprintf(out, "Period %s to %s\n\n", from.Format(statementDateFormat), to.Add(-time.Nanosecond).Format(statementDateFormat))
+			if len(statement.Entries) == 0 {
+				fmt.Fprintf(out, "No entries, current balance %.2f\n", account.Balance)
+				return nil
+			}
+
+			w := tabwriter.NewWriter(out, 0, 0, 2, ' ', tabwriter.AlignRight)
+			fmt.Fprintln(w, "DATE\tTYPE\tAMOUNT\tBALANCE\tREASON\t")
+			fmt.Fprintf(w, "\topening\t\t%.2f\t\t\n", statement.OpeningBalance)
+			for _, e := range statement.Entries {
+				amount := e.Amount
+				if e.Type == models.Debit {
+					amount = -amount
+				}
+				fmt.Fprintf(w, "%s\t%s\t%.2f\t%.2f\t%s\t\n", e.CreatedAt.Format(time.RFC3339), e.Type, amount, e.BalanceAfter, e.Reason)
+			}
+			fmt.Fprintf(w, "\tclosing\t\t%.2f\t\t\n", statement.ClosingBalance)
+			if err := w.Flush(); err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "\nTotal credits %.2f, total debits %.2f\n", statement.TotalCredits, statement.TotalDebits)
+			return nil
+		})
+	},
+}
+
+func init() {
+	accountsCreateCmd.Flags().String("email", "", "email address (required)")
+	accountsCreateCmd.Flags().String("first-name", "", "first name (required)")
+	accountsCreateCmd.Flags().String("last-name", "", "last name (required)")
+	accountsCreateCmd.Flags().String("password", "", "password, generated and printed if not given")
+	accountsCreateCmd.Flags().String("role", "user", "role ID or name")
+	for _, name := range []string{"email", "first-name", "last-name"} {
+		accountsCreateCmd.MarkFlagRequired(name)
+	}
+	accountsResetPasswordCmd.Flags().String("password", "", "new password, generated and printed if not given")
+	accountsStatementCmd.Flags().String("from", "", "first day of the statement, "+statementDateFormat+", defaults to the start of the month")
+	accountsStatementCmd.Flags().String("to", "", "last day of the statement, "+statementDateFormat+", defaults to today")
+
+	addActorFlag(accountsCmd)
+	accountsCmd.AddCommand(
+		accountsCreateCmd,
+		accountsActivateCmd,
+		accountsDeactivateCmd,
+		accountsResetPasswordCmd,
+		accountsAssignRoleCmd,
+		accountsRevokeSessionsCmd,
+		newLedgerCmd(models.Credit, "Add to an account's balance, recorded in its ledger"),
+		newLedgerCmd(models.Debit, "Take from an account's balance, recorded in its ledger"),
+		accountsStatementCmd,
+	)
+	rootCmd.AddCommand(accountsCmd)
+}
+
+// withAdmin runs fn with the admin service and the actor from the flags
+func withAdmin(cmd *cobra.Command, fn func(admin *service.AdminService, actor string) error) error {
+	actor, err := actor(cmd)
+	if err != nil {
+		return err
+	}
+	admin, closeDS, err := newAdminService(cmd)
+	if err != nil {
+		return err
+	}
+	defer closeDS()
+	return fn(admin, actor)
+}
+
+// withAccount is withAdmin for commands on the account ref refers to
+func withAccount(cmd *cobra.Command, ref string, fn func(admin *service.AdminService, actor string, account *models.Account) error) error {
+	return withAdmin(cmd, func(admin *service.AdminService, actor string) error {
+		account, err := admin.FindAccount(cmd.Context(), ref)
+		if err != nil {
+			return err
+		}
+		return fn(admin, actor, account)
+	})
+}
+
+// statementPeriod parses --from and --to into [from, to), whole days in local time
+func statementPeriod(cmd *cobra.Command) (time.Time, time.Time, error) {
+	now := time.Now()
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local)
+	to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+
+	for name, value := range map[string]*time.Time{"from": &from, "to": &to} {
+		flag, _ := cmd.Flags().GetString(name)
+		if flag == "" {
+			continue
+		}
+		parsed, err := time.ParseInLocation(statementDateFormat, flag, time.Local)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid --%s %q, expected %s", name, flag, statementDateFormat)
+		}
+		*value = parsed
+	}
+	// to is inclusive on the command line
+	return from, to.AddDate(0, 0, 1), nil
+}
+
+// generatePassword returns a random password for accounts created or reset without one
+func generatePassword() (string, error) {
+	bytes := make([]byte, 12)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", fmt.Errorf("generating password: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(bytes), nil
+}
@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+
+	"github.com/Cprime50/Gopay/db"
+	"github.com/Cprime50/Gopay/migrations"
+	models "github.com/Cprime50/Gopay/models/account"
+	"github.com/Cprime50/Gopay/service"
+	"github.com/spf13/cobra"
+)
+
+// newAdminService connects to postgres and redis for the operations
+// commands, the returned func closes the connections
+func newAdminService(cmd *cobra.Command) (*service.AdminService, func(), error) {
+	cfg := loadConfig()
+	gormDB, rdb, err := db.InitDS(cfg.Database, cfg.Redis)
+	if err != nil {
+		return nil, nil, err
+	}
+	closeDS := func() { db.Close(gormDB, rdb) }
+
+	// same rule as serving, don't touch a schema that's out of date
+	migrator, err := migrations.New(gormDB)
+	if err == nil {
+		err = migrator.Check(cmd.Context())
+	}
+	if err != nil {
+		closeDS()
+		return nil, nil, fmt.Errorf("database schema is not up to date: %w", err)
+	}
+
+	accounts := models.NewAccountRepository(gormDB)
+	accountService := service.NewAccountService(accounts, models.NewRoleRepository(gormDB), models.NewImageRepository(cfg.Cloudinary))
+	tokenService := service.NewTokenService(models.NewTokenRepository(rdb), cfg.Token)
+	adminService := service.NewAdminService(accountService, tokenService, models.NewLedgerRepository(gormDB), models.NewAuditRepository(gormDB), models.NewTransactor(gormDB))
+	return adminService, closeDS, nil
+}
+
+// addActorFlag adds the --actor flag recorded in the audit log to cmd and its subcommands
+func addActorFlag(cmd *cobra.Command) {
+	cmd.PersistentFlags().String("actor", defaultActor(), "who is running the command, recorded in the audit log")
+}
+
+func actor(cmd *cobra.Command) (string, error) {
+	actor, _ := cmd.Flags().GetString("actor")
+	if actor == "" {
+		return "", fmt.Errorf("--actor is required")
+	}
+	return actor, nil
+}
+
+// defaultActor is the user running the CLI
+func defaultActor() string {
+	name := os.Getenv("USER")
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	if name == "" {
+		return ""
+	}
+	return "cli:" + name
+}
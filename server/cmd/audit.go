@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	models "github.com/Cprime50/Gopay/models/account"
+	"github.com/Cprime50/Gopay/service"
+	"github.com/spf13/cobra"
+)
+
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "List the latest audit records",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		limit, _ := cmd.Flags().GetInt("limit")
+		ref, _ := cmd.Flags().GetString("account")
+
+		admin, closeDS, err := newAdminService(cmd)
+		if err != nil {
+			return err
+		}
+		defer closeDS()
+
+		filter := models.AuditFilter{Limit: limit}
+		if ref != "" {
+			account, err := admin.FindAccount(cmd.Context(), ref)
+			if err != nil {
+				return err
+			}
+			filter.TargetType, filter.TargetID = service.TargetAccount, account.ID.String()
+		}
+		records, err := admin.AuditLog(cmd.Context(), filter)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "TIME\tACTOR\tACTION\tTARGET\tDETAILS")
+		for _, r := range records {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s:%s\t%s\n", r.CreatedAt.Format(time.RFC3339), r.Actor, r.Action, r.TargetType, r.TargetID, r.Details)
+		}
+		return w.Flush()
+	},
+}
+
+func init() {
+	auditCmd.Flags().Int("limit", 50, "number of records to list")
+	auditCmd.Flags().String("account", "", "only list records for this account (ID, account number or email)")
+	rootCmd.AddCommand(auditCmd)
+}
@@ -0,0 +1,23 @@
+package cmd
+
+import (
+	"context"
+
+	"github.com/Cprime50/Gopay/events"
+	"github.com/Cprime50/Gopay/helper"
+	models "github.com/Cprime50/Gopay/models/account"
+	"github.com/Cprime50/Gopay/service"
+)
+
+// registerSubscribers subscribes the in process handlers of domain
+// events to bus, which the outbox relay publishes to
+func registerSubscribers(bus *events.Bus, accounts models.AccountRepository, notifier service.Notifier, webhooks *service.WebhookService, texts *service.SMSService, updates service.UpdatePublisher) {
+	bus.Subscribe(events.All, "notifications", service.NotifyEvents(accounts, notifier))
+	bus.Subscribe(events.All, "webhooks", webhooks.HandleEvent)
+	bus.Subscribe(events.All, "sms_alerts", texts.HandleEvent)
+	bus.Subscribe(events.All, "realtime", service.PublishUpdates(accounts, updates))
+	bus.Subscribe(events.All, "log", func(ctx context.Context, event events.Event) error {
+		helper.Logger(ctx).Debug("event", "event_id", event.ID, "type", event.Type, "aggregate_id", event.AggregateID)
+		return nil
+	})
+}
@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Cprime50/Gopay/config"
+	"github.com/Cprime50/Gopay/db"
+	"github.com/Cprime50/Gopay/queue"
+	"github.com/Cprime50/Gopay/service"
+	"github.com/google/uuid"
+	"github.com/spf13/cobra"
+)
+
+// registerJobs registers the handler of every job type on worker,
+// serve runs them and the jobs command lists their queues.
+// notifications delivers queued notifications
+func registerJobs(worker *queue.Worker, notifications service.Notifier, webhooks *service.WebhookService, texts *service.SMSService) {
+	service.HandleNotifications(worker, notifications)
+	webhooks.HandleWebhooks(worker)
+	texts.HandleSMS(worker)
+}
+
+// withQueue connects to redis and runs fn with the job queue
+func withQueue(cmd *cobra.Command, fn func(jobs *queue.Queue) error) error {
+	cfg := loadConfig()
+	rdb, err := db.OpenRedis(cfg.Redis)
+	if err != nil {
+		return err
+	}
+	defer rdb.Close()
+	return fn(queue.New(rdb, cfg.Jobs))
+}
+
+var jobsCmd = &cobra.Command{
+	Use:   "jobs",
+	Short: "Inspect the background job queues and retry dead jobs",
+}
+
+var jobsStatsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Count the jobs of every queue by state",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withQueue(cmd, func(jobs *queue.Queue) error {
+			// only the queues are listed, so the handlers need no repositories
+			worker := jobs.NewWorker()
+			registerJobs(worker, service.LogNotifier{}, service.NewWebhookService(nil, nil, jobs, nil, config.Webhooks{}), service.NewSMSService(nil, nil, nil, nil, jobs, nil, config.SMS{}))
+
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "QUEUE\tREADY\tDELAYED\tACTIVE\tDEAD")
+			for _, name := range worker.Queues() {
+				stats, err := jobs.Stats(cmd.Context(), name)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\n", name, stats.Ready, stats.Delayed, stats.Active, stats.Dead)
+			}
+			return w.Flush()
+		})
+	},
+}
+
+var jobsDeadCmd = &cobra.Command{
+	Use:   "dead QUEUE",
+	Short: "List the latest dead jobs of a queue",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		limit, _ := cmd.Flags().GetInt("limit")
+		return withQueue(cmd, func(jobs *queue.Queue) error {
+			dead, err := jobs.Dead(cmd.Context(), args[0], limit)
+			if err != nil {
+				return err
+			}
+
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "ID\tTYPE\tFAILED\tATTEMPTS\tERROR")
+			for _, job := range dead {
+				failed := ""
+				if job.FailedAt != nil {
+					failed = job.FailedAt.Format(time.RFC3339)
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\n", job.ID, job.Type, failed, job.Attempts, job.LastError)
+			}
+			return w.Flush()
+		})
+	},
+}
+
+var jobsRetryCmd = &cobra.Command{
+	Use:   "retry QUEUE JOB_ID",
+	Short: "Move a dead job back to its queue with fresh attempts",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		id, err := uuid.Parse(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid job ID %q", args[1])
+		}
+		return withQueue(cmd, func(jobs *queue.Queue) error {
+			if err := jobs.Retry(cmd.Context(), args[0], id); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "requeued %s\n", id)
+			return nil
+		})
+	},
+}
+
+func init() {
+	jobsDeadCmd.Flags().Int("limit", 50, "number of jobs to list")
+	jobsCmd.AddCommand(jobsStatsCmd, jobsDeadCmd, jobsRetryCmd)
+	rootCmd.AddCommand(jobsCmd)
+}
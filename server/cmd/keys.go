@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var keysCmd = &cobra.Command{
+	Use:   "keys",
+	Short: "Manage the token signing keys",
+}
+
+var keysRotateCmd = &cobra.Command{
+	Use:   "rotate",
+	Short: "Replace the signing key pair, invalidating issued ID tokens",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		actor, err := actor(cmd)
+		if err != nil {
+			return err
+		}
+		admin, closeDS, err := newAdminService(cmd)
+		if err != nil {
+			return err
+		}
+		defer closeDS()
+
+		if err := admin.RotateKeys(cmd.Context(), actor); err != nil {
+			return err
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), "signing keys rotated")
+		return nil
+	},
+}
+
+func init() {
+	addActorFlag(keysCmd)
+	keysCmd.AddCommand(keysRotateCmd)
+	rootCmd.AddCommand(keysCmd)
+}
@@ -0,0 +1,172 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Cprime50/Gopay/db"
+	"github.com/Cprime50/Gopay/migrations"
+	"github.com/spf13/cobra"
+)
+
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Apply, roll back and inspect database migrations",
+}
+
+var migrateUpCmd = &cobra.Command{
+	Use:   "up",
+	Short: "Apply pending migrations",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		steps, _ := cmd.Flags().GetInt("steps")
+		migrator, err := newMigrator()
+		if err != nil {
+			return err
+		}
+
+		applied, err := migrator.Up(cmd.Context(), steps)
+		for _, m := range applied {
+			fmt.Fprintf(cmd.OutOrStdout(), "applied %s\n", m)
+		}
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Fprintln(cmd.OutOrStdout(), "no pending migrations")
+		}
+		return nil
+	},
+}
+
+var migrateDownCmd = &cobra.Command{
+	Use:   "down",
+	Short: "Roll back the latest migration, or more with --steps or --all",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		steps, _ := cmd.Flags().GetInt("steps")
+		all, _ := cmd.Flags().GetBool("all")
+		if all {
+			steps = 0
+		} else if steps < 1 {
+			return fmt.Errorf("--steps must be at least 1, use --all to roll back everything")
+		}
+
+		migrator, err := newMigrator()
+		if err != nil {
+			return err
+		}
+
+		rolledBack, err := migrator.Down(cmd.Context(), steps)
+		for _, m := range rolledBack {
+			fmt.Fprintf(cmd.OutOrStdout(), "rolled back %s\n", m)
+		}
+		if err != nil {
+			return err
+		}
+		if len(rolledBack) == 0 {
+			fmt.Fprintln(cmd.OutOrStdout(), "no migrations to roll back")
+		}
+		return nil
+	},
+}
+
+var migrateStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "List migrations and whether they are applied",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		migrator, err := newMigrator()
+		if err != nil {
+			return err
+		}
+		statuses, err := migrator.Status(cmd.Context())
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+		for _, s := range statuses {
+			state, appliedAt := "pending", ""
+			switch {
+			case s.Dirty:
+				state = "dirty"
+			case s.Missing:
+				state = "missing file"
+			case s.Modified:
+				state = "modified"
+			case s.Applied:
+				state = "applied"
+			}
+			if s.Applied {
+				appliedAt = s.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\t%s\n", s.Version, s.Name, state, appliedAt)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+
+		// a non zero exit lets scripts and deploys gate on the schema
+		return migrator.Check(cmd.Context())
+	},
+}
+
+var migrateCreateCmd = &cobra.Command{
+	Use:   "create NAME",
+	Short: "Create empty up and down files for a new migration",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir, _ := cmd.Flags().GetString("dir")
+		up, down, err := migrations.Create(dir, args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "created %s\ncreated %s\n", up, down)
+		return nil
+	},
+}
+
+var migrateForceCmd = &cobra.Command{
+	Use:   "force VERSION",
+	Short: "Mark a dirty migration as applied once it has been fixed by hand",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		version, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid version %q", args[0])
+		}
+		migrator, err := newMigrator()
+		if err != nil {
+			return err
+		}
+		if err := migrator.Force(cmd.Context(), version); err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "forced version %04d\n", version)
+		return nil
+	},
+}
+
+func init() {
+	migrateUpCmd.Flags().Int("steps", 0, "number of migrations to apply, all if 0")
+	migrateDownCmd.Flags().Int("steps", 1, "number of migrations to roll back")
+	migrateDownCmd.Flags().Bool("all", false, "roll back every migration")
+	migrateCreateCmd.Flags().String("dir", migrations.Dir, "directory the migration files are written to")
+
+	migrateCmd.AddCommand(migrateUpCmd, migrateDownCmd, migrateStatusCmd, migrateCreateCmd, migrateForceCmd)
+	rootCmd.AddCommand(migrateCmd)
+}
+
+// newMigrator connects to postgres for the migrate commands
+func newMigrator() (*migrations.Migrator, error) {
+	cfg := loadConfig()
+	gormDB, err := db.OpenPostgres(cfg.Database)
+	if err != nil {
+		return nil, err
+	}
+	return migrations.New(gormDB)
+}
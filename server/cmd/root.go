@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"log/slog"
+	"os"
+
+	"github.com/Cprime50/Gopay/config"
+	"github.com/Cprime50/Gopay/helper"
+	"github.com/spf13/cobra"
+)
+
+var rootCmd = &cobra.Command{
+	Use:   "gopay",
+	Short: "Gopay API server and operations tools",
+	// running gopay with no command serves the API, as it did before there were commands
+	Run: func(cmd *cobra.Command, args []string) {
+		serveApp()
+	},
+	SilenceUsage: true,
+}
+
+// Execute runs the command given on the command line
+func Execute() {
+	if err := rootCmd.Execute(); err != nil {
+		os.Exit(1)
+	}
+}
+
+// loadConfig loads the config from .env, the optional CONFIG_FILE and
+// the environment and sets up logging, exiting if the config is invalid
+func loadConfig() *config.Config {
+	cfg, warnings, err := config.Load("")
+	if err != nil {
+		fatal("Error loading config", err)
+	}
+
+	// structured json logs, secrets and PII are redacted by the handler
+	slog.SetDefault(helper.NewLogger(os.Stderr, cfg.Log.LogLevel()))
+	for _, warning := range warnings {
+		slog.Warn(warning)
+	}
+	slog.Info("config loaded successfully", "env", cfg.Env)
+	return cfg
+}
+
+// fatal logs err and exits, the structured counterpart of log.Fatal
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
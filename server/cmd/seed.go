@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/Cprime50/Gopay/db"
+	"github.com/Cprime50/Gopay/migrations"
+	models "github.com/Cprime50/Gopay/models/account"
+	"github.com/Cprime50/Gopay/seed"
+	"github.com/spf13/cobra"
+)
+
+var seedCmd = &cobra.Command{
+	Use:   "seed [SET...]",
+	Short: "Load seed data, the sets for APP_ENV unless named",
+	Long: `Load seed data. Every set can be run again safely, existing data is left alone.
+
+Without arguments the sets for APP_ENV are loaded: roles in production and
+staging, roles and demo accounts in development and test. The bootstrap admin
+is created too if there is no admin account yet.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if list, _ := cmd.Flags().GetBool("list"); list {
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "SET\tPRODUCTION\tDESCRIPTION")
+			for _, set := range seed.Sets() {
+				fmt.Fprintf(w, "%s\t%t\t%s\n", set.Name, set.Production, set.Description)
+			}
+			return w.Flush()
+		}
+
+		cfg := loadConfig()
+		names := args
+		if len(names) == 0 {
+			names = seed.ForEnv(cfg.Env)
+		}
+
+		gormDB, err := db.OpenPostgres(cfg.Database)
+		if err != nil {
+			return err
+		}
+		if sqlDB, err := gormDB.DB(); err == nil {
+			defer sqlDB.Close()
+		}
+
+		migrator, err := migrations.New(gormDB)
+		if err != nil {
+			return err
+		}
+		if err := migrator.Check(cmd.Context()); err != nil {
+			return fmt.Errorf("database schema is not up to date: %w", err)
+		}
+
+		if err := seed.Run(cmd.Context(), gormDB, cfg.IsProduction(), names...); err != nil {
+			return err
+		}
+		for _, name := range names {
+			fmt.Fprintf(cmd.OutOrStdout(), "seeded %s\n", name)
+		}
+
+		admin, password, err := seed.BootstrapAdmin(cmd.Context(), gormDB, cfg.Admin)
+		if err != nil {
+			return err
+		}
+		printBootstrapAdmin(cmd.OutOrStdout(), admin, password)
+		return nil
+	},
+}
+
+func init() {
+	seedCmd.Flags().Bool("list", false, "list the seed sets")
+	rootCmd.AddCommand(seedCmd)
+}
+
+// printBootstrapAdmin tells the operator about a newly created bootstrap
+// admin. A generated password is printed, not logged, as the logs redact it
+func printBootstrapAdmin(w io.Writer, admin *models.Account, password string) {
+	if admin == nil {
+		return
+	}
+	fmt.Fprintf(w, "created bootstrap admin %s, the password must be changed on first login\n", admin.Email)
+	if password != "" {
+		fmt.Fprintf(w, "generated password: %s\n", password)
+	}
+}
@@ -0,0 +1,287 @@
+package cmd
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	db "github.com/Cprime50/Gopay/db"
+	"github.com/Cprime50/Gopay/events"
+	"github.com/Cprime50/Gopay/handler"
+	"github.com/Cprime50/Gopay/metrics"
+	"github.com/Cprime50/Gopay/middleware"
+	"github.com/Cprime50/Gopay/migrations"
+	models "github.com/Cprime50/Gopay/models/account"
+	"github.com/Cprime50/Gopay/notifier"
+	"github.com/Cprime50/Gopay/queue"
+	"github.com/Cprime50/Gopay/realtime"
+	"github.com/Cprime50/Gopay/seed"
+	"github.com/Cprime50/Gopay/service"
+	"github.com/Cprime50/Gopay/sms"
+	"github.com/Cprime50/Gopay/tracing"
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/cobra"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+)
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Run the API server",
+	Run: func(cmd *cobra.Command, args []string) {
+		serveApp()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+}
+
+func serveApp() {
+	cfg := loadConfig()
+
+	// tracing, a no-op unless an OTLP endpoint is configured
+	shutdownTracing, err := tracing.Init(context.Background(), cfg.Tracing)
+	if err != nil {
+		fatal("Error initializing tracing", err)
+	}
+
+	// initialize datasource
+	gormDB, rdb, err := db.InitDS(cfg.Database, cfg.Redis)
+	if err != nil {
+		fatal("Error initializing data sources", err)
+	}
+	defer db.Close(gormDB, rdb)
+
+	if err := tracing.InstrumentDataSources(gormDB, rdb); err != nil {
+		fatal("Error instrumenting data sources", err)
+	}
+
+	sqlDB, err := gormDB.DB()
+	if err != nil {
+		fatal("Error getting postgres connection pool", err)
+	}
+	if err := metrics.RegisterDataSources(sqlDB, rdb); err != nil {
+		fatal("Error registering data source metrics", err)
+	}
+
+	// refuse to start on a schema that's dirty or out of date,
+	// migrations are applied with `gopay migrate up`
+	migrator, err := migrations.New(gormDB)
+	if err != nil {
+		fatal("Error loading migrations", err)
+	}
+	if err := migrator.Check(context.Background()); err != nil {
+		fatal("Database schema is not up to date", err)
+	}
+	// the admin is only created when there's none, other seed data is
+	// loaded on demand with `gopay seed`
+	admin, password, err := seed.BootstrapAdmin(context.Background(), gormDB, cfg.Admin)
+	if err != nil {
+		fatal("Error bootstrapping admin", err)
+	}
+	printBootstrapAdmin(os.Stderr, admin, password)
+
+	// repositories and services
+	accountService := service.NewAccountService(
+		models.NewAccountRepository(gormDB),
+		models.NewRoleRepository(gormDB),
+		models.NewImageRepository(cfg.Cloudinary),
+	)
+	tokenService := service.NewTokenService(models.NewTokenRepository(rdb), cfg.Token)
+
+	// background jobs, each service registers the jobs it runs
+	jobs := queue.New(rdb, cfg.Jobs)
+	worker := jobs.NewWorker()
+	webhookService := service.NewWebhookService(
+		models.NewAccountRepository(gormDB),
+		models.NewWebhookRepository(gormDB),
+		jobs,
+		service.QueueNotifier{Queue: jobs},
+		cfg.Webhooks,
+	)
+	// notifications are emailed by the worker, everything else only enqueues them
+	mailer, err := notifier.NewMailer(cfg.Mail)
+	if err != nil {
+		fatal("Error setting up the mailer", err)
+	}
+	templates, err := notifier.LoadTemplates()
+	if err != nil {
+		fatal("Error loading email templates", err)
+	}
+	email := notifier.NewEmail(models.NewAccountRepository(gormDB), mailer, templates, cfg.Mail.From)
+	// and saved to the inbox, on the channels each account chose
+	notificationService := service.NewNotificationService(models.NewNotificationRepository(gormDB), email)
+	// texts are sent by the worker too
+	provider, err := sms.NewProvider(cfg.SMS)
+	if err != nil {
+		fatal("Error setting up the sms provider", err)
+	}
+	smsService := service.NewSMSService(
+		models.NewAccountRepository(gormDB),
+		models.NewOTPRepository(rdb),
+		models.NewSMSUsageRepository(rdb),
+		models.NewNotificationRepository(gormDB),
+		jobs,
+		provider,
+		cfg.SMS,
+	)
+	registerJobs(worker, notificationService, webhookService, smsService)
+
+	scheduleService := service.NewScheduleService(
+		models.NewAccountRepository(gormDB),
+		models.NewScheduleRepository(gormDB),
+		models.NewLedgerRepository(gormDB),
+		models.NewBeneficiaryRepository(gormDB),
+		service.QueueNotifier{Queue: jobs},
+		cfg.Scheduler,
+		cfg.Beneficiaries,
+	)
+	beneficiaryService := service.NewBeneficiaryService(models.NewAccountRepository(gormDB), models.NewBeneficiaryRepository(gormDB), cfg.Beneficiaries)
+
+	// domain events, relayed from the outbox to the subscribers in this
+	// process and the redis stream
+	bus := events.NewBus()
+	// live updates are fanned out to every instance's streams over redis
+	hub := realtime.NewHub(rdb, cfg.Realtime)
+	registerSubscribers(bus, models.NewAccountRepository(gormDB), service.QueueNotifier{Queue: jobs}, webhookService, smsService, hub)
+	relay := events.NewRelay(
+		models.NewOutboxRepository(gormDB),
+		cfg.Outbox,
+		bus,
+		events.NewStream(rdb, cfg.Outbox.Stream, cfg.Outbox.StreamMaxLen),
+	)
+
+	//Generate key
+	_err := tokenService.GenerateRSAKeys()
+	if _err != nil {
+		fatal("Error gerating rsa keys", _err)
+	}
+
+	router := gin.New()
+	router.Use(gin.Recovery(), otelgin.Middleware(tracing.ServiceName), middleware.RequestID(), middleware.RequestLogger(), metrics.Middleware())
+	// handler := handler.Handler{}
+	newHandler, err := handler.NewHandler(router, cfg, handler.Services{
+		AccountService:      accountService,
+		TokenService:        tokenService,
+		ScheduleService:     scheduleService,
+		WebhookService:      webhookService,
+		SMSService:          smsService,
+		NotificationService: notificationService,
+		BeneficiaryService:  beneficiaryService,
+		Realtime:            hub,
+		RateLimiter:         middleware.NewRateLimiter(rdb),
+		ReadinessChecks: map[string]handler.DependencyCheck{
+			"postgres": sqlDB.PingContext,
+			"redis": func(ctx context.Context) error {
+				return rdb.Ping(ctx).Err()
+			},
+			"signing_keys": func(ctx context.Context) error {
+				return tokenService.CheckSigningKeys()
+			},
+		},
+	})
+	if err != nil {
+		fatal("Error setting up handler", err)
+	}
+	newHandler.SetupRoutes()
+	srv := &http.Server{
+		Addr:         cfg.Server.Addr(), // Good practice to set timeouts to avoid Slow-loris attacks.
+		WriteTimeout: cfg.Server.WriteTimeout,
+		ReadTimeout:  cfg.Server.ReadTimeout,
+		IdleTimeout:  cfg.Server.IdleTimeout,
+		Handler:      router,
+	}
+
+	// start receiving traffic
+	newHandler.SetReady(true)
+
+	go func() {
+		// service connections
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			fatal("listen", err)
+		}
+	}()
+
+	// run scheduled transfers until shutdown, workers on other
+	// instances claim each run so it's only made once
+	schedulerCtx, stopScheduler := context.WithCancel(context.Background())
+	schedulerDone := make(chan struct{})
+	go func() {
+		defer close(schedulerDone)
+		if cfg.Scheduler.Enabled {
+			scheduleService.Run(schedulerCtx)
+		}
+	}()
+
+	// relay outbox events until shutdown
+	relayCtx, stopRelay := context.WithCancel(context.Background())
+	relayDone := make(chan struct{})
+	go func() {
+		defer close(relayDone)
+		if cfg.Outbox.Enabled {
+			relay.Run(relayCtx)
+		}
+	}()
+
+	// wake the update streams of this instance until shutdown
+	hubCtx, stopHub := context.WithCancel(context.Background())
+	go hub.Run(hubCtx)
+
+	if cfg.Jobs.Enabled {
+		worker.Start()
+	}
+
+	// Wait for interrupt signal to gracefully shutdown the server with
+	// a timeout of SHUTDOWN_TIMEOUT.
+	quit := make(chan os.Signal, 1)
+	// kill (no param) default send syscanll.SIGTERM
+	// kill -2 is syscall.SIGINT
+	// kill -9 is syscall. SIGKILL but can"t be catch, so don't need add it
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+	slog.Info("Shutdown Server ...")
+
+	// fail readiness first and keep serving for SHUTDOWN_DRAIN, so load
+	// balancers see it and stop routing here before we close
+	newHandler.SetReady(false)
+	time.Sleep(cfg.Server.ShutdownDrain)
+
+	// end the update streams, the server would wait on them until the timeout
+	hub.Close()
+	stopHub()
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		fatal("Server Shutdown", err)
+	}
+	// let a run in progress finish saving its schedule
+	stopScheduler()
+	select {
+	case <-schedulerDone:
+	case <-ctx.Done():
+	}
+	// and the relay finish its batch, events it doesn't get to are relayed on the next start
+	stopRelay()
+	select {
+	case <-relayDone:
+	case <-ctx.Done():
+	}
+	// then let running jobs finish, those that don't in time are retried later
+	if err := worker.Shutdown(ctx); err != nil {
+		slog.Error("error draining jobs", "error", err)
+	}
+	if err := shutdownTracing(ctx); err != nil {
+		slog.Error("error flushing traces", "error", err)
+	}
+	if ctx.Err() != nil {
+		slog.Info("shutdown timeout reached", "timeout", cfg.Server.ShutdownTimeout.String())
+	}
+	slog.Info("Server exiting")
+
+}
@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Cprime50/Gopay/sms"
+	"github.com/spf13/cobra"
+)
+
+var smsCmd = &cobra.Command{
+	Use:   "sms",
+	Short: "Tools for the texts sent to account holders",
+}
+
+var smsStandInCmd = &cobra.Command{
+	Use:   "standin",
+	Short: "Run a local SMS provider the http driver can send to",
+	Long: "Accepts the texts the http sms driver posts, logs them and lists the latest on GET.\n" +
+		"Point the server at it with SMS_DRIVER=http and SMS_URL=http://<addr>/messages",
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		addr, _ := cmd.Flags().GetString("addr")
+		apiKey, _ := cmd.Flags().GetString("api-key")
+
+		fmt.Fprintf(cmd.OutOrStdout(), "sms stand in listening on %s\n", addr)
+		srv := &http.Server{
+			Addr:              addr,
+			Handler:           sms.NewStandIn(apiKey),
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+		return srv.ListenAndServe()
+	},
+}
+
+func init() {
+	smsStandInCmd.Flags().String("addr", "localhost:8026", "address to listen on")
+	smsStandInCmd.Flags().String("api-key", "", "bearer token required of senders, none if empty")
+	smsCmd.AddCommand(smsStandInCmd)
+	rootCmd.AddCommand(smsCmd)
+}
@@ -0,0 +1,374 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+// Config holds every setting the service needs. It is loaded once on
+// start up by Load and passed explicitly to the packages that need it.
+// yaml tags name the keys of the optional config file and env tags the
+// environment variables that override them
+type Config struct {
+	Env           string        `yaml:"env" env:"APP_ENV"`
+	Server        Server        `yaml:"server"`
+	Database      Database      `yaml:"database"`
+	Redis         Redis         `yaml:"redis"`
+	Token         Token         `yaml:"token"`
+	Cloudinary    Cloudinary    `yaml:"cloudinary"`
+	Admin         Admin         `yaml:"admin"`
+	Log           Log           `yaml:"log"`
+	Metrics       Metrics       `yaml:"metrics"`
+	Tracing       Tracing       `yaml:"tracing"`
+	Scheduler     Scheduler     `yaml:"scheduler"`
+	Jobs          Jobs          `yaml:"jobs"`
+	Outbox        Outbox        `yaml:"outbox"`
+	Webhooks      Webhooks      `yaml:"webhooks"`
+	Mail          Mail          `yaml:"mail"`
+	SMS           SMS           `yaml:"sms"`
+	Realtime      Realtime      `yaml:"realtime"`
+	Beneficiaries Beneficiaries `yaml:"beneficiaries"`
+}
+
+// Server holds the http server and handler settings
+type Server struct {
+	Port            string        `yaml:"port" env:"PORT"`
+	BaseURL         string        `yaml:"base_url" env:"ACCOUNT_API_URL"`
+	HandlerTimeout  time.Duration `yaml:"handler_timeout" env:"HANDLER_TIMEOUT"`
+	MaxBodyBytes    int64         `yaml:"max_body_bytes" env:"MAX_BODY_BYTES"`
+	ReadTimeout     time.Duration `yaml:"read_timeout" env:"READ_TIMEOUT"`
+	WriteTimeout    time.Duration `yaml:"write_timeout" env:"WRITE_TIMEOUT"`
+	IdleTimeout     time.Duration `yaml:"idle_timeout" env:"IDLE_TIMEOUT"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT"`
+	// ShutdownDrain is how long to keep serving after readiness fails on
+	// shutdown, so load balancers stop routing here before we close
+	ShutdownDrain time.Duration `yaml:"shutdown_drain" env:"SHUTDOWN_DRAIN"`
+	// TrustedProxies are the IPs or CIDRs of the proxies whose
+	// X-Forwarded-For is believed, eg 10.0.0.0/8. When empty the client
+	// IP is always the peer's, so the header can't dodge IP rate limits
+	TrustedProxies []string `yaml:"trusted_proxies" env:"TRUSTED_PROXIES"`
+}
+
+// Addr is the address the http server listens on
+func (s Server) Addr() string {
+	return ":" + s.Port
+}
+
+// Database holds the postgres connection settings
+type Database struct {
+	Host         string `yaml:"host" env:"DB_HOST"`
+	User         string `yaml:"user" env:"DB_USER"`
+	Password     string `yaml:"password" env:"DB_PASSWORD"`
+	Name         string `yaml:"name" env:"DB_NAME"`
+	Port         string `yaml:"port" env:"DB_PORT"`
+	SSLMode      string `yaml:"sslmode" env:"DB_SSLMODE"`
+	MaxIdleConns int    `yaml:"max_idle_conns" env:"DB_MAX_IDLE_CONNS"`
+	MaxOpenConns int    `yaml:"max_open_conns" env:"DB_MAX_OPEN_CONNS"`
+}
+
+// DSN is the postgres connection string
+func (d Database) DSN() string {
+	return fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=%s", d.Host, d.User, d.Password, d.Name, d.Port, d.SSLMode)
+}
+
+// Redis holds the redis connection settings
+type Redis struct {
+	Host     string `yaml:"host" env:"REDIS_HOST"`
+	Port     string `yaml:"port" env:"REDIS_PORT"`
+	Password string `yaml:"password" env:"REDIS_PASSWORD"`
+	DB       int    `yaml:"db" env:"REDIS_DB"`
+}
+
+// Addr is the host:port redis listens on
+func (r Redis) Addr() string {
+	return net.JoinHostPort(r.Host, r.Port)
+}
+
+// Token holds the settings used to sign and validate tokens
+type Token struct {
+	PrivKeyFile     string        `yaml:"priv_key_file" env:"PRIV_KEY_FILE"`
+	PubKeyFile      string        `yaml:"pub_key_file" env:"PUB_KEY_FILE"`
+	IDTokenExp      time.Duration `yaml:"id_token_exp" env:"TOKEN_EXP"`
+	RefreshTokenExp time.Duration `yaml:"refresh_token_exp" env:"REFRESH_TOKEN_EXP"`
+	RefreshSecret   string        `yaml:"refresh_secret" env:"REFRESH_SECRET"`
+}
+
+// Cloudinary holds the credentials used for image uploads
+type Cloudinary struct {
+	CloudName    string `yaml:"cloud_name" env:"CLOUDINARY_CLOUD_NAME"`
+	APIKey       string `yaml:"api_key" env:"CLOUDINARY_API_KEY"`
+	APISecret    string `yaml:"api_secret" env:"CLOUDINARY_API_SECRET"`
+	UploadFolder string `yaml:"upload_folder" env:"CLOUDINARY_UPLOAD_FOLDER"`
+}
+
+// Admin holds the bootstrap admin, created once when there is no admin
+// account yet. When no password is set one is generated and printed,
+// either way it must be changed on first login
+type Admin struct {
+	Email     string `yaml:"email" env:"ADMIN_EMAIL"`
+	Password  string `yaml:"password" env:"ADMIN_PASSWORD"`
+	FirstName string `yaml:"first_name" env:"ADMIN_FIRSTNAME"`
+	LastName  string `yaml:"last_name" env:"ADMIN_LASTNAME"`
+}
+
+// Log holds the logger settings
+type Log struct {
+	Level string `yaml:"level" env:"LOG_LEVEL"`
+}
+
+// Metrics holds the /metrics settings
+type Metrics struct {
+	// Token is the bearer token scrapers must present, required outside
+	// development. When empty only private network scrapes are allowed
+	Token string `yaml:"token" env:"METRICS_TOKEN"`
+}
+
+// Tracing holds the OpenTelemetry exporter settings
+type Tracing struct {
+	// Endpoint is the OTLP/HTTP collector url, tracing is disabled when empty
+	Endpoint string `yaml:"endpoint" env:"OTEL_EXPORTER_OTLP_ENDPOINT"`
+}
+
+// Scheduler holds the settings of the worker running scheduled transfers
+type Scheduler struct {
+	// Enabled runs the worker in the server, turn it off on replicas
+	// that should only serve traffic
+	Enabled bool `yaml:"enabled" env:"SCHEDULER_ENABLED"`
+	// Interval is how often due transfers are looked for
+	Interval  time.Duration `yaml:"interval" env:"SCHEDULER_INTERVAL"`
+	BatchSize int           `yaml:"batch_size" env:"SCHEDULER_BATCH_SIZE"`
+	// MaxAttempts bounds the tries at a transfer failing for transient
+	// reasons, retried after RetryBackoff doubling each time
+	MaxAttempts  int           `yaml:"max_attempts" env:"SCHEDULER_MAX_ATTEMPTS"`
+	RetryBackoff time.Duration `yaml:"retry_backoff" env:"SCHEDULER_RETRY_BACKOFF"`
+	// Lease is how long a worker holds a transfer it is running,
+	// after which another may pick it up if it hasn't finished
+	Lease time.Duration `yaml:"lease" env:"SCHEDULER_LEASE"`
+}
+
+// Jobs holds the settings of the background job queue and its workers
+type Jobs struct {
+	// Enabled runs the workers in the server, jobs can still be enqueued without them
+	Enabled bool `yaml:"enabled" env:"JOBS_ENABLED"`
+	// Concurrency is the number of workers per queue, eg notifications=4,default=2.
+	// Queues not listed get one
+	Concurrency  map[string]int `yaml:"concurrency" env:"JOBS_CONCURRENCY"`
+	PollInterval time.Duration  `yaml:"poll_interval" env:"JOBS_POLL_INTERVAL"`
+	// MaxAttempts is how many times a job is tried before it's dead lettered,
+	// retried after Backoff doubling each time up to MaxBackoff
+	MaxAttempts int           `yaml:"max_attempts" env:"JOBS_MAX_ATTEMPTS"`
+	Backoff     time.Duration `yaml:"backoff" env:"JOBS_BACKOFF"`
+	MaxBackoff  time.Duration `yaml:"max_backoff" env:"JOBS_MAX_BACKOFF"`
+	// Lease is how long a job may run, after which it's cancelled and
+	// another worker may pick it up
+	Lease time.Duration `yaml:"lease" env:"JOBS_LEASE"`
+}
+
+// Outbox holds the settings of the relay publishing domain events from the outbox
+type Outbox struct {
+	// Enabled runs the relay in the server, events are still written to the outbox without it
+	Enabled   bool          `yaml:"enabled" env:"OUTBOX_ENABLED"`
+	Interval  time.Duration `yaml:"interval" env:"OUTBOX_INTERVAL"`
+	BatchSize int           `yaml:"batch_size" env:"OUTBOX_BATCH_SIZE"`
+	// Lease is how long a relay holds the events it's publishing
+	Lease time.Duration `yaml:"lease" env:"OUTBOX_LEASE"`
+	// MaxBackoff caps the wait before retrying an event that failed to
+	// publish, which starts at Interval and doubles each attempt
+	MaxBackoff time.Duration `yaml:"max_backoff" env:"OUTBOX_MAX_BACKOFF"`
+	// Stream is the redis stream events are added to, trimmed to about StreamMaxLen
+	Stream       string `yaml:"stream" env:"OUTBOX_STREAM"`
+	StreamMaxLen int64  `yaml:"stream_max_len" env:"OUTBOX_STREAM_MAX_LEN"`
+	// Retention is how long published events are kept in the outbox
+	Retention time.Duration `yaml:"retention" env:"OUTBOX_RETENTION"`
+}
+
+// Webhooks holds the settings of outgoing webhook deliveries, retried
+// with the backoff of the job queue
+type Webhooks struct {
+	// Timeout bounds each delivery request
+	Timeout     time.Duration `yaml:"timeout" env:"WEBHOOKS_TIMEOUT"`
+	MaxAttempts int           `yaml:"max_attempts" env:"WEBHOOKS_MAX_ATTEMPTS"`
+	// DisableAfter consecutive failed attempts disable an endpoint
+	DisableAfter int `yaml:"disable_after" env:"WEBHOOKS_DISABLE_AFTER"`
+	// MaxEndpoints is how many endpoints an account may register
+	MaxEndpoints int `yaml:"max_endpoints" env:"WEBHOOKS_MAX_ENDPOINTS"`
+	// AllowInsecure allows http URLs and private, loopback and link local
+	// addresses, for local development only
+	AllowInsecure bool `yaml:"allow_insecure" env:"WEBHOOKS_ALLOW_INSECURE"`
+}
+
+// Mail holds the settings of the emails notifications are sent as
+type Mail struct {
+	// Driver is smtp, file to write every email to Dir, or log to only log them
+	Driver string `yaml:"driver" env:"MAIL_DRIVER"`
+	// From is the sender, eg Gopay <no-reply@gopay.com>
+	From string `yaml:"from" env:"MAIL_FROM"`
+	Dir  string `yaml:"dir" env:"MAIL_DIR"`
+	SMTP SMTP   `yaml:"smtp"`
+}
+
+// SMTP holds the settings of the smtp mail driver
+type SMTP struct {
+	Host     string `yaml:"host" env:"SMTP_HOST"`
+	Port     string `yaml:"port" env:"SMTP_PORT"`
+	Username string `yaml:"username" env:"SMTP_USERNAME"`
+	Password string `yaml:"password" env:"SMTP_PASSWORD"`
+	// TLS is starttls to upgrade the connection, tls to connect over tls
+	// or none, for local capture servers only
+	TLS string `yaml:"tls" env:"SMTP_TLS"`
+	// Timeout bounds sending each email
+	Timeout time.Duration `yaml:"timeout" env:"SMTP_TIMEOUT"`
+}
+
+// SMS holds the settings of the texts sent for one time codes and opted
+// in debit and credit alerts
+type SMS struct {
+	// Driver is http to post texts to the provider at URL, or log to only log them
+	Driver  string        `yaml:"driver" env:"SMS_DRIVER"`
+	URL     string        `yaml:"url" env:"SMS_URL"`
+	APIKey  string        `yaml:"api_key" env:"SMS_API_KEY"`
+	Sender  string        `yaml:"sender" env:"SMS_SENDER"`
+	Timeout time.Duration `yaml:"timeout" env:"SMS_TIMEOUT"`
+	// DailySegments caps the segments texted to an account a day, texts
+	// are billed per 160 characters, or 70 with characters outside GSM 7
+	DailySegments int `yaml:"daily_segments" env:"SMS_DAILY_SEGMENTS"`
+	// MinAlertAmount is the smallest debit or credit texted
+	MinAlertAmount float64 `yaml:"min_alert_amount" env:"SMS_MIN_ALERT_AMOUNT"`
+	// OTPTTL is how long a code is valid, OTPCooldown how long before another can be sent
+	OTPTTL         time.Duration `yaml:"otp_ttl" env:"SMS_OTP_TTL"`
+	OTPCooldown    time.Duration `yaml:"otp_cooldown" env:"SMS_OTP_COOLDOWN"`
+	OTPMaxAttempts int           `yaml:"otp_max_attempts" env:"SMS_OTP_MAX_ATTEMPTS"`
+}
+
+// Realtime holds the settings of the live updates streamed to signed in clients
+type Realtime struct {
+	// Channel is the redis pub/sub channel waking the streams on every instance
+	Channel string `yaml:"channel" env:"REALTIME_CHANNEL"`
+	// Heartbeat is how often an idle stream is sent a comment, so proxies
+	// keep it open, and its token checked again
+	Heartbeat time.Duration `yaml:"heartbeat" env:"REALTIME_HEARTBEAT"`
+	// History is about how many updates are kept per account for clients
+	// resuming after a reconnect, for HistoryTTL after the last one
+	History    int64         `yaml:"history" env:"REALTIME_HISTORY"`
+	HistoryTTL time.Duration `yaml:"history_ttl" env:"REALTIME_HISTORY_TTL"`
+	// MaxStreams is how many streams an account may have open on each instance
+	MaxStreams int `yaml:"max_streams" env:"REALTIME_MAX_STREAMS"`
+}
+
+// Beneficiaries holds the settings of the recipients accounts save
+type Beneficiaries struct {
+	// Max is how many beneficiaries an account may save
+	Max int `yaml:"max" env:"BENEFICIARIES_MAX"`
+	// CoolOff is how long after a beneficiary is added before a transfer
+	// to it can be due, 0 for none. While set, scheduled transfers can only go
+	// to beneficiaries
+	CoolOff time.Duration `yaml:"cool_off" env:"BENEFICIARIES_COOL_OFF"`
+}
+
+// Default returns the settings used when neither the config file
+// nor the environment set a value
+func Default() *Config {
+	return &Config{
+		Env: "development",
+		Server: Server{
+			Port:            "8082",
+			BaseURL:         "localhost:8082",
+			HandlerTimeout:  20 * time.Second,
+			MaxBodyBytes:    10 << 20,
+			ReadTimeout:     15 * time.Second,
+			WriteTimeout:    15 * time.Second,
+			IdleTimeout:     60 * time.Second,
+			ShutdownTimeout: 5 * time.Second,
+			ShutdownDrain:   5 * time.Second,
+		},
+		Database: Database{
+			Port:         "5432",
+			SSLMode:      "disable",
+			MaxIdleConns: 10,
+			MaxOpenConns: 100,
+		},
+		Redis: Redis{
+			Host: "localhost",
+			Port: "6379",
+		},
+		Token: Token{
+			IDTokenExp:      30 * time.Minute,
+			RefreshTokenExp: 72 * time.Hour,
+		},
+		Admin: Admin{
+			FirstName: "Gopay",
+			LastName:  "Admin",
+		},
+		Log: Log{
+			Level: "info",
+		},
+		Scheduler: Scheduler{
+			Enabled:      true,
+			Interval:     30 * time.Second,
+			BatchSize:    100,
+			MaxAttempts:  5,
+			RetryBackoff: time.Minute,
+			Lease:        5 * time.Minute,
+		},
+		Jobs: Jobs{
+			Enabled:      true,
+			Concurrency:  map[string]int{},
+			PollInterval: time.Second,
+			MaxAttempts:  8,
+			Backoff:      5 * time.Second,
+			MaxBackoff:   time.Hour,
+			Lease:        5 * time.Minute,
+		},
+		Outbox: Outbox{
+			Enabled:      true,
+			Interval:     time.Second,
+			BatchSize:    100,
+			Lease:        time.Minute,
+			MaxBackoff:   10 * time.Minute,
+			Stream:       "gopay:events",
+			StreamMaxLen: 100000,
+			Retention:    7 * 24 * time.Hour,
+		},
+		Webhooks: Webhooks{
+			Timeout:      10 * time.Second,
+			MaxAttempts:  8,
+			DisableAfter: 20,
+			MaxEndpoints: 10,
+		},
+		Mail: Mail{
+			Driver: "log",
+			From:   "Gopay <no-reply@gopay.local>",
+			Dir:    "./mail",
+			SMTP: SMTP{
+				Port:    "587",
+				TLS:     "starttls",
+				Timeout: 10 * time.Second,
+			},
+		},
+		SMS: SMS{
+			Driver:         "log",
+			Sender:         "Gopay",
+			Timeout:        10 * time.Second,
+			DailySegments:  20,
+			OTPTTL:         10 * time.Minute,
+			OTPCooldown:    time.Minute,
+			OTPMaxAttempts: 5,
+		},
+		Realtime: Realtime{
+			Channel:    "gopay:realtime",
+			Heartbeat:  15 * time.Second,
+			History:    100,
+			HistoryTTL: 24 * time.Hour,
+			MaxStreams: 10,
+		},
+		Beneficiaries: Beneficiaries{
+			Max: 100,
+		},
+	}
+}
+
+// IsProduction reports whether the service runs in production
+func (c *Config) IsProduction() bool {
+	return c.Env == "production"
+}
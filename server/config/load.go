@@ -0,0 +1,350 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/mail"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// Load builds the config from, in increasing order of precedence,
+// the defaults, the optional yaml file at path and the environment.
+// A .env file in the working directory is loaded into the environment
+// first if present. When path is empty CONFIG_FILE is used, if set.
+// Every invalid setting is reported in the returned error. Settings
+// that are allowed but likely a mistake are returned as warnings, to be
+// logged once logging is set up from the config
+func Load(path string) (*Config, []string, error) {
+	if err := godotenv.Load(".env"); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, nil, fmt.Errorf("error loading .env file: %w", err)
+	}
+	if path == "" {
+		path = os.Getenv("CONFIG_FILE")
+	}
+
+	cfg := Default()
+
+	if path != "" {
+		file, err := os.ReadFile(path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error reading config file: %w", err)
+		}
+		if err := yaml.Unmarshal(file, cfg); err != nil {
+			return nil, nil, fmt.Errorf("error parsing config file %s: %w", path, err)
+		}
+	}
+
+	errs := applyEnv(reflect.ValueOf(cfg).Elem())
+	invalid, warnings := cfg.validate()
+	errs = append(errs, invalid...)
+	if len(errs) > 0 {
+		return nil, nil, fmt.Errorf("invalid config: %w", errors.Join(errs...))
+	}
+	return cfg, warnings, nil
+}
+
+// applyEnv walks the config struct setting every field with an
+// env tag from the matching environment variable when it is set
+func applyEnv(v reflect.Value) []error {
+	var errs []error
+	for i := 0; i < v.NumField(); i++ {
+		field, value := v.Type().Field(i), v.Field(i)
+		if field.Type.Kind() == reflect.Struct {
+			errs = append(errs, applyEnv(value)...)
+			continue
+		}
+
+		name := field.Tag.Get("env")
+		raw, ok := os.LookupEnv(name)
+		if name == "" || !ok || raw == "" {
+			continue
+		}
+		if err := setValue(value, raw); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+	return errs
+}
+
+func setValue(v reflect.Value, raw string) error {
+	switch v.Interface().(type) {
+	case string:
+		v.SetString(raw)
+	case time.Duration:
+		d, err := parseDuration(raw)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+	case int, int64:
+		n, err := strconv.ParseInt(raw, 0, 64)
+		if err != nil {
+			return fmt.Errorf("could not parse %q as int", raw)
+		}
+		v.SetInt(n)
+	case float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return fmt.Errorf("could not parse %q as float", raw)
+		}
+		v.SetFloat(f)
+	case bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("could not parse %q as bool", raw)
+		}
+		v.SetBool(b)
+	case []string:
+		v.Set(reflect.ValueOf(parseList(raw)))
+	case map[string]int:
+		m, err := parseIntMap(raw)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(m))
+	default:
+		return fmt.Errorf("unsupported config type %s", v.Type())
+	}
+	return nil
+}
+
+// parseList parses a comma separated list, eg 10.0.0.0/8,192.168.1.2
+func parseList(raw string) []string {
+	var list []string
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// parseIntMap parses comma separated name=value pairs, eg notifications=4,default=2
+func parseIntMap(raw string) (map[string]int, error) {
+	m := make(map[string]int)
+	for _, pair := range strings.Split(raw, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		n, err := strconv.Atoi(value)
+		if !ok || name == "" || err != nil {
+			return nil, fmt.Errorf("could not parse %q as name=number pairs", raw)
+		}
+		m[name] = n
+	}
+	return m, nil
+}
+
+// parseDuration accepts go durations such as "30m" and, for
+// compatibility with existing env files, plain integers as seconds
+func parseDuration(raw string) (time.Duration, error) {
+	if seconds, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		return time.Duration(seconds) * time.Second, nil
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil {
+		return 0, fmt.Errorf("could not parse %q as duration", raw)
+	}
+	return d, nil
+}
+
+// validate checks every setting and returns all problems found, and
+// warnings about settings that are allowed but likely a mistake
+func (c *Config) validate() ([]error, []string) {
+	var errs []error
+	var warnings []string
+	required := func(name, value string) {
+		if value == "" {
+			errs = append(errs, fmt.Errorf("%s is required", name))
+		}
+	}
+	positive := func(name string, value time.Duration) {
+		if value <= 0 {
+			errs = append(errs, fmt.Errorf("%s must be positive", name))
+		}
+	}
+
+	switch c.Env {
+	case "development", "test", "staging", "production":
+	default:
+		errs = append(errs, fmt.Errorf("APP_ENV must be one of development, test, staging, production, got %q", c.Env))
+	}
+
+	required("PORT", c.Server.Port)
+	positive("HANDLER_TIMEOUT", c.Server.HandlerTimeout)
+	positive("READ_TIMEOUT", c.Server.ReadTimeout)
+	positive("WRITE_TIMEOUT", c.Server.WriteTimeout)
+	positive("IDLE_TIMEOUT", c.Server.IdleTimeout)
+	positive("SHUTDOWN_TIMEOUT", c.Server.ShutdownTimeout)
+	if c.Server.ShutdownDrain < 0 {
+		errs = append(errs, fmt.Errorf("SHUTDOWN_DRAIN must not be negative"))
+	}
+	if c.Server.MaxBodyBytes <= 0 {
+		errs = append(errs, fmt.Errorf("MAX_BODY_BYTES must be positive"))
+	}
+	for _, proxy := range c.Server.TrustedProxies {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			errs = append(errs, fmt.Errorf("TRUSTED_PROXIES must be IPs or CIDRs, got %q", proxy))
+		}
+	}
+
+	required("DB_HOST", c.Database.Host)
+	required("DB_USER", c.Database.User)
+	required("DB_NAME", c.Database.Name)
+	required("DB_PORT", c.Database.Port)
+
+	required("REDIS_HOST", c.Redis.Host)
+	required("REDIS_PORT", c.Redis.Port)
+
+	required("PRIV_KEY_FILE", c.Token.PrivKeyFile)
+	required("PUB_KEY_FILE", c.Token.PubKeyFile)
+	positive("TOKEN_EXP", c.Token.IDTokenExp)
+	positive("REFRESH_TOKEN_EXP", c.Token.RefreshTokenExp)
+	if c.Token.RefreshSecret == "" {
+		if c.IsProduction() {
+			errs = append(errs, fmt.Errorf("REFRESH_SECRET is required in production"))
+		} else {
+			warnings = append(warnings, "REFRESH_SECRET not provided, refresh tokens will not survive a restart")
+		}
+	}
+
+	if c.Metrics.Token == "" && c.Env != "development" {
+		errs = append(errs, fmt.Errorf("METRICS_TOKEN is required outside development"))
+	}
+
+	if c.Admin.Email != "" && !strings.Contains(c.Admin.Email, "@") {
+		errs = append(errs, fmt.Errorf("ADMIN_EMAIL must be an email address, got %q", c.Admin.Email))
+	}
+	if c.Admin.Password != "" && len(c.Admin.Password) < 8 {
+		errs = append(errs, fmt.Errorf("ADMIN_PASSWORD must be at least 8 characters"))
+	}
+
+	positive("SCHEDULER_INTERVAL", c.Scheduler.Interval)
+	positive("SCHEDULER_RETRY_BACKOFF", c.Scheduler.RetryBackoff)
+	positive("SCHEDULER_LEASE", c.Scheduler.Lease)
+	if c.Scheduler.BatchSize <= 0 {
+		errs = append(errs, fmt.Errorf("SCHEDULER_BATCH_SIZE must be positive"))
+	}
+	if c.Scheduler.MaxAttempts <= 0 {
+		errs = append(errs, fmt.Errorf("SCHEDULER_MAX_ATTEMPTS must be positive"))
+	}
+
+	positive("JOBS_POLL_INTERVAL", c.Jobs.PollInterval)
+	positive("JOBS_BACKOFF", c.Jobs.Backoff)
+	positive("JOBS_MAX_BACKOFF", c.Jobs.MaxBackoff)
+	positive("JOBS_LEASE", c.Jobs.Lease)
+	if c.Jobs.MaxAttempts <= 0 {
+		errs = append(errs, fmt.Errorf("JOBS_MAX_ATTEMPTS must be positive"))
+	}
+	for queue, n := range c.Jobs.Concurrency {
+		if n <= 0 {
+			errs = append(errs, fmt.Errorf("JOBS_CONCURRENCY of %s must be positive", queue))
+		}
+	}
+
+	positive("OUTBOX_INTERVAL", c.Outbox.Interval)
+	positive("OUTBOX_LEASE", c.Outbox.Lease)
+	positive("OUTBOX_MAX_BACKOFF", c.Outbox.MaxBackoff)
+	positive("OUTBOX_RETENTION", c.Outbox.Retention)
+	if c.Outbox.BatchSize <= 0 {
+		errs = append(errs, fmt.Errorf("OUTBOX_BATCH_SIZE must be positive"))
+	}
+	if c.Outbox.Stream == "" {
+		errs = append(errs, fmt.Errorf("OUTBOX_STREAM is required"))
+	}
+	if c.Outbox.StreamMaxLen < 0 {
+		errs = append(errs, fmt.Errorf("OUTBOX_STREAM_MAX_LEN must not be negative"))
+	}
+
+	positive("WEBHOOKS_TIMEOUT", c.Webhooks.Timeout)
+	if c.Webhooks.MaxAttempts <= 0 {
+		errs = append(errs, fmt.Errorf("WEBHOOKS_MAX_ATTEMPTS must be positive"))
+	}
+	if c.Webhooks.DisableAfter <= 0 {
+		errs = append(errs, fmt.Errorf("WEBHOOKS_DISABLE_AFTER must be positive"))
+	}
+	if c.Webhooks.MaxEndpoints <= 0 {
+		errs = append(errs, fmt.Errorf("WEBHOOKS_MAX_ENDPOINTS must be positive"))
+	}
+	if c.Webhooks.AllowInsecure && c.IsProduction() {
+		errs = append(errs, fmt.Errorf("WEBHOOKS_ALLOW_INSECURE must not be set in production"))
+	}
+
+	if _, err := mail.ParseAddress(c.Mail.From); err != nil {
+		errs = append(errs, fmt.Errorf("MAIL_FROM must be an email address, got %q", c.Mail.From))
+	}
+	switch c.Mail.Driver {
+	case "smtp":
+		required("SMTP_HOST", c.Mail.SMTP.Host)
+		required("SMTP_PORT", c.Mail.SMTP.Port)
+		positive("SMTP_TIMEOUT", c.Mail.SMTP.Timeout)
+		if c.Mail.SMTP.TLS != "starttls" && c.Mail.SMTP.TLS != "tls" && c.Mail.SMTP.TLS != "none" {
+			errs = append(errs, fmt.Errorf("SMTP_TLS must be one of starttls, tls, none, got %q", c.Mail.SMTP.TLS))
+		}
+	case "file":
+		required("MAIL_DIR", c.Mail.Dir)
+	case "log":
+	default:
+		errs = append(errs, fmt.Errorf("MAIL_DRIVER must be one of smtp, file, log, got %q", c.Mail.Driver))
+	}
+
+	switch c.SMS.Driver {
+	case "http":
+		required("SMS_URL", c.SMS.URL)
+	case "log":
+	default:
+		errs = append(errs, fmt.Errorf("SMS_DRIVER must be one of http, log, got %q", c.SMS.Driver))
+	}
+	positive("SMS_TIMEOUT", c.SMS.Timeout)
+	positive("SMS_OTP_TTL", c.SMS.OTPTTL)
+	if c.SMS.DailySegments <= 0 {
+		errs = append(errs, fmt.Errorf("SMS_DAILY_SEGMENTS must be positive"))
+	}
+	if c.SMS.MinAlertAmount < 0 {
+		errs = append(errs, fmt.Errorf("SMS_MIN_ALERT_AMOUNT must not be negative"))
+	}
+	if c.SMS.OTPCooldown < 0 {
+		errs = append(errs, fmt.Errorf("SMS_OTP_COOLDOWN must not be negative"))
+	}
+	if c.SMS.OTPMaxAttempts <= 0 {
+		errs = append(errs, fmt.Errorf("SMS_OTP_MAX_ATTEMPTS must be positive"))
+	}
+
+	required("REALTIME_CHANNEL", c.Realtime.Channel)
+	positive("REALTIME_HEARTBEAT", c.Realtime.Heartbeat)
+	positive("REALTIME_HISTORY_TTL", c.Realtime.HistoryTTL)
+	if c.Realtime.History <= 0 {
+		errs = append(errs, fmt.Errorf("REALTIME_HISTORY must be positive"))
+	}
+	if c.Realtime.MaxStreams <= 0 {
+		errs = append(errs, fmt.Errorf("REALTIME_MAX_STREAMS must be positive"))
+	}
+
+	if c.Beneficiaries.Max <= 0 {
+		errs = append(errs, fmt.Errorf("BENEFICIARIES_MAX must be positive"))
+	}
+	if c.Beneficiaries.CoolOff < 0 {
+		errs = append(errs, fmt.Errorf("BENEFICIARIES_COOL_OFF must not be negative"))
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Log.Level)); err != nil {
+		errs = append(errs, fmt.Errorf("LOG_LEVEL: %w", err))
+	}
+
+	return errs, warnings
+}
+
+// LogLevel is the parsed log level, validated by Load
+func (l Log) LogLevel() slog.Level {
+	var level slog.Level
+	_ = level.UnmarshalText([]byte(l.Level))
+	return level
+}
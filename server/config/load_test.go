@@ -0,0 +1,200 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// isolate clears every variable the config reads and moves into an
+// empty directory, so only what the test sets is loaded. The
+// variables are restored afterwards, .env ones included
+func isolate(t *testing.T) string {
+	t.Helper()
+	names := []string{"CONFIG_FILE"}
+	var collect func(typ reflect.Type)
+	collect = func(typ reflect.Type) {
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i)
+			if field.Type.Kind() == reflect.Struct {
+				collect(field.Type)
+			} else if name := field.Tag.Get("env"); name != "" {
+				names = append(names, name)
+			}
+		}
+	}
+	collect(reflect.TypeOf(Config{}))
+	for _, name := range names {
+		unsetenv(t, name)
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	return dir
+}
+
+// unsetenv unsets name until the test ends
+func unsetenv(t *testing.T, name string) {
+	t.Helper()
+	t.Setenv(name, "")
+	os.Unsetenv(name)
+}
+
+// setRequired sets the settings that have no default
+func setRequired(t *testing.T) {
+	t.Helper()
+	for name, value := range map[string]string{
+		"DB_HOST":        "localhost",
+		"DB_USER":        "postgres",
+		"DB_NAME":        "gopay",
+		"PRIV_KEY_FILE":  "private.pem",
+		"PUB_KEY_FILE":   "public.pem",
+		"REFRESH_SECRET": "secret",
+	} {
+		t.Setenv(name, value)
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	dir := isolate(t)
+	setRequired(t)
+	unsetenv(t, "DB_HOST")
+
+	writeFile(t, filepath.Join(dir, "config.yaml"), `
+server:
+  port: "1000"
+  handler_timeout: 10s
+database:
+  host: yaml-host
+  name: yaml-name
+log:
+  level: debug
+`)
+	writeFile(t, filepath.Join(dir, ".env"), "PORT=2000\nDB_HOST=dotenv-host\n")
+	t.Setenv("CONFIG_FILE", filepath.Join(dir, "config.yaml"))
+	t.Setenv("PORT", "3000")
+
+	cfg, _, err := Load("")
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	for _, tc := range []struct {
+		name      string
+		got, want any
+	}{
+		{"env over .env and yaml", cfg.Server.Port, "3000"},
+		{".env over yaml", cfg.Database.Host, "dotenv-host"},
+		{"env over yaml", cfg.Database.Name, "gopay"},
+		{"yaml over defaults", cfg.Server.HandlerTimeout, 10 * time.Second},
+		{"yaml string", cfg.Log.Level, "debug"},
+		{"defaults", cfg.Server.ReadTimeout, 15 * time.Second},
+	} {
+		if tc.got != tc.want {
+			t.Errorf("%s: got %v, want %v", tc.name, tc.got, tc.want)
+		}
+	}
+}
+
+func TestLoadParsing(t *testing.T) {
+	for _, tc := range []struct {
+		name, env, raw string
+		get            func(cfg *Config) any
+		want           any
+	}{
+		{"seconds", "TOKEN_EXP", "1800", func(cfg *Config) any { return cfg.Token.IDTokenExp }, 30 * time.Minute},
+		{"duration", "TOKEN_EXP", "1h30m", func(cfg *Config) any { return cfg.Token.IDTokenExp }, 90 * time.Minute},
+		{"bool false", "SCHEDULER_ENABLED", "false", func(cfg *Config) any { return cfg.Scheduler.Enabled }, false},
+		{"bool 0", "SCHEDULER_ENABLED", "0", func(cfg *Config) any { return cfg.Scheduler.Enabled }, false},
+		{"bool true", "WEBHOOKS_ALLOW_INSECURE", "true", func(cfg *Config) any { return cfg.Webhooks.AllowInsecure }, true},
+		{"int", "BENEFICIARIES_MAX", "5", func(cfg *Config) any { return cfg.Beneficiaries.Max }, 5},
+		{"float", "SMS_MIN_ALERT_AMOUNT", "2.5", func(cfg *Config) any { return cfg.SMS.MinAlertAmount }, 2.5},
+		{"map", "JOBS_CONCURRENCY", "notifications=4, default=2", func(cfg *Config) any { return cfg.Jobs.Concurrency }, map[string]int{"notifications": 4, "default": 2}},
+		{"list", "TRUSTED_PROXIES", "10.0.0.0/8, 192.168.1.2", func(cfg *Config) any { return cfg.Server.TrustedProxies }, []string{"10.0.0.0/8", "192.168.1.2"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			isolate(t)
+			setRequired(t)
+			t.Setenv(tc.env, tc.raw)
+
+			cfg, _, err := Load("")
+			if err != nil {
+				t.Fatalf("load: %v", err)
+			}
+			if got := tc.get(cfg); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("%s=%s: got %v, want %v", tc.env, tc.raw, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestLoadReportsEveryError(t *testing.T) {
+	isolate(t)
+	setRequired(t)
+	unsetenv(t, "DB_HOST")
+	t.Setenv("TOKEN_EXP", "soon")
+	t.Setenv("SCHEDULER_ENABLED", "maybe")
+	t.Setenv("MAIL_DRIVER", "pigeon")
+	t.Setenv("TRUSTED_PROXIES", "proxy.local")
+
+	_, _, err := Load("")
+	if err == nil {
+		t.Fatal("load: got no error")
+	}
+	for _, want := range []string{
+		`TOKEN_EXP: could not parse "soon" as duration`,
+		`SCHEDULER_ENABLED: could not parse "maybe" as bool`,
+		`MAIL_DRIVER must be one of smtp, file, log, got "pigeon"`,
+		`TRUSTED_PROXIES must be IPs or CIDRs, got "proxy.local"`,
+		"DB_HOST is required",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q doesn't report %q", err, want)
+		}
+	}
+}
+
+func TestLoadWarnings(t *testing.T) {
+	for _, tc := range []struct {
+		name, env, secret, metrics string
+		warnings                   int
+		fails                      bool
+	}{
+		{"secret set", "development", "secret", "", 0, false},
+		{"no secret in development", "development", "", "", 1, false},
+		{"no secret in production", "production", "", "token", 0, true},
+		{"no metrics token outside development", "staging", "secret", "", 0, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			isolate(t)
+			setRequired(t)
+			t.Setenv("APP_ENV", tc.env)
+			t.Setenv("REFRESH_SECRET", tc.secret)
+			t.Setenv("METRICS_TOKEN", tc.metrics)
+
+			_, warnings, err := Load("")
+			if (err != nil) != tc.fails {
+				t.Fatalf("got error %v, want failure %v", err, tc.fails)
+			}
+			if len(warnings) != tc.warnings {
+				t.Errorf("got warnings %q, want %d", warnings, tc.warnings)
+			}
+		})
+	}
+}
@@ -3,9 +3,9 @@ package db
 import (
 	"context"
 	"fmt"
-	"log"
-	"os"
+	"log/slog"
 
+	"github.com/Cprime50/Gopay/config"
 	"github.com/Cprime50/Gopay/helper"
 	"github.com/go-redis/redis/v8"
 	"gorm.io/driver/postgres"
@@ -13,87 +13,87 @@ import (
 	"gorm.io/gorm/schema"
 )
 
-var (
-	DB          *gorm.DB
-	RedisClient *redis.Client
-)
-
 // Initializes the DS connection
-func InitDS() (*gorm.DB, *redis.Client) {
-	DB, RedisClient, _ = connectDS()
-	return DB, RedisClient
-}
+func InitDS(dbCfg config.Database, redisCfg config.Redis) (*gorm.DB, *redis.Client, error) {
+	slog.Info("initializing data sources")
 
-// connectDS establishes connections to dataSources
-func connectDS() (*gorm.DB, *redis.Client, error) {
-	log.Printf("Initializing data sources\n")
+	db, err := OpenPostgres(dbCfg)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	host := os.Getenv("DB_HOST")
-	username := os.Getenv("DB_USER")
-	password := os.Getenv("DB_PASSWORD")
-	dbname := os.Getenv("DB_NAME")
-	port := os.Getenv("DB_PORT")
+	rdb, err := OpenRedis(redisCfg)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable", host, username, password, dbname, port)
+	return db, rdb, nil
+}
 
-	log.Printf("Connecting to Postgres\n")
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{NamingStrategy: schema.NamingStrategy{
-		SingularTable: true,
-	}})
+// OpenPostgres connects to postgres with pooling enabled.
+// Commands that don't need redis, eg migrate, use it directly
+func OpenPostgres(dbCfg config.Database) (*gorm.DB, error) {
+	slog.Info("connecting to postgres")
+	db, err := gorm.Open(postgres.Open(dbCfg.DSN()), gormConfig())
 
 	if err != nil {
-		log.Fatalf("Failed to connect to Postgres database: %s", err)
-		return nil, nil, helper.NewInternal()
+		return nil, fmt.Errorf("failed to connect to postgres database: %w", err)
 	}
 
 	//Enable pooling
-	// sqlDB, err := db.DB()
-	// if err != nil {
-	// 	return nil, err
-	// }
-	// sqlDB.SetMaxIdleConns(10)
-	// sqlDB.SetMaxOpenConns(100)
-	fmt.Println("Connected to postgres successfully")
-
-	// Initialize redis connection
-	redisHost := os.Getenv("REDIS_HOST")
-	redisPort := os.Getenv("REDIS_PORT")
-
-	log.Printf("Connecting to Redis\n")
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get postgres connection pool: %w", err)
+	}
+	sqlDB.SetMaxIdleConns(dbCfg.MaxIdleConns)
+	sqlDB.SetMaxOpenConns(dbCfg.MaxOpenConns)
+	slog.Info("connected to postgres successfully")
+
+	return db, nil
+}
+
+// OpenRedis connects to redis and verifies the connection
+func OpenRedis(redisCfg config.Redis) (*redis.Client, error) {
+	slog.Info("connecting to redis")
 	rdb := redis.NewClient(&redis.Options{
-		Addr:     fmt.Sprintf("%s:%s", redisHost, redisPort),
-		Password: "",
-		DB:       0,
+		Addr:     redisCfg.Addr(),
+		Password: redisCfg.Password,
+		DB:       redisCfg.DB,
 	})
 
 	// verify redis connection
-	_, err = rdb.Ping(context.Background()).Result()
-
-	if err != nil {
-		return nil, nil, fmt.Errorf("error connecting to redis: %w", err)
+	if err := rdb.Ping(context.Background()).Err(); err != nil {
+		return nil, fmt.Errorf("error connecting to redis: %w", err)
 	}
-	fmt.Println("Connected to redis successfully")
+	slog.Info("connected to redis successfully")
 
-	return db, rdb, nil
+	return rdb, nil
+}
+
+// gormConfig is shared by every GORM dialect so table names match
+func gormConfig() *gorm.Config {
+	return &gorm.Config{NamingStrategy: schema.NamingStrategy{
+		SingularTable: true,
+	}}
 }
 
 // close to be used in graceful server shutdown
-func Close() error {
-	sqlDB, err := DB.DB()
+func Close(db *gorm.DB, rdb *redis.Client) error {
+	sqlDB, err := db.DB()
 	if err != nil {
-		log.Fatal(err)
+		slog.Error("error getting postgres connection pool", "error", err)
 		return helper.NewInternal()
 	}
 	if err := sqlDB.Close(); err != nil {
-		log.Fatal("error closing Postgresql: %w", err)
+		slog.Error("error closing postgres", "error", err)
 		return helper.NewInternal()
 	}
 
-	if err := RedisClient.Close(); err != nil {
-		log.Fatal("error closing Redis Client: %w", err)
+	if err := rdb.Close(); err != nil {
+		slog.Error("error closing redis client", "error", err)
 		return helper.NewInternal()
 	}
-	log.Println("Closing Datasources")
+	slog.Info("closed data sources")
 
 	return nil
 }
@@ -0,0 +1,26 @@
+package db
+
+import (
+	"fmt"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+// OpenSQLite opens a SQLite database with the same GORM settings as postgres.
+// It's pure go so needs no cgo, meant for tests and local runs,
+// use ":memory:" for a throwaway database
+func OpenSQLite(dsn string) (*gorm.DB, error) {
+	db, err := gorm.Open(sqlite.Open(dsn), gormConfig())
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sqlite database: %w", err)
+	}
+
+	// an in memory database only lives as long as its connection
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sqlite connection pool: %w", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	return db, nil
+}
@@ -0,0 +1,111 @@
+// Package events publishes the domain events written to the outbox by
+// the account and ledger repositories. A Relay reads the outbox and
+// hands each event to its publishers, the in process Bus and a redis
+// Stream, marking it published once they all have it.
+//
+// Delivery is at least once: an event that fails to reach one publisher
+// is retried on all of them, and a relay that dies mid batch leaves its
+// events to be picked up again once their lease expires. Subscribers
+// must be idempotent, the event ID is the same on every delivery
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Cprime50/Gopay/helper"
+	models "github.com/Cprime50/Gopay/models/account"
+	"github.com/google/uuid"
+)
+
+// All subscribes to every event type
+const All = "*"
+
+// Event is a published domain event, Payload is the JSON of one of the
+// payload structs in models, eg models.TransferCompleted
+type Event struct {
+	ID          uuid.UUID       `json:"id"`
+	Type        string          `json:"type"`
+	AggregateID uuid.UUID       `json:"aggregate_id"`
+	OccurredAt  time.Time       `json:"occurred_at"`
+	Payload     json.RawMessage `json:"payload"`
+}
+
+// FromOutbox is the event recorded in the outbox as e
+func FromOutbox(e *models.OutboxEvent) Event {
+	return Event{
+		ID:          e.ID,
+		Type:        e.Type,
+		AggregateID: e.AggregateID,
+		OccurredAt:  e.CreatedAt,
+		Payload:     json.RawMessage(e.Payload),
+	}
+}
+
+// Decode unmarshals the event's payload into a T
+func Decode[T any](event Event) (T, error) {
+	var payload T
+	if err := json.Unmarshal(event.Payload, &payload); err != nil {
+		return payload, fmt.Errorf("events: decoding %s payload: %w", event.Type, err)
+	}
+	return payload, nil
+}
+
+// Handler handles an event, an error has it delivered again later
+type Handler func(ctx context.Context, event Event) error
+
+// subscriber is a named handler, the name is used in logs and errors
+type subscriber struct {
+	name    string
+	handler Handler
+}
+
+// Bus delivers events to the subscribers in this process
+type Bus struct {
+	mu          sync.RWMutex
+	subscribers map[string][]subscriber
+}
+
+// NewBus returns a Bus with no subscribers
+func NewBus() *Bus {
+	return &Bus{subscribers: make(map[string][]subscriber)}
+}
+
+// Subscribe has h handle events of eventType, or every event for All
+func (b *Bus) Subscribe(eventType string, name string, h Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribers[eventType] = append(b.subscribers[eventType], subscriber{name: name, handler: h})
+}
+
+// Publish hands event to each of its subscribers in the order they
+// subscribed. Every subscriber is run even if one fails, the errors
+// are joined
+func (b *Bus) Publish(ctx context.Context, event Event) error {
+	b.mu.RLock()
+	subscribers := append(append([]subscriber{}, b.subscribers[event.Type]...), b.subscribers[All]...)
+	b.mu.RUnlock()
+
+	var errs []error
+	for _, s := range subscribers {
+		if err := s.handle(ctx, event); err != nil {
+			helper.Logger(ctx).Error("event subscriber failed", "subscriber", s.name, "event_id", event.ID, "type", event.Type, "error", err)
+			errs = append(errs, fmt.Errorf("%s: %w", s.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// handle runs the subscriber, turning panics into errors
+func (s subscriber) handle(ctx context.Context, event Event) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("subscriber panicked: %v", r)
+		}
+	}()
+	return s.handler(ctx, event)
+}
@@ -0,0 +1,123 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Cprime50/Gopay/config"
+	models "github.com/Cprime50/Gopay/models/account"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+func TestBus(t *testing.T) {
+	ctx := context.Background()
+	bus := NewBus()
+	var got []string
+	bus.Subscribe(models.EventAccountCreated, "welcome", func(ctx context.Context, event Event) error {
+		payload, err := Decode[models.AccountCreated](event)
+		if err != nil {
+			return err
+		}
+		got = append(got, "welcome "+payload.Email)
+		return nil
+	})
+	bus.Subscribe(models.EventAccountCreated, "broken", func(ctx context.Context, event Event) error {
+		panic("boom")
+	})
+	bus.Subscribe(All, "audit", func(ctx context.Context, event Event) error {
+		got = append(got, "audit "+event.Type)
+		return errors.New("audit log is down")
+	})
+
+	// every subscriber runs, failures and panics are joined into the error
+	err := bus.Publish(ctx, Event{ID: uuid.New(), Type: models.EventAccountCreated, Payload: []byte(`{"email":"john@mail.com"}`)})
+	if err == nil || len(got) != 2 || got[0] != "welcome john@mail.com" || got[1] != "audit account.created" {
+		t.Fatalf("publish: got %v, %v", got, err)
+	}
+
+	// only All subscribers get other types
+	got = nil
+	bus.Publish(ctx, Event{ID: uuid.New(), Type: models.EventPasswordChanged, Payload: []byte(`{}`)})
+	if len(got) != 1 || got[0] != "audit account.password_changed" {
+		t.Fatalf("publish other type: got %v", got)
+	}
+}
+
+// flakyPublisher fails the first fail publishes, recording the rest
+type flakyPublisher struct {
+	fail   int
+	events []Event
+}
+
+func (p *flakyPublisher) Publish(ctx context.Context, event Event) error {
+	if p.fail > 0 {
+		p.fail--
+		return errors.New("publisher is down")
+	}
+	p.events = append(p.events, event)
+	return nil
+}
+
+func TestRelay(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+
+	accounts := models.NewMemoryAccountRepository()
+	for i, email := range []string{"john@mail.com", "jane@mail.com"} {
+		if err := accounts.Create(ctx, &models.Account{Email: email, AccountNumber: 1234567890 + int64(i)}); err != nil {
+			t.Fatalf("create: %v", err)
+		}
+	}
+
+	cfg := config.Default().Outbox
+	cfg.Stream = "test:events"
+	flaky := &flakyPublisher{fail: 1}
+	relay := NewRelay(models.NewMemoryOutboxRepository(accounts), cfg, flaky, NewStream(rdb, cfg.Stream, cfg.StreamMaxLen))
+	now := time.Now().Add(time.Second)
+	relay.now = func() time.Time { return now }
+
+	// the first event fails on one publisher so is retried on all of them
+	published, err := relay.RelayPending(ctx)
+	if err != nil || published != 1 {
+		t.Fatalf("relay: got %d, %v", published, err)
+	}
+	if published, _ := relay.RelayPending(ctx); published != 0 {
+		t.Fatalf("relay before the retry: published %d", published)
+	}
+	now = now.Add(relay.backoff(1))
+	if published, err := relay.RelayPending(ctx); err != nil || published != 1 {
+		t.Fatalf("relay at the retry: got %d, %v", published, err)
+	}
+	if len(flaky.events) != 2 || flaky.events[0].Type != models.EventAccountCreated {
+		t.Fatalf("published: got %+v", flaky.events)
+	}
+
+	// the stream got it on both attempts, consumers dedupe on the id
+	entries, err := rdb.XRange(ctx, cfg.Stream, "-", "+").Result()
+	if err != nil || len(entries) != 3 {
+		t.Fatalf("stream: got %d entries, %v", len(entries), err)
+	}
+	first, retried := entries[0].Values, entries[2].Values
+	if first["id"] != retried["id"] || first["type"] != models.EventAccountCreated || first["id"] == entries[1].Values["id"] {
+		t.Fatalf("stream entries: got %+v", entries)
+	}
+	payload, err := Decode[models.AccountCreated](Event{Type: models.EventAccountCreated, Payload: []byte(first["payload"].(string))})
+	if err != nil || payload.AccountID.String() != first["aggregate_id"] {
+		t.Fatalf("stream payload: got %+v, %v", payload, err)
+	}
+}
+
+func TestRelayBackoff(t *testing.T) {
+	relay := NewRelay(nil, config.Outbox{Interval: time.Second, MaxBackoff: 10 * time.Second})
+	for attempts, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 4: 8 * time.Second, 5: 10 * time.Second, 60: 10 * time.Second} {
+		if got := relay.backoff(attempts); got != want {
+			t.Errorf("backoff after %d attempts: got %v, want %v", attempts, got, want)
+		}
+	}
+}
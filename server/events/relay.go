@@ -0,0 +1,148 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Cprime50/Gopay/config"
+	"github.com/Cprime50/Gopay/helper"
+	"github.com/Cprime50/Gopay/metrics"
+	models "github.com/Cprime50/Gopay/models/account"
+)
+
+// pruneInterval is how often the relay deletes events past their retention
+const pruneInterval = time.Hour
+
+// Publisher is somewhere events are published to, eg the Bus or a Stream
+type Publisher interface {
+	Publish(ctx context.Context, event Event) error
+}
+
+// Relay publishes the events written to the outbox. Several may run at
+// once, each event is leased to one of them while it's published
+type Relay struct {
+	outbox     models.OutboxRepository
+	publishers []Publisher
+	cfg        config.Outbox
+	now        func() time.Time
+}
+
+// NewRelay returns a Relay publishing the events in outbox to publishers
+func NewRelay(outbox models.OutboxRepository, cfg config.Outbox, publishers ...Publisher) *Relay {
+	return &Relay{
+		outbox:     outbox,
+		publishers: publishers,
+		cfg:        cfg,
+		now:        time.Now,
+	}
+}
+
+// Run relays pending events every interval until ctx is done. A batch
+// in progress when ctx is done is finished, so its events aren't left
+// leased until the lease expires
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.cfg.Interval)
+	defer ticker.Stop()
+	var pruned time.Time
+	for {
+		n, err := r.RelayPending(context.WithoutCancel(ctx))
+		if err != nil {
+			helper.Logger(ctx).Error("error relaying outbox events", "error", err)
+		}
+		if now := r.now(); now.Sub(pruned) >= pruneInterval {
+			pruned = now
+			deleted, err := r.outbox.DeletePublished(ctx, now.Add(-r.cfg.Retention))
+			if err != nil {
+				helper.Logger(ctx).Error("error pruning outbox", "error", err)
+			} else if deleted > 0 {
+				helper.Logger(ctx).Info("pruned published outbox events", "deleted", deleted)
+			}
+		}
+
+		// a full batch likely means there's more waiting
+		if n == r.cfg.BatchSize && ctx.Err() == nil {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RelayPending publishes a batch of the events due, returning how many
+// were published. Events that fail are retried after a backoff
+func (r *Relay) RelayPending(ctx context.Context) (int, error) {
+	now := r.now()
+	pending, err := r.outbox.Pending(ctx, now, r.cfg.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	published := 0
+	for _, e := range pending {
+		claimed, err := r.outbox.Claim(ctx, e, now, now.Add(r.cfg.Lease))
+		if err != nil {
+			return published, err
+		}
+		if !claimed {
+			// another relay has it
+			continue
+		}
+
+		logger := helper.Logger(ctx).With("event_id", e.ID, "type", e.Type, "attempt", e.Attempts+1)
+		if err := r.publish(helper.ContextWithLogger(ctx, logger), FromOutbox(e)); err != nil {
+			retryAt := r.now().Add(r.backoff(e.Attempts + 1))
+			logger.Warn("error publishing event, will retry", "retry_at", retryAt, "error", err)
+			metrics.ObserveEvent(e.Type, metrics.EventRetried)
+			if err := r.outbox.MarkFailed(ctx, e.ID, retryAt, truncate(err.Error(), 255)); err != nil {
+				return published, err
+			}
+			continue
+		}
+		if err := r.outbox.MarkPublished(ctx, e.ID, r.now()); err != nil {
+			return published, err
+		}
+		metrics.ObserveEvent(e.Type, metrics.EventPublished)
+		published++
+	}
+	return published, nil
+}
+
+// publish hands event to every publisher, even if one fails
+func (r *Relay) publish(ctx context.Context, event Event) error {
+	var errs []error
+	for _, p := range r.publishers {
+		if err := p.Publish(ctx, event); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("publishing %s: %w", event.Type, err)
+	}
+	return nil
+}
+
+// backoff is how long to wait before the next attempt at an event that
+// failed attempts times, the interval doubling up to the max backoff
+func (r *Relay) backoff(attempts int) time.Duration {
+	backoff := r.cfg.Interval
+	for i := 1; i < attempts && backoff < r.cfg.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > r.cfg.MaxBackoff {
+		backoff = r.cfg.MaxBackoff
+	}
+	return backoff
+}
+
+// truncate cuts s to at most n bytes, to fit the outbox's last_error column
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
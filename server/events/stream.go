@@ -0,0 +1,39 @@
+package events
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Stream publishes events to a redis stream, for consumers outside this
+// process. Each entry has the event's id, type, aggregate_id,
+// occurred_at and payload fields. Consumers should dedupe on id as an
+// event may be added more than once
+type Stream struct {
+	redis  *redis.Client
+	name   string
+	maxLen int64
+}
+
+// NewStream returns a Stream adding events to the stream name, trimmed
+// to about maxLen entries. Zero doesn't trim
+func NewStream(rdb *redis.Client, name string, maxLen int64) *Stream {
+	return &Stream{redis: rdb, name: name, maxLen: maxLen}
+}
+
+func (s *Stream) Publish(ctx context.Context, event Event) error {
+	return s.redis.XAdd(ctx, &redis.XAddArgs{
+		Stream: s.name,
+		MaxLen: s.maxLen,
+		Approx: true,
+		Values: map[string]interface{}{
+			"id":           event.ID.String(),
+			"type":         event.Type,
+			"aggregate_id": event.AggregateID.String(),
+			"occurred_at":  event.OccurredAt.UTC().Format(time.RFC3339Nano),
+			"payload":      string(event.Payload),
+		},
+	}).Err()
+}
@@ -1,17 +1,14 @@
 package handler
 
 import (
-	"errors"
-	"fmt"
-	"log"
 	"net/http"
 
 	"github.com/Cprime50/Gopay/helper"
+	"github.com/Cprime50/Gopay/i18n"
+	"github.com/Cprime50/Gopay/metrics"
 	"github.com/Cprime50/Gopay/middleware"
 	models "github.com/Cprime50/Gopay/models/account"
 	"github.com/gin-gonic/gin"
-	"github.com/go-playground/validator"
-	"gorm.io/gorm"
 )
 
 // signupReq is not exported, hence the lowercase name
@@ -21,7 +18,24 @@ type signupReq struct {
 	Lastname        string `json:"last_name" binding:"required,min=3,max=255,alphanum"`
 	Email           string `json:"email" binding:"required,email"`
 	Password        string `json:"password" binding:"required,min=8,max=255"`
-	ConfirmPassword string `json:"confirm_password" binding:"required,min=8,max=255"`
+	ConfirmPassword string `json:"confirm_password" binding:"required,eqfield=Password"`
+	// Locale defaults to the one negotiated from Accept-Language
+	Locale string `json:"locale" binding:"omitempty,oneof=en fr"`
+}
+
+type changePasswordReq struct {
+	CurrentPassword string `json:"current_password" binding:"required,max=255"`
+	Password        string `json:"password" binding:"required,min=8,max=255"`
+	ConfirmPassword string `json:"confirm_password" binding:"required,eqfield=Password"`
+}
+
+type localeReq struct {
+	Locale string `json:"locale" binding:"required,oneof=en fr"`
+}
+
+// lookupQuery asks who holds an account number
+type lookupQuery struct {
+	AccountNumber int64 `form:"account_number" binding:"required,gt=0"`
 }
 
 type signinReq struct {
@@ -29,6 +43,42 @@ type signinReq struct {
 	Password string `json:"password" binding:"required,min=8,max=255"`
 }
 
+// signupResp is returned by Signup
+type signupResp struct {
+	Message string            `json:"message"`
+	User    string            `json:"user"`
+	Tokens  *models.TokenPair `json:"tokens"`
+}
+
+// signinResp is returned by Signin, accounts with credentials_expired
+// must change their password before anything else
+type signinResp struct {
+	Tokens             *models.TokenPair `json:"tokens"`
+	Account            string            `json:"account"`
+	CredentialsExpired bool              `json:"credentials_expired"`
+}
+
+// accountResp wraps the signed in account, with a new token pair when
+// the change is carried in the id token
+type accountResp struct {
+	Message string            `json:"message,omitempty"`
+	Account *models.Account   `json:"account"`
+	Tokens  *models.TokenPair `json:"tokens,omitempty"`
+}
+
+// lookupResp is returned by LookupAccount, only the masked name is
+// shown so a lookup can confirm a recipient but not identify them
+type lookupResp struct {
+	AccountNumber int64  `json:"account_number"`
+	HolderName    string `json:"holder_name"`
+}
+
+// tokensResp is a fresh token pair
+type tokensResp struct {
+	Message string            `json:"message,omitempty"`
+	Tokens  *models.TokenPair `json:"tokens"`
+}
+
 // Signup handler
 func (h *Handler) Signup(c *gin.Context) {
 	// define a variable to which we'll bind incoming
@@ -36,24 +86,14 @@ func (h *Handler) Signup(c *gin.Context) {
 	var input signupReq
 
 	// Bind form input as JSON
-	if err := c.BindJSON(&input); err != nil {
-		// check for error in required field
-		var errorMessage string
-		var validationErrors validator.ValidationErrors
-		if errors.As(err, &validationErrors) {
-			validationError := validationErrors[0]
-			if validationError.Tag() == "required" {
-				errorMessage = fmt.Sprintf("%s not provided", validationError.Field())
-			}
-		}
-		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": errorMessage, "message": "please correctly provide the relevant fields"})
+	if err := c.ShouldBindJSON(&input); err != nil {
+		middleware.Abort(c, helper.NewBindError(err))
 		return
 	}
 
-	// Ensure password provided and confirmedPassword match
-	if input.Password != input.ConfirmPassword {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Passwords do not match"})
-		c.Abort()
+	ctx := c.Request.Context()
+	if input.Locale == "" {
+		input.Locale = i18n.FromContext(ctx)
 	}
 
 	// update the user table with new data
@@ -62,44 +102,35 @@ func (h *Handler) Signup(c *gin.Context) {
 		LastName:  input.Lastname,
 		Email:     input.Email,
 		Password:  input.Password,
+		Locale:    input.Locale,
 	}
 
-	ctx := c.Request.Context()
-	hashedPassword, err := models.HashPassword(account.Password)
-	if err != nil {
-		log.Printf("Unable to hashpassword for account: %v, due to: %v\n", account.Email, err)
-		c.AbortWithStatusJSON(helper.Status(err), gin.H{"message": "Internal server error"})
-		return
-	}
-	account.Password = hashedPassword
-
-	//model layer will handle generatingn account number and initilizing user inputed data
-	if err := models.CreateAccount(ctx, account); err != nil {
-		log.Printf("Error creating account: %v", err)
-		c.AbortWithStatusJSON(helper.Status(err), gin.H{"message": "Internal server error"})
+	//service layer will handle hashing, generatingn account number and initilizing user inputed data
+	if err := h.AccountService.Signup(ctx, account); err != nil {
+		helper.Logger(ctx).Error("error creating account", "error", err)
+		middleware.Abort(c, err)
 		return
 	}
 
 	// create token pair as strings
-	tokens, err := middleware.NewPairFromUser(ctx, account, "")
+	tokens, err := h.TokenService.NewPairFromUser(ctx, account, "")
 
 	if err != nil {
-		log.Printf("Failed to create tokens for user: %v\n", err.Error())
+		helper.Logger(ctx).Error("failed to create tokens for account", "error", err)
 
 		// may eventually implement rollback logic here
 		// meaning, if we fail to create tokens after creating a user,
 		// we make sure to clear/delete the created user in the database
 
-		c.AbortWithStatusJSON(helper.Status(err), gin.H{
-			"error": err,
-		})
+		middleware.Abort(c, err)
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{
-		"message": "account created successfully",
-		"user":    account.Email,
-		"tokens":  tokens,
+	metrics.Signups.Inc()
+	c.JSON(http.StatusCreated, signupResp{
+		Message: i18n.T(i18n.FromContext(ctx), "account_created", nil),
+		User:    account.Email,
+		Tokens:  tokens,
 	})
 }
 
@@ -108,67 +139,38 @@ func (h *Handler) Signin(c *gin.Context) {
 	var input signinReq
 
 	// Bind input
-	if err := c.BindJSON(&input); err != nil {
-		// check for error in required field
-		var errorMessage string
-		var validationErrors validator.ValidationErrors
-		if errors.As(err, &validationErrors) {
-			validationError := validationErrors[0]
-			if validationError.Tag() == "required" {
-				errorMessage = fmt.Sprintf("%s not provided", validationError.Field())
-			}
-
-		}
-		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": errorMessage, "message": "please correctly provide the relevant fields"})
+	if err := c.ShouldBindJSON(&input); err != nil {
+		middleware.Abort(c, helper.NewBindError(err))
 		return
 	}
 
-	account := &models.Account{
-		Email:    input.Email,
-		Password: input.Password,
-	}
-
 	ctx := c.Request.Context()
-	accountGotten, err := models.GetAccountByEmail(ctx, account.Email)
+	account, err := h.AccountService.Signin(ctx, input.Email, input.Password)
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error(), "message": "Email not found, create account"})
-			return
-
+		switch helper.Status(err) {
+		case http.StatusNotFound, http.StatusUnauthorized:
+			metrics.Logins.WithLabelValues(metrics.LoginFailure).Inc()
+		default:
+			helper.Logger(ctx).Error("failed to sign in account", "error", err)
 		}
-		log.Println("Failed to sign in user: error getting user form db", err)
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "message": "Something went wrong"})
-		return
-
-	}
-	// verify password - check if matches
-	match, err := helper.ComparePassword(accountGotten.Password, account.Password)
-	if err != nil {
-		log.Println("error comparing password", err)
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "message": "Something went wrong"})
-		return
-	}
-	if !match {
-		c.AbortWithStatusJSON(helper.Status(err), gin.H{"error": err.Error(), "message": "Invalid email and password combination"})
+		middleware.Abort(c, err)
 		return
 	}
 
-	tokens, err := middleware.NewPairFromUser(ctx, account, "")
+	tokens, err := h.TokenService.NewPairFromUser(ctx, account, "")
 
 	if err != nil {
-		log.Printf("Failed to create tokens for user: %v\n", err.Error())
+		helper.Logger(ctx).Error("failed to create tokens for account", "error", err)
 
-		c.AbortWithStatusJSON(helper.Status(err), gin.H{
-			"message": "Login unsuccessful",
-			"account": account.Email,
-			"error":   err,
-		})
+		middleware.Abort(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"tokens":  tokens,
-		"account": account.Email,
+	metrics.Logins.WithLabelValues(metrics.LoginSuccess).Inc()
+	c.JSON(http.StatusOK, signinResp{
+		Tokens:             tokens,
+		Account:            account.Email,
+		CredentialsExpired: account.MustChangePassword,
 	})
 }
 
@@ -193,12 +195,8 @@ func (h *Handler) Me(c *gin.Context) {
 	// We'll extract this logic later as it will be common to all handler
 	// methods which require a valid user
 	if !exists {
-		log.Printf("Unable to extract user from request context for unknown reason: %v\n", c)
-		err := helper.NewInternal()
-		c.JSON(err.Status(), gin.H{
-			"error": err,
-		})
-
+		helper.Logger(c.Request.Context()).Error("unable to extract account from request context for unknown reason")
+		middleware.Abort(c, helper.NewInternal())
 		return
 	}
 
@@ -207,21 +205,104 @@ func (h *Handler) Me(c *gin.Context) {
 	// use the Request Context
 	ctx := c.Request.Context()
 
-	acct, err := models.GetAccountByID(ctx, id)
+	acct, err := h.AccountService.Get(ctx, id)
 
 	if err != nil {
-		log.Printf("Unable to find account: %v\n%v", id, err)
-		e := helper.NewNotFound("account", id.String())
-
-		c.JSON(e.Status(), gin.H{
-			"error": e,
-		})
+		helper.Logger(ctx).Info("unable to find account", "id", id, "error", err)
+		middleware.Abort(c, helper.NewNotFound("account", id.String()))
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"account": acct,
+	c.JSON(http.StatusOK, accountResp{
+		Account: acct,
 	})
 }
 
 // Update Me
+
+// ChangePassword sets a new password for the signed in account. Every
+// session is revoked and a fresh token pair returned
+func (h *Handler) ChangePassword(c *gin.Context) {
+	var input changePasswordReq
+	if err := c.ShouldBindJSON(&input); err != nil {
+		middleware.Abort(c, helper.NewBindError(err))
+		return
+	}
+
+	value, _ := c.Get("account")
+	ctx := c.Request.Context()
+
+	account, err := h.AccountService.ChangePassword(ctx, value.(*models.Account).ID, input.CurrentPassword, input.Password)
+	if err != nil {
+		middleware.Abort(c, err)
+		return
+	}
+
+	// other sessions may have been started with the old password
+	if err := h.TokenService.Signout(ctx, account.ID); err != nil {
+		middleware.Abort(c, err)
+		return
+	}
+	tokens, err := h.TokenService.NewPairFromUser(ctx, account, "")
+	if err != nil {
+		middleware.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, tokensResp{
+		Message: i18n.T(i18n.FromContext(ctx), "password_changed", nil),
+		Tokens:  tokens,
+	})
+}
+
+// SetLocale saves the signed in account's preferred language, used for
+// its emails and notifications and for responses without Accept-Language.
+// The locale is read from the id token, so a new pair is returned
+func (h *Handler) SetLocale(c *gin.Context) {
+	var input localeReq
+	if err := c.ShouldBindJSON(&input); err != nil {
+		middleware.Abort(c, helper.NewBindError(err))
+		return
+	}
+
+	value, _ := c.Get("account")
+	ctx := c.Request.Context()
+
+	account, err := h.AccountService.SetLocale(ctx, value.(*models.Account).ID, input.Locale)
+	if err != nil {
+		middleware.Abort(c, err)
+		return
+	}
+	tokens, err := h.TokenService.NewPairFromUser(ctx, account, "")
+	if err != nil {
+		middleware.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, accountResp{
+		Message: i18n.T(account.Locale, "locale_changed", nil),
+		Account: account,
+		Tokens:  tokens,
+	})
+}
+
+// LookupAccount returns the masked name of an account number's holder,
+// so senders can check they typed the right number before paying it
+func (h *Handler) LookupAccount(c *gin.Context) {
+	var query lookupQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		middleware.Abort(c, helper.NewBindError(err))
+		return
+	}
+
+	holderName, err := h.AccountService.Lookup(c.Request.Context(), query.AccountNumber)
+	if err != nil {
+		middleware.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, lookupResp{
+		AccountNumber: query.AccountNumber,
+		HolderName:    holderName,
+	})
+}
@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Cprime50/Gopay/helper"
+	"github.com/gin-gonic/gin"
+)
+
+func TestSignupThenMe(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s *testServer) {
+		tokens := s.signup("john@mail.com", "password123")
+		if tokens.Tokens.Token == "" || tokens.Tokens.RefreshToken == "" {
+			t.Fatalf("expected a token pair, got %+v", tokens)
+		}
+
+		rec := s.do(http.MethodGet, "/api/me", nil, tokens.Tokens.Token)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("me: got status %d, body %s", rec.Code, rec.Body)
+		}
+		var resp struct {
+			Account struct {
+				Email string `json:"email"`
+			} `json:"account"`
+		}
+		decode(t, rec, &resp)
+		if resp.Account.Email != "john@mail.com" {
+			t.Errorf("me: got email %q", resp.Account.Email)
+		}
+	})
+}
+
+func TestSigninIssuesTokensForStoredAccount(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s *testServer) {
+		s.signup("jane@mail.com", "password123")
+
+		rec := s.do(http.MethodPost, "/api/login", gin.H{"email": "jane@mail.com", "password": "password123"}, "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("login: got status %d, body %s", rec.Code, rec.Body)
+		}
+		var resp tokensResponse
+		decode(t, rec, &resp)
+
+		// the id token must carry the stored account so /me can find it
+		rec = s.do(http.MethodGet, "/api/me", nil, resp.Tokens.Token)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("me: got status %d, body %s", rec.Code, rec.Body)
+		}
+	})
+}
+
+func TestAccountLookup(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s *testServer) {
+		john := s.signup("john@mail.com", "password123").Tokens.Token
+		s.signup("jane@mail.com", "password123")
+		jane, _ := s.accounts.GetByEmail(context.Background(), "jane@mail.com")
+		path := fmt.Sprintf("/api/accounts/lookup?account_number=%d", jane.AccountNumber)
+
+		rec := s.do(http.MethodGet, path, nil, john)
+		var resp lookupResp
+		decode(t, rec, &resp)
+		if rec.Code != http.StatusOK || resp.HolderName != "Jo** Do*" || resp.AccountNumber != jane.AccountNumber {
+			t.Fatalf("lookup: got status %d, body %s", rec.Code, rec.Body)
+		}
+		for _, field := range []string{`"email"`, `"balance"`, `"id"`, "jane@mail.com"} {
+			if strings.Contains(rec.Body.String(), field) {
+				t.Errorf("lookup shows %s: %s", field, rec.Body)
+			}
+		}
+
+		problem(t, s.do(http.MethodGet, "/api/accounts/lookup?account_number=42", nil, john), http.StatusNotFound, helper.CodeNotFound)
+		problem(t, s.do(http.MethodGet, "/api/accounts/lookup", nil, john), http.StatusBadRequest, helper.CodeValidationFailed)
+		problem(t, s.do(http.MethodGet, "/api/accounts/lookup?account_number=abc", nil, john), http.StatusBadRequest, helper.CodeMalformedBody)
+		problem(t, s.do(http.MethodGet, path, nil, ""), http.StatusUnauthorized, helper.CodeUnauthenticated)
+
+		// lookups are limited per caller so numbers can't be walked
+		for i := int64(0); i < lookupRateLimit.Limit; i++ {
+			rec = s.do(http.MethodGet, path, nil, john)
+		}
+		problem(t, rec, http.StatusTooManyRequests, helper.CodeRateLimited)
+
+		// and per IP, so another account only gets what's left of its budget
+		jim := s.signup("jim@mail.com", "password123").Tokens.Token
+		for i := int64(0); i < lookupIPRateLimit.Limit-lookupRateLimit.Limit; i++ {
+			if rec := s.do(http.MethodGet, path, nil, jim); rec.Code != http.StatusOK {
+				t.Fatalf("lookup %d by another account: got status %d, body %s", i, rec.Code, rec.Body)
+			}
+		}
+		problem(t, s.do(http.MethodGet, path, nil, jim), http.StatusTooManyRequests, helper.CodeRateLimited)
+	})
+}
+
+func TestMetricsInternalOnly(t *testing.T) {
+	s := newTestServer(t, backends[0])
+	scrape := func(remoteAddr, forwardedFor string) int {
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		req.RemoteAddr = remoteAddr
+		if forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := scrape("10.0.0.5:1234", ""); code != http.StatusOK {
+		t.Fatalf("private scrape: got status %d", code)
+	}
+	if code := scrape("203.0.113.5:1234", ""); code != http.StatusNotFound {
+		t.Fatalf("public scrape: got status %d", code)
+	}
+	// the header isn't believed from a peer that isn't a trusted proxy
+	if code := scrape("203.0.113.5:1234", "127.0.0.1"); code != http.StatusNotFound {
+		t.Fatalf("spoofed scrape: got status %d", code)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	s := newTestServer(t, backends[0])
+
+	if rec := s.do(http.MethodGet, "/readyz", nil, ""); rec.Code != http.StatusOK {
+		t.Fatalf("got status %d, body %s", rec.Code, rec.Body)
+	}
+
+	s.redis.Close()
+	rec := s.do(http.MethodGet, "/readyz", nil, "")
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("with redis down: got status %d, body %s", rec.Code, rec.Body)
+	}
+	// the cause is logged, not reported
+	var got readinessResp
+	decode(t, rec, &got)
+	for name, check := range got.Checks {
+		if check.Status == "down" && check.Error != "unavailable" {
+			t.Fatalf("%s: got error %q, want unavailable", name, check.Error)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/Cprime50/Gopay/middleware"
+	models "github.com/Cprime50/Gopay/models/account"
+	"github.com/gin-gonic/gin"
+)
+
+// accountsResp is the list of accounts returned to admins
+type accountsResp struct {
+	Accounts []*models.Account `json:"accounts"`
+}
+
+// GetAccounts lists every account, admin only
+func (h *Handler) GetAccounts(c *gin.Context) {
+	accounts, err := h.AccountService.GetAll(c.Request.Context())
+	if err != nil {
+		middleware.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, accountsResp{
+		Accounts: accounts,
+	})
+}
@@ -0,0 +1,367 @@
+package handler
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Cprime50/Gopay/helper"
+	models "github.com/Cprime50/Gopay/models/account"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestSignupValidation(t *testing.T) {
+	valid := func() gin.H {
+		return gin.H{
+			"first_name":       "John",
+			"last_name":        "Doe",
+			"email":            "john@mail.com",
+			"password":         "password123",
+			"confirm_password": "password123",
+		}
+	}
+
+	tests := []struct {
+		name   string
+		modify func(body gin.H)
+	}{
+		{"missing email", func(b gin.H) { delete(b, "email") }},
+		{"invalid email", func(b gin.H) { b["email"] = "not-an-email" }},
+		{"short password", func(b gin.H) { b["password"], b["confirm_password"] = "short", "short" }},
+		{"short first name", func(b gin.H) { b["first_name"] = "Jo" }},
+		{"non alphanumeric last name", func(b gin.H) { b["last_name"] = "Doe!" }},
+		{"password mismatch", func(b gin.H) { b["confirm_password"] = "password456" }},
+	}
+
+	forEachBackend(t, func(t *testing.T, s *testServer) {
+		for _, tt := range tests {
+			// registration is limited to a handful per IP per hour
+			s.redis.FlushAll()
+
+			body := valid()
+			tt.modify(body)
+
+			rec := s.do(http.MethodPost, "/api/register", body, "")
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("%s: got status %d, want 400, body %s", tt.name, rec.Code, rec.Body)
+			}
+		}
+
+		// none of the rejected requests may have created the account
+		_, err := s.accounts.GetByEmail(context.Background(), "john@mail.com")
+		if helper.Status(err) != http.StatusNotFound {
+			t.Fatalf("account created by an invalid signup, err %v", err)
+		}
+	})
+}
+
+func TestSignupDuplicateEmail(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s *testServer) {
+		s.signup("john@mail.com", "password123")
+
+		rec := s.do(http.MethodPost, "/api/register", gin.H{
+			"first_name":       "Johnny",
+			"last_name":        "Doe",
+			"email":            "john@mail.com",
+			"password":         "password456",
+			"confirm_password": "password456",
+		}, "")
+		if rec.Code != http.StatusConflict {
+			t.Fatalf("got status %d, want 409, body %s", rec.Code, rec.Body)
+		}
+	})
+}
+
+func TestSignin(t *testing.T) {
+	tests := []struct {
+		name     string
+		email    string
+		password string
+		want     int
+	}{
+		{"success", "john@mail.com", "password123", http.StatusOK},
+		{"wrong password", "john@mail.com", "password456", http.StatusUnauthorized},
+		{"unknown email", "jane@mail.com", "password123", http.StatusNotFound},
+		{"invalid body", "john@mail.com", "", http.StatusBadRequest},
+	}
+
+	forEachBackend(t, func(t *testing.T, s *testServer) {
+		s.signup("john@mail.com", "password123")
+
+		for _, tt := range tests {
+			rec := s.do(http.MethodPost, "/api/login", gin.H{"email": tt.email, "password": tt.password}, "")
+			if rec.Code != tt.want {
+				t.Errorf("%s: got status %d, want %d, body %s", tt.name, rec.Code, tt.want, rec.Body)
+				continue
+			}
+			if tt.want == http.StatusOK {
+				var resp tokensResponse
+				decode(t, rec, &resp)
+				if resp.Tokens.Token == "" || resp.Tokens.RefreshToken == "" {
+					t.Errorf("%s: expected a token pair, got %s", tt.name, rec.Body)
+				}
+			}
+		}
+	})
+}
+
+func TestMeDoesNotExposePassword(t *testing.T) {
+	s := newTestServer(t, backends[0])
+	tokens := s.signup("john@mail.com", "password123")
+
+	rec := s.do(http.MethodGet, "/api/me", nil, tokens.Tokens.Token)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d, body %s", rec.Code, rec.Body)
+	}
+	if body := strings.ToLower(rec.Body.String()); strings.Contains(body, "password") {
+		t.Fatalf("password exposed in %s", body)
+	}
+
+	// nor in the id token claims, which are only base64 encoded
+	payload, err := base64.RawURLEncoding.DecodeString(strings.Split(tokens.Tokens.Token, ".")[1])
+	if err != nil {
+		t.Fatalf("decoding token payload: %v", err)
+	}
+	if strings.Contains(strings.ToLower(string(payload)), "password") {
+		t.Fatalf("password exposed in token claims %s", payload)
+	}
+}
+
+func TestAuthUserRejectsBadTokens(t *testing.T) {
+	s := newTestServer(t, backends[0])
+	tokens := s.signup("john@mail.com", "password123")
+	account, err := s.accounts.GetByEmail(context.Background(), "john@mail.com")
+	if err != nil {
+		t.Fatalf("getting account: %v", err)
+	}
+
+	// sign claims with the server's own private key
+	sign := func(claims jwt.MapClaims) string {
+		pem, err := os.ReadFile(s.cfg.Token.PrivKeyFile)
+		if err != nil {
+			t.Fatalf("reading private key: %v", err)
+		}
+		key, err := jwt.ParseRSAPrivateKeyFromPEM(pem)
+		if err != nil {
+			t.Fatalf("parsing private key: %v", err)
+		}
+		signed, err := jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(key)
+		if err != nil {
+			t.Fatalf("signing token: %v", err)
+		}
+		return signed
+	}
+
+	// swap the payload for one claiming the admin role, keeping the signature
+	parts := strings.Split(tokens.Tokens.Token, ".")
+	payload, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	forged := strings.Replace(string(payload), `"role_id":2`, `"role_id":1`, 1)
+	tampered := parts[0] + "." + base64.RawURLEncoding.EncodeToString([]byte(forged)) + "." + parts[2]
+
+	unsigned, err := jwt.NewWithClaims(jwt.SigningMethodNone, jwt.MapClaims{
+		"account": gin.H{"ID": account.ID, "role_id": models.AdminRoleID},
+		"exp":     time.Now().Add(time.Hour).Unix(),
+	}).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatalf("signing none token: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		header string
+	}{
+		{"no header", ""},
+		{"no bearer prefix", tokens.Tokens.Token},
+		{"garbage", "Bearer not.a.token"},
+		{"expired", "Bearer " + sign(jwt.MapClaims{
+			"account": gin.H{"ID": account.ID, "role_id": account.RoleID},
+			"iat":     time.Now().Add(-2 * time.Hour).Unix(),
+			"exp":     time.Now().Add(-time.Hour).Unix(),
+		})},
+		{"tampered payload", "Bearer " + tampered},
+		{"alg none", "Bearer " + unsigned},
+		{"refresh token as id token", "Bearer " + tokens.Tokens.RefreshToken},
+	}
+
+	for _, tt := range tests {
+		rec := s.doAuth(http.MethodGet, "/api/me", nil, tt.header)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s: got status %d, want 401, body %s", tt.name, rec.Code, rec.Body)
+		}
+	}
+}
+
+func TestAuthAdmin(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s *testServer) {
+		userTokens := s.signup("john@mail.com", "password123")
+		adminTokens := s.signup("jane@mail.com", "password123")
+
+		admin, err := s.accounts.GetByEmail(context.Background(), "jane@mail.com")
+		if err != nil {
+			t.Fatalf("getting account: %v", err)
+		}
+		if err := s.roles.Assign(context.Background(), admin.ID, models.AdminRoleID); err != nil {
+			t.Fatalf("assigning admin role: %v", err)
+		}
+
+		if rec := s.do(http.MethodGet, "/api/admin/accounts", nil, ""); rec.Code != http.StatusUnauthorized {
+			t.Errorf("anonymous: got status %d, want 401", rec.Code)
+		}
+		if rec := s.do(http.MethodGet, "/api/admin/accounts", nil, userTokens.Tokens.Token); rec.Code != http.StatusForbidden {
+			t.Errorf("user: got status %d, want 403, body %s", rec.Code, rec.Body)
+		}
+
+		// tokens issued before the role change still carry the user role
+		if rec := s.do(http.MethodGet, "/api/admin/accounts", nil, adminTokens.Tokens.Token); rec.Code != http.StatusForbidden {
+			t.Errorf("admin with stale token: got status %d, want 403", rec.Code)
+		}
+
+		// refreshing picks up the new role
+		rec := s.do(http.MethodPost, "/api/tokens", gin.H{"refreshToken": adminTokens.Tokens.RefreshToken}, "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("refresh: got status %d, body %s", rec.Code, rec.Body)
+		}
+		var refreshed tokensResponse
+		decode(t, rec, &refreshed)
+
+		rec = s.do(http.MethodGet, "/api/admin/accounts", nil, refreshed.Tokens.Token)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("admin: got status %d, body %s", rec.Code, rec.Body)
+		}
+		var resp struct {
+			Accounts []models.Account `json:"accounts"`
+		}
+		decode(t, rec, &resp)
+		if len(resp.Accounts) != 2 {
+			t.Errorf("admin: got %d accounts, want 2", len(resp.Accounts))
+		}
+	})
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s *testServer) {
+		first := s.signup("john@mail.com", "password123")
+
+		rec := s.do(http.MethodPost, "/api/tokens", gin.H{"refreshToken": first.Tokens.RefreshToken}, "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("refresh: got status %d, body %s", rec.Code, rec.Body)
+		}
+		var second tokensResponse
+		decode(t, rec, &second)
+		if second.Tokens.RefreshToken == first.Tokens.RefreshToken {
+			t.Fatal("refresh token was not rotated")
+		}
+
+		if rec := s.do(http.MethodGet, "/api/me", nil, second.Tokens.Token); rec.Code != http.StatusOK {
+			t.Fatalf("me with refreshed token: got status %d", rec.Code)
+		}
+
+		// the first refresh token was revoked by the rotation
+		if rec := s.do(http.MethodPost, "/api/tokens", gin.H{"refreshToken": first.Tokens.RefreshToken}, ""); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("reused refresh token: got status %d, want 401", rec.Code)
+		}
+
+		if rec := s.do(http.MethodPost, "/api/tokens", gin.H{"refreshToken": second.Tokens.RefreshToken}, ""); rec.Code != http.StatusOK {
+			t.Fatalf("second refresh: got status %d, body %s", rec.Code, rec.Body)
+		}
+
+		// id tokens aren't refresh tokens
+		if rec := s.do(http.MethodPost, "/api/tokens", gin.H{"refreshToken": second.Tokens.Token}, ""); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("id token as refresh token: got status %d, want 401", rec.Code)
+		}
+	})
+}
+
+func TestRefreshTokenExpiry(t *testing.T) {
+	s := newTestServer(t, backends[0])
+	tokens := s.signup("john@mail.com", "password123")
+
+	// refresh tokens are kept in redis with a TTL, once it lapses they're gone
+	s.redis.FastForward(s.cfg.Token.RefreshTokenExp + time.Second)
+
+	rec := s.do(http.MethodPost, "/api/tokens", gin.H{"refreshToken": tokens.Tokens.RefreshToken}, "")
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("got status %d, want 401, body %s", rec.Code, rec.Body)
+	}
+}
+
+func TestForcedPasswordChange(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s *testServer) {
+		ctx := context.Background()
+		hash, err := models.HashPassword(ctx, "bootstrap123")
+		if err != nil {
+			t.Fatalf("hashing password: %v", err)
+		}
+		// as created by the bootstrap admin seed
+		if err := s.accounts.Create(ctx, &models.Account{
+			Email:              "admin@mail.com",
+			FirstName:          "Gopay",
+			LastName:           "Admin",
+			Password:           hash,
+			AccountNumber:      1234567890,
+			RoleID:             models.AdminRoleID,
+			IsActive:           true,
+			MustChangePassword: true,
+		}); err != nil {
+			t.Fatalf("creating account: %v", err)
+		}
+
+		rec := s.do(http.MethodPost, "/api/login", gin.H{"email": "admin@mail.com", "password": "bootstrap123"}, "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("signin: got status %d, body %s", rec.Code, rec.Body)
+		}
+		var signin struct {
+			tokensResponse
+			MustChangePassword bool `json:"credentials_expired"`
+		}
+		decode(t, rec, &signin)
+		if !signin.MustChangePassword {
+			t.Fatal("signin didn't report the required password change")
+		}
+
+		for _, path := range []string{"/api/me", "/api/admin/accounts"} {
+			if rec := s.do(http.MethodGet, path, nil, signin.Tokens.Token); rec.Code != http.StatusForbidden {
+				t.Errorf("%s before changing password: got status %d, want 403", path, rec.Code)
+			}
+		}
+
+		change := func(current, password string) *httptest.ResponseRecorder {
+			return s.do(http.MethodPut, "/api/me/password", gin.H{
+				"current_password": current,
+				"password":         password,
+				"confirm_password": password,
+			}, signin.Tokens.Token)
+		}
+		if rec := change("wrong-password", "newpassword123"); rec.Code != http.StatusUnauthorized {
+			t.Errorf("wrong current password: got status %d, want 401", rec.Code)
+		}
+		if rec := change("bootstrap123", "bootstrap123"); rec.Code != http.StatusBadRequest {
+			t.Errorf("same password: got status %d, want 400", rec.Code)
+		}
+		rec = change("bootstrap123", "newpassword123")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("change password: got status %d, body %s", rec.Code, rec.Body)
+		}
+		var changed tokensResponse
+		decode(t, rec, &changed)
+
+		for _, path := range []string{"/api/me", "/api/admin/accounts"} {
+			if rec := s.do(http.MethodGet, path, nil, changed.Tokens.Token); rec.Code != http.StatusOK {
+				t.Errorf("%s after changing password: got status %d, body %s", path, rec.Code, rec.Body)
+			}
+		}
+		// sessions started with the old password are gone
+		if rec := s.do(http.MethodPost, "/api/tokens", gin.H{"refreshToken": signin.Tokens.RefreshToken}, ""); rec.Code != http.StatusUnauthorized {
+			t.Errorf("old refresh token: got status %d, want 401", rec.Code)
+		}
+		if rec := s.do(http.MethodPost, "/api/login", gin.H{"email": "admin@mail.com", "password": "newpassword123"}, ""); rec.Code != http.StatusOK {
+			t.Errorf("signin with the new password: got status %d", rec.Code)
+		}
+	})
+}
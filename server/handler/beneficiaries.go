@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/Cprime50/Gopay/helper"
+	"github.com/Cprime50/Gopay/middleware"
+	models "github.com/Cprime50/Gopay/models/account"
+	"github.com/Cprime50/Gopay/service"
+	"github.com/gin-gonic/gin"
+)
+
+// beneficiaryReq saves a recipient, the holder's name is looked up from the account number
+type beneficiaryReq struct {
+	Nickname      string `json:"nickname" binding:"required,max=50"`
+	AccountNumber int64  `json:"account_number" binding:"required,gt=0"`
+	Favourite     bool   `json:"favourite"`
+}
+
+// beneficiaryUpdateReq renames a beneficiary or marks it a favourite, fields left out are kept
+type beneficiaryUpdateReq struct {
+	Nickname  *string `json:"nickname" binding:"omitempty,max=50"`
+	Favourite *bool   `json:"favourite"`
+}
+
+// beneficiaryResp wraps one beneficiary
+type beneficiaryResp struct {
+	Beneficiary *models.Beneficiary `json:"beneficiary"`
+}
+
+// beneficiariesResp lists the account's beneficiaries
+type beneficiariesResp struct {
+	Beneficiaries []*models.Beneficiary `json:"beneficiaries"`
+}
+
+// CreateBeneficiary saves a recipient for the signed in account
+func (h *Handler) CreateBeneficiary(c *gin.Context) {
+	var input beneficiaryReq
+	if err := c.ShouldBindJSON(&input); err != nil {
+		middleware.Abort(c, helper.NewBindError(err))
+		return
+	}
+
+	value, _ := c.Get("account")
+	beneficiary := &models.Beneficiary{
+		AccountID:     value.(*models.Account).ID,
+		Nickname:      input.Nickname,
+		AccountNumber: input.AccountNumber,
+		Favourite:     input.Favourite,
+	}
+	if err := h.BeneficiaryService.Create(c.Request.Context(), beneficiary); err != nil {
+		middleware.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, beneficiaryResp{Beneficiary: beneficiary})
+}
+
+// GetBeneficiaries lists the signed in account's beneficiaries
+func (h *Handler) GetBeneficiaries(c *gin.Context) {
+	value, _ := c.Get("account")
+	beneficiaries, err := h.BeneficiaryService.List(c.Request.Context(), value.(*models.Account).ID)
+	if err != nil {
+		middleware.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, beneficiariesResp{Beneficiaries: beneficiaries})
+}
+
+// GetBeneficiary returns one of the signed in account's beneficiaries
+func (h *Handler) GetBeneficiary(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	value, _ := c.Get("account")
+	beneficiary, err := h.BeneficiaryService.Get(c.Request.Context(), value.(*models.Account).ID, id)
+	if err != nil {
+		middleware.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, beneficiaryResp{Beneficiary: beneficiary})
+}
+
+// UpdateBeneficiary renames a beneficiary or marks it a favourite
+func (h *Handler) UpdateBeneficiary(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+	var input beneficiaryUpdateReq
+	if err := c.ShouldBindJSON(&input); err != nil {
+		middleware.Abort(c, helper.NewBindError(err))
+		return
+	}
+
+	value, _ := c.Get("account")
+	beneficiary, err := h.BeneficiaryService.Update(c.Request.Context(), value.(*models.Account).ID, id, service.BeneficiaryUpdate{
+		Nickname:  input.Nickname,
+		Favourite: input.Favourite,
+	})
+	if err != nil {
+		middleware.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, beneficiaryResp{Beneficiary: beneficiary})
+}
+
+// DeleteBeneficiary removes one of the signed in account's beneficiaries
+func (h *Handler) DeleteBeneficiary(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	value, _ := c.Get("account")
+	if err := h.BeneficiaryService.Delete(c.Request.Context(), value.(*models.Account).ID, id); err != nil {
+		middleware.Abort(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
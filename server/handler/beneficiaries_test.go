@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Cprime50/Gopay/config"
+	"github.com/Cprime50/Gopay/helper"
+	"github.com/gin-gonic/gin"
+)
+
+func TestBeneficiaries(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s *testServer) {
+		ctx := context.Background()
+		john := s.signup("john@mail.com", "password123").Tokens.Token
+		jane := s.signup("jane@mail.com", "password123").Tokens.Token
+		s.signup("jim@mail.com", "password123")
+		janeAccount, _ := s.accounts.GetByEmail(ctx, "jane@mail.com")
+		jimAccount, _ := s.accounts.GetByEmail(ctx, "jim@mail.com")
+
+		add := func(nickname string, accountNumber int64) beneficiaryResp {
+			t.Helper()
+			rec := s.do(http.MethodPost, "/api/beneficiaries", gin.H{"nickname": nickname, "account_number": accountNumber}, john)
+			if rec.Code != http.StatusCreated {
+				t.Fatalf("add %s: got status %d, body %s", nickname, rec.Code, rec.Body)
+			}
+			var created beneficiaryResp
+			decode(t, rec, &created)
+			return created
+		}
+		created := add("Jane", janeAccount.AccountNumber)
+		if b := created.Beneficiary; b.HolderName != "Jo** Do*" || b.AccountNumber != janeAccount.AccountNumber || b.Favourite {
+			t.Fatalf("add: got %+v", b)
+		}
+		id := created.Beneficiary.ID.String()
+		if strings.Contains(s.do(http.MethodGet, "/api/beneficiaries/"+id, nil, john).Body.String(), "account_id") {
+			t.Fatal("beneficiary shows the owner's account ID")
+		}
+		jim := add("Jim", jimAccount.AccountNumber).Beneficiary.ID.String()
+
+		problem(t, s.do(http.MethodPost, "/api/beneficiaries", gin.H{"nickname": "Jane again", "account_number": janeAccount.AccountNumber}, john), http.StatusConflict, helper.CodeConflict)
+		problem(t, s.do(http.MethodPost, "/api/beneficiaries", gin.H{"nickname": "Nobody", "account_number": 42}, john), http.StatusBadRequest, helper.CodeValidationFailed)
+		problem(t, s.do(http.MethodPost, "/api/beneficiaries", gin.H{"account_number": jimAccount.AccountNumber}, john), http.StatusBadRequest, helper.CodeValidationFailed)
+		problem(t, s.do(http.MethodGet, "/api/beneficiaries/"+id, nil, jane), http.StatusNotFound, helper.CodeNotFound)
+		problem(t, s.do(http.MethodDelete, "/api/beneficiaries/"+id, nil, jane), http.StatusNotFound, helper.CodeNotFound)
+		problem(t, s.do(http.MethodGet, "/api/beneficiaries", nil, ""), http.StatusUnauthorized, helper.CodeUnauthenticated)
+
+		// favourites come first
+		rec := s.do(http.MethodPatch, "/api/beneficiaries/"+jim, gin.H{"favourite": true}, john)
+		var updated beneficiaryResp
+		decode(t, rec, &updated)
+		if rec.Code != http.StatusOK || !updated.Beneficiary.Favourite || updated.Beneficiary.Nickname != "Jim" {
+			t.Fatalf("favourite: got status %d, body %s", rec.Code, rec.Body)
+		}
+		rec = s.do(http.MethodGet, "/api/beneficiaries", nil, john)
+		var list beneficiariesResp
+		decode(t, rec, &list)
+		if rec.Code != http.StatusOK || len(list.Beneficiaries) != 2 || list.Beneficiaries[0].ID.String() != jim {
+			t.Fatalf("list: got status %d, body %s", rec.Code, rec.Body)
+		}
+
+		if rec := s.do(http.MethodDelete, "/api/beneficiaries/"+id, nil, john); rec.Code != http.StatusNoContent {
+			t.Fatalf("delete: got status %d, body %s", rec.Code, rec.Body)
+		}
+		problem(t, s.do(http.MethodGet, "/api/beneficiaries/"+id, nil, john), http.StatusNotFound, helper.CodeNotFound)
+	})
+}
+
+func TestBeneficiaryLookupBudget(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s *testServer) {
+		john := s.signup("john@mail.com", "password123").Tokens.Token
+		s.signup("jane@mail.com", "password123")
+		jane, _ := s.accounts.GetByEmail(context.Background(), "jane@mail.com")
+
+		// adding a beneficiary shows the holder's name, so it's charged to the lookup budget
+		add := gin.H{"nickname": "Jane", "account_number": jane.AccountNumber}
+		for i := int64(0); i < lookupRateLimit.Limit; i++ {
+			if rec := s.do(http.MethodPost, "/api/beneficiaries", add, john); rec.Code == http.StatusTooManyRequests {
+				t.Fatalf("add %d: limited before the lookup budget ran out", i)
+			}
+		}
+		problem(t, s.do(http.MethodPost, "/api/beneficiaries", add, john), http.StatusTooManyRequests, helper.CodeRateLimited)
+		problem(t, s.do(http.MethodGet, fmt.Sprintf("/api/accounts/lookup?account_number=%d", jane.AccountNumber), nil, john), http.StatusTooManyRequests, helper.CodeRateLimited)
+		if rec := s.do(http.MethodGet, "/api/beneficiaries", nil, john); rec.Code != http.StatusOK {
+			t.Fatalf("list: got status %d, body %s", rec.Code, rec.Body)
+		}
+	})
+}
+
+func TestBeneficiaryCoolOff(t *testing.T) {
+	for _, b := range backends {
+		t.Run(b.name, func(t *testing.T) {
+			s := newTestServer(t, b, func(cfg *config.Config) {
+				cfg.Beneficiaries.CoolOff = time.Hour
+			})
+			john := s.signup("john@mail.com", "password123").Tokens.Token
+			s.signup("jane@mail.com", "password123")
+			s.activate("john@mail.com")
+			s.activate("jane@mail.com")
+			jane, _ := s.accounts.GetByEmail(context.Background(), "jane@mail.com")
+
+			// with a cool off only saved beneficiaries can be paid
+			unsaved := gin.H{"to_account_number": jane.AccountNumber, "amount": 10, "frequency": "once", "start_at": time.Now().Add(2 * time.Hour)}
+			problem(t, s.do(http.MethodPost, "/api/schedules", unsaved, john), http.StatusBadRequest, helper.CodeValidationFailed)
+
+			rec := s.do(http.MethodPost, "/api/beneficiaries", gin.H{"nickname": "Jane", "account_number": jane.AccountNumber}, john)
+			var created beneficiaryResp
+			decode(t, rec, &created)
+			availableAt := created.Beneficiary.AvailableAt
+			if rec.Code != http.StatusCreated || availableAt.Before(time.Now().Add(59*time.Minute)) {
+				t.Fatalf("add: got status %d, body %s", rec.Code, rec.Body)
+			}
+
+			schedule := gin.H{"to_account_number": jane.AccountNumber, "amount": 10, "frequency": "once"}
+			problem(t, s.do(http.MethodPost, "/api/schedules", schedule, john), http.StatusBadRequest, helper.CodeValidationFailed)
+			schedule["start_at"] = availableAt
+			if rec := s.do(http.MethodPost, "/api/schedules", schedule, john); rec.Code != http.StatusCreated {
+				t.Fatalf("schedule after the cool off: got status %d, body %s", rec.Code, rec.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Cprime50/Gopay/config"
+	"github.com/Cprime50/Gopay/helper"
+	"github.com/Cprime50/Gopay/middleware"
+	"github.com/gin-gonic/gin"
+)
+
+// problem decodes and sanity checks a problem+json response
+func problem(t *testing.T, rec *httptest.ResponseRecorder, status int, code helper.Code) helper.Problem {
+	t.Helper()
+	if rec.Code != status {
+		t.Fatalf("got status %d, want %d, body %s", rec.Code, status, rec.Body)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, helper.ProblemContentType) {
+		t.Fatalf("got content type %q, want %s", ct, helper.ProblemContentType)
+	}
+	var p helper.Problem
+	decode(t, rec, &p)
+	if p.Status != status || p.Code != code || p.Type != "urn:gopay:problem:"+string(code) || p.Title == "" {
+		t.Fatalf("unexpected problem %+v, want status %d code %s", p, status, code)
+	}
+	if p.RequestID == "" || p.RequestID != rec.Header().Get(middleware.RequestIDHeader) {
+		t.Fatalf("problem request ID %q doesn't match the header %q", p.RequestID, rec.Header().Get(middleware.RequestIDHeader))
+	}
+	return p
+}
+
+func TestValidationProblemListsEveryField(t *testing.T) {
+	s := newTestServer(t, backends[0])
+
+	rec := s.do(http.MethodPost, "/api/register", gin.H{
+		"first_name":       "Jo",
+		"email":            "not-an-email",
+		"password":         "password123",
+		"confirm_password": "password456",
+	}, "")
+	p := problem(t, rec, http.StatusBadRequest, helper.CodeValidationFailed)
+	if p.Instance != "/api/register" {
+		t.Errorf("got instance %q", p.Instance)
+	}
+
+	want := map[string]string{
+		"first_name":       "min",
+		"last_name":        "required",
+		"email":            "email",
+		"confirm_password": "eqfield",
+	}
+	if len(p.InvalidParams) != len(want) {
+		t.Fatalf("got invalid params %+v, want %v", p.InvalidParams, want)
+	}
+	for _, param := range p.InvalidParams {
+		if want[param.Name] != param.Rule || param.Reason == "" {
+			t.Errorf("unexpected invalid param %+v", param)
+		}
+	}
+}
+
+func TestErrorProblems(t *testing.T) {
+	s := newTestServer(t, backends[0])
+	tokens := s.signup("john@mail.com", "password123")
+
+	s.router.GET("/panic", func(c *gin.Context) { panic("boom") })
+
+	malformed := httptest.NewRequest(http.MethodPost, "/api/login", strings.NewReader(`{"email":`))
+	malformed.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, malformed)
+	problem(t, rec, http.StatusBadRequest, helper.CodeMalformedBody)
+
+	wrongType := s.do(http.MethodPost, "/api/login", gin.H{"email": 42, "password": "password123"}, "")
+	if p := problem(t, wrongType, http.StatusBadRequest, helper.CodeMalformedBody); len(p.InvalidParams) != 1 || p.InvalidParams[0].Name != "email" {
+		t.Errorf("wrong type: got invalid params %+v", p.InvalidParams)
+	}
+
+	problem(t, s.do(http.MethodPost, "/api/login", gin.H{"email": "john@mail.com", "password": "password456"}, ""), http.StatusUnauthorized, helper.CodeInvalidCredentials)
+	problem(t, s.do(http.MethodPost, "/api/register", gin.H{
+		"first_name":       "John",
+		"last_name":        "Doe",
+		"email":            "john@mail.com",
+		"password":         "password123",
+		"confirm_password": "password123",
+	}, ""), http.StatusConflict, helper.CodeEmailTaken)
+	problem(t, s.do(http.MethodGet, "/api/me", nil, ""), http.StatusUnauthorized, helper.CodeUnauthenticated)
+	problem(t, s.do(http.MethodGet, "/api/me", nil, "not.a.token"), http.StatusUnauthorized, helper.CodeInvalidToken)
+	problem(t, s.do(http.MethodGet, "/api/admin/accounts", nil, tokens.Tokens.Token), http.StatusForbidden, helper.CodeForbidden)
+	problem(t, s.do(http.MethodGet, "/api/nope", nil, ""), http.StatusNotFound, helper.CodeRouteNotFound)
+
+	p := problem(t, s.do(http.MethodGet, "/panic", nil, ""), http.StatusInternalServerError, helper.CodeInternal)
+	if strings.Contains(p.Detail, "boom") {
+		t.Errorf("panic value leaked in %q", p.Detail)
+	}
+
+	// the signup limit is 5 per hour, one is used above
+	for i := 0; i < 5; i++ {
+		rec = s.do(http.MethodPost, "/api/register", gin.H{}, "")
+	}
+	problem(t, rec, http.StatusTooManyRequests, helper.CodeRateLimited)
+}
+
+func TestRateLimitByIP(t *testing.T) {
+	login := func(s *testServer, forwardedFor string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/login", strings.NewReader(`{}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// without trusted proxies a new X-Forwarded-For on every request
+	// is still counted against the peer
+	s := newTestServer(t, backends[0])
+	for i := int64(0); i < loginRateLimit.Limit; i++ {
+		login(s, fmt.Sprintf("198.51.100.%d", i))
+	}
+	problem(t, login(s, "198.51.100.200"), http.StatusTooManyRequests, helper.CodeRateLimited)
+
+	// behind a trusted proxy each forwarded client has its own budget
+	s = newTestServer(t, backends[0], func(cfg *config.Config) {
+		cfg.Server.TrustedProxies = []string{"192.0.2.0/24"}
+	})
+	for i := int64(0); i < loginRateLimit.Limit; i++ {
+		login(s, "198.51.100.1")
+	}
+	problem(t, login(s, "198.51.100.1"), http.StatusTooManyRequests, helper.CodeRateLimited)
+	if rec := login(s, "198.51.100.2"); rec.Code == http.StatusTooManyRequests {
+		t.Fatalf("another client behind the proxy was limited: %s", rec.Body)
+	}
+}
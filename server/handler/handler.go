@@ -1,60 +1,109 @@
 package handler
 
 import (
-	"fmt"
-	"log"
-	"os"
-	"strconv"
+	"log/slog"
+	"sync/atomic"
 	"time"
 
+	"github.com/Cprime50/Gopay/config"
+	"github.com/Cprime50/Gopay/helper"
+	"github.com/Cprime50/Gopay/middleware"
+	"github.com/Cprime50/Gopay/openapi"
+	"github.com/Cprime50/Gopay/realtime"
+	"github.com/Cprime50/Gopay/service"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
 )
 
+// Services holds everything the handler depends on, built in main
+// so tests can swap in their own implementations
+type Services struct {
+	AccountService      *service.AccountService
+	TokenService        *service.TokenService
+	ScheduleService     *service.ScheduleService
+	WebhookService      *service.WebhookService
+	SMSService          *service.SMSService
+	NotificationService *service.NotificationService
+	BeneficiaryService  *service.BeneficiaryService
+	RateLimiter         *middleware.RateLimiter
+	// Realtime streams updates to connected clients
+	Realtime *realtime.Hub
+	// ReadinessChecks are run by /readyz, keyed by dependency name
+	ReadinessChecks map[string]DependencyCheck
+}
+
 // Handler struct holds required services for handler to function
 type Handler struct {
-	router          *gin.Engine
-	BaseURL         string
-	TimeoutDuration time.Duration
-	MaxBodyBytes    int64
+	router              *gin.Engine
+	AccountService      *service.AccountService
+	TokenService        *service.TokenService
+	ScheduleService     *service.ScheduleService
+	WebhookService      *service.WebhookService
+	SMSService          *service.SMSService
+	NotificationService *service.NotificationService
+	BeneficiaryService  *service.BeneficiaryService
+	RateLimiter         *middleware.RateLimiter
+	Realtime            *realtime.Hub
+	readinessChecks     map[string]DependencyCheck
+	BaseURL             string
+	TimeoutDuration     time.Duration
+	MaxBodyBytes        int64
+	MetricsToken        string
+	// Heartbeat is how often idle update streams are sent a comment
+	Heartbeat time.Duration
+	// ServeDocs serves the Redoc UI at /docs, off in production
+	ServeDocs bool
+	spec      *openapi.Document
+	ready     atomic.Bool
 }
 
 // Initilizes and retuens new handler
-func (h *Handler) NewHandler(router *gin.Engine) (*Handler, error) {
-	log.Print("setting up handler")
+func NewHandler(router *gin.Engine, cfg *config.Config, services Services) (*Handler, error) {
+	slog.Info("setting up handler")
 
-	// read in ACCOUNT_API_URL
-	baseURL := os.Getenv("ACCOUNT_API_URL")
+	baseURL := cfg.Server.BaseURL
 
-	// read in HANDLER_TIMEOUT
-	handlerTimeout := os.Getenv("HANDLER_TIMEOUT")
-	hTimeout, err := strconv.ParseInt(handlerTimeout, 0, 64)
-	if err != nil {
-		return nil, fmt.Errorf("could not parse HANDLER_TIMEOUT as int: %w", err)
+	handler := &Handler{
+		router:              router,
+		AccountService:      services.AccountService,
+		TokenService:        services.TokenService,
+		ScheduleService:     services.ScheduleService,
+		WebhookService:      services.WebhookService,
+		SMSService:          services.SMSService,
+		NotificationService: services.NotificationService,
+		BeneficiaryService:  services.BeneficiaryService,
+		RateLimiter:         services.RateLimiter,
+		Realtime:            services.Realtime,
+		readinessChecks:     services.ReadinessChecks,
+		BaseURL:             baseURL,
+		TimeoutDuration:     cfg.Server.HandlerTimeout,
+		MaxBodyBytes:        cfg.Server.MaxBodyBytes,
+		MetricsToken:        cfg.Metrics.Token,
+		Heartbeat:           cfg.Realtime.Heartbeat,
+		ServeDocs:           !cfg.IsProduction(),
 	}
 
-	maxBodyBytes := os.Getenv("MAX_BODY_BYTES")
-	maxbb, err := strconv.ParseInt(maxBodyBytes, 0, 64)
-	if err != nil {
-		return nil, fmt.Errorf("could not parse MAX_BODY_BYTES as int: %w", err)
+	// X-Forwarded-For is only believed from the configured proxies, else
+	// anyone could pick the IP they're rate limited and let in by
+	if err := router.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		return nil, err
 	}
 
-	//set timeout middleware
-	timeoutDuration := time.Duration(time.Duration(hTimeout) * time.Second)
-
-	handler := &Handler{
-		router:          router,
-		BaseURL:         baseURL,
-		TimeoutDuration: timeoutDuration,
-		MaxBodyBytes:    maxbb,
+	spec, err := handler.newOpenAPI()
+	if err != nil {
+		return nil, err
 	}
+	handler.spec = spec
 
 	// Add CORS middleware
 	router.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"https://*, http://*, *"},
-		AllowMethods:     []string{"GET, POST, PUT, DELETE, OPTIONS"},
-		AllowHeaders:     []string{"Origin, Accept, Authorization, Content-Type, X-CSRF-Token"},
-		ExposeHeaders:    []string{"Link"},
+		AllowOrigins: []string{"https://*, http://*, *"},
+		AllowMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowHeaders: []string{"Origin, Accept, Authorization, Content-Type, X-CSRF-Token, Last-Event-ID"},
+		// pagination, rate limits and the request ID to quote in support requests
+		ExposeHeaders:    []string{"Link", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After", middleware.RequestIDHeader},
 		AllowCredentials: true,
 		AllowOriginFunc: func(origin string) bool {
 			return origin == baseURL
@@ -62,6 +111,17 @@ func (h *Handler) NewHandler(router *gin.Engine) (*Handler, error) {
 		MaxAge: 12 * time.Hour,
 	}))
 
+	// every error is rendered as problem+json in the negotiated locale, panics included
+	router.Use(middleware.Locale(), middleware.Errors(), middleware.Recovery())
+
+	// report invalid fields by the names clients send, in their language
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(helper.JSONTagName)
+		if err := helper.RegisterTranslations(v); err != nil {
+			return nil, err
+		}
+	}
+
 	// //routes and middleware setup
 	// handler.SetupRoutes() //to set up routes
 
@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Cprime50/Gopay/helper"
+	"github.com/gin-gonic/gin"
+)
+
+// readinessTimeout bounds each dependency check so a hung
+// dependency can't hang the probe itself
+const readinessTimeout = 2 * time.Second
+
+// DependencyCheck pings a single dependency the service needs to serve traffic
+type DependencyCheck func(ctx context.Context) error
+
+// checkResult is the per dependency status reported by /readyz
+type checkResult struct {
+	Status    string `json:"status"`
+	LatencyMs int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+// healthResp is the body of /healthz
+type healthResp struct {
+	Status string `json:"status"`
+}
+
+// readinessResp is the body of /readyz, status is ready, not_ready or shutting_down
+type readinessResp struct {
+	Status string                 `json:"status"`
+	Checks map[string]checkResult `json:"checks"`
+}
+
+// SetReady marks the service as ready or not to receive traffic.
+// It's flipped off when shutdown starts so orchestrators stop routing
+// requests here while in-flight ones drain
+func (h *Handler) SetReady(ready bool) {
+	h.ready.Store(ready)
+}
+
+// Healthz reports the process is alive, it never touches dependencies
+func (h *Handler) Healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, healthResp{Status: "ok"})
+}
+
+// Readyz reports whether every dependency in the readiness checks,
+// eg postgres, redis and the signing keys, is available
+func (h *Handler) Readyz(c *gin.Context) {
+	checks := h.readinessChecks
+
+	results := make(map[string]checkResult, len(checks))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check DependencyCheck) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(c.Request.Context(), readinessTimeout)
+			defer cancel()
+
+			start := time.Now()
+			result := checkResult{Status: "up"}
+			if err := check(ctx); err != nil {
+				// the error can name hosts and addresses, so it's only logged
+				helper.Logger(ctx).Warn("readiness check failed", "dependency", name, "error", err)
+				result.Status = "down"
+				result.Error = "unavailable"
+			}
+			result.LatencyMs = time.Since(start).Milliseconds()
+
+			mu.Lock()
+			results[name] = result
+			mu.Unlock()
+		}(name, check)
+	}
+	wg.Wait()
+
+	status, code := "ready", http.StatusOK
+	if !h.ready.Load() {
+		status, code = "shutting_down", http.StatusServiceUnavailable
+	}
+	for _, result := range results {
+		if result.Status != "up" && status == "ready" {
+			status, code = "not_ready", http.StatusServiceUnavailable
+		}
+	}
+
+	c.JSON(code, readinessResp{
+		Status: status,
+		Checks: results,
+	})
+}
@@ -0,0 +1,137 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Cprime50/Gopay/helper"
+	"github.com/Cprime50/Gopay/i18n"
+	"github.com/gin-gonic/gin"
+)
+
+// doLocale is do with an Accept-Language header, left out if empty
+func (s *testServer) doLocale(method, path string, body any, token string, acceptLanguage string) *httptest.ResponseRecorder {
+	s.t.Helper()
+
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			s.t.Fatalf("encoding body: %v", err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if acceptLanguage != "" {
+		req.Header.Set("Accept-Language", acceptLanguage)
+	}
+
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestLocalisedProblems(t *testing.T) {
+	s := newTestServer(t, backends[0])
+
+	invalid := gin.H{"first_name": "Jo", "email": "not-an-email"}
+
+	en := problem(t, s.doLocale(http.MethodPost, "/api/register", invalid, "", ""), http.StatusBadRequest, helper.CodeValidationFailed)
+	fr := problem(t, s.doLocale(http.MethodPost, "/api/register", invalid, "", "fr-FR,fr;q=0.9,en;q=0.5"), http.StatusBadRequest, helper.CodeValidationFailed)
+
+	if en.Title != "Validation failed" || fr.Title != "Échec de la validation" {
+		t.Errorf("got titles %q and %q", en.Title, fr.Title)
+	}
+	if len(en.InvalidParams) != len(fr.InvalidParams) {
+		t.Fatalf("got %d English and %d French invalid params", len(en.InvalidParams), len(fr.InvalidParams))
+	}
+	for i := range en.InvalidParams {
+		if en.InvalidParams[i].Name != fr.InvalidParams[i].Name || en.InvalidParams[i].Rule != fr.InvalidParams[i].Rule {
+			t.Errorf("params differ between locales: %+v and %+v", en.InvalidParams[i], fr.InvalidParams[i])
+		}
+		if en.InvalidParams[i].Reason == fr.InvalidParams[i].Reason {
+			t.Errorf("reason %q isn't translated", fr.InvalidParams[i].Reason)
+		}
+	}
+
+	rec := s.doLocale(http.MethodGet, "/api/nope", nil, "", "fr")
+	if p := problem(t, rec, http.StatusNotFound, helper.CodeRouteNotFound); p.Detail != "Aucun point d'accès ne correspond à /api/nope." {
+		t.Errorf("got detail %q", p.Detail)
+	}
+	if got := rec.Header().Get("Content-Language"); got != i18n.French {
+		t.Errorf("got Content-Language %q", got)
+	}
+
+	// unsupported languages fall back to English
+	if p := problem(t, s.doLocale(http.MethodGet, "/api/nope", nil, "", "de"), http.StatusNotFound, helper.CodeRouteNotFound); p.Title != "Route not found" {
+		t.Errorf("got title %q", p.Title)
+	}
+}
+
+func TestAccountLocale(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s *testServer) {
+		// the locale negotiated at signup becomes the account's preference
+		rec := s.doLocale(http.MethodPost, "/api/register", gin.H{
+			"first_name":       "Jean",
+			"last_name":        "Dupont",
+			"email":            "jean@mail.com",
+			"password":         "password123",
+			"confirm_password": "password123",
+		}, "", "fr")
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("signup: got status %d, body %s", rec.Code, rec.Body)
+		}
+		var signup struct {
+			Message string `json:"message"`
+			tokensResponse
+		}
+		decode(t, rec, &signup)
+		if signup.Message != "compte créé avec succès" {
+			t.Errorf("got message %q", signup.Message)
+		}
+		token := signup.Tokens.Token
+
+		var me struct {
+			Account struct {
+				Locale string `json:"locale"`
+			} `json:"account"`
+		}
+		decode(t, s.do(http.MethodGet, "/api/me", nil, token), &me)
+		if me.Account.Locale != i18n.French {
+			t.Fatalf("got locale %q after signup, want %q", me.Account.Locale, i18n.French)
+		}
+
+		// without Accept-Language the account's preference is used
+		rec = s.do(http.MethodPut, "/api/me/locale", gin.H{"locale": "de"}, token)
+		if p := problem(t, rec, http.StatusBadRequest, helper.CodeValidationFailed); p.Title != "Échec de la validation" {
+			t.Errorf("got title %q", p.Title)
+		}
+		// and Accept-Language overrides it
+		rec = s.doLocale(http.MethodPut, "/api/me/locale", gin.H{"locale": "de"}, token, "en")
+		if p := problem(t, rec, http.StatusBadRequest, helper.CodeValidationFailed); !strings.Contains(p.InvalidParams[0].Reason, "locale") || p.Title != "Validation failed" {
+			t.Errorf("unexpected problem %+v", p)
+		}
+
+		rec = s.do(http.MethodPut, "/api/me/locale", gin.H{"locale": "en"}, token)
+		var changed tokensResponse
+		decode(t, rec, &changed)
+		if rec.Code != http.StatusOK || changed.Tokens.Token == "" {
+			t.Fatalf("set locale: got status %d, body %s", rec.Code, rec.Body)
+		}
+		decode(t, s.do(http.MethodGet, "/api/me", nil, token), &me)
+		if me.Account.Locale != i18n.English {
+			t.Errorf("got locale %q, want %q", me.Account.Locale, i18n.English)
+		}
+		// responses to the new token are in the new language straight away
+		rec = s.do(http.MethodPut, "/api/me/locale", gin.H{"locale": "de"}, changed.Tokens.Token)
+		if p := problem(t, rec, http.StatusBadRequest, helper.CodeValidationFailed); p.Title != "Validation failed" {
+			t.Errorf("got title %q with the new token", p.Title)
+		}
+	})
+}
@@ -0,0 +1,181 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/Cprime50/Gopay/helper"
+	"github.com/Cprime50/Gopay/i18n"
+	"github.com/Cprime50/Gopay/middleware"
+	models "github.com/Cprime50/Gopay/models/account"
+	"github.com/Cprime50/Gopay/service"
+	"github.com/gin-gonic/gin"
+)
+
+// notificationsQuery pages the inbox, cursor is the next_cursor of the
+// previous page
+type notificationsQuery struct {
+	Limit  int    `form:"limit" binding:"omitempty,min=1,max=100"`
+	Cursor string `form:"cursor" binding:"max=200"`
+	Unread bool   `form:"unread"`
+}
+
+// preferenceReq changes the channels of a category, fields left out are kept
+type preferenceReq struct {
+	InApp *bool `json:"in_app"`
+	Email *bool `json:"email"`
+	SMS   *bool `json:"sms"`
+}
+
+// notificationItem is a notification with its text in the reader's language
+type notificationItem struct {
+	*models.Notification
+	Title string `json:"title"`
+	Body  string `json:"body"`
+}
+
+// notificationsResp is a page of the inbox, next_cursor is empty on the last
+type notificationsResp struct {
+	Notifications []notificationItem `json:"notifications"`
+	NextCursor    string             `json:"next_cursor"`
+}
+
+// notificationResp wraps one notification
+type notificationResp struct {
+	Notification notificationItem `json:"notification"`
+}
+
+type unreadCountResp struct {
+	Unread int64 `json:"unread"`
+}
+
+// readAllResp tells how many notifications were marked read
+type readAllResp struct {
+	Message string `json:"message"`
+	Read    int64  `json:"read"`
+}
+
+// preferencesResp lists the channels of every category
+type preferencesResp struct {
+	Preferences []*models.NotificationPreference `json:"preferences"`
+}
+
+// preferenceResp wraps the channels of one category
+type preferenceResp struct {
+	Message    string                         `json:"message"`
+	Preference *models.NotificationPreference `json:"preference"`
+}
+
+// GetNotifications lists the signed in account's inbox, newest first
+func (h *Handler) GetNotifications(c *gin.Context) {
+	query := notificationsQuery{Limit: 20}
+	if err := c.ShouldBindQuery(&query); err != nil {
+		middleware.Abort(c, helper.NewBindError(err))
+		return
+	}
+
+	value, _ := c.Get("account")
+	ctx := c.Request.Context()
+	page, err := h.NotificationService.List(ctx, value.(*models.Account).ID, query.Unread, query.Cursor, query.Limit)
+	if err != nil {
+		middleware.Abort(c, err)
+		return
+	}
+
+	locale := i18n.FromContext(ctx)
+	items := make([]notificationItem, 0, len(page.Notifications))
+	for _, n := range page.Notifications {
+		items = append(items, newNotificationItem(locale, n))
+	}
+	c.JSON(http.StatusOK, notificationsResp{Notifications: items, NextCursor: page.NextCursor})
+}
+
+// GetUnreadCount counts the signed in account's unread notifications
+func (h *Handler) GetUnreadCount(c *gin.Context) {
+	value, _ := c.Get("account")
+	count, err := h.NotificationService.UnreadCount(c.Request.Context(), value.(*models.Account).ID)
+	if err != nil {
+		middleware.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, unreadCountResp{Unread: count})
+}
+
+// ReadNotification marks one of the signed in account's notifications read
+func (h *Handler) ReadNotification(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	value, _ := c.Get("account")
+	ctx := c.Request.Context()
+	notification, err := h.NotificationService.MarkRead(ctx, value.(*models.Account).ID, id)
+	if err != nil {
+		middleware.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, notificationResp{Notification: newNotificationItem(i18n.FromContext(ctx), notification)})
+}
+
+// ReadAllNotifications marks every notification of the signed in account read
+func (h *Handler) ReadAllNotifications(c *gin.Context) {
+	value, _ := c.Get("account")
+	ctx := c.Request.Context()
+	count, err := h.NotificationService.MarkAllRead(ctx, value.(*models.Account).ID)
+	if err != nil {
+		middleware.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, readAllResp{
+		Message: i18n.T(i18n.FromContext(ctx), "notifications_read", map[string]string{"count": strconv.FormatInt(count, 10)}),
+		Read:    count,
+	})
+}
+
+// GetNotificationPreferences lists the channels the signed in account
+// chose for every category
+func (h *Handler) GetNotificationPreferences(c *gin.Context) {
+	value, _ := c.Get("account")
+	preferences, err := h.NotificationService.Preferences(c.Request.Context(), value.(*models.Account).ID)
+	if err != nil {
+		middleware.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, preferencesResp{Preferences: preferences})
+}
+
+// UpdateNotificationPreference changes the channels of a category
+func (h *Handler) UpdateNotificationPreference(c *gin.Context) {
+	var input preferenceReq
+	if err := c.ShouldBindJSON(&input); err != nil {
+		middleware.Abort(c, helper.NewBindError(err))
+		return
+	}
+
+	value, _ := c.Get("account")
+	ctx := c.Request.Context()
+	preference, err := h.NotificationService.UpdatePreference(ctx, value.(*models.Account).ID, c.Param("category"), service.PreferenceUpdate{
+		InApp: input.InApp,
+		Email: input.Email,
+		SMS:   input.SMS,
+	})
+	if err != nil {
+		middleware.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, preferenceResp{
+		Message:    i18n.T(i18n.FromContext(ctx), "preferences_saved", nil),
+		Preference: preference,
+	})
+}
+
+func newNotificationItem(locale string, n *models.Notification) notificationItem {
+	title, body := service.NotificationText(locale, n)
+	return notificationItem{Notification: n, Title: title, Body: body}
+}
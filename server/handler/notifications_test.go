@@ -0,0 +1,150 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/Cprime50/Gopay/helper"
+	models "github.com/Cprime50/Gopay/models/account"
+	"github.com/Cprime50/Gopay/service"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// deliverNotifications relays pending events and runs every queued notification
+func (s *testServer) deliverNotifications(ctx context.Context) {
+	s.t.Helper()
+	if _, err := s.relay.RelayPending(ctx); err != nil {
+		s.t.Fatalf("relay: %v", err)
+	}
+	for {
+		ran, err := s.worker.RunOne(ctx, service.NotificationJob.Queue)
+		if err != nil {
+			s.t.Fatalf("deliver notification: %v", err)
+		}
+		if !ran {
+			return
+		}
+	}
+}
+
+func TestNotificationInbox(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s *testServer) {
+		ctx := context.Background()
+		john := s.signup("john@mail.com", "password123").Tokens.Token
+		jane := s.signup("jane@mail.com", "password123").Tokens.Token
+
+		sender, _ := s.accounts.GetByEmail(ctx, "john@mail.com")
+		recipient, _ := s.accounts.GetByEmail(ctx, "jane@mail.com")
+		for _, amount := range []float64{10, 20} {
+			err := s.ledger.Transfer(ctx,
+				&models.LedgerEntry{AccountID: sender.ID, Type: models.Debit, Amount: amount, Reason: "lunch", Actor: sender.Email},
+				&models.LedgerEntry{AccountID: recipient.ID, Type: models.Credit, Amount: amount, Reason: "lunch", Actor: sender.Email})
+			if err != nil {
+				t.Fatalf("transfer: %v", err)
+			}
+		}
+		s.deliverNotifications(ctx)
+
+		// jane has a welcome and two receipts, newest first
+		var page notificationsResp
+		rec := s.do(http.MethodGet, "/api/notifications?limit=2", nil, jane)
+		decode(t, rec, &page)
+		if rec.Code != http.StatusOK || len(page.Notifications) != 2 || page.NextCursor == "" {
+			t.Fatalf("first page: got status %d, body %s", rec.Code, rec.Body)
+		}
+		newest := page.Notifications[0]
+		if newest.Event != service.EventTransferReceived || newest.Category != models.CategoryTransactions || newest.Title != "You received 20.00" {
+			t.Fatalf("newest: got %+v", newest)
+		}
+		rec = s.do(http.MethodGet, "/api/notifications?limit=2&cursor="+url.QueryEscape(page.NextCursor), nil, jane)
+		decode(t, rec, &page)
+		if rec.Code != http.StatusOK || len(page.Notifications) != 1 || page.NextCursor != "" || page.Notifications[0].Event != models.EventAccountCreated {
+			t.Fatalf("last page: got status %d, body %s", rec.Code, rec.Body)
+		}
+		problem(t, s.do(http.MethodGet, "/api/notifications?cursor=nope", nil, jane), http.StatusBadRequest, helper.CodeValidationFailed)
+		problem(t, s.do(http.MethodGet, "/api/notifications?limit=500", nil, jane), http.StatusBadRequest, helper.CodeValidationFailed)
+
+		// text follows the reader's language
+		rec = s.doLocale(http.MethodGet, "/api/notifications?limit=1", nil, jane, "fr")
+		decode(t, rec, &page)
+		if len(page.Notifications) != 1 || page.Notifications[0].Title != "Vous avez reçu 20.00" {
+			t.Fatalf("fr: got body %s", rec.Body)
+		}
+
+		var count unreadCountResp
+		decode(t, s.do(http.MethodGet, "/api/notifications/unread-count", nil, jane), &count)
+		if count.Unread != 3 {
+			t.Fatalf("unread: got %d, want 3", count.Unread)
+		}
+
+		var read notificationResp
+		rec = s.do(http.MethodPost, "/api/notifications/"+newest.ID.String()+"/read", nil, jane)
+		decode(t, rec, &read)
+		if rec.Code != http.StatusOK || read.Notification.ReadAt == nil || read.Notification.ID != newest.ID {
+			t.Fatalf("mark read: got status %d, body %s", rec.Code, rec.Body)
+		}
+		// john can't read jane's notifications
+		problem(t, s.do(http.MethodPost, "/api/notifications/"+newest.ID.String()+"/read", nil, john), http.StatusNotFound, helper.CodeNotFound)
+		problem(t, s.do(http.MethodPost, "/api/notifications/"+uuid.NewString()+"/read", nil, jane), http.StatusNotFound, helper.CodeNotFound)
+
+		rec = s.do(http.MethodGet, "/api/notifications?unread=true", nil, jane)
+		decode(t, rec, &page)
+		if len(page.Notifications) != 2 {
+			t.Fatalf("unread only: got body %s", rec.Body)
+		}
+		var all readAllResp
+		rec = s.do(http.MethodPost, "/api/notifications/read-all", nil, jane)
+		decode(t, rec, &all)
+		if rec.Code != http.StatusOK || all.Read != 2 {
+			t.Fatalf("read all: got status %d, body %s", rec.Code, rec.Body)
+		}
+		decode(t, s.do(http.MethodGet, "/api/notifications/unread-count", nil, jane), &count)
+		if count.Unread != 0 {
+			t.Fatalf("unread after read all: got %d", count.Unread)
+		}
+	})
+}
+
+func TestNotificationPreferences(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s *testServer) {
+		ctx := context.Background()
+		s.signup("john@mail.com", "password123")
+		jane := s.signup("jane@mail.com", "password123").Tokens.Token
+
+		var preferences preferencesResp
+		rec := s.do(http.MethodGet, "/api/notifications/preferences", nil, jane)
+		decode(t, rec, &preferences)
+		if rec.Code != http.StatusOK || len(preferences.Preferences) != len(models.NotificationCategories) {
+			t.Fatalf("preferences: got status %d, body %s", rec.Code, rec.Body)
+		}
+
+		var saved preferenceResp
+		rec = s.do(http.MethodPut, "/api/notifications/preferences/transactions", gin.H{"in_app": false}, jane)
+		decode(t, rec, &saved)
+		if rec.Code != http.StatusOK || saved.Preference.InApp || !saved.Preference.Email || !saved.Preference.SMS {
+			t.Fatalf("update: got status %d, body %s", rec.Code, rec.Body)
+		}
+		problem(t, s.do(http.MethodPut, "/api/notifications/preferences/weather", gin.H{"in_app": false}, jane), http.StatusNotFound, helper.CodeNotFound)
+		problem(t, s.do(http.MethodPut, "/api/notifications/preferences/security", gin.H{"in_app": false, "email": false}, jane), http.StatusBadRequest, helper.CodeInvalidRequest)
+
+		// receipts no longer reach jane's inbox
+		sender, _ := s.accounts.GetByEmail(ctx, "john@mail.com")
+		recipient, _ := s.accounts.GetByEmail(ctx, "jane@mail.com")
+		err := s.ledger.Transfer(ctx,
+			&models.LedgerEntry{AccountID: sender.ID, Type: models.Debit, Amount: 10, Reason: "lunch", Actor: sender.Email},
+			&models.LedgerEntry{AccountID: recipient.ID, Type: models.Credit, Amount: 10, Reason: "lunch", Actor: sender.Email})
+		if err != nil {
+			t.Fatalf("transfer: %v", err)
+		}
+		s.deliverNotifications(ctx)
+
+		var page notificationsResp
+		decode(t, s.do(http.MethodGet, "/api/notifications", nil, jane), &page)
+		if len(page.Notifications) != 1 || page.Notifications[0].Event != models.EventAccountCreated {
+			t.Fatalf("got inbox %+v", page.Notifications)
+		}
+	})
+}
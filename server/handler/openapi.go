@@ -0,0 +1,464 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Cprime50/Gopay/helper"
+	"github.com/Cprime50/Gopay/middleware"
+	"github.com/Cprime50/Gopay/openapi"
+	"github.com/gin-gonic/gin"
+)
+
+// Security schemes used by the routes
+const (
+	bearerAuth   = "bearerAuth"
+	metricsToken = "metricsToken"
+)
+
+// redocPage renders the spec with Redoc, served at /docs outside production
+const redocPage = `<!DOCTYPE html>
+<html>
+  <head>
+    <title>Gopay API</title>
+    <meta charset="utf-8"/>
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+  </head>
+  <body>
+    <redoc spec-url="/openapi.json"></redoc>
+    <script src="https://cdn.jsdelivr.net/npm/redoc@2/bundles/redoc.standalone.js"></script>
+  </body>
+</html>
+`
+
+// rateLimited describes a route's rate limit policy
+func rateLimited(policy middleware.RateLimitPolicy) string {
+	window := strings.TrimSuffix(strings.TrimSuffix(policy.Window.String(), "0s"), "0m")
+	return fmt.Sprintf("Rate limited to %d requests per %s, see the RateLimit headers.", policy.Limit, window)
+}
+
+// routeDocs describes every route SetupRoutes registers, the route
+// coverage test fails if one is missing. Request and response schemas
+// come from the types the handlers bind and render
+func (h *Handler) routeDocs() []openapi.Route {
+	routes := []openapi.Route{
+		{
+			Method: http.MethodGet, Path: "/", Tag: "meta",
+			Summary:      "Welcome message",
+			ResponseType: openapi.Text,
+		},
+		{
+			Method: http.MethodGet, Path: "/openapi.json", Tag: "meta",
+			Summary:  "This OpenAPI document",
+			Response: map[string]any{},
+		},
+		{
+			Method: http.MethodGet, Path: "/healthz", Tag: "operations",
+			Summary:     "Liveness probe",
+			Description: "Reports the process is alive, it never touches dependencies.",
+			Response:    healthResp{},
+		},
+		{
+			Method: http.MethodGet, Path: "/readyz", Tag: "operations",
+			Summary:     "Readiness probe",
+			Description: "Checks every dependency, 503 with the failing checks when one is down or the server is shutting down.",
+			Response:    readinessResp{},
+			Errors:      []int{http.StatusServiceUnavailable},
+		},
+		{
+			Method: http.MethodGet, Path: "/metrics", Tag: "operations",
+			Summary:      "Prometheus metrics",
+			Description:  "Only reachable from private networks, or with the metrics token when one is configured. Anyone else gets a 404.",
+			Security:     metricsToken,
+			ResponseType: openapi.Text,
+			Errors:       []int{http.StatusNotFound},
+		},
+		{
+			Method: http.MethodPost, Path: "/api/register", Tag: "auth",
+			Summary:     "Create an account",
+			Description: "The locale defaults to the one negotiated from Accept-Language. " + rateLimited(registerRateLimit),
+			Request:     signupReq{},
+			Status:      http.StatusCreated,
+			Response:    signupResp{},
+			Errors:      []int{http.StatusBadRequest, http.StatusConflict, http.StatusTooManyRequests},
+		},
+		{
+			Method: http.MethodPost, Path: "/api/login", Tag: "auth",
+			Summary:     "Sign in",
+			Description: "Accounts with credentials_expired set must change their password before anything else. " + rateLimited(loginRateLimit),
+			Request:     signinReq{},
+			Response:    signinResp{},
+			Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound, http.StatusTooManyRequests},
+		},
+		{
+			Method: http.MethodPost, Path: "/api/tokens", Tag: "auth",
+			Summary:     "Refresh tokens",
+			Description: "The refresh token is revoked and a new pair issued, so each refresh token works only once. " + rateLimited(refreshRateLimit),
+			Request:     tokensReq{},
+			Response:    tokensResp{},
+			Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusTooManyRequests},
+		},
+		{
+			Method: http.MethodGet, Path: "/api/me", Tag: "account",
+			Summary:     "Get the signed in account",
+			Description: rateLimited(readRateLimit),
+			Security:    bearerAuth,
+			Response:    accountResp{},
+			Errors:      []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusTooManyRequests},
+		},
+		{
+			Method: http.MethodPut, Path: "/api/me/locale", Tag: "account",
+			Summary:     "Set the preferred language",
+			Description: "Used for emails, notifications and responses sent without Accept-Language. Returns a new token pair, earlier tokens keep the old language until refreshed. " + rateLimited(readRateLimit),
+			Security:    bearerAuth,
+			Request:     localeReq{},
+			Response:    accountResp{},
+			Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusTooManyRequests},
+		},
+		{
+			Method: http.MethodPut, Path: "/api/me/phone", Tag: "account",
+			Summary:     "Set the phone number",
+			Description: "Texts a 6 digit code to an E.164 number, which replaces the account's phone number once verified with POST /api/me/phone/verify. Until then the current number stays verified and keeps getting alerts. A new code can be requested once a minute, texts count against a daily allowance. " + rateLimited(otpRateLimit),
+			Security:    bearerAuth,
+			Request:     phoneReq{},
+			Status:      http.StatusAccepted,
+			Response:    accountResp{},
+			Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusTooManyRequests},
+		},
+		{
+			Method: http.MethodPost, Path: "/api/me/phone/verify", Tag: "account",
+			Summary:     "Verify the phone number",
+			Description: "Checks the code texted by PUT /api/me/phone. A code expires after 10 minutes or 5 wrong guesses. " + rateLimited(otpRateLimit),
+			Security:    bearerAuth,
+			Request:     verifyPhoneReq{},
+			Response:    accountResp{},
+			Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusTooManyRequests},
+		},
+		{
+			Method: http.MethodPut, Path: "/api/me/sms-alerts", Tag: "account",
+			Summary:     "Turn SMS alerts on or off",
+			Description: "Texts the verified phone number about the categories whose sms channel is on in the notification preferences. Alerts over the daily allowance are dropped. " + rateLimited(readRateLimit),
+			Security:    bearerAuth,
+			Request:     smsAlertsReq{},
+			Response:    accountResp{},
+			Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusTooManyRequests},
+		},
+		{
+			Method: http.MethodGet, Path: "/api/accounts/lookup", Tag: "account",
+			Summary:     "Look up an account number",
+			Description: "Returns the holder's name masked to the first two letters of each name, eg Jo** Do*, for the account_number query parameter. Email, balance and ID are never shown. " + rateLimited(lookupRateLimit) + fmt.Sprintf(" Each IP is also limited to %d, however many accounts it signs in as.", lookupIPRateLimit.Limit),
+			Security:    bearerAuth,
+			Response:    lookupResp{},
+			Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusTooManyRequests},
+		},
+		{
+			Method: http.MethodGet, Path: "/api/stream", Tag: "account",
+			Summary: "Stream live updates",
+			Description: "Server sent events, starting with a ready event carrying the balance. Then balance, transfer.sent, transfer.received and security.password_changed events " +
+				"with JSON data, and a comment every " + h.Heartbeat.String() + " when idle. The stream ends when the password changes or, with an expired event, when the token expires. " +
+				"Reconnect with the Last-Event-ID header to be sent the events missed, ready has resync set when some can no longer be sent. " +
+				"The token is only read from the Authorization header, which the browser's native EventSource can't set, so use a polyfill that can, such as @microsoft/fetch-event-source. " +
+				"Transfers are identified by reference, one may be sent twice. " + rateLimited(streamRateLimit),
+			Security:     bearerAuth,
+			ResponseType: "text/event-stream",
+			Errors:       []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusTooManyRequests},
+		},
+		{
+			Method: http.MethodPut, Path: "/api/me/password", Tag: "account",
+			Summary:     "Change the password",
+			Description: "Every session is revoked and a new token pair returned. Accounts that must change their password can call it. " + rateLimited(passwordRateLimit),
+			Security:    bearerAuth,
+			Request:     changePasswordReq{},
+			Response:    tokensResp{},
+			Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusTooManyRequests},
+		},
+		{
+			Method: http.MethodPost, Path: "/api/schedules", Tag: "schedules",
+			Summary:     "Schedule a transfer",
+			Description: "Runs once at start_at, or repeats daily, weekly, monthly or on a 5 field cron expression until end_at, descriptors such as @every aren't accepted. The sender and recipient accounts must be active. Runs the sender can't afford are skipped and the sender notified, ones where either account has been deactivated pause the schedule. A transfer to a beneficiary can't be due before its available_at, and while a cool off is configured only beneficiaries can be paid. " + rateLimited(scheduleRateLimit),
+			Security:    bearerAuth,
+			Request:     scheduleReq{},
+			Status:      http.StatusCreated,
+			Response:    scheduleResp{},
+			Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusTooManyRequests},
+		},
+		{
+			Method: http.MethodGet, Path: "/api/schedules", Tag: "schedules",
+			Summary:     "List scheduled transfers",
+			Description: "Newest first, cancelled and completed ones included. " + rateLimited(scheduleRateLimit),
+			Security:    bearerAuth,
+			Response:    schedulesResp{},
+			Errors:      []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusTooManyRequests},
+		},
+		{
+			Method: http.MethodGet, Path: "/api/schedules/:id", Tag: "schedules",
+			Summary:     "Get a scheduled transfer",
+			Description: rateLimited(scheduleRateLimit),
+			Security:    bearerAuth,
+			Response:    scheduleResp{},
+			Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusTooManyRequests},
+		},
+		{
+			Method: http.MethodPatch, Path: "/api/schedules/:id", Tag: "schedules",
+			Summary:     "Edit a scheduled transfer",
+			Description: "Only active and paused schedules can be edited. Changing when it runs restarts it from start_at. " + rateLimited(scheduleRateLimit),
+			Security:    bearerAuth,
+			Request:     scheduleUpdateReq{},
+			Response:    scheduleResp{},
+			Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusTooManyRequests},
+		},
+		{
+			Method: http.MethodPost, Path: "/api/schedules/:id/pause", Tag: "schedules",
+			Summary:     "Pause a scheduled transfer",
+			Description: rateLimited(scheduleRateLimit),
+			Security:    bearerAuth,
+			Response:    scheduleResp{},
+			Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusTooManyRequests},
+		},
+		{
+			Method: http.MethodPost, Path: "/api/schedules/:id/resume", Tag: "schedules",
+			Summary:     "Resume a paused scheduled transfer",
+			Description: "Runs missed while it was paused are skipped, not made up. The sender and recipient accounts must both be active. " + rateLimited(scheduleRateLimit),
+			Security:    bearerAuth,
+			Response:    scheduleResp{},
+			Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusTooManyRequests},
+		},
+		{
+			Method: http.MethodDelete, Path: "/api/schedules/:id", Tag: "schedules",
+			Summary:     "Cancel a scheduled transfer",
+			Description: "The schedule is kept, with status cancelled. " + rateLimited(scheduleRateLimit),
+			Security:    bearerAuth,
+			Response:    scheduleResp{},
+			Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusTooManyRequests},
+		},
+		{
+			Method: http.MethodPost, Path: "/api/webhooks", Tag: "webhooks",
+			Summary: "Register a webhook",
+			Description: "Events of the listed types are posted to the URL as JSON, signed in the Gopay-Signature header as t=<unix time>,v1=<hex HMAC-SHA256 of \"<unix time>.<body>\" keyed by the secret>. " +
+				"A transfer.completed is posted to both sides, each given only its direction (sent or received), the amount, its own entry_id and the other side's masked counterparty_account_number. " +
+				"The secret is only returned here. Failed deliveries are retried with backoff, endpoints that keep failing are disabled. " + rateLimited(webhookRateLimit),
+			Security: bearerAuth,
+			Request:  webhookReq{},
+			Status:   http.StatusCreated,
+			Response: webhookCreatedResp{},
+			Errors:   []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusTooManyRequests},
+		},
+		{
+			Method: http.MethodGet, Path: "/api/webhooks", Tag: "webhooks",
+			Summary:     "List webhooks",
+			Description: rateLimited(webhookRateLimit),
+			Security:    bearerAuth,
+			Response:    webhooksResp{},
+			Errors:      []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusTooManyRequests},
+		},
+		{
+			Method: http.MethodGet, Path: "/api/webhooks/:id", Tag: "webhooks",
+			Summary:     "Get a webhook",
+			Description: rateLimited(webhookRateLimit),
+			Security:    bearerAuth,
+			Response:    webhookResp{},
+			Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusTooManyRequests},
+		},
+		{
+			Method: http.MethodPatch, Path: "/api/webhooks/:id", Tag: "webhooks",
+			Summary:     "Edit a webhook",
+			Description: "Set enabled to re-enable a disabled webhook, which resets its failures. " + rateLimited(webhookRateLimit),
+			Security:    bearerAuth,
+			Request:     webhookUpdateReq{},
+			Response:    webhookResp{},
+			Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusTooManyRequests},
+		},
+		{
+			Method: http.MethodDelete, Path: "/api/webhooks/:id", Tag: "webhooks",
+			Summary:     "Delete a webhook",
+			Description: "Its delivery log is deleted with it. " + rateLimited(webhookRateLimit),
+			Security:    bearerAuth,
+			Status:      http.StatusNoContent,
+			Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusTooManyRequests},
+		},
+		{
+			Method: http.MethodGet, Path: "/api/webhooks/:id/deliveries", Tag: "webhooks",
+			Summary:     "List a webhook's deliveries",
+			Description: "Newest first, the limit query parameter takes up to 100, 50 by default. " + rateLimited(webhookRateLimit),
+			Security:    bearerAuth,
+			Response:    deliveriesResp{},
+			Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusTooManyRequests},
+		},
+		{
+			Method: http.MethodGet, Path: "/api/webhooks/:id/deliveries/:delivery_id", Tag: "webhooks",
+			Summary:     "Get a delivery",
+			Description: "With the body posted and every attempt at it. " + rateLimited(webhookRateLimit),
+			Security:    bearerAuth,
+			Response:    deliveryResp{},
+			Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusTooManyRequests},
+		},
+		{
+			Method: http.MethodPost, Path: "/api/webhooks/:id/deliveries/:delivery_id/redeliver", Tag: "webhooks",
+			Summary:     "Redeliver",
+			Description: "Sends a delivery that succeeded or ran out of attempts again, with fresh attempts. The webhook must be enabled. " + rateLimited(webhookRateLimit),
+			Security:    bearerAuth,
+			Status:      http.StatusAccepted,
+			Response:    redeliveryResp{},
+			Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusTooManyRequests},
+		},
+		{
+			Method: http.MethodPost, Path: "/api/beneficiaries", Tag: "beneficiaries",
+			Summary: "Save a beneficiary",
+			Description: "The holder's name is looked up from the account number. Scheduled transfers to it can't be due before its available_at, when the cool off after adding it ends. " +
+				rateLimited(beneficiaryRateLimit) + fmt.Sprintf(" It also counts against the account lookup limits of %d an hour per account and %d per IP.", lookupRateLimit.Limit, lookupIPRateLimit.Limit),
+			Security: bearerAuth,
+			Request:  beneficiaryReq{},
+			Status:   http.StatusCreated,
+			Response: beneficiaryResp{},
+			Errors:   []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusConflict, http.StatusTooManyRequests},
+		},
+		{
+			Method: http.MethodGet, Path: "/api/beneficiaries", Tag: "beneficiaries",
+			Summary:     "List beneficiaries",
+			Description: "Favourites first, then the most recently sent money, those never used last. " + rateLimited(beneficiaryRateLimit),
+			Security:    bearerAuth,
+			Response:    beneficiariesResp{},
+			Errors:      []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusTooManyRequests},
+		},
+		{
+			Method: http.MethodGet, Path: "/api/beneficiaries/:id", Tag: "beneficiaries",
+			Summary:     "Get a beneficiary",
+			Description: rateLimited(beneficiaryRateLimit),
+			Security:    bearerAuth,
+			Response:    beneficiaryResp{},
+			Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusTooManyRequests},
+		},
+		{
+			Method: http.MethodPatch, Path: "/api/beneficiaries/:id", Tag: "beneficiaries",
+			Summary:     "Edit a beneficiary",
+			Description: "Only the nickname and favourite can change, save a new beneficiary for another account number. " + rateLimited(beneficiaryRateLimit),
+			Security:    bearerAuth,
+			Request:     beneficiaryUpdateReq{},
+			Response:    beneficiaryResp{},
+			Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusTooManyRequests},
+		},
+		{
+			Method: http.MethodDelete, Path: "/api/beneficiaries/:id", Tag: "beneficiaries",
+			Summary:     "Delete a beneficiary",
+			Description: "Scheduled transfers to its account number are kept, but while a cool off is configured they pause at their next run. " + rateLimited(beneficiaryRateLimit),
+			Security:    bearerAuth,
+			Status:      http.StatusNoContent,
+			Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusTooManyRequests},
+		},
+		{
+			Method: http.MethodGet, Path: "/api/notifications", Tag: "notifications",
+			Summary: "List notifications",
+			Description: "The in app inbox, newest first, with title and body in the request's language. The limit query parameter takes up to 100, 20 by default, " +
+				"pass next_cursor as the cursor query parameter for the next page and unread=true for unread notifications only. " + rateLimited(notificationRateLimit),
+			Security: bearerAuth,
+			Response: notificationsResp{},
+			Errors:   []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusTooManyRequests},
+		},
+		{
+			Method: http.MethodGet, Path: "/api/notifications/unread-count", Tag: "notifications",
+			Summary:     "Count unread notifications",
+			Description: rateLimited(notificationRateLimit),
+			Security:    bearerAuth,
+			Response:    unreadCountResp{},
+			Errors:      []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusTooManyRequests},
+		},
+		{
+			Method: http.MethodPost, Path: "/api/notifications/:id/read", Tag: "notifications",
+			Summary:     "Mark a notification read",
+			Description: "Marking a read notification again keeps when it was first read. " + rateLimited(notificationRateLimit),
+			Security:    bearerAuth,
+			Response:    notificationResp{},
+			Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusTooManyRequests},
+		},
+		{
+			Method: http.MethodPost, Path: "/api/notifications/read-all", Tag: "notifications",
+			Summary:     "Mark every notification read",
+			Description: rateLimited(notificationRateLimit),
+			Security:    bearerAuth,
+			Response:    readAllResp{},
+			Errors:      []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusTooManyRequests},
+		},
+		{
+			Method: http.MethodGet, Path: "/api/notifications/preferences", Tag: "notifications",
+			Summary: "List notification preferences",
+			Description: "The channels of the security, transactions and marketing categories. Texts also need SMS alerts turned on. " +
+				rateLimited(notificationRateLimit),
+			Security: bearerAuth,
+			Response: preferencesResp{},
+			Errors:   []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusTooManyRequests},
+		},
+		{
+			Method: http.MethodPut, Path: "/api/notifications/preferences/:category", Tag: "notifications",
+			Summary:     "Choose a category's channels",
+			Description: "Fields left out are kept. Security notifications can't be turned off, they keep the app or email. " + rateLimited(notificationRateLimit),
+			Security:    bearerAuth,
+			Request:     preferenceReq{},
+			Response:    preferenceResp{},
+			Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusTooManyRequests},
+		},
+		{
+			Method: http.MethodGet, Path: "/api/admin/accounts", Tag: "admin",
+			Summary:     "List every account",
+			Description: rateLimited(adminRateLimit),
+			Security:    bearerAuth,
+			Response:    accountsResp{},
+			Errors:      []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusTooManyRequests, http.StatusServiceUnavailable},
+		},
+	}
+
+	if h.ServeDocs {
+		routes = append(routes, openapi.Route{
+			Method: http.MethodGet, Path: "/docs", Tag: "meta",
+			Summary:      "Browsable API documentation",
+			Description:  "Not served in production.",
+			ResponseType: "text/html",
+		})
+	}
+	return routes
+}
+
+// newOpenAPI builds the API's OpenAPI document
+func (h *Handler) newOpenAPI() (*openapi.Document, error) {
+	doc, err := openapi.New(openapi.Info{
+		Title:   "Gopay API",
+		Version: "1.0.0",
+		Description: "Errors are application/problem+json, branch on their code rather than the message. " +
+			"Messages follow Accept-Language, English and French are supported.",
+	}, h.routeDocs(), helper.Problem{}, map[string]*openapi.SecurityScheme{
+		bearerAuth: {
+			Type: "http", Scheme: "bearer", BearerFormat: "JWT",
+			Description: "The id token returned on signup, signin and refresh.",
+		},
+		metricsToken: {
+			Type: "http", Scheme: "bearer",
+			Description: "The configured metrics token.",
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// list the whole code catalogue on the problem schema
+	problem, ok := doc.Components.Schemas["Problem"]
+	if !ok {
+		return nil, fmt.Errorf("openapi: no Problem schema")
+	}
+	for _, code := range helper.Codes {
+		problem.Properties["code"].Enum = append(problem.Properties["code"].Enum, code)
+	}
+	if h.BaseURL != "" {
+		doc.Servers = []openapi.Server{{URL: h.BaseURL}}
+	}
+	return doc, nil
+}
+
+// OpenAPI serves the OpenAPI document
+func (h *Handler) OpenAPI(c *gin.Context) {
+	c.JSON(http.StatusOK, h.spec)
+}
+
+// Docs serves Redoc pointed at the OpenAPI document
+func (h *Handler) Docs(c *gin.Context) {
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(redocPage))
+}
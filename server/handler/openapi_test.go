@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Cprime50/Gopay/config"
+	"github.com/Cprime50/Gopay/openapi"
+)
+
+// every registered route must be in the spec and every spec entry registered
+func TestOpenAPICoversEveryRoute(t *testing.T) {
+	for _, env := range []string{"test", "production"} {
+		t.Run(env, func(t *testing.T) {
+			s := newTestServer(t, backends[0], func(cfg *config.Config) { cfg.Env = env })
+
+			registered := make(map[string]bool)
+			for _, route := range s.router.Routes() {
+				registered[route.Method+" "+openapi.OpenAPIPath(route.Path)] = true
+				if s.handler.spec.Operation(route.Method, route.Path) == nil {
+					t.Errorf("%s %s has no OpenAPI entry, describe it in routeDocs", route.Method, route.Path)
+				}
+			}
+			for path, item := range s.handler.spec.Paths {
+				for method := range *item {
+					if !registered[strings.ToUpper(method)+" "+path] {
+						t.Errorf("%s %s is in the OpenAPI document but not registered", strings.ToUpper(method), path)
+					}
+				}
+			}
+
+			docs := s.do(http.MethodGet, "/docs", nil, "")
+			if want := env != "production"; (docs.Code == http.StatusOK) != want {
+				t.Errorf("/docs got status %d in %s", docs.Code, env)
+			}
+		})
+	}
+}
+
+func TestOpenAPIDocument(t *testing.T) {
+	s := newTestServer(t, backends[0])
+
+	rec := s.do(http.MethodGet, "/openapi.json", nil, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d, body %s", rec.Code, rec.Body)
+	}
+	var doc map[string]any
+	decode(t, rec, &doc)
+	if doc["openapi"] != openapi.Version {
+		t.Errorf("got openapi version %v", doc["openapi"])
+	}
+
+	// every reference must resolve
+	schemas := doc["components"].(map[string]any)["schemas"].(map[string]any)
+	var walk func(v any)
+	walk = func(v any) {
+		switch v := v.(type) {
+		case map[string]any:
+			if ref, ok := v["$ref"].(string); ok {
+				if _, ok := schemas[strings.TrimPrefix(ref, "#/components/schemas/")]; !ok {
+					t.Errorf("unresolved reference %s", ref)
+				}
+			}
+			for _, child := range v {
+				walk(child)
+			}
+		case []any:
+			for _, child := range v {
+				walk(child)
+			}
+		}
+	}
+	walk(doc)
+
+	// the signup body is generated from signupReq, binding tags included
+	var signup openapi.Schema
+	raw, _ := json.Marshal(schemas["SignupReq"])
+	if err := json.Unmarshal(raw, &signup); err != nil {
+		t.Fatalf("decoding SignupReq: %v", err)
+	}
+	for _, field := range []string{"first_name", "last_name", "email", "password", "confirm_password"} {
+		if !slices.Contains(signup.Required, field) {
+			t.Errorf("SignupReq: %s should be required, got %v", field, signup.Required)
+		}
+	}
+	if slices.Contains(signup.Required, "locale") || len(signup.Properties["locale"].Enum) != 2 {
+		t.Errorf("SignupReq: unexpected locale %+v", signup.Properties["locale"])
+	}
+	if signup.Properties["email"].Format != "email" || *signup.Properties["password"].MinLength != 8 {
+		t.Errorf("SignupReq: missing constraints %+v %+v", signup.Properties["email"], signup.Properties["password"])
+	}
+
+	me := s.handler.spec.Operation(http.MethodGet, "/api/me")
+	if len(me.Security) != 1 || me.Responses["401"] == nil || me.Responses["401"].Content[openapi.ProblemJSON] == nil {
+		t.Errorf("GET /api/me: unexpected operation %+v", me)
+	}
+}
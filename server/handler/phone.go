@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/Cprime50/Gopay/helper"
+	"github.com/Cprime50/Gopay/i18n"
+	"github.com/Cprime50/Gopay/middleware"
+	models "github.com/Cprime50/Gopay/models/account"
+	"github.com/gin-gonic/gin"
+)
+
+type phoneReq struct {
+	// Phone is an E.164 number, eg +2348012345678
+	Phone string `json:"phone" binding:"required,max=16"`
+}
+
+type verifyPhoneReq struct {
+	Code string `json:"code" binding:"required,len=6,numeric"`
+}
+
+type smsAlertsReq struct {
+	Enabled *bool `json:"enabled" binding:"required"`
+}
+
+// SetPhone texts a code to the phone number the signed in account wants
+// to use, it replaces the account's number once verified
+func (h *Handler) SetPhone(c *gin.Context) {
+	var input phoneReq
+	if err := c.ShouldBindJSON(&input); err != nil {
+		middleware.Abort(c, helper.NewBindError(err))
+		return
+	}
+
+	value, _ := c.Get("account")
+	ctx := c.Request.Context()
+
+	account, err := h.SMSService.SetPhone(ctx, value.(*models.Account).ID, input.Phone)
+	if err != nil {
+		middleware.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, accountResp{
+		Message: i18n.T(i18n.FromContext(ctx), "otp_sent", map[string]string{"phone": input.Phone}),
+		Account: account,
+	})
+}
+
+// VerifyPhone verifies the signed in account's phone number with the
+// code texted to it
+func (h *Handler) VerifyPhone(c *gin.Context) {
+	var input verifyPhoneReq
+	if err := c.ShouldBindJSON(&input); err != nil {
+		middleware.Abort(c, helper.NewBindError(err))
+		return
+	}
+
+	value, _ := c.Get("account")
+	ctx := c.Request.Context()
+
+	account, err := h.SMSService.VerifyPhone(ctx, value.(*models.Account).ID, input.Code)
+	if err != nil {
+		middleware.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, accountResp{
+		Message: i18n.T(i18n.FromContext(ctx), "phone_verified", nil),
+		Account: account,
+	})
+}
+
+// SetSMSAlerts turns the signed in account's debit and credit texts on or off
+func (h *Handler) SetSMSAlerts(c *gin.Context) {
+	var input smsAlertsReq
+	if err := c.ShouldBindJSON(&input); err != nil {
+		middleware.Abort(c, helper.NewBindError(err))
+		return
+	}
+
+	value, _ := c.Get("account")
+	ctx := c.Request.Context()
+
+	account, err := h.SMSService.SetAlerts(ctx, value.(*models.Account).ID, *input.Enabled)
+	if err != nil {
+		middleware.Abort(c, err)
+		return
+	}
+
+	message := "sms_alerts_off"
+	if account.SMSAlerts {
+		message = "sms_alerts_on"
+	}
+	c.JSON(http.StatusOK, accountResp{
+		Message: i18n.T(i18n.FromContext(ctx), message, nil),
+		Account: account,
+	})
+}
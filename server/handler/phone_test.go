@@ -0,0 +1,97 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/Cprime50/Gopay/helper"
+	models "github.com/Cprime50/Gopay/models/account"
+	"github.com/Cprime50/Gopay/service"
+	"github.com/gin-gonic/gin"
+)
+
+var otpPattern = regexp.MustCompile(`\b[0-9]{6}\b`)
+
+func TestPhoneVerificationAndAlerts(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s *testServer) {
+		ctx := context.Background()
+		john := s.signup("john@mail.com", "password123").Tokens.Token
+		s.signup("jane@mail.com", "password123")
+		phone := "+2348012345678"
+
+		problem(t, s.do(http.MethodPut, "/api/me/sms-alerts", gin.H{"enabled": true}, john), http.StatusBadRequest, helper.CodePhoneNotVerified)
+		problem(t, s.do(http.MethodPut, "/api/me/phone", gin.H{"phone": "08012345678"}, john), http.StatusBadRequest, helper.CodeValidationFailed)
+		problem(t, s.do(http.MethodPost, "/api/me/phone/verify", gin.H{"code": "123456"}, john), http.StatusBadRequest, helper.CodeInvalidOTP)
+
+		rec := s.do(http.MethodPut, "/api/me/phone", gin.H{"phone": phone}, john)
+		var resp accountResp
+		decode(t, rec, &resp)
+		// the number is only saved once verified
+		if rec.Code != http.StatusAccepted || resp.Account.Phone != nil || resp.Account.PhoneVerifiedAt != nil {
+			t.Fatalf("set phone: got status %d, body %s", rec.Code, rec.Body)
+		}
+		// a new code can't be requested straight away
+		problem(t, s.do(http.MethodPut, "/api/me/phone", gin.H{"phone": phone}, john), http.StatusTooManyRequests, helper.CodeRateLimited)
+
+		if ran, err := s.worker.RunOne(ctx, service.SMSJob.Queue); !ran || err != nil {
+			t.Fatalf("send otp: ran %v, %v", ran, err)
+		}
+		texts := s.texts.Messages()
+		if len(texts) != 1 || texts[0].To != phone {
+			t.Fatalf("got texts %+v, want a code sent to %s", texts, phone)
+		}
+		code := otpPattern.FindString(texts[0].Body)
+		wrong := "000000"
+		if code == wrong {
+			wrong = "111111"
+		}
+
+		problem(t, s.do(http.MethodPost, "/api/me/phone/verify", gin.H{"code": wrong}, john), http.StatusBadRequest, helper.CodeInvalidOTP)
+		rec = s.do(http.MethodPost, "/api/me/phone/verify", gin.H{"code": code}, john)
+		decode(t, rec, &resp)
+		if rec.Code != http.StatusOK || resp.Account.PhoneVerifiedAt == nil || resp.Account.Phone == nil || *resp.Account.Phone != phone {
+			t.Fatalf("verify: got status %d, body %s", rec.Code, rec.Body)
+		}
+		// codes only work once
+		problem(t, s.do(http.MethodPost, "/api/me/phone/verify", gin.H{"code": code}, john), http.StatusBadRequest, helper.CodeInvalidOTP)
+
+		rec = s.do(http.MethodPut, "/api/me/sms-alerts", gin.H{"enabled": true}, john)
+		decode(t, rec, &resp)
+		if rec.Code != http.StatusOK || !resp.Account.SMSAlerts {
+			t.Fatalf("alerts: got status %d, body %s", rec.Code, rec.Body)
+		}
+
+		// john pays jane, only john opted in to alerts
+		sender, _ := s.accounts.GetByEmail(ctx, "john@mail.com")
+		recipient, _ := s.accounts.GetByEmail(ctx, "jane@mail.com")
+		err := s.ledger.Transfer(ctx,
+			&models.LedgerEntry{AccountID: sender.ID, Type: models.Debit, Amount: 25, Reason: "lunch", Actor: sender.Email},
+			&models.LedgerEntry{AccountID: recipient.ID, Type: models.Credit, Amount: 25, Reason: "lunch", Actor: sender.Email})
+		if err != nil {
+			t.Fatalf("transfer: %v", err)
+		}
+		if _, err := s.relay.RelayPending(ctx); err != nil {
+			t.Fatalf("relay: %v", err)
+		}
+		if ran, err := s.worker.RunOne(ctx, service.SMSJob.Queue); !ran || err != nil {
+			t.Fatalf("send alert: ran %v, %v", ran, err)
+		}
+		if ran, _ := s.worker.RunOne(ctx, service.SMSJob.Queue); ran {
+			t.Fatal("jane was texted without opting in")
+		}
+		texts = s.texts.Messages()
+		if len(texts) != 2 || texts[1].To != phone || !strings.Contains(texts[1].Body, "Debit: 25.00") {
+			t.Fatalf("got texts %+v, want a debit alert", texts)
+		}
+
+		rec = s.do(http.MethodPut, "/api/me/sms-alerts", gin.H{"enabled": false}, john)
+		decode(t, rec, &resp)
+		if rec.Code != http.StatusOK || resp.Account.SMSAlerts {
+			t.Fatalf("alerts off: got status %d, body %s", rec.Code, rec.Body)
+		}
+		problem(t, s.do(http.MethodPut, "/api/me/sms-alerts", gin.H{}, john), http.StatusBadRequest, helper.CodeValidationFailed)
+	})
+}
@@ -5,10 +5,32 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/Cprime50/Gopay/helper"
+	"github.com/Cprime50/Gopay/metrics"
 	"github.com/Cprime50/Gopay/middleware"
 	"github.com/gin-gonic/gin"
 )
 
+// Rate limit policies applied to each route group.
+// Auth routes are kept strict and counted per IP to slow down
+// credential stuffing, reads are looser and counted per account
+var (
+	registerRateLimit     = middleware.RateLimitPolicy{Name: "register", Limit: 5, Window: time.Hour, Key: middleware.KeyByIP}
+	loginRateLimit        = middleware.RateLimitPolicy{Name: "login", Limit: 10, Window: 15 * time.Minute, Key: middleware.KeyByIP}
+	refreshRateLimit      = middleware.RateLimitPolicy{Name: "refresh", Limit: 30, Window: 15 * time.Minute, Key: middleware.KeyByIP}
+	otpRateLimit          = middleware.RateLimitPolicy{Name: "otp", Limit: 10, Window: 15 * time.Minute, Key: middleware.KeyByAccount}
+	passwordRateLimit     = middleware.RateLimitPolicy{Name: "password", Limit: 10, Window: 15 * time.Minute, Key: middleware.KeyByAccount}
+	readRateLimit         = middleware.RateLimitPolicy{Name: "read", Limit: 120, Window: time.Minute, Key: middleware.KeyByAccount}
+	scheduleRateLimit     = middleware.RateLimitPolicy{Name: "schedule", Limit: 30, Window: time.Minute, Key: middleware.KeyByAccount}
+	webhookRateLimit      = middleware.RateLimitPolicy{Name: "webhook", Limit: 60, Window: time.Minute, Key: middleware.KeyByAccount}
+	notificationRateLimit = middleware.RateLimitPolicy{Name: "notification", Limit: 120, Window: time.Minute, Key: middleware.KeyByAccount}
+	streamRateLimit       = middleware.RateLimitPolicy{Name: "stream", Limit: 30, Window: time.Minute, Key: middleware.KeyByAccount}
+	beneficiaryRateLimit  = middleware.RateLimitPolicy{Name: "beneficiary", Limit: 30, Window: time.Minute, Key: middleware.KeyByAccount}
+	lookupRateLimit       = middleware.RateLimitPolicy{Name: "lookup", Limit: 20, Window: time.Hour, Key: middleware.KeyByAccount}
+	lookupIPRateLimit     = middleware.RateLimitPolicy{Name: "lookup_ip", Limit: 30, Window: time.Hour, Key: middleware.KeyByIP}
+	adminRateLimit        = middleware.RateLimitPolicy{Name: "admin", Limit: 60, Window: time.Minute, Key: middleware.KeyByAccount}
+)
+
 func (h *Handler) SetupRoutes() {
 	// starting route
 	h.router.GET("/", func(c *gin.Context) {
@@ -16,25 +38,126 @@ func (h *Handler) SetupRoutes() {
 		c.String(http.StatusOK, "Welcome Gopay Server")
 	})
 
+	h.router.NoRoute(func(c *gin.Context) {
+		middleware.Abort(c, helper.NewNotFound("route", c.Request.URL.Path).WithCode(helper.CodeRouteNotFound))
+	})
+
+	// the API description, browsable outside production
+	h.router.GET("/openapi.json", h.OpenAPI)
+	if h.ServeDocs {
+		h.router.GET("/docs", h.Docs)
+	}
+
+	// liveness and readiness probes
+	h.router.GET("/healthz", h.Healthz)
+	h.router.GET("/readyz", h.Readyz)
+
+	// prometheus metrics, not publicly reachable
+	h.router.GET("/metrics", middleware.InternalOnly(h.MetricsToken), metrics.Handler())
+
 	// Create a group for base routes
 	baseRoutes := h.router.Group("/api")
 	{
-		baseRoutes.POST("/register", h.Signup)
-		baseRoutes.POST("/login", h.Signin)
+		baseRoutes.POST("/register", h.RateLimiter.RateLimit(registerRateLimit), h.Signup)
+		baseRoutes.POST("/login", h.RateLimiter.RateLimit(loginRateLimit), h.Signin)
+		baseRoutes.POST("/tokens", h.RateLimiter.RateLimit(refreshRateLimit), h.Tokens)
 	}
 
 	// Basic Authenticated routes
 	authRoutes := h.router.Group("/api")
-	authRoutes.Use(middleware.AuthUser())
+	authRoutes.Use(middleware.AuthUser(h.TokenService), middleware.PasswordChanged(), h.RateLimiter.RateLimit(readRateLimit))
 	{
 		authRoutes.GET("/me", h.Me)
+		authRoutes.PUT("/me/locale", h.SetLocale)
+		authRoutes.PUT("/me/sms-alerts", h.SetSMSAlerts)
+	}
+
+	// Phone numbers, codes are texted so requesting and guessing them is limited tightly
+	phoneRoutes := h.router.Group("/api/me")
+	phoneRoutes.Use(middleware.AuthUser(h.TokenService), middleware.PasswordChanged(), h.RateLimiter.RateLimit(otpRateLimit))
+	{
+		phoneRoutes.PUT("/phone", h.SetPhone)
+		phoneRoutes.POST("/phone/verify", h.VerifyPhone)
+	}
+
+	// Scheduled transfers, writes move money so are limited more tightly than reads
+	scheduleRoutes := h.router.Group("/api/schedules")
+	scheduleRoutes.Use(middleware.AuthUser(h.TokenService), middleware.PasswordChanged(), h.RateLimiter.RateLimit(scheduleRateLimit))
+	{
+		scheduleRoutes.POST("", h.CreateSchedule)
+		scheduleRoutes.GET("", h.GetSchedules)
+		scheduleRoutes.GET("/:id", h.GetSchedule)
+		scheduleRoutes.PATCH("/:id", h.UpdateSchedule)
+		scheduleRoutes.POST("/:id/pause", h.PauseSchedule)
+		scheduleRoutes.POST("/:id/resume", h.ResumeSchedule)
+		scheduleRoutes.DELETE("/:id", h.CancelSchedule)
+	}
+
+	// Webhook endpoints and their delivery log
+	webhookRoutes := h.router.Group("/api/webhooks")
+	webhookRoutes.Use(middleware.AuthUser(h.TokenService), middleware.PasswordChanged(), h.RateLimiter.RateLimit(webhookRateLimit))
+	{
+		webhookRoutes.POST("", h.CreateWebhook)
+		webhookRoutes.GET("", h.GetWebhooks)
+		webhookRoutes.GET("/:id", h.GetWebhook)
+		webhookRoutes.PATCH("/:id", h.UpdateWebhook)
+		webhookRoutes.DELETE("/:id", h.DeleteWebhook)
+		webhookRoutes.GET("/:id/deliveries", h.GetWebhookDeliveries)
+		webhookRoutes.GET("/:id/deliveries/:delivery_id", h.GetWebhookDelivery)
+		webhookRoutes.POST("/:id/deliveries/:delivery_id/redeliver", h.RedeliverWebhook)
+	}
+
+	// The in app inbox and the channels of each category of notification
+	notificationRoutes := h.router.Group("/api/notifications")
+	notificationRoutes.Use(middleware.AuthUser(h.TokenService), middleware.PasswordChanged(), h.RateLimiter.RateLimit(notificationRateLimit))
+	{
+		notificationRoutes.GET("", h.GetNotifications)
+		notificationRoutes.GET("/unread-count", h.GetUnreadCount)
+		notificationRoutes.POST("/:id/read", h.ReadNotification)
+		notificationRoutes.POST("/read-all", h.ReadAllNotifications)
+		notificationRoutes.GET("/preferences", h.GetNotificationPreferences)
+		notificationRoutes.PUT("/preferences/:category", h.UpdateNotificationPreference)
+	}
+
+	// Saved recipients. Adding one looks up the holder of an account number,
+	// so it shares the lookup budgets or it would be a way round them
+	beneficiaryRoutes := h.router.Group("/api/beneficiaries")
+	beneficiaryRoutes.Use(middleware.AuthUser(h.TokenService), middleware.PasswordChanged(), h.RateLimiter.RateLimit(beneficiaryRateLimit))
+	{
+		beneficiaryRoutes.POST("", h.RateLimiter.RateLimit(lookupRateLimit), h.RateLimiter.RateLimit(lookupIPRateLimit), h.CreateBeneficiary)
+		beneficiaryRoutes.GET("", h.GetBeneficiaries)
+		beneficiaryRoutes.GET("/:id", h.GetBeneficiary)
+		beneficiaryRoutes.PATCH("/:id", h.UpdateBeneficiary)
+		beneficiaryRoutes.DELETE("/:id", h.DeleteBeneficiary)
+	}
+
+	// Account number lookups, limited per caller so holders can't be enumerated,
+	// and per IP too so registering more accounts doesn't buy more lookups
+	accountRoutes := h.router.Group("/api/accounts")
+	accountRoutes.Use(middleware.AuthUser(h.TokenService), middleware.PasswordChanged(), h.RateLimiter.RateLimit(lookupRateLimit), h.RateLimiter.RateLimit(lookupIPRateLimit))
+	{
+		accountRoutes.GET("/lookup", h.LookupAccount)
+	}
+
+	// Live updates, each request is a long lived stream so opening them is limited
+	streamRoutes := h.router.Group("/api")
+	streamRoutes.Use(middleware.AuthUser(h.TokenService), middleware.PasswordChanged(), h.RateLimiter.RateLimit(streamRateLimit))
+	{
+		streamRoutes.GET("/stream", h.Stream)
+	}
+
+	// Changing the password is the one thing accounts that must change it can do
+	passwordRoutes := h.router.Group("/api")
+	passwordRoutes.Use(middleware.AuthUser(h.TokenService), h.RateLimiter.RateLimit(passwordRateLimit))
+	{
+		passwordRoutes.PUT("/me/password", h.ChangePassword)
 	}
 
 	// Admin routes
 	adminRoutes := h.router.Group("/api/admin")
-	adminRoutes.Use(TimeoutMiddleware(h.TimeoutDuration), middleware.AuthAdmin())
+	adminRoutes.Use(TimeoutMiddleware(h.TimeoutDuration), middleware.AuthAdmin(h.TokenService), middleware.PasswordChanged(), h.RateLimiter.RateLimit(adminRateLimit))
 	{
-
+		adminRoutes.GET("/accounts", h.GetAccounts)
 	}
 }
 
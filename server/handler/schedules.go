@@ -0,0 +1,165 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/Cprime50/Gopay/helper"
+	"github.com/Cprime50/Gopay/middleware"
+	models "github.com/Cprime50/Gopay/models/account"
+	"github.com/Cprime50/Gopay/service"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// scheduleReq creates a scheduled transfer. Cron takes a 5 field
+// expression, not a descriptor, and is only allowed with the cron frequency
+type scheduleReq struct {
+	ToAccountNumber int64      `json:"to_account_number" binding:"required,gt=0"`
+	Amount          float64    `json:"amount" binding:"required,gt=0"`
+	Note            string     `json:"note" binding:"max=140"`
+	Frequency       string     `json:"frequency" binding:"required,oneof=once daily weekly monthly cron"`
+	Cron            string     `json:"cron" binding:"max=100"`
+	StartAt         time.Time  `json:"start_at"`
+	EndAt           *time.Time `json:"end_at"`
+}
+
+// scheduleUpdateReq edits a scheduled transfer, fields left out are kept
+type scheduleUpdateReq struct {
+	ToAccountNumber *int64     `json:"to_account_number" binding:"omitempty,gt=0"`
+	Amount          *float64   `json:"amount" binding:"omitempty,gt=0"`
+	Note            *string    `json:"note" binding:"omitempty,max=140"`
+	Frequency       *string    `json:"frequency" binding:"omitempty,oneof=once daily weekly monthly cron"`
+	Cron            *string    `json:"cron" binding:"omitempty,max=100"`
+	StartAt         *time.Time `json:"start_at"`
+	EndAt           *time.Time `json:"end_at"`
+}
+
+// scheduleResp wraps one scheduled transfer
+type scheduleResp struct {
+	Schedule *models.ScheduledTransfer `json:"schedule"`
+}
+
+// schedulesResp lists the account's scheduled transfers
+type schedulesResp struct {
+	Schedules []*models.ScheduledTransfer `json:"schedules"`
+}
+
+// CreateSchedule schedules a transfer from the signed in account
+func (h *Handler) CreateSchedule(c *gin.Context) {
+	var input scheduleReq
+	if err := c.ShouldBindJSON(&input); err != nil {
+		middleware.Abort(c, helper.NewBindError(err))
+		return
+	}
+
+	value, _ := c.Get("account")
+	schedule := &models.ScheduledTransfer{
+		AccountID:       value.(*models.Account).ID,
+		ToAccountNumber: input.ToAccountNumber,
+		Amount:          input.Amount,
+		Note:            input.Note,
+		Frequency:       input.Frequency,
+		Cron:            input.Cron,
+		StartAt:         input.StartAt,
+		EndAt:           input.EndAt,
+	}
+	if err := h.ScheduleService.Create(c.Request.Context(), schedule); err != nil {
+		middleware.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, scheduleResp{Schedule: schedule})
+}
+
+// GetSchedules lists the signed in account's scheduled transfers
+func (h *Handler) GetSchedules(c *gin.Context) {
+	value, _ := c.Get("account")
+	schedules, err := h.ScheduleService.List(c.Request.Context(), value.(*models.Account).ID)
+	if err != nil {
+		middleware.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, schedulesResp{Schedules: schedules})
+}
+
+// GetSchedule returns one of the signed in account's scheduled transfers
+func (h *Handler) GetSchedule(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	value, _ := c.Get("account")
+	schedule, err := h.ScheduleService.Get(c.Request.Context(), value.(*models.Account).ID, id)
+	if err != nil {
+		middleware.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, scheduleResp{Schedule: schedule})
+}
+
+// UpdateSchedule edits an active or paused scheduled transfer
+func (h *Handler) UpdateSchedule(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+	var input scheduleUpdateReq
+	if err := c.ShouldBindJSON(&input); err != nil {
+		middleware.Abort(c, helper.NewBindError(err))
+		return
+	}
+
+	value, _ := c.Get("account")
+	schedule, err := h.ScheduleService.Update(c.Request.Context(), value.(*models.Account).ID, id, service.ScheduleUpdate{
+		ToAccountNumber: input.ToAccountNumber,
+		Amount:          input.Amount,
+		Note:            input.Note,
+		Frequency:       input.Frequency,
+		Cron:            input.Cron,
+		StartAt:         input.StartAt,
+		EndAt:           input.EndAt,
+	})
+	if err != nil {
+		middleware.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, scheduleResp{Schedule: schedule})
+}
+
+// PauseSchedule stops a scheduled transfer running until it's resumed
+func (h *Handler) PauseSchedule(c *gin.Context) {
+	h.changeSchedule(c, h.ScheduleService.Pause)
+}
+
+// ResumeSchedule restarts a paused scheduled transfer
+func (h *Handler) ResumeSchedule(c *gin.Context) {
+	h.changeSchedule(c, h.ScheduleService.Resume)
+}
+
+// CancelSchedule stops a scheduled transfer for good
+func (h *Handler) CancelSchedule(c *gin.Context) {
+	h.changeSchedule(c, h.ScheduleService.Cancel)
+}
+
+// changeSchedule applies change to the schedule in the path
+func (h *Handler) changeSchedule(c *gin.Context, change func(ctx context.Context, accountID uuid.UUID, id uuid.UUID) (*models.ScheduledTransfer, error)) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	value, _ := c.Get("account")
+	schedule, err := change(c.Request.Context(), value.(*models.Account).ID, id)
+	if err != nil {
+		middleware.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, scheduleResp{Schedule: schedule})
+}
@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/Cprime50/Gopay/helper"
+	models "github.com/Cprime50/Gopay/models/account"
+	"github.com/gin-gonic/gin"
+)
+
+func TestScheduledTransfers(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s *testServer) {
+		ctx := context.Background()
+		john := s.signup("john@mail.com", "password123").Tokens.Token
+		jane := s.signup("jane@mail.com", "password123").Tokens.Token
+		recipient, err := s.accounts.GetByEmail(ctx, "jane@mail.com")
+		if err != nil {
+			t.Fatalf("get recipient: %v", err)
+		}
+
+		schedule := gin.H{
+			"to_account_number": recipient.AccountNumber,
+			"amount":            100,
+			"note":              "rent",
+			"frequency":         "monthly",
+		}
+		// only active accounts can schedule transfers, or be sent them
+		problem(t, s.do(http.MethodPost, "/api/schedules", schedule, john), http.StatusBadRequest, helper.CodeInvalidRequest)
+		s.activate("john@mail.com")
+		problem(t, s.do(http.MethodPost, "/api/schedules", schedule, john), http.StatusBadRequest, helper.CodeValidationFailed)
+		s.activate("jane@mail.com")
+
+		rec := s.do(http.MethodPost, "/api/schedules", schedule, john)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("create: got status %d, body %s", rec.Code, rec.Body)
+		}
+		var created scheduleResp
+		decode(t, rec, &created)
+		id := created.Schedule.ID.String()
+		if created.Schedule.Status != models.ScheduleActive || created.Schedule.NextRunAt == nil {
+			t.Fatalf("create: got %+v", created.Schedule)
+		}
+
+		problem(t, s.do(http.MethodPost, "/api/schedules", gin.H{"to_account_number": recipient.AccountNumber, "amount": 1, "frequency": "yearly"}, john), http.StatusBadRequest, helper.CodeValidationFailed)
+		problem(t, s.do(http.MethodGet, "/api/schedules/not-a-uuid", nil, john), http.StatusBadRequest, helper.CodeValidationFailed)
+		problem(t, s.do(http.MethodGet, "/api/schedules/"+id, nil, jane), http.StatusNotFound, helper.CodeNotFound)
+		problem(t, s.do(http.MethodGet, "/api/schedules", nil, ""), http.StatusUnauthorized, helper.CodeUnauthenticated)
+
+		// it's due straight away, the worker makes the transfer
+		if ran, err := s.schedules.RunDue(ctx); err != nil || ran != 1 {
+			t.Fatalf("run due: ran %d, %v", ran, err)
+		}
+		if got, _ := s.accounts.GetByEmail(ctx, "jane@mail.com"); got.Balance != recipient.Balance+100 {
+			t.Fatalf("recipient balance: got %v, want %v", got.Balance, recipient.Balance+100)
+		}
+
+		rec = s.do(http.MethodPatch, "/api/schedules/"+id, gin.H{"amount": 50}, john)
+		var updated scheduleResp
+		if rec.Code != http.StatusOK {
+			t.Fatalf("update: got status %d, body %s", rec.Code, rec.Body)
+		}
+		decode(t, rec, &updated)
+		if updated.Schedule.Amount != 50 || updated.Schedule.Runs != 1 {
+			t.Fatalf("update: got %+v", updated.Schedule)
+		}
+
+		for _, step := range []struct {
+			method, path, status string
+		}{
+			{http.MethodPost, "/pause", models.SchedulePaused},
+			{http.MethodPost, "/resume", models.ScheduleActive},
+			{http.MethodDelete, "", models.ScheduleCancelled},
+		} {
+			rec := s.do(step.method, "/api/schedules/"+id+step.path, nil, john)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("%s %s: got status %d, body %s", step.method, step.path, rec.Code, rec.Body)
+			}
+			var resp scheduleResp
+			decode(t, rec, &resp)
+			if resp.Schedule.Status != step.status {
+				t.Fatalf("%s %s: got status %s, want %s", step.method, step.path, resp.Schedule.Status, step.status)
+			}
+		}
+		problem(t, s.do(http.MethodPost, "/api/schedules/"+id+"/resume", nil, john), http.StatusBadRequest, helper.CodeInvalidRequest)
+
+		rec = s.do(http.MethodGet, "/api/schedules", nil, john)
+		var list schedulesResp
+		decode(t, rec, &list)
+		if rec.Code != http.StatusOK || len(list.Schedules) != 1 || list.Schedules[0].Status != models.ScheduleCancelled {
+			t.Fatalf("list: got status %d, body %s", rec.Code, rec.Body)
+		}
+		rec = s.do(http.MethodGet, "/api/schedules", nil, jane)
+		decode(t, rec, &list)
+		if rec.Code != http.StatusOK || len(list.Schedules) != 0 {
+			t.Fatalf("list of another account: got status %d, body %s", rec.Code, rec.Body)
+		}
+	})
+}
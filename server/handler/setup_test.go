@@ -0,0 +1,307 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/Cprime50/Gopay/config"
+	"github.com/Cprime50/Gopay/db"
+	"github.com/Cprime50/Gopay/events"
+	"github.com/Cprime50/Gopay/middleware"
+	models "github.com/Cprime50/Gopay/models/account"
+	"github.com/Cprime50/Gopay/queue"
+	"github.com/Cprime50/Gopay/realtime"
+	"github.com/Cprime50/Gopay/service"
+	"github.com/Cprime50/Gopay/sms"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// repositories are the stores a test server runs on
+type repositories struct {
+	accounts      models.AccountRepository
+	roles         models.RoleRepository
+	ledger        models.LedgerRepository
+	schedules     models.ScheduleRepository
+	webhooks      models.WebhookRepository
+	outbox        models.OutboxRepository
+	notifications models.NotificationRepository
+	beneficiaries models.BeneficiaryRepository
+}
+
+// backend builds the repositories a test server uses
+type backend struct {
+	name string
+	new  func(t *testing.T) repositories
+}
+
+// backends lists every repository implementation the end to end tests run against
+var backends = []backend{
+	{name: "memory", new: memoryBackend},
+	{name: "sqlite", new: sqliteBackend},
+}
+
+func memoryBackend(t *testing.T) repositories {
+	accounts := models.NewMemoryAccountRepository()
+	return repositories{
+		accounts:      accounts,
+		roles:         models.NewMemoryRoleRepository(accounts),
+		ledger:        models.NewMemoryLedgerRepository(accounts),
+		schedules:     models.NewMemoryScheduleRepository(),
+		webhooks:      models.NewMemoryWebhookRepository(),
+		outbox:        models.NewMemoryOutboxRepository(accounts),
+		notifications: models.NewMemoryNotificationRepository(),
+		beneficiaries: models.NewMemoryBeneficiaryRepository(),
+	}
+}
+
+func sqliteBackend(t *testing.T) repositories {
+	gormDB, err := db.OpenSQLite(":memory:")
+	if err != nil {
+		t.Fatalf("opening sqlite: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := gormDB.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	if err := gormDB.AutoMigrate(&models.Role{}, &models.Account{}, &models.LedgerEntry{}, &models.ScheduledTransfer{}, &models.OutboxEvent{},
+		&models.WebhookEndpoint{}, &models.WebhookDelivery{}, &models.WebhookAttempt{}, &models.Notification{}, &models.NotificationPreference{},
+		&models.Beneficiary{}); err != nil {
+		t.Fatalf("migrating sqlite: %v", err)
+	}
+	roles := []models.Role{
+		{ID: models.AdminRoleID, Name: "admin", Description: "Administrator role"},
+		{ID: models.UserRoleID, Name: "user", Description: "user role"},
+	}
+	if err := gormDB.Create(&roles).Error; err != nil {
+		t.Fatalf("seeding roles: %v", err)
+	}
+	return repositories{
+		accounts:      models.NewAccountRepository(gormDB),
+		roles:         models.NewRoleRepository(gormDB),
+		ledger:        models.NewLedgerRepository(gormDB),
+		schedules:     models.NewScheduleRepository(gormDB),
+		webhooks:      models.NewWebhookRepository(gormDB),
+		outbox:        models.NewOutboxRepository(gormDB),
+		notifications: models.NewNotificationRepository(gormDB),
+		beneficiaries: models.NewBeneficiaryRepository(gormDB),
+	}
+}
+
+// testServer is the full HTTP API wired to local stand-ins,
+// miniredis for redis and the given backend for postgres
+type testServer struct {
+	t        *testing.T
+	router   *gin.Engine
+	handler  *Handler
+	cfg      *config.Config
+	redis    *miniredis.Miniredis
+	accounts models.AccountRepository
+	roles    models.RoleRepository
+	ledger   models.LedgerRepository
+	tokens   *service.TokenService
+	// schedules runs scheduled transfers on demand, the worker isn't started
+	schedules *service.ScheduleService
+	// relay publishes outbox events and worker runs jobs on demand, neither is started
+	relay  *events.Relay
+	worker *queue.Worker
+	// texts is the SMS provider texts are posted to
+	texts *sms.StandIn
+}
+
+// newTestServer starts a server on backend, opts can tweak the config first
+func newTestServer(t *testing.T, b backend, opts ...func(cfg *config.Config)) *testServer {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+
+	cfg := config.Default()
+	cfg.Env = "test"
+	keys := t.TempDir()
+	cfg.Token.PrivKeyFile = filepath.Join(keys, "private.pem")
+	cfg.Token.PubKeyFile = filepath.Join(keys, "public.pem")
+	cfg.Token.RefreshSecret = "test-refresh-secret"
+	// webhook receivers are httptest servers on loopback
+	cfg.Webhooks.AllowInsecure = true
+	// texts are posted by the http driver to a stand in provider
+	texts := sms.NewStandIn("test-sms-key")
+	smsProvider := httptest.NewServer(texts)
+	t.Cleanup(smsProvider.Close)
+	cfg.SMS.Driver, cfg.SMS.URL, cfg.SMS.APIKey = "http", smsProvider.URL, "test-sms-key"
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	repos := b.new(t)
+	tokenService := service.NewTokenService(models.NewTokenRepository(rdb), cfg.Token)
+	if err := tokenService.GenerateRSAKeys(); err != nil {
+		t.Fatalf("generating keys: %v", err)
+	}
+
+	scheduleService := service.NewScheduleService(repos.accounts, repos.schedules, repos.ledger, repos.beneficiaries, nil, cfg.Scheduler, cfg.Beneficiaries)
+
+	jobs := queue.New(rdb, cfg.Jobs)
+	worker := jobs.NewWorker()
+	webhookService := service.NewWebhookService(repos.accounts, repos.webhooks, jobs, nil, cfg.Webhooks)
+	webhookService.HandleWebhooks(worker)
+	smsService := service.NewSMSService(repos.accounts, models.NewOTPRepository(rdb), models.NewSMSUsageRepository(rdb), repos.notifications, jobs, sms.NewHTTP(cfg.SMS), cfg.SMS)
+	smsService.HandleSMS(worker)
+	// notifications are saved to the inbox and logged rather than emailed
+	notificationService := service.NewNotificationService(repos.notifications, nil)
+	service.HandleNotifications(worker, notificationService)
+	bus := events.NewBus()
+	bus.Subscribe(events.All, "notifications", service.NotifyEvents(repos.accounts, service.QueueNotifier{Queue: jobs}))
+	bus.Subscribe(events.All, "webhooks", webhookService.HandleEvent)
+	bus.Subscribe(events.All, "sms_alerts", smsService.HandleEvent)
+	hub := realtime.NewHub(rdb, cfg.Realtime)
+	hubCtx, stopHub := context.WithCancel(context.Background())
+	t.Cleanup(stopHub)
+	go hub.Run(hubCtx)
+	bus.Subscribe(events.All, "realtime", service.PublishUpdates(repos.accounts, hub))
+
+	router := gin.New()
+	router.Use(middleware.RequestID())
+	h, err := NewHandler(router, cfg, Services{
+		AccountService:      service.NewAccountService(repos.accounts, repos.roles, nil),
+		TokenService:        tokenService,
+		ScheduleService:     scheduleService,
+		WebhookService:      webhookService,
+		SMSService:          smsService,
+		NotificationService: notificationService,
+		BeneficiaryService:  service.NewBeneficiaryService(repos.accounts, repos.beneficiaries, cfg.Beneficiaries),
+		Realtime:            hub,
+		RateLimiter:         middleware.NewRateLimiter(rdb),
+		ReadinessChecks: map[string]DependencyCheck{
+			"redis": func(ctx context.Context) error {
+				return rdb.Ping(ctx).Err()
+			},
+			"signing_keys": func(ctx context.Context) error {
+				return tokenService.CheckSigningKeys()
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("creating handler: %v", err)
+	}
+	h.SetupRoutes()
+	h.SetReady(true)
+
+	return &testServer{
+		t:         t,
+		router:    router,
+		handler:   h,
+		cfg:       cfg,
+		redis:     mr,
+		accounts:  repos.accounts,
+		roles:     repos.roles,
+		ledger:    repos.ledger,
+		tokens:    tokenService,
+		schedules: scheduleService,
+		relay:     events.NewRelay(repos.outbox, cfg.Outbox, bus),
+		worker:    worker,
+		texts:     texts,
+	}
+}
+
+// do sends a request with body encoded as JSON, and token as the
+// bearer token if not empty, returning the recorded response
+func (s *testServer) do(method, path string, body any, token string) *httptest.ResponseRecorder {
+	s.t.Helper()
+	if token != "" {
+		token = "Bearer " + token
+	}
+	return s.doAuth(method, path, body, token)
+}
+
+// doAuth is do with the raw Authorization header, left out if empty
+func (s *testServer) doAuth(method, path string, body any, authorization string) *httptest.ResponseRecorder {
+	s.t.Helper()
+
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			s.t.Fatalf("encoding body: %v", err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+	return rec
+}
+
+// tokensResponse is the token pair returned on signup and signin
+type tokensResponse struct {
+	Tokens struct {
+		Token        string `json:"token"`
+		RefreshToken string `json:"refreshToken"`
+	} `json:"tokens"`
+}
+
+// signup registers an account, failing the test unless it succeeds
+func (s *testServer) signup(email, password string) tokensResponse {
+	s.t.Helper()
+
+	rec := s.do(http.MethodPost, "/api/register", gin.H{
+		"first_name":       "John",
+		"last_name":        "Doe",
+		"email":            email,
+		"password":         password,
+		"confirm_password": password,
+	}, "")
+	if rec.Code != http.StatusCreated {
+		s.t.Fatalf("signup: got status %d, body %s", rec.Code, rec.Body)
+	}
+	var resp tokensResponse
+	decode(s.t, rec, &resp)
+	return resp
+}
+
+// activate activates the account with email, as an operator would
+func (s *testServer) activate(email string) {
+	s.t.Helper()
+	ctx := context.Background()
+	account, err := s.accounts.GetByEmail(ctx, email)
+	if err != nil {
+		s.t.Fatalf("get account: %v", err)
+	}
+	account.IsActive = true
+	if err := s.accounts.ChangeStatus(ctx, account); err != nil {
+		s.t.Fatalf("activate: %v", err)
+	}
+}
+
+func decode(t *testing.T, rec *httptest.ResponseRecorder, v any) {
+	t.Helper()
+	if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+		t.Fatalf("decoding response %q: %v", rec.Body, err)
+	}
+}
+
+// forEachBackend runs test against a fresh server for every backend
+func forEachBackend(t *testing.T, test func(t *testing.T, s *testServer)) {
+	for _, b := range backends {
+		b := b
+		t.Run(b.name, func(t *testing.T) {
+			test(t, newTestServer(t, b))
+		})
+	}
+}
@@ -0,0 +1,192 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Cprime50/Gopay/helper"
+	"github.com/Cprime50/Gopay/middleware"
+	models "github.com/Cprime50/Gopay/models/account"
+	"github.com/Cprime50/Gopay/realtime"
+	"github.com/Cprime50/Gopay/service"
+	"github.com/gin-gonic/gin"
+)
+
+// streamBatch is how many updates are read from the history at a time
+const streamBatch = 100
+
+// readyEvent is the first event of a stream. Resync is set when the
+// client resumed after updates it can no longer be sent, it should
+// fetch what it shows again
+type readyEvent struct {
+	Balance float64 `json:"balance"`
+	Resync  bool    `json:"resync"`
+}
+
+// Stream pushes the signed in account's balance changes, transfers and
+// security events as server sent events, until the client disconnects,
+// its token expires or the server shuts down. A client reconnecting with Last-Event-ID is
+// sent the updates it missed. The token is only taken from the
+// Authorization header, which a browser's EventSource can't send, so
+// browsers need a polyfill that can
+func (h *Handler) Stream(c *gin.Context) {
+	lastID := c.GetHeader("Last-Event-ID")
+	if lastID != "" && !realtime.ValidID(lastID) {
+		middleware.Abort(c, helper.NewInvalidParam("Last-Event-ID", "event_id", "must be the id of an event sent on this stream"))
+		return
+	}
+
+	value, _ := c.Get("account")
+	account := value.(*models.Account)
+	ctx := c.Request.Context()
+
+	// subscribed before reading the history so nothing published in between is missed
+	sub, err := h.Realtime.Subscribe(account.ID)
+	if errors.Is(err, realtime.ErrTooManyStreams) {
+		middleware.Abort(c, helper.NewTooManyRequests(h.Heartbeat))
+		return
+	}
+	if errors.Is(err, realtime.ErrClosed) {
+		middleware.Abort(c, helper.NewServiceUnavailable())
+		return
+	}
+	if err != nil {
+		middleware.Abort(c, err)
+		return
+	}
+	defer sub.Close()
+
+	cursor, resync := "", false
+	if lastID != "" {
+		ok, err := h.Realtime.Resumable(ctx, account.ID, lastID)
+		if err != nil {
+			helper.Logger(ctx).Error("error resuming stream", "error", err)
+			middleware.Abort(c, helper.NewInternal())
+			return
+		}
+		if ok {
+			cursor = lastID
+		} else {
+			resync = true
+		}
+	}
+	if cursor == "" {
+		if cursor, err = h.Realtime.Latest(ctx, account.ID); err != nil {
+			helper.Logger(ctx).Error("error starting stream", "error", err)
+			middleware.Abort(c, helper.NewInternal())
+			return
+		}
+	}
+	// the balance in the token may be stale, the account isn't
+	current, err := h.AccountService.Get(ctx, account.ID)
+	if err != nil {
+		middleware.Abort(c, err)
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	// nginx would buffer the stream otherwise
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	w := &eventWriter{c: c, rc: http.NewResponseController(c.Writer), timeout: 2 * h.Heartbeat}
+	data, _ := json.Marshal(readyEvent{Balance: current.Balance, Resync: resync})
+	if err := w.event(realtime.Update{ID: cursor, Type: "ready", Data: data}); err != nil {
+		return
+	}
+
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	heartbeat := time.NewTicker(h.Heartbeat)
+	defer heartbeat.Stop()
+	for {
+		// every wake up and heartbeat reads the history, so updates
+		// whose wake up was lost are only late
+		done, err := h.sendUpdates(ctx, w, account, &cursor)
+		if err != nil || done {
+			if err != nil && ctx.Err() == nil {
+				helper.Logger(ctx).Warn("stream ended", "error", err)
+			}
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-sub.Done():
+			return
+		case <-sub.Wake():
+		case <-heartbeat.C:
+			if _, err := h.TokenService.ValidateJWT(ctx, token); err != nil {
+				w.event(realtime.Update{Type: "expired", Data: json.RawMessage("{}")})
+				return
+			}
+			if err := w.comment("heartbeat"); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// sendUpdates writes the account's updates after cursor, moving it on.
+// The stream is done once the password changed, its tokens stop working
+func (h *Handler) sendUpdates(ctx context.Context, w *eventWriter, account *models.Account, cursor *string) (bool, error) {
+	for {
+		updates, err := h.Realtime.After(ctx, account.ID, *cursor, streamBatch)
+		if err != nil {
+			return false, err
+		}
+		for _, update := range updates {
+			if err := w.event(update); err != nil {
+				return false, err
+			}
+			*cursor = update.ID
+			if update.Type == service.UpdatePasswordChanged {
+				return true, nil
+			}
+		}
+		if len(updates) < streamBatch {
+			return false, nil
+		}
+	}
+}
+
+// eventWriter writes server sent events, each flushed straight away
+type eventWriter struct {
+	c  *gin.Context
+	rc *http.ResponseController
+	// timeout bounds each write, the server's write timeout would end
+	// the stream so it's pushed back on every write instead
+	timeout time.Duration
+}
+
+func (w *eventWriter) event(update realtime.Update) error {
+	var b strings.Builder
+	if update.ID != "" {
+		fmt.Fprintf(&b, "id: %s\n", update.ID)
+	}
+	fmt.Fprintf(&b, "event: %s\ndata: %s\n\n", update.Type, update.Data)
+	return w.write(b.String())
+}
+
+func (w *eventWriter) comment(text string) error {
+	return w.write(": " + text + "\n\n")
+}
+
+func (w *eventWriter) write(s string) error {
+	// recorders in tests can't set deadlines
+	if err := w.rc.SetWriteDeadline(time.Now().Add(w.timeout)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	if _, err := w.c.Writer.WriteString(s); err != nil {
+		return err
+	}
+	w.c.Writer.Flush()
+	return nil
+}
@@ -0,0 +1,211 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Cprime50/Gopay/config"
+	"github.com/Cprime50/Gopay/helper"
+	models "github.com/Cprime50/Gopay/models/account"
+	"github.com/Cprime50/Gopay/service"
+	"github.com/gin-gonic/gin"
+)
+
+// sseEvent is an event read from an update stream
+type sseEvent struct {
+	ID   string
+	Type string
+	Data string
+}
+
+// updateStream is an open update stream, next reads its events
+type updateStream struct {
+	t      *testing.T
+	resp   *http.Response
+	lines  *bufio.Scanner
+	cancel context.CancelFunc
+}
+
+// openStream connects to the update stream of the account of token,
+// resuming after lastEventID if it's set
+func openStream(t *testing.T, srv *httptest.Server, token string, lastEventID string) *updateStream {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/api/stream", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		cancel()
+		t.Fatalf("open stream: %v", err)
+	}
+	s := &updateStream{t: t, resp: resp, lines: bufio.NewScanner(resp.Body), cancel: cancel}
+	t.Cleanup(s.close)
+	return s
+}
+
+func (s *updateStream) close() {
+	s.cancel()
+	s.resp.Body.Close()
+}
+
+// next returns the next event, skipping comments, or a zero event once the stream ends
+func (s *updateStream) next() sseEvent {
+	s.t.Helper()
+	var event sseEvent
+	for s.lines.Scan() {
+		line := s.lines.Text()
+		switch {
+		case line == "":
+			if event.Type != "" {
+				return event
+			}
+		case strings.HasPrefix(line, "id: "):
+			event.ID = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			event.Type = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			event.Data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+	return sseEvent{}
+}
+
+// expect reads the next event, failing unless it's of eventType
+func (s *updateStream) expect(eventType string) sseEvent {
+	s.t.Helper()
+	event := s.next()
+	if event.Type != eventType {
+		s.t.Fatalf("got event %+v, want %s", event, eventType)
+	}
+	return event
+}
+
+func TestUpdateStream(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s *testServer) {
+		ctx := context.Background()
+		srv := httptest.NewServer(s.router)
+		t.Cleanup(srv.Close)
+		s.signup("john@mail.com", "password123")
+		jane := s.signup("jane@mail.com", "password123").Tokens.Token
+		sender, _ := s.accounts.GetByEmail(ctx, "john@mail.com")
+		recipient, _ := s.accounts.GetByEmail(ctx, "jane@mail.com")
+		transfer := func(amount float64) {
+			t.Helper()
+			err := s.ledger.Transfer(ctx,
+				&models.LedgerEntry{AccountID: sender.ID, Type: models.Debit, Amount: amount, Reason: "lunch", Actor: sender.Email},
+				&models.LedgerEntry{AccountID: recipient.ID, Type: models.Credit, Amount: amount, Reason: "lunch", Actor: sender.Email})
+			if err != nil {
+				t.Fatalf("transfer: %v", err)
+			}
+			if _, err := s.relay.RelayPending(ctx); err != nil {
+				t.Fatalf("relay: %v", err)
+			}
+		}
+
+		stream := openStream(t, srv, jane, "")
+		if stream.resp.StatusCode != http.StatusOK || stream.resp.Header.Get("Content-Type") != "text/event-stream" {
+			t.Fatalf("got status %d, content type %q", stream.resp.StatusCode, stream.resp.Header.Get("Content-Type"))
+		}
+		var ready readyEvent
+		json.Unmarshal([]byte(stream.expect("ready").Data), &ready)
+		if ready.Resync || ready.Balance != recipient.Balance {
+			t.Fatalf("got ready %+v", ready)
+		}
+
+		transfer(25)
+		var balance service.BalanceUpdate
+		json.Unmarshal([]byte(stream.expect(service.UpdateBalance).Data), &balance)
+		if balance.Balance != recipient.Balance+25 {
+			t.Fatalf("got balance %+v, want %.2f", balance, recipient.Balance+25)
+		}
+		received := stream.expect(service.UpdateTransferReceived)
+		var update service.TransferUpdate
+		json.Unmarshal([]byte(received.Data), &update)
+		if update.Amount != 25 || update.CounterpartyAccountNumber != sender.AccountNumber {
+			t.Fatalf("got transfer %+v", update)
+		}
+		stream.close()
+
+		// reconnecting resumes after the last event seen
+		transfer(10)
+		stream = openStream(t, srv, jane, received.ID)
+		json.Unmarshal([]byte(stream.expect("ready").Data), &ready)
+		if ready.Resync {
+			t.Fatalf("resumed with resync set")
+		}
+		stream.expect(service.UpdateBalance)
+		json.Unmarshal([]byte(stream.expect(service.UpdateTransferReceived).Data), &update)
+		if update.Amount != 10 {
+			t.Fatalf("got missed transfer %+v", update)
+		}
+		stream.close()
+
+		// updates no longer kept are resynced
+		stream = openStream(t, srv, jane, "1-0")
+		json.Unmarshal([]byte(stream.expect("ready").Data), &ready)
+		if !ready.Resync || ready.Balance != recipient.Balance+35 {
+			t.Fatalf("got ready %+v, want a resync", ready)
+		}
+		stream.close()
+
+		req := httptest.NewRequest(http.MethodGet, "/api/stream", nil)
+		req.Header.Set("Authorization", "Bearer "+jane)
+		req.Header.Set("Last-Event-ID", "nope")
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, req)
+		problem(t, rec, http.StatusBadRequest, helper.CodeValidationFailed)
+		problem(t, s.do(http.MethodGet, "/api/stream", nil, ""), http.StatusUnauthorized, helper.CodeUnauthenticated)
+	})
+}
+
+func TestUpdateStreamEnds(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s *testServer) {
+		srv := httptest.NewServer(s.router)
+		t.Cleanup(srv.Close)
+		jane := s.signup("jane@mail.com", "password123").Tokens.Token
+
+		// the stream ends once the password changes, its token stops working
+		stream := openStream(t, srv, jane, "")
+		stream.expect("ready")
+		rec := s.do(http.MethodPut, "/api/me/password", gin.H{"current_password": "password123", "password": "password456", "confirm_password": "password456"}, jane)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("change password: got status %d, body %s", rec.Code, rec.Body)
+		}
+		if _, err := s.relay.RelayPending(context.Background()); err != nil {
+			t.Fatalf("relay: %v", err)
+		}
+		stream.expect(service.UpdatePasswordChanged)
+		if event := stream.next(); event.Type != "" {
+			t.Fatalf("got %+v after the password changed, want the end of the stream", event)
+		}
+	})
+}
+
+func TestUpdateStreamExpires(t *testing.T) {
+	for _, b := range backends[:1] {
+		s := newTestServer(t, b, func(cfg *config.Config) {
+			cfg.Token.IDTokenExp = time.Second
+			cfg.Realtime.Heartbeat = 100 * time.Millisecond
+		})
+		srv := httptest.NewServer(s.router)
+		t.Cleanup(srv.Close)
+		jane := s.signup("jane@mail.com", "password123").Tokens.Token
+
+		// heartbeats check the token, the stream ends once it expires
+		stream := openStream(t, srv, jane, "")
+		stream.expect("ready")
+		stream.expect("expired")
+		if event := stream.next(); event.Type != "" {
+			t.Fatalf("got %+v after the token expired, want the end of the stream", event)
+		}
+	}
+}
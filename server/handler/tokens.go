@@ -0,0 +1,49 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/Cprime50/Gopay/helper"
+	"github.com/Cprime50/Gopay/middleware"
+	"github.com/gin-gonic/gin"
+)
+
+type tokensReq struct {
+	RefreshToken string `json:"refreshToken" binding:"required"`
+}
+
+// Tokens rotates a refresh token, the one provided is revoked
+// and a new pair issued, so each refresh token works only once
+func (h *Handler) Tokens(c *gin.Context) {
+	var input tokensReq
+	if err := c.ShouldBindJSON(&input); err != nil {
+		middleware.Abort(c, helper.NewBindError(err))
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	refreshToken, err := h.TokenService.ValidateRefreshToken(ctx, input.RefreshToken)
+	if err != nil {
+		middleware.Abort(c, err)
+		return
+	}
+
+	// load the account so role or detail changes since the
+	// last refresh make it into the new id token
+	account, err := h.AccountService.Get(ctx, refreshToken.AccountID)
+	if err != nil {
+		middleware.Abort(c, helper.NewAuthorization("Unable to verify user from refresh token").WithCode(helper.CodeInvalidToken))
+		return
+	}
+
+	tokens, err := h.TokenService.NewPairFromUser(ctx, account, refreshToken.ID.String())
+	if err != nil {
+		middleware.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, tokensResp{
+		Tokens: tokens,
+	})
+}
@@ -0,0 +1,239 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/Cprime50/Gopay/helper"
+	"github.com/Cprime50/Gopay/middleware"
+	models "github.com/Cprime50/Gopay/models/account"
+	"github.com/Cprime50/Gopay/service"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// webhookReq registers a webhook endpoint. Events lists the event
+// types to deliver, * for all of them
+type webhookReq struct {
+	URL         string   `json:"url" binding:"required,max=2048"`
+	Description string   `json:"description" binding:"max=140"`
+	Events      []string `json:"events" binding:"required,min=1,dive,max=100"`
+}
+
+// webhookUpdateReq edits a webhook endpoint, fields left out are kept.
+// Setting enabled on a disabled endpoint resets its failures
+type webhookUpdateReq struct {
+	URL         *string  `json:"url" binding:"omitempty,max=2048"`
+	Description *string  `json:"description" binding:"omitempty,max=140"`
+	Events      []string `json:"events" binding:"omitempty,min=1,dive,max=100"`
+	Enabled     *bool    `json:"enabled"`
+}
+
+// deliveriesQuery pages the delivery log
+type deliveriesQuery struct {
+	Limit int `form:"limit" binding:"omitempty,min=1,max=100"`
+}
+
+// webhookResp wraps one webhook endpoint
+type webhookResp struct {
+	Webhook *models.WebhookEndpoint `json:"webhook"`
+}
+
+// webhookCreatedResp is the new endpoint and the secret deliveries are
+// signed with, only ever shown here
+type webhookCreatedResp struct {
+	Webhook *models.WebhookEndpoint `json:"webhook"`
+	Secret  string                  `json:"secret"`
+}
+
+// webhooksResp lists the account's webhook endpoints
+type webhooksResp struct {
+	Webhooks []*models.WebhookEndpoint `json:"webhooks"`
+}
+
+// deliveriesResp lists an endpoint's deliveries
+type deliveriesResp struct {
+	Deliveries []*models.WebhookDelivery `json:"deliveries"`
+}
+
+// deliveryResp is a delivery with the body posted and every attempt at it
+type deliveryResp struct {
+	Delivery *models.WebhookDelivery  `json:"delivery"`
+	Payload  json.RawMessage          `json:"payload"`
+	Attempts []*models.WebhookAttempt `json:"attempts"`
+}
+
+// redeliveryResp is a delivery queued to be sent again
+type redeliveryResp struct {
+	Delivery *models.WebhookDelivery `json:"delivery"`
+}
+
+// CreateWebhook registers a webhook endpoint for the signed in account
+func (h *Handler) CreateWebhook(c *gin.Context) {
+	var input webhookReq
+	if err := c.ShouldBindJSON(&input); err != nil {
+		middleware.Abort(c, helper.NewBindError(err))
+		return
+	}
+
+	value, _ := c.Get("account")
+	endpoint := &models.WebhookEndpoint{
+		AccountID:   value.(*models.Account).ID,
+		URL:         input.URL,
+		Description: input.Description,
+		Events:      input.Events,
+	}
+	secret, err := h.WebhookService.Create(c.Request.Context(), endpoint)
+	if err != nil {
+		middleware.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, webhookCreatedResp{Webhook: endpoint, Secret: secret})
+}
+
+// GetWebhooks lists the signed in account's webhook endpoints
+func (h *Handler) GetWebhooks(c *gin.Context) {
+	value, _ := c.Get("account")
+	endpoints, err := h.WebhookService.List(c.Request.Context(), value.(*models.Account).ID)
+	if err != nil {
+		middleware.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, webhooksResp{Webhooks: endpoints})
+}
+
+// GetWebhook returns one of the signed in account's webhook endpoints
+func (h *Handler) GetWebhook(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	value, _ := c.Get("account")
+	endpoint, err := h.WebhookService.Get(c.Request.Context(), value.(*models.Account).ID, id)
+	if err != nil {
+		middleware.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, webhookResp{Webhook: endpoint})
+}
+
+// UpdateWebhook edits, enables or disables a webhook endpoint
+func (h *Handler) UpdateWebhook(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+	var input webhookUpdateReq
+	if err := c.ShouldBindJSON(&input); err != nil {
+		middleware.Abort(c, helper.NewBindError(err))
+		return
+	}
+
+	value, _ := c.Get("account")
+	endpoint, err := h.WebhookService.Update(c.Request.Context(), value.(*models.Account).ID, id, service.WebhookUpdate{
+		URL:         input.URL,
+		Description: input.Description,
+		Events:      input.Events,
+		Enabled:     input.Enabled,
+	})
+	if err != nil {
+		middleware.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, webhookResp{Webhook: endpoint})
+}
+
+// DeleteWebhook removes a webhook endpoint and its delivery log
+func (h *Handler) DeleteWebhook(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	value, _ := c.Get("account")
+	if err := h.WebhookService.Delete(c.Request.Context(), value.(*models.Account).ID, id); err != nil {
+		middleware.Abort(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// GetWebhookDeliveries lists a webhook endpoint's latest deliveries
+func (h *Handler) GetWebhookDeliveries(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+	query := deliveriesQuery{Limit: 50}
+	if err := c.ShouldBindQuery(&query); err != nil {
+		middleware.Abort(c, helper.NewBindError(err))
+		return
+	}
+
+	value, _ := c.Get("account")
+	deliveries, err := h.WebhookService.Deliveries(c.Request.Context(), value.(*models.Account).ID, id, query.Limit)
+	if err != nil {
+		middleware.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, deliveriesResp{Deliveries: deliveries})
+}
+
+// GetWebhookDelivery returns a delivery with every attempt at it
+func (h *Handler) GetWebhookDelivery(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+	deliveryID, ok := pathID(c, "delivery_id")
+	if !ok {
+		return
+	}
+
+	value, _ := c.Get("account")
+	delivery, attempts, err := h.WebhookService.Delivery(c.Request.Context(), value.(*models.Account).ID, id, deliveryID)
+	if err != nil {
+		middleware.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, deliveryResp{Delivery: delivery, Payload: json.RawMessage(delivery.Payload), Attempts: attempts})
+}
+
+// RedeliverWebhook sends a finished delivery again
+func (h *Handler) RedeliverWebhook(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+	deliveryID, ok := pathID(c, "delivery_id")
+	if !ok {
+		return
+	}
+
+	value, _ := c.Get("account")
+	delivery, err := h.WebhookService.Redeliver(c.Request.Context(), value.(*models.Account).ID, id, deliveryID)
+	if err != nil {
+		middleware.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, redeliveryResp{Delivery: delivery})
+}
+
+// pathID parses the uuid path parameter name, aborting if it isn't one
+func pathID(c *gin.Context, name string) (uuid.UUID, bool) {
+	id, err := uuid.Parse(c.Param(name))
+	if err != nil {
+		middleware.Abort(c, helper.NewInvalidParam(name, "uuid", "must be a valid UUID"))
+		return uuid.Nil, false
+	}
+	return id, true
+}
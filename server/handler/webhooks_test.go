@@ -0,0 +1,183 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Cprime50/Gopay/helper"
+	models "github.com/Cprime50/Gopay/models/account"
+	"github.com/Cprime50/Gopay/service"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// webhookReceiver records the deliveries posted to it
+type webhookReceiver struct {
+	mu       sync.Mutex
+	requests []receivedWebhook
+}
+
+type receivedWebhook struct {
+	header http.Header
+	body   []byte
+}
+
+func (r *webhookReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	r.mu.Lock()
+	r.requests = append(r.requests, receivedWebhook{header: req.Header.Clone(), body: body})
+	r.mu.Unlock()
+	w.Write([]byte("ok"))
+}
+
+func (r *webhookReceiver) received() []receivedWebhook {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]receivedWebhook(nil), r.requests...)
+}
+
+func TestWebhooks(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s *testServer) {
+		ctx := context.Background()
+		receiver := &webhookReceiver{}
+		srv := httptest.NewServer(receiver)
+		t.Cleanup(srv.Close)
+
+		john := s.signup("john@mail.com", "password123").Tokens.Token
+		jane := s.signup("jane@mail.com", "password123").Tokens.Token
+
+		rec := s.do(http.MethodPost, "/api/webhooks", gin.H{
+			"url":         srv.URL,
+			"description": "payments",
+			"events":      []string{models.EventTransferCompleted},
+		}, jane)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("create: got status %d, body %s", rec.Code, rec.Body)
+		}
+		var created webhookCreatedResp
+		decode(t, rec, &created)
+		id := created.Webhook.ID.String()
+		if !strings.HasPrefix(created.Secret, "whsec_") || created.Webhook.Status != models.WebhookActive {
+			t.Fatalf("create: got %+v, secret %q", created.Webhook, created.Secret)
+		}
+
+		problem(t, s.do(http.MethodPost, "/api/webhooks", gin.H{"url": "ftp://example.com", "events": []string{"*"}}, jane), http.StatusBadRequest, helper.CodeValidationFailed)
+		problem(t, s.do(http.MethodPost, "/api/webhooks", gin.H{"url": srv.URL, "events": []string{"account.deleted"}}, jane), http.StatusBadRequest, helper.CodeValidationFailed)
+		problem(t, s.do(http.MethodGet, "/api/webhooks/"+id, nil, john), http.StatusNotFound, helper.CodeNotFound)
+		problem(t, s.do(http.MethodGet, "/api/webhooks", nil, ""), http.StatusUnauthorized, helper.CodeUnauthenticated)
+
+		rec = s.do(http.MethodGet, "/api/webhooks", nil, jane)
+		var list webhooksResp
+		decode(t, rec, &list)
+		if rec.Code != http.StatusOK || len(list.Webhooks) != 1 || strings.Contains(rec.Body.String(), created.Secret) {
+			t.Fatalf("list: got status %d, body %s", rec.Code, rec.Body)
+		}
+
+		// john pays jane, the relay hands the event to the webhook subscriber
+		// and the worker posts it
+		sender, _ := s.accounts.GetByEmail(ctx, "john@mail.com")
+		recipient, _ := s.accounts.GetByEmail(ctx, "jane@mail.com")
+		err := s.ledger.Transfer(ctx,
+			&models.LedgerEntry{AccountID: sender.ID, Type: models.Debit, Amount: 25, Reason: "lunch", Actor: sender.Email},
+			&models.LedgerEntry{AccountID: recipient.ID, Type: models.Credit, Amount: 25, Reason: "lunch", Actor: sender.Email})
+		if err != nil {
+			t.Fatalf("transfer: %v", err)
+		}
+		if _, err := s.relay.RelayPending(ctx); err != nil {
+			t.Fatalf("relay: %v", err)
+		}
+		if ran, err := s.worker.RunOne(ctx, service.WebhookJob.Queue); !ran || err != nil {
+			t.Fatalf("deliver: ran %v, %v", ran, err)
+		}
+
+		received := receiver.received()
+		if len(received) != 1 {
+			t.Fatalf("got %d deliveries, want 1", len(received))
+		}
+		got := received[0]
+		if err := service.VerifyWebhook(created.Secret, got.header.Get(service.WebhookSignatureHeader), got.body, time.Now(), 5*time.Minute); err != nil {
+			t.Fatalf("verify: %v", err)
+		}
+		var payload struct {
+			ID   string `json:"id"`
+			Type string `json:"type"`
+			Data struct {
+				Direction                 string    `json:"direction"`
+				Amount                    float64   `json:"amount"`
+				EntryID                   uuid.UUID `json:"entry_id"`
+				CounterpartyAccountNumber string    `json:"counterparty_account_number"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(got.body, &payload); err != nil {
+			t.Fatalf("decoding payload: %v", err)
+		}
+		// jane only gets her side of it, john is named by his masked account number
+		entries, _ := s.ledger.ListByAccount(ctx, recipient.ID, time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+		senderNumber := strconv.FormatInt(sender.AccountNumber, 10)
+		if payload.Type != models.EventTransferCompleted || payload.Data.Direction != "received" || payload.Data.Amount != 25 ||
+			len(entries) != 1 || payload.Data.EntryID != entries[0].ID || payload.Data.CounterpartyAccountNumber != helper.MaskAccountNumber(senderNumber) {
+			t.Fatalf("payload: got %s", got.body)
+		}
+		for _, leaked := range []string{sender.ID.String(), recipient.ID.String(), sender.Email, senderNumber} {
+			if strings.Contains(string(got.body), leaked) {
+				t.Fatalf("payload has %q: %s", leaked, got.body)
+			}
+		}
+
+		rec = s.do(http.MethodGet, "/api/webhooks/"+id+"/deliveries", nil, jane)
+		var deliveries deliveriesResp
+		decode(t, rec, &deliveries)
+		if rec.Code != http.StatusOK || len(deliveries.Deliveries) != 1 || deliveries.Deliveries[0].Status != models.DeliverySucceeded {
+			t.Fatalf("deliveries: got status %d, body %s", rec.Code, rec.Body)
+		}
+		deliveryID := deliveries.Deliveries[0].ID.String()
+		if h := got.header.Get(service.WebhookDeliveryHeader); h != deliveryID {
+			t.Fatalf("delivery header: got %q, want %q", h, deliveryID)
+		}
+
+		rec = s.do(http.MethodGet, "/api/webhooks/"+id+"/deliveries/"+deliveryID, nil, jane)
+		var delivery deliveryResp
+		decode(t, rec, &delivery)
+		if rec.Code != http.StatusOK || len(delivery.Attempts) != 1 || delivery.Attempts[0].StatusCode != http.StatusOK || !delivery.Attempts[0].Succeeded {
+			t.Fatalf("delivery: got status %d, body %s", rec.Code, rec.Body)
+		}
+		if !strings.Contains(string(delivery.Payload), payload.ID) {
+			t.Fatalf("delivery payload: got %s", delivery.Payload)
+		}
+
+		rec = s.do(http.MethodPost, "/api/webhooks/"+id+"/deliveries/"+deliveryID+"/redeliver", nil, jane)
+		if rec.Code != http.StatusAccepted {
+			t.Fatalf("redeliver: got status %d, body %s", rec.Code, rec.Body)
+		}
+		problem(t, s.do(http.MethodPost, "/api/webhooks/"+id+"/deliveries/"+deliveryID+"/redeliver", nil, jane), http.StatusBadRequest, helper.CodeInvalidRequest)
+		if ran, err := s.worker.RunOne(ctx, service.WebhookJob.Queue); !ran || err != nil {
+			t.Fatalf("redeliver: ran %v, %v", ran, err)
+		}
+		if received := receiver.received(); len(received) != 2 || string(received[1].body) != string(got.body) {
+			t.Fatalf("redeliver: got %d deliveries", len(received))
+		}
+
+		// disabled endpoints can't be redelivered to
+		rec = s.do(http.MethodPatch, "/api/webhooks/"+id, gin.H{"enabled": false}, jane)
+		var updated webhookResp
+		decode(t, rec, &updated)
+		if rec.Code != http.StatusOK || updated.Webhook.Status != models.WebhookDisabled {
+			t.Fatalf("disable: got status %d, body %s", rec.Code, rec.Body)
+		}
+		problem(t, s.do(http.MethodPost, "/api/webhooks/"+id+"/deliveries/"+deliveryID+"/redeliver", nil, jane), http.StatusBadRequest, helper.CodeInvalidRequest)
+
+		if rec := s.do(http.MethodDelete, "/api/webhooks/"+id, nil, jane); rec.Code != http.StatusNoContent {
+			t.Fatalf("delete: got status %d, body %s", rec.Code, rec.Body)
+		}
+		problem(t, s.do(http.MethodGet, "/api/webhooks/"+id, nil, jane), http.StatusNotFound, helper.CodeNotFound)
+		problem(t, s.do(http.MethodGet, "/api/webhooks/"+id+"/deliveries/"+deliveryID, nil, jane), http.StatusNotFound, helper.CodeNotFound)
+	})
+}
@@ -0,0 +1,65 @@
+package helper
+
+// Code is a stable, machine readable error code. Clients should branch on
+// codes rather than messages, which are for humans and may change. Codes
+// are never renamed or reused once released, only added
+type Code string
+
+// The code catalogue. Every Type has a default code, set by its factory,
+// and some errors carry a more specific one set with WithCode
+const (
+	// 400
+	CodeInvalidRequest    Code = "invalid_request"    // the request can't be processed as sent
+	CodeMalformedBody     Code = "malformed_body"     // the body isn't valid JSON, or a field has the wrong JSON type
+	CodeValidationFailed  Code = "validation_failed"  // one or more fields are invalid, see invalid_params
+	CodeInsufficientFunds Code = "insufficient_funds" // a debit would take the balance below zero
+	CodeInvalidOTP        Code = "invalid_otp"        // the one time code is wrong, expired or was guessed too often
+	CodePhoneNotVerified  Code = "phone_not_verified" // the account has no verified phone number
+
+	// 401
+	CodeUnauthenticated    Code = "unauthenticated"     // no or badly formatted credentials
+	CodeInvalidToken       Code = "invalid_token"       // the token is expired, revoked or not valid
+	CodeInvalidCredentials Code = "invalid_credentials" // wrong email and password combination
+
+	// 403
+	CodeForbidden              Code = "forbidden"                // authenticated but not allowed
+	CodePasswordChangeRequired Code = "password_change_required" // the account must change its password first
+
+	// 404
+	CodeNotFound      Code = "not_found"       // the resource doesn't exist
+	CodeRouteNotFound Code = "route_not_found" // no such endpoint
+
+	// 409
+	CodeConflict   Code = "conflict"    // the resource already exists
+	CodeEmailTaken Code = "email_taken" // an account with the email already exists
+
+	CodePayloadTooLarge      Code = "payload_too_large"      // 413
+	CodeUnsupportedMediaType Code = "unsupported_media_type" // 415
+	CodeRateLimited          Code = "rate_limited"           // 429, see the Retry-After header
+	CodeInternal             Code = "internal_error"         // 500
+	CodeServiceUnavailable   Code = "service_unavailable"    // 503, the request timed out or a dependency is down
+)
+
+// defaultCodes is the code errors of each Type get unless set otherwise
+var defaultCodes = map[Type]Code{
+	Authorization:        CodeUnauthenticated,
+	BadRequest:           CodeInvalidRequest,
+	Conflict:             CodeConflict,
+	Forbidden:            CodeForbidden,
+	Internal:             CodeInternal,
+	NotFound:             CodeNotFound,
+	PayloadTooLarge:      CodePayloadTooLarge,
+	ServiceUnavailable:   CodeServiceUnavailable,
+	TooManyRequests:      CodeRateLimited,
+	UnsupportedMediaType: CodeUnsupportedMediaType,
+}
+
+// Codes lists the whole catalogue, eg for API documentation
+var Codes = []Code{
+	CodeInvalidRequest, CodeMalformedBody, CodeValidationFailed, CodeInsufficientFunds, CodeInvalidOTP, CodePhoneNotVerified,
+	CodeUnauthenticated, CodeInvalidToken, CodeInvalidCredentials,
+	CodeForbidden, CodePasswordChangeRequired,
+	CodeNotFound, CodeRouteNotFound,
+	CodeConflict, CodeEmailTaken,
+	CodePayloadTooLarge, CodeUnsupportedMediaType, CodeRateLimited, CodeInternal, CodeServiceUnavailable,
+}
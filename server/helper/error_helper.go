@@ -4,6 +4,8 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 // Type holds a type string and integer code for the error
@@ -14,10 +16,12 @@ const (
 	Authorization        Type = "AUTHORIZATION"          // Authentication Failures -
 	BadRequest           Type = "BAD_REQUEST"            // Validation errors / BadInput
 	Conflict             Type = "CONFLICT"               // Already exists (eg, create account with existent email) - 409
+	Forbidden            Type = "FORBIDDEN"              // Authenticated but not allowed (eg, non admin on admin routes) - 403
 	Internal             Type = "INTERNAL"               // Server (500) and fallback errors
 	NotFound             Type = "NOT_FOUND"              // For not finding resource
 	PayloadTooLarge      Type = "PAYLOAD_TOO_LARGE"      // for uploading tons of JSON, or an image over the limit - 413
 	ServiceUnavailable   Type = "SERVICE_UNAVAILABLE"    // For long running handlers
+	TooManyRequests      Type = "TOO_MANY_REQUESTS"      // Rate limit exceeded - 429
 	UnsupportedMediaType Type = "UNSUPPORTED_MEDIA_TYPE" // for http 415
 )
 
@@ -25,8 +29,18 @@ const (
 // which is helpful in returning a consistent
 // error type/message from API endpoints
 type Error struct {
-	Type    Type   `json:"type"`
-	Message string `json:"message"`
+	Type          Type           `json:"type"`
+	Code          Code           `json:"code"`
+	Message       string         `json:"message"`
+	InvalidParams []InvalidParam `json:"invalid_params,omitempty"`
+	// Params fill the placeholders of the code's message in the i18n catalogue
+	Params map[string]string `json:"-"`
+}
+
+// WithCode sets a more specific code than the Type's default
+func (e *Error) WithCode(code Code) *Error {
+	e.Code = code
+	return e
 }
 
 // Error satisfies standard error interface
@@ -47,6 +61,8 @@ func (e *Error) Status() int {
 		return http.StatusBadRequest
 	case Conflict:
 		return http.StatusConflict
+	case Forbidden:
+		return http.StatusForbidden
 	case Internal:
 		return http.StatusInternalServerError
 	case NotFound:
@@ -55,6 +71,8 @@ func (e *Error) Status() int {
 		return http.StatusRequestEntityTooLarge
 	case ServiceUnavailable:
 		return http.StatusServiceUnavailable
+	case TooManyRequests:
+		return http.StatusTooManyRequests
 	case UnsupportedMediaType:
 		return http.StatusUnsupportedMediaType
 	default:
@@ -81,6 +99,7 @@ func Status(err error) int {
 func NewAuthorization(reason string) *Error {
 	return &Error{
 		Type:    Authorization,
+		Code:    defaultCodes[Authorization],
 		Message: reason,
 	}
 }
@@ -89,7 +108,9 @@ func NewAuthorization(reason string) *Error {
 func NewBadRequest(reason string) *Error {
 	return &Error{
 		Type:    BadRequest,
+		Code:    defaultCodes[BadRequest],
 		Message: fmt.Sprintf("Bad request. Reason: %v", reason),
+		Params:  map[string]string{"reason": reason},
 	}
 }
 
@@ -97,7 +118,18 @@ func NewBadRequest(reason string) *Error {
 func NewConflict(name string, value string) *Error {
 	return &Error{
 		Type:    Conflict,
+		Code:    defaultCodes[Conflict],
 		Message: fmt.Sprintf("resource: %v with value: %v already exists", name, value),
+		Params:  map[string]string{"name": name, "value": value},
+	}
+}
+
+// NewForbidden to create a 403
+func NewForbidden(reason string) *Error {
+	return &Error{
+		Type:    Forbidden,
+		Code:    defaultCodes[Forbidden],
+		Message: reason,
 	}
 }
 
@@ -105,6 +137,7 @@ func NewConflict(name string, value string) *Error {
 func NewInternal() *Error {
 	return &Error{
 		Type:    Internal,
+		Code:    defaultCodes[Internal],
 		Message: fmt.Sprintf("Internal server error."),
 	}
 }
@@ -113,7 +146,9 @@ func NewInternal() *Error {
 func NewNotFound(name string, value string) *Error {
 	return &Error{
 		Type:    NotFound,
+		Code:    defaultCodes[NotFound],
 		Message: fmt.Sprintf("resource: %v with value: %v not found", name, value),
+		Params:  map[string]string{"name": name, "value": value},
 	}
 }
 
@@ -121,7 +156,9 @@ func NewNotFound(name string, value string) *Error {
 func NewPayloadTooLarge(maxBodySize int64, contentLength int64) *Error {
 	return &Error{
 		Type:    PayloadTooLarge,
+		Code:    defaultCodes[PayloadTooLarge],
 		Message: fmt.Sprintf("Max payload size of %v exceeded. Actual payload size: %v", maxBodySize, contentLength),
+		Params:  map[string]string{"max": strconv.FormatInt(maxBodySize, 10), "size": strconv.FormatInt(contentLength, 10)},
 	}
 }
 
@@ -129,14 +166,26 @@ func NewPayloadTooLarge(maxBodySize int64, contentLength int64) *Error {
 func NewServiceUnavailable() *Error {
 	return &Error{
 		Type:    ServiceUnavailable,
+		Code:    defaultCodes[ServiceUnavailable],
 		Message: fmt.Sprintf("Service unavailable or timed out"),
 	}
 }
 
+// NewTooManyRequests to create an error for 429
+func NewTooManyRequests(retryAfter time.Duration) *Error {
+	return &Error{
+		Type:    TooManyRequests,
+		Code:    defaultCodes[TooManyRequests],
+		Message: fmt.Sprintf("Rate limit exceeded. Try again in %v", retryAfter.Round(time.Second)),
+		Params:  map[string]string{"retry_after": retryAfter.Round(time.Second).String()},
+	}
+}
+
 // NewUnsupportedMediaType to create an error for 415
 func NewUnsupportedMediaType(reason string) *Error {
 	return &Error{
 		Type:    UnsupportedMediaType,
+		Code:    defaultCodes[UnsupportedMediaType],
 		Message: reason,
 	}
 }
@@ -2,31 +2,42 @@ package helper
 
 import (
 	"context"
-	"fmt"
-	"log"
-	"os"
 	"time"
 
+	"github.com/Cprime50/Gopay/config"
 	"github.com/cloudinary/cloudinary-go"
 	"github.com/cloudinary/cloudinary-go/api/uploader"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
-func ImageUploadHelper(input interface{}) (string, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+// tracer is used for spans around slow work done in this package
+var tracer = otel.Tracer("github.com/Cprime50/Gopay/helper")
+
+func ImageUploadHelper(ctx context.Context, cfg config.Cloudinary, input interface{}) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
+	ctx, span := tracer.Start(ctx, "cloudinary.upload", trace.WithSpanKind(trace.SpanKindClient))
+	defer span.End()
+
 	//create cloudinary instance
-	cld, err := cloudinary.NewFromParams(os.Getenv("CLOUDINARY_CLOUD_NAME"), os.Getenv("CLOUDINARY_API_KEY"), os.Getenv("CLOUDINARY_API_SECRET"))
-	log.Printf("Connecting to Cloudinary\n")
+	cld, err := cloudinary.NewFromParams(cfg.CloudName, cfg.APIKey, cfg.APISecret)
+	Logger(ctx).Debug("connecting to cloudinary")
 	cld.Config.URL.Secure = true
 	if err != nil {
-		fmt.Println("error loading cloudinary", err)
+		Logger(ctx).Error("error loading cloudinary", "error", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "error loading cloudinary")
 		return "", NewInternal()
 	}
 
 	//upload file
-	uploadParam, err := cld.Upload.Upload(ctx, input, uploader.UploadParams{Folder: os.Getenv("CLOUDINARY_UPLOAD_FOLDER")})
+	uploadParam, err := cld.Upload.Upload(ctx, input, uploader.UploadParams{Folder: cfg.UploadFolder})
 	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "upload failed")
 		return "", err
 	}
 	return uploadParam.SecureURL, nil
@@ -0,0 +1,106 @@
+package helper
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// loggerKey is the context key the request scoped logger is stored under
+type loggerKey struct{}
+
+// Redacted replaces the value of any attribute that must never be logged
+const Redacted = "[REDACTED]"
+
+// secretKeys are attribute keys whose values are dropped entirely
+var secretKeys = map[string]bool{
+	"password":         true,
+	"confirm_password": true,
+	"token":            true,
+	"tokens":           true,
+	"id_token":         true,
+	"refresh_token":    true,
+	"refreshtoken":     true,
+	"signed_string":    true,
+	"authorization":    true,
+	"secret":           true,
+	"api_key":          true,
+}
+
+// piiKeys are attribute keys whose values are masked but kept
+// recognisable enough to be useful when debugging
+var piiKeys = map[string]func(string) string{
+	"email":          MaskEmail,
+	"first_name":     MaskName,
+	"last_name":      MaskName,
+	"account_number": MaskAccountNumber,
+}
+
+// NewLogger returns a JSON logger writing to w which redacts secrets and PII
+func NewLogger(w io.Writer, level slog.Leveler) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: redact,
+	}))
+}
+
+// ContextWithLogger returns a copy of ctx carrying logger
+func ContextWithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// Logger returns the request scoped logger stored in ctx, which carries
+// the request and account IDs, or the default logger if there is none
+func Logger(ctx context.Context) *slog.Logger {
+	if ctx != nil {
+		if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+			return logger
+		}
+	}
+	return slog.Default()
+}
+
+// redact is used as the handler's ReplaceAttr hook
+func redact(groups []string, a slog.Attr) slog.Attr {
+	key := strings.ToLower(a.Key)
+	if secretKeys[key] {
+		return slog.String(a.Key, Redacted)
+	}
+	if mask, ok := piiKeys[key]; ok {
+		return slog.String(a.Key, mask(a.Value.String()))
+	}
+	return a
+}
+
+// MaskEmail keeps the first character of the local part and the domain
+// eg john.doe@mail.com becomes j*******@mail.com
+func MaskEmail(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at < 1 {
+		return mask(email, 0)
+	}
+	return mask(email[:at], 1) + email[at:]
+}
+
+// MaskName keeps only the first character of a name
+func MaskName(name string) string {
+	return mask(name, 1)
+}
+
+// MaskAccountNumber keeps only the last four digits of an account number
+func MaskAccountNumber(number string) string {
+	if len(number) <= 4 {
+		return mask(number, 0)
+	}
+	return strings.Repeat("*", len(number)-4) + number[len(number)-4:]
+}
+
+// mask replaces all but the first keep runes of s with asterisks
+func mask(s string, keep int) string {
+	runes := []rune(s)
+	if len(runes) <= keep {
+		return strings.Repeat("*", len(runes))
+	}
+	return string(runes[:keep]) + strings.Repeat("*", len(runes)-keep)
+}
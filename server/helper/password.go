@@ -1,13 +1,17 @@
 package helper
 
 import (
+	"context"
 	"errors"
 
 	"golang.org/x/crypto/bcrypt"
 )
 
 // confirm user password checks if password matches hashed one in db
-func ComparePassword(hashedPassword string, plainPassword string) (bool, error) {
+func ComparePassword(ctx context.Context, hashedPassword string, plainPassword string) (bool, error) {
+	_, span := tracer.Start(ctx, "bcrypt.compare")
+	defer span.End()
+
 	err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(plainPassword))
 	// we can get two types of error here
 	if err != nil {
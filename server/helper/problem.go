@@ -0,0 +1,81 @@
+package helper
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Cprime50/Gopay/i18n"
+)
+
+// ProblemContentType is the media type of error responses, RFC 7807
+const ProblemContentType = "application/problem+json"
+
+// problemTypePrefix prefixes the code to make the problem type URI
+const problemTypePrefix = "urn:gopay:problem:"
+
+// InvalidParam describes why a single request field was rejected
+type InvalidParam struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+	// Rule is the validation rule that failed, eg required or email
+	Rule string `json:"rule,omitempty"`
+	// translate returns Reason in a locale, nil if Reason is only in English
+	translate func(locale string) string
+}
+
+// Problem is an RFC 7807 problem details body, every API error is rendered as one
+type Problem struct {
+	Type          string         `json:"type"`
+	Title         string         `json:"title"`
+	Status        int            `json:"status"`
+	Detail        string         `json:"detail,omitempty"`
+	Instance      string         `json:"instance,omitempty"`
+	Code          Code           `json:"code"`
+	RequestID     string         `json:"request_id,omitempty"`
+	InvalidParams []InvalidParam `json:"invalid_params,omitempty"`
+}
+
+// NewProblem builds the problem details for err, with the title and detail
+// in locale. Errors that aren't an *Error are reported as internal errors
+// without leaking their message
+func NewProblem(err error, instance string, requestID string, locale string) Problem {
+	var e *Error
+	if !errors.As(err, &e) {
+		e = NewInternal()
+	}
+	code := e.Code
+	if code == "" {
+		code = defaultCodes[e.Type]
+	}
+	if code == "" {
+		code = CodeInternal
+	}
+
+	title, ok := i18n.Lookup(locale, string(code)+".title", nil)
+	if !ok {
+		title = http.StatusText(e.Status())
+	}
+	detail, ok := i18n.Lookup(locale, string(code)+".detail", e.Params)
+	if !ok {
+		detail = e.Message
+	}
+
+	var params []InvalidParam
+	for _, param := range e.InvalidParams {
+		if param.translate != nil {
+			param.Reason = param.translate(locale)
+		}
+		params = append(params, param)
+	}
+
+	return Problem{
+		Type:          problemTypePrefix + string(code),
+		Title:         title,
+		Status:        e.Status(),
+		Detail:        detail,
+		Instance:      instance,
+		Code:          code,
+		RequestID:     requestID,
+		InvalidParams: params,
+	}
+}
@@ -0,0 +1,76 @@
+package helper
+
+import (
+	"sync"
+
+	"github.com/Cprime50/Gopay/i18n"
+	"github.com/go-playground/locales/en"
+	"github.com/go-playground/locales/fr"
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+	entranslations "github.com/go-playground/validator/v10/translations/en"
+	frtranslations "github.com/go-playground/validator/v10/translations/fr"
+)
+
+// translators has a validator translator for every supported locale
+var translators = newTranslators()
+
+// registerOnce guards RegisterTranslations, a translator only takes
+// each message once and there is a single validator, gin's
+var registerOnce sync.Once
+
+func newTranslators() map[string]ut.Translator {
+	uni := ut.New(en.New(), en.New(), fr.New())
+	translators := make(map[string]ut.Translator, len(i18n.Supported))
+	for _, locale := range i18n.Supported {
+		translators[locale], _ = uni.GetTranslator(locale)
+	}
+	return translators
+}
+
+// RegisterTranslations adds the validator messages of every supported
+// locale to v, so invalid_params reasons follow the request's locale
+func RegisterTranslations(v *validator.Validate) error {
+	var err error
+	registerOnce.Do(func() {
+		register := map[string]func(*validator.Validate, ut.Translator) error{
+			i18n.English: entranslations.RegisterDefaultTranslations,
+			i18n.French:  frtranslations.RegisterDefaultTranslations,
+		}
+		// the defaults name the other field by its go name, eg Password
+		eqfield := map[string]string{
+			i18n.English: "{0} must match {1}",
+			i18n.French:  "{0} doit être identique à {1}",
+		}
+		for locale, trans := range translators {
+			if err = register[locale](v, trans); err != nil {
+				return
+			}
+			message := eqfield[locale]
+			err = v.RegisterTranslation("eqfield", trans, func(trans ut.Translator) error {
+				return trans.Add("eqfield", message, true)
+			}, func(trans ut.Translator, fe validator.FieldError) string {
+				t, _ := trans.T("eqfield", fe.Field(), snakeCase(fe.Param()))
+				return t
+			})
+			if err != nil {
+				return
+			}
+		}
+	})
+	return err
+}
+
+// translateField is the reason fe failed in locale, in English
+// when the rule has no translation
+func translateField(fe validator.FieldError, locale string) string {
+	trans, ok := translators[locale]
+	if !ok {
+		trans = translators[i18n.Default]
+	}
+	// Translate falls back to the raw validator error for unknown rules
+	if reason := fe.Translate(trans); reason != fe.Error() {
+		return reason
+	}
+	return fe.Field() + " " + validationReason(fe)
+}
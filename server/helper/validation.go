@@ -0,0 +1,165 @@
+package helper
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"unicode"
+
+	"github.com/Cprime50/Gopay/i18n"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// NewBindError turns an error from binding a request body into a 400,
+// listing every invalid field rather than only the first
+func NewBindError(err error) *Error {
+	var validationErrors validator.ValidationErrors
+	var syntaxError *json.SyntaxError
+	var typeError *json.UnmarshalTypeError
+
+	switch {
+	case errors.As(err, &validationErrors):
+		params := make([]InvalidParam, 0, len(validationErrors))
+		for _, fe := range validationErrors {
+			fe := fe
+			params = append(params, InvalidParam{
+				Name:      fieldName(fe),
+				Reason:    translateField(fe, i18n.Default),
+				Rule:      fe.Tag(),
+				translate: func(locale string) string { return translateField(fe, locale) },
+			})
+		}
+		return &Error{
+			Type:          BadRequest,
+			Code:          CodeValidationFailed,
+			Message:       "Bad request. Reason: some fields are invalid, see invalid_params",
+			InvalidParams: params,
+		}
+
+	case errors.As(err, &typeError):
+		kind := map[string]string{"kind": jsonKind(typeError.Type)}
+		return &Error{
+			Type:    BadRequest,
+			Code:    CodeMalformedBody,
+			Message: "Bad request. Reason: a field has the wrong type, see invalid_params",
+			InvalidParams: []InvalidParam{{
+				Name:      typeError.Field,
+				Reason:    i18n.T(i18n.Default, "invalid_type", kind),
+				Rule:      "type",
+				translate: func(locale string) string { return i18n.T(locale, "invalid_type", kind) },
+			}},
+		}
+
+	case errors.As(err, &syntaxError), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return NewBadRequest("the body must be a JSON object").WithCode(CodeMalformedBody)
+
+	default:
+		return NewBadRequest(err.Error()).WithCode(CodeMalformedBody)
+	}
+}
+
+// NewInvalidParam is a 400 for a single invalid field, for checks done outside the validator
+func NewInvalidParam(name string, rule string, reason string) *Error {
+	return &Error{
+		Type:          BadRequest,
+		Code:          CodeValidationFailed,
+		Message:       "Bad request. Reason: some fields are invalid, see invalid_params",
+		InvalidParams: []InvalidParam{{Name: name, Reason: reason, Rule: rule}},
+	}
+}
+
+// fieldName is the field's path as the client sent it, the validator
+// reports json names once JSONTagName is registered on it
+func fieldName(fe validator.FieldError) string {
+	namespace := fe.Namespace()
+	if i := strings.Index(namespace, "."); i >= 0 {
+		return namespace[i+1:]
+	}
+	return fe.Field()
+}
+
+// validationReason is a readable reason for a failed rule, used
+// for rules the validator translations don't cover
+func validationReason(fe validator.FieldError) string {
+	isString := fe.Kind() == reflect.String
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "alphanum":
+		return "must only contain letters and digits"
+	case "min":
+		if isString {
+			return fmt.Sprintf("must be at least %s characters long", fe.Param())
+		}
+		return fmt.Sprintf("must be at least %s", fe.Param())
+	case "max":
+		if isString {
+			return fmt.Sprintf("must be at most %s characters long", fe.Param())
+		}
+		return fmt.Sprintf("must be at most %s", fe.Param())
+	case "eqfield":
+		return fmt.Sprintf("must match %s", snakeCase(fe.Param()))
+	case "oneof":
+		return fmt.Sprintf("must be one of %s", fe.Param())
+	case "gt":
+		return fmt.Sprintf("must be greater than %s", fe.Param())
+	case "uuid", "uuid4":
+		return "must be a valid UUID"
+	case "url":
+		return "must be a valid URL"
+	default:
+		return fmt.Sprintf("failed the %s rule", fe.Tag())
+	}
+}
+
+// JSONTagName makes the validator report fields by their json name,
+// register it with RegisterTagNameFunc
+func JSONTagName(field reflect.StructField) string {
+	name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+	switch name {
+	case "-":
+		return ""
+	case "":
+		return field.Name
+	}
+	return name
+}
+
+// jsonKind names the JSON type a go type is decoded from
+func jsonKind(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+// snakeCase turns a go field name such as ConfirmPassword into confirm_password
+func snakeCase(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
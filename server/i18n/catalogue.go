@@ -0,0 +1,167 @@
+package i18n
+
+// catalogue holds every message by locale. Error messages are keyed by
+// code, "<code>.title" is a short summary and "<code>.detail" explains
+// it, filled in with the error's params. Every locale must have every key
+var catalogue = map[string]map[string]string{
+	English: {
+		"invalid_request.title":           "Invalid request",
+		"invalid_request.detail":          "Bad request. Reason: {reason}",
+		"malformed_body.title":            "Malformed body",
+		"malformed_body.detail":           "The body must be a JSON object with fields of the right type.",
+		"validation_failed.title":         "Validation failed",
+		"validation_failed.detail":        "Some fields are invalid, see invalid_params.",
+		"insufficient_funds.title":        "Insufficient funds",
+		"insufficient_funds.detail":       "The balance is too low for this debit.",
+		"invalid_otp.title":               "Invalid code",
+		"invalid_otp.detail":              "The code is wrong or has expired, request a new one.",
+		"phone_not_verified.title":        "Phone not verified",
+		"phone_not_verified.detail":       "Add and verify a phone number with PUT /api/me/phone first.",
+		"unauthenticated.title":           "Authentication required",
+		"unauthenticated.detail":          "Must provide Authorization header with format `Bearer <token>`.",
+		"invalid_token.title":             "Invalid token",
+		"invalid_token.detail":            "The token is invalid, expired or revoked.",
+		"invalid_credentials.title":       "Invalid credentials",
+		"invalid_credentials.detail":      "Invalid email and password combination.",
+		"forbidden.title":                 "Forbidden",
+		"forbidden.detail":                "You are not allowed to perform this action.",
+		"password_change_required.title":  "Password change required",
+		"password_change_required.detail": "Change your password with PUT /api/me/password first.",
+		"not_found.title":                 "Not found",
+		"not_found.detail":                "No {name} found with value {value}.",
+		"route_not_found.title":           "Route not found",
+		"route_not_found.detail":          "No endpoint matches {value}.",
+		"conflict.title":                  "Already exists",
+		"conflict.detail":                 "A {name} with value {value} already exists.",
+		"email_taken.title":               "Email taken",
+		"email_taken.detail":              "An account with the email {value} already exists.",
+		"payload_too_large.title":         "Payload too large",
+		"payload_too_large.detail":        "The body is {size} bytes, the limit is {max} bytes.",
+		"unsupported_media_type.title":    "Unsupported media type",
+		"unsupported_media_type.detail":   "The request content type is not supported.",
+		"rate_limited.title":              "Too many requests",
+		"rate_limited.detail":             "Rate limit exceeded. Try again in {retry_after}.",
+		"internal_error.title":            "Internal server error",
+		"internal_error.detail":           "Something went wrong on our side, please try again later.",
+		"service_unavailable.title":       "Service unavailable",
+		"service_unavailable.detail":      "The service is unavailable or timed out, please try again later.",
+
+		"invalid_type":         "must be a {kind}",
+		"account_created":      "account created successfully",
+		"password_changed":     "password changed",
+		"locale_changed":       "language preference saved",
+		"otp_sent":             "a verification code was texted to {phone}",
+		"phone_verified":       "phone number verified",
+		"sms_alerts_on":        "SMS alerts turned on",
+		"sms_alerts_off":       "SMS alerts turned off",
+		"sms_otp":              "Your Gopay verification code is {code}. It expires in {minutes} minutes, never share it.",
+		"sms_debit_alert":      "Gopay Debit: {amount} to {counterparty}, acct {account}. Ref {reference}",
+		"sms_credit_alert":     "Gopay Credit: {amount} from {counterparty}, acct {account}. Ref {reference}",
+		"sms_account_debited":  "Gopay Debit: {amount}, acct {account}: {reason}. Ref {reference}",
+		"sms_account_credited": "Gopay Credit: {amount}, acct {account}: {reason}. Ref {reference}",
+		"sms_password_changed": "Gopay: your password was changed and every session signed out. If this wasn't you, contact support now.",
+		"notifications_read":   "{count} notifications marked read",
+		"preferences_saved":    "notification preferences saved",
+
+		"notification.account.created.title":            "Welcome to Gopay",
+		"notification.account.created.body":             "Your account was opened on {occurred_at}.",
+		"notification.account.password_changed.title":   "Password changed",
+		"notification.account.password_changed.body":    "Your password was changed on {occurred_at} and every session signed out. If this wasn't you, contact support.",
+		"notification.transfer.sent.title":              "You sent {amount}",
+		"notification.transfer.sent.body":               "{amount} to {counterparty_name}, account {counterparty_account_number}. Reference {reference}.",
+		"notification.transfer.received.title":          "You received {amount}",
+		"notification.transfer.received.body":           "{amount} from {counterparty_name}, account {counterparty_account_number}. Reference {reference}.",
+		"notification.account.credited.title":           "Your account was credited {amount}",
+		"notification.account.credited.body":            "{reason}. Your balance is {balance_after}. Reference {reference}.",
+		"notification.account.debited.title":            "Your account was debited {amount}",
+		"notification.account.debited.body":             "{reason}. Your balance is {balance_after}. Reference {reference}.",
+		"notification.scheduled_transfer.skipped.title": "A scheduled transfer was skipped",
+		"notification.scheduled_transfer.skipped.body":  "{amount} to account {to_account_number} due on {due_at} wasn't sent: {reason}. It will run again on its next date.",
+		"notification.scheduled_transfer.failed.title":  "A scheduled transfer failed",
+		"notification.scheduled_transfer.failed.body":   "{amount} to account {to_account_number} due on {due_at} failed: {reason}. It will run again on its next date.",
+		"notification.scheduled_transfer.paused.title":  "A scheduled transfer was paused",
+		"notification.scheduled_transfer.paused.body":   "{amount} to account {to_account_number} can't be sent: {reason}. Fix it then resume the schedule.",
+		"notification.webhook.disabled.title":           "Your webhook was disabled",
+		"notification.webhook.disabled.body":            "Deliveries to {url} failed {failures} times in a row. Fix the endpoint then enable it again.",
+	},
+	French: {
+		"invalid_request.title":           "Requête invalide",
+		"invalid_request.detail":          "La requête ne peut pas être traitée telle quelle.",
+		"malformed_body.title":            "Corps de requête mal formé",
+		"malformed_body.detail":           "Le corps doit être un objet JSON dont les champs ont le bon type.",
+		"validation_failed.title":         "Échec de la validation",
+		"validation_failed.detail":        "Certains champs sont invalides, voir invalid_params.",
+		"insufficient_funds.title":        "Solde insuffisant",
+		"insufficient_funds.detail":       "Le solde est trop faible pour ce débit.",
+		"invalid_otp.title":               "Code invalide",
+		"invalid_otp.detail":              "Le code est incorrect ou a expiré, demandez-en un nouveau.",
+		"phone_not_verified.title":        "Téléphone non vérifié",
+		"phone_not_verified.detail":       "Ajoutez et vérifiez d'abord un numéro avec PUT /api/me/phone.",
+		"unauthenticated.title":           "Authentification requise",
+		"unauthenticated.detail":          "L'en-tête Authorization doit être de la forme `Bearer <jeton>`.",
+		"invalid_token.title":             "Jeton invalide",
+		"invalid_token.detail":            "Le jeton est invalide, expiré ou révoqué.",
+		"invalid_credentials.title":       "Identifiants invalides",
+		"invalid_credentials.detail":      "L'adresse e-mail ou le mot de passe est incorrect.",
+		"forbidden.title":                 "Accès refusé",
+		"forbidden.detail":                "Vous n'êtes pas autorisé à effectuer cette action.",
+		"password_change_required.title":  "Changement de mot de passe requis",
+		"password_change_required.detail": "Changez d'abord votre mot de passe avec PUT /api/me/password.",
+		"not_found.title":                 "Introuvable",
+		"not_found.detail":                "Aucun résultat pour {name} avec la valeur {value}.",
+		"route_not_found.title":           "Route introuvable",
+		"route_not_found.detail":          "Aucun point d'accès ne correspond à {value}.",
+		"conflict.title":                  "Existe déjà",
+		"conflict.detail":                 "Un élément {name} avec la valeur {value} existe déjà.",
+		"email_taken.title":               "Adresse e-mail déjà utilisée",
+		"email_taken.detail":              "Un compte avec l'adresse {value} existe déjà.",
+		"payload_too_large.title":         "Requête trop volumineuse",
+		"payload_too_large.detail":        "Le corps fait {size} octets, la limite est de {max} octets.",
+		"unsupported_media_type.title":    "Type de contenu non pris en charge",
+		"unsupported_media_type.detail":   "Le type de contenu de la requête n'est pas pris en charge.",
+		"rate_limited.title":              "Trop de requêtes",
+		"rate_limited.detail":             "Limite de requêtes atteinte. Réessayez dans {retry_after}.",
+		"internal_error.title":            "Erreur interne du serveur",
+		"internal_error.detail":           "Une erreur s'est produite de notre côté, veuillez réessayer plus tard.",
+		"service_unavailable.title":       "Service indisponible",
+		"service_unavailable.detail":      "Le service est indisponible ou a expiré, veuillez réessayer plus tard.",
+
+		"invalid_type":         "doit être de type {kind}",
+		"account_created":      "compte créé avec succès",
+		"password_changed":     "mot de passe modifié",
+		"locale_changed":       "préférence de langue enregistrée",
+		"otp_sent":             "un code de vérification a été envoyé au {phone}",
+		"phone_verified":       "numéro de téléphone vérifié",
+		"sms_alerts_on":        "alertes SMS activées",
+		"sms_alerts_off":       "alertes SMS désactivées",
+		"sms_otp":              "Votre code de vérification Gopay est {code}. Il expire dans {minutes} minutes, ne le partagez jamais.",
+		"sms_debit_alert":      "Gopay Débit : {amount} vers {counterparty}, cpte {account}. Réf {reference}",
+		"sms_credit_alert":     "Gopay Crédit : {amount} de {counterparty}, cpte {account}. Réf {reference}",
+		"sms_account_debited":  "Gopay Débit : {amount}, cpte {account} : {reason}. Réf {reference}",
+		"sms_account_credited": "Gopay Crédit : {amount}, cpte {account} : {reason}. Réf {reference}",
+		"sms_password_changed": "Gopay : votre mot de passe a été modifié et toutes les sessions fermées. Si ce n'était pas vous, contactez le support.",
+		"notifications_read":   "{count} notifications marquées comme lues",
+		"preferences_saved":    "préférences de notification enregistrées",
+
+		"notification.account.created.title":            "Bienvenue sur Gopay",
+		"notification.account.created.body":             "Votre compte a été ouvert le {occurred_at}.",
+		"notification.account.password_changed.title":   "Mot de passe modifié",
+		"notification.account.password_changed.body":    "Votre mot de passe a été modifié le {occurred_at} et toutes les sessions fermées. Si ce n'était pas vous, contactez le support.",
+		"notification.transfer.sent.title":              "Vous avez envoyé {amount}",
+		"notification.transfer.sent.body":               "{amount} à {counterparty_name}, compte {counterparty_account_number}. Référence {reference}.",
+		"notification.transfer.received.title":          "Vous avez reçu {amount}",
+		"notification.transfer.received.body":           "{amount} de {counterparty_name}, compte {counterparty_account_number}. Référence {reference}.",
+		"notification.account.credited.title":           "Votre compte a été crédité de {amount}",
+		"notification.account.credited.body":            "{reason}. Votre solde est de {balance_after}. Référence {reference}.",
+		"notification.account.debited.title":            "Votre compte a été débité de {amount}",
+		"notification.account.debited.body":             "{reason}. Votre solde est de {balance_after}. Référence {reference}.",
+		"notification.scheduled_transfer.skipped.title": "Un virement programmé n'a pas été effectué",
+		"notification.scheduled_transfer.skipped.body":  "{amount} vers le compte {to_account_number} prévu le {due_at} n'a pas été envoyé : {reason}. Il sera retenté à sa prochaine date.",
+		"notification.scheduled_transfer.failed.title":  "Un virement programmé a échoué",
+		"notification.scheduled_transfer.failed.body":   "{amount} vers le compte {to_account_number} prévu le {due_at} a échoué : {reason}. Il sera retenté à sa prochaine date.",
+		"notification.scheduled_transfer.paused.title":  "Un virement programmé a été suspendu",
+		"notification.scheduled_transfer.paused.body":   "{amount} vers le compte {to_account_number} ne peut pas être envoyé : {reason}. Corrigez le problème puis reprenez le virement.",
+		"notification.webhook.disabled.title":           "Votre webhook a été désactivé",
+		"notification.webhook.disabled.body":            "Les envois vers {url} ont échoué {failures} fois de suite. Corrigez l'endpoint puis réactivez-le.",
+	},
+}
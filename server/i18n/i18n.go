@@ -0,0 +1,93 @@
+// Package i18n holds the locales the API speaks and the catalogue of
+// messages shown to users, keyed by error code or message name
+package i18n
+
+import (
+	"context"
+	"strings"
+
+	"golang.org/x/text/language"
+)
+
+// Supported locales
+const (
+	English = "en"
+	French  = "fr"
+)
+
+// Default is used when the client accepts none of the supported locales
+const Default = English
+
+// Supported lists every locale the catalogue has messages for, Default first
+var Supported = []string{English, French}
+
+// matcher picks the best supported locale for an Accept-Language header,
+// its tags must be in the same order as Supported
+var matcher = language.NewMatcher([]language.Tag{language.English, language.French})
+
+// IsSupported reports whether locale is one of Supported
+func IsSupported(locale string) bool {
+	for _, l := range Supported {
+		if l == locale {
+			return true
+		}
+	}
+	return false
+}
+
+// Negotiate returns the supported locale that best matches an
+// Accept-Language header, or Default if none do
+func Negotiate(acceptLanguage string) string {
+	tags, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err != nil || len(tags) == 0 {
+		return Default
+	}
+	_, index, confidence := matcher.Match(tags...)
+	if confidence == language.No {
+		return Default
+	}
+	return Supported[index]
+}
+
+type contextKey struct{}
+
+// WithLocale returns a copy of ctx carrying locale
+func WithLocale(ctx context.Context, locale string) context.Context {
+	return context.WithValue(ctx, contextKey{}, locale)
+}
+
+// FromContext returns the locale set with WithLocale, or Default
+func FromContext(ctx context.Context) string {
+	if locale, ok := ctx.Value(contextKey{}).(string); ok && locale != "" {
+		return locale
+	}
+	return Default
+}
+
+// Lookup returns the message for key in locale, falling back to Default.
+// Placeholders such as {value} are replaced by the matching params
+func Lookup(locale string, key string, params map[string]string) (string, bool) {
+	message, ok := catalogue[locale][key]
+	if !ok {
+		if message, ok = catalogue[Default][key]; !ok {
+			return "", false
+		}
+	}
+	if len(params) == 0 {
+		return message, true
+	}
+	pairs := make([]string, 0, len(params)*2)
+	for name, value := range params {
+		pairs = append(pairs, "{"+name+"}", value)
+	}
+	return strings.NewReplacer(pairs...).Replace(message), true
+}
+
+// T is Lookup for messages that are always in the catalogue,
+// the key itself is returned if it is missing
+func T(locale string, key string, params map[string]string) string {
+	if message, ok := Lookup(locale, key, params); ok {
+		return message
+	}
+	return key
+}
@@ -0,0 +1,63 @@
+package i18n_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Cprime50/Gopay/helper"
+	"github.com/Cprime50/Gopay/i18n"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := map[string]string{
+		"":                          i18n.English,
+		"fr":                        i18n.French,
+		"fr-CA,fr;q=0.9,en;q=0.8":   i18n.French,
+		"en-GB,en;q=0.9":            i18n.English,
+		"de-DE,de;q=0.9":            i18n.English,
+		"de;q=0.9,fr;q=0.5":         i18n.French,
+		"en;q=0.2,fr;q=0.8":         i18n.French,
+		"not a valid ;;; header = ": i18n.English,
+	}
+	for header, want := range tests {
+		if got := i18n.Negotiate(header); got != want {
+			t.Errorf("Negotiate(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
+
+func TestContext(t *testing.T) {
+	ctx := context.Background()
+	if got := i18n.FromContext(ctx); got != i18n.Default {
+		t.Errorf("got %q without a locale, want %q", got, i18n.Default)
+	}
+	if got := i18n.FromContext(i18n.WithLocale(ctx, i18n.French)); got != i18n.French {
+		t.Errorf("got %q, want %q", got, i18n.French)
+	}
+}
+
+// every error code needs a title and detail in every locale
+func TestCatalogueCoversEveryCode(t *testing.T) {
+	for _, locale := range i18n.Supported {
+		for _, code := range helper.Codes {
+			for _, key := range []string{string(code) + ".title", string(code) + ".detail"} {
+				if _, ok := i18n.Lookup(locale, key, nil); !ok {
+					t.Errorf("%s: missing %s", locale, key)
+				}
+			}
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	got := i18n.T(i18n.French, "email_taken.detail", map[string]string{"value": "john@mail.com"})
+	if want := "Un compte avec l'adresse john@mail.com existe déjà."; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got := i18n.T("de", "password_changed", nil); got != "password changed" {
+		t.Errorf("unsupported locales should fall back to English, got %q", got)
+	}
+	if got := i18n.T(i18n.French, "no_such_key", nil); got != "no_such_key" {
+		t.Errorf("got %q for a missing key", got)
+	}
+}
@@ -0,0 +1,243 @@
+package metrics
+
+import (
+	"database/sql"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "gopay"
+
+// Registry holds every gopay collector. A dedicated registry is used
+// rather than the global default so nothing is exported by accident
+var Registry = prometheus.NewRegistry()
+
+var factory = promauto.With(Registry)
+
+// HTTP metrics
+var (
+	httpRequests = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Number of HTTP requests by route, method and status.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route, method and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+)
+
+// Domain metrics
+var (
+	// Signups counts accounts created through the api
+	Signups = factory.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "signups_total",
+		Help:      "Number of accounts created.",
+	})
+
+	// Logins counts sign in attempts by result (success, failure)
+	Logins = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "logins_total",
+		Help:      "Number of sign in attempts by result.",
+	}, []string{"result"})
+
+	// TokensIssued counts tokens issued by type (id, refresh)
+	TokensIssued = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tokens_issued_total",
+		Help:      "Number of tokens issued by type.",
+	}, []string{"type"})
+
+	transfers = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "transfers_total",
+		Help:      "Number of transfers by status.",
+	}, []string{"status"})
+
+	jobs = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "jobs_processed_total",
+		Help:      "Number of background job attempts by queue, type and outcome.",
+	}, []string{"queue", "type", "outcome"})
+
+	jobDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "job_duration_seconds",
+		Help:      "Background job run time by queue and type.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"queue", "type"})
+
+	events = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "events_relayed_total",
+		Help:      "Number of outbox events relayed by type and outcome.",
+	}, []string{"type", "outcome"})
+
+	transferAmount = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "transfer_amount",
+		Help:      "Amount moved per transfer by status.",
+		Buckets:   []float64{100, 500, 1000, 5000, 10000, 50000, 100000, 500000, 1000000},
+	}, []string{"status"})
+
+	texts = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "sms_total",
+		Help:      "Number of texts by kind and outcome.",
+	}, []string{"kind", "outcome"})
+
+	// Streams is the number of realtime update streams open on this instance
+	Streams = factory.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "realtime_streams",
+		Help:      "Number of open realtime update streams.",
+	})
+)
+
+// Login results
+const (
+	LoginSuccess = "success"
+	LoginFailure = "failure"
+)
+
+// Token types
+const (
+	IDToken      = "id"
+	RefreshToken = "refresh"
+)
+
+// Outbox event outcomes
+const (
+	EventPublished = "published"
+	EventRetried   = "retried"
+)
+
+// SMS outcomes
+const (
+	SMSSent      = "sent"
+	SMSFailed    = "failed"
+	SMSThrottled = "throttled"
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{Namespace: namespace}),
+	)
+}
+
+// ObserveTransfer records a transfer and the amount moved.
+// status is eg "completed" or "failed"
+func ObserveTransfer(status string, amount float64) {
+	transfers.WithLabelValues(status).Inc()
+	transferAmount.WithLabelValues(status).Observe(amount)
+}
+
+// ObserveJob records a background job attempt and how long it ran.
+// outcome is eg "completed", "retried" or "dead"
+func ObserveJob(queue string, jobType string, outcome string, duration time.Duration) {
+	jobs.WithLabelValues(queue, jobType, outcome).Inc()
+	jobDuration.WithLabelValues(queue, jobType).Observe(duration.Seconds())
+}
+
+// ObserveEvent records an attempt at relaying an outbox event.
+// outcome is EventPublished or EventRetried
+func ObserveEvent(eventType string, outcome string) {
+	events.WithLabelValues(eventType, outcome).Inc()
+}
+
+// ObserveSMS records a text being sent or not. kind is eg "otp" or "alert"
+func ObserveSMS(kind string, outcome string) {
+	texts.WithLabelValues(kind, outcome).Inc()
+}
+
+// RegisterDataSources exports connection pool stats for postgres and redis
+func RegisterDataSources(sqlDB *sql.DB, rdb *redis.Client) error {
+	if err := Registry.Register(collectors.NewDBStatsCollector(sqlDB, "gopay")); err != nil {
+		return err
+	}
+	return Registry.Register(newRedisCollector(rdb))
+}
+
+// Middleware records the count and latency of every request.
+// Routes are labelled by their pattern, eg /api/accounts/:id, to keep cardinality bounded
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		status := strconv.Itoa(c.Writer.Status())
+		httpRequests.WithLabelValues(c.Request.Method, route, status).Inc()
+		httpDuration.WithLabelValues(c.Request.Method, route, status).Observe(time.Since(start).Seconds())
+	}
+}
+
+// Handler serves the registry in the prometheus exposition format
+func Handler() gin.HandlerFunc {
+	h := promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+	return func(c *gin.Context) {
+		h.ServeHTTP(c.Writer, c.Request)
+	}
+}
+
+// redisCollector exports the go-redis connection pool stats
+type redisCollector struct {
+	client *redis.Client
+
+	hits       *prometheus.Desc
+	misses     *prometheus.Desc
+	timeouts   *prometheus.Desc
+	totalConns *prometheus.Desc
+	idleConns  *prometheus.Desc
+	staleConns *prometheus.Desc
+}
+
+func newRedisCollector(client *redis.Client) *redisCollector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "redis_pool", name), help, nil, nil)
+	}
+	return &redisCollector{
+		client:     client,
+		hits:       desc("hits_total", "Number of times a free connection was found in the pool."),
+		misses:     desc("misses_total", "Number of times a free connection was not found in the pool."),
+		timeouts:   desc("timeouts_total", "Number of times a wait for a connection timed out."),
+		totalConns: desc("total_connections", "Number of connections in the pool."),
+		idleConns:  desc("idle_connections", "Number of idle connections in the pool."),
+		staleConns: desc("stale_connections_total", "Number of stale connections removed from the pool."),
+	}
+}
+
+func (r *redisCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- r.hits
+	ch <- r.misses
+	ch <- r.timeouts
+	ch <- r.totalConns
+	ch <- r.idleConns
+	ch <- r.staleConns
+}
+
+func (r *redisCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := r.client.PoolStats()
+	ch <- prometheus.MustNewConstMetric(r.hits, prometheus.CounterValue, float64(stats.Hits))
+	ch <- prometheus.MustNewConstMetric(r.misses, prometheus.CounterValue, float64(stats.Misses))
+	ch <- prometheus.MustNewConstMetric(r.timeouts, prometheus.CounterValue, float64(stats.Timeouts))
+	ch <- prometheus.MustNewConstMetric(r.totalConns, prometheus.GaugeValue, float64(stats.TotalConns))
+	ch <- prometheus.MustNewConstMetric(r.idleConns, prometheus.GaugeValue, float64(stats.IdleConns))
+	ch <- prometheus.MustNewConstMetric(r.staleConns, prometheus.CounterValue, float64(stats.StaleConns))
+}
@@ -1,11 +1,11 @@
 package middleware
 
 import (
-	"fmt"
-	"net/http"
+	"context"
 	"strings"
 
 	"github.com/Cprime50/Gopay/helper"
+	models "github.com/Cprime50/Gopay/models/account"
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
 )
@@ -22,66 +22,81 @@ type invalidArgument struct {
 	Param string `json:"param"`
 }
 
+// TokenValidator validates id tokens, it is implemented by service.TokenService
+type TokenValidator interface {
+	ValidateJWT(ctx context.Context, tokenString string) (*models.Account, error)
+	ValidateAdminJWT(ctx context.Context, tokenString string) (*models.Account, error)
+}
+
 // AuthUser extracts a user from the Authorization header
 // which is of the form "Bearer token"
 // It sets the user to the context if the user exists
-func AuthUser() gin.HandlerFunc {
+func AuthUser(tokens TokenValidator) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		token, err := extractTokenFromHeader(c)
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
-			c.Abort()
+			Abort(c, err)
 			return
 		}
 		// validate token here
-		account, err := ValidateJWT(token)
+		account, err := tokens.ValidateJWT(c.Request.Context(), token)
 
 		if err != nil {
-			err := helper.NewAuthorization("Provided token is invalid")
-			c.JSON(err.Status(), gin.H{
-				"error": err,
-			})
-			c.Abort()
+			Abort(c, helper.NewAuthorization("Provided token is invalid").WithCode(helper.CodeInvalidToken))
 			return
 		}
 
 		c.Set("account", account)
+		setAccountLogger(c, account.ID.String())
+		setAccountLocale(c, account)
 
 		c.Next()
 	}
 }
 
 // JWTAuthAdminMiddleware is a middleware function that checks for both regular authentication and admin privileges.
-func AuthAdmin() gin.HandlerFunc {
+func AuthAdmin(tokens TokenValidator) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Extract token from Authorization header
 		token, err := extractTokenFromHeader(c)
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
-			c.Abort()
+			Abort(c, err)
 			return
 		}
 
 		// Validate token for regular user authentication
-		account, err := ValidateJWT(token)
+		account, err := tokens.ValidateJWT(c.Request.Context(), token)
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
-			c.Abort()
+			Abort(c, helper.NewAuthorization("Provided token is invalid").WithCode(helper.CodeInvalidToken))
 			return
 		}
 
-		// Validate admin role
-		accountAdmin, _err := ValidateAdminJWT(token)
+		// Validate admin role, the token is valid so this is a 403 not a 401
+		accountAdmin, _err := tokens.ValidateAdminJWT(c.Request.Context(), token)
 		if _err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Only Administrator is allowed to perform this action"})
-			c.Abort()
+			Abort(c, helper.NewForbidden("Only Administrator is allowed to perform this action"))
 			return
 		}
 
 		// Set account information to the context
 		c.Set("account", account)
 		c.Set("accountAdmin", accountAdmin)
+		setAccountLogger(c, account.ID.String())
+		setAccountLocale(c, account)
+
+		c.Next()
+	}
+}
 
+// PasswordChanged stops accounts that must change their password, such as
+// the bootstrap admin, from doing anything else. It runs after AuthUser or AuthAdmin
+func PasswordChanged() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value, _ := c.Get("account")
+		if account, ok := value.(*models.Account); ok && account.MustChangePassword {
+			Abort(c, helper.NewForbidden("Password change required, use PUT /api/me/password").WithCode(helper.CodePasswordChangeRequired))
+			return
+		}
 		c.Next()
 	}
 }
@@ -105,14 +120,14 @@ func extractTokenFromHeader(c *gin.Context) (string, error) {
 				})
 			}
 			err := helper.NewBadRequest("Invalid request parameters. See invalidArgs")
-			fmt.Println("invalid request param for auth header", err)
+			// only log the tags, the values hold the raw token
+			helper.Logger(c.Request.Context()).Warn("invalid request param for auth header", "invalid_args", len(invalidArgs), "tag", errs[0].Tag())
 			return "", err
 		}
 
 		// otherwise error type is unknown
-		err := helper.NewInternal()
-		fmt.Println("error", err)
-		return "", err
+		helper.Logger(c.Request.Context()).Error("unable to bind auth header", "error", err)
+		return "", helper.NewInternal()
 	}
 
 	tokenHeader := strings.Split(h.Token, "Bearer ")
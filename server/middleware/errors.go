@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/Cprime50/Gopay/helper"
+	"github.com/Cprime50/Gopay/i18n"
+	"github.com/gin-gonic/gin"
+)
+
+// Errors renders the error a handler or middleware added with Abort as
+// RFC 7807 problem+json in the request's locale. It must be registered
+// after RequestID so the body carries the request ID, and before
+// anything that can fail
+func Errors() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if len(c.Errors) == 0 || c.Writer.Written() {
+			return
+		}
+		err := c.Errors.Last().Err
+
+		ctx := c.Request.Context()
+		if helper.Status(err) >= http.StatusInternalServerError {
+			helper.Logger(ctx).Error("request failed", "error", err)
+		}
+
+		problem := helper.NewProblem(err, c.Request.URL.Path, RequestIDFromContext(ctx), i18n.FromContext(ctx))
+		c.Header("Content-Type", helper.ProblemContentType)
+		c.JSON(problem.Status, problem)
+	}
+}
+
+// Recovery turns panics into a 500 problem, rendered by Errors
+func Recovery() gin.HandlerFunc {
+	return gin.CustomRecovery(func(c *gin.Context, recovered any) {
+		helper.Logger(c.Request.Context()).Error("panic serving request", "panic", recovered)
+		Abort(c, helper.NewInternal())
+	})
+}
+
+// Abort stops the request with err, which Errors renders as the response
+func Abort(c *gin.Context, err error) {
+	_ = c.Error(err)
+	c.Abort()
+}
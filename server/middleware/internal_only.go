@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net"
+	"strings"
+
+	"github.com/Cprime50/Gopay/helper"
+	"github.com/gin-gonic/gin"
+)
+
+// InternalOnly guards operational endpoints such as /metrics.
+// If token is set the caller must present it as a bearer token,
+// otherwise only loopback and private network addresses are let through.
+// The address is the peer's unless it's one of the engine's trusted proxies
+func InternalOnly(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token != "" {
+			provided := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(provided), []byte(token)) == 1 {
+				c.Next()
+				return
+			}
+		} else if ip := net.ParseIP(c.ClientIP()); ip != nil && (ip.IsLoopback() || ip.IsPrivate()) {
+			c.Next()
+			return
+		}
+
+		Abort(c, helper.NewNotFound("route", c.Request.URL.Path).WithCode(helper.CodeRouteNotFound))
+	}
+}
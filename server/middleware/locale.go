@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"github.com/Cprime50/Gopay/i18n"
+	models "github.com/Cprime50/Gopay/models/account"
+	"github.com/gin-gonic/gin"
+)
+
+// AcceptLanguageHeader is the header clients pick a locale with
+const AcceptLanguageHeader = "Accept-Language"
+
+// Locale negotiates the response locale from the Accept-Language header
+// and stores it in the request context, see i18n.FromContext
+func Locale() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Vary", AcceptLanguageHeader)
+		setLocale(c, i18n.Negotiate(c.GetHeader(AcceptLanguageHeader)))
+		c.Next()
+	}
+}
+
+// setAccountLocale uses the signed in account's preferred locale
+// unless the client asked for one with Accept-Language
+func setAccountLocale(c *gin.Context, account *models.Account) {
+	if c.GetHeader(AcceptLanguageHeader) != "" || !i18n.IsSupported(account.Locale) {
+		return
+	}
+	setLocale(c, account.Locale)
+}
+
+func setLocale(c *gin.Context, locale string) {
+	c.Header("Content-Language", locale)
+	c.Request = c.Request.WithContext(i18n.WithLocale(c.Request.Context(), locale))
+}
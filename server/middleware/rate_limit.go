@@ -0,0 +1,135 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/Cprime50/Gopay/helper"
+	models "github.com/Cprime50/Gopay/models/account"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+// RateLimitKeyFunc returns the identity a request is counted against,
+// eg the client IP, the authenticated account or an API key
+type RateLimitKeyFunc func(c *gin.Context) string
+
+// RateLimitPolicy describes how many requests a caller may make
+// within a sliding window. Name is used to namespace the counters
+// in redis so different route groups don't share a budget
+type RateLimitPolicy struct {
+	Name   string
+	Limit  int64
+	Window time.Duration
+	Key    RateLimitKeyFunc
+}
+
+// slidingWindowScript keeps one sorted set per caller holding the
+// timestamps (ms) of the requests made in the current window.
+// It returns {allowed, remaining, reset in ms}
+var slidingWindowScript = redis.NewScript(`
+local key = KEYS[1]
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+local member = ARGV[4]
+
+redis.call('ZREMRANGEBYSCORE', key, 0, now - window)
+local count = redis.call('ZCARD', key)
+local allowed = 0
+if count < limit then
+	redis.call('ZADD', key, now, member)
+	redis.call('PEXPIRE', key, window)
+	count = count + 1
+	allowed = 1
+end
+
+local reset = window
+local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+if oldest[2] then
+	reset = window - (now - tonumber(oldest[2]))
+end
+
+return {allowed, limit - count, reset}
+`)
+
+// KeyByIP counts requests against the client IP
+func KeyByIP(c *gin.Context) string {
+	return "ip:" + c.ClientIP()
+}
+
+// KeyByAccount counts requests against the authenticated account,
+// falling back to the client IP for anonymous requests
+func KeyByAccount(c *gin.Context) string {
+	if account, exists := c.Get("account"); exists {
+		if acct, ok := account.(*models.Account); ok && acct.ID != uuid.Nil {
+			return "account:" + acct.ID.String()
+		}
+	}
+	return KeyByIP(c)
+}
+
+// KeyByAPIKey counts requests against the X-API-Key header.
+// The key is hashed so raw keys never end up in redis
+func KeyByAPIKey(c *gin.Context) string {
+	apiKey := c.GetHeader("X-API-Key")
+	if apiKey == "" {
+		return KeyByAccount(c)
+	}
+	sum := sha256.Sum256([]byte(apiKey))
+	return "apikey:" + hex.EncodeToString(sum[:])
+}
+
+// RateLimiter builds rate limiting middleware backed by redis
+type RateLimiter struct {
+	redis *redis.Client
+}
+
+// NewRateLimiter returns a RateLimiter keeping its counters in redis
+func NewRateLimiter(redis *redis.Client) *RateLimiter {
+	return &RateLimiter{redis: redis}
+}
+
+// RateLimit enforces policy using a sliding window stored in redis.
+// It sets the RateLimit-* headers on every response and Retry-After
+// when the caller has exhausted their budget.
+// If redis is unavailable requests are let through rather than
+// taking the whole api down with it
+func (l *RateLimiter) RateLimit(policy RateLimitPolicy) gin.HandlerFunc {
+	if policy.Key == nil {
+		policy.Key = KeyByIP
+	}
+	window := policy.Window.Milliseconds()
+
+	return func(c *gin.Context) {
+		key := fmt.Sprintf("ratelimit:%s:%s", policy.Name, policy.Key(c))
+		now := time.Now().UnixMilli()
+		member := fmt.Sprintf("%d-%s", now, uuid.NewString())
+
+		res, err := slidingWindowScript.Run(c.Request.Context(), l.redis, []string{key}, now, window, policy.Limit, member).Int64Slice()
+		if err != nil || len(res) != 3 {
+			helper.Logger(c.Request.Context()).Warn("rate limiter unavailable", "policy", policy.Name, "error", err)
+			c.Next()
+			return
+		}
+		allowed, remaining, reset := res[0] == 1, res[1], time.Duration(res[2])*time.Millisecond
+		resetSeconds := strconv.FormatInt(int64(math.Ceil(reset.Seconds())), 10)
+
+		c.Header("RateLimit-Limit", strconv.FormatInt(policy.Limit, 10))
+		c.Header("RateLimit-Remaining", strconv.FormatInt(remaining, 10))
+		c.Header("RateLimit-Reset", resetSeconds)
+
+		if !allowed {
+			c.Header("Retry-After", resetSeconds)
+			Abort(c, helper.NewTooManyRequests(reset))
+			return
+		}
+
+		c.Next()
+	}
+}
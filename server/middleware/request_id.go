@@ -0,0 +1,90 @@
+package middleware
+
+import (
+	"context"
+	"regexp"
+	"time"
+
+	"github.com/Cprime50/Gopay/helper"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RequestIDHeader is the header used to propagate request IDs
+const RequestIDHeader = "X-Request-ID"
+
+type requestIDKey struct{}
+
+// incoming request IDs are only trusted if they look sane,
+// so callers can't inject arbitrary data into our logs
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+// RequestID assigns every request an ID, reusing the caller's
+// X-Request-ID header when present, echoes it back in the response
+// and stores a logger carrying it in the request context
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(RequestIDHeader)
+		if !validRequestID.MatchString(requestID) {
+			requestID = uuid.NewString()
+		}
+		c.Header(RequestIDHeader, requestID)
+		c.Set("requestID", requestID)
+
+		ctx := context.WithValue(c.Request.Context(), requestIDKey{}, requestID)
+		logger := helper.Logger(ctx).With("request_id", requestID)
+		// correlate logs with the trace started by the tracing middleware
+		if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+			logger = logger.With("trace_id", sc.TraceID().String())
+		}
+		c.Request = c.Request.WithContext(helper.ContextWithLogger(ctx, logger))
+
+		c.Next()
+	}
+}
+
+// RequestIDFromContext returns the ID assigned to the request by RequestID
+func RequestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+// RequestLogger writes one structured access log line per request.
+// It must be registered after RequestID so the line carries the request ID
+func RequestLogger() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		logger := helper.Logger(c.Request.Context())
+		attrs := []any{
+			"method", c.Request.Method,
+			"route", c.FullPath(),
+			"path", c.Request.URL.Path,
+			"status", c.Writer.Status(),
+			"duration_ms", time.Since(start).Milliseconds(),
+			"client_ip", c.ClientIP(),
+			"bytes", c.Writer.Size(),
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, "errors", c.Errors.String())
+		}
+
+		switch status := c.Writer.Status(); {
+		case status >= 500:
+			logger.Error("request completed", attrs...)
+		case status >= 400:
+			logger.Warn("request completed", attrs...)
+		default:
+			logger.Info("request completed", attrs...)
+		}
+	}
+}
+
+// setAccountLogger adds the authenticated account ID to the request logger
+func setAccountLogger(c *gin.Context, accountID string) {
+	ctx := c.Request.Context()
+	logger := helper.Logger(ctx).With("account_id", accountID)
+	c.Request = c.Request.WithContext(helper.ContextWithLogger(ctx, logger))
+}
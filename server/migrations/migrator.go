@@ -0,0 +1,437 @@
+package migrations
+
+import (
+	"context"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// files holds the migrations compiled into the binary
+//
+//go:embed sql/*.sql
+var files embed.FS
+
+// Dir is where migration files live relative to the server module,
+// new ones are created here by `gopay migrate create`
+const Dir = "migrations/sql"
+
+// lockID is the postgres advisory lock held while migrating so two
+// instances starting at once don't both apply the same migration
+const lockID = 7_061_736_179
+
+// ErrDirty is returned when a previous migration failed half way,
+// the schema has to be fixed by hand and the version forced
+var ErrDirty = errors.New("database schema is dirty")
+
+// fileName matches eg 0002_add_transactions.up.sql
+var fileName = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// Migration is one versioned change to the schema
+type Migration struct {
+	Version  int64
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+// String is the migration's file name without the direction, eg 0001_init
+func (m Migration) String() string {
+	return fmt.Sprintf("%04d_%s", m.Version, m.Name)
+}
+
+// schemaMigration is a row of the schema_migrations table,
+// one per applied migration
+type schemaMigration struct {
+	Version   int64 `gorm:"primaryKey;autoIncrement:false"`
+	Name      string
+	Checksum  string
+	Dirty     bool
+	AppliedAt time.Time
+}
+
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// createSchemaMigrations takes the timestamp type, TIMESTAMPTZ on postgres.
+// SQLite drivers only parse columns declared as TIMESTAMP into time.Time
+const createSchemaMigrations = `CREATE TABLE IF NOT EXISTS schema_migrations (
+    version    BIGINT PRIMARY KEY,
+    name       VARCHAR(255) NOT NULL,
+    checksum   VARCHAR(64) NOT NULL,
+    dirty      BOOLEAN NOT NULL DEFAULT FALSE,
+    applied_at %s NOT NULL
+)`
+
+// Status describes a migration and whether it has been applied
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+	Dirty     bool
+	// Modified is set when the file changed since it was applied
+	Modified bool
+	// Missing is set when the database has a version this build doesn't know
+	Missing bool
+}
+
+// Migrator applies and rolls back migrations, tracking
+// them in the schema_migrations table
+type Migrator struct {
+	db         *gorm.DB
+	migrations []Migration
+}
+
+// New returns a Migrator for the migrations embedded in the binary
+func New(db *gorm.DB) (*Migrator, error) {
+	sqlFiles, err := fs.Sub(files, "sql")
+	if err != nil {
+		return nil, err
+	}
+	return NewFromFS(db, sqlFiles)
+}
+
+// NewFromFS returns a Migrator for the migration files at the root of fsys.
+// Every version needs both an up and a down file
+func NewFromFS(db *gorm.DB, fsys fs.FS) (*Migrator, error) {
+	migrations, err := load(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// load reads and pairs up the migration files in fsys, sorted by version
+func load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("error reading migrations: %w", err)
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		match := fileName.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+		version, _ := strconv.ParseInt(match[1], 10, 64)
+		body, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("error reading migration %s: %w", entry.Name(), err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migration version %d used by both %s and %s", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %s needs both an up and a down file", m)
+		}
+		sum := sha256.Sum256([]byte(m.Up))
+		m.Checksum = hex.EncodeToString(sum[:])
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Up applies pending migrations oldest first, at most steps of them
+// or all if steps is 0. It returns the migrations applied
+func (m *Migrator) Up(ctx context.Context, steps int) ([]Migration, error) {
+	var done []Migration
+	err := m.locked(ctx, func(db *gorm.DB) error {
+		applied, err := m.applied(db)
+		if err != nil {
+			return err
+		}
+		if err := checkClean(applied); err != nil {
+			return err
+		}
+		for _, migration := range m.migrations {
+			if steps > 0 && len(done) == steps {
+				break
+			}
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+			if err := m.run(db, migration, true); err != nil {
+				return err
+			}
+			done = append(done, migration)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down rolls back applied migrations newest first, at most steps
+// of them or all if steps is 0. It returns the migrations rolled back
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var done []Migration
+	err := m.locked(ctx, func(db *gorm.DB) error {
+		applied, err := m.applied(db)
+		if err != nil {
+			return err
+		}
+		if err := checkClean(applied); err != nil {
+			return err
+		}
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			if steps > 0 && len(done) == steps {
+				break
+			}
+			migration := m.migrations[i]
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+			if err := m.run(db, migration, false); err != nil {
+				return err
+			}
+			done = append(done, migration)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Force marks version as cleanly applied, used once a failed
+// migration has been fixed or finished by hand
+func (m *Migrator) Force(ctx context.Context, version int64) error {
+	migration, ok := m.find(version)
+	if !ok {
+		return fmt.Errorf("unknown migration version %d", version)
+	}
+	return m.locked(ctx, func(db *gorm.DB) error {
+		return db.Clauses(clause.OnConflict{UpdateAll: true}).Create(&schemaMigration{
+			Version:   migration.Version,
+			Name:      migration.Name,
+			Checksum:  migration.Checksum,
+			AppliedAt: time.Now().UTC(),
+		}).Error
+	})
+}
+
+// Status reports every known migration plus any applied
+// version missing from this build, ordered by version
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	db := m.db.WithContext(ctx)
+	applied := map[int64]schemaMigration{}
+	if db.Migrator().HasTable(&schemaMigration{}) {
+		var err error
+		if applied, err = m.applied(db); err != nil {
+			return nil, err
+		}
+	}
+
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := Status{Migration: migration}
+		if row, ok := applied[migration.Version]; ok {
+			status.Applied = true
+			status.AppliedAt = row.AppliedAt
+			status.Dirty = row.Dirty
+			status.Modified = row.Checksum != migration.Checksum
+			delete(applied, migration.Version)
+		}
+		statuses = append(statuses, status)
+	}
+	for _, row := range applied {
+		statuses = append(statuses, Status{
+			Migration: Migration{Version: row.Version, Name: row.Name, Checksum: row.Checksum},
+			Applied:   true,
+			AppliedAt: row.AppliedAt,
+			Dirty:     row.Dirty,
+			Missing:   true,
+		})
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	return statuses, nil
+}
+
+// Check returns an error unless every migration has been applied cleanly
+// and unchanged, the server refuses to start on any of these
+func (m *Migrator) Check(ctx context.Context) error {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	pending := 0
+	for _, status := range statuses {
+		switch {
+		case status.Dirty:
+			errs = append(errs, fmt.Errorf("%w: migration %s failed, fix it by hand then run `gopay migrate force %d`", ErrDirty, status.Migration, status.Version))
+		case status.Missing:
+			errs = append(errs, fmt.Errorf("migration %s is applied but unknown to this build, the database is newer than the code", status.Migration))
+		case status.Modified:
+			errs = append(errs, fmt.Errorf("migration %s was modified after being applied", status.Migration))
+		case !status.Applied:
+			pending++
+		}
+	}
+	if pending > 0 {
+		errs = append(errs, fmt.Errorf("%d pending migrations, run `gopay migrate up`", pending))
+	}
+	return errors.Join(errs...)
+}
+
+// run applies or rolls back a single migration. The row is marked dirty
+// first so a failure part way through is noticed on the next start
+func (m *Migrator) run(db *gorm.DB, migration Migration, up bool) error {
+	direction, body := "up", migration.Up
+	if !up {
+		direction, body = "down", migration.Down
+	}
+	slog.Info("running migration", "migration", migration.String(), "direction", direction)
+	start := time.Now()
+
+	row := schemaMigration{
+		Version:   migration.Version,
+		Name:      migration.Name,
+		Checksum:  migration.Checksum,
+		Dirty:     true,
+		AppliedAt: time.Now().UTC(),
+	}
+	if err := db.Clauses(clause.OnConflict{UpdateAll: true}).Create(&row).Error; err != nil {
+		return fmt.Errorf("error marking migration %s dirty: %w", migration, err)
+	}
+
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		return tx.Exec(body).Error
+	}); err != nil {
+		return fmt.Errorf("migration %s %s failed, schema marked dirty: %w", migration, direction, err)
+	}
+
+	var err error
+	if up {
+		err = db.Model(&row).Update("dirty", false).Error
+	} else {
+		err = db.Delete(&row).Error
+	}
+	if err != nil {
+		return fmt.Errorf("error recording migration %s: %w", migration, err)
+	}
+
+	slog.Info("migration complete", "migration", migration.String(), "direction", direction, "elapsed", time.Since(start).String())
+	return nil
+}
+
+// applied returns the rows of schema_migrations keyed by version
+func (m *Migrator) applied(db *gorm.DB) (map[int64]schemaMigration, error) {
+	var rows []schemaMigration
+	if err := db.Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("error reading schema_migrations: %w", err)
+	}
+	applied := make(map[int64]schemaMigration, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+	return applied, nil
+}
+
+// checkClean refuses to migrate further from a dirty schema
+func checkClean(applied map[int64]schemaMigration) error {
+	for _, row := range applied {
+		if row.Dirty {
+			return fmt.Errorf("%w: migration %04d_%s failed, fix it by hand then run `gopay migrate force %d`", ErrDirty, row.Version, row.Name, row.Version)
+		}
+	}
+	return nil
+}
+
+// locked creates schema_migrations and runs fn. On postgres an
+// advisory lock is held on a dedicated connection while fn runs
+func (m *Migrator) locked(ctx context.Context, fn func(db *gorm.DB) error) error {
+	db := m.db.WithContext(ctx)
+	timestamp := "TIMESTAMPTZ"
+	if db.Dialector.Name() != "postgres" {
+		timestamp = "TIMESTAMP"
+	}
+	run := func() error {
+		if err := db.Exec(fmt.Sprintf(createSchemaMigrations, timestamp)).Error; err != nil {
+			return fmt.Errorf("error creating schema_migrations: %w", err)
+		}
+		return fn(db)
+	}
+	if db.Dialector.Name() != "postgres" {
+		return run()
+	}
+
+	return db.Connection(func(conn *gorm.DB) error {
+		if err := conn.Exec("SELECT pg_advisory_lock(?)", lockID).Error; err != nil {
+			return fmt.Errorf("error acquiring migration lock: %w", err)
+		}
+		defer conn.Exec("SELECT pg_advisory_unlock(?)", lockID)
+		return run()
+	})
+}
+
+func (m *Migrator) find(version int64) (Migration, bool) {
+	for _, migration := range m.migrations {
+		if migration.Version == version {
+			return migration, true
+		}
+	}
+	return Migration{}, false
+}
+
+// Create writes empty up and down files for a new migration in dir,
+// numbered after the latest one there, and returns their paths
+func Create(dir string, name string) (string, string, error) {
+	name = strings.Trim(regexp.MustCompile(`[^a-z0-9]+`).ReplaceAllString(strings.ToLower(name), "_"), "_")
+	if name == "" {
+		return "", "", fmt.Errorf("migration name must contain letters or digits")
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", "", err
+	}
+	existing, err := load(os.DirFS(dir))
+	if err != nil {
+		return "", "", err
+	}
+	version := int64(1)
+	if len(existing) > 0 {
+		version = existing[len(existing)-1].Version + 1
+	}
+
+	base := filepath.Join(dir, fmt.Sprintf("%04d_%s", version, name))
+	up, down := base+".up.sql", base+".down.sql"
+	if err := os.WriteFile(up, []byte(fmt.Sprintf("-- %04d_%s up\n", version, name)), 0o644); err != nil {
+		return "", "", err
+	}
+	if err := os.WriteFile(down, []byte(fmt.Sprintf("-- %04d_%s down, undo everything the up file does\n", version, name)), 0o644); err != nil {
+		return "", "", err
+	}
+	return up, down, nil
+}
@@ -0,0 +1,146 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"github.com/Cprime50/Gopay/db"
+	"gorm.io/gorm"
+)
+
+func openSQLite(t *testing.T) *gorm.DB {
+	t.Helper()
+	gormDB, err := db.OpenSQLite(":memory:")
+	if err != nil {
+		t.Fatalf("opening sqlite: %v", err)
+	}
+	return gormDB
+}
+
+func TestEmbeddedMigrationsUpAndDown(t *testing.T) {
+	ctx := context.Background()
+	gormDB := openSQLite(t)
+	migrator, err := New(gormDB)
+	if err != nil {
+		t.Fatalf("loading migrations: %v", err)
+	}
+
+	if err := migrator.Check(ctx); err == nil {
+		t.Fatal("check passed on an empty database")
+	}
+
+	applied, err := migrator.Up(ctx, 0)
+	if err != nil {
+		t.Fatalf("up: %v", err)
+	}
+	if len(applied) == 0 {
+		t.Fatal("up applied nothing")
+	}
+	if err := migrator.Check(ctx); err != nil {
+		t.Fatalf("check after up: %v", err)
+	}
+	if again, err := migrator.Up(ctx, 0); err != nil || len(again) != 0 {
+		t.Fatalf("second up: applied %v, err %v", again, err)
+	}
+
+	var roles int64
+	if err := gormDB.Table("role").Count(&roles).Error; err != nil || roles != 2 {
+		t.Fatalf("expected the 2 seeded roles, got %d, err %v", roles, err)
+	}
+
+	rolledBack, err := migrator.Down(ctx, 0)
+	if err != nil {
+		t.Fatalf("down: %v", err)
+	}
+	if len(rolledBack) != len(applied) {
+		t.Fatalf("down rolled back %d of %d migrations", len(rolledBack), len(applied))
+	}
+	if gormDB.Migrator().HasTable("account") {
+		t.Fatal("account table still exists after rolling everything back")
+	}
+}
+
+func TestStepsDirtyAndModified(t *testing.T) {
+	ctx := context.Background()
+	gormDB := openSQLite(t)
+	files := fstest.MapFS{
+		"0001_one.up.sql":      {Data: []byte("CREATE TABLE one (id INTEGER);")},
+		"0001_one.down.sql":    {Data: []byte("DROP TABLE one;")},
+		"0002_two.up.sql":      {Data: []byte("CREATE TABLE two (id INTEGER);")},
+		"0002_two.down.sql":    {Data: []byte("DROP TABLE two;")},
+		"0003_broken.up.sql":   {Data: []byte("CREATE TABLE three (id INTEGER); NOT SQL;")},
+		"0003_broken.down.sql": {Data: []byte("DROP TABLE IF EXISTS three;")},
+	}
+	migrator, err := NewFromFS(gormDB, files)
+	if err != nil {
+		t.Fatalf("loading migrations: %v", err)
+	}
+
+	if applied, err := migrator.Up(ctx, 1); err != nil || len(applied) != 1 {
+		t.Fatalf("up one step: applied %v, err %v", applied, err)
+	}
+	if !gormDB.Migrator().HasTable("one") || gormDB.Migrator().HasTable("two") {
+		t.Fatal("up one step applied the wrong migrations")
+	}
+
+	if _, err := migrator.Up(ctx, 0); err == nil {
+		t.Fatal("expected the broken migration to fail")
+	}
+	if gormDB.Migrator().HasTable("three") {
+		t.Fatal("broken migration was not rolled back")
+	}
+	if err := migrator.Check(ctx); !errors.Is(err, ErrDirty) {
+		t.Fatalf("check: got %v, want dirty", err)
+	}
+	if _, err := migrator.Down(ctx, 1); !errors.Is(err, ErrDirty) {
+		t.Fatalf("down on a dirty schema: got %v, want dirty", err)
+	}
+
+	// after fixing it by hand the version can be forced clean
+	if err := migrator.Force(ctx, 3); err != nil {
+		t.Fatalf("force: %v", err)
+	}
+	if err := migrator.Check(ctx); err != nil {
+		t.Fatalf("check after force: %v", err)
+	}
+
+	// editing an applied migration is caught on the next check
+	files["0001_one.up.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE one (id INTEGER, name TEXT);")}
+	edited, err := NewFromFS(gormDB, files)
+	if err != nil {
+		t.Fatalf("loading migrations: %v", err)
+	}
+	if err := edited.Check(ctx); err == nil {
+		t.Fatal("check passed with a modified migration")
+	}
+
+	// as is a database ahead of the code
+	delete(files, "0003_broken.up.sql")
+	delete(files, "0003_broken.down.sql")
+	files["0001_one.up.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE one (id INTEGER);")}
+	older, err := NewFromFS(gormDB, files)
+	if err != nil {
+		t.Fatalf("loading migrations: %v", err)
+	}
+	statuses, err := older.Status(ctx)
+	if err != nil {
+		t.Fatalf("status: %v", err)
+	}
+	if last := statuses[len(statuses)-1]; !last.Missing || last.Version != 3 {
+		t.Fatalf("expected version 3 to be reported missing, got %+v", last)
+	}
+	if err := older.Check(ctx); err == nil {
+		t.Fatal("check passed with an unknown applied migration")
+	}
+}
+
+func TestLoadRequiresDownFiles(t *testing.T) {
+	_, err := NewFromFS(nil, fstest.MapFS{
+		"0001_one.up.sql": {Data: []byte("CREATE TABLE one (id INTEGER);")},
+	})
+	if err == nil {
+		t.Fatal("expected an error for a migration without a down file")
+	}
+}
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS account;
+DROP TABLE IF EXISTS role;
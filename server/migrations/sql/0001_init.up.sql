@@ -0,0 +1,37 @@
+-- Baseline schema, matches what GORM AutoMigrate created before
+-- versioned migrations so existing databases can adopt it as is
+
+CREATE TABLE IF NOT EXISTS role (
+    id          BIGINT PRIMARY KEY,
+    created_at  TIMESTAMPTZ,
+    updated_at  TIMESTAMPTZ,
+    deleted_at  TIMESTAMPTZ,
+    name        VARCHAR(50) NOT NULL,
+    description VARCHAR(255) NOT NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_role_name ON role (name);
+CREATE INDEX IF NOT EXISTS idx_role_deleted_at ON role (deleted_at);
+
+CREATE TABLE IF NOT EXISTS account (
+    id             UUID PRIMARY KEY,
+    created_at     TIMESTAMPTZ,
+    updated_at     TIMESTAMPTZ,
+    deleted_at     TIMESTAMPTZ,
+    email          VARCHAR(250) NOT NULL,
+    account_number BIGINT NOT NULL,
+    balance        DECIMAL(10,2),
+    first_name     VARCHAR(100) NOT NULL,
+    last_name      VARCHAR(100) NOT NULL,
+    password       VARCHAR(100) NOT NULL,
+    image_url      TEXT,
+    role_id        BIGINT NOT NULL DEFAULT 2 REFERENCES role (id) ON UPDATE CASCADE ON DELETE CASCADE,
+    is_active      BOOLEAN
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_account_email ON account (email);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_account_account_number ON account (account_number);
+CREATE INDEX IF NOT EXISTS idx_account_deleted_at ON account (deleted_at);
+
+INSERT INTO role (id, created_at, updated_at, name, description) VALUES
+    (1, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, 'admin', 'Administrator role'),
+    (2, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, 'user', 'user role')
+ON CONFLICT (id) DO NOTHING;
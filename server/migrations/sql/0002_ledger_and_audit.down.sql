@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS audit_record;
+DROP TABLE IF EXISTS ledger_entry;
@@ -0,0 +1,26 @@
+-- Every change to an account balance is recorded in the ledger,
+-- and every operator action in the audit log
+
+CREATE TABLE ledger_entry (
+    id            UUID PRIMARY KEY,
+    created_at    TIMESTAMPTZ NOT NULL,
+    account_id    UUID NOT NULL REFERENCES account (id) ON DELETE CASCADE,
+    type          VARCHAR(20) NOT NULL,
+    amount        DECIMAL(12,2) NOT NULL,
+    balance_after DECIMAL(12,2) NOT NULL,
+    reason        VARCHAR(255) NOT NULL,
+    actor         VARCHAR(255) NOT NULL
+);
+CREATE INDEX idx_ledger_entry_account_created ON ledger_entry (account_id, created_at);
+
+CREATE TABLE audit_record (
+    id          UUID PRIMARY KEY,
+    created_at  TIMESTAMPTZ NOT NULL,
+    actor       VARCHAR(255) NOT NULL,
+    action      VARCHAR(100) NOT NULL,
+    target_type VARCHAR(50) NOT NULL,
+    target_id   VARCHAR(255) NOT NULL,
+    details     TEXT
+);
+CREATE INDEX idx_audit_record_target ON audit_record (target_type, target_id);
+CREATE INDEX idx_audit_record_created_at ON audit_record (created_at);
@@ -0,0 +1 @@
+ALTER TABLE account DROP COLUMN must_change_password;
@@ -0,0 +1,3 @@
+-- Accounts created by an operator or the bootstrap admin
+-- must choose their own password on first login
+ALTER TABLE account ADD COLUMN must_change_password BOOLEAN NOT NULL DEFAULT FALSE;
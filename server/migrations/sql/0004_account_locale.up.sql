@@ -0,0 +1,2 @@
+-- The language emails and notifications are sent in
+ALTER TABLE account ADD COLUMN locale VARCHAR(10) NOT NULL DEFAULT 'en';
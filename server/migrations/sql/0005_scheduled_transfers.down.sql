@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS scheduled_transfer;
+DROP INDEX IF EXISTS idx_ledger_entry_reference;
+ALTER TABLE ledger_entry DROP COLUMN reference;
@@ -0,0 +1,29 @@
+-- Ledger entries can carry a reference making them idempotent,
+-- scheduled transfers use it so a retried run never pays twice
+ALTER TABLE ledger_entry ADD COLUMN reference VARCHAR(100);
+CREATE UNIQUE INDEX idx_ledger_entry_reference ON ledger_entry (reference);
+
+CREATE TABLE scheduled_transfer (
+    id                UUID PRIMARY KEY,
+    created_at        TIMESTAMPTZ NOT NULL,
+    updated_at        TIMESTAMPTZ NOT NULL,
+    account_id        UUID NOT NULL REFERENCES account (id) ON DELETE CASCADE,
+    to_account_number BIGINT NOT NULL,
+    amount            DECIMAL(12,2) NOT NULL,
+    note              VARCHAR(140) NOT NULL,
+    frequency         VARCHAR(20) NOT NULL,
+    cron              VARCHAR(100) NOT NULL,
+    start_at          TIMESTAMPTZ NOT NULL,
+    end_at            TIMESTAMPTZ,
+    status            VARCHAR(20) NOT NULL,
+    due_at            TIMESTAMPTZ,
+    next_run_at       TIMESTAMPTZ,
+    runs              INTEGER NOT NULL DEFAULT 0,
+    attempts          INTEGER NOT NULL DEFAULT 0,
+    last_run_at       TIMESTAMPTZ,
+    last_status       VARCHAR(20) NOT NULL,
+    last_error        VARCHAR(255) NOT NULL,
+    version           INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX idx_scheduled_transfer_account_id ON scheduled_transfer (account_id);
+CREATE INDEX idx_scheduled_transfer_due ON scheduled_transfer (status, next_run_at);
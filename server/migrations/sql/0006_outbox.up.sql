@@ -0,0 +1,15 @@
+-- Domain events are written here in the same transaction as the change
+-- they describe, the relay publishes them and marks them published
+CREATE TABLE outbox_event (
+    id              UUID PRIMARY KEY,
+    created_at      TIMESTAMPTZ NOT NULL,
+    type            VARCHAR(100) NOT NULL,
+    aggregate_id    UUID NOT NULL,
+    payload         TEXT NOT NULL,
+    published_at    TIMESTAMPTZ,
+    next_attempt_at TIMESTAMPTZ NOT NULL,
+    attempts        INTEGER NOT NULL DEFAULT 0,
+    last_error      VARCHAR(255) NOT NULL,
+    locked_until    TIMESTAMPTZ
+);
+CREATE INDEX idx_outbox_event_pending ON outbox_event (published_at, next_attempt_at);
@@ -0,0 +1,46 @@
+-- Endpoints accounts have events pushed to, each delivery of an event
+-- and every attempt at it
+CREATE TABLE webhook_endpoint (
+    id                   UUID PRIMARY KEY,
+    created_at           TIMESTAMPTZ NOT NULL,
+    updated_at           TIMESTAMPTZ NOT NULL,
+    account_id           UUID NOT NULL REFERENCES account (id) ON DELETE CASCADE,
+    url                  VARCHAR(2048) NOT NULL,
+    description          VARCHAR(140) NOT NULL,
+    events               TEXT NOT NULL,
+    secret               VARCHAR(100) NOT NULL,
+    status               VARCHAR(20) NOT NULL,
+    consecutive_failures INTEGER NOT NULL DEFAULT 0,
+    disabled_at          TIMESTAMPTZ,
+    disabled_reason      VARCHAR(255) NOT NULL
+);
+CREATE INDEX idx_webhook_endpoint_account_id ON webhook_endpoint (account_id);
+
+CREATE TABLE webhook_delivery (
+    id               UUID PRIMARY KEY,
+    created_at       TIMESTAMPTZ NOT NULL,
+    updated_at       TIMESTAMPTZ NOT NULL,
+    endpoint_id      UUID NOT NULL REFERENCES webhook_endpoint (id) ON DELETE CASCADE,
+    event_id         UUID NOT NULL,
+    event_type       VARCHAR(100) NOT NULL,
+    payload          TEXT NOT NULL,
+    status           VARCHAR(20) NOT NULL,
+    attempts         INTEGER NOT NULL DEFAULT 0,
+    last_attempt_at  TIMESTAMPTZ,
+    last_status_code INTEGER NOT NULL DEFAULT 0,
+    last_error       VARCHAR(255) NOT NULL,
+    delivered_at     TIMESTAMPTZ
+);
+CREATE UNIQUE INDEX idx_webhook_delivery_event ON webhook_delivery (endpoint_id, event_id);
+
+CREATE TABLE webhook_attempt (
+    id          UUID PRIMARY KEY,
+    created_at  TIMESTAMPTZ NOT NULL,
+    delivery_id UUID NOT NULL REFERENCES webhook_delivery (id) ON DELETE CASCADE,
+    succeeded   BOOLEAN NOT NULL,
+    status_code INTEGER NOT NULL DEFAULT 0,
+    error       VARCHAR(255) NOT NULL,
+    response    VARCHAR(1024) NOT NULL,
+    duration_ms BIGINT NOT NULL
+);
+CREATE INDEX idx_webhook_attempt_delivery_id ON webhook_attempt (delivery_id);
@@ -0,0 +1,3 @@
+ALTER TABLE account DROP COLUMN sms_alerts;
+ALTER TABLE account DROP COLUMN phone_verified_at;
+ALTER TABLE account DROP COLUMN phone;
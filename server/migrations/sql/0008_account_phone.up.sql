@@ -0,0 +1,4 @@
+-- An E.164 phone number for OTPs and opted in debit and credit alerts
+ALTER TABLE account ADD COLUMN phone VARCHAR(16);
+ALTER TABLE account ADD COLUMN phone_verified_at TIMESTAMPTZ;
+ALTER TABLE account ADD COLUMN sms_alerts BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,22 @@
+-- The in app notification inbox, and which channels each account has
+-- every category of notification sent on
+CREATE TABLE notification (
+    id         UUID PRIMARY KEY,
+    created_at TIMESTAMPTZ NOT NULL,
+    account_id UUID NOT NULL REFERENCES account (id) ON DELETE CASCADE,
+    category   VARCHAR(20) NOT NULL,
+    event      VARCHAR(100) NOT NULL,
+    data       TEXT NOT NULL,
+    read_at    TIMESTAMPTZ
+);
+CREATE INDEX idx_notification_account ON notification (account_id, created_at, id);
+
+CREATE TABLE notification_preference (
+    account_id UUID NOT NULL REFERENCES account (id) ON DELETE CASCADE,
+    category   VARCHAR(20) NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL,
+    in_app     BOOLEAN NOT NULL,
+    email      BOOLEAN NOT NULL,
+    sms        BOOLEAN NOT NULL,
+    PRIMARY KEY (account_id, category)
+);
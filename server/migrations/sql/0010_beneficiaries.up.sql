@@ -0,0 +1,14 @@
+-- The recipients accounts save, each account number once per account
+CREATE TABLE beneficiary (
+    id             UUID PRIMARY KEY,
+    created_at     TIMESTAMPTZ NOT NULL,
+    updated_at     TIMESTAMPTZ NOT NULL,
+    account_id     UUID NOT NULL REFERENCES account (id) ON DELETE CASCADE,
+    nickname       VARCHAR(50) NOT NULL,
+    account_number BIGINT NOT NULL,
+    holder_name    VARCHAR(201) NOT NULL,
+    favourite      BOOLEAN NOT NULL DEFAULT FALSE,
+    available_at   TIMESTAMPTZ NOT NULL,
+    last_used_at   TIMESTAMPTZ
+);
+CREATE UNIQUE INDEX idx_beneficiary_account_number ON beneficiary (account_id, account_number);
@@ -6,84 +6,82 @@ import (
 	"crypto/sha256"
 	"errors"
 	"fmt"
-	"log"
 	"math/big"
 	"math/rand"
 	"time"
 
-	"github.com/Cprime50/Gopay/db"
 	"github.com/Cprime50/Gopay/helper"
-
+	"github.com/Cprime50/Gopay/i18n"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
+// Account is a Gopay user. Accounts with MustChangePassword set, such as
+// the bootstrap admin, can only change their password until they do.
+// Locale is the language emails and notifications are sent in. Phone is
+// an E.164 number, verified once PhoneVerifiedAt is set, and SMSAlerts
+// opts in to a text for every debit and credit
 type Account struct {
-	gorm.Model    `json:"-"`
-	ID            uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primary_key"`
-	Email         string    `gorm:"uniqueIndex;not null;type:varchar(250)" json:"email"`
-	AccountNumber int64     `gorm:"uniqueIndex;column:account_number;not null"`
-	Balance       float64   `gorm:"type:decimal(10,2)"`
-	FirstName     string    `gorm:"type:varchar(100);not null"`
-	LastName      string    `gorm:"type:varchar(100);not null"`
-	Password      string    `gorm:"type:varchar(100);not null"`
-	ImageUrl      string    `gorm:"image_url" json:"imageUrl"`
-	RoleID        uint      `gorm:"not null;DEFAULT:4" json:"role_id"`
-	Role          Role      `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
-	IsActive      bool      `gorm:"type:boolean"`
+	gorm.Model         `json:"-"`
+	ID                 uuid.UUID  `gorm:"type:uuid;primary_key"`
+	Email              string     `gorm:"uniqueIndex;not null;type:varchar(250)" json:"email"`
+	AccountNumber      int64      `gorm:"uniqueIndex;column:account_number;not null"`
+	Balance            float64    `gorm:"type:decimal(10,2)"`
+	FirstName          string     `gorm:"type:varchar(100);not null"`
+	LastName           string     `gorm:"type:varchar(100);not null"`
+	Password           string     `gorm:"type:varchar(100);not null" json:"-"`
+	ImageUrl           string     `gorm:"image_url" json:"imageUrl"`
+	RoleID             uint       `gorm:"not null;DEFAULT:2" json:"role_id"`
+	Role               Role       `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	IsActive           bool       `gorm:"type:boolean"`
+	MustChangePassword bool       `gorm:"not null;default:false" json:"credentials_expired"`
+	Locale             string     `gorm:"type:varchar(10);not null;default:en" json:"locale"`
+	Phone              *string    `gorm:"type:varchar(16)" json:"phone,omitempty"`
+	PhoneVerifiedAt    *time.Time `json:"phone_verified_at,omitempty"`
+	SMSAlerts          bool       `gorm:"column:sms_alerts;not null;default:false" json:"sms_alerts"`
 }
 
-// CreateAccount creates a new account in the database
-func CreateAccount(ctx context.Context, account *Account) error {
-	// Check if an account with the given email already exists
-	err := db.DB.WithContext(ctx).Where("email = ?", account.Email).First(&account).Error
-	switch {
-	case err == nil:
-		log.Printf("Could not create an account with email: %v. Reason: Account already exists\n", account.Email)
-		return helper.NewConflict("email", account.Email)
-
-	case errors.Is(err, gorm.ErrRecordNotFound):
-		break
+// PhoneVerified reports whether texts can be sent to the account's phone
+func (a *Account) PhoneVerified() bool {
+	return a.Phone != nil && a.PhoneVerifiedAt != nil
+}
 
-	default:
-		log.Printf("Error checking account existence: %v\n", err)
-		return helper.NewInternal()
+// BeforeCreate generates the account ID in go so it doesn't depend
+// on the uuid-ossp postgres extension being installed
+func (a *Account) BeforeCreate(tx *gorm.DB) error {
+	if a.ID == uuid.Nil {
+		a.ID = uuid.New()
 	}
-
-	// Generate account number
-	accountNumber, err := GenerateAccountNumber()
-	if err != nil {
-		log.Printf("Error generating account number: %v\n", err)
-		return helper.NewInternal()
+	if a.Locale == "" {
+		a.Locale = i18n.Default
 	}
+	return nil
+}
 
-	//check if account number is unique
-	_err := db.DB.WithContext(ctx).Where("account_number = ?", accountNumber).First(&account).Error
-	for _err == nil {
-		accountNumber, err = GenerateAccountNumber()
-		if err != nil {
-			log.Printf("Error generating account number: %v\n", err)
-			return helper.NewInternal()
-		}
-	}
+// accountRepository is the GORM backed AccountRepository
+type accountRepository struct {
+	db *gorm.DB
+}
 
-	// initialize account number
-	newAccount := &Account{
-		Email:         account.Email,
-		FirstName:     account.FirstName,
-		LastName:      account.LastName,
-		Password:      account.Password,
-		AccountNumber: accountNumber,
-		Balance:       500,
-		RoleID:        2,
-		IsActive:      false,
-	}
-	if err := db.DB.WithContext(ctx).Create(newAccount).Error; err != nil {
-		log.Printf("Error creating account: %v\n", err)
-		return helper.NewInternal()
-	}
+// NewAccountRepository returns an AccountRepository backed by db
+func NewAccountRepository(db *gorm.DB) AccountRepository {
+	return &accountRepository{db: db}
+}
 
-	return nil
+// Create inserts a new account, populating its generated ID
+func (r *accountRepository) Create(ctx context.Context, account *Account) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(account).Error; err != nil {
+			helper.Logger(ctx).Error("error creating account", "error", err)
+			return helper.NewInternal()
+		}
+		return writeOutbox(ctx, tx, EventAccountCreated, account.ID, AccountCreated{
+			AccountID:     account.ID,
+			Email:         account.Email,
+			AccountNumber: account.AccountNumber,
+			Locale:        account.Locale,
+		})
+	})
 }
 
 // TODO generate better account number
@@ -103,184 +101,172 @@ func GenerateAccountNumber() (int64, error) {
 	return accountNumber, nil
 }
 
-// GetAccountByAccountNum gets a user's account from the database based on the account number
-func GetAccountByAccountNum(ctx context.Context, accountNumber int64) (*Account, error) {
+// GetByAccountNum gets a user's account from the database based on the account number
+func (r *accountRepository) GetByAccountNum(ctx context.Context, accountNumber int64) (*Account, error) {
 
 	var account Account
-	err := db.DB.WithContext(ctx).Where("account_number = ?", accountNumber).First(&account).Error
+	err := r.db.WithContext(ctx).Where("account_number = ?", accountNumber).First(&account).Error
 	if err != nil {
 		if errors.Is(gorm.ErrRecordNotFound, err) {
-			fmt.Printf("account with ID %d not found", accountNumber)
+			helper.Logger(ctx).Info("account not found", "account_number", accountNumber)
 			return nil, helper.NewNotFound("account_number", fmt.Sprintf("%d", accountNumber))
 		}
-		log.Println("Error querying account:", err)
+		helper.Logger(ctx).Error("error querying account", "error", err)
 		return nil, helper.NewInternal()
 	}
 	return &account, nil
 }
 
-// GetAccountByEmail gets a user's account from the database based on the email
-func GetAccountByEmail(ctx context.Context, email string) (*Account, error) {
+// GetByEmail gets a user's account from the database based on the email
+func (r *accountRepository) GetByEmail(ctx context.Context, email string) (*Account, error) {
 
 	var account Account
-	err := db.DB.WithContext(ctx).Where("email = ?", email).First(&account).Error
+	err := r.db.WithContext(ctx).Where("email = ?", email).First(&account).Error
 	if err != nil {
 		if errors.Is(gorm.ErrRecordNotFound, err) {
-			fmt.Printf("account with email %s not found", email)
+			helper.Logger(ctx).Info("account not found", "email", email)
 			return nil, helper.NewNotFound("email", email)
 		}
-		log.Println("Error querying account:", err)
+		helper.Logger(ctx).Error("error querying account", "error", err)
 		return nil, helper.NewInternal()
 	}
 	return &account, nil
 }
 
-// GetAccountByID gets a user's account from the database based on the ID
-func GetAccountByID(ctx context.Context, id uuid.UUID) (*Account, error) {
+// GetByID gets a user's account from the database based on the ID
+func (r *accountRepository) GetByID(ctx context.Context, id uuid.UUID) (*Account, error) {
 	var account Account
-	err := db.DB.WithContext(ctx).Where("id = ?", id).First(&account).Error
+	err := r.db.WithContext(ctx).Where("id = ?", id).First(&account).Error
 	if err != nil {
 		if errors.Is(gorm.ErrRecordNotFound, err) {
-			fmt.Printf("account with ID %s not found", id)
+			helper.Logger(ctx).Info("account not found", "id", id)
 			return nil, helper.NewNotFound("id", id.String())
 		}
-		log.Println("Error querying account in db:", err)
+		helper.Logger(ctx).Error("error querying account", "error", err)
 		return nil, helper.NewInternal()
 	}
 	return &account, nil
 }
 
 // Update Account details
-func UpdateAccount(ctx context.Context, account *Account) error {
+func (r *accountRepository) Update(ctx context.Context, account *Account) error {
 	// Update only the fields that are filled in the account
 	// Omit sensitive fields like password, balance, and role
-	err := db.DB.WithContext(ctx).Omit("password", "balance", "role").Updates(&account).Error
+	err := r.db.WithContext(ctx).Omit("password", "balance", "role").Updates(&account).Error
 	if err != nil {
 		if errors.Is(gorm.ErrRecordNotFound, err) {
-			fmt.Printf("account with ID %s not found", account.ID)
+			helper.Logger(ctx).Info("account not found", "id", account.ID)
 			return helper.NewNotFound("id", account.ID.String())
 		}
-		log.Println("Error querying account:", err)
+		helper.Logger(ctx).Error("error querying account", "error", err)
 		return helper.NewInternal()
 	}
 	return nil
 }
 
-func ChangeUserStatus(ctx context.Context, account *Account) error {
-	// Check if the accounts exists based on the provided accountID
-	_, err := GetAccountByID(ctx, account.ID)
-	if err != nil {
-		if errors.Is(gorm.ErrRecordNotFound, err) {
-			fmt.Printf("account with ID %s not found", account.ID)
-			return helper.NewNotFound("id", account.ID.String())
+// ChangeStatus activates or deactivates an account
+func (r *accountRepository) ChangeStatus(ctx context.Context, account *Account) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Check if the accounts exists based on the provided accountID
+		existing, err := NewAccountRepository(tx).GetByID(ctx, account.ID)
+		if err != nil {
+			return err
 		}
-		log.Println("Error querying account:", err)
-		return helper.NewInternal()
-	}
 
-	// Create a map of columns and their values that you want to update
-	updateColumns := map[string]interface{}{
-		"IsActive": account.IsActive,
-	}
+		// Create a map of columns and their values that you want to update
+		updateColumns := map[string]interface{}{
+			"is_active": account.IsActive,
+		}
 
-	// Update only the specified columns in the database
-	if err := db.DB.WithContext(ctx).Model(&account).Updates(updateColumns).Error; err != nil {
-		log.Println("Error updating user:", err)
-		return helper.NewInternal()
-	}
-	return nil
+		// Update only the specified columns in the database
+		if err := tx.Model(&Account{}).Where("id = ?", account.ID).Updates(updateColumns).Error; err != nil {
+			helper.Logger(ctx).Error("error updating account status", "error", err)
+			return helper.NewInternal()
+		}
+		if existing.IsActive || !account.IsActive {
+			return nil
+		}
+		return writeOutbox(ctx, tx, EventAccountActivated, account.ID, AccountActivated{AccountID: account.ID})
+	})
 }
 
-// Resetpassword updates the users password
-func ResetPassword(ctx context.Context, account *Account) error {
-	// Hash the new password
-	hashedPassword, err := HashPassword(account.Password)
-	if err != nil {
-		fmt.Println("Error hashing password", err)
-		return helper.NewInternal()
-	}
+// UpdatePassword sets the account's already hashed password,
+// which also lifts any forced password change
+func (r *accountRepository) UpdatePassword(ctx context.Context, email string, hashedPassword string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		account, err := NewAccountRepository(tx).GetByEmail(ctx, email)
+		if err != nil {
+			return err
+		}
 
-	// Update user password where username, email match and the user is active
-	err = db.DB.WithContext(ctx).Model(&Account{}).
-		Where("email = ?", account.Email).
-		Updates(map[string]interface{}{"password": hashedPassword}).Error
-	if err != nil {
-		if errors.Is(gorm.ErrRecordNotFound, err) {
-			fmt.Printf("account with email %s not found\n", account.Email)
-			return helper.NewNotFound("email", account.Email)
+		// Update user password where email match
+		err = tx.Model(&Account{}).
+			Where("id = ?", account.ID).
+			Updates(map[string]interface{}{"password": hashedPassword, "must_change_password": false}).Error
+		if err != nil {
+			helper.Logger(ctx).Error("error resetting password", "error", err)
+			return helper.NewInternal()
 		}
-		log.Println("Error reseting password", err)
-		return helper.NewInternal()
-	}
-	return nil
+		return writeOutbox(ctx, tx, EventPasswordChanged, account.ID, PasswordChanged{AccountID: account.ID})
+	})
 }
 
-// Upload Image by file to cloudinary and save the img url to db
-func UpdateImgByFile(ctx context.Context, id uuid.UUID, imgFile *File) error {
-	media := NewImageRepository()
-	imageURL, err := media.FileUpload(imgFile)
-	if err != nil {
-		log.Println("Error uploaidng image by file", err)
-		return helper.NewInternal()
-	}
-	err = db.DB.WithContext(ctx).Model(&Account{}).
+// UpdateImage saves the url of the account's uploaded image
+func (r *accountRepository) UpdateImage(ctx context.Context, id uuid.UUID, imageURL string) error {
+	result := r.db.WithContext(ctx).Model(&Account{}).
 		Where("id = ?", id).
-		Updates(map[string]interface{}{"image": imageURL}).Error
-	if err != nil {
-		if errors.Is(gorm.ErrRecordNotFound, err) {
-			fmt.Printf("account with ID %s not found", id)
-			return helper.NewNotFound("id", id.String())
-		}
-		log.Println("Error querying account to update image:", err)
+		Updates(map[string]interface{}{"image_url": imageURL})
+	if err := result.Error; err != nil {
+		helper.Logger(ctx).Error("error querying account to update image", "error", err)
 		return helper.NewInternal()
 	}
+	if result.RowsAffected == 0 {
+		helper.Logger(ctx).Info("account not found", "id", id)
+		return helper.NewNotFound("id", id.String())
+	}
 	return nil
 }
 
-// Upload Image by url to cloudinary and save the img url to db
-func UpdateImgByUrl(ctx context.Context, id uuid.UUID, imgUrl *Url) error {
-	media := NewImageRepository()
-	imageURL, err := media.RemoteUpload(imgUrl)
-	if err != nil {
-		log.Println("Error uploaidng image by Url", err)
+// UpdatePhone saves the account's phone number, its verification and SMS alerts opt in
+func (r *accountRepository) UpdatePhone(ctx context.Context, account *Account) error {
+	result := r.db.WithContext(ctx).Model(&Account{}).
+		Where("id = ?", account.ID).
+		Updates(map[string]interface{}{
+			"phone":             account.Phone,
+			"phone_verified_at": account.PhoneVerifiedAt,
+			"sms_alerts":        account.SMSAlerts,
+		})
+	if err := result.Error; err != nil {
+		helper.Logger(ctx).Error("error querying account to update phone", "error", err)
 		return helper.NewInternal()
 	}
-	err = db.DB.WithContext(ctx).Model(&Account{}).
-		Where("id = ?", id).
-		Updates(map[string]interface{}{"image": imageURL}).Error
-	if err != nil {
-		if errors.Is(gorm.ErrRecordNotFound, err) {
-			fmt.Printf("account with ID %s not found", id)
-			return helper.NewNotFound("id", id.String())
-		}
-		log.Println("Error querying account to updating image:", err)
-		return helper.NewInternal()
+	if result.RowsAffected == 0 {
+		helper.Logger(ctx).Info("account not found", "id", account.ID)
+		return helper.NewNotFound("id", account.ID.String())
 	}
 	return nil
 }
 
-// GetAllAccount gets a list of all account in db
-func GetAllAccount(ctx context.Context) ([]*Account, error) {
+// GetAll gets a list of all account in db
+func (r *accountRepository) GetAll(ctx context.Context) ([]*Account, error) {
 	var accounts []*Account
-	if err := db.DB.WithContext(ctx).Omit("password").Find(&accounts).Error; err != nil {
-		log.Println("Error getting users accounts:", err)
+	if err := r.db.WithContext(ctx).Omit("password").Find(&accounts).Error; err != nil {
+		helper.Logger(ctx).Error("error getting accounts", "error", err)
 		return nil, helper.NewInternal()
 	}
 	return accounts, nil
 }
 
-// DeleteAccount deletes an account based on the provided ID
-func DeleteAccount(ctx context.Context, id uuid.UUID) error {
-	var account *Account
-	if err := db.DB.WithContext(ctx).Where("id = ?", id).Delete(&account).Error; err != nil {
-		if err != nil {
-			if errors.Is(gorm.ErrRecordNotFound, err) {
-				fmt.Printf("account with ID %s not found", account.ID)
-				return helper.NewNotFound("id", account.ID.String())
-			}
-			log.Println("Error deleting account:", err)
-			return helper.NewInternal()
-		}
+// Delete deletes an account based on the provided ID
+func (r *accountRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	result := r.db.WithContext(ctx).Where("id = ?", id).Delete(&Account{})
+	if err := result.Error; err != nil {
+		helper.Logger(ctx).Error("error deleting account", "error", err)
+		return helper.NewInternal()
+	}
+	if result.RowsAffected == 0 {
+		helper.Logger(ctx).Info("account not found", "id", id)
+		return helper.NewNotFound("id", id.String())
 	}
 	return nil
 }
@@ -0,0 +1,75 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/Cprime50/Gopay/helper"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// AuditRecord is an operator action, who did what to which resource
+type AuditRecord struct {
+	ID         uuid.UUID `gorm:"type:uuid;primary_key" json:"id"`
+	CreatedAt  time.Time `gorm:"index" json:"created_at"`
+	Actor      string    `gorm:"type:varchar(255);not null" json:"actor"`
+	Action     string    `gorm:"type:varchar(100);not null" json:"action"`
+	TargetType string    `gorm:"type:varchar(50);not null;index:idx_audit_record_target,priority:1" json:"target_type"`
+	TargetID   string    `gorm:"type:varchar(255);not null;index:idx_audit_record_target,priority:2" json:"target_id"`
+	Details    string    `gorm:"type:text" json:"details,omitempty"`
+}
+
+// BeforeCreate generates the record ID
+func (a *AuditRecord) BeforeCreate(tx *gorm.DB) error {
+	if a.ID == uuid.Nil {
+		a.ID = uuid.New()
+	}
+	return nil
+}
+
+// AuditFilter narrows down the records listed, zero values match everything
+type AuditFilter struct {
+	TargetType string
+	TargetID   string
+	Limit      int
+}
+
+// auditRepository is the GORM backed AuditRepository
+type auditRepository struct {
+	db *gorm.DB
+}
+
+// NewAuditRepository returns an AuditRepository backed by db
+func NewAuditRepository(db *gorm.DB) AuditRepository {
+	return &auditRepository{db: db}
+}
+
+func (r *auditRepository) Record(ctx context.Context, record *AuditRecord) error {
+	if err := r.db.WithContext(ctx).Create(record).Error; err != nil {
+		helper.Logger(ctx).Error("error creating audit record", "error", err)
+		return helper.NewInternal()
+	}
+	return nil
+}
+
+// List returns the matching records newest first
+func (r *auditRepository) List(ctx context.Context, filter AuditFilter) ([]*AuditRecord, error) {
+	query := r.db.WithContext(ctx).Order("created_at DESC")
+	if filter.TargetType != "" {
+		query = query.Where("target_type = ?", filter.TargetType)
+	}
+	if filter.TargetID != "" {
+		query = query.Where("target_id = ?", filter.TargetID)
+	}
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+
+	var records []*AuditRecord
+	if err := query.Find(&records).Error; err != nil {
+		helper.Logger(ctx).Error("error querying audit records", "error", err)
+		return nil, helper.NewInternal()
+	}
+	return records, nil
+}
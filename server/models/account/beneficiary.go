@@ -0,0 +1,145 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Cprime50/Gopay/helper"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Beneficiary is a recipient an account saved so its number needn't be
+// typed again. HolderName is the recipient's masked name when it was added.
+// Transfers to it can't be due before AvailableAt, the end of the cool
+// off after adding it. LastUsedAt is when money was last sent to it
+type Beneficiary struct {
+	ID            uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	AccountID     uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex:idx_beneficiary_account_number,priority:1" json:"-"`
+	Nickname      string     `gorm:"type:varchar(50);not null" json:"nickname"`
+	AccountNumber int64      `gorm:"not null;uniqueIndex:idx_beneficiary_account_number,priority:2" json:"account_number"`
+	HolderName    string     `gorm:"type:varchar(201);not null" json:"holder_name"`
+	Favourite     bool       `gorm:"not null;default:false" json:"favourite"`
+	AvailableAt   time.Time  `gorm:"not null" json:"available_at"`
+	LastUsedAt    *time.Time `json:"last_used_at,omitempty"`
+}
+
+// BeforeCreate generates the beneficiary ID
+func (b *Beneficiary) BeforeCreate(tx *gorm.DB) error {
+	if b.ID == uuid.Nil {
+		b.ID = uuid.New()
+	}
+	return nil
+}
+
+// beneficiaryRepository is the GORM backed BeneficiaryRepository
+type beneficiaryRepository struct {
+	db *gorm.DB
+}
+
+// NewBeneficiaryRepository returns a BeneficiaryRepository backed by db
+func NewBeneficiaryRepository(db *gorm.DB) BeneficiaryRepository {
+	return &beneficiaryRepository{db: db}
+}
+
+// Create saves a new beneficiary, failing with a conflict if the
+// account already saved its account number
+func (r *beneficiaryRepository) Create(ctx context.Context, beneficiary *Beneficiary) error {
+	result := r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(beneficiary)
+	if err := result.Error; err != nil {
+		helper.Logger(ctx).Error("error creating beneficiary", "error", err)
+		return helper.NewInternal()
+	}
+	if result.RowsAffected == 0 {
+		return helper.NewConflict("beneficiary", fmt.Sprintf("%d", beneficiary.AccountNumber))
+	}
+	return nil
+}
+
+func (r *beneficiaryRepository) GetByID(ctx context.Context, id uuid.UUID) (*Beneficiary, error) {
+	return r.get(ctx, id.String(), "id = ?", id)
+}
+
+func (r *beneficiaryRepository) GetByAccountNumber(ctx context.Context, accountID uuid.UUID, accountNumber int64) (*Beneficiary, error) {
+	return r.get(ctx, fmt.Sprintf("%d", accountNumber), "account_id = ? AND account_number = ?", accountID, accountNumber)
+}
+
+// get returns the beneficiary matching query, not found reports value
+func (r *beneficiaryRepository) get(ctx context.Context, value string, query string, args ...interface{}) (*Beneficiary, error) {
+	var beneficiary Beneficiary
+	if err := r.db.WithContext(ctx).Where(query, args...).First(&beneficiary).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, helper.NewNotFound("beneficiary", value)
+		}
+		helper.Logger(ctx).Error("error querying beneficiary", "error", err)
+		return nil, helper.NewInternal()
+	}
+	return &beneficiary, nil
+}
+
+// ListByAccount returns the account's beneficiaries, favourites first
+// then the most recently used, those never used last
+func (r *beneficiaryRepository) ListByAccount(ctx context.Context, accountID uuid.UUID) ([]*Beneficiary, error) {
+	var beneficiaries []*Beneficiary
+	err := r.db.WithContext(ctx).
+		Where("account_id = ?", accountID).
+		Order("favourite DESC").
+		Order("last_used_at IS NULL").
+		Order("last_used_at DESC").
+		Order("created_at DESC").
+		Find(&beneficiaries).Error
+	if err != nil {
+		helper.Logger(ctx).Error("error querying beneficiaries", "error", err)
+		return nil, helper.NewInternal()
+	}
+	return beneficiaries, nil
+}
+
+// Update saves the beneficiary's nickname and favourite flag, the rest is fixed once added
+func (r *beneficiaryRepository) Update(ctx context.Context, beneficiary *Beneficiary) error {
+	beneficiary.UpdatedAt = time.Now()
+	result := r.db.WithContext(ctx).Model(&Beneficiary{}).
+		Where("id = ?", beneficiary.ID).
+		Select("nickname", "favourite", "updated_at").
+		Updates(beneficiary)
+	if err := result.Error; err != nil {
+		helper.Logger(ctx).Error("error updating beneficiary", "error", err)
+		return helper.NewInternal()
+	}
+	if result.RowsAffected == 0 {
+		return helper.NewNotFound("beneficiary", beneficiary.ID.String())
+	}
+	return nil
+}
+
+func (r *beneficiaryRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	result := r.db.WithContext(ctx).Where("id = ?", id).Delete(&Beneficiary{})
+	if err := result.Error; err != nil {
+		helper.Logger(ctx).Error("error deleting beneficiary", "error", err)
+		return helper.NewInternal()
+	}
+	if result.RowsAffected == 0 {
+		return helper.NewNotFound("beneficiary", id.String())
+	}
+	return nil
+}
+
+// MarkUsed records money was sent to the account's beneficiary with
+// accountNumber at at, doing nothing if it has none
+func (r *beneficiaryRepository) MarkUsed(ctx context.Context, accountID uuid.UUID, accountNumber int64, at time.Time) error {
+	err := r.db.WithContext(ctx).Model(&Beneficiary{}).
+		Where("account_id = ? AND account_number = ?", accountID, accountNumber).
+		Update("last_used_at", at).Error
+	if err != nil {
+		helper.Logger(ctx).Error("error marking beneficiary used", "error", err)
+		return helper.NewInternal()
+	}
+	return nil
+}
@@ -1,8 +1,10 @@
 package models
 
 import (
+	"context"
 	"mime/multipart"
 
+	"github.com/Cprime50/Gopay/config"
 	"github.com/Cprime50/Gopay/helper"
 	"github.com/go-playground/validator/v10"
 )
@@ -10,14 +12,16 @@ import (
 var validate = validator.New()
 
 type ImageRepository interface {
-	FileUpload(file *File) (string, error)
-	RemoteUpload(url *Url) (string, error)
+	FileUpload(ctx context.Context, file *File) (string, error)
+	RemoteUpload(ctx context.Context, url *Url) (string, error)
 }
 
-type media struct{}
+type media struct {
+	cfg config.Cloudinary
+}
 
-func NewImageRepository() ImageRepository {
-	return &media{}
+func NewImageRepository(cfg config.Cloudinary) ImageRepository {
+	return &media{cfg: cfg}
 }
 
 type File struct {
@@ -28,7 +32,7 @@ type Url struct {
 	Url string `json:"url,omitempty" validate:"required"`
 }
 
-func (*media) FileUpload(file *File) (string, error) {
+func (m *media) FileUpload(ctx context.Context, file *File) (string, error) {
 	// Validate
 	err := validate.Struct(file)
 	if err != nil {
@@ -36,7 +40,7 @@ func (*media) FileUpload(file *File) (string, error) {
 	}
 
 	// Upload to Cloudinary
-	uploadUrl, err := helper.ImageUploadHelper(file.File)
+	uploadUrl, err := helper.ImageUploadHelper(ctx, m.cfg, file.File)
 	if err != nil {
 		return "", err
 	}
@@ -44,7 +48,7 @@ func (*media) FileUpload(file *File) (string, error) {
 	return uploadUrl, nil
 }
 
-func (*media) RemoteUpload(url *Url) (string, error) {
+func (m *media) RemoteUpload(ctx context.Context, url *Url) (string, error) {
 	// Validate
 	err := validate.Struct(url)
 	if err != nil {
@@ -52,7 +56,7 @@ func (*media) RemoteUpload(url *Url) (string, error) {
 	}
 
 	// Upload to Cloudinary
-	uploadUrl, err := helper.ImageUploadHelper(url.Url)
+	uploadUrl, err := helper.ImageUploadHelper(ctx, m.cfg, url.Url)
 	if err != nil {
 		return "", err
 	}
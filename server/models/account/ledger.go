@@ -0,0 +1,215 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/Cprime50/Gopay/helper"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Ledger entry types
+const (
+	Credit = "credit"
+	Debit  = "debit"
+)
+
+// LedgerEntry is a single change to an account's balance
+type LedgerEntry struct {
+	ID           uuid.UUID `gorm:"type:uuid;primary_key" json:"id"`
+	CreatedAt    time.Time `gorm:"index:idx_ledger_entry_account_created,priority:2" json:"created_at"`
+	AccountID    uuid.UUID `gorm:"type:uuid;not null;index:idx_ledger_entry_account_created,priority:1" json:"account_id"`
+	Type         string    `gorm:"type:varchar(20);not null" json:"type"`
+	Amount       float64   `gorm:"type:decimal(12,2);not null" json:"amount"`
+	BalanceAfter float64   `gorm:"type:decimal(12,2);not null" json:"balance_after"`
+	Reason       string    `gorm:"type:varchar(255);not null" json:"reason"`
+	Actor        string    `gorm:"type:varchar(255);not null" json:"-"`
+	// Reference makes applying the entry idempotent, an entry with a
+	// reference that's already in the ledger is rejected as a conflict
+	Reference *string `gorm:"type:varchar(100);uniqueIndex" json:"reference,omitempty"`
+}
+
+// BeforeCreate generates the entry ID
+func (e *LedgerEntry) BeforeCreate(tx *gorm.DB) error {
+	if e.ID == uuid.Nil {
+		e.ID = uuid.New()
+	}
+	return nil
+}
+
+// signedAmount is the change the entry makes to the balance
+func (e *LedgerEntry) signedAmount() float64 {
+	if e.Type == Debit {
+		return -e.Amount
+	}
+	return e.Amount
+}
+
+// validate checks the entry before it's applied
+func (e *LedgerEntry) validate() error {
+	if e.Type != Credit && e.Type != Debit {
+		return helper.NewBadRequest("entry type must be credit or debit")
+	}
+	if e.Amount <= 0 || math.IsNaN(e.Amount) || math.IsInf(e.Amount, 0) {
+		return helper.NewBadRequest("amount must be positive")
+	}
+	if e.Reason == "" {
+		return helper.NewBadRequest("a reason is required")
+	}
+	e.Amount = math.Round(e.Amount*100) / 100
+	return nil
+}
+
+// validateTransfer checks a transfer's entries, the debit and credit must
+// move the same amount between two different accounts
+func validateTransfer(debit *LedgerEntry, credit *LedgerEntry) error {
+	if debit.Type != Debit || credit.Type != Credit {
+		return helper.NewBadRequest("a transfer is a debit and a credit")
+	}
+	if debit.AccountID == credit.AccountID {
+		return helper.NewBadRequest("cannot transfer to the same account")
+	}
+	for _, entry := range []*LedgerEntry{debit, credit} {
+		if err := entry.validate(); err != nil {
+			return err
+		}
+	}
+	if debit.Amount != credit.Amount {
+		return helper.NewBadRequest("the debit and credit amounts differ")
+	}
+	if debit.Reference != nil && credit.Reference != nil && *debit.Reference == *credit.Reference {
+		return helper.NewBadRequest("the debit and credit need their own reference")
+	}
+	return nil
+}
+
+// ledgerRepository is the GORM backed LedgerRepository
+type ledgerRepository struct {
+	db *gorm.DB
+}
+
+// NewLedgerRepository returns a LedgerRepository backed by db
+func NewLedgerRepository(db *gorm.DB) LedgerRepository {
+	return &ledgerRepository{db: db}
+}
+
+// Apply updates the account balance by entry and records it along with
+// an EventBalanceAdjusted. Debits that would take the balance below zero
+// fail with a bad request
+func (r *ledgerRepository) Apply(ctx context.Context, entry *LedgerEntry) error {
+	if err := entry.validate(); err != nil {
+		return err
+	}
+
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := applyEntry(ctx, tx, entry); err != nil {
+			return err
+		}
+		return writeOutbox(ctx, tx, EventBalanceAdjusted, entry.AccountID, balanceAdjusted(entry))
+	})
+}
+
+// Transfer applies a debit and a credit in one transaction, so either
+// both accounts change or neither does
+func (r *ledgerRepository) Transfer(ctx context.Context, debit *LedgerEntry, credit *LedgerEntry) error {
+	if err := validateTransfer(debit, credit); err != nil {
+		return err
+	}
+
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// lock the accounts in ID order so opposite transfers can't deadlock
+		entries := []*LedgerEntry{debit, credit}
+		if credit.AccountID.String() < debit.AccountID.String() {
+			entries[0], entries[1] = credit, debit
+		}
+		for _, entry := range entries {
+			if err := applyEntry(ctx, tx, entry); err != nil {
+				return err
+			}
+		}
+		return writeOutbox(ctx, tx, EventTransferCompleted, debit.AccountID, transferCompleted(debit, credit))
+	})
+}
+
+// transferCompleted is the event recorded for a transfer made of debit and credit
+func transferCompleted(debit *LedgerEntry, credit *LedgerEntry) TransferCompleted {
+	return TransferCompleted{
+		FromAccountID: debit.AccountID,
+		ToAccountID:   credit.AccountID,
+		Amount:        debit.Amount,
+		DebitEntryID:  debit.ID,
+		CreditEntryID: credit.ID,
+		Actor:         debit.Actor,
+	}
+}
+
+// balanceAdjusted is the event recorded for an entry applied on its own
+func balanceAdjusted(entry *LedgerEntry) BalanceAdjusted {
+	return BalanceAdjusted{
+		AccountID:    entry.AccountID,
+		EntryID:      entry.ID,
+		Type:         entry.Type,
+		Amount:       entry.Amount,
+		BalanceAfter: entry.BalanceAfter,
+		Reason:       entry.Reason,
+	}
+}
+
+// applyEntry is Apply within the transaction tx
+func applyEntry(ctx context.Context, tx *gorm.DB, entry *LedgerEntry) error {
+	if entry.Reference != nil {
+		var count int64
+		if err := tx.Model(&LedgerEntry{}).Where("reference = ?", *entry.Reference).Count(&count).Error; err != nil {
+			helper.Logger(ctx).Error("error querying ledger reference", "error", err)
+			return helper.NewInternal()
+		}
+		if count > 0 {
+			return helper.NewConflict("reference", *entry.Reference)
+		}
+	}
+
+	// a single conditional update so concurrent debits can't overdraw
+	result := tx.Model(&Account{}).
+		Where("id = ? AND balance + ? >= 0", entry.AccountID, entry.signedAmount()).
+		Update("balance", gorm.Expr("balance + ?", entry.signedAmount()))
+	if err := result.Error; err != nil {
+		helper.Logger(ctx).Error("error updating balance", "error", err)
+		return helper.NewInternal()
+	}
+
+	var account Account
+	if err := tx.Select("balance").Where("id = ?", entry.AccountID).First(&account).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return helper.NewNotFound("id", entry.AccountID.String())
+		}
+		helper.Logger(ctx).Error("error querying account balance", "error", err)
+		return helper.NewInternal()
+	}
+	if result.RowsAffected == 0 {
+		return helper.NewBadRequest("insufficient funds").WithCode(helper.CodeInsufficientFunds)
+	}
+
+	entry.BalanceAfter = account.Balance
+	if err := tx.Create(entry).Error; err != nil {
+		helper.Logger(ctx).Error("error creating ledger entry", "error", err)
+		return helper.NewInternal()
+	}
+	return nil
+}
+
+// ListByAccount returns the account's entries created in [from, to), oldest first
+func (r *ledgerRepository) ListByAccount(ctx context.Context, accountID uuid.UUID, from time.Time, to time.Time) ([]*LedgerEntry, error) {
+	var entries []*LedgerEntry
+	err := r.db.WithContext(ctx).
+		Where("account_id = ? AND created_at >= ? AND created_at < ?", accountID, from, to).
+		Order("created_at").
+		Find(&entries).Error
+	if err != nil {
+		helper.Logger(ctx).Error("error querying ledger", "error", err)
+		return nil, helper.NewInternal()
+	}
+	return entries, nil
+}
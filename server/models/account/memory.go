@@ -0,0 +1,1185 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Cprime50/Gopay/helper"
+	"github.com/Cprime50/Gopay/i18n"
+	"github.com/google/uuid"
+)
+
+// The in memory repositories below keep everything in maps guarded by a
+// mutex. They behave like the GORM and redis ones, including the errors
+// returned, so services and handlers can be tested without postgres or redis.
+// Values are copied in and out so callers can't mutate stored records
+
+// memoryAccountRepository is the in memory AccountRepository. It holds
+// the outbox too, so events are recorded under the same lock as the
+// changes they describe
+type memoryAccountRepository struct {
+	mu       sync.RWMutex
+	accounts map[uuid.UUID]Account
+	outbox   []OutboxEvent
+}
+
+// NewMemoryAccountRepository returns an empty in memory AccountRepository
+func NewMemoryAccountRepository() AccountRepository {
+	return &memoryAccountRepository{accounts: make(map[uuid.UUID]Account)}
+}
+
+func (r *memoryAccountRepository) Create(ctx context.Context, account *Account) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if account.ID == uuid.Nil {
+		account.ID = uuid.New()
+	}
+	if account.Locale == "" {
+		account.Locale = i18n.Default
+	}
+	for _, a := range r.accounts {
+		if a.ID == account.ID || strings.EqualFold(a.Email, account.Email) || a.AccountNumber == account.AccountNumber {
+			helper.Logger(ctx).Error("error creating account: duplicate key")
+			return helper.NewInternal()
+		}
+	}
+	event, err := newOutboxEvent(ctx, EventAccountCreated, account.ID, AccountCreated{
+		AccountID:     account.ID,
+		Email:         account.Email,
+		AccountNumber: account.AccountNumber,
+		Locale:        account.Locale,
+	})
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	account.CreatedAt, account.UpdatedAt = now, now
+	r.accounts[account.ID] = *account
+	r.outbox = append(r.outbox, *event)
+	return nil
+}
+
+func (r *memoryAccountRepository) find(match func(a Account) bool) (*Account, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, a := range r.accounts {
+		if match(a) {
+			return &a, true
+		}
+	}
+	return nil, false
+}
+
+func (r *memoryAccountRepository) GetByID(ctx context.Context, id uuid.UUID) (*Account, error) {
+	account, ok := r.find(func(a Account) bool { return a.ID == id })
+	if !ok {
+		return nil, helper.NewNotFound("id", id.String())
+	}
+	return account, nil
+}
+
+func (r *memoryAccountRepository) GetByEmail(ctx context.Context, email string) (*Account, error) {
+	account, ok := r.find(func(a Account) bool { return a.Email == email })
+	if !ok {
+		return nil, helper.NewNotFound("email", email)
+	}
+	return account, nil
+}
+
+func (r *memoryAccountRepository) GetByAccountNum(ctx context.Context, accountNumber int64) (*Account, error) {
+	account, ok := r.find(func(a Account) bool { return a.AccountNumber == accountNumber })
+	if !ok {
+		return nil, helper.NewNotFound("account_number", fmt.Sprintf("%d", accountNumber))
+	}
+	return account, nil
+}
+
+// GetAll returns the accounts oldest first, without their passwords
+func (r *memoryAccountRepository) GetAll(ctx context.Context) ([]*Account, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	accounts := make([]*Account, 0, len(r.accounts))
+	for _, a := range r.accounts {
+		a := a
+		a.Password = ""
+		accounts = append(accounts, &a)
+	}
+	sort.Slice(accounts, func(i, j int) bool {
+		return accounts[i].CreatedAt.Before(accounts[j].CreatedAt)
+	})
+	return accounts, nil
+}
+
+// update applies fn to the stored account with id
+func (r *memoryAccountRepository) update(id uuid.UUID, field string, value string, fn func(a *Account)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	a, ok := r.accounts[id]
+	if !ok {
+		return helper.NewNotFound(field, value)
+	}
+	fn(&a)
+	a.UpdatedAt = time.Now()
+	r.accounts[id] = a
+	return nil
+}
+
+// Update mirrors the GORM Updates call, only non zero
+// fields are saved and password and balance are left untouched
+func (r *memoryAccountRepository) Update(ctx context.Context, account *Account) error {
+	return r.update(account.ID, "id", account.ID.String(), func(a *Account) {
+		if account.Email != "" {
+			a.Email = account.Email
+		}
+		if account.AccountNumber != 0 {
+			a.AccountNumber = account.AccountNumber
+		}
+		if account.FirstName != "" {
+			a.FirstName = account.FirstName
+		}
+		if account.LastName != "" {
+			a.LastName = account.LastName
+		}
+		if account.ImageUrl != "" {
+			a.ImageUrl = account.ImageUrl
+		}
+		if account.RoleID != 0 {
+			a.RoleID = account.RoleID
+		}
+		if account.IsActive {
+			a.IsActive = true
+		}
+		if account.Locale != "" {
+			a.Locale = account.Locale
+		}
+	})
+}
+
+func (r *memoryAccountRepository) ChangeStatus(ctx context.Context, account *Account) error {
+	event, err := newOutboxEvent(ctx, EventAccountActivated, account.ID, AccountActivated{AccountID: account.ID})
+	if err != nil {
+		return err
+	}
+	return r.update(account.ID, "id", account.ID.String(), func(a *Account) {
+		if !a.IsActive && account.IsActive {
+			r.outbox = append(r.outbox, *event)
+		}
+		a.IsActive = account.IsActive
+	})
+}
+
+func (r *memoryAccountRepository) UpdatePassword(ctx context.Context, email string, hashedPassword string) error {
+	account, ok := r.find(func(a Account) bool { return a.Email == email })
+	if !ok {
+		return helper.NewNotFound("email", email)
+	}
+	event, err := newOutboxEvent(ctx, EventPasswordChanged, account.ID, PasswordChanged{AccountID: account.ID})
+	if err != nil {
+		return err
+	}
+	return r.update(account.ID, "email", email, func(a *Account) {
+		a.Password = hashedPassword
+		a.MustChangePassword = false
+		r.outbox = append(r.outbox, *event)
+	})
+}
+
+func (r *memoryAccountRepository) UpdateImage(ctx context.Context, id uuid.UUID, imageURL string) error {
+	return r.update(id, "id", id.String(), func(a *Account) {
+		a.ImageUrl = imageURL
+	})
+}
+
+func (r *memoryAccountRepository) UpdatePhone(ctx context.Context, account *Account) error {
+	return r.update(account.ID, "id", account.ID.String(), func(a *Account) {
+		a.Phone, a.PhoneVerifiedAt, a.SMSAlerts = account.Phone, account.PhoneVerifiedAt, account.SMSAlerts
+	})
+}
+
+func (r *memoryAccountRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.accounts[id]; !ok {
+		return helper.NewNotFound("id", id.String())
+	}
+	delete(r.accounts, id)
+	return nil
+}
+
+// memoryRoleRepository is the in memory RoleRepository, role
+// assignments are saved through the account repository
+type memoryRoleRepository struct {
+	mu       sync.RWMutex
+	roles    map[uint]Role
+	accounts AccountRepository
+}
+
+// NewMemoryRoleRepository returns an in memory RoleRepository holding roles,
+// or the seeded admin and user roles if none are given
+func NewMemoryRoleRepository(accounts AccountRepository, roles ...Role) RoleRepository {
+	if len(roles) == 0 {
+		roles = []Role{
+			{ID: AdminRoleID, Name: "admin", Description: "Administrator role"},
+			{ID: UserRoleID, Name: "user", Description: "user role"},
+		}
+	}
+	r := &memoryRoleRepository{roles: make(map[uint]Role, len(roles)), accounts: accounts}
+	for _, role := range roles {
+		r.roles[role.ID] = role
+	}
+	return r
+}
+
+func (r *memoryRoleRepository) GetByID(ctx context.Context, id uint) (*Role, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	role, ok := r.roles[id]
+	if !ok {
+		return nil, helper.NewNotFound("id", fmt.Sprintf("%d", id))
+	}
+	return &role, nil
+}
+
+func (r *memoryRoleRepository) GetAll(ctx context.Context) ([]*Role, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	roles := make([]*Role, 0, len(r.roles))
+	for _, role := range r.roles {
+		role := role
+		roles = append(roles, &role)
+	}
+	sort.Slice(roles, func(i, j int) bool { return roles[i].ID < roles[j].ID })
+	return roles, nil
+}
+
+func (r *memoryRoleRepository) Assign(ctx context.Context, accountID uuid.UUID, roleID uint) error {
+	return r.accounts.Update(ctx, &Account{ID: accountID, RoleID: roleID})
+}
+
+func (r *memoryRoleRepository) GetAccounts(ctx context.Context, roleID uint) ([]*Account, error) {
+	all, err := r.accounts.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var accounts []*Account
+	for _, a := range all {
+		if a.RoleID == roleID {
+			accounts = append(accounts, a)
+		}
+	}
+	return accounts, nil
+}
+
+// memoryTokenRepository is the in memory TokenRepository,
+// expired refresh tokens are dropped as they are looked up
+type memoryTokenRepository struct {
+	mu     sync.Mutex
+	tokens map[string]time.Time
+}
+
+// NewMemoryTokenRepository returns an empty in memory TokenRepository
+func NewMemoryTokenRepository() TokenRepository {
+	return &memoryTokenRepository{tokens: make(map[string]time.Time)}
+}
+
+func (r *memoryTokenRepository) SetRefreshToken(ctx context.Context, accountID string, tokenID string, expiresIn time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tokens[fmt.Sprintf("%s:%s", accountID, tokenID)] = time.Now().Add(expiresIn)
+	return nil
+}
+
+func (r *memoryTokenRepository) DeleteRefreshToken(ctx context.Context, accountID string, tokenID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := fmt.Sprintf("%s:%s", accountID, tokenID)
+	expiresAt, ok := r.tokens[key]
+	delete(r.tokens, key)
+	if !ok || !time.Now().Before(expiresAt) {
+		return helper.NewAuthorization("Invalid refresh token").WithCode(helper.CodeInvalidToken)
+	}
+	return nil
+}
+
+func (r *memoryTokenRepository) DeleteUserRefreshTokens(ctx context.Context, accountID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for key := range r.tokens {
+		if strings.HasPrefix(key, accountID) {
+			delete(r.tokens, key)
+		}
+	}
+	return nil
+}
+
+// memoryLedgerRepository is the in memory LedgerRepository,
+// balances are changed on the in memory account repository
+type memoryLedgerRepository struct {
+	mu       sync.RWMutex
+	entries  []LedgerEntry
+	accounts *memoryAccountRepository
+}
+
+// NewMemoryLedgerRepository returns an empty in memory LedgerRepository
+// updating balances in accounts, which must be an in memory repository too
+func NewMemoryLedgerRepository(accounts AccountRepository) LedgerRepository {
+	memoryAccounts, ok := accounts.(*memoryAccountRepository)
+	if !ok {
+		panic("models: the in memory ledger needs the in memory account repository")
+	}
+	return &memoryLedgerRepository{accounts: memoryAccounts}
+}
+
+func (r *memoryLedgerRepository) Apply(ctx context.Context, entry *LedgerEntry) error {
+	if err := entry.validate(); err != nil {
+		return err
+	}
+	return r.apply(func() (*OutboxEvent, error) {
+		return newOutboxEvent(ctx, EventBalanceAdjusted, entry.AccountID, balanceAdjusted(entry))
+	}, entry)
+}
+
+func (r *memoryLedgerRepository) Transfer(ctx context.Context, debit *LedgerEntry, credit *LedgerEntry) error {
+	if err := validateTransfer(debit, credit); err != nil {
+		return err
+	}
+	return r.apply(func() (*OutboxEvent, error) {
+		return newOutboxEvent(ctx, EventTransferCompleted, debit.AccountID, transferCompleted(debit, credit))
+	}, debit, credit)
+}
+
+// apply changes the balances by entries and records them along with the
+// event of newEvent, all or nothing. newEvent is called once the entries
+// have their IDs and balances
+func (r *memoryLedgerRepository) apply(newEvent func() (*OutboxEvent, error), entries ...*LedgerEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// the account lock is held across the check and the update, like the
+	// conditional UPDATE in the GORM repository
+	r.accounts.mu.Lock()
+	defer r.accounts.mu.Unlock()
+
+	balances := make(map[uuid.UUID]float64, len(entries))
+	for _, entry := range entries {
+		if entry.Reference != nil {
+			for _, e := range r.entries {
+				if e.Reference != nil && *e.Reference == *entry.Reference {
+					return helper.NewConflict("reference", *entry.Reference)
+				}
+			}
+		}
+		a, ok := r.accounts.accounts[entry.AccountID]
+		if !ok {
+			return helper.NewNotFound("id", entry.AccountID.String())
+		}
+		balance := math.Round((a.Balance+entry.signedAmount())*100) / 100
+		if balance < 0 {
+			return helper.NewBadRequest("insufficient funds").WithCode(helper.CodeInsufficientFunds)
+		}
+		balances[entry.AccountID] = balance
+	}
+
+	now := time.Now()
+	for _, entry := range entries {
+		if entry.ID == uuid.Nil {
+			entry.ID = uuid.New()
+		}
+		entry.CreatedAt = now
+		entry.BalanceAfter = balances[entry.AccountID]
+	}
+	event, err := newEvent()
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		a := r.accounts.accounts[entry.AccountID]
+		a.Balance = entry.BalanceAfter
+		a.UpdatedAt = now
+		r.accounts.accounts[a.ID] = a
+		r.entries = append(r.entries, *entry)
+	}
+	r.accounts.outbox = append(r.accounts.outbox, *event)
+	return nil
+}
+
+func (r *memoryLedgerRepository) ListByAccount(ctx context.Context, accountID uuid.UUID, from time.Time, to time.Time) ([]*LedgerEntry, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var entries []*LedgerEntry
+	for _, e := range r.entries {
+		if e.AccountID == accountID && !e.CreatedAt.Before(from) && e.CreatedAt.Before(to) {
+			e := e
+			entries = append(entries, &e)
+		}
+	}
+	return entries, nil
+}
+
+// memoryAuditRepository is the in memory AuditRepository
+type memoryAuditRepository struct {
+	mu      sync.RWMutex
+	records []AuditRecord
+}
+
+// NewMemoryAuditRepository returns an empty in memory AuditRepository
+func NewMemoryAuditRepository() AuditRepository {
+	return &memoryAuditRepository{}
+}
+
+func (r *memoryAuditRepository) Record(ctx context.Context, record *AuditRecord) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if record.ID == uuid.Nil {
+		record.ID = uuid.New()
+	}
+	record.CreatedAt = time.Now()
+	r.records = append(r.records, *record)
+	return nil
+}
+
+// List returns the matching records newest first
+func (r *memoryAuditRepository) List(ctx context.Context, filter AuditFilter) ([]*AuditRecord, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var records []*AuditRecord
+	for i := len(r.records) - 1; i >= 0; i-- {
+		record := r.records[i]
+		if filter.TargetType != "" && record.TargetType != filter.TargetType {
+			continue
+		}
+		if filter.TargetID != "" && record.TargetID != filter.TargetID {
+			continue
+		}
+		records = append(records, &record)
+		if filter.Limit > 0 && len(records) == filter.Limit {
+			break
+		}
+	}
+	return records, nil
+}
+
+// memoryScheduleRepository is the in memory ScheduleRepository
+type memoryScheduleRepository struct {
+	mu        sync.RWMutex
+	schedules map[uuid.UUID]ScheduledTransfer
+}
+
+// NewMemoryScheduleRepository returns an empty in memory ScheduleRepository
+func NewMemoryScheduleRepository() ScheduleRepository {
+	return &memoryScheduleRepository{schedules: make(map[uuid.UUID]ScheduledTransfer)}
+}
+
+func (r *memoryScheduleRepository) Create(ctx context.Context, schedule *ScheduledTransfer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if schedule.ID == uuid.Nil {
+		schedule.ID = uuid.New()
+	}
+	now := time.Now()
+	schedule.CreatedAt, schedule.UpdatedAt = now, now
+	r.schedules[schedule.ID] = *schedule
+	return nil
+}
+
+func (r *memoryScheduleRepository) GetByID(ctx context.Context, id uuid.UUID) (*ScheduledTransfer, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	schedule, ok := r.schedules[id]
+	if !ok {
+		return nil, helper.NewNotFound("schedule", id.String())
+	}
+	return &schedule, nil
+}
+
+func (r *memoryScheduleRepository) ListByAccount(ctx context.Context, accountID uuid.UUID) ([]*ScheduledTransfer, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var schedules []*ScheduledTransfer
+	for _, s := range r.schedules {
+		if s.AccountID == accountID {
+			s := s
+			schedules = append(schedules, &s)
+		}
+	}
+	sort.Slice(schedules, func(i, j int) bool { return schedules[i].CreatedAt.After(schedules[j].CreatedAt) })
+	return schedules, nil
+}
+
+func (r *memoryScheduleRepository) Update(ctx context.Context, schedule *ScheduledTransfer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.schedules[schedule.ID]
+	if !ok || stored.Version != schedule.Version {
+		return helper.NewConflict("schedule", schedule.ID.String())
+	}
+	schedule.Version++
+	schedule.UpdatedAt = time.Now()
+	schedule.CreatedAt, schedule.AccountID = stored.CreatedAt, stored.AccountID
+	r.schedules[schedule.ID] = *schedule
+	return nil
+}
+
+func (r *memoryScheduleRepository) Due(ctx context.Context, now time.Time, limit int) ([]*ScheduledTransfer, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var schedules []*ScheduledTransfer
+	for _, s := range r.schedules {
+		if s.Status == ScheduleActive && s.NextRunAt != nil && !s.NextRunAt.After(now) {
+			s := s
+			schedules = append(schedules, &s)
+		}
+	}
+	sort.Slice(schedules, func(i, j int) bool { return schedules[i].NextRunAt.Before(*schedules[j].NextRunAt) })
+	if len(schedules) > limit {
+		schedules = schedules[:limit]
+	}
+	return schedules, nil
+}
+
+func (r *memoryScheduleRepository) Claim(ctx context.Context, schedule *ScheduledTransfer, until time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.schedules[schedule.ID]
+	if !ok || stored.Version != schedule.Version || stored.Status != ScheduleActive {
+		return false, nil
+	}
+	stored.NextRunAt = &until
+	stored.Version++
+	stored.UpdatedAt = time.Now()
+	r.schedules[schedule.ID] = stored
+	schedule.NextRunAt = &until
+	schedule.Version = stored.Version
+	return true, nil
+}
+
+// memoryOutboxRepository is the in memory OutboxRepository, reading
+// the outbox the in memory account and ledger repositories write to
+type memoryOutboxRepository struct {
+	accounts *memoryAccountRepository
+}
+
+// NewMemoryOutboxRepository returns an OutboxRepository over the events
+// recorded by accounts, which must be an in memory repository too
+func NewMemoryOutboxRepository(accounts AccountRepository) OutboxRepository {
+	memoryAccounts, ok := accounts.(*memoryAccountRepository)
+	if !ok {
+		panic("models: the in memory outbox needs the in memory account repository")
+	}
+	return &memoryOutboxRepository{accounts: memoryAccounts}
+}
+
+// Pending returns up to limit unpublished events due an attempt and not
+// leased to a relay, oldest first
+func (r *memoryOutboxRepository) Pending(ctx context.Context, now time.Time, limit int) ([]*OutboxEvent, error) {
+	r.accounts.mu.RLock()
+	defer r.accounts.mu.RUnlock()
+
+	var events []*OutboxEvent
+	for _, e := range r.accounts.outbox {
+		if e.PublishedAt == nil && !e.NextAttemptAt.After(now) && (e.LockedUntil == nil || !e.LockedUntil.After(now)) {
+			e := e
+			events = append(events, &e)
+			if len(events) == limit {
+				break
+			}
+		}
+	}
+	return events, nil
+}
+
+// event applies fn to the stored event with id, reporting whether there is one
+func (r *memoryOutboxRepository) event(id uuid.UUID, fn func(e *OutboxEvent) bool) bool {
+	r.accounts.mu.Lock()
+	defer r.accounts.mu.Unlock()
+
+	for i := range r.accounts.outbox {
+		if r.accounts.outbox[i].ID == id {
+			return fn(&r.accounts.outbox[i])
+		}
+	}
+	return false
+}
+
+func (r *memoryOutboxRepository) Claim(ctx context.Context, event *OutboxEvent, now time.Time, until time.Time) (bool, error) {
+	claimed := r.event(event.ID, func(e *OutboxEvent) bool {
+		if e.PublishedAt != nil || (e.LockedUntil != nil && e.LockedUntil.After(now)) {
+			return false
+		}
+		e.LockedUntil = &until
+		return true
+	})
+	if claimed {
+		event.LockedUntil = &until
+	}
+	return claimed, nil
+}
+
+func (r *memoryOutboxRepository) MarkPublished(ctx context.Context, id uuid.UUID, at time.Time) error {
+	r.event(id, func(e *OutboxEvent) bool {
+		e.PublishedAt, e.LockedUntil = &at, nil
+		return true
+	})
+	return nil
+}
+
+func (r *memoryOutboxRepository) MarkFailed(ctx context.Context, id uuid.UUID, nextAttemptAt time.Time, lastError string) error {
+	r.event(id, func(e *OutboxEvent) bool {
+		e.Attempts++
+		e.NextAttemptAt, e.LastError, e.LockedUntil = nextAttemptAt, lastError, nil
+		return true
+	})
+	return nil
+}
+
+func (r *memoryOutboxRepository) DeletePublished(ctx context.Context, before time.Time) (int64, error) {
+	r.accounts.mu.Lock()
+	defer r.accounts.mu.Unlock()
+
+	kept := r.accounts.outbox[:0]
+	for _, e := range r.accounts.outbox {
+		if e.PublishedAt == nil || !e.PublishedAt.Before(before) {
+			kept = append(kept, e)
+		}
+	}
+	deleted := int64(len(r.accounts.outbox) - len(kept))
+	r.accounts.outbox = kept
+	return deleted, nil
+}
+
+// memoryWebhookRepository is the in memory WebhookRepository
+type memoryWebhookRepository struct {
+	mu         sync.RWMutex
+	endpoints  map[uuid.UUID]WebhookEndpoint
+	deliveries []WebhookDelivery
+	attempts   []WebhookAttempt
+}
+
+// NewMemoryWebhookRepository returns an empty in memory WebhookRepository
+func NewMemoryWebhookRepository() WebhookRepository {
+	return &memoryWebhookRepository{endpoints: make(map[uuid.UUID]WebhookEndpoint)}
+}
+
+func (r *memoryWebhookRepository) CreateEndpoint(ctx context.Context, endpoint *WebhookEndpoint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if endpoint.ID == uuid.Nil {
+		endpoint.ID = uuid.New()
+	}
+	now := time.Now()
+	endpoint.CreatedAt, endpoint.UpdatedAt = now, now
+	endpoint.Events = append([]string(nil), endpoint.Events...)
+	r.endpoints[endpoint.ID] = *endpoint
+	return nil
+}
+
+func (r *memoryWebhookRepository) GetEndpoint(ctx context.Context, id uuid.UUID) (*WebhookEndpoint, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	endpoint, ok := r.endpoints[id]
+	if !ok {
+		return nil, helper.NewNotFound("webhook", id.String())
+	}
+	endpoint.Events = append([]string(nil), endpoint.Events...)
+	return &endpoint, nil
+}
+
+// ListEndpoints returns the account's endpoints, oldest first
+func (r *memoryWebhookRepository) ListEndpoints(ctx context.Context, accountID uuid.UUID) ([]*WebhookEndpoint, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var endpoints []*WebhookEndpoint
+	for _, e := range r.endpoints {
+		if e.AccountID == accountID {
+			e := e
+			e.Events = append([]string(nil), e.Events...)
+			endpoints = append(endpoints, &e)
+		}
+	}
+	sort.Slice(endpoints, func(i, j int) bool {
+		return endpoints[i].CreatedAt.Before(endpoints[j].CreatedAt)
+	})
+	return endpoints, nil
+}
+
+func (r *memoryWebhookRepository) UpdateEndpoint(ctx context.Context, endpoint *WebhookEndpoint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.endpoints[endpoint.ID]
+	if !ok {
+		return helper.NewNotFound("webhook", endpoint.ID.String())
+	}
+	endpoint.UpdatedAt = time.Now()
+	updated := *endpoint
+	updated.CreatedAt, updated.AccountID = stored.CreatedAt, stored.AccountID
+	updated.Events = append([]string(nil), endpoint.Events...)
+	r.endpoints[endpoint.ID] = updated
+	return nil
+}
+
+// DeleteEndpoint removes the endpoint along with its deliveries and their attempts
+func (r *memoryWebhookRepository) DeleteEndpoint(ctx context.Context, id uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.endpoints[id]; !ok {
+		return helper.NewNotFound("webhook", id.String())
+	}
+	delete(r.endpoints, id)
+	deleted := make(map[uuid.UUID]bool)
+	deliveries := r.deliveries[:0]
+	for _, d := range r.deliveries {
+		if d.EndpointID == id {
+			deleted[d.ID] = true
+			continue
+		}
+		deliveries = append(deliveries, d)
+	}
+	r.deliveries = deliveries
+	attempts := r.attempts[:0]
+	for _, a := range r.attempts {
+		if !deleted[a.DeliveryID] {
+			attempts = append(attempts, a)
+		}
+	}
+	r.attempts = attempts
+	return nil
+}
+
+func (r *memoryWebhookRepository) RecordResult(ctx context.Context, id uuid.UUID, succeeded bool, disableAfter int, at time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	endpoint, ok := r.endpoints[id]
+	if !ok {
+		return false, nil
+	}
+	disabled := false
+	if succeeded {
+		endpoint.ConsecutiveFailures = 0
+	} else {
+		endpoint.ConsecutiveFailures++
+		if endpoint.Status == WebhookActive && endpoint.ConsecutiveFailures >= disableAfter {
+			endpoint.Status = WebhookDisabled
+			endpoint.DisabledAt = &at
+			endpoint.DisabledReason = "too many consecutive failed deliveries"
+			endpoint.UpdatedAt = at
+			disabled = true
+		}
+	}
+	r.endpoints[id] = endpoint
+	return disabled, nil
+}
+
+func (r *memoryWebhookRepository) CreateDelivery(ctx context.Context, delivery *WebhookDelivery) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, d := range r.deliveries {
+		if d.EndpointID == delivery.EndpointID && d.EventID == delivery.EventID {
+			return false, nil
+		}
+	}
+	if delivery.ID == uuid.Nil {
+		delivery.ID = uuid.New()
+	}
+	now := time.Now()
+	delivery.CreatedAt, delivery.UpdatedAt = now, now
+	r.deliveries = append(r.deliveries, *delivery)
+	return true, nil
+}
+
+// findDelivery returns the delivery matching match, not found reports value
+func (r *memoryWebhookRepository) findDelivery(value string, match func(d WebhookDelivery) bool) (*WebhookDelivery, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, d := range r.deliveries {
+		if match(d) {
+			return &d, nil
+		}
+	}
+	return nil, helper.NewNotFound("delivery", value)
+}
+
+func (r *memoryWebhookRepository) GetDelivery(ctx context.Context, id uuid.UUID) (*WebhookDelivery, error) {
+	return r.findDelivery(id.String(), func(d WebhookDelivery) bool { return d.ID == id })
+}
+
+func (r *memoryWebhookRepository) GetDeliveryByEvent(ctx context.Context, endpointID uuid.UUID, eventID uuid.UUID) (*WebhookDelivery, error) {
+	return r.findDelivery(eventID.String(), func(d WebhookDelivery) bool {
+		return d.EndpointID == endpointID && d.EventID == eventID
+	})
+}
+
+// ListDeliveries returns up to limit of the endpoint's deliveries, newest first
+func (r *memoryWebhookRepository) ListDeliveries(ctx context.Context, endpointID uuid.UUID, limit int) ([]*WebhookDelivery, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var deliveries []*WebhookDelivery
+	for i := len(r.deliveries) - 1; i >= 0 && len(deliveries) < limit; i-- {
+		if d := r.deliveries[i]; d.EndpointID == endpointID {
+			deliveries = append(deliveries, &d)
+		}
+	}
+	return deliveries, nil
+}
+
+func (r *memoryWebhookRepository) UpdateDelivery(ctx context.Context, delivery *WebhookDelivery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.updateDelivery(delivery)
+}
+
+// updateDelivery saves the delivery's status, the caller holds the lock
+func (r *memoryWebhookRepository) updateDelivery(delivery *WebhookDelivery) error {
+	for i, d := range r.deliveries {
+		if d.ID == delivery.ID {
+			delivery.UpdatedAt = time.Now()
+			updated := *delivery
+			updated.CreatedAt, updated.EndpointID, updated.EventID = d.CreatedAt, d.EndpointID, d.EventID
+			updated.EventType, updated.Payload = d.EventType, d.Payload
+			r.deliveries[i] = updated
+			return nil
+		}
+	}
+	return helper.NewNotFound("delivery", delivery.ID.String())
+}
+
+func (r *memoryWebhookRepository) RecordAttempt(ctx context.Context, delivery *WebhookDelivery, attempt *WebhookAttempt) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.updateDelivery(delivery); err != nil {
+		return err
+	}
+	if attempt.ID == uuid.Nil {
+		attempt.ID = uuid.New()
+	}
+	attempt.DeliveryID = delivery.ID
+	attempt.CreatedAt = time.Now()
+	r.attempts = append(r.attempts, *attempt)
+	return nil
+}
+
+// ListAttempts returns the delivery's attempts, oldest first
+func (r *memoryWebhookRepository) ListAttempts(ctx context.Context, deliveryID uuid.UUID) ([]*WebhookAttempt, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var attempts []*WebhookAttempt
+	for _, a := range r.attempts {
+		if a.DeliveryID == deliveryID {
+			a := a
+			attempts = append(attempts, &a)
+		}
+	}
+	return attempts, nil
+}
+
+// memoryNotificationRepository is the in memory NotificationRepository
+type memoryNotificationRepository struct {
+	mu            sync.RWMutex
+	notifications []Notification
+	preferences   map[uuid.UUID]map[string]NotificationPreference
+}
+
+// NewMemoryNotificationRepository returns an empty in memory NotificationRepository
+func NewMemoryNotificationRepository() NotificationRepository {
+	return &memoryNotificationRepository{preferences: make(map[uuid.UUID]map[string]NotificationPreference)}
+}
+
+func (r *memoryNotificationRepository) CreateNotification(ctx context.Context, notification *Notification) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, n := range r.notifications {
+		if n.ID == notification.ID {
+			return false, nil
+		}
+	}
+	if notification.ID == uuid.Nil {
+		notification.ID = uuid.New()
+	}
+	if notification.CreatedAt.IsZero() {
+		notification.CreatedAt = time.Now()
+	}
+	r.notifications = append(r.notifications, copyNotification(*notification))
+	return true, nil
+}
+
+// ListNotifications returns a page of the account's notifications, newest first
+func (r *memoryNotificationRepository) ListNotifications(ctx context.Context, accountID uuid.UUID, filter NotificationFilter) ([]*Notification, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var notifications []*Notification
+	for _, n := range r.notifications {
+		if n.AccountID != accountID || (filter.UnreadOnly && n.ReadAt != nil) {
+			continue
+		}
+		if after := filter.After; after != nil && !notificationBefore(n, after) {
+			continue
+		}
+		n := copyNotification(n)
+		notifications = append(notifications, &n)
+	}
+	sort.Slice(notifications, func(i, j int) bool {
+		return notificationBefore(*notifications[j], &NotificationCursor{CreatedAt: notifications[i].CreatedAt, ID: notifications[i].ID})
+	})
+	if len(notifications) > filter.Limit {
+		notifications = notifications[:filter.Limit]
+	}
+	return notifications, nil
+}
+
+// notificationBefore reports whether n comes after cursor newest first,
+// ordered by when it was created then by ID like the GORM repository
+func notificationBefore(n Notification, cursor *NotificationCursor) bool {
+	if !n.CreatedAt.Equal(cursor.CreatedAt) {
+		return n.CreatedAt.Before(cursor.CreatedAt)
+	}
+	return n.ID.String() < cursor.ID.String()
+}
+
+func (r *memoryNotificationRepository) CountUnread(ctx context.Context, accountID uuid.UUID) (int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var count int64
+	for _, n := range r.notifications {
+		if n.AccountID == accountID && n.ReadAt == nil {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (r *memoryNotificationRepository) MarkRead(ctx context.Context, accountID uuid.UUID, id uuid.UUID, at time.Time) (*Notification, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, n := range r.notifications {
+		if n.ID == id && n.AccountID == accountID {
+			if n.ReadAt == nil {
+				r.notifications[i].ReadAt = &at
+			}
+			read := copyNotification(r.notifications[i])
+			return &read, nil
+		}
+	}
+	return nil, helper.NewNotFound("notification", id.String())
+}
+
+func (r *memoryNotificationRepository) MarkAllRead(ctx context.Context, accountID uuid.UUID, at time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var marked int64
+	for i, n := range r.notifications {
+		if n.AccountID == accountID && n.ReadAt == nil {
+			r.notifications[i].ReadAt = &at
+			marked++
+		}
+	}
+	return marked, nil
+}
+
+// ListPreferences returns the preferences the account saved, by category
+func (r *memoryNotificationRepository) ListPreferences(ctx context.Context, accountID uuid.UUID) ([]*NotificationPreference, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var preferences []*NotificationPreference
+	for _, p := range r.preferences[accountID] {
+		p := p
+		preferences = append(preferences, &p)
+	}
+	sort.Slice(preferences, func(i, j int) bool {
+		return preferences[i].Category < preferences[j].Category
+	})
+	return preferences, nil
+}
+
+func (r *memoryNotificationRepository) SavePreference(ctx context.Context, preference *NotificationPreference) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	preference.UpdatedAt = time.Now()
+	if r.preferences[preference.AccountID] == nil {
+		r.preferences[preference.AccountID] = make(map[string]NotificationPreference)
+	}
+	r.preferences[preference.AccountID][preference.Category] = *preference
+	return nil
+}
+
+// copyNotification copies n and its data so callers can't change what's stored
+func copyNotification(n Notification) Notification {
+	data := make(map[string]any, len(n.Data))
+	for k, v := range n.Data {
+		data[k] = v
+	}
+	n.Data = data
+	if n.ReadAt != nil {
+		readAt := *n.ReadAt
+		n.ReadAt = &readAt
+	}
+	return n
+}
+
+// memoryBeneficiaryRepository is the in memory BeneficiaryRepository
+type memoryBeneficiaryRepository struct {
+	mu            sync.RWMutex
+	beneficiaries map[uuid.UUID]Beneficiary
+}
+
+// NewMemoryBeneficiaryRepository returns an empty in memory BeneficiaryRepository
+func NewMemoryBeneficiaryRepository() BeneficiaryRepository {
+	return &memoryBeneficiaryRepository{beneficiaries: make(map[uuid.UUID]Beneficiary)}
+}
+
+func (r *memoryBeneficiaryRepository) Create(ctx context.Context, beneficiary *Beneficiary) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, b := range r.beneficiaries {
+		if b.AccountID == beneficiary.AccountID && b.AccountNumber == beneficiary.AccountNumber {
+			return helper.NewConflict("beneficiary", fmt.Sprintf("%d", beneficiary.AccountNumber))
+		}
+	}
+	if beneficiary.ID == uuid.Nil {
+		beneficiary.ID = uuid.New()
+	}
+	now := time.Now()
+	beneficiary.CreatedAt, beneficiary.UpdatedAt = now, now
+	r.beneficiaries[beneficiary.ID] = copyBeneficiary(*beneficiary)
+	return nil
+}
+
+func (r *memoryBeneficiaryRepository) GetByID(ctx context.Context, id uuid.UUID) (*Beneficiary, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	beneficiary, ok := r.beneficiaries[id]
+	if !ok {
+		return nil, helper.NewNotFound("beneficiary", id.String())
+	}
+	beneficiary = copyBeneficiary(beneficiary)
+	return &beneficiary, nil
+}
+
+func (r *memoryBeneficiaryRepository) GetByAccountNumber(ctx context.Context, accountID uuid.UUID, accountNumber int64) (*Beneficiary, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, b := range r.beneficiaries {
+		if b.AccountID == accountID && b.AccountNumber == accountNumber {
+			b = copyBeneficiary(b)
+			return &b, nil
+		}
+	}
+	return nil, helper.NewNotFound("beneficiary", fmt.Sprintf("%d", accountNumber))
+}
+
+// ListByAccount returns the account's beneficiaries, favourites first
+// then the most recently used, those never used last
+func (r *memoryBeneficiaryRepository) ListByAccount(ctx context.Context, accountID uuid.UUID) ([]*Beneficiary, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var beneficiaries []*Beneficiary
+	for _, b := range r.beneficiaries {
+		if b.AccountID == accountID {
+			b := copyBeneficiary(b)
+			beneficiaries = append(beneficiaries, &b)
+		}
+	}
+	sort.Slice(beneficiaries, func(i, j int) bool {
+		a, b := beneficiaries[i], beneficiaries[j]
+		switch {
+		case a.Favourite != b.Favourite:
+			return a.Favourite
+		case (a.LastUsedAt == nil) != (b.LastUsedAt == nil):
+			return a.LastUsedAt != nil
+		case a.LastUsedAt != nil && !a.LastUsedAt.Equal(*b.LastUsedAt):
+			return a.LastUsedAt.After(*b.LastUsedAt)
+		}
+		return a.CreatedAt.After(b.CreatedAt)
+	})
+	return beneficiaries, nil
+}
+
+func (r *memoryBeneficiaryRepository) Update(ctx context.Context, beneficiary *Beneficiary) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.beneficiaries[beneficiary.ID]
+	if !ok {
+		return helper.NewNotFound("beneficiary", beneficiary.ID.String())
+	}
+	beneficiary.UpdatedAt = time.Now()
+	stored.Nickname, stored.Favourite, stored.UpdatedAt = beneficiary.Nickname, beneficiary.Favourite, beneficiary.UpdatedAt
+	r.beneficiaries[beneficiary.ID] = stored
+	return nil
+}
+
+func (r *memoryBeneficiaryRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.beneficiaries[id]; !ok {
+		return helper.NewNotFound("beneficiary", id.String())
+	}
+	delete(r.beneficiaries, id)
+	return nil
+}
+
+func (r *memoryBeneficiaryRepository) MarkUsed(ctx context.Context, accountID uuid.UUID, accountNumber int64, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, b := range r.beneficiaries {
+		if b.AccountID == accountID && b.AccountNumber == accountNumber {
+			b.LastUsedAt = &at
+			r.beneficiaries[id] = b
+		}
+	}
+	return nil
+}
+
+// copyBeneficiary copies b so callers can't change what's stored
+func copyBeneficiary(b Beneficiary) Beneficiary {
+	if b.LastUsedAt != nil {
+		lastUsedAt := *b.LastUsedAt
+		b.LastUsedAt = &lastUsedAt
+	}
+	return b
+}
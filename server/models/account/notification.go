@@ -0,0 +1,188 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Cprime50/Gopay/helper"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Notification categories, each account chooses the channels of each
+const (
+	CategorySecurity     = "security"
+	CategoryTransactions = "transactions"
+	CategoryMarketing    = "marketing"
+)
+
+// NotificationCategories lists every category
+var NotificationCategories = []string{CategorySecurity, CategoryTransactions, CategoryMarketing}
+
+// Notification is an entry of an account's in app inbox. Data is the
+// notification's data, its text is rendered in the reader's language
+type Notification struct {
+	ID        uuid.UUID      `gorm:"type:uuid;primary_key" json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	AccountID uuid.UUID      `gorm:"type:uuid;not null;index" json:"-"`
+	Category  string         `gorm:"type:varchar(20);not null" json:"category"`
+	Event     string         `gorm:"type:varchar(100);not null" json:"event"`
+	Data      map[string]any `gorm:"type:text;not null;serializer:json" json:"data"`
+	ReadAt    *time.Time     `json:"read_at"`
+}
+
+// BeforeCreate generates the notification ID
+func (n *Notification) BeforeCreate(tx *gorm.DB) error {
+	if n.ID == uuid.Nil {
+		n.ID = uuid.New()
+	}
+	return nil
+}
+
+// NotificationCursor is where a page of the inbox ends, the next page
+// starts at the notification after it
+type NotificationCursor struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+// NotificationFilter selects a page of an account's inbox, newest first
+type NotificationFilter struct {
+	UnreadOnly bool
+	After      *NotificationCursor
+	Limit      int
+}
+
+// NotificationPreference is the channels an account has a category of
+// notifications sent on
+type NotificationPreference struct {
+	AccountID uuid.UUID `gorm:"type:uuid;primary_key" json:"-"`
+	Category  string    `gorm:"type:varchar(20);primary_key" json:"category"`
+	UpdatedAt time.Time `json:"-"`
+	InApp     bool      `gorm:"not null" json:"in_app"`
+	Email     bool      `gorm:"not null" json:"email"`
+	SMS       bool      `gorm:"column:sms;not null" json:"sms"`
+}
+
+// DefaultNotificationPreference is the channels of category for an
+// account that hasn't chosen them. Texts are only sent once the account
+// opts in to SMS alerts, marketing is only shown in the app
+func DefaultNotificationPreference(accountID uuid.UUID, category string) *NotificationPreference {
+	marketing := category == CategoryMarketing
+	return &NotificationPreference{AccountID: accountID, Category: category, InApp: true, Email: !marketing, SMS: !marketing}
+}
+
+// notificationRepository is the GORM backed NotificationRepository
+type notificationRepository struct {
+	db *gorm.DB
+}
+
+// NewNotificationRepository returns a NotificationRepository backed by db
+func NewNotificationRepository(db *gorm.DB) NotificationRepository {
+	return &notificationRepository{db: db}
+}
+
+// CreateNotification saves a new notification, reporting false without
+// saving it if one with its ID already exists
+func (r *notificationRepository) CreateNotification(ctx context.Context, notification *Notification) (bool, error) {
+	result := r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(notification)
+	if err := result.Error; err != nil {
+		helper.Logger(ctx).Error("error creating notification", "error", err)
+		return false, helper.NewInternal()
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// ListNotifications returns a page of the account's notifications, newest first
+func (r *notificationRepository) ListNotifications(ctx context.Context, accountID uuid.UUID, filter NotificationFilter) ([]*Notification, error) {
+	query := r.db.WithContext(ctx).Where("account_id = ?", accountID)
+	if filter.UnreadOnly {
+		query = query.Where("read_at IS NULL")
+	}
+	if after := filter.After; after != nil {
+		query = query.Where("created_at < ? OR (created_at = ? AND id < ?)", after.CreatedAt, after.CreatedAt, after.ID)
+	}
+	var notifications []*Notification
+	if err := query.Order("created_at DESC, id DESC").Limit(filter.Limit).Find(&notifications).Error; err != nil {
+		helper.Logger(ctx).Error("error querying notifications", "error", err)
+		return nil, helper.NewInternal()
+	}
+	return notifications, nil
+}
+
+func (r *notificationRepository) CountUnread(ctx context.Context, accountID uuid.UUID) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&Notification{}).
+		Where("account_id = ? AND read_at IS NULL", accountID).
+		Count(&count).Error
+	if err != nil {
+		helper.Logger(ctx).Error("error counting unread notifications", "error", err)
+		return 0, helper.NewInternal()
+	}
+	return count, nil
+}
+
+// MarkRead sets when the account's notification was read, if it wasn't already
+func (r *notificationRepository) MarkRead(ctx context.Context, accountID uuid.UUID, id uuid.UUID, at time.Time) (*Notification, error) {
+	var notification Notification
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&Notification{}).
+			Where("id = ? AND account_id = ? AND read_at IS NULL", id, accountID).
+			Update("read_at", at).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("id = ? AND account_id = ?", id, accountID).First(&notification).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, helper.NewNotFound("notification", id.String())
+	}
+	if err != nil {
+		helper.Logger(ctx).Error("error marking notification read", "error", err)
+		return nil, helper.NewInternal()
+	}
+	return &notification, nil
+}
+
+// MarkAllRead marks every unread notification of the account read, returning how many
+func (r *notificationRepository) MarkAllRead(ctx context.Context, accountID uuid.UUID, at time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).Model(&Notification{}).
+		Where("account_id = ? AND read_at IS NULL", accountID).
+		Update("read_at", at)
+	if err := result.Error; err != nil {
+		helper.Logger(ctx).Error("error marking notifications read", "error", err)
+		return 0, helper.NewInternal()
+	}
+	return result.RowsAffected, nil
+}
+
+// ListPreferences returns the preferences the account saved, categories
+// it hasn't chosen channels for are left out
+func (r *notificationRepository) ListPreferences(ctx context.Context, accountID uuid.UUID) ([]*NotificationPreference, error) {
+	var preferences []*NotificationPreference
+	if err := r.db.WithContext(ctx).Where("account_id = ?", accountID).Order("category").Find(&preferences).Error; err != nil {
+		helper.Logger(ctx).Error("error querying notification preferences", "error", err)
+		return nil, helper.NewInternal()
+	}
+	return preferences, nil
+}
+
+// SavePreference creates or replaces the account's preference for its category
+func (r *notificationRepository) SavePreference(ctx context.Context, preference *NotificationPreference) error {
+	preference.UpdatedAt = time.Now()
+	err := r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "account_id"}, {Name: "category"}},
+			DoUpdates: clause.AssignmentColumns([]string{"updated_at", "in_app", "email", "sms"}),
+		}).
+		Create(preference).Error
+	if err != nil {
+		helper.Logger(ctx).Error("error saving notification preference", "error", err)
+		return helper.NewInternal()
+	}
+	return nil
+}
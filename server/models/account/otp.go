@@ -1 +1,91 @@
 package models
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/Cprime50/Gopay/helper"
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+// OTP is a one time code sent to an account holder, stored hashed.
+// Target is what the code proves they have, eg the phone it was sent to
+type OTP struct {
+	Hash     string
+	Target   string
+	Attempts int
+	SentAt   time.Time
+}
+
+// otpRepository is the redis backed OTPRepository
+type otpRepository struct {
+	redis *redis.Client
+}
+
+// NewOTPRepository returns an OTPRepository backed by redis
+func NewOTPRepository(redis *redis.Client) OTPRepository {
+	return &otpRepository{redis: redis}
+}
+
+// otpKey is where the account's code for purpose is kept, it mustn't start
+// with the account ID or signing out would delete it with the refresh tokens
+func otpKey(purpose string, accountID uuid.UUID) string {
+	return "otp:" + purpose + ":" + accountID.String()
+}
+
+// SaveOTP stores the account's code for purpose until ttl, replacing any other
+func (r *otpRepository) SaveOTP(ctx context.Context, purpose string, accountID uuid.UUID, otp *OTP, ttl time.Duration) error {
+	key := otpKey(purpose, accountID)
+	_, err := r.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, key)
+		pipe.HSet(ctx, key, "hash", otp.Hash, "target", otp.Target, "attempts", otp.Attempts, "sent_at", otp.SentAt.UnixMilli())
+		pipe.Expire(ctx, key, ttl)
+		return nil
+	})
+	if err != nil {
+		helper.Logger(ctx).Error("could not save otp in redis", "account_id", accountID, "purpose", purpose, "error", err)
+		return helper.NewInternal()
+	}
+	return nil
+}
+
+// GetOTP returns the account's pending code for purpose, not found once it expires
+func (r *otpRepository) GetOTP(ctx context.Context, purpose string, accountID uuid.UUID) (*OTP, error) {
+	fields, err := r.redis.HGetAll(ctx, otpKey(purpose, accountID)).Result()
+	if err != nil {
+		helper.Logger(ctx).Error("could not get otp from redis", "account_id", accountID, "purpose", purpose, "error", err)
+		return nil, helper.NewInternal()
+	}
+	if len(fields) == 0 {
+		return nil, helper.NewNotFound("otp", purpose)
+	}
+	attempts, _ := strconv.Atoi(fields["attempts"])
+	sentAt, _ := strconv.ParseInt(fields["sent_at"], 10, 64)
+	return &OTP{
+		Hash:     fields["hash"],
+		Target:   fields["target"],
+		Attempts: attempts,
+		SentAt:   time.UnixMilli(sentAt),
+	}, nil
+}
+
+// AddOTPAttempt counts a wrong guess at the account's code, returning the guesses so far
+func (r *otpRepository) AddOTPAttempt(ctx context.Context, purpose string, accountID uuid.UUID) (int, error) {
+	attempts, err := r.redis.HIncrBy(ctx, otpKey(purpose, accountID), "attempts", 1).Result()
+	if err != nil {
+		helper.Logger(ctx).Error("could not count otp attempt in redis", "account_id", accountID, "purpose", purpose, "error", err)
+		return 0, helper.NewInternal()
+	}
+	return int(attempts), nil
+}
+
+// DeleteOTP removes the account's code for purpose, once used or guessed too often
+func (r *otpRepository) DeleteOTP(ctx context.Context, purpose string, accountID uuid.UUID) error {
+	if err := r.redis.Del(ctx, otpKey(purpose, accountID)).Err(); err != nil {
+		helper.Logger(ctx).Error("could not delete otp from redis", "account_id", accountID, "purpose", purpose, "error", err)
+		return helper.NewInternal()
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/Cprime50/Gopay/helper"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Domain events, written to the outbox in the same transaction as the
+// change they describe and published from there by the relay
+const (
+	EventAccountCreated    = "account.created"
+	EventAccountActivated  = "account.activated"
+	EventPasswordChanged   = "account.password_changed"
+	EventTransferCompleted = "transfer.completed"
+	EventBalanceAdjusted   = "account.balance_adjusted"
+)
+
+// AccountCreated is the payload of EventAccountCreated
+type AccountCreated struct {
+	AccountID     uuid.UUID `json:"account_id"`
+	Email         string    `json:"email"`
+	AccountNumber int64     `json:"account_number"`
+	Locale        string    `json:"locale"`
+}
+
+// AccountActivated is the payload of EventAccountActivated
+type AccountActivated struct {
+	AccountID uuid.UUID `json:"account_id"`
+}
+
+// PasswordChanged is the payload of EventPasswordChanged
+type PasswordChanged struct {
+	AccountID uuid.UUID `json:"account_id"`
+}
+
+// TransferCompleted is the payload of EventTransferCompleted
+type TransferCompleted struct {
+	FromAccountID uuid.UUID `json:"from_account_id"`
+	ToAccountID   uuid.UUID `json:"to_account_id"`
+	Amount        float64   `json:"amount"`
+	DebitEntryID  uuid.UUID `json:"debit_entry_id"`
+	CreditEntryID uuid.UUID `json:"credit_entry_id"`
+	Actor         string    `json:"actor"`
+}
+
+// BalanceAdjusted is the payload of EventBalanceAdjusted, an entry applied
+// on its own such as an operator's credit or debit. The operator isn't
+// included, the event is sent on to the account holder's webhooks
+type BalanceAdjusted struct {
+	AccountID    uuid.UUID `json:"account_id"`
+	EntryID      uuid.UUID `json:"entry_id"`
+	Type         string    `json:"type"`
+	Amount       float64   `json:"amount"`
+	BalanceAfter float64   `json:"balance_after"`
+	Reason       string    `json:"reason"`
+}
+
+// OutboxEvent is a domain event waiting to be published. AggregateID is
+// the account the event is about, Payload the JSON of the event's struct
+type OutboxEvent struct {
+	ID          uuid.UUID `gorm:"type:uuid;primary_key" json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	Type        string    `gorm:"type:varchar(100);not null" json:"type"`
+	AggregateID uuid.UUID `gorm:"type:uuid;not null" json:"aggregate_id"`
+	Payload     string    `gorm:"type:text;not null" json:"payload"`
+	// PublishedAt is set once every publisher has the event
+	PublishedAt   *time.Time `gorm:"index:idx_outbox_event_pending,priority:1" json:"published_at,omitempty"`
+	NextAttemptAt time.Time  `gorm:"not null;index:idx_outbox_event_pending,priority:2" json:"next_attempt_at"`
+	Attempts      int        `gorm:"not null;default:0" json:"attempts"`
+	LastError     string     `gorm:"type:varchar(255);not null" json:"last_error,omitempty"`
+	// LockedUntil leases the event to the relay publishing it
+	LockedUntil *time.Time `json:"-"`
+}
+
+// BeforeCreate generates the event ID
+func (e *OutboxEvent) BeforeCreate(tx *gorm.DB) error {
+	if e.ID == uuid.Nil {
+		e.ID = uuid.New()
+	}
+	return nil
+}
+
+// newOutboxEvent encodes payload as an event of eventType about aggregateID
+func newOutboxEvent(ctx context.Context, eventType string, aggregateID uuid.UUID, payload any) (*OutboxEvent, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		helper.Logger(ctx).Error("error encoding outbox event", "type", eventType, "error", err)
+		return nil, helper.NewInternal()
+	}
+	now := time.Now()
+	return &OutboxEvent{
+		ID:            uuid.New(),
+		CreatedAt:     now,
+		Type:          eventType,
+		AggregateID:   aggregateID,
+		Payload:       string(data),
+		NextAttemptAt: now,
+	}, nil
+}
+
+// writeOutbox records an event in the transaction tx making the change it describes
+func writeOutbox(ctx context.Context, tx *gorm.DB, eventType string, aggregateID uuid.UUID, payload any) error {
+	event, err := newOutboxEvent(ctx, eventType, aggregateID, payload)
+	if err != nil {
+		return err
+	}
+	if err := tx.Create(event).Error; err != nil {
+		helper.Logger(ctx).Error("error writing outbox event", "type", eventType, "error", err)
+		return helper.NewInternal()
+	}
+	return nil
+}
+
+// outboxRepository is the GORM backed OutboxRepository
+type outboxRepository struct {
+	db *gorm.DB
+}
+
+// NewOutboxRepository returns an OutboxRepository backed by db
+func NewOutboxRepository(db *gorm.DB) OutboxRepository {
+	return &outboxRepository{db: db}
+}
+
+// Pending returns up to limit unpublished events due an attempt and not
+// leased to a relay, oldest first
+func (r *outboxRepository) Pending(ctx context.Context, now time.Time, limit int) ([]*OutboxEvent, error) {
+	var events []*OutboxEvent
+	err := r.db.WithContext(ctx).
+		Where("published_at IS NULL AND next_attempt_at <= ? AND (locked_until IS NULL OR locked_until <= ?)", now, now).
+		Order("created_at").
+		Limit(limit).
+		Find(&events).Error
+	if err != nil {
+		helper.Logger(ctx).Error("error querying outbox", "error", err)
+		return nil, helper.NewInternal()
+	}
+	return events, nil
+}
+
+// Claim leases the event until the given time, reporting false if
+// another relay holds it or it's been published
+func (r *outboxRepository) Claim(ctx context.Context, event *OutboxEvent, now time.Time, until time.Time) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&OutboxEvent{}).
+		Where("id = ? AND published_at IS NULL AND (locked_until IS NULL OR locked_until <= ?)", event.ID, now).
+		Update("locked_until", until)
+	if err := result.Error; err != nil {
+		helper.Logger(ctx).Error("error claiming outbox event", "error", err)
+		return false, helper.NewInternal()
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+	event.LockedUntil = &until
+	return true, nil
+}
+
+// MarkPublished records the event as published, releasing its lease
+func (r *outboxRepository) MarkPublished(ctx context.Context, id uuid.UUID, at time.Time) error {
+	err := r.db.WithContext(ctx).Model(&OutboxEvent{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{"published_at": at, "locked_until": nil}).Error
+	if err != nil {
+		helper.Logger(ctx).Error("error marking outbox event published", "error", err)
+		return helper.NewInternal()
+	}
+	return nil
+}
+
+// MarkFailed records a failed attempt at the event, to be retried at nextAttemptAt
+func (r *outboxRepository) MarkFailed(ctx context.Context, id uuid.UUID, nextAttemptAt time.Time, lastError string) error {
+	err := r.db.WithContext(ctx).Model(&OutboxEvent{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"attempts":        gorm.Expr("attempts + 1"),
+			"next_attempt_at": nextAttemptAt,
+			"last_error":      lastError,
+			"locked_until":    nil,
+		}).Error
+	if err != nil {
+		helper.Logger(ctx).Error("error marking outbox event failed", "error", err)
+		return helper.NewInternal()
+	}
+	return nil
+}
+
+// DeletePublished removes events published before the given time, returning how many
+func (r *outboxRepository) DeletePublished(ctx context.Context, before time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).Where("published_at < ?", before).Delete(&OutboxEvent{})
+	if err := result.Error; err != nil {
+		helper.Logger(ctx).Error("error pruning outbox", "error", err)
+		return 0, helper.NewInternal()
+	}
+	return result.RowsAffected, nil
+}
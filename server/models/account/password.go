@@ -1,18 +1,22 @@
 package models
 
 import (
-	"log"
+	"context"
+	"fmt"
 
+	"go.opentelemetry.io/otel"
 	"golang.org/x/crypto/bcrypt"
 )
 
 // hash password before we save it
-func HashPassword(password string) (string, error) {
+func HashPassword(ctx context.Context, password string) (string, error) {
+	_, span := otel.Tracer("github.com/Cprime50/Gopay/models").Start(ctx, "bcrypt.hash")
+	defer span.End()
+
 	bytePassword := []byte(password)
 	passwordHash, err := bcrypt.GenerateFromPassword(bytePassword, bcrypt.DefaultCost)
 	if err != nil {
-		log.Println("bcrypting password failed", err)
-		return "", err
+		return "", fmt.Errorf("bcrypting password failed: %w", err)
 	}
 	hashedPw := string(passwordHash)
 
@@ -0,0 +1,147 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AccountRepository persists accounts
+type AccountRepository interface {
+	Create(ctx context.Context, account *Account) error
+	GetByID(ctx context.Context, id uuid.UUID) (*Account, error)
+	GetByEmail(ctx context.Context, email string) (*Account, error)
+	GetByAccountNum(ctx context.Context, accountNumber int64) (*Account, error)
+	GetAll(ctx context.Context) ([]*Account, error)
+	Update(ctx context.Context, account *Account) error
+	ChangeStatus(ctx context.Context, account *Account) error
+	UpdatePassword(ctx context.Context, email string, hashedPassword string) error
+	UpdateImage(ctx context.Context, id uuid.UUID, imageURL string) error
+	UpdatePhone(ctx context.Context, account *Account) error
+	Delete(ctx context.Context, id uuid.UUID) error
+}
+
+// RoleRepository persists roles and their assignment to accounts
+type RoleRepository interface {
+	GetByID(ctx context.Context, id uint) (*Role, error)
+	GetAll(ctx context.Context) ([]*Role, error)
+	Assign(ctx context.Context, accountID uuid.UUID, roleID uint) error
+	GetAccounts(ctx context.Context, roleID uint) ([]*Account, error)
+}
+
+// TokenRepository keeps track of the refresh tokens that are still valid
+type TokenRepository interface {
+	SetRefreshToken(ctx context.Context, accountID string, tokenID string, expiresIn time.Duration) error
+	DeleteRefreshToken(ctx context.Context, accountID string, tokenID string) error
+	DeleteUserRefreshTokens(ctx context.Context, accountID string) error
+}
+
+// OTPRepository keeps the one time codes sent to account holders, one
+// per account and purpose, until they expire
+type OTPRepository interface {
+	SaveOTP(ctx context.Context, purpose string, accountID uuid.UUID, otp *OTP, ttl time.Duration) error
+	GetOTP(ctx context.Context, purpose string, accountID uuid.UUID) (*OTP, error)
+	AddOTPAttempt(ctx context.Context, purpose string, accountID uuid.UUID) (int, error)
+	DeleteOTP(ctx context.Context, purpose string, accountID uuid.UUID) error
+}
+
+// SMSUsageRepository tracks the texts sent to accounts, which are billed per segment
+type SMSUsageRepository interface {
+	AddSegments(ctx context.Context, accountID uuid.UUID, day time.Time, segments int, limit int) (bool, error)
+	Sent(ctx context.Context, key string) (bool, error)
+	MarkSent(ctx context.Context, key string, ttl time.Duration) error
+}
+
+// LedgerRepository records balance changes, each entry is written
+// in the same database transaction as the balance update
+type LedgerRepository interface {
+	Apply(ctx context.Context, entry *LedgerEntry) error
+	Transfer(ctx context.Context, debit *LedgerEntry, credit *LedgerEntry) error
+	ListByAccount(ctx context.Context, accountID uuid.UUID, from time.Time, to time.Time) ([]*LedgerEntry, error)
+}
+
+// AuditRepository stores the trail of operator actions
+type AuditRepository interface {
+	Record(ctx context.Context, record *AuditRecord) error
+	List(ctx context.Context, filter AuditFilter) ([]*AuditRecord, error)
+}
+
+// Repositories are the repositories a Transactor hands to the function
+// it runs, what's done through them is committed or rolled back together
+type Repositories struct {
+	Accounts AccountRepository
+	Roles    RoleRepository
+	Ledger   LedgerRepository
+	Audit    AuditRepository
+}
+
+// Transactor runs a function in a transaction, committing it if the
+// function returns nil and rolling it back otherwise
+type Transactor interface {
+	Transaction(ctx context.Context, fn func(repos Repositories) error) error
+}
+
+// ScheduleRepository persists scheduled transfers. Update and Claim are
+// optimistic, they fail if the schedule changed since it was read
+type ScheduleRepository interface {
+	Create(ctx context.Context, schedule *ScheduledTransfer) error
+	GetByID(ctx context.Context, id uuid.UUID) (*ScheduledTransfer, error)
+	ListByAccount(ctx context.Context, accountID uuid.UUID) ([]*ScheduledTransfer, error)
+	Update(ctx context.Context, schedule *ScheduledTransfer) error
+	Due(ctx context.Context, now time.Time, limit int) ([]*ScheduledTransfer, error)
+	Claim(ctx context.Context, schedule *ScheduledTransfer, until time.Time) (bool, error)
+}
+
+// OutboxRepository reads the outbox the other repositories write domain
+// events to. Events are leased with Claim so concurrent relays don't
+// publish the same one at the same time
+type OutboxRepository interface {
+	Pending(ctx context.Context, now time.Time, limit int) ([]*OutboxEvent, error)
+	Claim(ctx context.Context, event *OutboxEvent, now time.Time, until time.Time) (bool, error)
+	MarkPublished(ctx context.Context, id uuid.UUID, at time.Time) error
+	MarkFailed(ctx context.Context, id uuid.UUID, nextAttemptAt time.Time, lastError string) error
+	DeletePublished(ctx context.Context, before time.Time) (int64, error)
+}
+
+// WebhookRepository persists webhook endpoints, their deliveries and
+// every attempt at them
+type WebhookRepository interface {
+	CreateEndpoint(ctx context.Context, endpoint *WebhookEndpoint) error
+	GetEndpoint(ctx context.Context, id uuid.UUID) (*WebhookEndpoint, error)
+	ListEndpoints(ctx context.Context, accountID uuid.UUID) ([]*WebhookEndpoint, error)
+	UpdateEndpoint(ctx context.Context, endpoint *WebhookEndpoint) error
+	DeleteEndpoint(ctx context.Context, id uuid.UUID) error
+	RecordResult(ctx context.Context, id uuid.UUID, succeeded bool, disableAfter int, at time.Time) (bool, error)
+	CreateDelivery(ctx context.Context, delivery *WebhookDelivery) (bool, error)
+	GetDelivery(ctx context.Context, id uuid.UUID) (*WebhookDelivery, error)
+	GetDeliveryByEvent(ctx context.Context, endpointID uuid.UUID, eventID uuid.UUID) (*WebhookDelivery, error)
+	ListDeliveries(ctx context.Context, endpointID uuid.UUID, limit int) ([]*WebhookDelivery, error)
+	UpdateDelivery(ctx context.Context, delivery *WebhookDelivery) error
+	RecordAttempt(ctx context.Context, delivery *WebhookDelivery, attempt *WebhookAttempt) error
+	ListAttempts(ctx context.Context, deliveryID uuid.UUID) ([]*WebhookAttempt, error)
+}
+
+// NotificationRepository persists the in app notification inbox and
+// the channels accounts chose for each category of notification
+type NotificationRepository interface {
+	CreateNotification(ctx context.Context, notification *Notification) (bool, error)
+	ListNotifications(ctx context.Context, accountID uuid.UUID, filter NotificationFilter) ([]*Notification, error)
+	CountUnread(ctx context.Context, accountID uuid.UUID) (int64, error)
+	MarkRead(ctx context.Context, accountID uuid.UUID, id uuid.UUID, at time.Time) (*Notification, error)
+	MarkAllRead(ctx context.Context, accountID uuid.UUID, at time.Time) (int64, error)
+	ListPreferences(ctx context.Context, accountID uuid.UUID) ([]*NotificationPreference, error)
+	SavePreference(ctx context.Context, preference *NotificationPreference) error
+}
+
+// BeneficiaryRepository persists the recipients accounts save, an
+// account saves each account number once
+type BeneficiaryRepository interface {
+	Create(ctx context.Context, beneficiary *Beneficiary) error
+	GetByID(ctx context.Context, id uuid.UUID) (*Beneficiary, error)
+	GetByAccountNumber(ctx context.Context, accountID uuid.UUID, accountNumber int64) (*Beneficiary, error)
+	ListByAccount(ctx context.Context, accountID uuid.UUID) ([]*Beneficiary, error)
+	Update(ctx context.Context, beneficiary *Beneficiary) error
+	Delete(ctx context.Context, id uuid.UUID) error
+	MarkUsed(ctx context.Context, accountID uuid.UUID, accountNumber int64, at time.Time) error
+}
@@ -0,0 +1,909 @@
+package models_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Cprime50/Gopay/db"
+	"github.com/Cprime50/Gopay/helper"
+	models "github.com/Cprime50/Gopay/models/account"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// The same checks run against the in memory and the GORM (on SQLite)
+// or redis (on miniredis) implementations so the stand-ins used in
+// tests can't drift from the real thing
+
+// openSQLite returns an in memory SQLite database with the schema and roles
+func openSQLite(t *testing.T) *gorm.DB {
+	gormDB, err := db.OpenSQLite(":memory:")
+	if err != nil {
+		t.Fatalf("opening sqlite: %v", err)
+	}
+	if err := gormDB.AutoMigrate(&models.Role{}, &models.Account{}, &models.LedgerEntry{}, &models.AuditRecord{}, &models.ScheduledTransfer{}, &models.OutboxEvent{},
+		&models.WebhookEndpoint{}, &models.WebhookDelivery{}, &models.WebhookAttempt{}, &models.Notification{}, &models.NotificationPreference{},
+		&models.Beneficiary{}); err != nil {
+		t.Fatalf("migrating sqlite: %v", err)
+	}
+	roles := []models.Role{
+		{ID: models.AdminRoleID, Name: "admin", Description: "Administrator role"},
+		{ID: models.UserRoleID, Name: "user", Description: "user role"},
+	}
+	if err := gormDB.Create(&roles).Error; err != nil {
+		t.Fatalf("seeding roles: %v", err)
+	}
+	return gormDB
+}
+
+func newSQLiteRepositories(t *testing.T) (models.AccountRepository, models.RoleRepository) {
+	gormDB := openSQLite(t)
+	return models.NewAccountRepository(gormDB), models.NewRoleRepository(gormDB)
+}
+
+func newMemoryRepositories(t *testing.T) (models.AccountRepository, models.RoleRepository) {
+	accounts := models.NewMemoryAccountRepository()
+	return accounts, models.NewMemoryRoleRepository(accounts)
+}
+
+func TestAccountRepositories(t *testing.T) {
+	for name, newRepositories := range map[string]func(*testing.T) (models.AccountRepository, models.RoleRepository){
+		"memory": newMemoryRepositories,
+		"sqlite": newSQLiteRepositories,
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			accounts, roles := newRepositories(t)
+
+			account := &models.Account{
+				Email:         "john@mail.com",
+				FirstName:     "John",
+				LastName:      "Doe",
+				Password:      "hash",
+				AccountNumber: 1234567890,
+				RoleID:        models.UserRoleID,
+			}
+			if err := accounts.Create(ctx, account); err != nil {
+				t.Fatalf("create: %v", err)
+			}
+			if account.ID == uuid.Nil {
+				t.Fatal("create: ID not populated")
+			}
+
+			got, err := accounts.GetByEmail(ctx, "john@mail.com")
+			if err != nil || got.ID != account.ID {
+				t.Fatalf("get by email: got %v, %v", got, err)
+			}
+			if _, err := accounts.GetByAccountNum(ctx, 1234567890); err != nil {
+				t.Fatalf("get by account number: %v", err)
+			}
+			if _, err := accounts.GetByID(ctx, uuid.New()); helper.Status(err) != http.StatusNotFound {
+				t.Fatalf("get missing: got %v, want not found", err)
+			}
+
+			if err := accounts.UpdatePassword(ctx, "john@mail.com", "new hash"); err != nil {
+				t.Fatalf("update password: %v", err)
+			}
+			if err := accounts.UpdatePassword(ctx, "nobody@mail.com", "hash"); helper.Status(err) != http.StatusNotFound {
+				t.Fatalf("update missing password: got %v, want not found", err)
+			}
+			if err := accounts.UpdateImage(ctx, account.ID, "https://img"); err != nil {
+				t.Fatalf("update image: %v", err)
+			}
+			phone, verifiedAt := "+2348012345678", time.Now().UTC().Truncate(time.Second)
+			account.Phone, account.PhoneVerifiedAt, account.SMSAlerts = &phone, &verifiedAt, true
+			if err := accounts.UpdatePhone(ctx, account); err != nil {
+				t.Fatalf("update phone: %v", err)
+			}
+
+			if err := roles.Assign(ctx, account.ID, models.AdminRoleID); err != nil {
+				t.Fatalf("assign: %v", err)
+			}
+			admins, err := roles.GetAccounts(ctx, models.AdminRoleID)
+			if err != nil || len(admins) != 1 || admins[0].ID != account.ID {
+				t.Fatalf("role accounts: got %v, %v", admins, err)
+			}
+			if _, err := roles.GetByID(ctx, 99); helper.Status(err) != http.StatusNotFound {
+				t.Fatalf("get missing role: got %v, want not found", err)
+			}
+
+			got, err = accounts.GetByID(ctx, account.ID)
+			if err != nil {
+				t.Fatalf("get by id: %v", err)
+			}
+			if got.Password != "new hash" || got.ImageUrl != "https://img" || got.RoleID != models.AdminRoleID || !got.PhoneVerified() || !got.SMSAlerts {
+				t.Fatalf("updates not saved: %+v", got)
+			}
+
+			if err := accounts.Delete(ctx, account.ID); err != nil {
+				t.Fatalf("delete: %v", err)
+			}
+			if err := accounts.Delete(ctx, account.ID); helper.Status(err) != http.StatusNotFound {
+				t.Fatalf("delete missing: got %v, want not found", err)
+			}
+		})
+	}
+}
+
+func TestTokenRepositories(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+
+	for name, tokens := range map[string]models.TokenRepository{
+		"memory": models.NewMemoryTokenRepository(),
+		"redis":  models.NewTokenRepository(rdb),
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			accountID := uuid.NewString()
+
+			for _, id := range []string{"one", "two"} {
+				if err := tokens.SetRefreshToken(ctx, accountID, id, time.Hour); err != nil {
+					t.Fatalf("set: %v", err)
+				}
+			}
+
+			if err := tokens.DeleteRefreshToken(ctx, accountID, "one"); err != nil {
+				t.Fatalf("delete: %v", err)
+			}
+			// a refresh token can only be used once
+			if err := tokens.DeleteRefreshToken(ctx, accountID, "one"); helper.Status(err) != http.StatusUnauthorized {
+				t.Fatalf("delete twice: got %v, want unauthorized", err)
+			}
+
+			if err := tokens.DeleteUserRefreshTokens(ctx, accountID); err != nil {
+				t.Fatalf("delete all: %v", err)
+			}
+			if err := tokens.DeleteRefreshToken(ctx, accountID, "two"); helper.Status(err) != http.StatusUnauthorized {
+				t.Fatalf("delete after revoke: got %v, want unauthorized", err)
+			}
+		})
+	}
+}
+
+func TestSMSRepositories(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	ctx := context.Background()
+	accountID := uuid.New()
+
+	otps := models.NewOTPRepository(rdb)
+	if _, err := otps.GetOTP(ctx, "phone", accountID); helper.Status(err) != http.StatusNotFound {
+		t.Fatalf("get missing otp: got %v, want not found", err)
+	}
+	sentAt := time.Now().Truncate(time.Millisecond)
+	if err := otps.SaveOTP(ctx, "phone", accountID, &models.OTP{Hash: "hash", Target: "+2348012345678", SentAt: sentAt}, time.Minute); err != nil {
+		t.Fatalf("save otp: %v", err)
+	}
+	// signing out deletes the keys starting with the account ID
+	if keys, _ := rdb.Keys(ctx, accountID.String()+"*").Result(); len(keys) != 0 {
+		t.Fatalf("otp stored under %v", keys)
+	}
+	if attempts, err := otps.AddOTPAttempt(ctx, "phone", accountID); attempts != 1 || err != nil {
+		t.Fatalf("add attempt: got %d, %v", attempts, err)
+	}
+	otp, err := otps.GetOTP(ctx, "phone", accountID)
+	if err != nil || otp.Hash != "hash" || otp.Target != "+2348012345678" || otp.Attempts != 1 || !otp.SentAt.Equal(sentAt) {
+		t.Fatalf("get otp: got %+v, %v", otp, err)
+	}
+	mr.FastForward(time.Minute)
+	if _, err := otps.GetOTP(ctx, "phone", accountID); helper.Status(err) != http.StatusNotFound {
+		t.Fatalf("get expired otp: got %v, want not found", err)
+	}
+
+	usage := models.NewSMSUsageRepository(rdb)
+	day := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for _, step := range []struct {
+		day      time.Time
+		segments int
+		want     bool
+	}{
+		{day, 3, true},
+		{day, 2, true},
+		// over the budget of 5, not counted
+		{day, 1, false},
+		{day.Add(24 * time.Hour), 5, true},
+	} {
+		if added, err := usage.AddSegments(ctx, accountID, step.day, step.segments, 5); added != step.want || err != nil {
+			t.Fatalf("add %d segments on %s: got %v, %v", step.segments, step.day.Format(time.DateOnly), added, err)
+		}
+	}
+
+	if sent, err := usage.Sent(ctx, "event:account"); sent || err != nil {
+		t.Fatalf("sent: got %v, %v", sent, err)
+	}
+	if err := usage.MarkSent(ctx, "event:account", time.Hour); err != nil {
+		t.Fatalf("mark sent: %v", err)
+	}
+	if sent, err := usage.Sent(ctx, "event:account"); !sent || err != nil {
+		t.Fatalf("sent after marking: got %v, %v", sent, err)
+	}
+}
+
+func TestLedgerRepositories(t *testing.T) {
+	type repositories struct {
+		accounts models.AccountRepository
+		ledger   models.LedgerRepository
+		audit    models.AuditRepository
+	}
+	for name, newRepositories := range map[string]func(*testing.T) repositories{
+		"memory": func(t *testing.T) repositories {
+			accounts := models.NewMemoryAccountRepository()
+			return repositories{accounts, models.NewMemoryLedgerRepository(accounts), models.NewMemoryAuditRepository()}
+		},
+		"sqlite": func(t *testing.T) repositories {
+			gormDB := openSQLite(t)
+			return repositories{models.NewAccountRepository(gormDB), models.NewLedgerRepository(gormDB), models.NewAuditRepository(gormDB)}
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			r := newRepositories(t)
+			start := time.Now().Add(-time.Minute)
+
+			account := &models.Account{
+				Email:         "john@mail.com",
+				FirstName:     "John",
+				LastName:      "Doe",
+				Password:      "hash",
+				AccountNumber: 1234567890,
+				Balance:       100,
+				RoleID:        models.UserRoleID,
+			}
+			if err := r.accounts.Create(ctx, account); err != nil {
+				t.Fatalf("create: %v", err)
+			}
+
+			credit := &models.LedgerEntry{AccountID: account.ID, Type: models.Credit, Amount: 50.255, Reason: "refund", Actor: "test"}
+			if err := r.ledger.Apply(ctx, credit); err != nil {
+				t.Fatalf("credit: %v", err)
+			}
+			if credit.Amount != 50.26 || credit.BalanceAfter != 150.26 {
+				t.Fatalf("credit: got amount %v balance %v", credit.Amount, credit.BalanceAfter)
+			}
+
+			// debits can't overdraw, and a failed one leaves no trace
+			overdraw := &models.LedgerEntry{AccountID: account.ID, Type: models.Debit, Amount: 200, Reason: "fee", Actor: "test"}
+			if err := r.ledger.Apply(ctx, overdraw); helper.Status(err) != http.StatusBadRequest {
+				t.Fatalf("overdraw: got %v, want bad request", err)
+			}
+			debit := &models.LedgerEntry{AccountID: account.ID, Type: models.Debit, Amount: 150.26, Reason: "fee", Actor: "test"}
+			if err := r.ledger.Apply(ctx, debit); err != nil {
+				t.Fatalf("debit: %v", err)
+			}
+
+			missing := &models.LedgerEntry{AccountID: uuid.New(), Type: models.Credit, Amount: 1, Reason: "refund", Actor: "test"}
+			if err := r.ledger.Apply(ctx, missing); helper.Status(err) != http.StatusNotFound {
+				t.Fatalf("missing account: got %v, want not found", err)
+			}
+			if err := r.ledger.Apply(ctx, &models.LedgerEntry{AccountID: account.ID, Type: models.Credit, Amount: 1, Actor: "test"}); helper.Status(err) != http.StatusBadRequest {
+				t.Fatalf("no reason: got %v, want bad request", err)
+			}
+
+			got, err := r.accounts.GetByID(ctx, account.ID)
+			if err != nil || got.Balance != 0 {
+				t.Fatalf("balance: got %v, %v", got, err)
+			}
+			entries, err := r.ledger.ListByAccount(ctx, account.ID, start, time.Now().Add(time.Minute))
+			if err != nil || len(entries) != 2 || entries[0].ID != credit.ID || entries[1].ID != debit.ID {
+				t.Fatalf("list: got %v, %v", entries, err)
+			}
+			if entries, _ := r.ledger.ListByAccount(ctx, account.ID, start, start.Add(time.Second)); len(entries) != 0 {
+				t.Fatalf("list outside the period: got %d entries", len(entries))
+			}
+
+			for _, action := range []string{"account.credit", "account.debit"} {
+				record := &models.AuditRecord{Actor: "test", Action: action, TargetType: "account", TargetID: account.ID.String()}
+				if err := r.audit.Record(ctx, record); err != nil {
+					t.Fatalf("record: %v", err)
+				}
+				time.Sleep(time.Millisecond)
+			}
+			records, err := r.audit.List(ctx, models.AuditFilter{TargetType: "account", TargetID: account.ID.String(), Limit: 1})
+			if err != nil || len(records) != 1 || records[0].Action != "account.debit" {
+				t.Fatalf("audit list: got %v, %v", records, err)
+			}
+		})
+	}
+}
+
+func TestTransactor(t *testing.T) {
+	type repositories struct {
+		accounts   models.AccountRepository
+		ledger     models.LedgerRepository
+		audit      models.AuditRepository
+		outbox     models.OutboxRepository
+		transactor models.Transactor
+	}
+	for name, newRepositories := range map[string]func(*testing.T) repositories{
+		"memory": func(t *testing.T) repositories {
+			accounts := models.NewMemoryAccountRepository()
+			ledger, audit := models.NewMemoryLedgerRepository(accounts), models.NewMemoryAuditRepository()
+			transactor := models.NewMemoryTransactor(accounts, models.NewMemoryRoleRepository(accounts), ledger, audit)
+			return repositories{accounts, ledger, audit, models.NewMemoryOutboxRepository(accounts), transactor}
+		},
+		"sqlite": func(t *testing.T) repositories {
+			gormDB := openSQLite(t)
+			return repositories{models.NewAccountRepository(gormDB), models.NewLedgerRepository(gormDB), models.NewAuditRepository(gormDB), models.NewOutboxRepository(gormDB), models.NewTransactor(gormDB)}
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			r := newRepositories(t)
+			start := time.Now().Add(-time.Minute)
+
+			account := &models.Account{Email: "john@mail.com", Password: "hash", AccountNumber: 1234567890, Balance: 100, RoleID: models.UserRoleID}
+			if err := r.accounts.Create(ctx, account); err != nil {
+				t.Fatalf("create: %v", err)
+			}
+			credit := func(fail error) error {
+				return r.transactor.Transaction(ctx, func(repos models.Repositories) error {
+					entry := &models.LedgerEntry{AccountID: account.ID, Type: models.Credit, Amount: 50, Reason: "refund", Actor: "test"}
+					if err := repos.Ledger.Apply(ctx, entry); err != nil {
+						return err
+					}
+					if err := repos.Audit.Record(ctx, &models.AuditRecord{Actor: "test", Action: "account.credit", TargetType: "account", TargetID: account.ID.String()}); err != nil {
+						return err
+					}
+					return fail
+				})
+			}
+
+			// a failed transaction leaves no balance change, entry, record or event
+			failure := helper.NewInternal()
+			if err := credit(failure); err != failure {
+				t.Fatalf("failed transaction: got %v, want %v", err, failure)
+			}
+			check := func(balance float64, entries int, records int, events []string) {
+				t.Helper()
+				got, err := r.accounts.GetByID(ctx, account.ID)
+				if err != nil || got.Balance != balance {
+					t.Fatalf("balance: got %v, %v, want %v", got, err, balance)
+				}
+				if list, _ := r.ledger.ListByAccount(ctx, account.ID, start, time.Now().Add(time.Minute)); len(list) != entries {
+					t.Fatalf("entries: got %d, want %d", len(list), entries)
+				}
+				if list, _ := r.audit.List(ctx, models.AuditFilter{TargetID: account.ID.String()}); len(list) != records {
+					t.Fatalf("audit records: got %d, want %d", len(list), records)
+				}
+				pending, _ := r.outbox.Pending(ctx, time.Now().Add(time.Second), 10)
+				var types []string
+				for _, e := range pending {
+					types = append(types, e.Type)
+				}
+				if strings.Join(types, ",") != strings.Join(events, ",") {
+					t.Fatalf("events: got %v, want %v", types, events)
+				}
+			}
+			check(100, 0, 0, []string{models.EventAccountCreated})
+
+			if err := credit(nil); err != nil {
+				t.Fatalf("transaction: %v", err)
+			}
+			check(150, 1, 1, []string{models.EventAccountCreated, models.EventBalanceAdjusted})
+
+			pending, _ := r.outbox.Pending(ctx, time.Now().Add(time.Second), 10)
+			var payload models.BalanceAdjusted
+			if err := json.Unmarshal([]byte(pending[1].Payload), &payload); err != nil {
+				t.Fatalf("decoding payload: %v", err)
+			}
+			if pending[1].AggregateID != account.ID || payload.Type != models.Credit || payload.Amount != 50 || payload.BalanceAfter != 150 || payload.Reason != "refund" {
+				t.Fatalf("balance adjusted event: got %+v, %+v", pending[1], payload)
+			}
+		})
+	}
+}
+
+func TestScheduleRepositories(t *testing.T) {
+	type repositories struct {
+		accounts  models.AccountRepository
+		ledger    models.LedgerRepository
+		schedules models.ScheduleRepository
+	}
+	for name, newRepositories := range map[string]func(*testing.T) repositories{
+		"memory": func(t *testing.T) repositories {
+			accounts := models.NewMemoryAccountRepository()
+			return repositories{accounts, models.NewMemoryLedgerRepository(accounts), models.NewMemoryScheduleRepository()}
+		},
+		"sqlite": func(t *testing.T) repositories {
+			gormDB := openSQLite(t)
+			return repositories{models.NewAccountRepository(gormDB), models.NewLedgerRepository(gormDB), models.NewScheduleRepository(gormDB)}
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			r := newRepositories(t)
+
+			var accounts []*models.Account
+			for i, email := range []string{"john@mail.com", "jane@mail.com"} {
+				account := &models.Account{
+					Email:         email,
+					FirstName:     "John",
+					LastName:      "Doe",
+					Password:      "hash",
+					AccountNumber: int64(1234567890 + i),
+					Balance:       100,
+					RoleID:        models.UserRoleID,
+				}
+				if err := r.accounts.Create(ctx, account); err != nil {
+					t.Fatalf("create account: %v", err)
+				}
+				accounts = append(accounts, account)
+			}
+			from, to := accounts[0], accounts[1]
+
+			transfer := func(amount float64, reference string) error {
+				debitReference, creditReference := reference+":debit", reference+":credit"
+				return r.ledger.Transfer(ctx,
+					&models.LedgerEntry{AccountID: from.ID, Type: models.Debit, Amount: amount, Reason: "rent", Actor: "test", Reference: &debitReference},
+					&models.LedgerEntry{AccountID: to.ID, Type: models.Credit, Amount: amount, Reason: "rent", Actor: "test", Reference: &creditReference},
+				)
+			}
+			if err := transfer(60, "one"); err != nil {
+				t.Fatalf("transfer: %v", err)
+			}
+			// the same reference is only applied once
+			if err := transfer(60, "one"); helper.Status(err) != http.StatusConflict {
+				t.Fatalf("repeated transfer: got %v, want conflict", err)
+			}
+			// a transfer that can't be afforded leaves both balances alone
+			if err := transfer(60, "two"); helper.Status(err) != http.StatusBadRequest {
+				t.Fatalf("overdraw: got %v, want bad request", err)
+			}
+			for account, want := range map[*models.Account]float64{from: 40, to: 160} {
+				got, err := r.accounts.GetByID(ctx, account.ID)
+				if err != nil || got.Balance != want {
+					t.Fatalf("balance of %s: got %v, %v, want %v", account.Email, got, err, want)
+				}
+			}
+
+			now := time.Now().UTC().Truncate(time.Second)
+			due, later := now.Add(-time.Minute), now.Add(time.Hour)
+			schedules := []*models.ScheduledTransfer{
+				{AccountID: from.ID, ToAccountNumber: to.AccountNumber, Amount: 10, Frequency: models.Daily, StartAt: due, Status: models.ScheduleActive, DueAt: &due, NextRunAt: &due},
+				{AccountID: from.ID, ToAccountNumber: to.AccountNumber, Amount: 10, Frequency: models.Once, StartAt: later, Status: models.ScheduleActive, DueAt: &later, NextRunAt: &later},
+				{AccountID: from.ID, ToAccountNumber: to.AccountNumber, Amount: 10, Frequency: models.Once, StartAt: due, Status: models.SchedulePaused, DueAt: &due},
+			}
+			for _, schedule := range schedules {
+				if err := r.schedules.Create(ctx, schedule); err != nil {
+					t.Fatalf("create schedule: %v", err)
+				}
+				time.Sleep(time.Millisecond)
+			}
+
+			list, err := r.schedules.ListByAccount(ctx, from.ID)
+			if err != nil || len(list) != 3 || list[0].ID != schedules[2].ID {
+				t.Fatalf("list: got %v, %v", list, err)
+			}
+			if list, _ := r.schedules.ListByAccount(ctx, to.ID); len(list) != 0 {
+				t.Fatalf("list of another account: got %d schedules", len(list))
+			}
+			if _, err := r.schedules.GetByID(ctx, uuid.New()); helper.Status(err) != http.StatusNotFound {
+				t.Fatalf("get missing: got %v, want not found", err)
+			}
+
+			// only active schedules that are due are returned
+			found, err := r.schedules.Due(ctx, now, 10)
+			if err != nil || len(found) != 1 || found[0].ID != schedules[0].ID {
+				t.Fatalf("due: got %v, %v", found, err)
+			}
+
+			// a claim moves the next run on, so the schedule is no longer due,
+			// and a second claim with the stale copy fails
+			stale := *found[0]
+			claimed, err := r.schedules.Claim(ctx, found[0], later)
+			if err != nil || !claimed {
+				t.Fatalf("claim: got %v, %v", claimed, err)
+			}
+			if claimed, err := r.schedules.Claim(ctx, &stale, later); err != nil || claimed {
+				t.Fatalf("second claim: got %v, %v", claimed, err)
+			}
+			if found, _ := r.schedules.Due(ctx, now, 10); len(found) != 0 {
+				t.Fatalf("due after claim: got %d schedules", len(found))
+			}
+
+			// updates with a stale copy conflict rather than overwrite
+			found[0].Runs = 1
+			if err := r.schedules.Update(ctx, found[0]); err != nil {
+				t.Fatalf("update: %v", err)
+			}
+			stale.Status = models.ScheduleCancelled
+			if err := r.schedules.Update(ctx, &stale); helper.Status(err) != http.StatusConflict {
+				t.Fatalf("stale update: got %v, want conflict", err)
+			}
+			got, err := r.schedules.GetByID(ctx, found[0].ID)
+			if err != nil || got.Runs != 1 || got.Status != models.ScheduleActive || !got.NextRunAt.Equal(later) {
+				t.Fatalf("get after update: got %+v, %v", got, err)
+			}
+		})
+	}
+}
+
+func TestOutboxRepositories(t *testing.T) {
+	type repositories struct {
+		accounts models.AccountRepository
+		ledger   models.LedgerRepository
+		outbox   models.OutboxRepository
+	}
+	for name, newRepositories := range map[string]func(*testing.T) repositories{
+		"memory": func(t *testing.T) repositories {
+			accounts := models.NewMemoryAccountRepository()
+			return repositories{accounts, models.NewMemoryLedgerRepository(accounts), models.NewMemoryOutboxRepository(accounts)}
+		},
+		"sqlite": func(t *testing.T) repositories {
+			gormDB := openSQLite(t)
+			return repositories{models.NewAccountRepository(gormDB), models.NewLedgerRepository(gormDB), models.NewOutboxRepository(gormDB)}
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			r := newRepositories(t)
+
+			// every change writes its event, failed ones write none
+			john := &models.Account{Email: "john@mail.com", Password: "hash", AccountNumber: 1234567890, Balance: 100, RoleID: models.UserRoleID}
+			jane := &models.Account{Email: "jane@mail.com", Password: "hash", AccountNumber: 1234567891, RoleID: models.UserRoleID}
+			for _, account := range []*models.Account{john, jane} {
+				if err := r.accounts.Create(ctx, account); err != nil {
+					t.Fatalf("create: %v", err)
+				}
+			}
+			for _, active := range []bool{true, true, false} {
+				if err := r.accounts.ChangeStatus(ctx, &models.Account{ID: john.ID, IsActive: active}); err != nil {
+					t.Fatalf("change status: %v", err)
+				}
+			}
+			if err := r.accounts.UpdatePassword(ctx, "jane@mail.com", "new hash"); err != nil {
+				t.Fatalf("update password: %v", err)
+			}
+			if err := r.accounts.UpdatePassword(ctx, "nobody@mail.com", "new hash"); helper.Status(err) != http.StatusNotFound {
+				t.Fatalf("update missing password: got %v, want not found", err)
+			}
+			debit := &models.LedgerEntry{AccountID: john.ID, Type: models.Debit, Amount: 40, Reason: "transfer", Actor: "test"}
+			credit := &models.LedgerEntry{AccountID: jane.ID, Type: models.Credit, Amount: 40, Reason: "transfer", Actor: "test"}
+			if err := r.ledger.Transfer(ctx, debit, credit); err != nil {
+				t.Fatalf("transfer: %v", err)
+			}
+			overdraw := &models.LedgerEntry{AccountID: john.ID, Type: models.Debit, Amount: 400, Reason: "transfer", Actor: "test"}
+			if err := r.ledger.Transfer(ctx, overdraw, &models.LedgerEntry{AccountID: jane.ID, Type: models.Credit, Amount: 400, Reason: "transfer", Actor: "test"}); helper.Status(err) != http.StatusBadRequest {
+				t.Fatalf("overdraw: got %v, want bad request", err)
+			}
+
+			now := time.Now().Add(time.Second)
+			pending, err := r.outbox.Pending(ctx, now, 10)
+			if err != nil {
+				t.Fatalf("pending: %v", err)
+			}
+			var types []string
+			for _, e := range pending {
+				types = append(types, e.Type)
+			}
+			want := []string{models.EventAccountCreated, models.EventAccountCreated, models.EventAccountActivated, models.EventPasswordChanged, models.EventTransferCompleted}
+			if strings.Join(types, ",") != strings.Join(want, ",") {
+				t.Fatalf("pending: got %v, want %v", types, want)
+			}
+			transfer := pending[4]
+			var payload models.TransferCompleted
+			if err := json.Unmarshal([]byte(transfer.Payload), &payload); err != nil {
+				t.Fatalf("decoding payload: %v", err)
+			}
+			if transfer.AggregateID != john.ID || payload.ToAccountID != jane.ID || payload.Amount != 40 || payload.DebitEntryID != debit.ID || payload.CreditEntryID != credit.ID {
+				t.Fatalf("transfer event: got %+v, %+v", transfer, payload)
+			}
+
+			// a claimed event is leased to one relay until it's done with it
+			claimed, err := r.outbox.Claim(ctx, transfer, now, now.Add(time.Minute))
+			if err != nil || !claimed {
+				t.Fatalf("claim: got %v, %v", claimed, err)
+			}
+			if claimed, _ := r.outbox.Claim(ctx, transfer, now, now.Add(time.Minute)); claimed {
+				t.Fatal("claimed a leased event")
+			}
+			if pending, _ := r.outbox.Pending(ctx, now, 10); len(pending) != 4 {
+				t.Fatalf("pending while leased: got %d events", len(pending))
+			}
+
+			// failed events wait for their next attempt
+			if err := r.outbox.MarkFailed(ctx, transfer.ID, now.Add(time.Minute), "redis is down"); err != nil {
+				t.Fatalf("mark failed: %v", err)
+			}
+			if pending, _ := r.outbox.Pending(ctx, now, 10); len(pending) != 4 {
+				t.Fatalf("pending before the retry: got %d events", len(pending))
+			}
+			pending, _ = r.outbox.Pending(ctx, now.Add(time.Minute), 10)
+			if len(pending) != 5 || pending[4].Attempts != 1 || pending[4].LastError != "redis is down" {
+				t.Fatalf("pending at the retry: got %+v", pending)
+			}
+
+			// published events aren't pending, and are pruned after a while
+			for _, e := range pending {
+				if err := r.outbox.MarkPublished(ctx, e.ID, now); err != nil {
+					t.Fatalf("mark published: %v", err)
+				}
+			}
+			if pending, _ := r.outbox.Pending(ctx, now.Add(time.Hour), 10); len(pending) != 0 {
+				t.Fatalf("pending after publishing: got %d events", len(pending))
+			}
+			if claimed, _ := r.outbox.Claim(ctx, transfer, now.Add(time.Hour), now.Add(2*time.Hour)); claimed {
+				t.Fatal("claimed a published event")
+			}
+			if deleted, err := r.outbox.DeletePublished(ctx, now); err != nil || deleted != 0 {
+				t.Fatalf("delete before publishing: got %d, %v", deleted, err)
+			}
+			if deleted, err := r.outbox.DeletePublished(ctx, now.Add(time.Second)); err != nil || deleted != 5 {
+				t.Fatalf("delete published: got %d, %v", deleted, err)
+			}
+		})
+	}
+}
+
+func TestWebhookRepositories(t *testing.T) {
+	for name, newRepository := range map[string]func(*testing.T) models.WebhookRepository{
+		"memory": func(t *testing.T) models.WebhookRepository { return models.NewMemoryWebhookRepository() },
+		"sqlite": func(t *testing.T) models.WebhookRepository { return models.NewWebhookRepository(openSQLite(t)) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			webhooks := newRepository(t)
+			accountID := uuid.New()
+
+			endpoint := &models.WebhookEndpoint{AccountID: accountID, URL: "https://example.com/hook", Events: []string{"*"}, Secret: "whsec_test", Status: models.WebhookActive}
+			if err := webhooks.CreateEndpoint(ctx, endpoint); err != nil {
+				t.Fatalf("create endpoint: %v", err)
+			}
+			got, err := webhooks.GetEndpoint(ctx, endpoint.ID)
+			if err != nil || got.Secret != "whsec_test" || !got.Subscribes(models.EventTransferCompleted) {
+				t.Fatalf("get endpoint: got %+v, %v", got, err)
+			}
+			if _, err := webhooks.GetEndpoint(ctx, uuid.New()); helper.Status(err) != http.StatusNotFound {
+				t.Fatalf("get missing endpoint: got %v, want not found", err)
+			}
+			if list, _ := webhooks.ListEndpoints(ctx, accountID); len(list) != 1 {
+				t.Fatalf("list endpoints: got %d", len(list))
+			}
+
+			// a delivery is only created once per event
+			eventID := uuid.New()
+			delivery := &models.WebhookDelivery{EndpointID: endpoint.ID, EventID: eventID, EventType: models.EventTransferCompleted, Payload: "{}", Status: models.DeliveryPending}
+			if created, err := webhooks.CreateDelivery(ctx, delivery); err != nil || !created {
+				t.Fatalf("create delivery: got %v, %v", created, err)
+			}
+			again := &models.WebhookDelivery{EndpointID: endpoint.ID, EventID: eventID, EventType: models.EventTransferCompleted, Payload: "{}", Status: models.DeliveryPending}
+			if created, err := webhooks.CreateDelivery(ctx, again); err != nil || created {
+				t.Fatalf("create duplicate delivery: got %v, %v", created, err)
+			}
+			if got, err := webhooks.GetDeliveryByEvent(ctx, endpoint.ID, eventID); err != nil || got.ID != delivery.ID {
+				t.Fatalf("get delivery by event: got %+v, %v", got, err)
+			}
+
+			now := time.Now().UTC()
+			delivery.Attempts = 1
+			delivery.LastAttemptAt = &now
+			delivery.LastStatusCode = http.StatusInternalServerError
+			if err := webhooks.RecordAttempt(ctx, delivery, &models.WebhookAttempt{StatusCode: http.StatusInternalServerError, Error: "the endpoint responded 500"}); err != nil {
+				t.Fatalf("record attempt: %v", err)
+			}
+			if got, _ := webhooks.GetDelivery(ctx, delivery.ID); got.Attempts != 1 || got.LastStatusCode != http.StatusInternalServerError {
+				t.Fatalf("delivery after attempt: got %+v", got)
+			}
+			if attempts, _ := webhooks.ListAttempts(ctx, delivery.ID); len(attempts) != 1 || attempts[0].DeliveryID != delivery.ID {
+				t.Fatalf("list attempts: got %+v", attempts)
+			}
+			if list, _ := webhooks.ListDeliveries(ctx, endpoint.ID, 10); len(list) != 1 {
+				t.Fatalf("list deliveries: got %d", len(list))
+			}
+
+			// consecutive failures disable the endpoint, a success resets them
+			for i, succeeded := range []bool{false, true, false, false} {
+				disabled, err := webhooks.RecordResult(ctx, endpoint.ID, succeeded, 2, now)
+				if err != nil {
+					t.Fatalf("record result: %v", err)
+				}
+				if disabled != (i == 3) {
+					t.Fatalf("record result %d: got disabled %v", i, disabled)
+				}
+			}
+			got, _ = webhooks.GetEndpoint(ctx, endpoint.ID)
+			if got.Status != models.WebhookDisabled || got.ConsecutiveFailures != 2 || got.DisabledAt == nil {
+				t.Fatalf("disabled endpoint: got %+v", got)
+			}
+			if disabled, _ := webhooks.RecordResult(ctx, endpoint.ID, false, 2, now); disabled {
+				t.Fatal("disabled an endpoint twice")
+			}
+
+			if err := webhooks.DeleteEndpoint(ctx, endpoint.ID); err != nil {
+				t.Fatalf("delete endpoint: %v", err)
+			}
+			if _, err := webhooks.GetDelivery(ctx, delivery.ID); helper.Status(err) != http.StatusNotFound {
+				t.Fatalf("delivery of a deleted endpoint: got %v, want not found", err)
+			}
+		})
+	}
+}
+
+func TestNotificationRepositories(t *testing.T) {
+	for name, newRepository := range map[string]func(*testing.T) models.NotificationRepository{
+		"memory": func(t *testing.T) models.NotificationRepository { return models.NewMemoryNotificationRepository() },
+		"sqlite": func(t *testing.T) models.NotificationRepository {
+			return models.NewNotificationRepository(openSQLite(t))
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			notifications := newRepository(t)
+			accountID := uuid.New()
+			now := time.Now().UTC().Truncate(time.Microsecond)
+
+			// two share a timestamp, pages are ordered by ID after it
+			var created []*models.Notification
+			for i, at := range []time.Time{now.Add(-time.Hour), now, now, now.Add(time.Minute)} {
+				n := &models.Notification{ID: uuid.New(), CreatedAt: at, AccountID: accountID, Category: models.CategoryTransactions, Event: "transfer.received", Data: map[string]any{"amount": float64(i)}}
+				if ok, err := notifications.CreateNotification(ctx, n); err != nil || !ok {
+					t.Fatalf("create notification %d: got %v, %v", i, ok, err)
+				}
+				created = append(created, n)
+			}
+			if ok, err := notifications.CreateNotification(ctx, &models.Notification{ID: created[0].ID, CreatedAt: now, AccountID: accountID, Category: models.CategorySecurity, Event: "account.created"}); err != nil || ok {
+				t.Fatalf("create duplicate: got %v, %v", ok, err)
+			}
+			other := &models.Notification{AccountID: uuid.New(), Category: models.CategorySecurity, Event: "account.created", CreatedAt: now}
+			if _, err := notifications.CreateNotification(ctx, other); err != nil {
+				t.Fatalf("create other account's: %v", err)
+			}
+
+			var seen []*models.Notification
+			filter := models.NotificationFilter{Limit: 3}
+			for {
+				page, err := notifications.ListNotifications(ctx, accountID, filter)
+				if err != nil {
+					t.Fatalf("list: %v", err)
+				}
+				seen = append(seen, page...)
+				if len(page) < filter.Limit {
+					break
+				}
+				last := page[len(page)-1]
+				filter.After = &models.NotificationCursor{CreatedAt: last.CreatedAt, ID: last.ID}
+			}
+			if len(seen) != len(created) {
+				t.Fatalf("paged through %d notifications, want %d", len(seen), len(created))
+			}
+			for i := 1; i < len(seen); i++ {
+				prev, n := seen[i-1], seen[i]
+				if n.CreatedAt.After(prev.CreatedAt) || (n.CreatedAt.Equal(prev.CreatedAt) && n.ID.String() >= prev.ID.String()) {
+					t.Fatalf("notification %d out of order: %+v after %+v", i, n, prev)
+				}
+			}
+			if seen[0].ID != created[3].ID || seen[0].Data["amount"] != float64(3) {
+				t.Fatalf("newest: got %+v", seen[0])
+			}
+
+			if count, err := notifications.CountUnread(ctx, accountID); err != nil || count != 4 {
+				t.Fatalf("unread: got %d, %v", count, err)
+			}
+			read, err := notifications.MarkRead(ctx, accountID, created[1].ID, now)
+			if err != nil || read.ReadAt == nil || !read.ReadAt.Equal(now) {
+				t.Fatalf("mark read: got %+v, %v", read, err)
+			}
+			// marking it again keeps when it was first read
+			if again, err := notifications.MarkRead(ctx, accountID, created[1].ID, now.Add(time.Hour)); err != nil || !again.ReadAt.Equal(now) {
+				t.Fatalf("mark read again: got %+v, %v", again, err)
+			}
+			if _, err := notifications.MarkRead(ctx, accountID, other.ID, now); helper.Status(err) != http.StatusNotFound {
+				t.Fatalf("mark other account's read: got %v, want not found", err)
+			}
+			if unread, _ := notifications.ListNotifications(ctx, accountID, models.NotificationFilter{UnreadOnly: true, Limit: 10}); len(unread) != 3 {
+				t.Fatalf("list unread: got %d", len(unread))
+			}
+			if marked, err := notifications.MarkAllRead(ctx, accountID, now); err != nil || marked != 3 {
+				t.Fatalf("mark all read: got %d, %v", marked, err)
+			}
+			if count, _ := notifications.CountUnread(ctx, other.AccountID); count != 1 {
+				t.Fatalf("other account's unread: got %d", count)
+			}
+
+			if saved, err := notifications.ListPreferences(ctx, accountID); err != nil || len(saved) != 0 {
+				t.Fatalf("no preferences: got %+v, %v", saved, err)
+			}
+			preference := models.DefaultNotificationPreference(accountID, models.CategoryMarketing)
+			preference.Email = true
+			if err := notifications.SavePreference(ctx, preference); err != nil {
+				t.Fatalf("save preference: %v", err)
+			}
+			preference.InApp = false
+			if err := notifications.SavePreference(ctx, preference); err != nil {
+				t.Fatalf("replace preference: %v", err)
+			}
+			saved, err := notifications.ListPreferences(ctx, accountID)
+			if err != nil || len(saved) != 1 || saved[0].Category != models.CategoryMarketing || saved[0].InApp || !saved[0].Email || saved[0].SMS {
+				t.Fatalf("list preferences: got %+v, %v", saved, err)
+			}
+		})
+	}
+}
+
+func TestBeneficiaryRepositories(t *testing.T) {
+	for name, newRepository := range map[string]func(*testing.T) models.BeneficiaryRepository{
+		"memory": func(t *testing.T) models.BeneficiaryRepository { return models.NewMemoryBeneficiaryRepository() },
+		"sqlite": func(t *testing.T) models.BeneficiaryRepository { return models.NewBeneficiaryRepository(openSQLite(t)) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			beneficiaries := newRepository(t)
+			accountID := uuid.New()
+			now := time.Now().UTC().Truncate(time.Microsecond)
+
+			var created []*models.Beneficiary
+			for i, nickname := range []string{"Mum", "Landlord", "Gym"} {
+				b := &models.Beneficiary{AccountID: accountID, Nickname: nickname, AccountNumber: int64(1234567890 + i), HolderName: "Jane Doe", AvailableAt: now}
+				if err := beneficiaries.Create(ctx, b); err != nil {
+					t.Fatalf("create %s: %v", nickname, err)
+				}
+				created = append(created, b)
+			}
+			err := beneficiaries.Create(ctx, &models.Beneficiary{AccountID: accountID, Nickname: "Mum again", AccountNumber: 1234567890, AvailableAt: now})
+			if helper.Status(err) != http.StatusConflict {
+				t.Fatalf("create duplicate account number: got %v", err)
+			}
+			// another account may save the same number
+			if err := beneficiaries.Create(ctx, &models.Beneficiary{AccountID: uuid.New(), Nickname: "Mum", AccountNumber: 1234567890, AvailableAt: now}); err != nil {
+				t.Fatalf("create other account's: %v", err)
+			}
+
+			got, err := beneficiaries.GetByAccountNumber(ctx, accountID, 1234567891)
+			if err != nil || got.ID != created[1].ID || !got.AvailableAt.Equal(now) {
+				t.Fatalf("get by account number: got %+v, %v", got, err)
+			}
+			if _, err := beneficiaries.GetByAccountNumber(ctx, accountID, 999); helper.Status(err) != http.StatusNotFound {
+				t.Fatalf("get unsaved account number: got %v", err)
+			}
+
+			// favourites first, then the most recently used, never used last
+			if err := beneficiaries.MarkUsed(ctx, accountID, created[2].AccountNumber, now.Add(-time.Hour)); err != nil {
+				t.Fatalf("mark used: %v", err)
+			}
+			if err := beneficiaries.MarkUsed(ctx, accountID, created[1].AccountNumber, now); err != nil {
+				t.Fatalf("mark used: %v", err)
+			}
+			if err := beneficiaries.MarkUsed(ctx, accountID, 999, now); err != nil {
+				t.Fatalf("mark unsaved account number used: %v", err)
+			}
+			created[0].Favourite, created[0].Nickname = true, "Mother"
+			if err := beneficiaries.Update(ctx, created[0]); err != nil {
+				t.Fatalf("update: %v", err)
+			}
+			list, err := beneficiaries.ListByAccount(ctx, accountID)
+			if err != nil || len(list) != 3 {
+				t.Fatalf("list: got %d, %v", len(list), err)
+			}
+			for i, want := range []*models.Beneficiary{created[0], created[1], created[2]} {
+				if list[i].ID != want.ID {
+					t.Fatalf("beneficiary %d: got %s, want %s", i, list[i].Nickname, want.Nickname)
+				}
+			}
+			if list[0].Nickname != "Mother" || list[0].LastUsedAt != nil || list[1].LastUsedAt == nil || !list[1].LastUsedAt.Equal(now) {
+				t.Fatalf("got %+v, %+v", list[0], list[1])
+			}
+
+			if err := beneficiaries.Delete(ctx, created[1].ID); err != nil {
+				t.Fatalf("delete: %v", err)
+			}
+			if _, err := beneficiaries.GetByID(ctx, created[1].ID); helper.Status(err) != http.StatusNotFound {
+				t.Fatalf("get deleted: got %v", err)
+			}
+			if err := beneficiaries.Delete(ctx, created[1].ID); helper.Status(err) != http.StatusNotFound {
+				t.Fatalf("delete again: got %v", err)
+			}
+			if err := beneficiaries.Update(ctx, created[1]); helper.Status(err) != http.StatusNotFound {
+				t.Fatalf("update deleted: got %v", err)
+			}
+		})
+	}
+}
@@ -4,10 +4,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
 	"time"
 
-	"github.com/Cprime50/Gopay/db"
 	"github.com/Cprime50/Gopay/helper"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
@@ -22,58 +20,65 @@ type Role struct {
 	UpdatedAt   time.Time
 }
 
+// Role IDs seeded on migration
+const (
+	AdminRoleID uint = 1
+	UserRoleID  uint = 2
+)
+
+// roleRepository is the GORM backed RoleRepository
+type roleRepository struct {
+	db *gorm.DB
+}
+
+// NewRoleRepository returns a RoleRepository backed by db
+func NewRoleRepository(db *gorm.DB) RoleRepository {
+	return &roleRepository{db: db}
+}
+
 // Get one role by id
-func GetRoleById(ctx context.Context, id uint) (*Role, error) {
-	var role *Role
-	if err := db.DB.WithContext(ctx).Where("id = ?", id).First(&role).Error; err != nil {
-		if err != nil {
-			if errors.Is(gorm.ErrRecordNotFound, err) {
-				fmt.Printf("role with ID %d not found\n", role.ID)
-				return nil, helper.NewNotFound("id", fmt.Sprintf("%d", role.ID))
-			}
+func (r *roleRepository) GetByID(ctx context.Context, id uint) (*Role, error) {
+	var role Role
+	if err := r.db.WithContext(ctx).Where("id = ?", id).First(&role).Error; err != nil {
+		if errors.Is(gorm.ErrRecordNotFound, err) {
+			helper.Logger(ctx).Info("role not found", "id", id)
+			return nil, helper.NewNotFound("id", fmt.Sprintf("%d", id))
 		}
-		log.Println("Error quering db", err)
+		helper.Logger(ctx).Error("error querying db", "error", err)
 		return nil, helper.NewInternal()
 	}
-	return role, nil
+	return &role, nil
 }
 
 // Gets all roles
-func GetAllRoles(ctx context.Context) ([]*Role, error) {
+func (r *roleRepository) GetAll(ctx context.Context) ([]*Role, error) {
 	var roles []*Role
-	if err := db.DB.WithContext(ctx).Find(&roles).Error; err != nil {
-		log.Println("Error quering db", err)
+	if err := r.db.WithContext(ctx).Find(&roles).Error; err != nil {
+		helper.Logger(ctx).Error("error querying db", "error", err)
 		return nil, helper.NewInternal()
 	}
 	return roles, nil
 }
 
 // Assign roles to account
-func AssignRole(ctx context.Context, accountID uuid.UUID, roleID uint) error {
-	if err := db.DB.WithContext(ctx).Model(&Account{}).Where("id = ?", accountID).Update("role", roleID).Error; err != nil {
-		if err != nil {
-			if errors.Is(gorm.ErrRecordNotFound, err) {
-				fmt.Printf("account with ID %s not found\n", accountID)
-				return helper.NewNotFound("id", accountID.String())
-			}
-		}
-		log.Println("Error quering db", err)
+func (r *roleRepository) Assign(ctx context.Context, accountID uuid.UUID, roleID uint) error {
+	result := r.db.WithContext(ctx).Model(&Account{}).Where("id = ?", accountID).Update("role_id", roleID)
+	if err := result.Error; err != nil {
+		helper.Logger(ctx).Error("error querying db", "error", err)
 		return helper.NewInternal()
 	}
+	if result.RowsAffected == 0 {
+		helper.Logger(ctx).Info("account not found", "id", accountID)
+		return helper.NewNotFound("id", accountID.String())
+	}
 	return nil
 }
 
 // Get accounts by role
-func GetAccntByRole(ctx context.Context, roleID uint) (*[]Account, error) {
-	var accounts *[]Account
-	if err := db.DB.WithContext(ctx).Where("role_id = ?", roleID).Find(&accounts).Error; err != nil {
-		if err != nil {
-			if errors.Is(gorm.ErrRecordNotFound, err) {
-				fmt.Printf("role with ID %d not found\n", roleID)
-				return nil, helper.NewNotFound("id", fmt.Sprintf("%d", roleID))
-			}
-		}
-		log.Println("Error quering db", err)
+func (r *roleRepository) GetAccounts(ctx context.Context, roleID uint) ([]*Account, error) {
+	var accounts []*Account
+	if err := r.db.WithContext(ctx).Where("role_id = ?", roleID).Find(&accounts).Error; err != nil {
+		helper.Logger(ctx).Error("error querying db", "error", err)
 		return nil, helper.NewInternal()
 	}
 	return accounts, nil
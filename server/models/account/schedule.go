@@ -0,0 +1,169 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Cprime50/Gopay/helper"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// How often a scheduled transfer runs
+const (
+	Once    = "once"
+	Daily   = "daily"
+	Weekly  = "weekly"
+	Monthly = "monthly"
+	Cron    = "cron"
+)
+
+// Scheduled transfer statuses, only active ones are run
+const (
+	ScheduleActive    = "active"
+	SchedulePaused    = "paused"
+	ScheduleCancelled = "cancelled"
+	ScheduleCompleted = "completed"
+)
+
+// Outcomes of a scheduled transfer run
+const (
+	RunCompleted = "completed"
+	RunSkipped   = "skipped"
+	RunFailed    = "failed"
+)
+
+// ScheduledTransfer is a future dated or recurring transfer from an
+// account to another account number. DueAt is when the current
+// occurrence is due, NextRunAt when the worker should next try it,
+// later than DueAt while it's being retried or run
+type ScheduledTransfer struct {
+	ID              uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+	AccountID       uuid.UUID  `gorm:"type:uuid;not null;index" json:"account_id"`
+	ToAccountNumber int64      `gorm:"not null" json:"to_account_number"`
+	Amount          float64    `gorm:"type:decimal(12,2);not null" json:"amount"`
+	Note            string     `gorm:"type:varchar(140);not null" json:"note"`
+	Frequency       string     `gorm:"type:varchar(20);not null" json:"frequency"`
+	Cron            string     `gorm:"type:varchar(100);not null" json:"cron,omitempty"`
+	StartAt         time.Time  `gorm:"not null" json:"start_at"`
+	EndAt           *time.Time `json:"end_at,omitempty"`
+	Status          string     `gorm:"type:varchar(20);not null;index:idx_scheduled_transfer_due,priority:1" json:"status"`
+	DueAt           *time.Time `json:"due_at,omitempty"`
+	NextRunAt       *time.Time `gorm:"index:idx_scheduled_transfer_due,priority:2" json:"next_run_at,omitempty"`
+	// Runs counts the occurrences done or skipped so far
+	Runs int `gorm:"not null;default:0" json:"runs"`
+	// Attempts counts the failed tries at the current occurrence
+	Attempts   int        `gorm:"not null;default:0" json:"attempts"`
+	LastRunAt  *time.Time `json:"last_run_at,omitempty"`
+	LastStatus string     `gorm:"type:varchar(20);not null" json:"last_status,omitempty"`
+	LastError  string     `gorm:"type:varchar(255);not null" json:"last_error,omitempty"`
+	// Version guards against lost updates between the owner and the worker
+	Version int `gorm:"not null;default:0" json:"-"`
+}
+
+// BeforeCreate generates the schedule ID
+func (s *ScheduledTransfer) BeforeCreate(tx *gorm.DB) error {
+	if s.ID == uuid.Nil {
+		s.ID = uuid.New()
+	}
+	return nil
+}
+
+// scheduleRepository is the GORM backed ScheduleRepository
+type scheduleRepository struct {
+	db *gorm.DB
+}
+
+// NewScheduleRepository returns a ScheduleRepository backed by db
+func NewScheduleRepository(db *gorm.DB) ScheduleRepository {
+	return &scheduleRepository{db: db}
+}
+
+func (r *scheduleRepository) Create(ctx context.Context, schedule *ScheduledTransfer) error {
+	if err := r.db.WithContext(ctx).Create(schedule).Error; err != nil {
+		helper.Logger(ctx).Error("error creating scheduled transfer", "error", err)
+		return helper.NewInternal()
+	}
+	return nil
+}
+
+func (r *scheduleRepository) GetByID(ctx context.Context, id uuid.UUID) (*ScheduledTransfer, error) {
+	var schedule ScheduledTransfer
+	if err := r.db.WithContext(ctx).Where("id = ?", id).First(&schedule).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, helper.NewNotFound("schedule", id.String())
+		}
+		helper.Logger(ctx).Error("error querying scheduled transfer", "error", err)
+		return nil, helper.NewInternal()
+	}
+	return &schedule, nil
+}
+
+// ListByAccount returns the account's schedules, newest first
+func (r *scheduleRepository) ListByAccount(ctx context.Context, accountID uuid.UUID) ([]*ScheduledTransfer, error) {
+	var schedules []*ScheduledTransfer
+	if err := r.db.WithContext(ctx).Where("account_id = ?", accountID).Order("created_at DESC").Find(&schedules).Error; err != nil {
+		helper.Logger(ctx).Error("error querying scheduled transfers", "error", err)
+		return nil, helper.NewInternal()
+	}
+	return schedules, nil
+}
+
+// Update saves every field of schedule unless it was changed since it
+// was read, which fails with a conflict
+func (r *scheduleRepository) Update(ctx context.Context, schedule *ScheduledTransfer) error {
+	version := schedule.Version
+	schedule.Version++
+	schedule.UpdatedAt = time.Now()
+	result := r.db.WithContext(ctx).Model(&ScheduledTransfer{}).
+		Where("id = ? AND version = ?", schedule.ID, version).
+		Select("*").Omit("id", "created_at", "account_id").
+		Updates(schedule)
+	if err := result.Error; err != nil {
+		schedule.Version = version
+		helper.Logger(ctx).Error("error updating scheduled transfer", "error", err)
+		return helper.NewInternal()
+	}
+	if result.RowsAffected == 0 {
+		schedule.Version = version
+		return helper.NewConflict("schedule", schedule.ID.String())
+	}
+	return nil
+}
+
+// Due returns up to limit active schedules whose next run is at or before now
+func (r *scheduleRepository) Due(ctx context.Context, now time.Time, limit int) ([]*ScheduledTransfer, error) {
+	var schedules []*ScheduledTransfer
+	err := r.db.WithContext(ctx).
+		Where("status = ? AND next_run_at <= ?", ScheduleActive, now).
+		Order("next_run_at").
+		Limit(limit).
+		Find(&schedules).Error
+	if err != nil {
+		helper.Logger(ctx).Error("error querying due scheduled transfers", "error", err)
+		return nil, helper.NewInternal()
+	}
+	return schedules, nil
+}
+
+// Claim leases schedule to the caller by moving its next run to until,
+// so other workers leave it alone. It reports false if another worker
+// or the owner changed it first
+func (r *scheduleRepository) Claim(ctx context.Context, schedule *ScheduledTransfer, until time.Time) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&ScheduledTransfer{}).
+		Where("id = ? AND version = ? AND status = ?", schedule.ID, schedule.Version, ScheduleActive).
+		Updates(map[string]interface{}{"next_run_at": until, "version": schedule.Version + 1})
+	if err := result.Error; err != nil {
+		helper.Logger(ctx).Error("error claiming scheduled transfer", "error", err)
+		return false, helper.NewInternal()
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+	schedule.NextRunAt = &until
+	schedule.Version++
+	return true, nil
+}
@@ -0,0 +1,67 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/Cprime50/Gopay/helper"
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+// addSegments counts ARGV[1] segments against the daily budget at KEYS[1]
+// unless that takes it over ARGV[2], the key expiring ARGV[3] seconds
+// after the first count. It returns 1 if the segments were counted
+var addSegments = redis.NewScript(`
+local used = redis.call('INCRBY', KEYS[1], ARGV[1])
+if used == tonumber(ARGV[1]) then
+	redis.call('EXPIRE', KEYS[1], ARGV[3])
+end
+if used > tonumber(ARGV[2]) then
+	redis.call('DECRBY', KEYS[1], ARGV[1])
+	return 0
+end
+return 1
+`)
+
+// smsUsageRepository is the redis backed SMSUsageRepository
+type smsUsageRepository struct {
+	redis *redis.Client
+}
+
+// NewSMSUsageRepository returns an SMSUsageRepository backed by redis
+func NewSMSUsageRepository(redis *redis.Client) SMSUsageRepository {
+	return &smsUsageRepository{redis: redis}
+}
+
+// AddSegments counts segments sent to the account on day's UTC date,
+// reporting false without counting them if that would go over limit
+func (r *smsUsageRepository) AddSegments(ctx context.Context, accountID uuid.UUID, day time.Time, segments int, limit int) (bool, error) {
+	key := "sms:segments:" + accountID.String() + ":" + day.UTC().Format("20060102")
+	added, err := addSegments.Run(ctx, r.redis, []string{key}, segments, limit, int((48 * time.Hour).Seconds())).Int()
+	if err != nil {
+		helper.Logger(ctx).Error("could not count sms segments in redis", "account_id", accountID, "error", err)
+		return false, helper.NewInternal()
+	}
+	return added == 1, nil
+}
+
+// Sent reports whether the text for key has been marked sent, so a text
+// for an event delivered more than once is only sent once
+func (r *smsUsageRepository) Sent(ctx context.Context, key string) (bool, error) {
+	n, err := r.redis.Exists(ctx, "sms:sent:"+key).Result()
+	if err != nil {
+		helper.Logger(ctx).Error("could not look up sms in redis", "key", key, "error", err)
+		return false, helper.NewInternal()
+	}
+	return n > 0, nil
+}
+
+// MarkSent remembers the text for key was sent for ttl
+func (r *smsUsageRepository) MarkSent(ctx context.Context, key string, ttl time.Duration) error {
+	if err := r.redis.Set(ctx, "sms:sent:"+key, 1, ttl).Err(); err != nil {
+		helper.Logger(ctx).Error("could not record sms in redis", "key", key, "error", err)
+		return helper.NewInternal()
+	}
+	return nil
+}
@@ -3,11 +3,10 @@ package models
 import (
 	"context"
 	"fmt"
-	"log"
 	"time"
 
-	"github.com/Cprime50/Gopay/db"
 	"github.com/Cprime50/Gopay/helper"
+	"github.com/go-redis/redis/v8"
 	"github.com/google/uuid"
 )
 
@@ -27,32 +26,42 @@ type TokenPair struct {
 	RefreshToken
 }
 
+// tokenRepository is the redis backed TokenRepository
+type tokenRepository struct {
+	redis *redis.Client
+}
+
+// NewTokenRepository returns a TokenRepository backed by redis
+func NewTokenRepository(redis *redis.Client) TokenRepository {
+	return &tokenRepository{redis: redis}
+}
+
 // SetRefreshToken stores a refresh token with an expiry time
-func SetRefreshToken(ctx context.Context, accountID string, tokenID string, expiresIn time.Duration) error {
+func (r *tokenRepository) SetRefreshToken(ctx context.Context, accountID string, tokenID string, expiresIn time.Duration) error {
 	// We'll store accountID with token id so we can scan (non-blocking)
 	// over the user's tokens and delete them in case of token leakage
 	key := fmt.Sprintf("%s:%s", accountID, tokenID)
-	if err := db.RedisClient.Set(ctx, key, 0, expiresIn).Err(); err != nil {
-		log.Printf("Could not SET refresh token to redis for accountID/tokenID: %s/%s: %v\n", accountID, tokenID, err)
+	if err := r.redis.Set(ctx, key, 0, expiresIn).Err(); err != nil {
+		helper.Logger(ctx).Error("could not set refresh token in redis", "account_id", accountID, "token_id", tokenID, "error", err)
 		return helper.NewInternal()
 	}
 	return nil
 }
 
 // Deletes a specific refresh token from Redis
-func DeleteRefreshToken(ctx context.Context, accountID string, tokenID string) error {
+func (r *tokenRepository) DeleteRefreshToken(ctx context.Context, accountID string, tokenID string) error {
 	key := fmt.Sprintf("%s:%s", accountID, tokenID)
-	result := db.RedisClient.Del(ctx, key)
+	result := r.redis.Del(ctx, key)
 	if err := result.Err(); err != nil {
-		log.Printf("Could not delete refresh token to redis for accountID/tokenID: %s/%s: %v\n", accountID, tokenID, err)
+		helper.Logger(ctx).Error("could not delete refresh token from redis", "account_id", accountID, "token_id", tokenID, "error", err)
 		return helper.NewInternal()
 	}
 
 	// Val returns count of deleted keys.
 	// If no key was deleted, the refresh token is invalid
 	if result.Val() < 1 {
-		log.Printf("Refresh token to redis for accountID/tokenID: %s/%s does not exist\n", accountID, tokenID)
-		return helper.NewAuthorization("Invalid refresh token")
+		helper.Logger(ctx).Info("refresh token does not exist in redis", "account_id", accountID, "token_id", tokenID)
+		return helper.NewAuthorization("Invalid refresh token").WithCode(helper.CodeInvalidToken)
 	}
 
 	return nil
@@ -60,22 +69,22 @@ func DeleteRefreshToken(ctx context.Context, accountID string, tokenID string) e
 
 // DeleteUserRefreshTokens looks for all tokens beginning with
 // accountID and scans to delete them in a non-blocking fashion
-func DeleteUserRefreshTokens(ctx context.Context, accountID string) error {
+func (r *tokenRepository) DeleteUserRefreshTokens(ctx context.Context, accountID string) error {
 	pattern := fmt.Sprintf("%s*", accountID)
 
-	iter := db.RedisClient.Scan(ctx, 0, pattern, 5).Iterator()
+	iter := r.redis.Scan(ctx, 0, pattern, 5).Iterator()
 	failCount := 0
 
 	for iter.Next(ctx) {
-		if err := db.RedisClient.Del(ctx, iter.Val()).Err(); err != nil {
-			log.Printf("Failed to delete refresh token: %s\n", iter.Val())
+		if err := r.redis.Del(ctx, iter.Val()).Err(); err != nil {
+			helper.Logger(ctx).Error("failed to delete refresh token", "key", iter.Val(), "error", err)
 			failCount++
 		}
 	}
 
 	// check last value
 	if err := iter.Err(); err != nil {
-		log.Printf("Failed to delete refresh token: %s\n", iter.Val())
+		helper.Logger(ctx).Error("failed to scan refresh tokens", "account_id", accountID, "error", err)
 	}
 
 	if failCount > 0 {
@@ -0,0 +1,97 @@
+package models
+
+import (
+	"context"
+	"sync"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// transactor is the GORM backed Transactor
+type transactor struct {
+	db *gorm.DB
+}
+
+// NewTransactor returns a Transactor running functions in a transaction
+// of db. Repositories that open their own transaction, like the ledger,
+// get a savepoint within it
+func NewTransactor(db *gorm.DB) Transactor {
+	return &transactor{db: db}
+}
+
+func (t *transactor) Transaction(ctx context.Context, fn func(repos Repositories) error) error {
+	return t.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(Repositories{
+			Accounts: NewAccountRepository(tx),
+			Roles:    NewRoleRepository(tx),
+			Ledger:   NewLedgerRepository(tx),
+			Audit:    NewAuditRepository(tx),
+		})
+	})
+}
+
+// memoryTransactor is the in memory Transactor. Transactions run one at a
+// time and are rolled back by restoring what the repositories held when
+// they started, so changes made outside one while it runs can be lost.
+// It's only meant for tests, like the other in memory repositories
+type memoryTransactor struct {
+	mu       sync.Mutex
+	repos    Repositories
+	accounts *memoryAccountRepository
+	ledger   *memoryLedgerRepository
+	audit    *memoryAuditRepository
+}
+
+// NewMemoryTransactor returns a Transactor over the in memory accounts,
+// roles, ledger and audit repositories, it panics given any other kind
+func NewMemoryTransactor(accounts AccountRepository, roles RoleRepository, ledger LedgerRepository, audit AuditRepository) Transactor {
+	memoryAccounts, ok1 := accounts.(*memoryAccountRepository)
+	_, ok2 := roles.(*memoryRoleRepository)
+	memoryLedger, ok3 := ledger.(*memoryLedgerRepository)
+	memoryAudit, ok4 := audit.(*memoryAuditRepository)
+	if !ok1 || !ok2 || !ok3 || !ok4 {
+		panic("models: the in memory transactor needs the in memory repositories")
+	}
+	return &memoryTransactor{
+		repos:    Repositories{Accounts: accounts, Roles: roles, Ledger: ledger, Audit: audit},
+		accounts: memoryAccounts,
+		ledger:   memoryLedger,
+		audit:    memoryAudit,
+	}
+}
+
+func (t *memoryTransactor) Transaction(ctx context.Context, fn func(repos Repositories) error) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.accounts.mu.RLock()
+	accounts := make(map[uuid.UUID]Account, len(t.accounts.accounts))
+	for id, a := range t.accounts.accounts {
+		accounts[id] = a
+	}
+	outbox := append([]OutboxEvent(nil), t.accounts.outbox...)
+	t.accounts.mu.RUnlock()
+	t.ledger.mu.RLock()
+	entries := append([]LedgerEntry(nil), t.ledger.entries...)
+	t.ledger.mu.RUnlock()
+	t.audit.mu.RLock()
+	records := append([]AuditRecord(nil), t.audit.records...)
+	t.audit.mu.RUnlock()
+
+	err := fn(t.repos)
+	if err == nil {
+		return nil
+	}
+
+	t.accounts.mu.Lock()
+	t.accounts.accounts, t.accounts.outbox = accounts, outbox
+	t.accounts.mu.Unlock()
+	t.ledger.mu.Lock()
+	t.ledger.entries = entries
+	t.ledger.mu.Unlock()
+	t.audit.mu.Lock()
+	t.audit.records = records
+	t.audit.mu.Unlock()
+	return err
+}
@@ -0,0 +1,313 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Cprime50/Gopay/helper"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Webhook endpoint statuses, only active endpoints are delivered to
+const (
+	WebhookActive   = "active"
+	WebhookDisabled = "disabled"
+)
+
+// Webhook delivery statuses
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+// WebhookEndpoint is a URL an account has events pushed to. Events
+// lists the event types it subscribes to, "*" for all of them. Each
+// delivery is signed with Secret
+type WebhookEndpoint struct {
+	ID          uuid.UUID `gorm:"type:uuid;primary_key" json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	AccountID   uuid.UUID `gorm:"type:uuid;not null;index" json:"account_id"`
+	URL         string    `gorm:"type:varchar(2048);not null" json:"url"`
+	Description string    `gorm:"type:varchar(140);not null" json:"description"`
+	Events      []string  `gorm:"type:text;not null;serializer:json" json:"events"`
+	Secret      string    `gorm:"type:varchar(100);not null" json:"-"`
+	Status      string    `gorm:"type:varchar(20);not null" json:"status"`
+	// ConsecutiveFailures counts failed attempts since the last success,
+	// the endpoint is disabled once there are too many
+	ConsecutiveFailures int        `gorm:"not null;default:0" json:"consecutive_failures"`
+	DisabledAt          *time.Time `json:"disabled_at,omitempty"`
+	DisabledReason      string     `gorm:"type:varchar(255);not null" json:"disabled_reason,omitempty"`
+}
+
+// BeforeCreate generates the endpoint ID
+func (e *WebhookEndpoint) BeforeCreate(tx *gorm.DB) error {
+	if e.ID == uuid.Nil {
+		e.ID = uuid.New()
+	}
+	return nil
+}
+
+// Subscribes reports whether the endpoint wants events of eventType
+func (e *WebhookEndpoint) Subscribes(eventType string) bool {
+	for _, t := range e.Events {
+		if t == "*" || t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookDelivery is an event sent, or to be sent, to an endpoint.
+// Payload is the exact body posted. Attempts counts the tries since
+// it was created or last redelivered
+type WebhookDelivery struct {
+	ID             uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	EndpointID     uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex:idx_webhook_delivery_event,priority:1" json:"endpoint_id"`
+	EventID        uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex:idx_webhook_delivery_event,priority:2" json:"event_id"`
+	EventType      string     `gorm:"type:varchar(100);not null" json:"event_type"`
+	Payload        string     `gorm:"type:text;not null" json:"-"`
+	Status         string     `gorm:"type:varchar(20);not null" json:"status"`
+	Attempts       int        `gorm:"not null;default:0" json:"attempts"`
+	LastAttemptAt  *time.Time `json:"last_attempt_at,omitempty"`
+	LastStatusCode int        `gorm:"not null;default:0" json:"last_status_code,omitempty"`
+	LastError      string     `gorm:"type:varchar(255);not null" json:"last_error,omitempty"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+}
+
+// BeforeCreate generates the delivery ID
+func (d *WebhookDelivery) BeforeCreate(tx *gorm.DB) error {
+	if d.ID == uuid.Nil {
+		d.ID = uuid.New()
+	}
+	return nil
+}
+
+// WebhookAttempt records one try at a delivery. StatusCode is 0 when
+// no response came back, Error says why
+type WebhookAttempt struct {
+	ID         uuid.UUID `gorm:"type:uuid;primary_key" json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	DeliveryID uuid.UUID `gorm:"type:uuid;not null;index" json:"delivery_id"`
+	Succeeded  bool      `gorm:"not null" json:"succeeded"`
+	StatusCode int       `gorm:"not null;default:0" json:"status_code,omitempty"`
+	Error      string    `gorm:"type:varchar(255);not null" json:"error,omitempty"`
+	// Response is the start of the response body
+	Response   string `gorm:"type:varchar(1024);not null" json:"response,omitempty"`
+	DurationMS int64  `gorm:"not null" json:"duration_ms"`
+}
+
+// BeforeCreate generates the attempt ID
+func (a *WebhookAttempt) BeforeCreate(tx *gorm.DB) error {
+	if a.ID == uuid.Nil {
+		a.ID = uuid.New()
+	}
+	return nil
+}
+
+// webhookRepository is the GORM backed WebhookRepository
+type webhookRepository struct {
+	db *gorm.DB
+}
+
+// NewWebhookRepository returns a WebhookRepository backed by db
+func NewWebhookRepository(db *gorm.DB) WebhookRepository {
+	return &webhookRepository{db: db}
+}
+
+func (r *webhookRepository) CreateEndpoint(ctx context.Context, endpoint *WebhookEndpoint) error {
+	if err := r.db.WithContext(ctx).Create(endpoint).Error; err != nil {
+		helper.Logger(ctx).Error("error creating webhook endpoint", "error", err)
+		return helper.NewInternal()
+	}
+	return nil
+}
+
+func (r *webhookRepository) GetEndpoint(ctx context.Context, id uuid.UUID) (*WebhookEndpoint, error) {
+	var endpoint WebhookEndpoint
+	if err := r.db.WithContext(ctx).Where("id = ?", id).First(&endpoint).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, helper.NewNotFound("webhook", id.String())
+		}
+		helper.Logger(ctx).Error("error querying webhook endpoint", "error", err)
+		return nil, helper.NewInternal()
+	}
+	return &endpoint, nil
+}
+
+// ListEndpoints returns the account's endpoints, oldest first
+func (r *webhookRepository) ListEndpoints(ctx context.Context, accountID uuid.UUID) ([]*WebhookEndpoint, error) {
+	var endpoints []*WebhookEndpoint
+	if err := r.db.WithContext(ctx).Where("account_id = ?", accountID).Order("created_at").Find(&endpoints).Error; err != nil {
+		helper.Logger(ctx).Error("error querying webhook endpoints", "error", err)
+		return nil, helper.NewInternal()
+	}
+	return endpoints, nil
+}
+
+// UpdateEndpoint saves the endpoint's settings and status
+func (r *webhookRepository) UpdateEndpoint(ctx context.Context, endpoint *WebhookEndpoint) error {
+	endpoint.UpdatedAt = time.Now()
+	result := r.db.WithContext(ctx).Model(&WebhookEndpoint{}).
+		Where("id = ?", endpoint.ID).
+		Select("*").Omit("id", "created_at", "account_id").
+		Updates(endpoint)
+	if err := result.Error; err != nil {
+		helper.Logger(ctx).Error("error updating webhook endpoint", "error", err)
+		return helper.NewInternal()
+	}
+	if result.RowsAffected == 0 {
+		return helper.NewNotFound("webhook", endpoint.ID.String())
+	}
+	return nil
+}
+
+// DeleteEndpoint removes the endpoint along with its deliveries and their attempts
+func (r *webhookRepository) DeleteEndpoint(ctx context.Context, id uuid.UUID) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		deliveries := tx.Model(&WebhookDelivery{}).Select("id").Where("endpoint_id = ?", id)
+		if err := tx.Where("delivery_id IN (?)", deliveries).Delete(&WebhookAttempt{}).Error; err != nil {
+			helper.Logger(ctx).Error("error deleting webhook attempts", "error", err)
+			return helper.NewInternal()
+		}
+		if err := tx.Where("endpoint_id = ?", id).Delete(&WebhookDelivery{}).Error; err != nil {
+			helper.Logger(ctx).Error("error deleting webhook deliveries", "error", err)
+			return helper.NewInternal()
+		}
+		result := tx.Where("id = ?", id).Delete(&WebhookEndpoint{})
+		if err := result.Error; err != nil {
+			helper.Logger(ctx).Error("error deleting webhook endpoint", "error", err)
+			return helper.NewInternal()
+		}
+		if result.RowsAffected == 0 {
+			return helper.NewNotFound("webhook", id.String())
+		}
+		return nil
+	})
+}
+
+// RecordResult counts a successful or failed attempt against the
+// endpoint. A failure that takes it to disableAfter consecutive ones
+// disables it, reported by disabled
+func (r *webhookRepository) RecordResult(ctx context.Context, id uuid.UUID, succeeded bool, disableAfter int, at time.Time) (disabled bool, err error) {
+	err = r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if succeeded {
+			return tx.Model(&WebhookEndpoint{}).Where("id = ?", id).Update("consecutive_failures", 0).Error
+		}
+		err := tx.Model(&WebhookEndpoint{}).Where("id = ?", id).
+			Update("consecutive_failures", gorm.Expr("consecutive_failures + 1")).Error
+		if err != nil {
+			return err
+		}
+		result := tx.Model(&WebhookEndpoint{}).
+			Where("id = ? AND status = ? AND consecutive_failures >= ?", id, WebhookActive, disableAfter).
+			Updates(map[string]interface{}{
+				"status":          WebhookDisabled,
+				"disabled_at":     at,
+				"disabled_reason": "too many consecutive failed deliveries",
+				"updated_at":      at,
+			})
+		disabled = result.RowsAffected > 0
+		return result.Error
+	})
+	if err != nil {
+		helper.Logger(ctx).Error("error recording webhook result", "error", err)
+		return false, helper.NewInternal()
+	}
+	return disabled, nil
+}
+
+// CreateDelivery saves a new delivery, reporting false without saving
+// it if the endpoint already has a delivery of the same event
+func (r *webhookRepository) CreateDelivery(ctx context.Context, delivery *WebhookDelivery) (bool, error) {
+	result := r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(delivery)
+	if err := result.Error; err != nil {
+		helper.Logger(ctx).Error("error creating webhook delivery", "error", err)
+		return false, helper.NewInternal()
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (r *webhookRepository) GetDelivery(ctx context.Context, id uuid.UUID) (*WebhookDelivery, error) {
+	return r.getDelivery(ctx, id.String(), "id = ?", id)
+}
+
+func (r *webhookRepository) GetDeliveryByEvent(ctx context.Context, endpointID uuid.UUID, eventID uuid.UUID) (*WebhookDelivery, error) {
+	return r.getDelivery(ctx, eventID.String(), "endpoint_id = ? AND event_id = ?", endpointID, eventID)
+}
+
+// getDelivery returns the delivery matching query, not found reports value
+func (r *webhookRepository) getDelivery(ctx context.Context, value string, query string, args ...interface{}) (*WebhookDelivery, error) {
+	var delivery WebhookDelivery
+	if err := r.db.WithContext(ctx).Where(query, args...).First(&delivery).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, helper.NewNotFound("delivery", value)
+		}
+		helper.Logger(ctx).Error("error querying webhook delivery", "error", err)
+		return nil, helper.NewInternal()
+	}
+	return &delivery, nil
+}
+
+// ListDeliveries returns up to limit of the endpoint's deliveries, newest first
+func (r *webhookRepository) ListDeliveries(ctx context.Context, endpointID uuid.UUID, limit int) ([]*WebhookDelivery, error) {
+	var deliveries []*WebhookDelivery
+	err := r.db.WithContext(ctx).
+		Where("endpoint_id = ?", endpointID).
+		Order("created_at DESC").
+		Limit(limit).
+		Find(&deliveries).Error
+	if err != nil {
+		helper.Logger(ctx).Error("error querying webhook deliveries", "error", err)
+		return nil, helper.NewInternal()
+	}
+	return deliveries, nil
+}
+
+// UpdateDelivery saves the delivery's status
+func (r *webhookRepository) UpdateDelivery(ctx context.Context, delivery *WebhookDelivery) error {
+	delivery.UpdatedAt = time.Now()
+	result := r.db.WithContext(ctx).Model(&WebhookDelivery{}).
+		Where("id = ?", delivery.ID).
+		Select("*").Omit("id", "created_at", "endpoint_id", "event_id", "event_type", "payload").
+		Updates(delivery)
+	if err := result.Error; err != nil {
+		helper.Logger(ctx).Error("error updating webhook delivery", "error", err)
+		return helper.NewInternal()
+	}
+	if result.RowsAffected == 0 {
+		return helper.NewNotFound("delivery", delivery.ID.String())
+	}
+	return nil
+}
+
+// RecordAttempt saves an attempt at delivery along with the delivery's
+// new status, in one transaction
+func (r *webhookRepository) RecordAttempt(ctx context.Context, delivery *WebhookDelivery, attempt *WebhookAttempt) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		attempt.DeliveryID = delivery.ID
+		if err := tx.Create(attempt).Error; err != nil {
+			helper.Logger(ctx).Error("error recording webhook attempt", "error", err)
+			return helper.NewInternal()
+		}
+		return NewWebhookRepository(tx).UpdateDelivery(ctx, delivery)
+	})
+}
+
+// ListAttempts returns the delivery's attempts, oldest first
+func (r *webhookRepository) ListAttempts(ctx context.Context, deliveryID uuid.UUID) ([]*WebhookAttempt, error) {
+	var attempts []*WebhookAttempt
+	if err := r.db.WithContext(ctx).Where("delivery_id = ?", deliveryID).Order("created_at").Find(&attempts).Error; err != nil {
+		helper.Logger(ctx).Error("error querying webhook attempts", "error", err)
+		return nil, helper.NewInternal()
+	}
+	return attempts, nil
+}
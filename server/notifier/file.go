@@ -0,0 +1,52 @@
+package notifier
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Cprime50/Gopay/helper"
+)
+
+// File writes every email to a .eml file in a directory, for development
+type File struct {
+	dir string
+	now func() time.Time
+}
+
+// NewFile returns a File mailer writing to dir, created if missing
+func NewFile(dir string) (*File, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("creating mail directory: %w", err)
+	}
+	return &File{dir: dir, now: time.Now}, nil
+}
+
+// Send writes msg to a new file named after the time it's sent
+func (f *File) Send(ctx context.Context, msg *Message) error {
+	now := f.now()
+	data, err := msg.Bytes(now)
+	if err != nil {
+		return err
+	}
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	name := filepath.Join(f.dir, now.UTC().Format("20060102T150405.000000000")+"-"+hex.EncodeToString(suffix)+".eml")
+	if err := os.WriteFile(name, data, 0o644); err != nil {
+		return fmt.Errorf("writing email: %w", err)
+	}
+	helper.Logger(ctx).Debug("email written", "to", msg.To, "subject", msg.Subject, "file", name)
+	return nil
+}
+
+// Log only logs emails, with their plain text body
+type Log struct{}
+
+func (Log) Send(ctx context.Context, msg *Message) error {
+	helper.Logger(ctx).Info("email", "to", msg.To, "subject", msg.Subject, "text", msg.Text)
+	return nil
+}
@@ -0,0 +1,86 @@
+// Package notifier emails notifications to account holders. Emails are
+// rendered from the templates of the account's locale and sent by a
+// Mailer: smtp in production, or a file or log driver in development.
+//
+// Email is the service.Notifier the notifications worker delivers
+// with, callers enqueue notifications with service.QueueNotifier so
+// they never wait on a mail server
+package notifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Cprime50/Gopay/config"
+	"github.com/Cprime50/Gopay/helper"
+	models "github.com/Cprime50/Gopay/models/account"
+	"github.com/Cprime50/Gopay/service"
+)
+
+// Mailer sends emails
+type Mailer interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+// NewMailer returns the mailer of the configured driver
+func NewMailer(cfg config.Mail) (Mailer, error) {
+	switch cfg.Driver {
+	case "smtp":
+		return NewSMTP(cfg.SMTP), nil
+	case "file":
+		return NewFile(cfg.Dir)
+	case "log":
+		return Log{}, nil
+	}
+	return nil, fmt.Errorf("unknown mail driver %q", cfg.Driver)
+}
+
+// Email sends notifications as emails to the account they're for
+type Email struct {
+	accounts  models.AccountRepository
+	mailer    Mailer
+	templates *Templates
+	from      string
+}
+
+// NewEmail returns an Email sending from the given address
+func NewEmail(accounts models.AccountRepository, mailer Mailer, templates *Templates, from string) *Email {
+	return &Email{
+		accounts:  accounts,
+		mailer:    mailer,
+		templates: templates,
+		from:      from,
+	}
+}
+
+// Notify renders and sends the notification. Notifications of events
+// with no template and for accounts that are gone are dropped, an error
+// sending has the job retried
+func (e *Email) Notify(ctx context.Context, n service.Notification) error {
+	account, err := e.accounts.GetByID(ctx, n.AccountID)
+	if helper.Status(err) == http.StatusNotFound {
+		helper.Logger(ctx).Info("dropping notification of deleted account", "account_id", n.AccountID, "event", n.Event)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	msg, err := e.templates.Render(n.Event, TemplateData{Locale: account.Locale, Account: account, Data: n.Data})
+	if errors.Is(err, ErrNoTemplate) {
+		helper.Logger(ctx).Debug("no email for notification", "account_id", n.AccountID, "event", n.Event)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("rendering %s email: %w", n.Event, err)
+	}
+	msg.From = e.from
+	msg.To = account.Email
+	if err := e.mailer.Send(ctx, msg); err != nil {
+		return err
+	}
+	helper.Logger(ctx).Info("email sent", "account_id", n.AccountID, "event", n.Event)
+	return nil
+}
@@ -0,0 +1,335 @@
+package notifier
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Cprime50/Gopay/config"
+	"github.com/Cprime50/Gopay/i18n"
+	models "github.com/Cprime50/Gopay/models/account"
+	"github.com/Cprime50/Gopay/service"
+)
+
+// captured is an email received by captureServer
+type captured struct {
+	from string
+	to   []string
+	data string
+}
+
+// captureServer is a minimal smtp server keeping what it's sent, like
+// mailhog. Recipients in reject are refused
+func captureServer(t *testing.T, reject ...string) (config.SMTP, <-chan captured) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listening: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	received := make(chan captured, 10)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serveSMTP(conn, reject, received)
+		}
+	}()
+	host, port, _ := net.SplitHostPort(l.Addr().String())
+	return config.SMTP{Host: host, Port: port, TLS: "none", Timeout: 5 * time.Second}, received
+}
+
+func serveSMTP(conn net.Conn, reject []string, received chan<- captured) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+
+	var msg captured
+	reply("220 localhost capture")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch verb {
+		case "EHLO", "HELO":
+			reply("250 localhost")
+		case "MAIL":
+			msg.from = strings.Trim(strings.TrimPrefix(line, "MAIL FROM:"), "<>")
+			reply("250 OK")
+		case "RCPT":
+			to := strings.Trim(strings.TrimPrefix(line, "RCPT TO:"), "<>")
+			if slices.Contains(reject, to) {
+				reply("550 no such user")
+				continue
+			}
+			msg.to = append(msg.to, to)
+			reply("250 OK")
+		case "DATA":
+			reply("354 end with .")
+			var data strings.Builder
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(line, "."))
+			}
+			msg.data = data.String()
+			received <- msg
+			msg = captured{}
+			reply("250 OK")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+// parts decodes an email, returning its headers and its bodies by content type
+func parts(t *testing.T, data string) (mail.Header, map[string]string) {
+	t.Helper()
+	msg, err := mail.ReadMessage(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("reading email: %v", err)
+	}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("content type: got %q, %v", msg.Header.Get("Content-Type"), err)
+	}
+	bodies := make(map[string]string)
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("reading part: %v", err)
+		}
+		body, _ := io.ReadAll(part)
+		contentType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		// lines end in CRLF on the wire
+		bodies[contentType] = strings.ReplaceAll(string(body), "\r\n", "\n")
+	}
+	return msg.Header, bodies
+}
+
+func testMessage() *Message {
+	return &Message{
+		From:    "Gopay <no-reply@gopay.local>",
+		To:      "jane@mail.com",
+		Subject: "Vous avez reçu 25.00",
+		Text:    "Bonjour Jane,\n\nVous avez reçu 25.00 de John Doe.\n",
+		HTML:    "<p>Bonjour Jane,</p><p>Vous avez reçu <strong>25.00</strong> de John Doe.</p>",
+	}
+}
+
+func TestSMTP(t *testing.T) {
+	cfg, received := captureServer(t)
+	if err := NewSMTP(cfg).Send(context.Background(), testMessage()); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+
+	got := <-received
+	if got.from != "no-reply@gopay.local" || len(got.to) != 1 || got.to[0] != "jane@mail.com" {
+		t.Fatalf("envelope: got %s to %v", got.from, got.to)
+	}
+	header, bodies := parts(t, got.data)
+	subject, _ := new(mime.WordDecoder).DecodeHeader(header.Get("Subject"))
+	if subject != "Vous avez reçu 25.00" || header.Get("Message-ID") == "" {
+		t.Fatalf("headers: got %v", header)
+	}
+	if bodies["text/plain"] != testMessage().Text || bodies["text/html"] != testMessage().HTML {
+		t.Fatalf("bodies: got %q", bodies)
+	}
+}
+
+func TestSMTPErrors(t *testing.T) {
+	cfg, _ := captureServer(t, "nobody@mail.com")
+	msg := testMessage()
+	msg.To = "nobody@mail.com"
+	if err := NewSMTP(cfg).Send(context.Background(), msg); err == nil || !strings.Contains(err.Error(), "RCPT TO") {
+		t.Fatalf("rejected recipient: got %v", err)
+	}
+
+	// the server doesn't offer STARTTLS
+	cfg.TLS = "starttls"
+	if err := NewSMTP(cfg).Send(context.Background(), testMessage()); err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Fatalf("starttls: got %v", err)
+	}
+
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	_, cfg.Port, _ = net.SplitHostPort(l.Addr().String())
+	l.Close()
+	if err := NewSMTP(cfg).Send(context.Background(), testMessage()); err == nil {
+		t.Fatal("sent to a closed port")
+	}
+}
+
+func TestFile(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mail")
+	mailer, err := NewMailer(config.Mail{Driver: "file", Dir: dir})
+	if err != nil {
+		t.Fatalf("new mailer: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := mailer.Send(context.Background(), testMessage()); err != nil {
+			t.Fatalf("send: %v", err)
+		}
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if len(files) != 2 {
+		t.Fatalf("got %d files, want 2", len(files))
+	}
+	data, _ := os.ReadFile(files[0])
+	if _, bodies := parts(t, string(data)); bodies["text/plain"] != testMessage().Text {
+		t.Fatalf("bodies: got %q", bodies)
+	}
+}
+
+// sampleData has every key any template uses
+var sampleData = map[string]any{
+	"amount":                      25.5,
+	"counterparty_name":           "John <Doe>",
+	"counterparty_account_number": float64(1234567890),
+	"reference":                   "6f1c1d9e-6b5c-4a43-9d3e-4a0b2d1c7e10",
+	"occurred_at":                 "2024-01-31T09:00:00.123Z",
+	"to_account_number":           float64(1234567891),
+	"due_at":                      "2024-01-31T09:00:00Z",
+	"reason":                      "insufficient funds",
+	"url":                         "https://example.com/hook",
+	"failures":                    float64(20),
+	"balance_after":               float64(74.5),
+}
+
+func TestTemplates(t *testing.T) {
+	templates, err := LoadTemplates()
+	if err != nil {
+		t.Fatalf("loading templates: %v", err)
+	}
+	account := &models.Account{FirstName: "Jane", LastName: "Doe", AccountNumber: 1234567891, Locale: i18n.French}
+
+	// every locale has the same emails, rendered without missing values
+	for event := range templates.byLocale[i18n.Default] {
+		for _, locale := range i18n.Supported {
+			if _, ok := templates.byLocale[locale][event]; !ok {
+				t.Errorf("%s: no %s template", event, locale)
+				continue
+			}
+			msg, err := templates.Render(event, TemplateData{Locale: locale, Account: account, Data: sampleData})
+			if err != nil {
+				t.Errorf("%s %s: %v", locale, event, err)
+				continue
+			}
+			for _, body := range []string{msg.Subject, msg.Text, msg.HTML} {
+				if body == "" || strings.Contains(body, "<no value>") || strings.Contains(body, "e+09") || strings.Contains(body, "%!") {
+					t.Errorf("%s %s: got %q", locale, event, body)
+				}
+			}
+			if !strings.Contains(msg.HTML, `lang="`+locale+`"`) {
+				t.Errorf("%s %s: html isn't in its locale", locale, event)
+			}
+		}
+	}
+
+	msg, err := templates.Render(service.EventTransferReceived, TemplateData{Locale: i18n.French, Account: account, Data: sampleData})
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	if msg.Subject != "Vous avez reçu 25.50 de John <Doe>" {
+		t.Fatalf("subject: got %q", msg.Subject)
+	}
+	if !strings.Contains(msg.Text, "compte 1234567890") || !strings.Contains(msg.Text, "31 Jan 2024 09:00 UTC") {
+		t.Fatalf("text: got %q", msg.Text)
+	}
+	if !strings.Contains(msg.HTML, "John &lt;Doe&gt;") {
+		t.Fatalf("html isn't escaped: got %q", msg.HTML)
+	}
+
+	// unsupported locales fall back to the default
+	msg, _ = templates.Render(service.EventTransferReceived, TemplateData{Locale: "de", Account: account, Data: sampleData})
+	if !strings.HasPrefix(msg.Subject, "You received") || !strings.Contains(msg.HTML, `lang="en"`) {
+		t.Fatalf("fallback: got %q", msg.Subject)
+	}
+	if _, err := templates.Render("account.deleted", TemplateData{Locale: i18n.English, Account: account}); !errors.Is(err, ErrNoTemplate) {
+		t.Fatalf("unknown event: got %v", err)
+	}
+}
+
+// recordingMailer keeps the emails it's sent, failing with err when set
+type recordingMailer struct {
+	sent []*Message
+	err  error
+}
+
+func (m *recordingMailer) Send(ctx context.Context, msg *Message) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+func TestEmail(t *testing.T) {
+	ctx := context.Background()
+	accounts := models.NewMemoryAccountRepository()
+	jane := &models.Account{Email: "jane@mail.com", FirstName: "Jane", LastName: "Doe", Password: "hash", AccountNumber: 1234567891, RoleID: models.UserRoleID, Locale: i18n.French}
+	if err := accounts.Create(ctx, jane); err != nil {
+		t.Fatalf("creating account: %v", err)
+	}
+	templates, err := LoadTemplates()
+	if err != nil {
+		t.Fatalf("loading templates: %v", err)
+	}
+	mailer := &recordingMailer{}
+	email := NewEmail(accounts, mailer, templates, "Gopay <no-reply@gopay.local>")
+
+	if err := email.Notify(ctx, service.Notification{AccountID: jane.ID, Event: service.EventTransferReceived, Data: sampleData}); err != nil {
+		t.Fatalf("notify: %v", err)
+	}
+	if len(mailer.sent) != 1 {
+		t.Fatalf("sent %d emails, want 1", len(mailer.sent))
+	}
+	if msg := mailer.sent[0]; msg.To != "jane@mail.com" || msg.From != "Gopay <no-reply@gopay.local>" || !strings.HasPrefix(msg.Subject, "Vous avez reçu") {
+		t.Fatalf("email: got %+v", msg)
+	}
+
+	// events without an email and deleted accounts are dropped, send errors retried
+	if err := email.Notify(ctx, service.Notification{AccountID: jane.ID, Event: "account.activated"}); err != nil {
+		t.Fatalf("no template: got %v", err)
+	}
+	deleted := models.Account{}
+	if err := email.Notify(ctx, service.Notification{AccountID: deleted.ID, Event: service.EventTransferReceived, Data: sampleData}); err != nil {
+		t.Fatalf("deleted account: got %v", err)
+	}
+	if len(mailer.sent) != 1 {
+		t.Fatalf("sent %d emails, want 1", len(mailer.sent))
+	}
+	mailer.err = errors.New("connection refused")
+	if err := email.Notify(ctx, service.Notification{AccountID: jane.ID, Event: service.EventTransferReceived, Data: sampleData}); err == nil {
+		t.Fatal("send error: got nil")
+	}
+}
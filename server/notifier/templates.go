@@ -0,0 +1,154 @@
+package notifier
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/Cprime50/Gopay/i18n"
+	models "github.com/Cprime50/Gopay/models/account"
+)
+
+// templates holds, per locale, a template for each notification event
+// named <event>.tmpl defining its "subject", "text" and "content", the
+// HTML body wrapped in layout.tmpl. footer.tmpl defines the "footer"
+// shared by every email of the locale
+//
+//go:embed templates
+var templates embed.FS
+
+// ErrNoTemplate is returned when no email is sent for an event
+var ErrNoTemplate = errors.New("notifier: no template for event")
+
+// TemplateData is what the templates are executed with
+type TemplateData struct {
+	Locale  string
+	Account *models.Account
+	// Data is the notification's data
+	Data map[string]any
+}
+
+// eventTemplates is the parsed template of one event in one locale,
+// the same source parsed for the plain text and the HTML body
+type eventTemplates struct {
+	text *texttemplate.Template
+	html *htmltemplate.Template
+}
+
+// Templates renders notification emails
+type Templates struct {
+	// byLocale maps locale then event to its templates
+	byLocale map[string]map[string]eventTemplates
+}
+
+// funcs are the helpers available in templates
+var funcs = map[string]any{
+	// money formats an amount, numbers in data are float64 once decoded from the queue
+	"money": func(v any) string {
+		switch n := v.(type) {
+		case float64:
+			return fmt.Sprintf("%.2f", n)
+		case int:
+			return fmt.Sprintf("%d.00", n)
+		}
+		return fmt.Sprint(v)
+	},
+	// number formats a whole number such as an account number without an exponent
+	"number": func(v any) string {
+		if n, ok := v.(float64); ok {
+			return fmt.Sprintf("%.0f", n)
+		}
+		return fmt.Sprint(v)
+	},
+	// date formats a time or an RFC 3339 string, times in data are strings once decoded from the queue
+	"date": func(v any) string {
+		t, ok := v.(time.Time)
+		if s, isString := v.(string); isString {
+			parsed, err := time.Parse(time.RFC3339, s)
+			t, ok = parsed, err == nil
+		}
+		if !ok {
+			return fmt.Sprint(v)
+		}
+		return t.UTC().Format("2 Jan 2006 15:04 MST")
+	},
+}
+
+// LoadTemplates parses the embedded templates of every supported locale
+func LoadTemplates() (*Templates, error) {
+	layout, err := fs.ReadFile(templates, "templates/layout.tmpl")
+	if err != nil {
+		return nil, err
+	}
+	t := &Templates{byLocale: make(map[string]map[string]eventTemplates)}
+	for _, locale := range i18n.Supported {
+		dir := path.Join("templates", locale)
+		footer, err := fs.ReadFile(templates, path.Join(dir, "footer.tmpl"))
+		if err != nil {
+			return nil, fmt.Errorf("locale %s: %w", locale, err)
+		}
+		files, err := fs.ReadDir(templates, dir)
+		if err != nil {
+			return nil, fmt.Errorf("locale %s: %w", locale, err)
+		}
+
+		t.byLocale[locale] = make(map[string]eventTemplates)
+		for _, file := range files {
+			event, ok := strings.CutSuffix(file.Name(), ".tmpl")
+			if !ok || event == "footer" {
+				continue
+			}
+			source, err := fs.ReadFile(templates, path.Join(dir, file.Name()))
+			if err != nil {
+				return nil, err
+			}
+			name := locale + "/" + event
+			text, err := texttemplate.New(name).Funcs(funcs).Parse(string(footer) + string(source))
+			if err != nil {
+				return nil, err
+			}
+			html, err := htmltemplate.New(name).Funcs(funcs).Parse(string(layout) + string(footer) + string(source))
+			if err != nil {
+				return nil, err
+			}
+			t.byLocale[locale][event] = eventTemplates{text: text, html: html}
+		}
+	}
+	return t, nil
+}
+
+// Render executes the templates of event in data's locale, or the
+// default locale if it has none, returning the message without its
+// sender and recipient
+func (t *Templates) Render(event string, data TemplateData) (*Message, error) {
+	tmpl, ok := t.byLocale[data.Locale][event]
+	if !ok {
+		data.Locale = i18n.Default
+		if tmpl, ok = t.byLocale[i18n.Default][event]; !ok {
+			return nil, fmt.Errorf("%w %s", ErrNoTemplate, event)
+		}
+	}
+
+	var subject, text, html bytes.Buffer
+	if err := tmpl.text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return nil, err
+	}
+	if err := tmpl.text.ExecuteTemplate(&text, "text", data); err != nil {
+		return nil, err
+	}
+	if err := tmpl.html.ExecuteTemplate(&html, "layout", data); err != nil {
+		return nil, err
+	}
+	return &Message{
+		Subject: strings.TrimSpace(subject.String()),
+		Text:    strings.TrimSpace(text.String()) + "\n",
+		HTML:    html.String(),
+	}, nil
+}
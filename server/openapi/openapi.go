@@ -0,0 +1,265 @@
+// Package openapi builds an OpenAPI 3.1 document from route descriptions,
+// with request and response schemas generated from the Go types the
+// handlers bind and render, so the spec can't drift from the code
+package openapi
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Version is the OpenAPI version of the documents built here
+const Version = "3.1.0"
+
+// Media types of request and response bodies
+const (
+	JSON        = "application/json"
+	ProblemJSON = "application/problem+json"
+	Text        = "text/plain"
+)
+
+// Document is an OpenAPI document, only the parts the API uses are modelled
+type Document struct {
+	OpenAPI    string               `json:"openapi"`
+	Info       Info                 `json:"info"`
+	Servers    []Server             `json:"servers,omitempty"`
+	Tags       []Tag                `json:"tags,omitempty"`
+	Paths      map[string]*PathItem `json:"paths"`
+	Components Components           `json:"components"`
+}
+
+// Info describes the API
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// Server is a base URL the API is served from
+type Server struct {
+	URL string `json:"url"`
+}
+
+// Tag groups operations in the docs UI
+type Tag struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// PathItem holds the operations of a path, keyed by lowercase method
+type PathItem map[string]*Operation
+
+// Components holds the schemas and security schemes operations refer to
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+// SecurityScheme is how a client authenticates
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+	Description  string `json:"description,omitempty"`
+}
+
+// Operation is a single method on a path
+type Operation struct {
+	OperationID string                `json:"operationId"`
+	Summary     string                `json:"summary"`
+	Description string                `json:"description,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Parameters  []*Parameter          `json:"parameters,omitempty"`
+	Security    []map[string][]string `json:"security,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]*Response  `json:"responses"`
+}
+
+// Parameter is a path, query or header parameter
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Required    bool    `json:"required,omitempty"`
+	Description string  `json:"description,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+// RequestBody is an operation's body
+type RequestBody struct {
+	Required bool                  `json:"required"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+// Response is one of an operation's responses
+type Response struct {
+	Description string                `json:"description"`
+	Headers     map[string]*Header    `json:"headers,omitempty"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+// Header is a response header
+type Header struct {
+	Description string  `json:"description,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+// MediaType holds the schema of a body
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Route describes one endpoint, New turns routes into a Document
+type Route struct {
+	Method string
+	// Path is in gin's syntax, eg /api/accounts/:id
+	Path        string
+	Summary     string
+	Description string
+	Tag         string
+	// Security names the security scheme the route requires, if any
+	Security string
+	// Request is a value of the body type, nil if there is no body
+	Request any
+	// Status is the success status, 200 if not set
+	Status int
+	// Response is a value of the success body type, nil if there is none
+	Response any
+	// ResponseType is the success media type, JSON if not set
+	ResponseType string
+	// Errors are the statuses the route can fail with, each a problem+json
+	Errors []int
+	// Headers are documented on the success response, eg Retry-After
+	Headers map[string]*Header
+}
+
+// ginParam matches path parameters in gin's syntax
+var ginParam = regexp.MustCompile(`[:*]([A-Za-z0-9_]+)`)
+
+// OpenAPIPath converts a gin path to OpenAPI's syntax, /accounts/:id to /accounts/{id}
+func OpenAPIPath(path string) string {
+	return ginParam.ReplaceAllString(path, "{$1}")
+}
+
+// New builds the document for routes. problem is the error body type,
+// rendered for every error status a route lists
+func New(info Info, routes []Route, problem any, securitySchemes map[string]*SecurityScheme) (*Document, error) {
+	doc := &Document{
+		OpenAPI: Version,
+		Info:    info,
+		Paths:   make(map[string]*PathItem),
+		Components: Components{
+			Schemas:         make(map[string]*Schema),
+			SecuritySchemes: securitySchemes,
+		},
+	}
+	g := &generator{schemas: doc.Components.Schemas}
+	problemSchema := g.schema(problem)
+
+	tags := make(map[string]bool)
+	ids := make(map[string]bool)
+	for _, route := range routes {
+		path := OpenAPIPath(route.Path)
+		item, ok := doc.Paths[path]
+		if !ok {
+			item = &PathItem{}
+			doc.Paths[path] = item
+		}
+		method := strings.ToLower(route.Method)
+		if _, exists := (*item)[method]; exists {
+			return nil, fmt.Errorf("openapi: %s %s is described twice", route.Method, route.Path)
+		}
+
+		op := &Operation{
+			OperationID: operationID(route),
+			Summary:     route.Summary,
+			Description: route.Description,
+			Responses:   make(map[string]*Response),
+		}
+		if ids[op.OperationID] {
+			return nil, fmt.Errorf("openapi: duplicate operation id %s", op.OperationID)
+		}
+		ids[op.OperationID] = true
+
+		if route.Tag != "" {
+			op.Tags = []string{route.Tag}
+			if !tags[route.Tag] {
+				tags[route.Tag] = true
+				doc.Tags = append(doc.Tags, Tag{Name: route.Tag})
+			}
+		}
+		if route.Security != "" {
+			if _, ok := securitySchemes[route.Security]; !ok {
+				return nil, fmt.Errorf("openapi: %s %s uses unknown security scheme %s", route.Method, route.Path, route.Security)
+			}
+			op.Security = []map[string][]string{{route.Security: {}}}
+		}
+		for _, match := range ginParam.FindAllStringSubmatch(route.Path, -1) {
+			op.Parameters = append(op.Parameters, &Parameter{Name: match[1], In: "path", Required: true, Schema: &Schema{Type: "string"}})
+		}
+		if route.Request != nil {
+			op.RequestBody = &RequestBody{
+				Required: true,
+				Content:  map[string]*MediaType{JSON: {Schema: g.schema(route.Request)}},
+			}
+		}
+
+		status := route.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		success := &Response{Description: http.StatusText(status), Headers: route.Headers}
+		if route.Response != nil || route.ResponseType != "" {
+			mediaType := route.ResponseType
+			if mediaType == "" {
+				mediaType = JSON
+			}
+			schema := &Schema{Type: "string"}
+			if route.Response != nil {
+				schema = g.schema(route.Response)
+			}
+			success.Content = map[string]*MediaType{mediaType: {Schema: schema}}
+		}
+		op.Responses[strconv.Itoa(status)] = success
+
+		for _, errStatus := range route.Errors {
+			op.Responses[strconv.Itoa(errStatus)] = &Response{
+				Description: http.StatusText(errStatus),
+				Content:     map[string]*MediaType{ProblemJSON: {Schema: problemSchema}},
+			}
+		}
+		(*item)[method] = op
+	}
+
+	sort.Slice(doc.Tags, func(i, j int) bool { return doc.Tags[i].Name < doc.Tags[j].Name })
+	return doc, nil
+}
+
+// Operation returns the operation for a method and gin path, nil if it isn't documented
+func (d *Document) Operation(method string, path string) *Operation {
+	item, ok := d.Paths[OpenAPIPath(path)]
+	if !ok {
+		return nil
+	}
+	return (*item)[strings.ToLower(method)]
+}
+
+// operationID is a stable ID such as putApiMeLocale
+func operationID(route Route) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(route.Method))
+	for _, part := range strings.FieldsFunc(route.Path, func(r rune) bool { return r == '/' || r == '-' || r == '_' || r == '.' }) {
+		part = strings.TrimLeft(part, ":*")
+		if part == "" {
+			continue
+		}
+		b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	if b.Len() == len(route.Method) {
+		b.WriteString("Root")
+	}
+	return b.String()
+}
@@ -0,0 +1,88 @@
+package openapi
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type embedded struct {
+	Token string `json:"token"`
+}
+
+type item struct {
+	ID uuid.UUID
+	embedded
+	Secret  string    `json:"-"`
+	Created time.Time `json:"created_at"`
+	Amount  float64   `json:"amount" binding:"required,gt=0"`
+	Kind    string    `json:"kind" binding:"omitempty,oneof=a b"`
+	Name    string    `json:"name" binding:"required,min=3,max=10,alphanum"`
+	Next    *item     `json:"next,omitempty"`
+	Tags    []string  `json:"tags"`
+	hidden  string
+}
+
+func TestSchema(t *testing.T) {
+	doc, err := New(Info{Title: "test", Version: "1"}, []Route{
+		{Method: http.MethodPost, Path: "/items/:id", Request: item{}, Status: http.StatusCreated, Response: item{}, Errors: []int{http.StatusBadRequest}},
+	}, struct {
+		Code string `json:"code"`
+	}{}, nil)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	s, ok := doc.Components.Schemas["Item"]
+	if !ok {
+		t.Fatalf("no Item schema in %v", doc.Components.Schemas)
+	}
+	want := []string{"ID", "token", "created_at", "amount", "kind", "name", "next", "tags"}
+	if len(s.Properties) != len(want) {
+		t.Errorf("got properties %v, want %v", s.Properties, want)
+	}
+	for _, name := range want {
+		if s.Properties[name] == nil {
+			t.Errorf("missing property %s", name)
+		}
+	}
+	if s.Properties["ID"].Format != "uuid" || s.Properties["created_at"].Format != "date-time" {
+		t.Errorf("uuid and time should be formatted strings, got %+v %+v", s.Properties["ID"], s.Properties["created_at"])
+	}
+	if s.Properties["next"].Ref != Ref("Item") || s.Properties["tags"].Items.Type != "string" {
+		t.Errorf("unexpected next %+v or tags %+v", s.Properties["next"], s.Properties["tags"])
+	}
+	if len(s.Required) != 2 || s.Required[0] != "amount" || s.Required[1] != "name" {
+		t.Errorf("got required %v", s.Required)
+	}
+	name := s.Properties["name"]
+	if *name.MinLength != 3 || *name.MaxLength != 10 || name.Pattern == "" {
+		t.Errorf("unexpected name constraints %+v", name)
+	}
+	if *s.Properties["amount"].ExclusiveMinimum != 0 || len(s.Properties["kind"].Enum) != 2 {
+		t.Errorf("unexpected amount %+v or kind %+v", s.Properties["amount"], s.Properties["kind"])
+	}
+
+	op := doc.Operation(http.MethodPost, "/items/:id")
+	if op == nil || op.OperationID != "postItemsId" || len(op.Parameters) != 1 || op.Parameters[0].Name != "id" {
+		t.Fatalf("unexpected operation %+v", op)
+	}
+	if op.Responses["201"] == nil || op.Responses["400"].Content[ProblemJSON] == nil {
+		t.Errorf("unexpected responses %+v", op.Responses)
+	}
+}
+
+func TestNewRejectsDuplicates(t *testing.T) {
+	routes := []Route{
+		{Method: http.MethodGet, Path: "/items"},
+		{Method: http.MethodGet, Path: "/items"},
+	}
+	if _, err := New(Info{}, routes, struct{}{}, nil); err == nil {
+		t.Error("expected an error for a route described twice")
+	}
+	if _, err := New(Info{}, []Route{{Method: http.MethodGet, Path: "/items", Security: "nope"}}, struct{}{}, nil); err == nil {
+		t.Error("expected an error for an unknown security scheme")
+	}
+}
@@ -0,0 +1,340 @@
+// Package queue is a durable job queue on redis. Jobs are run at least
+// once by a Worker, failed ones are retried with exponential backoff
+// and dead lettered once they run out of attempts, so handlers must be
+// idempotent.
+//
+// Each queue is kept under jobs:<queue>: as a ready list, a delayed
+// sorted set scored by when the job is due, an active sorted set
+// scored by when the running worker's lease expires and a dead list.
+// Jobs themselves are stored as JSON under jobs:job:<id>
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Cprime50/Gopay/config"
+	"github.com/Cprime50/Gopay/helper"
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+// DefaultQueue is used by job types that don't name a queue
+const DefaultQueue = "default"
+
+// promoteBatch bounds the delayed and expired jobs moved to the ready list per claim
+const promoteBatch = 100
+
+// Job is a unit of work, its payload is the JSON of a Type's payload
+type Job struct {
+	ID      uuid.UUID       `json:"id"`
+	Queue   string          `json:"queue"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload"`
+	// Attempts counts the times the job was started, including the current one
+	Attempts    int        `json:"attempts"`
+	MaxAttempts int        `json:"max_attempts"`
+	CreatedAt   time.Time  `json:"created_at"`
+	RunAt       time.Time  `json:"run_at"`
+	LastError   string     `json:"last_error,omitempty"`
+	FailedAt    *time.Time `json:"failed_at,omitempty"`
+}
+
+// Option changes a job before it's enqueued
+type Option func(job *Job)
+
+// Delay runs the job after d
+func Delay(d time.Duration) Option {
+	return func(job *Job) {
+		job.RunAt = job.RunAt.Add(d)
+	}
+}
+
+// At runs the job at t, or straight away if t is past
+func At(t time.Time) Option {
+	return func(job *Job) {
+		job.RunAt = t
+	}
+}
+
+// MaxAttempts overrides the configured attempts for the job
+func MaxAttempts(n int) Option {
+	return func(job *Job) {
+		job.MaxAttempts = n
+	}
+}
+
+// Stats counts a queue's jobs by state
+type Stats struct {
+	Ready   int64 `json:"ready"`
+	Delayed int64 `json:"delayed"`
+	Active  int64 `json:"active"`
+	Dead    int64 `json:"dead"`
+}
+
+// Queue enqueues jobs and manages the dead letter queue, Worker runs them
+type Queue struct {
+	redis *redis.Client
+	cfg   config.Jobs
+	now   func() time.Time
+}
+
+// New returns a Queue storing jobs in rdb
+func New(rdb *redis.Client, cfg config.Jobs) *Queue {
+	return &Queue{
+		redis: rdb,
+		cfg:   cfg,
+		now:   func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// Enqueue adds a job of jobType to queue, payload is encoded as JSON.
+// Prefer a Type, which keeps the payload and its handler in step
+func (q *Queue) Enqueue(ctx context.Context, queue string, jobType string, payload any, opts ...Option) (*Job, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("queue: encoding %s payload: %w", jobType, err)
+	}
+	now := q.now()
+	job := &Job{
+		ID:          uuid.New(),
+		Queue:       queue,
+		Type:        jobType,
+		Payload:     data,
+		MaxAttempts: q.cfg.MaxAttempts,
+		CreatedAt:   now,
+		RunAt:       now,
+	}
+	for _, opt := range opts {
+		opt(job)
+	}
+
+	encoded, err := json.Marshal(job)
+	if err != nil {
+		return nil, fmt.Errorf("queue: encoding job: %w", err)
+	}
+	_, err = q.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, jobKey(job.ID.String()), encoded, 0)
+		if job.RunAt.After(now) {
+			pipe.ZAdd(ctx, delayedKey(queue), &redis.Z{Score: score(job.RunAt), Member: job.ID.String()})
+		} else {
+			pipe.LPush(ctx, readyKey(queue), job.ID.String())
+		}
+		return nil
+	})
+	if err != nil {
+		helper.Logger(ctx).Error("error enqueuing job", "queue", queue, "type", jobType, "error", err)
+		return nil, helper.NewInternal()
+	}
+	return job, nil
+}
+
+// Stats counts the jobs of queue in each state
+func (q *Queue) Stats(ctx context.Context, queue string) (Stats, error) {
+	pipe := q.redis.Pipeline()
+	ready := pipe.LLen(ctx, readyKey(queue))
+	delayed := pipe.ZCard(ctx, delayedKey(queue))
+	active := pipe.ZCard(ctx, activeKey(queue))
+	dead := pipe.LLen(ctx, deadKey(queue))
+	if _, err := pipe.Exec(ctx); err != nil {
+		helper.Logger(ctx).Error("error counting jobs", "queue", queue, "error", err)
+		return Stats{}, helper.NewInternal()
+	}
+	return Stats{Ready: ready.Val(), Delayed: delayed.Val(), Active: active.Val(), Dead: dead.Val()}, nil
+}
+
+// Dead returns up to limit of queue's dead jobs, most recent first
+func (q *Queue) Dead(ctx context.Context, queue string, limit int) ([]*Job, error) {
+	ids, err := q.redis.LRange(ctx, deadKey(queue), 0, int64(limit)-1).Result()
+	if err != nil {
+		helper.Logger(ctx).Error("error listing dead jobs", "queue", queue, "error", err)
+		return nil, helper.NewInternal()
+	}
+	jobs := make([]*Job, 0, len(ids))
+	for _, id := range ids {
+		job, err := q.get(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if job != nil {
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs, nil
+}
+
+// Retry moves a dead job back to its queue with fresh attempts
+func (q *Queue) Retry(ctx context.Context, queue string, id uuid.UUID) error {
+	removed, err := q.redis.LRem(ctx, deadKey(queue), 1, id.String()).Result()
+	if err != nil {
+		helper.Logger(ctx).Error("error retrying dead job", "queue", queue, "job_id", id, "error", err)
+		return helper.NewInternal()
+	}
+	if removed == 0 {
+		return helper.NewNotFound("dead job", id.String())
+	}
+
+	job, err := q.get(ctx, id.String())
+	if err != nil {
+		return err
+	}
+	if job == nil {
+		return helper.NewNotFound("job", id.String())
+	}
+	job.Attempts, job.FailedAt, job.RunAt = 0, nil, q.now()
+	return q.save(ctx, job, func(pipe redis.Pipeliner) {
+		pipe.LPush(ctx, readyKey(queue), job.ID.String())
+	})
+}
+
+// claimScript moves due delayed jobs and jobs whose worker's lease
+// expired to the ready list, then leases the oldest ready job to the caller
+var claimScript = redis.NewScript(`
+local due = redis.call('ZRANGEBYSCORE', KEYS[2], '-inf', ARGV[1], 'LIMIT', 0, ARGV[3])
+for _, id in ipairs(due) do
+	redis.call('ZREM', KEYS[2], id)
+	redis.call('LPUSH', KEYS[1], id)
+end
+local expired = redis.call('ZRANGEBYSCORE', KEYS[3], '-inf', ARGV[1], 'LIMIT', 0, ARGV[3])
+for _, id in ipairs(expired) do
+	redis.call('ZREM', KEYS[3], id)
+	redis.call('RPUSH', KEYS[1], id)
+end
+local id = redis.call('RPOP', KEYS[1])
+if not id then
+	return false
+end
+redis.call('ZADD', KEYS[3], ARGV[2], id)
+return id
+`)
+
+// claim leases the next job of queue for the configured lease, nil if there is none.
+// Its attempts are counted now so a job that crashes its worker still runs out
+func (q *Queue) claim(ctx context.Context, queue string) (*Job, error) {
+	now := q.now()
+	id, err := claimScript.Run(ctx, q.redis,
+		[]string{readyKey(queue), delayedKey(queue), activeKey(queue)},
+		score(now), score(now.Add(q.cfg.Lease)), promoteBatch,
+	).Text()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("queue: claiming job from %s: %w", queue, err)
+	}
+
+	job, err := q.get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if job == nil {
+		// its data is gone, so there's nothing to run
+		q.redis.ZRem(ctx, activeKey(queue), id)
+		return nil, nil
+	}
+	if job.Attempts >= job.MaxAttempts {
+		// its last attempt never finished, eg its worker crashed
+		job.LastError = "the last attempt did not finish before its lease expired"
+		return nil, q.kill(ctx, job)
+	}
+	job.Attempts++
+	if err := q.save(ctx, job, nil); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// complete removes a job that ran successfully
+func (q *Queue) complete(ctx context.Context, job *Job) error {
+	_, err := q.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRem(ctx, activeKey(job.Queue), job.ID.String())
+		pipe.Del(ctx, jobKey(job.ID.String()))
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("queue: completing job %s: %w", job.ID, err)
+	}
+	return nil
+}
+
+// retry puts a failed job back to run at runAt
+func (q *Queue) retry(ctx context.Context, job *Job, runAt time.Time) error {
+	job.RunAt = runAt
+	return q.save(ctx, job, func(pipe redis.Pipeliner) {
+		pipe.ZRem(ctx, activeKey(job.Queue), job.ID.String())
+		pipe.ZAdd(ctx, delayedKey(job.Queue), &redis.Z{Score: score(runAt), Member: job.ID.String()})
+	})
+}
+
+// kill moves a job that won't be retried to the dead letter queue
+func (q *Queue) kill(ctx context.Context, job *Job) error {
+	now := q.now()
+	job.FailedAt = &now
+	return q.save(ctx, job, func(pipe redis.Pipeliner) {
+		pipe.ZRem(ctx, activeKey(job.Queue), job.ID.String())
+		pipe.LPush(ctx, deadKey(job.Queue), job.ID.String())
+	})
+}
+
+// backoff is how long to wait before the next attempt at job
+func (q *Queue) backoff(job *Job) time.Duration {
+	backoff := q.cfg.Backoff
+	for i := 1; i < job.Attempts && backoff < q.cfg.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > q.cfg.MaxBackoff {
+		backoff = q.cfg.MaxBackoff
+	}
+	return backoff
+}
+
+// get loads a job, nil if it doesn't exist
+func (q *Queue) get(ctx context.Context, id string) (*Job, error) {
+	data, err := q.redis.Get(ctx, jobKey(id)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		helper.Logger(ctx).Error("error loading job", "job_id", id, "error", err)
+		return nil, helper.NewInternal()
+	}
+	var job Job
+	if err := json.Unmarshal(data, &job); err != nil {
+		return nil, fmt.Errorf("queue: decoding job %s: %w", id, err)
+	}
+	return &job, nil
+}
+
+// save stores job along with the moves in move, in one transaction
+func (q *Queue) save(ctx context.Context, job *Job, move func(pipe redis.Pipeliner)) error {
+	encoded, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("queue: encoding job %s: %w", job.ID, err)
+	}
+	_, err = q.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, jobKey(job.ID.String()), encoded, 0)
+		if move != nil {
+			move(pipe)
+		}
+		return nil
+	})
+	if err != nil {
+		helper.Logger(ctx).Error("error saving job", "job_id", job.ID, "error", err)
+		return helper.NewInternal()
+	}
+	return nil
+}
+
+func jobKey(id string) string        { return "jobs:job:" + id }
+func readyKey(queue string) string   { return "jobs:" + queue + ":ready" }
+func delayedKey(queue string) string { return "jobs:" + queue + ":delayed" }
+func activeKey(queue string) string  { return "jobs:" + queue + ":active" }
+func deadKey(queue string) string    { return "jobs:" + queue + ":dead" }
+
+// score is t in unix milliseconds, the sorted sets' scores
+func score(t time.Time) float64 {
+	return float64(t.UnixMilli())
+}
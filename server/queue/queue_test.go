@@ -0,0 +1,289 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Cprime50/Gopay/config"
+	"github.com/Cprime50/Gopay/helper"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+type greeting struct {
+	Name string `json:"name"`
+}
+
+var greet = NewType[greeting]("greetings", "greet")
+
+// newTestQueue returns a queue on miniredis with a clock the test moves
+func newTestQueue(t *testing.T) (*Queue, *time.Time) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+
+	cfg := config.Default().Jobs
+	cfg.MaxAttempts = 3
+	cfg.PollInterval = 10 * time.Millisecond
+	q := New(rdb, cfg)
+	now := time.Date(2024, time.January, 1, 9, 0, 0, 0, time.UTC)
+	q.now = func() time.Time { return now }
+	return q, &now
+}
+
+func stats(t *testing.T, q *Queue) Stats {
+	t.Helper()
+	s, err := q.Stats(context.Background(), greet.Queue)
+	if err != nil {
+		t.Fatalf("stats: %v", err)
+	}
+	return s
+}
+
+func runOne(t *testing.T, w *Worker, want bool) {
+	t.Helper()
+	ran, err := w.RunOne(context.Background(), greet.Queue)
+	if err != nil || ran != want {
+		t.Fatalf("run one: got %v, %v, want %v", ran, err, want)
+	}
+}
+
+func TestTypedJob(t *testing.T) {
+	ctx := context.Background()
+	q, now := newTestQueue(t)
+	w := q.NewWorker()
+	var got []string
+	greet.Handle(w, func(ctx context.Context, payload greeting) error {
+		got = append(got, payload.Name)
+		return nil
+	})
+
+	for _, name := range []string{"john", "jane"} {
+		if _, err := greet.Enqueue(ctx, q, greeting{Name: name}); err != nil {
+			t.Fatalf("enqueue: %v", err)
+		}
+	}
+	if _, err := greet.Enqueue(ctx, q, greeting{Name: "later"}, Delay(time.Minute)); err != nil {
+		t.Fatalf("enqueue delayed: %v", err)
+	}
+	if s := stats(t, q); s != (Stats{Ready: 2, Delayed: 1}) {
+		t.Fatalf("stats after enqueue: %+v", s)
+	}
+
+	// oldest first, and the delayed job waits until it's due
+	runOne(t, w, true)
+	runOne(t, w, true)
+	runOne(t, w, false)
+	*now = now.Add(time.Minute)
+	runOne(t, w, true)
+	if len(got) != 3 || got[0] != "john" || got[1] != "jane" || got[2] != "later" {
+		t.Fatalf("handled %v", got)
+	}
+	if s := stats(t, q); s != (Stats{}) {
+		t.Fatalf("stats after running: %+v", s)
+	}
+}
+
+func TestRetriesAndDeadLetters(t *testing.T) {
+	ctx := context.Background()
+	q, now := newTestQueue(t)
+	w := q.NewWorker()
+	fail := true
+	greet.Handle(w, func(ctx context.Context, payload greeting) error {
+		if fail {
+			return errors.New("smtp is down")
+		}
+		return nil
+	})
+
+	job, err := greet.Enqueue(ctx, q, greeting{Name: "john"})
+	if err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+
+	// retried after the backoff, doubling each time
+	backoff := q.cfg.Backoff
+	for attempt := 1; attempt < q.cfg.MaxAttempts; attempt++ {
+		runOne(t, w, true)
+		if s := stats(t, q); s != (Stats{Delayed: 1}) {
+			t.Fatalf("attempt %d: stats %+v", attempt, s)
+		}
+		*now = now.Add(backoff - time.Millisecond)
+		runOne(t, w, false)
+		*now = now.Add(time.Millisecond)
+		backoff *= 2
+	}
+
+	// the last attempt dead letters it
+	runOne(t, w, true)
+	if s := stats(t, q); s != (Stats{Dead: 1}) {
+		t.Fatalf("stats after last attempt: %+v", s)
+	}
+	dead, err := q.Dead(ctx, greet.Queue, 10)
+	if err != nil || len(dead) != 1 || dead[0].ID != job.ID || dead[0].Attempts != q.cfg.MaxAttempts || dead[0].LastError != "smtp is down" || dead[0].FailedAt == nil {
+		t.Fatalf("dead: got %+v, %v", dead, err)
+	}
+
+	// retrying puts it back with fresh attempts
+	fail = false
+	if err := q.Retry(ctx, greet.Queue, job.ID); err != nil {
+		t.Fatalf("retry: %v", err)
+	}
+	if err := q.Retry(ctx, greet.Queue, job.ID); helper.Status(err) != http.StatusNotFound {
+		t.Fatalf("retry twice: got %v, want not found", err)
+	}
+	runOne(t, w, true)
+	if s := stats(t, q); s != (Stats{}) {
+		t.Fatalf("stats after retry: %+v", s)
+	}
+}
+
+func TestPermanentFailures(t *testing.T) {
+	ctx := context.Background()
+	q, _ := newTestQueue(t)
+	w := q.NewWorker()
+	greet.Handle(w, func(ctx context.Context, payload greeting) error {
+		if payload.Name == "panic" {
+			panic("boom")
+		}
+		return Permanent(errors.New("no such account"))
+	})
+
+	// permanent errors, payloads that don't decode and unknown types skip the retries
+	if _, err := greet.Enqueue(ctx, q, greeting{Name: "john"}); err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+	if _, err := q.Enqueue(ctx, greet.Queue, greet.Name, "not a greeting"); err != nil {
+		t.Fatalf("enqueue bad payload: %v", err)
+	}
+	if _, err := q.Enqueue(ctx, greet.Queue, "unknown", greeting{}); err != nil {
+		t.Fatalf("enqueue unknown type: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		runOne(t, w, true)
+	}
+	if s := stats(t, q); s != (Stats{Dead: 3}) {
+		t.Fatalf("stats: %+v", s)
+	}
+
+	// panics are failures like any other
+	if _, err := greet.Enqueue(ctx, q, greeting{Name: "panic"}); err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+	runOne(t, w, true)
+	if s := stats(t, q); s != (Stats{Delayed: 1, Dead: 3}) {
+		t.Fatalf("stats after panic: %+v", s)
+	}
+}
+
+func TestExpiredLease(t *testing.T) {
+	ctx := context.Background()
+	q, now := newTestQueue(t)
+	if _, err := greet.Enqueue(ctx, q, greeting{Name: "john"}, MaxAttempts(2)); err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+
+	// a worker that claims a job then dies leaves it active until its lease expires
+	for attempt := 1; attempt <= 2; attempt++ {
+		job, err := q.claim(ctx, greet.Queue)
+		if err != nil || job == nil || job.Attempts != attempt {
+			t.Fatalf("claim %d: got %+v, %v", attempt, job, err)
+		}
+		if job, _ := q.claim(ctx, greet.Queue); job != nil {
+			t.Fatalf("claimed a leased job")
+		}
+		*now = now.Add(q.cfg.Lease)
+	}
+
+	// out of attempts, so it's dead lettered rather than run again
+	if job, err := q.claim(ctx, greet.Queue); job != nil || err != nil {
+		t.Fatalf("claim after last attempt: got %+v, %v", job, err)
+	}
+	if s := stats(t, q); s != (Stats{Dead: 1}) {
+		t.Fatalf("stats: %+v", s)
+	}
+}
+
+func TestWorkerDrainsOnShutdown(t *testing.T) {
+	ctx := context.Background()
+	q, _ := newTestQueue(t)
+	q.now = func() time.Time { return time.Now().UTC() }
+	q.cfg.Concurrency = map[string]int{greet.Queue: 2}
+
+	w := q.NewWorker()
+	var running atomic.Int32
+	started := make(chan struct{}, 2)
+	release := make(chan struct{})
+	greet.Handle(w, func(ctx context.Context, payload greeting) error {
+		running.Add(1)
+		started <- struct{}{}
+		<-release
+		return nil
+	})
+	for _, name := range []string{"john", "jane"} {
+		if _, err := greet.Enqueue(ctx, q, greeting{Name: name}); err != nil {
+			t.Fatalf("enqueue: %v", err)
+		}
+	}
+
+	w.Start()
+	// both run at once with a concurrency of 2
+	for i := 0; i < 2; i++ {
+		select {
+		case <-started:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("only %d jobs started", running.Load())
+		}
+	}
+
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- w.Shutdown(ctx) }()
+	select {
+	case err := <-shutdown:
+		t.Fatalf("shutdown returned %v before the jobs finished", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	if err := <-shutdown; err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+	if s := stats(t, q); s != (Stats{}) {
+		t.Fatalf("stats after drain: %+v", s)
+	}
+
+	// jobs still running when the deadline passes are cancelled and retried
+	w = q.NewWorker()
+	greet.Handle(w, func(ctx context.Context, payload greeting) error {
+		started <- struct{}{}
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if _, err := greet.Enqueue(ctx, q, greeting{Name: "john"}); err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+	w.Start()
+	<-started
+	deadline, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if err := w.Shutdown(deadline); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("shutdown past the deadline: got %v", err)
+	}
+	if s := stats(t, q); s != (Stats{Delayed: 1}) {
+		t.Fatalf("stats after cancelled job: %+v", s)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	q, _ := newTestQueue(t)
+	q.cfg.Backoff, q.cfg.MaxBackoff = time.Second, 10*time.Second
+	for attempts, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 4: 8 * time.Second, 5: 10 * time.Second, 60: 10 * time.Second} {
+		if got := q.backoff(&Job{Attempts: attempts}); got != want {
+			t.Errorf("backoff after %d attempts: got %v, want %v", attempts, got, want)
+		}
+	}
+}
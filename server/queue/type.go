@@ -0,0 +1,62 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Handler runs a job, an error fails the attempt
+type Handler func(ctx context.Context, job *Job) error
+
+// Type is a kind of job with a payload of type T, declared once and
+// used both to enqueue jobs and to handle them so the two can't disagree
+type Type[T any] struct {
+	Queue string
+	Name  string
+}
+
+// NewType declares a job type run on queue, DefaultQueue if empty
+func NewType[T any](queue string, name string) Type[T] {
+	if queue == "" {
+		queue = DefaultQueue
+	}
+	return Type[T]{Queue: queue, Name: name}
+}
+
+// Enqueue adds a job of this type with payload to q
+func (t Type[T]) Enqueue(ctx context.Context, q *Queue, payload T, opts ...Option) (*Job, error) {
+	return q.Enqueue(ctx, t.Queue, t.Name, payload, opts...)
+}
+
+// Handle registers fn to run jobs of this type on w. A payload that
+// doesn't decode is dead lettered rather than retried
+func (t Type[T]) Handle(w *Worker, fn func(ctx context.Context, payload T) error) {
+	w.Handle(t.Queue, t.Name, func(ctx context.Context, job *Job) error {
+		var payload T
+		if err := json.Unmarshal(job.Payload, &payload); err != nil {
+			return Permanent(fmt.Errorf("decoding %s payload: %w", t.Name, err))
+		}
+		return fn(ctx, payload)
+	})
+}
+
+// permanentError marks an error retrying won't fix
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps err so the job is dead lettered straight away instead of retried
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports whether err was wrapped by Permanent
+func IsPermanent(err error) bool {
+	var permanent *permanentError
+	return errors.As(err, &permanent)
+}
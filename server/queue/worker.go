@@ -0,0 +1,216 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Cprime50/Gopay/helper"
+	"github.com/Cprime50/Gopay/metrics"
+)
+
+// Job outcomes, as recorded in metrics
+const (
+	outcomeCompleted = "completed"
+	outcomeRetried   = "retried"
+	outcomeDead      = "dead"
+)
+
+// Worker runs the jobs of the queues it has handlers for, each with
+// the configured number of concurrent workers
+type Worker struct {
+	queue    *Queue
+	handlers map[string]map[string]Handler
+
+	mu       sync.Mutex
+	started  bool
+	stop     chan struct{}
+	wg       sync.WaitGroup
+	jobsCtx  context.Context
+	stopJobs context.CancelFunc
+}
+
+// NewWorker returns a Worker running jobs from q, register handlers then Start it
+func (q *Queue) NewWorker() *Worker {
+	return &Worker{
+		queue:    q,
+		handlers: make(map[string]map[string]Handler),
+		stop:     make(chan struct{}),
+	}
+}
+
+// Handle registers h to run jobs of jobType on queue. Prefer Type.Handle
+func (w *Worker) Handle(queue string, jobType string, h Handler) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.started {
+		panic("queue: handler registered after the worker started")
+	}
+	if w.handlers[queue] == nil {
+		w.handlers[queue] = make(map[string]Handler)
+	}
+	w.handlers[queue][jobType] = h
+}
+
+// Queues lists the queues the worker has handlers for
+func (w *Worker) Queues() []string {
+	queues := make([]string, 0, len(w.handlers))
+	for queue := range w.handlers {
+		queues = append(queues, queue)
+	}
+	sort.Strings(queues)
+	return queues
+}
+
+// Start runs the workers in the background until Shutdown
+func (w *Worker) Start() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.started {
+		return
+	}
+	w.started = true
+	// jobs get a context of their own so stopping to claim doesn't cancel them
+	w.jobsCtx, w.stopJobs = context.WithCancel(context.Background())
+
+	for _, queue := range w.Queues() {
+		concurrency := w.queue.cfg.Concurrency[queue]
+		if concurrency <= 0 {
+			concurrency = 1
+		}
+		helper.Logger(w.jobsCtx).Info("job workers started", "queue", queue, "concurrency", concurrency)
+		for i := 0; i < concurrency; i++ {
+			w.wg.Add(1)
+			go w.loop(queue)
+		}
+	}
+}
+
+// Shutdown stops claiming jobs and waits for those running to finish.
+// If ctx is done first they're cancelled, so fail and are retried
+// later, and ctx's error is returned
+func (w *Worker) Shutdown(ctx context.Context) error {
+	w.mu.Lock()
+	if !w.started {
+		w.mu.Unlock()
+		return nil
+	}
+	select {
+	case <-w.stop:
+	default:
+		close(w.stop)
+	}
+	w.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		w.stopJobs()
+		return nil
+	case <-ctx.Done():
+		w.stopJobs()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// loop claims and runs jobs from queue until the worker is stopped
+func (w *Worker) loop(queue string) {
+	defer w.wg.Done()
+	for {
+		select {
+		case <-w.stop:
+			return
+		default:
+		}
+
+		job, err := w.queue.claim(w.jobsCtx, queue)
+		if err != nil {
+			helper.Logger(w.jobsCtx).Error("error claiming job", "queue", queue, "error", err)
+		}
+		if job == nil {
+			select {
+			case <-w.stop:
+				return
+			case <-time.After(w.queue.cfg.PollInterval):
+			}
+			continue
+		}
+		w.run(w.jobsCtx, job)
+	}
+}
+
+// RunOne claims and runs one job from queue, reporting whether there was one.
+// It lets tests and tools drive the worker without starting it
+func (w *Worker) RunOne(ctx context.Context, queue string) (bool, error) {
+	job, err := w.queue.claim(ctx, queue)
+	if err != nil || job == nil {
+		return false, err
+	}
+	w.run(ctx, job)
+	return true, nil
+}
+
+// run runs job and records the outcome, retrying or dead lettering it on failure
+func (w *Worker) run(base context.Context, job *Job) {
+	logger := helper.Logger(base).With("job_id", job.ID, "queue", job.Queue, "type", job.Type, "attempt", job.Attempts)
+	ctx, cancel := context.WithTimeout(helper.ContextWithLogger(base, logger), w.queue.cfg.Lease)
+	defer cancel()
+	// the outcome is saved even if the job was cancelled by a shutdown
+	saveCtx := context.WithoutCancel(ctx)
+
+	start := time.Now()
+	err := w.handle(ctx, job)
+	outcome := outcomeCompleted
+	switch {
+	case err == nil:
+		if err := w.queue.complete(saveCtx, job); err != nil {
+			logger.Error("error completing job", "error", err)
+		}
+	case !IsPermanent(err) && job.Attempts < job.MaxAttempts:
+		outcome = outcomeRetried
+		job.LastError = truncate(err.Error(), 1000)
+		retryAt := w.queue.now().Add(w.queue.backoff(job))
+		logger.Warn("job failed, will retry", "retry_at", retryAt, "error", err)
+		if err := w.queue.retry(saveCtx, job, retryAt); err != nil {
+			logger.Error("error scheduling job retry", "error", err)
+		}
+	default:
+		outcome = outcomeDead
+		job.LastError = truncate(err.Error(), 1000)
+		logger.Error("job failed, moved to the dead letter queue", "error", err)
+		if err := w.queue.kill(saveCtx, job); err != nil {
+			logger.Error("error dead lettering job", "error", err)
+		}
+	}
+	metrics.ObserveJob(job.Queue, job.Type, outcome, time.Since(start))
+}
+
+// handle runs job's handler, turning panics into errors
+func (w *Worker) handle(ctx context.Context, job *Job) (err error) {
+	h, ok := w.handlers[job.Queue][job.Type]
+	if !ok {
+		return Permanent(errors.New("no handler for job type " + job.Type))
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+	return h(ctx, job)
+}
+
+// truncate cuts s to at most n bytes
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
@@ -0,0 +1,263 @@
+// Package realtime pushes live updates to the clients an account has
+// connected. Each update is added to a short redis stream per account,
+// its history, so a client that reconnects resumes after the last update
+// it saw. Publishing also sends the account ID on a pub/sub channel,
+// which wakes the account's streams on every instance to read the new
+// updates from its history.
+//
+// Pub/sub is only a wake up call: a message lost while an instance
+// reconnects to redis delays updates until the stream's next heartbeat,
+// when its history is read again anyway
+package realtime
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Cprime50/Gopay/config"
+	"github.com/Cprime50/Gopay/helper"
+	"github.com/Cprime50/Gopay/metrics"
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+// Start is the position before an account's first update
+const Start = "0-0"
+
+var (
+	// ErrTooManyStreams is returned by Subscribe when the account already
+	// has MaxStreams streams open on this instance
+	ErrTooManyStreams = errors.New("realtime: too many streams")
+	// ErrClosed is returned by Subscribe once the hub is closed
+	ErrClosed = errors.New("realtime: hub closed")
+)
+
+// Update is a change pushed to an account's clients. IDs are redis
+// stream IDs, increasing with every update of the account
+type Update struct {
+	ID   string
+	Type string
+	Data json.RawMessage
+}
+
+// Hub publishes updates and wakes the streams open on this instance
+type Hub struct {
+	redis *redis.Client
+	cfg   config.Realtime
+
+	mu      sync.Mutex
+	streams map[uuid.UUID]map[*Subscription]struct{}
+	// closed is closed by Close, ending every stream
+	closed chan struct{}
+}
+
+// NewHub returns a Hub, Run must be running for its streams to be woken
+func NewHub(rdb *redis.Client, cfg config.Realtime) *Hub {
+	return &Hub{redis: rdb, cfg: cfg, streams: make(map[uuid.UUID]map[*Subscription]struct{}), closed: make(chan struct{})}
+}
+
+// Close ends the streams open on this instance, the server waits for
+// them before shutting down. Their clients reconnect to another instance
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	select {
+	case <-h.closed:
+	default:
+		close(h.closed)
+	}
+}
+
+// historyKey is the redis stream of the account's updates
+func historyKey(accountID uuid.UUID) string {
+	return "realtime:history:" + accountID.String()
+}
+
+// Publish adds an update of data as JSON to the account's history and
+// wakes its streams, returning the update's ID
+func (h *Hub) Publish(ctx context.Context, accountID uuid.UUID, updateType string, data any) (string, error) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return "", fmt.Errorf("realtime: encoding %s update: %w", updateType, err)
+	}
+	key := historyKey(accountID)
+	var add *redis.StringCmd
+	_, err = h.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		add = pipe.XAdd(ctx, &redis.XAddArgs{
+			Stream: key,
+			MaxLen: h.cfg.History,
+			Approx: true,
+			Values: map[string]interface{}{"type": updateType, "data": string(payload)},
+		})
+		pipe.Expire(ctx, key, h.cfg.HistoryTTL)
+		pipe.Publish(ctx, h.cfg.Channel, accountID.String())
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return add.Val(), nil
+}
+
+// Run wakes the streams of the accounts published to until ctx is done
+func (h *Hub) Run(ctx context.Context) {
+	pubsub := h.redis.Subscribe(ctx, h.cfg.Channel)
+	defer pubsub.Close()
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+			accountID, err := uuid.Parse(msg.Payload)
+			if err != nil {
+				helper.Logger(ctx).Warn("ignoring realtime message", "payload", msg.Payload)
+				continue
+			}
+			h.wake(accountID)
+		}
+	}
+}
+
+func (h *Hub) wake(accountID uuid.UUID) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for s := range h.streams[accountID] {
+		select {
+		case s.wake <- struct{}{}:
+		default:
+			// already woken, it reads every update when it gets to it
+		}
+	}
+}
+
+// Subscription is a stream of an account's updates open on this instance
+type Subscription struct {
+	hub       *Hub
+	accountID uuid.UUID
+	wake      chan struct{}
+}
+
+// Subscribe opens a stream of the account's updates, Close it when done.
+// Subscribe before reading the history so no update is missed in between
+func (h *Hub) Subscribe(accountID uuid.UUID) (*Subscription, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	select {
+	case <-h.closed:
+		return nil, ErrClosed
+	default:
+	}
+	if len(h.streams[accountID]) >= h.cfg.MaxStreams {
+		return nil, ErrTooManyStreams
+	}
+	s := &Subscription{hub: h, accountID: accountID, wake: make(chan struct{}, 1)}
+	if h.streams[accountID] == nil {
+		h.streams[accountID] = make(map[*Subscription]struct{})
+	}
+	h.streams[accountID][s] = struct{}{}
+	metrics.Streams.Inc()
+	return s, nil
+}
+
+// Wake receives when the account has new updates
+func (s *Subscription) Wake() <-chan struct{} {
+	return s.wake
+}
+
+// Done is closed when the hub is, the stream should end
+func (s *Subscription) Done() <-chan struct{} {
+	return s.hub.closed
+}
+
+func (s *Subscription) Close() {
+	h := s.hub
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.streams[s.accountID][s]; !ok {
+		return
+	}
+	delete(h.streams[s.accountID], s)
+	if len(h.streams[s.accountID]) == 0 {
+		delete(h.streams, s.accountID)
+	}
+	metrics.Streams.Dec()
+}
+
+// Latest returns the ID of the account's newest update, Start if it has none
+func (h *Hub) Latest(ctx context.Context, accountID uuid.UUID) (string, error) {
+	entries, err := h.redis.XRevRangeN(ctx, historyKey(accountID), "+", "-", 1).Result()
+	if err != nil {
+		return "", err
+	}
+	if len(entries) == 0 {
+		return Start, nil
+	}
+	return entries[0].ID, nil
+}
+
+// Resumable reports whether every update after id is still in the
+// account's history, so a client that saw id can resume without a gap
+func (h *Hub) Resumable(ctx context.Context, accountID uuid.UUID, id string) (bool, error) {
+	key := historyKey(accountID)
+	if id == Start {
+		// the history is only trimmed once it grows past History
+		n, err := h.redis.XLen(ctx, key).Result()
+		return n < h.cfg.History, err
+	}
+	entries, err := h.redis.XRangeN(ctx, key, id, id, 1).Result()
+	if err != nil {
+		return false, err
+	}
+	return len(entries) == 1, nil
+}
+
+// After returns up to count of the account's updates after id, oldest first
+func (h *Hub) After(ctx context.Context, accountID uuid.UUID, id string, count int64) ([]Update, error) {
+	start, err := nextID(id)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := h.redis.XRangeN(ctx, historyKey(accountID), start, "+", count).Result()
+	if err != nil {
+		return nil, err
+	}
+	updates := make([]Update, 0, len(entries))
+	for _, e := range entries {
+		updateType, _ := e.Values["type"].(string)
+		data, _ := e.Values["data"].(string)
+		updates = append(updates, Update{ID: e.ID, Type: updateType, Data: json.RawMessage(data)})
+	}
+	return updates, nil
+}
+
+var idPattern = regexp.MustCompile(`^[0-9]{1,20}-[0-9]{1,20}$`)
+
+// ValidID reports whether id is an update ID, eg the Last-Event-ID of a reconnecting client
+func ValidID(id string) bool {
+	return idPattern.MatchString(id)
+}
+
+// nextID is the smallest stream ID after id, XRANGE's exclusive start
+// needs redis 6.2
+func nextID(id string) (string, error) {
+	ms, seq, ok := strings.Cut(id, "-")
+	if !ok || !ValidID(id) {
+		return "", fmt.Errorf("realtime: invalid update id %q", id)
+	}
+	n, err := strconv.ParseUint(seq, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("realtime: invalid update id %q", id)
+	}
+	return ms + "-" + strconv.FormatUint(n+1, 10), nil
+}
@@ -0,0 +1,161 @@
+package realtime
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Cprime50/Gopay/config"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+func newHub(t *testing.T, cfg config.Realtime) *Hub {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	return NewHub(rdb, cfg)
+}
+
+func TestHistory(t *testing.T) {
+	ctx := context.Background()
+	cfg := config.Default().Realtime
+	cfg.History = 5
+	hub := newHub(t, cfg)
+	accountID := uuid.New()
+
+	latest, err := hub.Latest(ctx, accountID)
+	if err != nil || latest != Start {
+		t.Fatalf("latest of no updates: got %q, %v", latest, err)
+	}
+	if ok, err := hub.Resumable(ctx, accountID, Start); err != nil || !ok {
+		t.Fatalf("resume from the start: got %v, %v", ok, err)
+	}
+
+	var ids []string
+	for i := 0; i < 3; i++ {
+		id, err := hub.Publish(ctx, accountID, "balance", map[string]int{"balance": i})
+		if err != nil {
+			t.Fatalf("publish %d: %v", i, err)
+		}
+		ids = append(ids, id)
+	}
+	// another account's updates are kept apart
+	if _, err := hub.Publish(ctx, uuid.New(), "balance", map[string]int{"balance": 9}); err != nil {
+		t.Fatalf("publish other: %v", err)
+	}
+
+	if latest, _ := hub.Latest(ctx, accountID); latest != ids[2] {
+		t.Fatalf("latest: got %q, want %q", latest, ids[2])
+	}
+	updates, err := hub.After(ctx, accountID, ids[0], 10)
+	if err != nil || len(updates) != 2 || updates[0].ID != ids[1] || updates[1].ID != ids[2] {
+		t.Fatalf("after the first: got %+v, %v", updates, err)
+	}
+	if updates[1].Type != "balance" || string(updates[1].Data) != `{"balance":2}` {
+		t.Fatalf("got update %+v", updates[1])
+	}
+	if updates, _ := hub.After(ctx, accountID, Start, 2); len(updates) != 2 || updates[0].ID != ids[0] {
+		t.Fatalf("first two: got %+v", updates)
+	}
+	if ok, _ := hub.Resumable(ctx, accountID, ids[1]); !ok {
+		t.Fatal("a kept update isn't resumable")
+	}
+	if ok, _ := hub.Resumable(ctx, accountID, "1-0"); ok {
+		t.Fatal("an unknown update is resumable")
+	}
+
+	// once trimmed, the start can't be resumed from
+	for i := 0; i < 10; i++ {
+		if _, err := hub.Publish(ctx, accountID, "balance", map[string]int{"balance": i}); err != nil {
+			t.Fatalf("publish: %v", err)
+		}
+	}
+	if ok, _ := hub.Resumable(ctx, accountID, Start); ok {
+		t.Fatal("a trimmed history is resumable from the start")
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cfg := config.Default().Realtime
+	cfg.MaxStreams = 2
+	hub := newHub(t, cfg)
+	go hub.Run(ctx)
+	accountID := uuid.New()
+
+	first, err := hub.Subscribe(accountID)
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	second, _ := hub.Subscribe(accountID)
+	if _, err := hub.Subscribe(accountID); !errors.Is(err, ErrTooManyStreams) {
+		t.Fatalf("third stream: got %v", err)
+	}
+	other, _ := hub.Subscribe(uuid.New())
+
+	// Run may not have subscribed yet, publish until the wake up arrives
+	deadline := time.After(5 * time.Second)
+	for woken := false; !woken; {
+		if _, err := hub.Publish(ctx, accountID, "balance", nil); err != nil {
+			t.Fatalf("publish: %v", err)
+		}
+		select {
+		case <-first.Wake():
+			woken = true
+		case <-time.After(10 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("not woken")
+		}
+	}
+	select {
+	case <-second.Wake():
+	case <-time.After(time.Second):
+		t.Fatal("second stream not woken")
+	}
+	select {
+	case <-other.Wake():
+		t.Fatal("another account's stream was woken")
+	default:
+	}
+
+	second.Close()
+	second.Close()
+	if _, err := hub.Subscribe(accountID); err != nil {
+		t.Fatalf("subscribe after close: %v", err)
+	}
+
+	hub.Close()
+	select {
+	case <-first.Done():
+	default:
+		t.Fatal("stream not done once the hub closed")
+	}
+	if _, err := hub.Subscribe(uuid.New()); !errors.Is(err, ErrClosed) {
+		t.Fatalf("subscribe to a closed hub: got %v", err)
+	}
+}
+
+func TestValidID(t *testing.T) {
+	for id, want := range map[string]bool{
+		"1526919030474-0":  true,
+		Start:              true,
+		"1526919030474":    false,
+		"1526919030474-":   false,
+		"abc-0":            false,
+		"1-0\nevent: fake": false,
+		"":                 false,
+	} {
+		if got := ValidID(id); got != want {
+			t.Errorf("ValidID(%q) = %v, want %v", id, got, want)
+		}
+	}
+	if next, err := nextID("1526919030474-" + strconv.Itoa(41)); err != nil || next != "1526919030474-42" {
+		t.Fatalf("next id: got %q, %v", next, err)
+	}
+}
@@ -0,0 +1,100 @@
+package seed
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+
+	"github.com/Cprime50/Gopay/config"
+	models "github.com/Cprime50/Gopay/models/account"
+	"github.com/Cprime50/Gopay/service"
+	"gorm.io/gorm"
+)
+
+// bootstrapActor is recorded in the audit log for the bootstrap admin
+const bootstrapActor = "seed:bootstrap"
+
+// BootstrapAdmin creates the configured admin account if there is no admin
+// yet, so it only ever happens once per database. The account has to change
+// its password on first login. When the config has no password one is
+// generated and returned, as it's the only chance to see it; otherwise, or
+// when nothing was created, password is empty. account is nil if skipped
+func BootstrapAdmin(ctx context.Context, db *gorm.DB, admin config.Admin) (account *models.Account, password string, err error) {
+	err = db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var admins int64
+		if err := tx.Model(&models.Account{}).Where("role_id = ?", models.AdminRoleID).Count(&admins).Error; err != nil {
+			return err
+		}
+		if admins > 0 {
+			return nil
+		}
+		if admin.Email == "" {
+			slog.Warn("there is no admin account and ADMIN_EMAIL is not set to bootstrap one")
+			return nil
+		}
+
+		var existing int64
+		if err := tx.Model(&models.Account{}).Where("email = ?", admin.Email).Count(&existing).Error; err != nil {
+			return err
+		}
+		if existing > 0 {
+			return fmt.Errorf("ADMIN_EMAIL %s belongs to an account that isn't an admin, promote it with `gopay accounts assign-role` instead", admin.Email)
+		}
+
+		plain := admin.Password
+		if plain == "" {
+			generated, err := generatePassword()
+			if err != nil {
+				return err
+			}
+			plain, password = generated, generated
+		}
+		hashedPassword, err := models.HashPassword(ctx, plain)
+		if err != nil {
+			return err
+		}
+		accountNumber, err := models.GenerateAccountNumber()
+		if err != nil {
+			return err
+		}
+
+		account = &models.Account{
+			Email:              admin.Email,
+			FirstName:          admin.FirstName,
+			LastName:           admin.LastName,
+			Password:           hashedPassword,
+			AccountNumber:      accountNumber,
+			RoleID:             models.AdminRoleID,
+			IsActive:           true,
+			MustChangePassword: true,
+		}
+		if err := tx.Create(account).Error; err != nil {
+			return err
+		}
+		return models.NewAuditRepository(tx).Record(ctx, &models.AuditRecord{
+			Actor:      bootstrapActor,
+			Action:     service.ActionAccountCreate,
+			TargetType: service.TargetAccount,
+			TargetID:   account.ID.String(),
+			Details:    `{"bootstrap_admin":true}`,
+		})
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("bootstrapping admin: %w", err)
+	}
+	if account == nil {
+		password = ""
+	}
+	return account, password, nil
+}
+
+// generatePassword returns a random password for the bootstrap admin
+func generatePassword() (string, error) {
+	bytes := make([]byte, 12)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", fmt.Errorf("generating password: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(bytes), nil
+}
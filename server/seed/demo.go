@@ -0,0 +1,110 @@
+package seed
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	models "github.com/Cprime50/Gopay/models/account"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DemoSet is the name of the demo data seed set
+const DemoSet = "demo"
+
+// DemoPassword is the password of every demo account
+const DemoPassword = "password123"
+
+// demoActor is recorded on the demo ledger entries
+const demoActor = "seed:demo"
+
+type demoEntry struct {
+	daysAgo int
+	kind    string
+	amount  float64
+	reason  string
+}
+
+type demoAccount struct {
+	email     string
+	firstName string
+	lastName  string
+	history   []demoEntry
+}
+
+var demoAccounts = []demoAccount{
+	{"john@demo.gopay.dev", "John", "Doe", []demoEntry{
+		{30, models.Credit, 2500, "salary"},
+		{27, models.Debit, 850, "rent"},
+		{20, models.Debit, 64.9, "groceries"},
+		{12, models.Credit, 120, "refund"},
+		{3, models.Debit, 42.5, "utilities"},
+	}},
+	{"jane@demo.gopay.dev", "Jane", "Smith", []demoEntry{
+		{25, models.Credit, 4200, "salary"},
+		{18, models.Debit, 1300, "rent"},
+		{6, models.Debit, 210.75, "travel"},
+	}},
+	{"sam@demo.gopay.dev", "Sam", "Lee", nil},
+}
+
+func init() {
+	register(Set{
+		Name:        DemoSet,
+		Description: fmt.Sprintf("demo accounts with a month of ledger history, password %s", DemoPassword),
+		run:         seedDemo,
+	})
+}
+
+// seedDemo creates the demo accounts that don't exist yet along with their
+// history, existing ones are left as they are so balances aren't replayed
+func seedDemo(ctx context.Context, tx *gorm.DB) error {
+	hashedPassword, err := models.HashPassword(ctx, DemoPassword)
+	if err != nil {
+		return err
+	}
+	ledger := models.NewLedgerRepository(tx)
+	now := time.Now()
+
+	for _, demo := range demoAccounts {
+		accountNumber, err := models.GenerateAccountNumber()
+		if err != nil {
+			return err
+		}
+		account := &models.Account{
+			Email:         demo.email,
+			FirstName:     demo.firstName,
+			LastName:      demo.lastName,
+			Password:      hashedPassword,
+			AccountNumber: accountNumber,
+			RoleID:        models.UserRoleID,
+			IsActive:      true,
+		}
+		result := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "email"}},
+			DoNothing: true,
+		}).Create(account)
+		if err := result.Error; err != nil {
+			return err
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+
+		for _, e := range demo.history {
+			entry := &models.LedgerEntry{
+				CreatedAt: now.AddDate(0, 0, -e.daysAgo),
+				AccountID: account.ID,
+				Type:      e.kind,
+				Amount:    e.amount,
+				Reason:    e.reason,
+				Actor:     demoActor,
+			}
+			if err := ledger.Apply(ctx, entry); err != nil {
+				return fmt.Errorf("demo history for %s: %w", demo.email, err)
+			}
+		}
+	}
+	return nil
+}
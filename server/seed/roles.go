@@ -0,0 +1,37 @@
+package seed
+
+import (
+	"context"
+
+	models "github.com/Cprime50/Gopay/models/account"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RolesSet is the name of the roles seed set
+const RolesSet = "roles"
+
+// Roles every install needs, the IDs are referred to in code
+var roles = []models.Role{
+	{ID: models.AdminRoleID, Name: "admin", Description: "Administrator role"},
+	{ID: models.UserRoleID, Name: "user", Description: "user role"},
+}
+
+func init() {
+	register(Set{
+		Name:        RolesSet,
+		Description: "the admin and user roles",
+		Production:  true,
+		run:         seedRoles,
+	})
+}
+
+// seedRoles upserts the roles, restoring their names and descriptions if changed
+func seedRoles(ctx context.Context, tx *gorm.DB) error {
+	rows := make([]models.Role, len(roles))
+	copy(rows, roles)
+	return tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"name", "description", "updated_at"}),
+	}).Create(&rows).Error
+}
@@ -0,0 +1,75 @@
+// Package seed fills the database with the data a fresh install needs.
+// Seeds are grouped in named sets, each safe to run any number of times:
+// rows are upserted and data that's already there is left alone
+package seed
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+
+	"gorm.io/gorm"
+)
+
+// Set is a named group of seed data
+type Set struct {
+	Name        string
+	Description string
+	// Production sets may be run against a production database
+	Production bool
+	run        func(ctx context.Context, tx *gorm.DB) error
+}
+
+var sets = map[string]Set{}
+
+func register(set Set) {
+	sets[set.Name] = set
+}
+
+// Sets returns every seed set sorted by name
+func Sets() []Set {
+	all := make([]Set, 0, len(sets))
+	for _, set := range sets {
+		all = append(all, set)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Name < all[j].Name })
+	return all
+}
+
+// ForEnv returns the names of the sets seeded by default in env,
+// production only gets the roles while development gets demo data too
+func ForEnv(env string) []string {
+	switch env {
+	case "development", "test":
+		return []string{RolesSet, DemoSet}
+	default:
+		return []string{RolesSet}
+	}
+}
+
+// Run seeds the named sets in order, each in its own transaction.
+// Sets not marked Production are refused when production is true
+func Run(ctx context.Context, db *gorm.DB, production bool, names ...string) error {
+	toRun := make([]Set, 0, len(names))
+	for _, name := range names {
+		set, ok := sets[name]
+		if !ok {
+			return fmt.Errorf("unknown seed set %q", name)
+		}
+		if production && !set.Production {
+			return fmt.Errorf("seed set %q can't be run in production", name)
+		}
+		toRun = append(toRun, set)
+	}
+
+	for _, set := range toRun {
+		if err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			return set.run(ctx, tx)
+		}); err != nil {
+			return fmt.Errorf("seeding %s: %w", set.Name, err)
+		}
+		slog.Info("seeded", "set", set.Name)
+	}
+	return nil
+}
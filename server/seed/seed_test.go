@@ -0,0 +1,133 @@
+package seed
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Cprime50/Gopay/config"
+	"github.com/Cprime50/Gopay/db"
+	"github.com/Cprime50/Gopay/helper"
+	models "github.com/Cprime50/Gopay/models/account"
+	"gorm.io/gorm"
+)
+
+func openSQLite(t *testing.T) *gorm.DB {
+	t.Helper()
+	gormDB, err := db.OpenSQLite(":memory:")
+	if err != nil {
+		t.Fatalf("opening sqlite: %v", err)
+	}
+	if err := gormDB.AutoMigrate(&models.Role{}, &models.Account{}, &models.LedgerEntry{}, &models.AuditRecord{}, &models.OutboxEvent{}); err != nil {
+		t.Fatalf("migrating sqlite: %v", err)
+	}
+	return gormDB
+}
+
+func count(t *testing.T, gormDB *gorm.DB, model any) int64 {
+	t.Helper()
+	var n int64
+	if err := gormDB.Model(model).Count(&n).Error; err != nil {
+		t.Fatalf("counting: %v", err)
+	}
+	return n
+}
+
+func TestRunIsIdempotent(t *testing.T) {
+	ctx := context.Background()
+	gormDB := openSQLite(t)
+
+	for i := 0; i < 2; i++ {
+		if err := Run(ctx, gormDB, false, ForEnv("development")...); err != nil {
+			t.Fatalf("run %d: %v", i, err)
+		}
+	}
+
+	if n := count(t, gormDB, &models.Role{}); n != 2 {
+		t.Errorf("got %d roles, want 2", n)
+	}
+	if n := count(t, gormDB, &models.Account{}); n != int64(len(demoAccounts)) {
+		t.Errorf("got %d accounts, want %d", n, len(demoAccounts))
+	}
+	entries := 0
+	for _, demo := range demoAccounts {
+		entries += len(demo.history)
+	}
+	if n := count(t, gormDB, &models.LedgerEntry{}); n != int64(entries) {
+		t.Errorf("got %d ledger entries, want %d", n, entries)
+	}
+
+	account, err := models.NewAccountRepository(gormDB).GetByEmail(ctx, "john@demo.gopay.dev")
+	if err != nil {
+		t.Fatalf("getting demo account: %v", err)
+	}
+	if account.Balance != 1662.6 {
+		t.Errorf("got balance %v, want the history replayed once, 1662.6", account.Balance)
+	}
+	if match, _ := helper.ComparePassword(ctx, account.Password, DemoPassword); !match {
+		t.Error("demo password doesn't match")
+	}
+}
+
+func TestRunRefusesDemoDataInProduction(t *testing.T) {
+	gormDB := openSQLite(t)
+	if err := Run(context.Background(), gormDB, true, ForEnv("production")...); err != nil {
+		t.Fatalf("production sets: %v", err)
+	}
+	if err := Run(context.Background(), gormDB, true, DemoSet); err == nil {
+		t.Fatal("demo data seeded in production")
+	}
+	if err := Run(context.Background(), gormDB, false, "nope"); err == nil {
+		t.Fatal("expected an error for an unknown set")
+	}
+}
+
+func TestBootstrapAdmin(t *testing.T) {
+	ctx := context.Background()
+	gormDB := openSQLite(t)
+	if err := Run(ctx, gormDB, false, RolesSet); err != nil {
+		t.Fatalf("seeding roles: %v", err)
+	}
+
+	if account, _, err := BootstrapAdmin(ctx, gormDB, config.Admin{}); err != nil || account != nil {
+		t.Fatalf("without an email: got %v, %v, want it skipped", account, err)
+	}
+
+	cfg := config.Admin{Email: "admin@mail.com", FirstName: "Gopay", LastName: "Admin"}
+	account, password, err := BootstrapAdmin(ctx, gormDB, cfg)
+	if err != nil || account == nil {
+		t.Fatalf("bootstrap: got %v, %v", account, err)
+	}
+	if password == "" {
+		t.Fatal("expected a generated password")
+	}
+	stored, err := models.NewAccountRepository(gormDB).GetByEmail(ctx, "admin@mail.com")
+	if err != nil {
+		t.Fatalf("getting admin: %v", err)
+	}
+	if !stored.MustChangePassword || stored.RoleID != models.AdminRoleID || !stored.IsActive {
+		t.Fatalf("unexpected admin %+v", stored)
+	}
+	if match, _ := helper.ComparePassword(ctx, stored.Password, password); !match {
+		t.Fatal("generated password doesn't match")
+	}
+	if n := count(t, gormDB, &models.AuditRecord{}); n != 1 {
+		t.Errorf("got %d audit records, want 1", n)
+	}
+
+	// there's an admin now so nothing happens, even with other settings
+	cfg.Email, cfg.Password = "other@mail.com", "password123"
+	if account, password, err := BootstrapAdmin(ctx, gormDB, cfg); err != nil || account != nil || password != "" {
+		t.Fatalf("second bootstrap: got %v, %q, %v", account, password, err)
+	}
+}
+
+func TestBootstrapAdminEmailTaken(t *testing.T) {
+	ctx := context.Background()
+	gormDB := openSQLite(t)
+	if err := Run(ctx, gormDB, false, RolesSet, DemoSet); err != nil {
+		t.Fatalf("seeding: %v", err)
+	}
+	if _, _, err := BootstrapAdmin(ctx, gormDB, config.Admin{Email: "john@demo.gopay.dev"}); err == nil {
+		t.Fatal("expected an error bootstrapping an existing user as admin")
+	}
+}
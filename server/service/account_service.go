@@ -0,0 +1,231 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/Cprime50/Gopay/helper"
+	"github.com/Cprime50/Gopay/i18n"
+	models "github.com/Cprime50/Gopay/models/account"
+	"github.com/google/uuid"
+)
+
+// maxAccountNumberAttempts bounds the retries when a generated
+// account number collides with an existing one
+const maxAccountNumberAttempts = 10
+
+// signupBalance is the balance new accounts are opened with
+const signupBalance = 500
+
+// AccountService holds the account business logic
+type AccountService struct {
+	accounts models.AccountRepository
+	roles    models.RoleRepository
+	images   models.ImageRepository
+}
+
+// NewAccountService returns an AccountService using the given repositories
+func NewAccountService(accounts models.AccountRepository, roles models.RoleRepository, images models.ImageRepository) *AccountService {
+	return &AccountService{
+		accounts: accounts,
+		roles:    roles,
+		images:   images,
+	}
+}
+
+// Signup creates a new account from the provided details and plain password.
+// On success account is populated with the stored account, including its ID
+func (s *AccountService) Signup(ctx context.Context, account *models.Account) error {
+	// Check if an account with the given email already exists
+	_, err := s.accounts.GetByEmail(ctx, account.Email)
+	switch {
+	case err == nil:
+		helper.Logger(ctx).Info("could not create account: account already exists", "email", account.Email)
+		return helper.NewConflict("email", account.Email).WithCode(helper.CodeEmailTaken)
+
+	case helper.Status(err) == http.StatusNotFound:
+		break
+
+	default:
+		return err
+	}
+
+	hashedPassword, err := models.HashPassword(ctx, account.Password)
+	if err != nil {
+		helper.Logger(ctx).Error("unable to hash password for account", "email", account.Email, "error", err)
+		return helper.NewInternal()
+	}
+
+	accountNumber, err := s.newAccountNumber(ctx)
+	if err != nil {
+		return err
+	}
+
+	// initialize account number
+	newAccount := &models.Account{
+		Email:         account.Email,
+		FirstName:     account.FirstName,
+		LastName:      account.LastName,
+		Password:      hashedPassword,
+		AccountNumber: accountNumber,
+		Balance:       signupBalance,
+		RoleID:        models.UserRoleID,
+		IsActive:      false,
+		Locale:        account.Locale,
+	}
+	if err := s.accounts.Create(ctx, newAccount); err != nil {
+		return err
+	}
+
+	*account = *newAccount
+	return nil
+}
+
+// Signin returns the account matching email if password is correct
+func (s *AccountService) Signin(ctx context.Context, email string, password string) (*models.Account, error) {
+	account, err := s.accounts.GetByEmail(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+
+	// verify password - check if matches
+	match, err := helper.ComparePassword(ctx, account.Password, password)
+	if err != nil {
+		helper.Logger(ctx).Error("error comparing password", "error", err)
+		return nil, helper.NewInternal()
+	}
+	if !match {
+		return nil, helper.NewAuthorization("Invalid email and password combination").WithCode(helper.CodeInvalidCredentials)
+	}
+	return account, nil
+}
+
+// Get returns the account with the given ID
+func (s *AccountService) Get(ctx context.Context, id uuid.UUID) (*models.Account, error) {
+	return s.accounts.GetByID(ctx, id)
+}
+
+// Lookup returns the masked name of the holder of accountNumber, so a
+// sender can check who they're paying without learning who they are
+func (s *AccountService) Lookup(ctx context.Context, accountNumber int64) (string, error) {
+	account, err := s.accounts.GetByAccountNum(ctx, accountNumber)
+	if err != nil {
+		return "", err
+	}
+	return maskHolderName(account.FirstName, account.LastName), nil
+}
+
+// maskHolderName keeps the first two letters of each word of a name, one of
+// shorter words, and stars the rest, eg John Doe is Jo** Do*
+func maskHolderName(firstName string, lastName string) string {
+	words := strings.Fields(firstName + " " + lastName)
+	for i, word := range words {
+		letters := []rune(word)
+		keep := min(2, len(letters)-1)
+		words[i] = string(letters[:keep]) + strings.Repeat("*", len(letters)-keep)
+	}
+	return strings.Join(words, " ")
+}
+
+// GetAll returns every account
+func (s *AccountService) GetAll(ctx context.Context) ([]*models.Account, error) {
+	return s.accounts.GetAll(ctx)
+}
+
+// AssignRole gives the account with accountID the role with roleID
+func (s *AccountService) AssignRole(ctx context.Context, accountID uuid.UUID, roleID uint) error {
+	if _, err := s.roles.GetByID(ctx, roleID); err != nil {
+		return err
+	}
+	return s.roles.Assign(ctx, accountID, roleID)
+}
+
+// ResetPassword hashes and saves a new password for the account with email
+func (s *AccountService) ResetPassword(ctx context.Context, email string, password string) error {
+	hashedPassword, err := models.HashPassword(ctx, password)
+	if err != nil {
+		helper.Logger(ctx).Error("error hashing password", "error", err)
+		return helper.NewInternal()
+	}
+	return s.accounts.UpdatePassword(ctx, email, hashedPassword)
+}
+
+// ChangePassword replaces the account's password after checking the current
+// one, which also lifts a forced password change
+func (s *AccountService) ChangePassword(ctx context.Context, id uuid.UUID, currentPassword string, newPassword string) (*models.Account, error) {
+	account, err := s.accounts.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	match, err := helper.ComparePassword(ctx, account.Password, currentPassword)
+	if err != nil {
+		helper.Logger(ctx).Error("error comparing password", "error", err)
+		return nil, helper.NewInternal()
+	}
+	if !match {
+		return nil, helper.NewAuthorization("Current password is incorrect").WithCode(helper.CodeInvalidCredentials)
+	}
+	if currentPassword == newPassword {
+		return nil, helper.NewBadRequest("the new password must be different from the current one")
+	}
+
+	if err := s.ResetPassword(ctx, account.Email, newPassword); err != nil {
+		return nil, err
+	}
+	return s.accounts.GetByID(ctx, id)
+}
+
+// SetLocale saves the language the account's emails and notifications are sent in
+func (s *AccountService) SetLocale(ctx context.Context, id uuid.UUID, locale string) (*models.Account, error) {
+	if !i18n.IsSupported(locale) {
+		return nil, helper.NewInvalidParam("locale", "oneof", "must be one of "+strings.Join(i18n.Supported, " "))
+	}
+	if err := s.accounts.Update(ctx, &models.Account{ID: id, Locale: locale}); err != nil {
+		return nil, err
+	}
+	return s.accounts.GetByID(ctx, id)
+}
+
+// UpdateImageByFile uploads an image file and saves its url to the account
+func (s *AccountService) UpdateImageByFile(ctx context.Context, id uuid.UUID, imgFile *models.File) error {
+	imageURL, err := s.images.FileUpload(ctx, imgFile)
+	if err != nil {
+		helper.Logger(ctx).Error("error uploading image by file", "error", err)
+		return helper.NewInternal()
+	}
+	return s.accounts.UpdateImage(ctx, id, imageURL)
+}
+
+// UpdateImageByUrl uploads a remote image and saves its url to the account
+func (s *AccountService) UpdateImageByUrl(ctx context.Context, id uuid.UUID, imgUrl *models.Url) error {
+	imageURL, err := s.images.RemoteUpload(ctx, imgUrl)
+	if err != nil {
+		helper.Logger(ctx).Error("error uploading image by url", "error", err)
+		return helper.NewInternal()
+	}
+	return s.accounts.UpdateImage(ctx, id, imageURL)
+}
+
+// newAccountNumber generates an account number not yet in use
+func (s *AccountService) newAccountNumber(ctx context.Context) (int64, error) {
+	for i := 0; i < maxAccountNumberAttempts; i++ {
+		accountNumber, err := models.GenerateAccountNumber()
+		if err != nil {
+			helper.Logger(ctx).Error("error generating account number", "error", err)
+			return 0, helper.NewInternal()
+		}
+
+		//check if account number is unique
+		_, err = s.accounts.GetByAccountNum(ctx, accountNumber)
+		switch {
+		case helper.Status(err) == http.StatusNotFound:
+			return accountNumber, nil
+		case err != nil:
+			return 0, err
+		}
+	}
+	helper.Logger(ctx).Error("could not generate a unique account number", "attempts", maxAccountNumberAttempts)
+	return 0, helper.NewInternal()
+}
@@ -0,0 +1,20 @@
+package service
+
+import "testing"
+
+func TestMaskHolderName(t *testing.T) {
+	for _, tc := range []struct {
+		first, last, want string
+	}{
+		{"John", "Doe", "Jo** Do*"},
+		{"Al", "Li", "A* L*"},
+		{"J", "Doe", "* Do*"},
+		{"Mary Ann", "Smith", "Ma** An* Sm***"},
+		{"Zoë", "Ødegård", "Zo* Ød*****"},
+		{" John ", "", "Jo**"},
+	} {
+		if got := maskHolderName(tc.first, tc.last); got != tc.want {
+			t.Errorf("maskHolderName(%q, %q) = %q, want %q", tc.first, tc.last, got, tc.want)
+		}
+	}
+}
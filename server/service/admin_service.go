@@ -0,0 +1,329 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Cprime50/Gopay/helper"
+	models "github.com/Cprime50/Gopay/models/account"
+	"github.com/google/uuid"
+)
+
+// Audit actions, recorded for every operation done through the AdminService
+const (
+	ActionAccountCreate     = "account.create"
+	ActionAccountActivate   = "account.activate"
+	ActionAccountDeactivate = "account.deactivate"
+	ActionPasswordReset     = "account.reset_password"
+	ActionRoleAssign        = "account.assign_role"
+	ActionSessionsRevoke    = "account.revoke_sessions"
+	ActionAccountCredit     = "account.credit"
+	ActionAccountDebit      = "account.debit"
+	ActionKeysRotate        = "keys.rotate"
+)
+
+// Audit target types
+const (
+	TargetAccount = "account"
+	TargetKeys    = "signing_keys"
+)
+
+// minPasswordLength matches the signup validation
+const minPasswordLength = 8
+
+var accountNumberPattern = regexp.MustCompile(`^[0-9]+$`)
+
+// AdminService holds the operations tasks, every change it makes
+// is recorded in the audit log along with who made it. The record is
+// written in the same transaction as the change, so neither is kept
+// without the other
+type AdminService struct {
+	accountService *AccountService
+	tokenService   *TokenService
+	accounts       models.AccountRepository
+	ledger         models.LedgerRepository
+	audit          models.AuditRepository
+	transactor     models.Transactor
+}
+
+// NewAdminService returns an AdminService built on the account and token
+// services, changes are made through the repositories of transactor
+func NewAdminService(accountService *AccountService, tokenService *TokenService, ledger models.LedgerRepository, audit models.AuditRepository, transactor models.Transactor) *AdminService {
+	return &AdminService{
+		accountService: accountService,
+		tokenService:   tokenService,
+		accounts:       accountService.accounts,
+		ledger:         ledger,
+		audit:          audit,
+		transactor:     transactor,
+	}
+}
+
+// Statement is an account's ledger entries for a period
+type Statement struct {
+	Account        *models.Account
+	From           time.Time
+	To             time.Time
+	Entries        []*models.LedgerEntry
+	OpeningBalance float64
+	ClosingBalance float64
+	TotalCredits   float64
+	TotalDebits    float64
+}
+
+// FindAccount looks an account up by ID, account number or email
+func (s *AdminService) FindAccount(ctx context.Context, ref string) (*models.Account, error) {
+	if id, err := uuid.Parse(ref); err == nil {
+		return s.accounts.GetByID(ctx, id)
+	}
+	if accountNumberPattern.MatchString(ref) {
+		accountNumber, err := strconv.ParseInt(ref, 10, 64)
+		if err != nil {
+			return nil, helper.NewBadRequest(fmt.Sprintf("invalid account number %s", ref))
+		}
+		return s.accounts.GetByAccountNum(ctx, accountNumber)
+	}
+	return s.accounts.GetByEmail(ctx, ref)
+}
+
+// FindRole looks a role up by ID or name
+func (s *AdminService) FindRole(ctx context.Context, ref string) (*models.Role, error) {
+	if id, err := strconv.ParseUint(ref, 10, 32); err == nil {
+		return s.accountService.roles.GetByID(ctx, uint(id))
+	}
+	roles, err := s.accountService.roles.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, role := range roles {
+		if strings.EqualFold(role.Name, ref) {
+			return role, nil
+		}
+	}
+	return nil, helper.NewNotFound("name", ref)
+}
+
+// CreateAccount signs up a new account with the given role, active straight away
+func (s *AdminService) CreateAccount(ctx context.Context, actor string, account *models.Account, roleID uint) error {
+	if len(account.Password) < minPasswordLength {
+		return helper.NewBadRequest(fmt.Sprintf("password must be at least %d characters", minPasswordLength))
+	}
+	return s.transaction(ctx, func(repos models.Repositories, accountService *AccountService) error {
+		if _, err := repos.Roles.GetByID(ctx, roleID); err != nil {
+			return err
+		}
+		if err := accountService.Signup(ctx, account); err != nil {
+			return err
+		}
+		if err := accountService.AssignRole(ctx, account.ID, roleID); err != nil {
+			return err
+		}
+		account.RoleID = roleID
+		account.IsActive = true
+		if err := repos.Accounts.ChangeStatus(ctx, account); err != nil {
+			return err
+		}
+
+		return s.record(ctx, repos.Audit, actor, ActionAccountCreate, TargetAccount, account.ID.String(), map[string]any{
+			"email":          account.Email,
+			"account_number": account.AccountNumber,
+			"role_id":        roleID,
+		})
+	})
+}
+
+// SetActive activates or deactivates an account. Deactivating also
+// revokes its sessions so it can't keep refreshing tokens
+func (s *AdminService) SetActive(ctx context.Context, actor string, id uuid.UUID, active bool) error {
+	return s.transaction(ctx, func(repos models.Repositories, _ *AccountService) error {
+		if err := repos.Accounts.ChangeStatus(ctx, &models.Account{ID: id, IsActive: active}); err != nil {
+			return err
+		}
+		action := ActionAccountActivate
+		if !active {
+			action = ActionAccountDeactivate
+		}
+		if err := s.record(ctx, repos.Audit, actor, action, TargetAccount, id.String(), nil); err != nil {
+			return err
+		}
+		if active {
+			return nil
+		}
+		return s.tokenService.Signout(ctx, id)
+	})
+}
+
+// ResetPassword sets a new password and revokes the account's sessions
+func (s *AdminService) ResetPassword(ctx context.Context, actor string, id uuid.UUID, password string) error {
+	account, err := s.accounts.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if len(password) < minPasswordLength {
+		return helper.NewBadRequest(fmt.Sprintf("password must be at least %d characters", minPasswordLength))
+	}
+	return s.transaction(ctx, func(repos models.Repositories, accountService *AccountService) error {
+		if err := accountService.ResetPassword(ctx, account.Email, password); err != nil {
+			return err
+		}
+		if err := s.record(ctx, repos.Audit, actor, ActionPasswordReset, TargetAccount, id.String(), nil); err != nil {
+			return err
+		}
+		return s.tokenService.Signout(ctx, id)
+	})
+}
+
+// AssignRole gives an account a role, it applies from the account's next token refresh
+func (s *AdminService) AssignRole(ctx context.Context, actor string, id uuid.UUID, roleID uint) error {
+	account, err := s.accounts.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	return s.transaction(ctx, func(repos models.Repositories, accountService *AccountService) error {
+		if err := accountService.AssignRole(ctx, id, roleID); err != nil {
+			return err
+		}
+		return s.record(ctx, repos.Audit, actor, ActionRoleAssign, TargetAccount, id.String(), map[string]any{
+			"from_role_id": account.RoleID,
+			"role_id":      roleID,
+		})
+	})
+}
+
+// RevokeSessions deletes all the account's refresh tokens, signing it out everywhere
+func (s *AdminService) RevokeSessions(ctx context.Context, actor string, id uuid.UUID) error {
+	if _, err := s.accounts.GetByID(ctx, id); err != nil {
+		return err
+	}
+	return s.transaction(ctx, func(repos models.Repositories, _ *AccountService) error {
+		if err := s.record(ctx, repos.Audit, actor, ActionSessionsRevoke, TargetAccount, id.String(), nil); err != nil {
+			return err
+		}
+		return s.tokenService.Signout(ctx, id)
+	})
+}
+
+// Credit adds amount to the account's balance
+func (s *AdminService) Credit(ctx context.Context, actor string, id uuid.UUID, amount float64, reason string) (*models.LedgerEntry, error) {
+	return s.apply(ctx, actor, id, models.Credit, amount, reason)
+}
+
+// Debit takes amount from the account's balance, failing if it isn't enough
+func (s *AdminService) Debit(ctx context.Context, actor string, id uuid.UUID, amount float64, reason string) (*models.LedgerEntry, error) {
+	return s.apply(ctx, actor, id, models.Debit, amount, reason)
+}
+
+func (s *AdminService) apply(ctx context.Context, actor string, id uuid.UUID, entryType string, amount float64, reason string) (*models.LedgerEntry, error) {
+	entry := &models.LedgerEntry{
+		AccountID: id,
+		Type:      entryType,
+		Amount:    amount,
+		Reason:    strings.TrimSpace(reason),
+		Actor:     actor,
+	}
+	action := ActionAccountCredit
+	if entryType == models.Debit {
+		action = ActionAccountDebit
+	}
+	err := s.transaction(ctx, func(repos models.Repositories, _ *AccountService) error {
+		if err := repos.Ledger.Apply(ctx, entry); err != nil {
+			return err
+		}
+		return s.record(ctx, repos.Audit, actor, action, TargetAccount, id.String(), map[string]any{
+			"ledger_entry_id": entry.ID,
+			"amount":          entry.Amount,
+			"balance_after":   entry.BalanceAfter,
+			"reason":          entry.Reason,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// Statement returns the account's ledger entries created in [from, to)
+func (s *AdminService) Statement(ctx context.Context, id uuid.UUID, from time.Time, to time.Time) (*Statement, error) {
+	if !from.Before(to) {
+		return nil, helper.NewBadRequest("the statement period must end after it starts")
+	}
+	account, err := s.accounts.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := s.ledger.ListByAccount(ctx, id, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	statement := &Statement{Account: account, From: from, To: to, Entries: entries}
+	if len(entries) == 0 {
+		return statement, nil
+	}
+	first := entries[0]
+	statement.OpeningBalance = first.BalanceAfter - first.Amount
+	if first.Type == models.Debit {
+		statement.OpeningBalance = first.BalanceAfter + first.Amount
+	}
+	statement.OpeningBalance = math.Round(statement.OpeningBalance*100) / 100
+	statement.ClosingBalance = entries[len(entries)-1].BalanceAfter
+	for _, e := range entries {
+		if e.Type == models.Debit {
+			statement.TotalDebits += e.Amount
+		} else {
+			statement.TotalCredits += e.Amount
+		}
+	}
+	statement.TotalCredits = math.Round(statement.TotalCredits*100) / 100
+	statement.TotalDebits = math.Round(statement.TotalDebits*100) / 100
+	return statement, nil
+}
+
+// RotateKeys replaces the token signing key pair. ID tokens signed with
+// the old key stop validating, clients get new ones by refreshing
+func (s *AdminService) RotateKeys(ctx context.Context, actor string) error {
+	if err := s.tokenService.GenerateRSAKeys(); err != nil {
+		helper.Logger(ctx).Error("error rotating signing keys", "error", err)
+		return helper.NewInternal()
+	}
+	return s.record(ctx, s.audit, actor, ActionKeysRotate, TargetKeys, s.tokenService.cfg.PubKeyFile, nil)
+}
+
+// AuditLog returns the latest audit records matching filter
+func (s *AdminService) AuditLog(ctx context.Context, filter models.AuditFilter) ([]*models.AuditRecord, error) {
+	return s.audit.List(ctx, filter)
+}
+
+// transaction runs fn in a transaction, with an AccountService on its
+// repositories. Sessions are revoked last within fn, so a failure to
+// revoke them rolls the change back too
+func (s *AdminService) transaction(ctx context.Context, fn func(repos models.Repositories, accountService *AccountService) error) error {
+	return s.transactor.Transaction(ctx, func(repos models.Repositories) error {
+		return fn(repos, NewAccountService(repos.Accounts, repos.Roles, s.accountService.images))
+	})
+}
+
+// record writes an audit record to audit, details are stored as json
+func (s *AdminService) record(ctx context.Context, audit models.AuditRepository, actor string, action string, targetType string, targetID string, details map[string]any) error {
+	record := &models.AuditRecord{
+		Actor:      actor,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+	}
+	if details != nil {
+		encoded, err := json.Marshal(details)
+		if err != nil {
+			helper.Logger(ctx).Error("error encoding audit details", "error", err)
+			return helper.NewInternal()
+		}
+		record.Details = string(encoded)
+	}
+	return audit.Record(ctx, record)
+}
@@ -0,0 +1,222 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Cprime50/Gopay/config"
+	"github.com/Cprime50/Gopay/helper"
+	models "github.com/Cprime50/Gopay/models/account"
+)
+
+func newTestAdminService(t *testing.T) (*AdminService, models.TokenRepository) {
+	t.Helper()
+	dir := t.TempDir()
+	accounts := models.NewMemoryAccountRepository()
+	tokens := models.NewMemoryTokenRepository()
+	tokenService := NewTokenService(tokens, config.Token{
+		PrivKeyFile:     filepath.Join(dir, "private.pem"),
+		PubKeyFile:      filepath.Join(dir, "public.pem"),
+		IDTokenExp:      15 * time.Minute,
+		RefreshTokenExp: time.Hour,
+	})
+	if err := tokenService.GenerateRSAKeys(); err != nil {
+		t.Fatalf("generating keys: %v", err)
+	}
+	roles := models.NewMemoryRoleRepository(accounts)
+	ledger, audit := models.NewMemoryLedgerRepository(accounts), models.NewMemoryAuditRepository()
+	accountService := NewAccountService(accounts, roles, nil)
+	return NewAdminService(accountService, tokenService, ledger, audit, models.NewMemoryTransactor(accounts, roles, ledger, audit)), tokens
+}
+
+func TestAdminAccountLifecycle(t *testing.T) {
+	ctx := context.Background()
+	admin, tokens := newTestAdminService(t)
+
+	account := &models.Account{Email: "john@mail.com", FirstName: "John", LastName: "Doe", Password: "password123"}
+	if err := admin.CreateAccount(ctx, "cli:ops", account, models.AdminRoleID); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	for _, ref := range []string{account.ID.String(), "john@mail.com", strconv.FormatInt(account.AccountNumber, 10)} {
+		got, err := admin.FindAccount(ctx, ref)
+		if err != nil || got.ID != account.ID {
+			t.Fatalf("find %s: got %v, %v", ref, got, err)
+		}
+		if !got.IsActive || got.RoleID != models.AdminRoleID {
+			t.Fatalf("created account not active admin: %+v", got)
+		}
+	}
+	if _, err := admin.FindRole(ctx, "user"); err != nil {
+		t.Fatalf("find role by name: %v", err)
+	}
+
+	pair, err := admin.tokenService.NewPairFromUser(ctx, account, "")
+	if err != nil {
+		t.Fatalf("issuing tokens: %v", err)
+	}
+	if err := admin.ResetPassword(ctx, "cli:ops", account.ID, "newpassword"); err != nil {
+		t.Fatalf("reset password: %v", err)
+	}
+	// resetting the password signs the account out everywhere
+	if err := tokens.DeleteRefreshToken(ctx, account.ID.String(), pair.RefreshToken.ID.String()); helper.Status(err) != http.StatusUnauthorized {
+		t.Fatalf("refresh token survived the reset: %v", err)
+	}
+	if _, err := admin.accountService.Signin(ctx, "john@mail.com", "newpassword"); err != nil {
+		t.Fatalf("signin with the new password: %v", err)
+	}
+
+	if err := admin.SetActive(ctx, "cli:ops", account.ID, false); err != nil {
+		t.Fatalf("deactivate: %v", err)
+	}
+	if err := admin.AssignRole(ctx, "cli:ops", account.ID, models.UserRoleID); err != nil {
+		t.Fatalf("assign role: %v", err)
+	}
+	if err := admin.RevokeSessions(ctx, "cli:ops", account.ID); err != nil {
+		t.Fatalf("revoke sessions: %v", err)
+	}
+
+	records, err := admin.AuditLog(ctx, models.AuditFilter{TargetType: TargetAccount, TargetID: account.ID.String()})
+	if err != nil {
+		t.Fatalf("audit log: %v", err)
+	}
+	want := []string{ActionSessionsRevoke, ActionRoleAssign, ActionAccountDeactivate, ActionPasswordReset, ActionAccountCreate}
+	if len(records) != len(want) {
+		t.Fatalf("got %d audit records, want %d", len(records), len(want))
+	}
+	for i, record := range records {
+		if record.Action != want[i] || record.Actor != "cli:ops" {
+			t.Errorf("record %d: got %s by %s, want %s by cli:ops", i, record.Action, record.Actor, want[i])
+		}
+	}
+}
+
+func TestAdminCreditDebitAndStatement(t *testing.T) {
+	ctx := context.Background()
+	admin, _ := newTestAdminService(t)
+	start := time.Now().Add(-time.Minute)
+
+	account := &models.Account{Email: "john@mail.com", FirstName: "John", LastName: "Doe", Password: "password123"}
+	if err := admin.CreateAccount(ctx, "cli:ops", account, models.UserRoleID); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	opening := account.Balance
+
+	if _, err := admin.Credit(ctx, "cli:ops", account.ID, 100, "goodwill"); err != nil {
+		t.Fatalf("credit: %v", err)
+	}
+	if _, err := admin.Debit(ctx, "cli:ops", account.ID, 25.5, "fee"); err != nil {
+		t.Fatalf("debit: %v", err)
+	}
+	if _, err := admin.Debit(ctx, "cli:ops", account.ID, 1e6, "fee"); helper.Status(err) != http.StatusBadRequest {
+		t.Fatalf("overdraw: got %v, want bad request", err)
+	}
+	if _, err := admin.Credit(ctx, "cli:ops", account.ID, -5, "oops"); helper.Status(err) != http.StatusBadRequest {
+		t.Fatalf("negative credit: got %v, want bad request", err)
+	}
+	if _, err := admin.Credit(ctx, "cli:ops", account.ID, 5, " "); helper.Status(err) != http.StatusBadRequest {
+		t.Fatalf("credit without reason: got %v, want bad request", err)
+	}
+
+	statement, err := admin.Statement(ctx, account.ID, start, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("statement: %v", err)
+	}
+	if len(statement.Entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(statement.Entries))
+	}
+	if statement.OpeningBalance != opening || statement.ClosingBalance != opening+74.5 {
+		t.Errorf("got opening %v closing %v, want %v and %v", statement.OpeningBalance, statement.ClosingBalance, opening, opening+74.5)
+	}
+	if statement.TotalCredits != 100 || statement.TotalDebits != 25.5 {
+		t.Errorf("got credits %v debits %v", statement.TotalCredits, statement.TotalDebits)
+	}
+
+	// only the applied entries are audited
+	records, _ := admin.AuditLog(ctx, models.AuditFilter{TargetID: account.ID.String()})
+	if len(records) != 3 || records[0].Action != ActionAccountDebit || records[1].Action != ActionAccountCredit {
+		t.Fatalf("unexpected audit records %v", records)
+	}
+}
+
+// unrevokableTokens is a TokenRepository that fails to revoke sessions
+type unrevokableTokens struct {
+	models.TokenRepository
+}
+
+func (unrevokableTokens) DeleteUserRefreshTokens(ctx context.Context, accountID string) error {
+	return helper.NewInternal()
+}
+
+func TestAdminChangesRollBackWithTheirRecord(t *testing.T) {
+	ctx := context.Background()
+	admin, tokens := newTestAdminService(t)
+
+	account := &models.Account{Email: "john@mail.com", FirstName: "John", LastName: "Doe", Password: "password123"}
+	if err := admin.CreateAccount(ctx, "cli:ops", account, models.UserRoleID); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	// sessions can't be revoked, so the deactivation and its record are rolled back
+	admin.tokenService.tokens = unrevokableTokens{tokens}
+	if err := admin.SetActive(ctx, "cli:ops", account.ID, false); helper.Status(err) != http.StatusInternalServerError {
+		t.Fatalf("deactivate: got %v, want internal error", err)
+	}
+	got, err := admin.FindAccount(ctx, account.ID.String())
+	if err != nil || !got.IsActive {
+		t.Fatalf("deactivated without revoking sessions: %+v, %v", got, err)
+	}
+	records, _ := admin.AuditLog(ctx, models.AuditFilter{TargetID: account.ID.String()})
+	if len(records) != 1 || records[0].Action != ActionAccountCreate {
+		t.Fatalf("unexpected audit records %v", records)
+	}
+
+	// a credit is committed with its record
+	entry, err := admin.Credit(ctx, "cli:ops", account.ID, 10, "goodwill")
+	if err != nil {
+		t.Fatalf("credit: %v", err)
+	}
+	records, _ = admin.AuditLog(ctx, models.AuditFilter{TargetID: account.ID.String()})
+	if len(records) != 2 || records[0].Action != ActionAccountCredit || !strings.Contains(records[0].Details, entry.ID.String()) {
+		t.Fatalf("unexpected audit records %v", records)
+	}
+}
+
+func TestAdminRotateKeys(t *testing.T) {
+	ctx := context.Background()
+	admin, _ := newTestAdminService(t)
+
+	account := &models.Account{Email: "john@mail.com", FirstName: "John", LastName: "Doe", Password: "password123"}
+	if err := admin.CreateAccount(ctx, "cli:ops", account, models.UserRoleID); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	pair, err := admin.tokenService.NewPairFromUser(ctx, account, "")
+	if err != nil {
+		t.Fatalf("issuing tokens: %v", err)
+	}
+	before, _ := os.ReadFile(admin.tokenService.cfg.PubKeyFile)
+
+	if err := admin.RotateKeys(ctx, "cli:ops"); err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+	after, _ := os.ReadFile(admin.tokenService.cfg.PubKeyFile)
+	if string(before) == string(after) {
+		t.Fatal("public key unchanged by rotation")
+	}
+	if _, err := admin.tokenService.ValidateJWT(ctx, pair.Token.SignedString); err == nil {
+		t.Fatal("token signed with the old key still validates")
+	}
+	if err := admin.tokenService.CheckSigningKeys(); err != nil {
+		t.Fatalf("rotated keys don't load: %v", err)
+	}
+
+	records, _ := admin.AuditLog(ctx, models.AuditFilter{TargetType: TargetKeys})
+	if len(records) != 1 || records[0].Action != ActionKeysRotate {
+		t.Fatalf("unexpected audit records %v", records)
+	}
+}
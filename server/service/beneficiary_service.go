@@ -0,0 +1,139 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Cprime50/Gopay/config"
+	"github.com/Cprime50/Gopay/helper"
+	models "github.com/Cprime50/Gopay/models/account"
+	"github.com/google/uuid"
+)
+
+// maxNicknameLength matches the nickname column
+const maxNicknameLength = 50
+
+// BeneficiaryUpdate holds the fields of a beneficiary to change, nil ones are kept
+type BeneficiaryUpdate struct {
+	Nickname  *string
+	Favourite *bool
+}
+
+// BeneficiaryService manages the recipients accounts save. The holder's
+// name is resolved from the account number when one is added, masked
+// like a lookup's so saving one doesn't reveal more, and transfers to
+// it can't be due until the cool off after adding it ends
+type BeneficiaryService struct {
+	accounts      models.AccountRepository
+	beneficiaries models.BeneficiaryRepository
+	cfg           config.Beneficiaries
+	now           func() time.Time
+}
+
+// NewBeneficiaryService returns a BeneficiaryService
+func NewBeneficiaryService(accounts models.AccountRepository, beneficiaries models.BeneficiaryRepository, cfg config.Beneficiaries) *BeneficiaryService {
+	return &BeneficiaryService{
+		accounts:      accounts,
+		beneficiaries: beneficiaries,
+		cfg:           cfg,
+		now:           func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// Create saves a new beneficiary for beneficiary.AccountID, resolving
+// the holder of its account number
+func (s *BeneficiaryService) Create(ctx context.Context, beneficiary *models.Beneficiary) error {
+	nickname, err := validateNickname(beneficiary.Nickname)
+	if err != nil {
+		return err
+	}
+	holder, err := s.accounts.GetByAccountNum(ctx, beneficiary.AccountNumber)
+	if err != nil {
+		if helper.Status(err) == http.StatusNotFound {
+			return helper.NewInvalidParam("account_number", "exists", "no account has this number")
+		}
+		return err
+	}
+	if holder.ID == beneficiary.AccountID {
+		return helper.NewInvalidParam("account_number", "ne", "must not be your own account")
+	}
+	existing, err := s.beneficiaries.ListByAccount(ctx, beneficiary.AccountID)
+	if err != nil {
+		return err
+	}
+	if len(existing) >= s.cfg.Max {
+		return helper.NewBadRequest(fmt.Sprintf("an account can have at most %d beneficiaries", s.cfg.Max))
+	}
+
+	beneficiary.Nickname = nickname
+	beneficiary.HolderName = maskHolderName(holder.FirstName, holder.LastName)
+	beneficiary.AvailableAt = s.now().Add(s.cfg.CoolOff)
+	beneficiary.LastUsedAt = nil
+	return s.beneficiaries.Create(ctx, beneficiary)
+}
+
+// List returns the account's beneficiaries, favourites first then the most recently used
+func (s *BeneficiaryService) List(ctx context.Context, accountID uuid.UUID) ([]*models.Beneficiary, error) {
+	return s.beneficiaries.ListByAccount(ctx, accountID)
+}
+
+// Get returns one of the account's beneficiaries, other accounts' are not found
+func (s *BeneficiaryService) Get(ctx context.Context, accountID uuid.UUID, id uuid.UUID) (*models.Beneficiary, error) {
+	beneficiary, err := s.beneficiaries.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if beneficiary.AccountID != accountID {
+		return nil, helper.NewNotFound("beneficiary", id.String())
+	}
+	return beneficiary, nil
+}
+
+// Update renames a beneficiary or marks it a favourite
+func (s *BeneficiaryService) Update(ctx context.Context, accountID uuid.UUID, id uuid.UUID, update BeneficiaryUpdate) (*models.Beneficiary, error) {
+	beneficiary, err := s.Get(ctx, accountID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if update.Nickname != nil {
+		nickname, err := validateNickname(*update.Nickname)
+		if err != nil {
+			return nil, err
+		}
+		beneficiary.Nickname = nickname
+	}
+	if update.Favourite != nil {
+		beneficiary.Favourite = *update.Favourite
+	}
+
+	if err := s.beneficiaries.Update(ctx, beneficiary); err != nil {
+		return nil, err
+	}
+	return beneficiary, nil
+}
+
+// Delete removes a beneficiary. Schedules to its account number are kept
+// but pause when next due while a cool off is configured
+func (s *BeneficiaryService) Delete(ctx context.Context, accountID uuid.UUID, id uuid.UUID) error {
+	if _, err := s.Get(ctx, accountID, id); err != nil {
+		return err
+	}
+	return s.beneficiaries.Delete(ctx, id)
+}
+
+// validateNickname trims nickname, which must be left with 1 to maxNicknameLength characters
+func validateNickname(nickname string) (string, error) {
+	nickname = strings.TrimSpace(nickname)
+	if nickname == "" {
+		return "", helper.NewInvalidParam("nickname", "required", "must not be blank")
+	}
+	if utf8.RuneCountInString(nickname) > maxNicknameLength {
+		return "", helper.NewInvalidParam("nickname", "max", fmt.Sprintf("must be at most %d characters long", maxNicknameLength))
+	}
+	return nickname, nil
+}
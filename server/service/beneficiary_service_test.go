@@ -0,0 +1,120 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Cprime50/Gopay/config"
+	"github.com/Cprime50/Gopay/helper"
+	models "github.com/Cprime50/Gopay/models/account"
+)
+
+// newBeneficiaryService returns a BeneficiaryService over the schedule
+// fixture's accounts and beneficiaries, on its clock
+func newBeneficiaryService(f *scheduleFixture, cfg config.Beneficiaries) *BeneficiaryService {
+	s := NewBeneficiaryService(f.accounts, f.beneficiaries, cfg)
+	s.now = func() time.Time { return f.now }
+	return s
+}
+
+func TestBeneficiaries(t *testing.T) {
+	ctx := context.Background()
+	f := newScheduleFixture(t)
+	cfg := config.Default().Beneficiaries
+	cfg.Max = 1
+	s := newBeneficiaryService(f, cfg)
+
+	beneficiary := &models.Beneficiary{AccountID: f.from.ID, Nickname: "  Jane ", AccountNumber: f.to.AccountNumber}
+	if err := s.Create(ctx, beneficiary); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if beneficiary.Nickname != "Jane" || beneficiary.HolderName != "Jo** Do*" || !beneficiary.AvailableAt.Equal(f.now) {
+		t.Fatalf("created %+v", beneficiary)
+	}
+
+	for name, b := range map[string]*models.Beneficiary{
+		"blank nickname": {AccountID: f.to.ID, Nickname: " ", AccountNumber: f.from.AccountNumber},
+		"unknown number": {AccountID: f.to.ID, Nickname: "Nobody", AccountNumber: 999},
+		"own account":    {AccountID: f.to.ID, Nickname: "Me", AccountNumber: f.to.AccountNumber},
+		"more than max":  {AccountID: f.from.ID, Nickname: "Again", AccountNumber: f.to.AccountNumber},
+	} {
+		if err := s.Create(ctx, b); helper.Status(err) != http.StatusBadRequest {
+			t.Errorf("%s: got %v, want bad request", name, err)
+		}
+	}
+
+	// other accounts can't see or change it
+	if _, err := s.Get(ctx, f.to.ID, beneficiary.ID); helper.Status(err) != http.StatusNotFound {
+		t.Fatalf("get by another account: got %v, want not found", err)
+	}
+	if err := s.Delete(ctx, f.to.ID, beneficiary.ID); helper.Status(err) != http.StatusNotFound {
+		t.Fatalf("delete by another account: got %v, want not found", err)
+	}
+
+	nickname, favourite := "Jane D", true
+	updated, err := s.Update(ctx, f.from.ID, beneficiary.ID, BeneficiaryUpdate{Nickname: &nickname, Favourite: &favourite})
+	if err != nil || updated.Nickname != "Jane D" || !updated.Favourite || updated.AccountNumber != f.to.AccountNumber {
+		t.Fatalf("update: got %+v, %v", updated, err)
+	}
+	if err := s.Delete(ctx, f.from.ID, beneficiary.ID); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if list, _ := s.List(ctx, f.from.ID); len(list) != 0 {
+		t.Fatalf("list after delete: %+v", list)
+	}
+}
+
+func TestBeneficiaryCoolOff(t *testing.T) {
+	ctx := context.Background()
+	f := newScheduleFixture(t)
+	cfg := config.Default().Beneficiaries
+	cfg.CoolOff = 24 * time.Hour
+	f.service.coolOffPeriod = cfg.CoolOff
+
+	// with a cool off only saved beneficiaries can be paid
+	unsaved := &models.ScheduledTransfer{AccountID: f.from.ID, ToAccountNumber: f.to.AccountNumber, Amount: 30, Frequency: models.Once, StartAt: f.now.Add(48 * time.Hour)}
+	if err := f.service.Create(ctx, unsaved); helper.Status(err) != http.StatusBadRequest {
+		t.Fatalf("create to an unsaved recipient: got %v, want bad request", err)
+	}
+
+	beneficiary := &models.Beneficiary{AccountID: f.from.ID, Nickname: "Jane", AccountNumber: f.to.AccountNumber}
+	if err := newBeneficiaryService(f, cfg).Create(ctx, beneficiary); err != nil {
+		t.Fatalf("create beneficiary: %v", err)
+	}
+
+	// a transfer to a new beneficiary can't be due until the cool off ends
+	schedule := &models.ScheduledTransfer{AccountID: f.from.ID, ToAccountNumber: f.to.AccountNumber, Amount: 30, Frequency: models.Monthly, StartAt: f.now}
+	if err := f.service.Create(ctx, schedule); helper.Status(err) != http.StatusBadRequest {
+		t.Fatalf("create during the cool off: got %v, want bad request", err)
+	}
+	schedule.StartAt = beneficiary.AvailableAt
+	if err := f.service.Create(ctx, schedule); err != nil {
+		t.Fatalf("create after the cool off: %v", err)
+	}
+	early := f.now.Add(time.Hour)
+	if _, err := f.service.Update(ctx, f.from.ID, schedule.ID, ScheduleUpdate{StartAt: &early}); helper.Status(err) != http.StatusBadRequest {
+		t.Fatalf("move into the cool off: got %v, want bad request", err)
+	}
+
+	// making the transfer marks the beneficiary used
+	f.now = beneficiary.AvailableAt
+	if got := f.runDue(t, schedule); got.LastStatus != models.RunCompleted {
+		t.Fatalf("run: %+v", got)
+	}
+	used, _ := f.beneficiaries.GetByID(ctx, beneficiary.ID)
+	if used.LastUsedAt == nil || !used.LastUsedAt.Equal(f.now) {
+		t.Fatalf("beneficiary after the transfer: %+v", used)
+	}
+
+	// deleting the beneficiary pauses the schedule at its next run,
+	// adding it again would start a new cool off
+	if err := newBeneficiaryService(f, cfg).Delete(ctx, f.from.ID, beneficiary.ID); err != nil {
+		t.Fatalf("delete beneficiary: %v", err)
+	}
+	f.now = f.now.AddDate(0, 1, 0)
+	if got := f.runDue(t, schedule); got.Status != models.SchedulePaused || f.balance(t, f.from) != 70 {
+		t.Fatalf("run after deleting the beneficiary: %+v", got)
+	}
+}
@@ -0,0 +1,137 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// remember to fix this whenu wake up
+func (s *TokenService) GenerateRSAKeys() error {
+	privKeyFile := s.cfg.PrivKeyFile
+	pubKeyFile := s.cfg.PubKeyFile
+
+	// Generate RSA private key
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return fmt.Errorf("failed to generate RSA private key: %w", err)
+	}
+
+	// Encode private key to PEM format
+	privKeyBytes := x509.MarshalPKCS1PrivateKey(privateKey)
+	privKeyBlock := &pem.Block{Type: "RSA PRIVATE KEY", Bytes: privKeyBytes}
+
+	//Create private key
+	if err := writePEMFile(privKeyFile, privKeyBlock, 0600); err != nil {
+		return fmt.Errorf("failed to write private key to file: %w", err)
+	}
+
+	// Generate RSA public key
+	pubKey := &privateKey.PublicKey
+
+	// Encode public key to PEM format
+	pubKeyBytes, err := x509.MarshalPKIXPublicKey(pubKey)
+	if err != nil {
+		return fmt.Errorf("failed to marshal public key: %w", err)
+	}
+	pubKeyBlock := &pem.Block{Type: "PUBLIC KEY", Bytes: pubKeyBytes}
+
+	//Create pubkey
+	if err := writePEMFile(pubKeyFile, pubKeyBlock, 0644); err != nil {
+		return fmt.Errorf("failed to write public key to file: %w", err)
+	}
+
+	return nil
+}
+
+// writePEMFile writes block to a temporary file renamed over path, so a
+// running server never reads a half written key while they're rotated
+func writePEMFile(path string, block *pem.Block, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := pem.Encode(tmp, block); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// CheckSigningKeys makes sure both halves of the token signing key pair
+// can be loaded, used by the readiness probe
+func (s *TokenService) CheckSigningKeys() error {
+	if _, err := s.privKey(); err != nil {
+		return err
+	}
+	_, err := s.pubKey()
+	return err
+}
+
+func (s *TokenService) privKey() (*rsa.PrivateKey, error) {
+	privKeyFile := s.cfg.PrivKeyFile
+	if privKeyFile == "" {
+		return nil, fmt.Errorf("private key file not configured")
+	}
+	priv, err := os.ReadFile(privKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not read private key pem file: %w", err)
+	}
+
+	privKey, err := jwt.ParseRSAPrivateKeyFromPEM(priv)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse private key: %w", err)
+	}
+	return privKey, nil
+}
+
+func (s *TokenService) pubKey() (*rsa.PublicKey, error) {
+	pubKeyFile := s.cfg.PubKeyFile
+	if pubKeyFile == "" {
+		return nil, fmt.Errorf("public key file not configured")
+	}
+	pub, err := os.ReadFile(pubKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not read public key pem file: %w", err)
+	}
+
+	pubKey, err := jwt.ParseRSAPublicKeyFromPEM(pub)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse public key: %w", err)
+	}
+	return pubKey, nil
+}
+
+func (s *TokenService) tokenExp() (time.Duration, error) {
+	if s.cfg.IDTokenExp <= 0 {
+		return 0, fmt.Errorf("token expiration not configured")
+	}
+	return s.cfg.IDTokenExp, nil
+}
+
+func (s *TokenService) refreshExp() (time.Duration, error) {
+	if s.cfg.RefreshTokenExp <= 0 {
+		return 0, fmt.Errorf("refresh token expiration not configured")
+	}
+	return s.cfg.RefreshTokenExp, nil
+}
+
+func (s *TokenService) refreshSecret() string {
+	return s.cfg.RefreshSecret
+}
@@ -0,0 +1,280 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Cprime50/Gopay/helper"
+	"github.com/Cprime50/Gopay/i18n"
+	models "github.com/Cprime50/Gopay/models/account"
+	"github.com/google/uuid"
+)
+
+// notificationCategories maps notification events to their category,
+// events not listed are security notifications
+var notificationCategories = map[string]string{
+	models.EventAccountCreated:    models.CategorySecurity,
+	models.EventPasswordChanged:   models.CategorySecurity,
+	EventWebhookDisabled:          models.CategorySecurity,
+	EventTransferSent:             models.CategoryTransactions,
+	EventTransferReceived:         models.CategoryTransactions,
+	EventAccountCredited:          models.CategoryTransactions,
+	EventAccountDebited:           models.CategoryTransactions,
+	EventScheduledTransferSkipped: models.CategoryTransactions,
+	EventScheduledTransferFailed:  models.CategoryTransactions,
+	EventScheduledTransferPaused:  models.CategoryTransactions,
+}
+
+// NotificationCategory returns the category of a notification event
+func NotificationCategory(event string) string {
+	if category, ok := notificationCategories[event]; ok {
+		return category
+	}
+	return models.CategorySecurity
+}
+
+// NotificationPage is a page of an account's inbox, NextCursor fetches
+// the next one and is empty on the last
+type NotificationPage struct {
+	Notifications []*models.Notification
+	NextCursor    string
+}
+
+// PreferenceUpdate changes the channels of a category, nil fields are kept
+type PreferenceUpdate struct {
+	InApp *bool
+	Email *bool
+	SMS   *bool
+}
+
+// NotificationService keeps the in app inbox and the channels each
+// account chose for every category of notification. It's the Notifier
+// the notifications worker delivers with, saving notifications to the
+// inbox and handing them to email as the account chose. Texts are sent
+// by SMSService, which checks the same preferences
+type NotificationService struct {
+	notifications models.NotificationRepository
+	email         Notifier
+	now           func() time.Time
+}
+
+// NewNotificationService returns a NotificationService emailing with email,
+// LogNotifier if nil
+func NewNotificationService(notifications models.NotificationRepository, email Notifier) *NotificationService {
+	if email == nil {
+		email = LogNotifier{}
+	}
+	return &NotificationService{
+		notifications: notifications,
+		email:         email,
+		now:           func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// Notify delivers n on the channels the account chose for its category.
+// A notification delivered again, with the same ID, isn't saved or
+// emailed twice. Without the in app copy to tell it's been delivered
+// it's emailed each time
+func (s *NotificationService) Notify(ctx context.Context, n Notification) error {
+	category := NotificationCategory(n.Event)
+	preference, err := s.Preference(ctx, n.AccountID, category)
+	if err != nil {
+		return err
+	}
+	if preference.InApp {
+		if n.ID == uuid.Nil {
+			n.ID = uuid.New()
+		}
+		created, err := s.notifications.CreateNotification(ctx, &models.Notification{
+			ID: n.ID,
+			// postgres keeps microseconds, so cursors match what's stored
+			CreatedAt: s.now().Truncate(time.Microsecond),
+			AccountID: n.AccountID,
+			Category:  category,
+			Event:     n.Event,
+			Data:      n.Data,
+		})
+		if err != nil || !created {
+			return err
+		}
+	}
+	if preference.Email {
+		return s.email.Notify(ctx, n)
+	}
+	return nil
+}
+
+// List returns a page of the account's notifications, newest first.
+// cursor is the NextCursor of the previous page, empty for the first
+func (s *NotificationService) List(ctx context.Context, accountID uuid.UUID, unreadOnly bool, cursor string, limit int) (*NotificationPage, error) {
+	filter := models.NotificationFilter{UnreadOnly: unreadOnly, Limit: limit + 1}
+	if cursor != "" {
+		after, err := decodeCursor(cursor)
+		if err != nil {
+			return nil, helper.NewInvalidParam("cursor", "cursor", "must be a next_cursor returned by this endpoint")
+		}
+		filter.After = after
+	}
+	notifications, err := s.notifications.ListNotifications(ctx, accountID, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &NotificationPage{Notifications: notifications}
+	// one more than asked for tells there's another page
+	if len(notifications) > limit {
+		page.Notifications = notifications[:limit]
+		last := page.Notifications[limit-1]
+		page.NextCursor = encodeCursor(&models.NotificationCursor{CreatedAt: last.CreatedAt, ID: last.ID})
+	}
+	return page, nil
+}
+
+func (s *NotificationService) UnreadCount(ctx context.Context, accountID uuid.UUID) (int64, error) {
+	return s.notifications.CountUnread(ctx, accountID)
+}
+
+// MarkRead marks one of the account's notifications read
+func (s *NotificationService) MarkRead(ctx context.Context, accountID uuid.UUID, id uuid.UUID) (*models.Notification, error) {
+	return s.notifications.MarkRead(ctx, accountID, id, s.now())
+}
+
+// MarkAllRead marks every notification of the account read, returning how many were unread
+func (s *NotificationService) MarkAllRead(ctx context.Context, accountID uuid.UUID) (int64, error) {
+	return s.notifications.MarkAllRead(ctx, accountID, s.now())
+}
+
+// Preferences returns the account's channels for every category,
+// the defaults for those it hasn't chosen
+func (s *NotificationService) Preferences(ctx context.Context, accountID uuid.UUID) ([]*models.NotificationPreference, error) {
+	saved, err := s.notifications.ListPreferences(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+	preferences := make([]*models.NotificationPreference, 0, len(models.NotificationCategories))
+	for _, category := range models.NotificationCategories {
+		preferences = append(preferences, findPreference(saved, accountID, category))
+	}
+	return preferences, nil
+}
+
+// Preference returns the account's channels for category
+func (s *NotificationService) Preference(ctx context.Context, accountID uuid.UUID, category string) (*models.NotificationPreference, error) {
+	return preferenceFor(ctx, s.notifications, accountID, category)
+}
+
+// UpdatePreference changes the account's channels for category. Security
+// notifications can't be turned off, they keep the app or email
+func (s *NotificationService) UpdatePreference(ctx context.Context, accountID uuid.UUID, category string, update PreferenceUpdate) (*models.NotificationPreference, error) {
+	if !isCategory(category) {
+		return nil, helper.NewNotFound("category", category)
+	}
+	preference, err := s.Preference(ctx, accountID, category)
+	if err != nil {
+		return nil, err
+	}
+	if update.InApp != nil {
+		preference.InApp = *update.InApp
+	}
+	if update.Email != nil {
+		preference.Email = *update.Email
+	}
+	if update.SMS != nil {
+		preference.SMS = *update.SMS
+	}
+	if category == models.CategorySecurity && !preference.InApp && !preference.Email {
+		return nil, helper.NewBadRequest("security notifications can't be turned off, keep them in the app or by email")
+	}
+	if err := s.notifications.SavePreference(ctx, preference); err != nil {
+		return nil, err
+	}
+	return preference, nil
+}
+
+// preferenceFor returns the account's channels for category, the default if it hasn't chosen
+func preferenceFor(ctx context.Context, notifications models.NotificationRepository, accountID uuid.UUID, category string) (*models.NotificationPreference, error) {
+	saved, err := notifications.ListPreferences(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+	return findPreference(saved, accountID, category), nil
+}
+
+// findPreference returns the preference for category among saved, or its default
+func findPreference(saved []*models.NotificationPreference, accountID uuid.UUID, category string) *models.NotificationPreference {
+	for _, p := range saved {
+		if p.Category == category {
+			return p
+		}
+	}
+	return models.DefaultNotificationPreference(accountID, category)
+}
+
+func isCategory(category string) bool {
+	for _, c := range models.NotificationCategories {
+		if c == category {
+			return true
+		}
+	}
+	return false
+}
+
+// NotificationText renders the title and body of an inbox notification in locale
+func NotificationText(locale string, n *models.Notification) (title string, body string) {
+	params := make(map[string]string, len(n.Data))
+	for key, value := range n.Data {
+		params[key] = formatNotificationValue(key, value)
+	}
+	key := "notification." + n.Event
+	return i18n.T(locale, key+".title", params), i18n.T(locale, key+".body", params)
+}
+
+// formatNotificationValue formats a value of notification data for its
+// text. Data has been through JSON so numbers are float64 and times strings
+func formatNotificationValue(key string, value any) string {
+	switch v := value.(type) {
+	case float64:
+		if key == "amount" || key == "balance_after" {
+			return fmt.Sprintf("%.2f", v)
+		}
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case string:
+		if t, err := time.Parse(time.RFC3339, v); err == nil {
+			return t.UTC().Format("2 Jan 2006 15:04 MST")
+		}
+		return v
+	case time.Time:
+		return v.UTC().Format("2 Jan 2006 15:04 MST")
+	}
+	return fmt.Sprint(value)
+}
+
+// encodeCursor makes an opaque page cursor out of where a page ended
+func encodeCursor(cursor *models.NotificationCursor) string {
+	raw := strconv.FormatInt(cursor.CreatedAt.UnixNano(), 10) + ":" + cursor.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(cursor string) (*models.NotificationCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, err
+	}
+	nanos, id, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return nil, fmt.Errorf("malformed cursor %q", raw)
+	}
+	unixNano, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := uuid.Parse(id)
+	if err != nil {
+		return nil, err
+	}
+	return &models.NotificationCursor{CreatedAt: time.Unix(0, unixNano).UTC(), ID: parsed}, nil
+}
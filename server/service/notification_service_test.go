@@ -0,0 +1,146 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Cprime50/Gopay/helper"
+	models "github.com/Cprime50/Gopay/models/account"
+	"github.com/google/uuid"
+)
+
+func TestNotificationChannels(t *testing.T) {
+	ctx := context.Background()
+	email := &recordingNotifier{}
+	s := NewNotificationService(models.NewMemoryNotificationRepository(), email)
+	accountID := uuid.New()
+	off := false
+
+	received := Notification{ID: uuid.New(), AccountID: accountID, Event: EventTransferReceived, Data: map[string]any{"amount": 25.0}}
+	if err := s.Notify(ctx, received); err != nil {
+		t.Fatalf("notify: %v", err)
+	}
+	// delivered again by the queue, it's only saved and emailed once
+	if err := s.Notify(ctx, received); err != nil {
+		t.Fatalf("notify again: %v", err)
+	}
+	if count, _ := s.UnreadCount(ctx, accountID); count != 1 || len(email.sent) != 1 {
+		t.Fatalf("got %d in the inbox and %d emails", count, len(email.sent))
+	}
+
+	// unknown events are security notifications, shown and emailed
+	if err := s.Notify(ctx, Notification{AccountID: accountID, Event: "promo.launched"}); err != nil {
+		t.Fatalf("notify unknown event: %v", err)
+	}
+	if _, err := s.UpdatePreference(ctx, accountID, models.CategoryTransactions, PreferenceUpdate{InApp: &off}); err != nil {
+		t.Fatalf("transactions out of the app: %v", err)
+	}
+	if err := s.Notify(ctx, Notification{AccountID: accountID, Event: EventTransferSent}); err != nil {
+		t.Fatalf("notify sent: %v", err)
+	}
+	// transactions are only emailed now
+	if count, _ := s.UnreadCount(ctx, accountID); count != 2 || len(email.sent) != 3 {
+		t.Fatalf("got %d in the inbox and %d emails", count, len(email.sent))
+	}
+
+	preferences, err := s.Preferences(ctx, accountID)
+	if err != nil || len(preferences) != len(models.NotificationCategories) {
+		t.Fatalf("preferences: got %+v, %v", preferences, err)
+	}
+	for _, p := range preferences {
+		want := models.DefaultNotificationPreference(accountID, p.Category)
+		if p.Category == models.CategoryTransactions {
+			want.InApp = false
+		}
+		if p.InApp != want.InApp || p.Email != want.Email || p.SMS != want.SMS {
+			t.Fatalf("%s: got %+v, want %+v", p.Category, p, want)
+		}
+	}
+
+	if _, err := s.UpdatePreference(ctx, accountID, "weather", PreferenceUpdate{InApp: &off}); helper.Status(err) != http.StatusNotFound {
+		t.Fatalf("unknown category: got %v", err)
+	}
+	if _, err := s.UpdatePreference(ctx, accountID, models.CategorySecurity, PreferenceUpdate{Email: &off}); err != nil {
+		t.Fatalf("security by app only: %v", err)
+	}
+	if _, err := s.UpdatePreference(ctx, accountID, models.CategorySecurity, PreferenceUpdate{InApp: &off}); helper.Status(err) != http.StatusBadRequest {
+		t.Fatalf("security turned off: got %v", err)
+	}
+}
+
+func TestNotificationPages(t *testing.T) {
+	ctx := context.Background()
+	s := NewNotificationService(models.NewMemoryNotificationRepository(), nil)
+	accountID := uuid.New()
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+
+	for i := 0; i < 5; i++ {
+		if err := s.Notify(ctx, Notification{AccountID: accountID, Event: EventTransferReceived, Data: map[string]any{"amount": float64(i)}}); err != nil {
+			t.Fatalf("notify %d: %v", i, err)
+		}
+		// two share a timestamp
+		if i != 2 {
+			now = now.Add(time.Second)
+		}
+	}
+
+	seen := map[uuid.UUID]bool{}
+	cursor := ""
+	for pages := 0; ; pages++ {
+		page, err := s.List(ctx, accountID, false, cursor, 2)
+		if err != nil {
+			t.Fatalf("page %d: %v", pages, err)
+		}
+		for _, n := range page.Notifications {
+			seen[n.ID] = true
+		}
+		if page.NextCursor == "" {
+			if pages != 2 || len(page.Notifications) != 1 {
+				t.Fatalf("last page %d has %d notifications", pages, len(page.Notifications))
+			}
+			break
+		}
+		cursor = page.NextCursor
+	}
+	if len(seen) != 5 {
+		t.Fatalf("paged through %d notifications, want 5", len(seen))
+	}
+
+	first, _ := s.List(ctx, accountID, false, "", 1)
+	if _, err := s.MarkRead(ctx, accountID, first.Notifications[0].ID); err != nil {
+		t.Fatalf("mark read: %v", err)
+	}
+	if unread, _ := s.List(ctx, accountID, true, "", 10); len(unread.Notifications) != 4 || unread.NextCursor != "" {
+		t.Fatalf("unread: got %+v", unread)
+	}
+	if _, err := s.List(ctx, accountID, false, "not-a-cursor", 10); !isCode(err, helper.CodeValidationFailed) {
+		t.Fatalf("bad cursor: got %v", err)
+	}
+	if marked, err := s.MarkAllRead(ctx, accountID); err != nil || marked != 4 {
+		t.Fatalf("mark all read: got %d, %v", marked, err)
+	}
+}
+
+func TestNotificationText(t *testing.T) {
+	n := &models.Notification{Event: EventTransferReceived, Data: map[string]any{
+		"amount":                      25.5,
+		"counterparty_name":           "John Doe",
+		"counterparty_account_number": 1234567890.0,
+		"reference":                   "8f14e45f-ceea-467e-9a1b-2c3d4e5f6a7b",
+	}}
+	title, body := NotificationText("en", n)
+	if title != "You received 25.50" || body != "25.50 from John Doe, account 1234567890. Reference 8f14e45f-ceea-467e-9a1b-2c3d4e5f6a7b." {
+		t.Fatalf("got %q, %q", title, body)
+	}
+	if title, _ := NotificationText("fr", n); title != "Vous avez reçu 25.50" {
+		t.Fatalf("fr: got %q", title)
+	}
+	due := &models.Notification{Event: EventScheduledTransferSkipped, Data: map[string]any{"due_at": "2024-05-01T09:30:00Z"}}
+	if _, body := NotificationText("en", due); !strings.Contains(body, "1 May 2024 09:30 UTC") {
+		t.Fatalf("due_at: got %q", body)
+	}
+}
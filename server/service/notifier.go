@@ -0,0 +1,152 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Cprime50/Gopay/events"
+	"github.com/Cprime50/Gopay/helper"
+	models "github.com/Cprime50/Gopay/models/account"
+	"github.com/Cprime50/Gopay/queue"
+	"github.com/google/uuid"
+)
+
+// Notification events
+const (
+	EventScheduledTransferSkipped = "scheduled_transfer.skipped"
+	EventScheduledTransferFailed  = "scheduled_transfer.failed"
+	EventScheduledTransferPaused  = "scheduled_transfer.paused"
+	EventWebhookDisabled          = "webhook.disabled"
+	// a transfer completed is a receipt to each side, see NotifyEvents
+	EventTransferSent     = "transfer.sent"
+	EventTransferReceived = "transfer.received"
+	// a balance adjusted is one of these, by the entry's type
+	EventAccountCredited = "account.credited"
+	EventAccountDebited  = "account.debited"
+)
+
+// Notification tells an account holder something happened to their
+// account. ID identifies it in the inbox, so delivering it again doesn't
+// save it twice
+type Notification struct {
+	ID        uuid.UUID      `json:"id"`
+	AccountID uuid.UUID      `json:"account_id"`
+	Event     string         `json:"event"`
+	Data      map[string]any `json:"data"`
+}
+
+// Notifier delivers notifications to account holders
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+}
+
+// LogNotifier only logs notifications, for when no other notifier is set up
+type LogNotifier struct{}
+
+func (LogNotifier) Notify(ctx context.Context, n Notification) error {
+	helper.Logger(ctx).Info("notification", "account_id", n.AccountID, "event", n.Event, "data", n.Data)
+	return nil
+}
+
+// NotificationJob delivers a notification in the background
+var NotificationJob = queue.NewType[Notification]("notifications", "notification.deliver")
+
+// QueueNotifier enqueues notifications for a worker to deliver, so a
+// slow or failing delivery is retried without holding up the caller
+type QueueNotifier struct {
+	Queue *queue.Queue
+}
+
+func (n QueueNotifier) Notify(ctx context.Context, notification Notification) error {
+	if notification.ID == uuid.Nil {
+		notification.ID = uuid.New()
+	}
+	_, err := NotificationJob.Enqueue(ctx, n.Queue, notification)
+	return err
+}
+
+// HandleNotifications has w deliver queued notifications with notifier
+func HandleNotifications(w *queue.Worker, notifier Notifier) {
+	NotificationJob.Handle(w, notifier.Notify)
+}
+
+// NotifyEvents is an event bus subscriber notifying account holders of
+// the domain events they're told about: their account opening, password
+// changes, transfer receipts and balance adjustments. Handlers such as Signup only write the
+// event, notifier should be a QueueNotifier so the relay isn't held up.
+// Notifications are identified by the event, so one relayed again has
+// the same ID
+func NotifyEvents(accounts models.AccountRepository, notifier Notifier) events.Handler {
+	return func(ctx context.Context, event events.Event) error {
+		switch event.Type {
+		case models.EventAccountCreated, models.EventPasswordChanged:
+			return notifier.Notify(ctx, Notification{
+				ID:        notificationID(event, event.Type),
+				AccountID: event.AggregateID,
+				Event:     event.Type,
+				Data:      map[string]any{"occurred_at": event.OccurredAt},
+			})
+
+		case models.EventTransferCompleted:
+			transfer, err := events.Decode[models.TransferCompleted](event)
+			if err != nil {
+				return err
+			}
+			from, err := accounts.GetByID(ctx, transfer.FromAccountID)
+			if err != nil {
+				return err
+			}
+			to, err := accounts.GetByID(ctx, transfer.ToAccountID)
+			if err != nil {
+				return err
+			}
+			receipt := func(account *models.Account, notification string, counterparty *models.Account, reference uuid.UUID) Notification {
+				return Notification{
+					ID:        notificationID(event, notification),
+					AccountID: account.ID,
+					Event:     notification,
+					Data: map[string]any{
+						"amount":                      transfer.Amount,
+						"counterparty_name":           counterparty.FirstName + " " + counterparty.LastName,
+						"counterparty_account_number": counterparty.AccountNumber,
+						"reference":                   reference,
+						"occurred_at":                 event.OccurredAt,
+					},
+				}
+			}
+			return errors.Join(
+				notifier.Notify(ctx, receipt(from, EventTransferSent, to, transfer.DebitEntryID)),
+				notifier.Notify(ctx, receipt(to, EventTransferReceived, from, transfer.CreditEntryID)),
+			)
+
+		case models.EventBalanceAdjusted:
+			adjusted, err := events.Decode[models.BalanceAdjusted](event)
+			if err != nil {
+				return err
+			}
+			notification := EventAccountCredited
+			if adjusted.Type == models.Debit {
+				notification = EventAccountDebited
+			}
+			return notifier.Notify(ctx, Notification{
+				ID:        notificationID(event, notification),
+				AccountID: adjusted.AccountID,
+				Event:     notification,
+				Data: map[string]any{
+					"amount":        adjusted.Amount,
+					"balance_after": adjusted.BalanceAfter,
+					"reason":        adjusted.Reason,
+					"reference":     adjusted.EntryID,
+					"occurred_at":   event.OccurredAt,
+				},
+			})
+		}
+		return nil
+	}
+}
+
+// notificationID is the ID of the notification of event about it,
+// the same every time the event is handled
+func notificationID(event events.Event, notification string) uuid.UUID {
+	return uuid.NewSHA1(event.ID, []byte(notification))
+}
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/Cprime50/Gopay/events"
+	models "github.com/Cprime50/Gopay/models/account"
+	"github.com/google/uuid"
+)
+
+func TestNotifyEvents(t *testing.T) {
+	ctx := context.Background()
+	accounts := models.NewMemoryAccountRepository()
+	john := &models.Account{Email: "john@mail.com", FirstName: "John", LastName: "Doe", Password: "hash", AccountNumber: 1234567890, RoleID: models.UserRoleID}
+	jane := &models.Account{Email: "jane@mail.com", FirstName: "Jane", LastName: "Doe", Password: "hash", AccountNumber: 1234567891, RoleID: models.UserRoleID}
+	for _, account := range []*models.Account{john, jane} {
+		if err := accounts.Create(ctx, account); err != nil {
+			t.Fatalf("creating account: %v", err)
+		}
+	}
+	notifier := &recordingNotifier{}
+	handle := NotifyEvents(accounts, notifier)
+
+	event := func(eventType string, aggregateID uuid.UUID, payload any) events.Event {
+		data, _ := json.Marshal(payload)
+		return events.Event{ID: uuid.New(), Type: eventType, AggregateID: aggregateID, OccurredAt: time.Now(), Payload: data}
+	}
+	transfer := models.TransferCompleted{FromAccountID: john.ID, ToAccountID: jane.ID, Amount: 25, DebitEntryID: uuid.New(), CreditEntryID: uuid.New()}
+	completed := event(models.EventTransferCompleted, john.ID, transfer)
+	for _, e := range []events.Event{
+		event(models.EventAccountCreated, jane.ID, models.AccountCreated{AccountID: jane.ID}),
+		event(models.EventAccountActivated, jane.ID, models.AccountActivated{AccountID: jane.ID}),
+		completed,
+	} {
+		if err := handle(ctx, e); err != nil {
+			t.Fatalf("%s: %v", e.Type, err)
+		}
+	}
+
+	// activations aren't notified, a transfer is a receipt to each side
+	if len(notifier.sent) != 3 {
+		t.Fatalf("got %d notifications, want 3: %+v", len(notifier.sent), notifier.sent)
+	}
+	if n := notifier.sent[0]; n.AccountID != jane.ID || n.Event != models.EventAccountCreated {
+		t.Fatalf("welcome: got %+v", n)
+	}
+	sent, received := notifier.sent[1], notifier.sent[2]
+	if sent.AccountID != john.ID || sent.Event != EventTransferSent || sent.Data["counterparty_account_number"] != jane.AccountNumber || sent.Data["reference"] != transfer.DebitEntryID {
+		t.Fatalf("sent: got %+v", sent)
+	}
+	if received.AccountID != jane.ID || received.Event != EventTransferReceived || received.Data["counterparty_name"] != "John Doe" || received.Data["amount"] != 25.0 {
+		t.Fatalf("received: got %+v", received)
+	}
+
+	// an event relayed again notifies with the same IDs, so it's only saved once
+	if err := handle(ctx, completed); err != nil {
+		t.Fatalf("handle again: %v", err)
+	}
+	if again := notifier.sent[3]; again.ID != sent.ID || again.ID == received.ID || again.ID == uuid.Nil {
+		t.Fatalf("relayed again: got ID %s, want %s", again.ID, sent.ID)
+	}
+
+	// a balance adjustment is notified to its account by the entry's type
+	adjusted := models.BalanceAdjusted{AccountID: jane.ID, EntryID: uuid.New(), Type: models.Debit, Amount: 5, BalanceAfter: 20, Reason: "card fee"}
+	if err := handle(ctx, event(models.EventBalanceAdjusted, jane.ID, adjusted)); err != nil {
+		t.Fatalf("handle adjustment: %v", err)
+	}
+	if n := notifier.sent[5]; n.AccountID != jane.ID || n.Event != EventAccountDebited || n.Data["reason"] != "card fee" || n.Data["balance_after"] != 20.0 || n.Data["reference"] != adjusted.EntryID {
+		t.Fatalf("debited: got %+v", n)
+	}
+}
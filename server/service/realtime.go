@@ -0,0 +1,101 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Cprime50/Gopay/events"
+	models "github.com/Cprime50/Gopay/models/account"
+	"github.com/google/uuid"
+)
+
+// Types of realtime updates
+const (
+	UpdateBalance          = "balance"
+	UpdateTransferSent     = "transfer.sent"
+	UpdateTransferReceived = "transfer.received"
+	UpdatePasswordChanged  = "security.password_changed"
+)
+
+// UpdatePublisher pushes updates to an account's connected clients,
+// it's a realtime.Hub
+type UpdatePublisher interface {
+	Publish(ctx context.Context, accountID uuid.UUID, updateType string, data any) (string, error)
+}
+
+// BalanceUpdate is the account's balance after a change
+type BalanceUpdate struct {
+	Balance float64 `json:"balance"`
+}
+
+// TransferUpdate is one side of a transfer, Reference is the ledger
+// entry and identifies it if the update is pushed again
+type TransferUpdate struct {
+	Reference                 uuid.UUID `json:"reference"`
+	Amount                    float64   `json:"amount"`
+	CounterpartyName          string    `json:"counterparty_name"`
+	CounterpartyAccountNumber int64     `json:"counterparty_account_number"`
+	OccurredAt                time.Time `json:"occurred_at"`
+}
+
+// SecurityUpdate tells the account's clients about a change to its
+// security, their tokens stop working when the password changes
+type SecurityUpdate struct {
+	EventID    uuid.UUID `json:"event_id"`
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
+// PublishUpdates is an event bus subscriber pushing balance changes,
+// including adjustments, transfers and security events to the clients of the accounts they're
+// about. Events are delivered at least once, so an update may be pushed
+// again, balances are the latest when the event is handled
+func PublishUpdates(accounts models.AccountRepository, updates UpdatePublisher) events.Handler {
+	return func(ctx context.Context, event events.Event) error {
+		switch event.Type {
+		case models.EventPasswordChanged:
+			_, err := updates.Publish(ctx, event.AggregateID, UpdatePasswordChanged, SecurityUpdate{EventID: event.ID, OccurredAt: event.OccurredAt})
+			return err
+
+		case models.EventTransferCompleted:
+			transfer, err := events.Decode[models.TransferCompleted](event)
+			if err != nil {
+				return err
+			}
+			from, err := accounts.GetByID(ctx, transfer.FromAccountID)
+			if err != nil {
+				return err
+			}
+			to, err := accounts.GetByID(ctx, transfer.ToAccountID)
+			if err != nil {
+				return err
+			}
+			side := func(account *models.Account, update string, counterparty *models.Account, reference uuid.UUID) error {
+				if _, err := updates.Publish(ctx, account.ID, UpdateBalance, BalanceUpdate{Balance: account.Balance}); err != nil {
+					return err
+				}
+				_, err := updates.Publish(ctx, account.ID, update, TransferUpdate{
+					Reference:                 reference,
+					Amount:                    transfer.Amount,
+					CounterpartyName:          counterparty.FirstName + " " + counterparty.LastName,
+					CounterpartyAccountNumber: counterparty.AccountNumber,
+					OccurredAt:                event.OccurredAt,
+				})
+				return err
+			}
+			return errors.Join(
+				side(from, UpdateTransferSent, to, transfer.DebitEntryID),
+				side(to, UpdateTransferReceived, from, transfer.CreditEntryID),
+			)
+
+		case models.EventBalanceAdjusted:
+			account, err := accounts.GetByID(ctx, event.AggregateID)
+			if err != nil {
+				return err
+			}
+			_, err = updates.Publish(ctx, account.ID, UpdateBalance, BalanceUpdate{Balance: account.Balance})
+			return err
+		}
+		return nil
+	}
+}
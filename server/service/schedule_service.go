@@ -0,0 +1,610 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Cprime50/Gopay/config"
+	"github.com/Cprime50/Gopay/helper"
+	"github.com/Cprime50/Gopay/metrics"
+	models "github.com/Cprime50/Gopay/models/account"
+	"github.com/google/uuid"
+	"github.com/robfig/cron/v3"
+)
+
+// startGrace lets a schedule start a little in the past, so one created
+// to start "now" isn't rejected because of clock skew or a slow request
+const startGrace = time.Minute
+
+// maxNoteLength matches the note column
+const maxNoteLength = 140
+
+// cronParser parses standard 5 field specs. Descriptors such as
+// "@every 1s" aren't accepted, so a schedule runs at most once a minute
+var cronParser = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow)
+
+// ScheduleUpdate holds the fields of a schedule to change, nil ones are kept.
+// Changing when it runs restarts it from StartAt
+type ScheduleUpdate struct {
+	ToAccountNumber *int64
+	Amount          *float64
+	Note            *string
+	Frequency       *string
+	Cron            *string
+	StartAt         *time.Time
+	EndAt           *time.Time
+}
+
+// ScheduleService manages scheduled transfers and runs them when due.
+// A run that fails for a transient reason is retried with backoff, one
+// the sender can't afford is skipped and the sender notified. Transfers
+// to a saved beneficiary can't be due before its cool off ends, and
+// mark it used when they're made. With a cool off configured only saved
+// beneficiaries can be paid, so not saving one can't skip it
+type ScheduleService struct {
+	accounts      models.AccountRepository
+	schedules     models.ScheduleRepository
+	ledger        models.LedgerRepository
+	beneficiaries models.BeneficiaryRepository
+	notifier      Notifier
+	cfg           config.Scheduler
+	coolOffPeriod time.Duration
+	now           func() time.Time
+}
+
+// NewScheduleService returns a ScheduleService, notifier defaults to
+// LogNotifier. beneficiaryCfg sets the cool off on new recipients
+func NewScheduleService(accounts models.AccountRepository, schedules models.ScheduleRepository, ledger models.LedgerRepository, beneficiaries models.BeneficiaryRepository, notifier Notifier, cfg config.Scheduler, beneficiaryCfg config.Beneficiaries) *ScheduleService {
+	if notifier == nil {
+		notifier = LogNotifier{}
+	}
+	return &ScheduleService{
+		accounts:      accounts,
+		schedules:     schedules,
+		ledger:        ledger,
+		beneficiaries: beneficiaries,
+		notifier:      notifier,
+		cfg:           cfg,
+		coolOffPeriod: beneficiaryCfg.CoolOff,
+		now:           func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// Create validates and saves a new active schedule for schedule.AccountID
+func (s *ScheduleService) Create(ctx context.Context, schedule *models.ScheduledTransfer) error {
+	now := s.now()
+	if schedule.StartAt.IsZero() {
+		schedule.StartAt = now
+	}
+	if schedule.StartAt.Before(now.Add(-startGrace)) {
+		return helper.NewInvalidParam("start_at", "future", "must not be in the past")
+	}
+	if err := s.validate(ctx, schedule); err != nil {
+		return err
+	}
+	schedule.Status = models.ScheduleActive
+	if err := s.start(schedule, now); err != nil {
+		return err
+	}
+	if err := s.coolOff(ctx, schedule); err != nil {
+		return err
+	}
+	return s.schedules.Create(ctx, schedule)
+}
+
+// List returns the account's schedules, newest first
+func (s *ScheduleService) List(ctx context.Context, accountID uuid.UUID) ([]*models.ScheduledTransfer, error) {
+	return s.schedules.ListByAccount(ctx, accountID)
+}
+
+// Get returns one of the account's schedules, other accounts' are not found
+func (s *ScheduleService) Get(ctx context.Context, accountID uuid.UUID, id uuid.UUID) (*models.ScheduledTransfer, error) {
+	schedule, err := s.schedules.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if schedule.AccountID != accountID {
+		return nil, helper.NewNotFound("schedule", id.String())
+	}
+	return schedule, nil
+}
+
+// Update edits an active or paused schedule
+func (s *ScheduleService) Update(ctx context.Context, accountID uuid.UUID, id uuid.UUID, update ScheduleUpdate) (*models.ScheduledTransfer, error) {
+	schedule, err := s.editable(ctx, accountID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	recipient := schedule.ToAccountNumber
+	if update.ToAccountNumber != nil {
+		schedule.ToAccountNumber = *update.ToAccountNumber
+	}
+	if update.Amount != nil {
+		schedule.Amount = *update.Amount
+	}
+	if update.Note != nil {
+		schedule.Note = *update.Note
+	}
+	retimed := false
+	if update.Frequency != nil {
+		schedule.Frequency, retimed = *update.Frequency, true
+		if schedule.Frequency != models.Cron {
+			schedule.Cron = ""
+		}
+	}
+	if update.Cron != nil {
+		schedule.Cron, retimed = *update.Cron, true
+	}
+	if update.StartAt != nil {
+		if update.StartAt.Before(s.now().Add(-startGrace)) {
+			return nil, helper.NewInvalidParam("start_at", "future", "must not be in the past")
+		}
+		schedule.StartAt, retimed = *update.StartAt, true
+	}
+	if update.EndAt != nil {
+		schedule.EndAt, retimed = update.EndAt, true
+	}
+
+	if err := s.validate(ctx, schedule); err != nil {
+		return nil, err
+	}
+	if retimed {
+		if err := s.start(schedule, s.now()); err != nil {
+			return nil, err
+		}
+	}
+	if retimed || schedule.ToAccountNumber != recipient {
+		if err := s.coolOff(ctx, schedule); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.schedules.Update(ctx, schedule); err != nil {
+		return nil, err
+	}
+	return schedule, nil
+}
+
+// Pause stops an active schedule from running until it's resumed
+func (s *ScheduleService) Pause(ctx context.Context, accountID uuid.UUID, id uuid.UUID) (*models.ScheduledTransfer, error) {
+	schedule, err := s.Get(ctx, accountID, id)
+	if err != nil {
+		return nil, err
+	}
+	if schedule.Status != models.ScheduleActive {
+		return nil, helper.NewBadRequest(fmt.Sprintf("only active schedules can be paused, this one is %s", schedule.Status))
+	}
+	schedule.Status = models.SchedulePaused
+	schedule.NextRunAt = nil
+	schedule.Attempts = 0
+	if err := s.schedules.Update(ctx, schedule); err != nil {
+		return nil, err
+	}
+	return schedule, nil
+}
+
+// Resume restarts a paused schedule. Occurrences missed while it was
+// paused are skipped, not made up
+func (s *ScheduleService) Resume(ctx context.Context, accountID uuid.UUID, id uuid.UUID) (*models.ScheduledTransfer, error) {
+	schedule, err := s.Get(ctx, accountID, id)
+	if err != nil {
+		return nil, err
+	}
+	if schedule.Status != models.SchedulePaused {
+		return nil, helper.NewBadRequest(fmt.Sprintf("only paused schedules can be resumed, this one is %s", schedule.Status))
+	}
+	if _, err := s.parties(ctx, schedule); err != nil {
+		return nil, err
+	}
+	now := s.now()
+	schedule.Status = models.ScheduleActive
+	schedule.NextRunAt = schedule.DueAt
+	if schedule.DueAt == nil || schedule.DueAt.Before(now.Add(-startGrace)) {
+		s.advance(schedule, now)
+	}
+	if err := s.schedules.Update(ctx, schedule); err != nil {
+		return nil, err
+	}
+	return schedule, nil
+}
+
+// Cancel stops a schedule for good, it's kept for the record
+func (s *ScheduleService) Cancel(ctx context.Context, accountID uuid.UUID, id uuid.UUID) (*models.ScheduledTransfer, error) {
+	schedule, err := s.editable(ctx, accountID, id)
+	if err != nil {
+		return nil, err
+	}
+	schedule.Status = models.ScheduleCancelled
+	schedule.NextRunAt = nil
+	if err := s.schedules.Update(ctx, schedule); err != nil {
+		return nil, err
+	}
+	return schedule, nil
+}
+
+// Run runs due transfers every interval until ctx is done
+func (s *ScheduleService) Run(ctx context.Context) {
+	helper.Logger(ctx).Info("scheduled transfers worker started", "interval", s.cfg.Interval.String())
+	ticker := time.NewTicker(s.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		if _, err := s.RunDue(ctx); err != nil {
+			helper.Logger(ctx).Error("error running scheduled transfers", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			helper.Logger(ctx).Info("scheduled transfers worker stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunDue runs a batch of the transfers that are due, returning how many
+// it ran. Each is claimed first so concurrent workers don't run it twice
+func (s *ScheduleService) RunDue(ctx context.Context) (int, error) {
+	now := s.now()
+	due, err := s.schedules.Due(ctx, now, s.cfg.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	ran := 0
+	for _, schedule := range due {
+		if ctx.Err() != nil {
+			break
+		}
+		claimed, err := s.schedules.Claim(ctx, schedule, now.Add(s.cfg.Lease))
+		if err != nil {
+			return ran, err
+		}
+		if !claimed {
+			continue
+		}
+		// a run that has started is finished even if ctx is cancelled,
+		// so shutting down doesn't leave a transfer made but unrecorded
+		s.run(context.WithoutCancel(ctx), schedule, now)
+		ran++
+	}
+	return ran, nil
+}
+
+// run makes the transfer for the schedule's current occurrence and
+// moves it on to the next one, or retries it later
+func (s *ScheduleService) run(ctx context.Context, schedule *models.ScheduledTransfer, now time.Time) {
+	logger := helper.Logger(ctx).With("schedule_id", schedule.ID)
+	schedule.LastRunAt = &now
+
+	err := s.transfer(ctx, schedule)
+	var e *helper.Error
+	switch {
+	case err == nil:
+		logger.Info("scheduled transfer completed", "amount", schedule.Amount)
+		metrics.ObserveTransfer(models.RunCompleted, schedule.Amount)
+		if err := s.beneficiaries.MarkUsed(ctx, schedule.AccountID, schedule.ToAccountNumber, now); err != nil {
+			logger.Warn("error marking beneficiary used", "error", err)
+		}
+		s.finishRun(schedule, models.RunCompleted, "", now)
+
+	case errors.As(err, &e) && e.Code == helper.CodeInsufficientFunds:
+		logger.Info("scheduled transfer skipped, insufficient funds")
+		metrics.ObserveTransfer(models.RunSkipped, schedule.Amount)
+		s.notify(ctx, schedule, EventScheduledTransferSkipped, "insufficient funds")
+		s.finishRun(schedule, models.RunSkipped, "insufficient funds", now)
+
+	case helper.Status(err) < http.StatusInternalServerError:
+		// retrying won't help, eg the recipient's account is gone
+		logger.Warn("scheduled transfer paused", "error", err)
+		metrics.ObserveTransfer(models.RunFailed, schedule.Amount)
+		s.notify(ctx, schedule, EventScheduledTransferPaused, err.Error())
+		schedule.Status = models.SchedulePaused
+		schedule.NextRunAt = nil
+		schedule.Attempts = 0
+		schedule.LastStatus, schedule.LastError = models.RunFailed, truncate(err.Error(), 255)
+
+	default:
+		schedule.Attempts++
+		schedule.LastError = truncate(err.Error(), 255)
+		if schedule.Attempts < s.cfg.MaxAttempts {
+			retryAt := now.Add(s.cfg.RetryBackoff << (schedule.Attempts - 1))
+			logger.Warn("scheduled transfer failed, will retry", "attempt", schedule.Attempts, "retry_at", retryAt, "error", err)
+			schedule.NextRunAt = &retryAt
+			break
+		}
+		logger.Error("scheduled transfer failed, giving up on this occurrence", "attempts", schedule.Attempts, "error", err)
+		metrics.ObserveTransfer(models.RunFailed, schedule.Amount)
+		s.notify(ctx, schedule, EventScheduledTransferFailed, "the transfer could not be made")
+		s.finishRun(schedule, models.RunFailed, schedule.LastError, now)
+	}
+
+	if err := s.schedules.Update(ctx, schedule); err != nil {
+		// the owner changed it mid run, the ledger reference stops
+		// the transfer being made again when it next runs
+		logger.Warn("error saving scheduled transfer after running it", "error", err)
+	}
+}
+
+// transfer moves the money for the current occurrence. The ledger
+// references are derived from it, so a retry after a run that made
+// the transfer but failed to save the schedule is a no-op
+func (s *ScheduleService) transfer(ctx context.Context, schedule *models.ScheduledTransfer) error {
+	sender, err := s.accounts.GetByID(ctx, schedule.AccountID)
+	if err != nil {
+		return err
+	}
+	recipient, err := s.accounts.GetByAccountNum(ctx, schedule.ToAccountNumber)
+	if err != nil {
+		return err
+	}
+	// either account may have been deactivated, or the beneficiary
+	// deleted, since the schedule was made
+	if !sender.IsActive {
+		return helper.NewBadRequest("the sender's account isn't active")
+	}
+	if !recipient.IsActive {
+		return helper.NewBadRequest("the recipient's account isn't active")
+	}
+	if err := s.coolOff(ctx, schedule); err != nil {
+		return err
+	}
+
+	reference := fmt.Sprintf("schedule:%s:%d", schedule.ID, schedule.DueAt.Unix())
+	debitReference, creditReference := reference+":debit", reference+":credit"
+	actor := "schedule:" + schedule.ID.String()
+	debit := &models.LedgerEntry{
+		AccountID: sender.ID,
+		Type:      models.Debit,
+		Amount:    schedule.Amount,
+		Reason:    truncate(fmt.Sprintf("Scheduled transfer to %d %s", recipient.AccountNumber, schedule.Note), 255),
+		Actor:     actor,
+		Reference: &debitReference,
+	}
+	credit := &models.LedgerEntry{
+		AccountID: recipient.ID,
+		Type:      models.Credit,
+		Amount:    schedule.Amount,
+		Reason:    truncate(fmt.Sprintf("Scheduled transfer from %d %s", sender.AccountNumber, schedule.Note), 255),
+		Actor:     actor,
+		Reference: &creditReference,
+	}
+
+	err = s.ledger.Transfer(ctx, debit, credit)
+	if helper.Status(err) == http.StatusConflict {
+		// made by an earlier run
+		return nil
+	}
+	return err
+}
+
+// finishRun records the outcome of the current occurrence and moves on
+func (s *ScheduleService) finishRun(schedule *models.ScheduledTransfer, status string, lastError string, now time.Time) {
+	schedule.LastStatus, schedule.LastError = status, lastError
+	s.advance(schedule, now)
+}
+
+func (s *ScheduleService) notify(ctx context.Context, schedule *models.ScheduledTransfer, event string, reason string) {
+	err := s.notifier.Notify(ctx, Notification{
+		AccountID: schedule.AccountID,
+		Event:     event,
+		Data: map[string]any{
+			"schedule_id":       schedule.ID,
+			"to_account_number": schedule.ToAccountNumber,
+			"amount":            schedule.Amount,
+			"due_at":            schedule.DueAt,
+			"reason":            reason,
+		},
+	})
+	if err != nil {
+		helper.Logger(ctx).Error("error sending notification", "event", event, "error", err)
+	}
+}
+
+// editable returns the account's schedule if it can still be changed
+func (s *ScheduleService) editable(ctx context.Context, accountID uuid.UUID, id uuid.UUID) (*models.ScheduledTransfer, error) {
+	schedule, err := s.Get(ctx, accountID, id)
+	if err != nil {
+		return nil, err
+	}
+	if schedule.Status != models.ScheduleActive && schedule.Status != models.SchedulePaused {
+		return nil, helper.NewBadRequest(fmt.Sprintf("the schedule is %s and can't be changed", schedule.Status))
+	}
+	return schedule, nil
+}
+
+// validate checks the fields the owner sets, normalising them
+func (s *ScheduleService) validate(ctx context.Context, schedule *models.ScheduledTransfer) error {
+	if schedule.Amount <= 0 || math.IsNaN(schedule.Amount) || math.IsInf(schedule.Amount, 0) {
+		return helper.NewInvalidParam("amount", "gt", "must be greater than 0")
+	}
+	schedule.Amount = math.Round(schedule.Amount*100) / 100
+	schedule.Note = strings.TrimSpace(schedule.Note)
+	if len(schedule.Note) > maxNoteLength {
+		return helper.NewInvalidParam("note", "max", fmt.Sprintf("must be at most %d characters long", maxNoteLength))
+	}
+
+	switch schedule.Frequency {
+	case models.Once, models.Daily, models.Weekly, models.Monthly:
+		if schedule.Cron != "" {
+			return helper.NewInvalidParam("cron", "excluded_unless", "is only allowed with the cron frequency")
+		}
+	case models.Cron:
+		if _, err := cronParser.Parse(schedule.Cron); err != nil {
+			return helper.NewInvalidParam("cron", "cron", "must be a 5 field cron expression, eg 0 9 1 * *")
+		}
+	default:
+		return helper.NewInvalidParam("frequency", "oneof", "must be one of once daily weekly monthly cron")
+	}
+
+	schedule.StartAt = schedule.StartAt.UTC()
+	if schedule.EndAt != nil {
+		end := schedule.EndAt.UTC()
+		schedule.EndAt = &end
+		if !end.After(schedule.StartAt) {
+			return helper.NewInvalidParam("end_at", "gtfield", "must be after start_at")
+		}
+	}
+
+	recipient, err := s.parties(ctx, schedule)
+	if err != nil {
+		return err
+	}
+	if recipient.ID == schedule.AccountID {
+		return helper.NewInvalidParam("to_account_number", "ne", "must not be your own account")
+	}
+	return nil
+}
+
+// parties returns the schedule's recipient, failing unless it and the
+// sender both exist and are active
+func (s *ScheduleService) parties(ctx context.Context, schedule *models.ScheduledTransfer) (*models.Account, error) {
+	sender, err := s.accounts.GetByID(ctx, schedule.AccountID)
+	if err != nil {
+		return nil, err
+	}
+	if !sender.IsActive {
+		return nil, helper.NewBadRequest("your account isn't active, scheduled transfers can't be made from it")
+	}
+	recipient, err := s.accounts.GetByAccountNum(ctx, schedule.ToAccountNumber)
+	if err != nil {
+		if helper.Status(err) == http.StatusNotFound {
+			return nil, helper.NewInvalidParam("to_account_number", "exists", "no account has this number")
+		}
+		return nil, err
+	}
+	if !recipient.IsActive {
+		return nil, helper.NewInvalidParam("to_account_number", "active", "the account isn't active")
+	}
+	return recipient, nil
+}
+
+// coolOff fails if the recipient is a beneficiary the sender added so
+// recently its cool off hasn't ended by the time the transfer is due.
+// With a cool off configured it fails for a recipient that isn't a
+// beneficiary too, or paying the account number directly, or deleting
+// the beneficiary, would get round it
+func (s *ScheduleService) coolOff(ctx context.Context, schedule *models.ScheduledTransfer) error {
+	if schedule.DueAt == nil {
+		return nil
+	}
+	beneficiary, err := s.beneficiaries.GetByAccountNumber(ctx, schedule.AccountID, schedule.ToAccountNumber)
+	if helper.Status(err) == http.StatusNotFound {
+		if s.coolOffPeriod > 0 {
+			return helper.NewInvalidParam("to_account_number", "beneficiary", "must be a saved beneficiary, new recipients have a cool off")
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if schedule.DueAt.Before(beneficiary.AvailableAt) {
+		return helper.NewInvalidParam("start_at", "cool_off",
+			fmt.Sprintf("must not be before %s, when the cool off on the new beneficiary ends", beneficiary.AvailableAt.UTC().Format(time.RFC3339)))
+	}
+	return nil
+}
+
+// start (re)starts the schedule from its first occurrence, skipping any already past
+func (s *ScheduleService) start(schedule *models.ScheduledTransfer, now time.Time) error {
+	first, ok := occurrence(schedule, 0, time.Time{})
+	if !ok {
+		return helper.NewInvalidParam("end_at", "gtfield", "leaves no time for the transfer to run")
+	}
+	schedule.Runs, schedule.Attempts = 0, 0
+	schedule.DueAt, schedule.NextRunAt = &first, &first
+	if first.Before(now.Add(-startGrace)) {
+		s.advance(schedule, now)
+		if schedule.Status == models.ScheduleCompleted {
+			return helper.NewInvalidParam("start_at", "future", "leaves no occurrence in the future")
+		}
+	}
+	return nil
+}
+
+// advance moves the schedule past its current occurrence. Occurrences
+// already past, missed while the worker was down, are skipped
+func (s *ScheduleService) advance(schedule *models.ScheduledTransfer, now time.Time) {
+	schedule.Attempts = 0
+	prev := *schedule.DueAt
+	for {
+		schedule.Runs++
+		next, ok := occurrence(schedule, schedule.Runs, prev)
+		if !ok {
+			schedule.Status = models.ScheduleCompleted
+			schedule.NextRunAt = nil
+			return
+		}
+		if !next.Before(now) {
+			schedule.DueAt, schedule.NextRunAt = &next, &next
+			return
+		}
+		prev = next
+		if schedule.Frequency == models.Cron {
+			// cron occurrences aren't numbered, jump straight to now
+			prev = now.Add(-time.Second)
+		}
+	}
+}
+
+// occurrence returns the schedule's nth occurrence counting from 0, prev
+// is occurrence n-1 and is only used by cron schedules. It reports false
+// when there is none, the schedule runs once or has ended
+func occurrence(schedule *models.ScheduledTransfer, n int, prev time.Time) (time.Time, bool) {
+	var at time.Time
+	switch schedule.Frequency {
+	case models.Once:
+		if n > 0 {
+			return time.Time{}, false
+		}
+		at = schedule.StartAt
+	case models.Daily:
+		at = schedule.StartAt.AddDate(0, 0, n)
+	case models.Weekly:
+		at = schedule.StartAt.AddDate(0, 0, 7*n)
+	case models.Monthly:
+		at = addMonths(schedule.StartAt, n)
+	case models.Cron:
+		spec, err := cronParser.Parse(schedule.Cron)
+		if err != nil {
+			return time.Time{}, false
+		}
+		if n == 0 {
+			prev = schedule.StartAt.Add(-time.Second)
+		}
+		at = spec.Next(prev)
+		if at.IsZero() {
+			return time.Time{}, false
+		}
+	default:
+		return time.Time{}, false
+	}
+	if schedule.EndAt != nil && at.After(*schedule.EndAt) {
+		return time.Time{}, false
+	}
+	return at, true
+}
+
+// addMonths adds n months to t keeping its day of the month, or the last
+// day of shorter months, so a schedule starting on the 31st runs on the
+// 30th in April rather than drifting into May
+func addMonths(t time.Time, n int) time.Time {
+	year, month, day := t.Date()
+	firstOfMonth := time.Date(year, month+time.Month(n), 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	lastDay := firstOfMonth.AddDate(0, 1, -1).Day()
+	if day > lastDay {
+		day = lastDay
+	}
+	return firstOfMonth.AddDate(0, 0, day-1)
+}
+
+// truncate cuts s to at most n bytes
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
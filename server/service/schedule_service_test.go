@@ -0,0 +1,348 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Cprime50/Gopay/config"
+	"github.com/Cprime50/Gopay/helper"
+	models "github.com/Cprime50/Gopay/models/account"
+)
+
+// recordingNotifier keeps the notifications it's sent
+type recordingNotifier struct {
+	sent []Notification
+}
+
+func (n *recordingNotifier) Notify(ctx context.Context, notification Notification) error {
+	n.sent = append(n.sent, notification)
+	return nil
+}
+
+// flakyLedger fails transfers with err while it's set
+type flakyLedger struct {
+	models.LedgerRepository
+	err error
+}
+
+func (l *flakyLedger) Transfer(ctx context.Context, debit *models.LedgerEntry, credit *models.LedgerEntry) error {
+	if l.err != nil {
+		return l.err
+	}
+	return l.LedgerRepository.Transfer(ctx, debit, credit)
+}
+
+type scheduleFixture struct {
+	service       *ScheduleService
+	accounts      models.AccountRepository
+	ledger        *flakyLedger
+	beneficiaries models.BeneficiaryRepository
+	notifier      *recordingNotifier
+	from, to      *models.Account
+	now           time.Time
+}
+
+func newScheduleFixture(t *testing.T) *scheduleFixture {
+	t.Helper()
+	ctx := context.Background()
+	accounts := models.NewMemoryAccountRepository()
+	f := &scheduleFixture{
+		accounts:      accounts,
+		ledger:        &flakyLedger{LedgerRepository: models.NewMemoryLedgerRepository(accounts)},
+		beneficiaries: models.NewMemoryBeneficiaryRepository(),
+		notifier:      &recordingNotifier{},
+		now:           time.Date(2024, time.January, 31, 9, 0, 0, 0, time.UTC),
+	}
+	f.service = NewScheduleService(accounts, models.NewMemoryScheduleRepository(), f.ledger, f.beneficiaries, f.notifier, config.Default().Scheduler, config.Default().Beneficiaries)
+	f.service.now = func() time.Time { return f.now }
+
+	for i, email := range []string{"john@mail.com", "jane@mail.com"} {
+		account := &models.Account{
+			Email:         email,
+			FirstName:     "John",
+			LastName:      "Doe",
+			Password:      "hash",
+			AccountNumber: int64(1234567890 + i),
+			Balance:       100,
+			RoleID:        models.UserRoleID,
+			IsActive:      true,
+		}
+		if err := accounts.Create(ctx, account); err != nil {
+			t.Fatalf("creating account: %v", err)
+		}
+	}
+	f.from, _ = accounts.GetByEmail(ctx, "john@mail.com")
+	f.to, _ = accounts.GetByEmail(ctx, "jane@mail.com")
+	return f
+}
+
+// create schedules amount monthly from now, failing the test on error
+func (f *scheduleFixture) create(t *testing.T, amount float64) *models.ScheduledTransfer {
+	t.Helper()
+	schedule := &models.ScheduledTransfer{
+		AccountID:       f.from.ID,
+		ToAccountNumber: f.to.AccountNumber,
+		Amount:          amount,
+		Frequency:       models.Monthly,
+		StartAt:         f.now,
+	}
+	if err := f.service.Create(context.Background(), schedule); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	return schedule
+}
+
+// runDue runs due schedules and returns the schedule's new state
+func (f *scheduleFixture) runDue(t *testing.T, schedule *models.ScheduledTransfer) *models.ScheduledTransfer {
+	t.Helper()
+	if _, err := f.service.RunDue(context.Background()); err != nil {
+		t.Fatalf("run due: %v", err)
+	}
+	got, err := f.service.Get(context.Background(), f.from.ID, schedule.ID)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	return got
+}
+
+func (f *scheduleFixture) balance(t *testing.T, account *models.Account) float64 {
+	t.Helper()
+	got, err := f.accounts.GetByID(context.Background(), account.ID)
+	if err != nil {
+		t.Fatalf("get account: %v", err)
+	}
+	return got.Balance
+}
+
+func TestScheduledTransferRuns(t *testing.T) {
+	f := newScheduleFixture(t)
+	schedule := f.create(t, 30)
+
+	got := f.runDue(t, schedule)
+	if f.balance(t, f.from) != 70 || f.balance(t, f.to) != 130 {
+		t.Fatalf("balances after run: %v and %v", f.balance(t, f.from), f.balance(t, f.to))
+	}
+	// started on the 31st, so february's run is on its last day
+	want := time.Date(2024, time.February, 29, 9, 0, 0, 0, time.UTC)
+	if got.LastStatus != models.RunCompleted || got.Runs != 1 || !got.NextRunAt.Equal(want) {
+		t.Fatalf("after run: %+v", got)
+	}
+
+	// nothing runs again until it's due
+	if ran, _ := f.service.RunDue(context.Background()); ran != 0 {
+		t.Fatalf("ran %d schedules before they were due", ran)
+	}
+
+	// march goes back to the 31st, and a run the sender can't afford
+	// is skipped with a notification rather than retried
+	f.now = want
+	f.runDue(t, schedule)
+	f.now = time.Date(2024, time.March, 31, 9, 0, 0, 0, time.UTC)
+	f.runDue(t, schedule)
+	f.now = time.Date(2024, time.April, 30, 9, 0, 0, 0, time.UTC)
+	got = f.runDue(t, schedule)
+	if got.LastStatus != models.RunSkipped || got.Runs != 4 || got.Attempts != 0 {
+		t.Fatalf("after skipped run: %+v", got)
+	}
+	if f.balance(t, f.from) != 10 {
+		t.Fatalf("balance after skipped run: %v", f.balance(t, f.from))
+	}
+	if len(f.notifier.sent) != 1 || f.notifier.sent[0].Event != EventScheduledTransferSkipped || f.notifier.sent[0].AccountID != f.from.ID {
+		t.Fatalf("notifications: %+v", f.notifier.sent)
+	}
+}
+
+func TestScheduledTransferRetries(t *testing.T) {
+	f := newScheduleFixture(t)
+	cfg := f.service.cfg
+	schedule := f.create(t, 30)
+
+	f.ledger.err = helper.NewInternal()
+	for attempt := 1; attempt < cfg.MaxAttempts; attempt++ {
+		got := f.runDue(t, schedule)
+		retryAt := f.now.Add(cfg.RetryBackoff << (attempt - 1))
+		if got.Attempts != attempt || got.Status != models.ScheduleActive || !got.NextRunAt.Equal(retryAt) {
+			t.Fatalf("attempt %d: %+v", attempt, got)
+		}
+		f.now = retryAt
+	}
+
+	// the last attempt gives up on the occurrence and moves to the next
+	got := f.runDue(t, schedule)
+	if got.LastStatus != models.RunFailed || got.Attempts != 0 || got.Runs != 1 {
+		t.Fatalf("after giving up: %+v", got)
+	}
+	if len(f.notifier.sent) != 1 || f.notifier.sent[0].Event != EventScheduledTransferFailed {
+		t.Fatalf("notifications: %+v", f.notifier.sent)
+	}
+	if f.balance(t, f.from) != 100 {
+		t.Fatalf("balance after failed runs: %v", f.balance(t, f.from))
+	}
+
+	// a recipient that's gone won't come back by retrying, so the schedule is paused
+	f.ledger.err = helper.NewNotFound("account", f.to.ID.String())
+	f.now = *got.NextRunAt
+	got = f.runDue(t, schedule)
+	if got.Status != models.SchedulePaused || got.NextRunAt != nil {
+		t.Fatalf("after recipient removed: %+v", got)
+	}
+	if last := f.notifier.sent[len(f.notifier.sent)-1]; last.Event != EventScheduledTransferPaused {
+		t.Fatalf("notification: %+v", last)
+	}
+}
+
+func TestScheduleLifecycle(t *testing.T) {
+	ctx := context.Background()
+	f := newScheduleFixture(t)
+	schedule := f.create(t, 30)
+
+	// other accounts can't see or change it
+	if _, err := f.service.Pause(ctx, f.to.ID, schedule.ID); helper.Status(err) != http.StatusNotFound {
+		t.Fatalf("pause by another account: got %v, want not found", err)
+	}
+
+	paused, err := f.service.Pause(ctx, f.from.ID, schedule.ID)
+	if err != nil || paused.Status != models.SchedulePaused {
+		t.Fatalf("pause: got %+v, %v", paused, err)
+	}
+	if ran, _ := f.service.RunDue(ctx); ran != 0 {
+		t.Fatalf("ran %d paused schedules", ran)
+	}
+	if _, err := f.service.Pause(ctx, f.from.ID, schedule.ID); helper.Status(err) != http.StatusBadRequest {
+		t.Fatalf("pause twice: got %v, want bad request", err)
+	}
+
+	// occurrences missed while paused are skipped
+	f.now = time.Date(2024, time.March, 15, 9, 0, 0, 0, time.UTC)
+	resumed, err := f.service.Resume(ctx, f.from.ID, schedule.ID)
+	want := time.Date(2024, time.March, 31, 9, 0, 0, 0, time.UTC)
+	if err != nil || resumed.Status != models.ScheduleActive || !resumed.NextRunAt.Equal(want) {
+		t.Fatalf("resume: got %+v, %v", resumed, err)
+	}
+
+	// retiming restarts it
+	daily, start := models.Daily, f.now.Add(time.Hour)
+	updated, err := f.service.Update(ctx, f.from.ID, schedule.ID, ScheduleUpdate{Frequency: &daily, StartAt: &start})
+	if err != nil || updated.Frequency != models.Daily || !updated.NextRunAt.Equal(start) || updated.Runs != 0 {
+		t.Fatalf("update: got %+v, %v", updated, err)
+	}
+	own := f.from.AccountNumber
+	if _, err := f.service.Update(ctx, f.from.ID, schedule.ID, ScheduleUpdate{ToAccountNumber: &own}); helper.Status(err) != http.StatusBadRequest {
+		t.Fatalf("update to own account: got %v, want bad request", err)
+	}
+
+	cancelled, err := f.service.Cancel(ctx, f.from.ID, schedule.ID)
+	if err != nil || cancelled.Status != models.ScheduleCancelled || cancelled.NextRunAt != nil {
+		t.Fatalf("cancel: got %+v, %v", cancelled, err)
+	}
+	if _, err := f.service.Update(ctx, f.from.ID, schedule.ID, ScheduleUpdate{}); helper.Status(err) != http.StatusBadRequest {
+		t.Fatalf("update cancelled: got %v, want bad request", err)
+	}
+}
+
+func TestScheduleInactiveAccounts(t *testing.T) {
+	ctx := context.Background()
+	f := newScheduleFixture(t)
+	schedule := f.create(t, 30)
+	setActive := func(account *models.Account, active bool) {
+		t.Helper()
+		if err := f.accounts.ChangeStatus(ctx, &models.Account{ID: account.ID, IsActive: active}); err != nil {
+			t.Fatalf("change status: %v", err)
+		}
+	}
+
+	// a recipient deactivated since the schedule was made pauses it
+	setActive(f.to, false)
+	got := f.runDue(t, schedule)
+	if got.Status != models.SchedulePaused || f.balance(t, f.from) != 100 {
+		t.Fatalf("run to an inactive recipient: %+v", got)
+	}
+	if last := f.notifier.sent[len(f.notifier.sent)-1]; last.Event != EventScheduledTransferPaused {
+		t.Fatalf("notification: %+v", last)
+	}
+	if _, err := f.service.Resume(ctx, f.from.ID, schedule.ID); helper.Status(err) != http.StatusBadRequest {
+		t.Fatalf("resume to an inactive recipient: got %v, want bad request", err)
+	}
+	setActive(f.to, true)
+	if _, err := f.service.Resume(ctx, f.from.ID, schedule.ID); err != nil {
+		t.Fatalf("resume: %v", err)
+	}
+
+	// an inactive sender can't create or resume schedules, nor run them
+	setActive(f.from, false)
+	another := &models.ScheduledTransfer{AccountID: f.from.ID, ToAccountNumber: f.to.AccountNumber, Amount: 30, Frequency: models.Once, StartAt: f.now}
+	if err := f.service.Create(ctx, another); helper.Status(err) != http.StatusBadRequest {
+		t.Fatalf("create from an inactive account: got %v, want bad request", err)
+	}
+	f.now = f.now.AddDate(0, 1, 0)
+	if got := f.runDue(t, schedule); got.Status != models.SchedulePaused || f.balance(t, f.from) != 100 {
+		t.Fatalf("run from an inactive sender: %+v", got)
+	}
+	if _, err := f.service.Resume(ctx, f.from.ID, schedule.ID); helper.Status(err) != http.StatusBadRequest {
+		t.Fatalf("resume from an inactive account: got %v, want bad request", err)
+	}
+}
+
+func TestScheduleValidation(t *testing.T) {
+	f := newScheduleFixture(t)
+	end := f.now.Add(-time.Hour)
+	for name, schedule := range map[string]models.ScheduledTransfer{
+		"no amount":         {Frequency: models.Once},
+		"unknown frequency": {Amount: 1, Frequency: "yearly"},
+		"bad cron":          {Amount: 1, Frequency: models.Cron, Cron: "every day"},
+		"cron descriptor":   {Amount: 1, Frequency: models.Cron, Cron: "@every 1s"},
+		"cron without cron": {Amount: 1, Frequency: models.Daily, Cron: "0 9 * * *"},
+		"in the past":       {Amount: 1, Frequency: models.Once, StartAt: f.now.Add(-time.Hour)},
+		"ends before start": {Amount: 1, Frequency: models.Daily, EndAt: &end},
+		"unknown recipient": {Amount: 1, Frequency: models.Once, ToAccountNumber: 1},
+	} {
+		schedule.AccountID = f.from.ID
+		if schedule.ToAccountNumber == 0 {
+			schedule.ToAccountNumber = f.to.AccountNumber
+		}
+		if err := f.service.Create(context.Background(), &schedule); helper.Status(err) != http.StatusBadRequest {
+			t.Errorf("%s: got %v, want bad request", name, err)
+		}
+	}
+}
+
+func TestOccurrence(t *testing.T) {
+	start := time.Date(2024, time.January, 31, 9, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 0, 14)
+	weekly := &models.ScheduledTransfer{Frequency: models.Weekly, StartAt: start, EndAt: &end}
+	for n, want := range []time.Time{start, start.AddDate(0, 0, 7), start.AddDate(0, 0, 14)} {
+		if got, ok := occurrence(weekly, n, time.Time{}); !ok || !got.Equal(want) {
+			t.Fatalf("weekly occurrence %d: got %v, %v", n, got, ok)
+		}
+	}
+	if _, ok := occurrence(weekly, 3, time.Time{}); ok {
+		t.Fatal("weekly occurrence after end_at")
+	}
+
+	// 9am on the first of every month
+	monthly := &models.ScheduledTransfer{Frequency: models.Cron, Cron: "0 9 1 * *", StartAt: start}
+	first, ok := occurrence(monthly, 0, time.Time{})
+	if want := time.Date(2024, time.February, 1, 9, 0, 0, 0, time.UTC); !ok || !first.Equal(want) {
+		t.Fatalf("first cron occurrence: got %v, %v", first, ok)
+	}
+	second, ok := occurrence(monthly, 1, first)
+	if want := time.Date(2024, time.March, 1, 9, 0, 0, 0, time.UTC); !ok || !second.Equal(want) {
+		t.Fatalf("second cron occurrence: got %v, %v", second, ok)
+	}
+
+	for _, c := range []struct {
+		t    time.Time
+		n    int
+		want time.Time
+	}{
+		{start, 1, time.Date(2024, time.February, 29, 9, 0, 0, 0, time.UTC)},
+		{start, 13, time.Date(2025, time.February, 28, 9, 0, 0, 0, time.UTC)},
+		{time.Date(2024, time.March, 15, 0, 0, 0, 0, time.UTC), -1, time.Date(2024, time.February, 15, 0, 0, 0, 0, time.UTC)},
+	} {
+		if got := addMonths(c.t, c.n); !got.Equal(c.want) {
+			t.Errorf("addMonths(%v, %d): got %v, want %v", c.t, c.n, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,349 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Cprime50/Gopay/config"
+	"github.com/Cprime50/Gopay/events"
+	"github.com/Cprime50/Gopay/helper"
+	"github.com/Cprime50/Gopay/i18n"
+	"github.com/Cprime50/Gopay/metrics"
+	models "github.com/Cprime50/Gopay/models/account"
+	"github.com/Cprime50/Gopay/queue"
+	"github.com/Cprime50/Gopay/sms"
+	"github.com/google/uuid"
+)
+
+// otpPhone is the purpose of the codes verifying a phone number
+const otpPhone = "phone"
+
+// Kinds of texts
+const (
+	SMSOTP   = "otp"
+	SMSAlert = "alert"
+)
+
+// smsJob sends a text in the background. OTPs are counted against the
+// account's budget when requested, alerts when they're sent
+type smsJob struct {
+	AccountID uuid.UUID `json:"account_id"`
+	Kind      string    `json:"kind"`
+	To        string    `json:"to"`
+	Body      string    `json:"body"`
+}
+
+// SMSJob texts an account holder, failed attempts are retried by the queue
+var SMSJob = queue.NewType[smsJob]("sms", "sms.send")
+
+// smsAlertTTL is how long a sent alert is remembered, so an event
+// delivered again by the relay isn't texted twice
+const smsAlertTTL = 7 * 24 * time.Hour
+
+// SMSService verifies account holders' phone numbers with one time codes
+// and texts accounts that opted in to SMS alerts about the categories of
+// events they chose texts for. Texts are billed per segment so each
+// account has a daily budget of them
+type SMSService struct {
+	accounts      models.AccountRepository
+	otps          models.OTPRepository
+	usage         models.SMSUsageRepository
+	notifications models.NotificationRepository
+	jobs          *queue.Queue
+	provider      sms.Provider
+	cfg           config.SMS
+	now           func() time.Time
+}
+
+// NewSMSService returns an SMSService, provider defaults to sms.Log.
+// notifications holds the channels accounts chose for each category
+func NewSMSService(accounts models.AccountRepository, otps models.OTPRepository, usage models.SMSUsageRepository, notifications models.NotificationRepository, jobs *queue.Queue, provider sms.Provider, cfg config.SMS) *SMSService {
+	if provider == nil {
+		provider = sms.Log{}
+	}
+	return &SMSService{
+		accounts:      accounts,
+		otps:          otps,
+		usage:         usage,
+		notifications: notifications,
+		jobs:          jobs,
+		provider:      provider,
+		cfg:           cfg,
+		now:           func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// SetPhone texts phone a code to verify it with. The number is only kept
+// with the code until VerifyPhone swaps it in, so the account's current
+// number stays verified and alerted meanwhile. Calling it again sends a
+// new code, once the cooldown is over, replacing the pending number
+func (s *SMSService) SetPhone(ctx context.Context, accountID uuid.UUID, phone string) (*models.Account, error) {
+	if !sms.ValidPhone(phone) {
+		return nil, helper.NewInvalidParam("phone", "e164", "must be an E.164 number, eg +2348012345678")
+	}
+	account, err := s.accounts.GetByID(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+	if account.PhoneVerified() && *account.Phone == phone {
+		return nil, helper.NewBadRequest("the phone number is already verified")
+	}
+
+	pending, err := s.otps.GetOTP(ctx, otpPhone, accountID)
+	switch {
+	case err == nil:
+		if wait := pending.SentAt.Add(s.cfg.OTPCooldown).Sub(s.now()); wait > 0 {
+			return nil, helper.NewTooManyRequests(wait)
+		}
+	case helper.Status(err) != http.StatusNotFound:
+		return nil, err
+	}
+
+	code, err := newOTP()
+	if err != nil {
+		helper.Logger(ctx).Error("error generating otp", "error", err)
+		return nil, helper.NewInternal()
+	}
+	body := i18n.T(account.Locale, "sms_otp", map[string]string{
+		"code":    code,
+		"minutes": strconv.Itoa(int(s.cfg.OTPTTL.Minutes())),
+	})
+	// codes are paid for up front so an account over budget is told now
+	allowed, err := s.usage.AddSegments(ctx, accountID, s.now(), sms.Segments(body), s.cfg.DailySegments)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		metrics.ObserveSMS(SMSOTP, metrics.SMSThrottled)
+		return nil, helper.NewTooManyRequests(s.untilTomorrow())
+	}
+
+	otp := &models.OTP{Hash: hashOTP(accountID, code), Target: phone, SentAt: s.now()}
+	if err := s.otps.SaveOTP(ctx, otpPhone, accountID, otp, s.cfg.OTPTTL); err != nil {
+		return nil, err
+	}
+	_, err = SMSJob.Enqueue(ctx, s.jobs, smsJob{AccountID: accountID, Kind: SMSOTP, To: phone, Body: body}, queue.MaxAttempts(3))
+	if err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+// VerifyPhone checks the code texted by SetPhone, making the number it was
+// sent to the account's verified one. Alerts stay as they were, going to
+// the new number. A code can only be guessed OTPMaxAttempts times
+func (s *SMSService) VerifyPhone(ctx context.Context, accountID uuid.UUID, code string) (*models.Account, error) {
+	invalid := helper.NewBadRequest("the code is wrong or has expired").WithCode(helper.CodeInvalidOTP)
+	otp, err := s.otps.GetOTP(ctx, otpPhone, accountID)
+	if helper.Status(err) == http.StatusNotFound {
+		return nil, invalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	if otp.Attempts >= s.cfg.OTPMaxAttempts {
+		return nil, invalid
+	}
+	if subtle.ConstantTimeCompare([]byte(otp.Hash), []byte(hashOTP(accountID, code))) != 1 {
+		attempts, err := s.otps.AddOTPAttempt(ctx, otpPhone, accountID)
+		if err != nil {
+			return nil, err
+		}
+		if attempts >= s.cfg.OTPMaxAttempts {
+			helper.Logger(ctx).Warn("otp guessed too often", "account_id", accountID)
+			if err := s.otps.DeleteOTP(ctx, otpPhone, accountID); err != nil {
+				return nil, err
+			}
+		}
+		return nil, invalid
+	}
+
+	account, err := s.accounts.GetByID(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.otps.DeleteOTP(ctx, otpPhone, accountID); err != nil {
+		return nil, err
+	}
+	now := s.now()
+	account.Phone, account.PhoneVerifiedAt = &otp.Target, &now
+	if err := s.accounts.UpdatePhone(ctx, account); err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+// SetAlerts turns the account's texts on or off, they need a verified
+// phone number. Which categories are texted is a notification preference
+func (s *SMSService) SetAlerts(ctx context.Context, accountID uuid.UUID, enabled bool) (*models.Account, error) {
+	account, err := s.accounts.GetByID(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+	if enabled && !account.PhoneVerified() {
+		return nil, helper.NewBadRequest("verify a phone number before turning on SMS alerts").WithCode(helper.CodePhoneNotVerified)
+	}
+	account.SMSAlerts = enabled
+	if err := s.accounts.UpdatePhone(ctx, account); err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+// HandleEvent texts opted in accounts about events of the categories
+// they chose texts for: a security alert when their password changes,
+// and a debit and a credit alert for a transfer or a balance adjustment
+// of at least MinAlertAmount. It's an event bus subscriber, an event seen again
+// isn't texted again
+func (s *SMSService) HandleEvent(ctx context.Context, event events.Event) error {
+	switch event.Type {
+	case models.EventPasswordChanged:
+		account, err := s.accounts.GetByID(ctx, event.AggregateID)
+		if err != nil {
+			return err
+		}
+		return s.alert(ctx, event, account, models.CategorySecurity, i18n.T(account.Locale, "sms_password_changed", nil))
+
+	case models.EventTransferCompleted:
+		transfer, err := events.Decode[models.TransferCompleted](event)
+		if err != nil {
+			return err
+		}
+		if transfer.Amount < s.cfg.MinAlertAmount {
+			return nil
+		}
+		from, err := s.accounts.GetByID(ctx, transfer.FromAccountID)
+		if err != nil {
+			return err
+		}
+		to, err := s.accounts.GetByID(ctx, transfer.ToAccountID)
+		if err != nil {
+			return err
+		}
+		return errors.Join(
+			s.alert(ctx, event, from, models.CategoryTransactions, transferAlert(event, from, "sms_debit_alert", to, transfer)),
+			s.alert(ctx, event, to, models.CategoryTransactions, transferAlert(event, to, "sms_credit_alert", from, transfer)),
+		)
+
+	case models.EventBalanceAdjusted:
+		adjusted, err := events.Decode[models.BalanceAdjusted](event)
+		if err != nil {
+			return err
+		}
+		if adjusted.Amount < s.cfg.MinAlertAmount {
+			return nil
+		}
+		account, err := s.accounts.GetByID(ctx, adjusted.AccountID)
+		if err != nil {
+			return err
+		}
+		message := "sms_account_credited"
+		if adjusted.Type == models.Debit {
+			message = "sms_account_debited"
+		}
+		return s.alert(ctx, event, account, models.CategoryTransactions, i18n.T(account.Locale, message, map[string]string{
+			"amount":    fmt.Sprintf("%.2f", adjusted.Amount),
+			"reason":    adjusted.Reason,
+			"account":   helper.MaskAccountNumber(strconv.FormatInt(account.AccountNumber, 10)),
+			"reference": event.ID.String()[:8],
+		}))
+	}
+	return nil
+}
+
+// alert queues a text of body to the account about event, unless it
+// hasn't opted in to texts of category or has been sent it already
+func (s *SMSService) alert(ctx context.Context, event events.Event, account *models.Account, category string, body string) error {
+	if !account.SMSAlerts || !account.PhoneVerified() {
+		return nil
+	}
+	preference, err := preferenceFor(ctx, s.notifications, account.ID, category)
+	if err != nil || !preference.SMS {
+		return err
+	}
+	key := event.ID.String() + ":" + account.ID.String()
+	sent, err := s.usage.Sent(ctx, key)
+	if err != nil || sent {
+		return err
+	}
+	// marked only once it's queued, so a failure to queue it is retried
+	// with the event rather than losing the text
+	if _, err := SMSJob.Enqueue(ctx, s.jobs, smsJob{AccountID: account.ID, Kind: SMSAlert, To: *account.Phone, Body: body}); err != nil {
+		return err
+	}
+	return s.usage.MarkSent(ctx, key, smsAlertTTL)
+}
+
+// transferAlert is the account's text about its side of transfer
+func transferAlert(event events.Event, account *models.Account, message string, counterparty *models.Account, transfer models.TransferCompleted) string {
+	return i18n.T(account.Locale, message, map[string]string{
+		"amount":       fmt.Sprintf("%.2f", transfer.Amount),
+		"counterparty": counterparty.FirstName + " " + counterparty.LastName,
+		"account":      helper.MaskAccountNumber(strconv.FormatInt(account.AccountNumber, 10)),
+		"reference":    event.ID.String()[:8],
+	})
+}
+
+// HandleSMS has w send queued texts
+func (s *SMSService) HandleSMS(w *queue.Worker) {
+	SMSJob.Handle(w, s.send)
+}
+
+// send texts job, dropping alerts over the account's daily budget.
+// Texts the provider rejects aren't retried
+func (s *SMSService) send(ctx context.Context, job smsJob) error {
+	if job.Kind == SMSAlert {
+		allowed, err := s.usage.AddSegments(ctx, job.AccountID, s.now(), sms.Segments(job.Body), s.cfg.DailySegments)
+		if err != nil {
+			return err
+		}
+		if !allowed {
+			helper.Logger(ctx).Info("sms alert over the daily budget", "account_id", job.AccountID)
+			metrics.ObserveSMS(job.Kind, metrics.SMSThrottled)
+			return nil
+		}
+	}
+
+	err := s.provider.Send(ctx, &sms.Message{To: job.To, From: s.cfg.Sender, Body: job.Body})
+	switch {
+	case errors.Is(err, sms.ErrRejected):
+		metrics.ObserveSMS(job.Kind, metrics.SMSFailed)
+		return queue.Permanent(err)
+	case err != nil:
+		metrics.ObserveSMS(job.Kind, metrics.SMSFailed)
+		return err
+	}
+	metrics.ObserveSMS(job.Kind, metrics.SMSSent)
+	return nil
+}
+
+// untilTomorrow is how long until the daily budgets reset, at midnight UTC
+func (s *SMSService) untilTomorrow() time.Duration {
+	now := s.now()
+	return now.Truncate(24 * time.Hour).Add(24 * time.Hour).Sub(now)
+}
+
+// newOTP returns a random 6 digit code
+func newOTP() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+// hashOTP is how a code is stored, salted with the account so equal
+// codes of different accounts don't hash the same
+func hashOTP(accountID uuid.UUID, code string) string {
+	sum := sha256.Sum256([]byte(accountID.String() + ":" + code))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,330 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Cprime50/Gopay/config"
+	"github.com/Cprime50/Gopay/events"
+	"github.com/Cprime50/Gopay/helper"
+	models "github.com/Cprime50/Gopay/models/account"
+	"github.com/Cprime50/Gopay/queue"
+	"github.com/Cprime50/Gopay/sms"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+// recordingProvider keeps the texts it's sent, failing with err while it's set
+type recordingProvider struct {
+	sent []sms.Message
+	err  error
+}
+
+func (p *recordingProvider) Send(ctx context.Context, msg *sms.Message) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.sent = append(p.sent, *msg)
+	return nil
+}
+
+type smsFixture struct {
+	service       *SMSService
+	accounts      models.AccountRepository
+	notifications models.NotificationRepository
+	jobs          *queue.Queue
+	worker        *queue.Worker
+	provider      *recordingProvider
+	now           time.Time
+}
+
+func newSMSFixture(t *testing.T, cfg config.SMS) *smsFixture {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+
+	f := &smsFixture{
+		accounts:      models.NewMemoryAccountRepository(),
+		notifications: models.NewMemoryNotificationRepository(),
+		jobs:          queue.New(rdb, config.Default().Jobs),
+		provider:      &recordingProvider{},
+		now:           time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+	}
+	f.service = NewSMSService(f.accounts, models.NewOTPRepository(rdb), models.NewSMSUsageRepository(rdb), f.notifications, f.jobs, f.provider, cfg)
+	f.service.now = func() time.Time { return f.now }
+	f.worker = f.jobs.NewWorker()
+	f.service.HandleSMS(f.worker)
+	return f
+}
+
+// account creates an account, with a verified phone and alerts on if phone isn't empty
+func (f *smsFixture) account(t *testing.T, email string, phone string) *models.Account {
+	t.Helper()
+	ctx := context.Background()
+	account := &models.Account{Email: email, FirstName: "John", LastName: "Doe", AccountNumber: time.Now().UnixNano() % 10000000000, Locale: "en"}
+	if err := f.accounts.Create(ctx, account); err != nil {
+		t.Fatalf("create account: %v", err)
+	}
+	if phone != "" {
+		account.Phone, account.PhoneVerifiedAt, account.SMSAlerts = &phone, &f.now, true
+		if err := f.accounts.UpdatePhone(ctx, account); err != nil {
+			t.Fatalf("update phone: %v", err)
+		}
+	}
+	return account
+}
+
+// send runs every queued text
+func (f *smsFixture) send(t *testing.T) {
+	t.Helper()
+	for {
+		ran, err := f.worker.RunOne(context.Background(), SMSJob.Queue)
+		if err != nil {
+			t.Fatalf("send: %v", err)
+		}
+		if !ran {
+			return
+		}
+	}
+}
+
+var otpCode = regexp.MustCompile(`[0-9]{6}`)
+
+// code returns the code in the last text sent
+func (f *smsFixture) code(t *testing.T) string {
+	t.Helper()
+	f.send(t)
+	if len(f.provider.sent) == 0 {
+		t.Fatal("no code texted")
+	}
+	return otpCode.FindString(f.provider.sent[len(f.provider.sent)-1].Body)
+}
+
+func TestSMSVerifyPhone(t *testing.T) {
+	ctx := context.Background()
+	cfg := config.Default().SMS
+	f := newSMSFixture(t, cfg)
+	account := f.account(t, "john@mail.com", "")
+	phone := "+2348012345678"
+
+	if _, err := f.service.SetPhone(ctx, account.ID, "08012345678"); helper.Status(err) != http.StatusBadRequest {
+		t.Fatalf("invalid phone: got %v", err)
+	}
+	if _, err := f.service.SetPhone(ctx, account.ID, phone); err != nil {
+		t.Fatalf("set phone: %v", err)
+	}
+	first := f.code(t)
+	if f.provider.sent[0].To != phone || f.provider.sent[0].From != cfg.Sender {
+		t.Fatalf("got text %+v", f.provider.sent[0])
+	}
+
+	// a new code replaces the last once the cooldown is over
+	if _, err := f.service.SetPhone(ctx, account.ID, phone); helper.Status(err) != http.StatusTooManyRequests {
+		t.Fatalf("during cooldown: got %v", err)
+	}
+	f.now = f.now.Add(cfg.OTPCooldown)
+	if _, err := f.service.SetPhone(ctx, account.ID, phone); err != nil {
+		t.Fatalf("after cooldown: %v", err)
+	}
+	second := f.code(t)
+	if first != second {
+		if _, err := f.service.VerifyPhone(ctx, account.ID, first); !isCode(err, helper.CodeInvalidOTP) {
+			t.Fatalf("replaced code: got %v", err)
+		}
+	}
+
+	// the code is dropped once guessed too often
+	wrong := "000000"
+	if second == wrong {
+		wrong = "111111"
+	}
+	for i := 0; i < cfg.OTPMaxAttempts; i++ {
+		if _, err := f.service.VerifyPhone(ctx, account.ID, wrong); !isCode(err, helper.CodeInvalidOTP) {
+			t.Fatalf("guess %d: got %v", i, err)
+		}
+	}
+	if _, err := f.service.VerifyPhone(ctx, account.ID, second); !isCode(err, helper.CodeInvalidOTP) {
+		t.Fatalf("after too many guesses: got %v", err)
+	}
+
+	f.now = f.now.Add(cfg.OTPCooldown)
+	if _, err := f.service.SetPhone(ctx, account.ID, phone); err != nil {
+		t.Fatalf("set phone again: %v", err)
+	}
+	got, err := f.service.VerifyPhone(ctx, account.ID, f.code(t))
+	if err != nil || !got.PhoneVerified() || got.SMSAlerts {
+		t.Fatalf("verify: got %+v, %v", got, err)
+	}
+	if _, err := f.service.SetPhone(ctx, account.ID, phone); helper.Status(err) != http.StatusBadRequest {
+		t.Fatalf("verified phone again: got %v", err)
+	}
+
+	// a new number is only swapped in once verified, until then the
+	// verified one keeps its alerts
+	if _, err := f.service.SetAlerts(ctx, account.ID, true); err != nil {
+		t.Fatalf("alerts on: %v", err)
+	}
+	newPhone := "+2348087654321"
+	f.now = f.now.Add(cfg.OTPCooldown)
+	got, err = f.service.SetPhone(ctx, account.ID, newPhone)
+	if err != nil || !got.PhoneVerified() || *got.Phone != phone || !got.SMSAlerts {
+		t.Fatalf("new phone: got %+v, %v", got, err)
+	}
+	if stored, _ := f.accounts.GetByID(ctx, account.ID); !stored.PhoneVerified() || *stored.Phone != phone || !stored.SMSAlerts {
+		t.Fatalf("stored before verifying: got %+v", stored)
+	}
+	got, err = f.service.VerifyPhone(ctx, account.ID, f.code(t))
+	if err != nil || !got.PhoneVerified() || *got.Phone != newPhone || !got.SMSAlerts {
+		t.Fatalf("verify new phone: got %+v, %v", got, err)
+	}
+}
+
+func TestSMSBudget(t *testing.T) {
+	ctx := context.Background()
+	cfg := config.Default().SMS
+	cfg.OTPCooldown = 0
+	// codes are a segment each
+	cfg.DailySegments = 2
+	f := newSMSFixture(t, cfg)
+	account := f.account(t, "john@mail.com", "")
+
+	for i := 0; i < cfg.DailySegments; i++ {
+		if _, err := f.service.SetPhone(ctx, account.ID, "+2348012345678"); err != nil {
+			t.Fatalf("code %d: %v", i, err)
+		}
+	}
+	if _, err := f.service.SetPhone(ctx, account.ID, "+2348012345678"); helper.Status(err) != http.StatusTooManyRequests {
+		t.Fatalf("over budget: got %v", err)
+	}
+	f.now = f.now.Add(24 * time.Hour)
+	if _, err := f.service.SetPhone(ctx, account.ID, "+2348012345678"); err != nil {
+		t.Fatalf("next day: %v", err)
+	}
+}
+
+func TestSMSAlerts(t *testing.T) {
+	ctx := context.Background()
+	cfg := config.Default().SMS
+	cfg.MinAlertAmount = 10
+	cfg.DailySegments = 2
+	f := newSMSFixture(t, cfg)
+	john := f.account(t, "john@mail.com", "+2348012345678")
+	jane := f.account(t, "jane@mail.com", "+2348087654321")
+	// opted out
+	joe := f.account(t, "joe@mail.com", "")
+
+	transfer := func(from, to *models.Account, amount float64) events.Event {
+		payload, _ := json.Marshal(models.TransferCompleted{FromAccountID: from.ID, ToAccountID: to.ID, Amount: amount})
+		event := events.Event{ID: uuid.New(), Type: models.EventTransferCompleted, AggregateID: from.ID, OccurredAt: f.now, Payload: payload}
+		if err := f.service.HandleEvent(ctx, event); err != nil {
+			t.Fatalf("handle event: %v", err)
+		}
+		return event
+	}
+
+	transfer(john, jane, 5)
+	if stats, _ := f.jobs.Stats(ctx, SMSJob.Queue); stats.Ready != 0 {
+		t.Fatalf("alerts under the minimum: got %+v", stats)
+	}
+
+	event := transfer(john, jane, 25)
+	// the relay delivers events at least once
+	if err := f.service.HandleEvent(ctx, event); err != nil {
+		t.Fatalf("handle event again: %v", err)
+	}
+	if stats, _ := f.jobs.Stats(ctx, SMSJob.Queue); stats.Ready != 2 {
+		t.Fatalf("queued alerts: got %+v", stats)
+	}
+	f.send(t)
+	if len(f.provider.sent) != 2 {
+		t.Fatalf("got texts %+v", f.provider.sent)
+	}
+	for _, text := range f.provider.sent {
+		masked := helper.MaskAccountNumber(strconv.FormatInt(john.AccountNumber, 10))
+		want := "Debit: 25.00"
+		if text.To == *jane.Phone {
+			masked, want = helper.MaskAccountNumber(strconv.FormatInt(jane.AccountNumber, 10)), "Credit: 25.00"
+		}
+		if !strings.Contains(text.Body, want) || !strings.Contains(text.Body, masked) || !strings.Contains(text.Body, event.ID.String()[:8]) {
+			t.Fatalf("got text %+v, want %q to %s", text, want, masked)
+		}
+	}
+
+	transfer(joe, jane, 50)
+	transfer(joe, jane, 50)
+	f.send(t)
+	// jane's budget of 2 segments runs out, joe is never texted
+	if len(f.provider.sent) != 3 || f.provider.sent[2].To != *jane.Phone {
+		t.Fatalf("got texts %+v", f.provider.sent)
+	}
+
+	// balance adjustments are texted to their account, over the minimum too
+	for _, amount := range []float64{5, 30} {
+		payload, _ := json.Marshal(models.BalanceAdjusted{AccountID: john.ID, Type: models.Credit, Amount: amount, Reason: "goodwill"})
+		event := events.Event{ID: uuid.New(), Type: models.EventBalanceAdjusted, AggregateID: john.ID, OccurredAt: f.now, Payload: payload}
+		if err := f.service.HandleEvent(ctx, event); err != nil {
+			t.Fatalf("handle adjustment: %v", err)
+		}
+	}
+	f.send(t)
+	if len(f.provider.sent) != 4 || f.provider.sent[3].To != *john.Phone || !strings.Contains(f.provider.sent[3].Body, "Credit: 30.00") || !strings.Contains(f.provider.sent[3].Body, "goodwill") {
+		t.Fatalf("got texts %+v", f.provider.sent)
+	}
+
+	// texts the provider rejects aren't retried
+	f.provider.err = fmt.Errorf("%w: unreachable", sms.ErrRejected)
+	if err := f.service.send(ctx, smsJob{AccountID: uuid.New(), Kind: SMSOTP, To: "+2348012345678", Body: "hi"}); !queue.IsPermanent(err) {
+		t.Fatalf("rejected: got %v, want a permanent error", err)
+	}
+	f.provider.err = fmt.Errorf("timeout")
+	if err := f.service.send(ctx, smsJob{AccountID: uuid.New(), Kind: SMSOTP, To: "+2348012345678", Body: "hi"}); err == nil || queue.IsPermanent(err) {
+		t.Fatalf("timeout: got %v, want a retryable error", err)
+	}
+}
+
+func TestSMSAlertPreferences(t *testing.T) {
+	ctx := context.Background()
+	f := newSMSFixture(t, config.Default().SMS)
+	john := f.account(t, "john@mail.com", "+2348012345678")
+	jane := f.account(t, "jane@mail.com", "+2348087654321")
+
+	changed := events.Event{ID: uuid.New(), Type: models.EventPasswordChanged, AggregateID: john.ID, OccurredAt: f.now}
+	if err := f.service.HandleEvent(ctx, changed); err != nil {
+		t.Fatalf("password changed: %v", err)
+	}
+	f.send(t)
+	if len(f.provider.sent) != 1 || f.provider.sent[0].To != *john.Phone || !strings.Contains(f.provider.sent[0].Body, "password was changed") {
+		t.Fatalf("got texts %+v", f.provider.sent)
+	}
+
+	// jane only has security notifications texted
+	noSMS := models.DefaultNotificationPreference(jane.ID, models.CategoryTransactions)
+	noSMS.SMS = false
+	if err := f.notifications.SavePreference(ctx, noSMS); err != nil {
+		t.Fatalf("save preference: %v", err)
+	}
+	payload, _ := json.Marshal(models.TransferCompleted{FromAccountID: john.ID, ToAccountID: jane.ID, Amount: 25})
+	if err := f.service.HandleEvent(ctx, events.Event{ID: uuid.New(), Type: models.EventTransferCompleted, AggregateID: john.ID, OccurredAt: f.now, Payload: payload}); err != nil {
+		t.Fatalf("transfer: %v", err)
+	}
+	f.send(t)
+	if len(f.provider.sent) != 2 || f.provider.sent[1].To != *john.Phone {
+		t.Fatalf("got texts %+v", f.provider.sent)
+	}
+}
+
+// isCode reports whether err is a helper.Error with code
+func isCode(err error, code helper.Code) bool {
+	var e *helper.Error
+	return errors.As(err, &e) && e.Code == code
+}
@@ -1,11 +1,9 @@
-package middleware
+package service
 
 import (
 	"fmt"
-	"log"
 	"time"
 
-	"github.com/Cprime50/Gopay/helper"
 	models "github.com/Cprime50/Gopay/models/account"
 
 	//"github.com/dgrijalva/jwt-go"
@@ -13,6 +11,13 @@ import (
 	"github.com/google/uuid"
 )
 
+// Only accept the algorithms we sign with, otherwise a token
+// signed with eg "none" or HS256 and the public key would pass
+var (
+	idTokenMethods      = jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg()})
+	refreshTokenMethods = jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()})
+)
+
 // idTokenCustomClaims holds structure of jwt claims of idToken
 type idTokenCustomClaims struct {
 	Account *models.Account `json:"account"`
@@ -21,22 +26,19 @@ type idTokenCustomClaims struct {
 
 // generateJWT generates an IDToken which is a jwt with myCustomClaims
 // Could call this GenerateJWT, but the signature makes this fairly clear
-func generateJWT(account *models.Account) (string, error) {
-	key, err := privKey()
+func (s *TokenService) generateJWT(account *models.Account) (string, error) {
+	key, err := s.privKey()
 	if err != nil {
-		log.Println("error loading private pem key", err)
-		helper.NewInternal()
+		return "", fmt.Errorf("error loading private pem key: %w", err)
 	}
 
-	exp, err := tokenExp()
+	exp, err := s.tokenExp()
 	if err != nil {
-		log.Println("error loading toekn expiration", err)
-		helper.NewInternal()
+		return "", fmt.Errorf("error loading token expiration: %w", err)
 	}
 
-	//tokenTTL, _ := strconv.Atoi(os.Getenv("TOKEN_TTL"))
 	issuedAt := jwt.NewNumericDate(time.Now().UTC())
-	expiresAt := jwt.NewNumericDate(issuedAt.Add(time.Hour * time.Duration(exp)))
+	expiresAt := jwt.NewNumericDate(issuedAt.Add(exp))
 
 	claims := idTokenCustomClaims{
 		Account: account,
@@ -49,8 +51,7 @@ func generateJWT(account *models.Account) (string, error) {
 	signedString, err := token.SignedString(key)
 
 	if err != nil {
-		log.Println("Failed to sign id token string")
-		return "", err
+		return "", fmt.Errorf("failed to sign id token string: %w", err)
 	}
 
 	return signedString, nil
@@ -75,21 +76,19 @@ type refreshTokenCustomClaims struct {
 
 // generateRefreshToken creates a refresh token
 // The refresh token stores only the account's ID, role and a string
-func generateRefreshToken(account *models.Account) (*refreshTokenData, error) {
-	exp, err := refreshExp()
+func (s *TokenService) generateRefreshToken(account *models.Account) (*refreshTokenData, error) {
+	exp, err := s.refreshExp()
 	if err != nil {
-		log.Println("error loading reFreshtoken expiration", err)
-		helper.NewInternal()
+		return nil, fmt.Errorf("error loading refresh token expiration: %w", err)
 	}
-	key := refreshSecret()
+	key := s.refreshSecret()
 
 	issuedAt := jwt.NewNumericDate(time.Now().UTC())
-	expiresAt := jwt.NewNumericDate(issuedAt.Add(time.Hour * time.Duration(exp)))
+	expiresAt := jwt.NewNumericDate(issuedAt.Add(exp))
 	tokenID, err := uuid.NewRandom() // v4 uuid in the google uuid lib
 
 	if err != nil {
-		log.Println("Failed to generate refresh token ID")
-		return nil, err
+		return nil, fmt.Errorf("failed to generate refresh token ID: %w", err)
 	}
 
 	claims := refreshTokenCustomClaims{
@@ -106,8 +105,7 @@ func generateRefreshToken(account *models.Account) (*refreshTokenData, error) {
 	signedString, err := token.SignedString([]byte(key))
 
 	if err != nil {
-		log.Println("Failed to sign refresh token string")
-		return nil, err
+		return nil, fmt.Errorf("failed to sign refresh token string: %w", err)
 	}
 
 	return &refreshTokenData{
@@ -118,18 +116,17 @@ func generateRefreshToken(account *models.Account) (*refreshTokenData, error) {
 }
 
 // validateIDToken returns the token's claims if the token is valid
-func validateJWT(tokenString string) (*idTokenCustomClaims, error) {
-	key, err := pubKey()
+func (s *TokenService) validateJWT(tokenString string) (*idTokenCustomClaims, error) {
+	key, err := s.pubKey()
 	if err != nil {
-		log.Println("error loading public pem key", err)
-		helper.NewInternal()
+		return nil, fmt.Errorf("error loading public pem key: %w", err)
 	}
 
 	claims := &idTokenCustomClaims{}
 
 	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
 		return key, nil
-	})
+	}, idTokenMethods)
 	// For now we'll just return the error and handle logging in service level
 	if err != nil {
 		return nil, err
@@ -145,52 +142,49 @@ func validateJWT(tokenString string) (*idTokenCustomClaims, error) {
 }
 
 // Validate admin
-func validateAdminJWT(tokenString string) (*idTokenCustomClaims, error) {
-	key, err := pubKey()
+func (s *TokenService) validateAdminJWT(tokenString string) (*idTokenCustomClaims, error) {
+	key, err := s.pubKey()
 	if err != nil {
-		log.Println("error loading public pem key", err)
-		helper.NewInternal()
+		return nil, fmt.Errorf("error loading public pem key: %w", err)
 	}
 	claims := &idTokenCustomClaims{}
 
 	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
 		return key, nil
-	})
+	}, idTokenMethods)
 	// For now we'll just return the error and handle logging in service level
 	if err != nil {
 		return nil, err
 	}
+	if !token.Valid {
+		return nil, fmt.Errorf("ID token is invalid")
+	}
 	//check role for admin
 	claims, ok := token.Claims.(*idTokenCustomClaims)
-	accountRole := claims.Account.RoleID
-	if !token.Valid && accountRole != 1 {
-		return nil, fmt.Errorf("invalid admin token")
-	}
-
-	if !ok {
+	if !ok || claims.Account == nil {
 		return nil, fmt.Errorf("token valid but Invalid admin couldn't parse claims")
 	}
+	if claims.Account.RoleID != models.AdminRoleID {
+		return nil, fmt.Errorf("invalid admin token")
+	}
 	return claims, nil
 }
 
 // validateRefreshToken uses the secret key to validate a refresh token
-func validateRefreshToken(tokenString string) (*refreshTokenCustomClaims, error) {
-	key := refreshSecret()
+func (s *TokenService) validateRefreshToken(tokenString string) (*refreshTokenCustomClaims, error) {
+	key := s.refreshSecret()
 	claims := &refreshTokenCustomClaims{}
 	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
 		return []byte(key), nil
-	})
+	}, refreshTokenMethods)
 	// For now we'll just return the error and handle logging in service level
 	if err != nil {
 		return nil, err
 	}
-	//check role for admin and validate
-	claims, ok := token.Claims.(*refreshTokenCustomClaims)
-	accountRole := claims.RoleID
-	if !token.Valid && accountRole != 1 {
-		return nil, fmt.Errorf("invalid admin refresh token")
+	if !token.Valid {
+		return nil, fmt.Errorf("Refresh token is invalid")
 	}
-
+	claims, ok := token.Claims.(*refreshTokenCustomClaims)
 	if !ok {
 		return nil, fmt.Errorf("Refresh token valid but couldn't parse claims")
 	}
@@ -198,12 +192,12 @@ func validateRefreshToken(tokenString string) (*refreshTokenCustomClaims, error)
 }
 
 // Validate admin refresh token
-func validateAdminRefreshToken(tokenString string) (*refreshTokenCustomClaims, error) {
-	key := refreshSecret()
+func (s *TokenService) validateAdminRefreshToken(tokenString string) (*refreshTokenCustomClaims, error) {
+	key := s.refreshSecret()
 	claims := &refreshTokenCustomClaims{}
 	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
 		return []byte(key), nil
-	})
+	}, refreshTokenMethods)
 	// For now we'll just return the error and handle logging in service level
 	if err != nil {
 		return nil, fmt.Errorf("error parsing claims to jwt %w", err)
@@ -215,5 +209,8 @@ func validateAdminRefreshToken(tokenString string) (*refreshTokenCustomClaims, e
 	if !ok {
 		return nil, fmt.Errorf("Refresh token valid but couldn't parse claims")
 	}
+	if claims.RoleID != models.AdminRoleID {
+		return nil, fmt.Errorf("invalid admin refresh token")
+	}
 	return claims, nil
 }
@@ -0,0 +1,159 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+
+	"github.com/Cprime50/Gopay/config"
+	"github.com/Cprime50/Gopay/helper"
+	"github.com/Cprime50/Gopay/metrics"
+	models "github.com/Cprime50/Gopay/models/account"
+	"github.com/google/uuid"
+)
+
+// TokenService issues, validates and revokes id and refresh tokens
+type TokenService struct {
+	tokens models.TokenRepository
+	cfg    config.Token
+}
+
+// NewTokenService returns a TokenService storing refresh tokens in tokens.
+// If no refresh secret is configured a random one is generated,
+// meaning refresh tokens won't survive a restart
+func NewTokenService(tokens models.TokenRepository, cfg config.Token) *TokenService {
+	if cfg.RefreshSecret == "" {
+		bytes := make([]byte, 32)
+		rand.Read(bytes)
+		cfg.RefreshSecret = base64.StdEncoding.EncodeToString(bytes)
+	}
+	return &TokenService{
+		tokens: tokens,
+		cfg:    cfg,
+	}
+}
+
+// NewPairFromUser generates a new set of ID and refresh tokens for the specified user account.
+// If a previous refresh token is provided, it is removed from the token repository.
+// The newly generated refresh token is stored in the repository for future validation.
+func (s *TokenService) NewPairFromUser(ctx context.Context, account *models.Account, prevTokenID string) (*models.TokenPair, error) {
+	// Remove the previous refresh token from the repository if provided
+	if prevTokenID != "" {
+		if err := s.tokens.DeleteRefreshToken(ctx, account.ID.String(), prevTokenID); err != nil {
+			helper.Logger(ctx).Warn("failed to delete previous refresh token", "account_id", account.ID, "token_id", prevTokenID, "error", err)
+			return nil, err
+		}
+	}
+
+	// Generate a new ID token
+	idToken, err := s.generateJWT(account)
+	if err != nil {
+		helper.Logger(ctx).Error("error generating ID token", "account_id", account.ID, "error", err)
+		return nil, helper.NewInternal()
+	}
+	metrics.TokensIssued.WithLabelValues(metrics.IDToken).Inc()
+
+	// Generate a new refresh token
+	refreshToken, err := s.generateRefreshToken(account)
+	if err != nil {
+		helper.Logger(ctx).Error("error generating refresh token", "account_id", account.ID, "error", err)
+		return nil, helper.NewInternal()
+	}
+
+	// Store the newly generated refresh token in the repository
+	if err := s.tokens.SetRefreshToken(ctx, account.ID.String(), refreshToken.ID.String(), refreshToken.ExpiresIn); err != nil {
+		helper.Logger(ctx).Error("error storing refresh token ID", "account_id", account.ID, "error", err)
+		return nil, helper.NewInternal()
+	}
+
+	metrics.TokensIssued.WithLabelValues(metrics.RefreshToken).Inc()
+
+	// Return the newly generated tokens as a TokenPair
+	return &models.TokenPair{
+		Token:        models.Token{SignedString: idToken},
+		RefreshToken: models.RefreshToken{SignedString: refreshToken.SignedString, ID: refreshToken.ID, AccountID: account.ID},
+	}, nil
+}
+
+// Signout revokes all valid tokens for a user by reaching out to the repository layer.
+func (s *TokenService) Signout(ctx context.Context, id uuid.UUID) error {
+	// Delete all valid refresh tokens associated with the user ID from the repository
+	return s.tokens.DeleteUserRefreshTokens(ctx, id.String())
+}
+
+// ValidateJWT validates the provided ID token JWT string using the public RSA key.
+func (s *TokenService) ValidateJWT(ctx context.Context, tokenString string) (*models.Account, error) {
+	// Validate and parse the ID token using the provided public RSA key
+	claims, err := s.validateJWT(tokenString)
+	if err != nil {
+		helper.Logger(ctx).Info("unable to validate or parse ID token", "error", err)
+		return nil, helper.NewAuthorization("Unable to verify user from ID token").WithCode(helper.CodeInvalidToken)
+	}
+	return claims.Account, nil
+}
+
+// JWTAuthAdmin validates the id token jwt string
+func (s *TokenService) ValidateAdminJWT(ctx context.Context, tokenString string) (*models.Account, error) {
+	claims, err := s.validateAdminJWT(tokenString) // uses public RSA key
+	if err != nil {
+		helper.Logger(ctx).Info("unable to validate admin or parse token", "error", err)
+		return nil, helper.NewAuthorization("Unable to verify user from idToken").WithCode(helper.CodeInvalidToken)
+	}
+	return claims.Account, nil
+}
+
+// ValidateRefreshToken checks to make sure the JWT provided by a string is valid
+// and returns a RefreshToken if valid
+func (s *TokenService) ValidateRefreshToken(ctx context.Context, tokenString string) (*models.RefreshToken, error) {
+	// validate actual JWT with string a secret
+	claims, err := s.validateRefreshToken(tokenString)
+
+	// We'll just return unauthorized error in all instances of failing to verify user
+	if err != nil {
+		helper.Logger(ctx).Info("unable to validate or parse refresh token", "error", err)
+		return nil, helper.NewAuthorization("Unable to verify user from refresh token").WithCode(helper.CodeInvalidToken)
+	}
+
+	// Standard claims store ID as a string. I want "model" to be clear our string
+	// is a UUID. So we parse claims.Id as UUID
+	tokenUUID, err := uuid.Parse(claims.ID)
+
+	if err != nil {
+		helper.Logger(ctx).Info("refresh token claims ID could not be parsed as UUID", "token_id", claims.ID, "error", err)
+		return nil, helper.NewAuthorization("Unable to verify user from refresh token").WithCode(helper.CodeInvalidToken)
+	}
+
+	return &models.RefreshToken{
+		SignedString: tokenString,
+		ID:           tokenUUID,
+		AccountID:    claims.AccountID,
+	}, nil
+}
+
+// ValidateRefreshToken checks to make sure the JWT provided by a string is valid
+// and returns a RefreshToken if valid
+func (s *TokenService) ValidateAdminRefreshToken(ctx context.Context, tokenString string) (*models.RefreshToken, error) {
+	// validate actual JWT with string a secret
+	claims, err := s.validateAdminRefreshToken(tokenString)
+
+	// We'll just return unauthorized error in all instances of failing to verify user
+	if err != nil {
+		helper.Logger(ctx).Info("unable to validate or parse refresh token", "error", err)
+		return nil, helper.NewAuthorization("Unable to verify user from refresh token").WithCode(helper.CodeInvalidToken)
+	}
+
+	// Standard claims store ID as a string. I want "model" to be clear our string
+	// is a UUID. So we parse claims.Id as UUID
+	tokenUUID, err := uuid.Parse(claims.ID)
+
+	if err != nil {
+		helper.Logger(ctx).Info("refresh token claims ID could not be parsed as UUID", "token_id", claims.ID, "error", err)
+		return nil, helper.NewAuthorization("Unable to verify user from refresh token").WithCode(helper.CodeInvalidToken)
+	}
+
+	return &models.RefreshToken{
+		SignedString: tokenString,
+		ID:           tokenUUID,
+		AccountID:    claims.AccountID,
+	}, nil
+}
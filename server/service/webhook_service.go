@@ -0,0 +1,599 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/Cprime50/Gopay/config"
+	"github.com/Cprime50/Gopay/events"
+	"github.com/Cprime50/Gopay/helper"
+	models "github.com/Cprime50/Gopay/models/account"
+	"github.com/Cprime50/Gopay/queue"
+	"github.com/google/uuid"
+)
+
+// Headers sent with every webhook delivery
+const (
+	WebhookSignatureHeader = "Gopay-Signature"
+	WebhookEventHeader     = "Gopay-Event-Type"
+	WebhookDeliveryHeader  = "Gopay-Delivery-Id"
+)
+
+// maxWebhookResponse is how much of a response body is kept with an attempt
+const maxWebhookResponse = 1024
+
+// WebhookEventTypes are the events webhooks can subscribe to, "*" subscribes to all of them
+var WebhookEventTypes = []string{
+	models.EventAccountActivated,
+	models.EventPasswordChanged,
+	models.EventTransferCompleted,
+	models.EventBalanceAdjusted,
+}
+
+// WebhookUpdate holds the fields of an endpoint to change, nil ones are kept.
+// Enabling a disabled endpoint resets its failures
+type WebhookUpdate struct {
+	URL         *string
+	Description *string
+	Events      []string
+	Enabled     *bool
+}
+
+// webhookPayload is the body posted to endpoints. ID is the event's,
+// the same on every delivery of it, so receivers can dedupe on it
+type webhookPayload struct {
+	ID        uuid.UUID       `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// webhookTransfer is the data of a transfer.completed webhook, the
+// recipient's own side of the transfer. The counterparty is only given
+// by its masked account number
+type webhookTransfer struct {
+	// Direction is sent or received
+	Direction                 string    `json:"direction"`
+	Amount                    float64   `json:"amount"`
+	EntryID                   uuid.UUID `json:"entry_id"`
+	CounterpartyAccountNumber string    `json:"counterparty_account_number"`
+}
+
+// webhookRecipient is an account an event is posted to, with its data
+type webhookRecipient struct {
+	AccountID uuid.UUID
+	Data      json.RawMessage
+}
+
+// webhookJob delivers a webhook in the background
+type webhookJob struct {
+	DeliveryID uuid.UUID `json:"delivery_id"`
+}
+
+// WebhookJob posts a delivery to its endpoint, failed attempts are retried by the queue
+var WebhookJob = queue.NewType[webhookJob]("webhooks", "webhook.deliver")
+
+// WebhookService manages accounts' webhook endpoints and delivers the
+// events they subscribe to. Deliveries are signed, retried with backoff
+// and every attempt is recorded. Endpoints that keep failing are
+// disabled and their owner notified
+type WebhookService struct {
+	accounts models.AccountRepository
+	webhooks models.WebhookRepository
+	jobs     *queue.Queue
+	notifier Notifier
+	client   *http.Client
+	cfg      config.Webhooks
+	now      func() time.Time
+}
+
+// NewWebhookService returns a WebhookService, notifier defaults to LogNotifier
+func NewWebhookService(accounts models.AccountRepository, webhooks models.WebhookRepository, jobs *queue.Queue, notifier Notifier, cfg config.Webhooks) *WebhookService {
+	if notifier == nil {
+		notifier = LogNotifier{}
+	}
+	return &WebhookService{
+		accounts: accounts,
+		webhooks: webhooks,
+		jobs:     jobs,
+		notifier: notifier,
+		client:   newWebhookClient(cfg),
+		cfg:      cfg,
+		now:      func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// Create validates and saves a new active endpoint, returning the secret
+// its deliveries are signed with. It isn't shown again
+func (s *WebhookService) Create(ctx context.Context, endpoint *models.WebhookEndpoint) (string, error) {
+	if err := s.validateURL(endpoint.URL); err != nil {
+		return "", err
+	}
+	eventTypes, err := validateWebhookEvents(endpoint.Events)
+	if err != nil {
+		return "", err
+	}
+	existing, err := s.webhooks.ListEndpoints(ctx, endpoint.AccountID)
+	if err != nil {
+		return "", err
+	}
+	if len(existing) >= s.cfg.MaxEndpoints {
+		return "", helper.NewBadRequest(fmt.Sprintf("an account can have at most %d webhooks", s.cfg.MaxEndpoints))
+	}
+
+	secret, err := newWebhookSecret()
+	if err != nil {
+		helper.Logger(ctx).Error("error generating webhook secret", "error", err)
+		return "", helper.NewInternal()
+	}
+	endpoint.Events = eventTypes
+	endpoint.Secret = secret
+	endpoint.Status = models.WebhookActive
+	if err := s.webhooks.CreateEndpoint(ctx, endpoint); err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+// List returns the account's endpoints, oldest first
+func (s *WebhookService) List(ctx context.Context, accountID uuid.UUID) ([]*models.WebhookEndpoint, error) {
+	return s.webhooks.ListEndpoints(ctx, accountID)
+}
+
+// Get returns one of the account's endpoints, other accounts' are not found
+func (s *WebhookService) Get(ctx context.Context, accountID uuid.UUID, id uuid.UUID) (*models.WebhookEndpoint, error) {
+	endpoint, err := s.webhooks.GetEndpoint(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if endpoint.AccountID != accountID {
+		return nil, helper.NewNotFound("webhook", id.String())
+	}
+	return endpoint, nil
+}
+
+// Update edits an endpoint, enabling or disabling it
+func (s *WebhookService) Update(ctx context.Context, accountID uuid.UUID, id uuid.UUID, update WebhookUpdate) (*models.WebhookEndpoint, error) {
+	endpoint, err := s.Get(ctx, accountID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if update.URL != nil {
+		if err := s.validateURL(*update.URL); err != nil {
+			return nil, err
+		}
+		endpoint.URL = *update.URL
+	}
+	if update.Description != nil {
+		endpoint.Description = *update.Description
+	}
+	if update.Events != nil {
+		eventTypes, err := validateWebhookEvents(update.Events)
+		if err != nil {
+			return nil, err
+		}
+		endpoint.Events = eventTypes
+	}
+	if update.Enabled != nil {
+		switch {
+		case *update.Enabled && endpoint.Status == models.WebhookDisabled:
+			endpoint.Status = models.WebhookActive
+			endpoint.ConsecutiveFailures = 0
+			endpoint.DisabledAt, endpoint.DisabledReason = nil, ""
+		case !*update.Enabled && endpoint.Status == models.WebhookActive:
+			now := s.now()
+			endpoint.Status = models.WebhookDisabled
+			endpoint.DisabledAt, endpoint.DisabledReason = &now, "disabled by the owner"
+		}
+	}
+
+	if err := s.webhooks.UpdateEndpoint(ctx, endpoint); err != nil {
+		return nil, err
+	}
+	return endpoint, nil
+}
+
+// Delete removes an endpoint and its delivery log
+func (s *WebhookService) Delete(ctx context.Context, accountID uuid.UUID, id uuid.UUID) error {
+	if _, err := s.Get(ctx, accountID, id); err != nil {
+		return err
+	}
+	return s.webhooks.DeleteEndpoint(ctx, id)
+}
+
+// Deliveries returns up to limit of an endpoint's deliveries, newest first
+func (s *WebhookService) Deliveries(ctx context.Context, accountID uuid.UUID, id uuid.UUID, limit int) ([]*models.WebhookDelivery, error) {
+	if _, err := s.Get(ctx, accountID, id); err != nil {
+		return nil, err
+	}
+	return s.webhooks.ListDeliveries(ctx, id, limit)
+}
+
+// Delivery returns one of an endpoint's deliveries with its attempts, oldest first
+func (s *WebhookService) Delivery(ctx context.Context, accountID uuid.UUID, id uuid.UUID, deliveryID uuid.UUID) (*models.WebhookDelivery, []*models.WebhookAttempt, error) {
+	delivery, err := s.delivery(ctx, accountID, id, deliveryID)
+	if err != nil {
+		return nil, nil, err
+	}
+	attempts, err := s.webhooks.ListAttempts(ctx, delivery.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return delivery, attempts, nil
+}
+
+// Redeliver sends a delivery that succeeded or ran out of attempts
+// again, with fresh attempts. The endpoint must be enabled
+func (s *WebhookService) Redeliver(ctx context.Context, accountID uuid.UUID, id uuid.UUID, deliveryID uuid.UUID) (*models.WebhookDelivery, error) {
+	endpoint, err := s.Get(ctx, accountID, id)
+	if err != nil {
+		return nil, err
+	}
+	if endpoint.Status != models.WebhookActive {
+		return nil, helper.NewBadRequest("the webhook is disabled, enable it before redelivering")
+	}
+	delivery, err := s.delivery(ctx, accountID, id, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	if delivery.Status == models.DeliveryPending {
+		return nil, helper.NewBadRequest("the delivery is still in progress")
+	}
+
+	delivery.Status = models.DeliveryPending
+	delivery.Attempts = 0
+	if err := s.webhooks.UpdateDelivery(ctx, delivery); err != nil {
+		return nil, err
+	}
+	if err := s.enqueue(ctx, delivery); err != nil {
+		return nil, err
+	}
+	return delivery, nil
+}
+
+// delivery returns one of the endpoint's deliveries, after checking the account owns the endpoint
+func (s *WebhookService) delivery(ctx context.Context, accountID uuid.UUID, id uuid.UUID, deliveryID uuid.UUID) (*models.WebhookDelivery, error) {
+	if _, err := s.Get(ctx, accountID, id); err != nil {
+		return nil, err
+	}
+	delivery, err := s.webhooks.GetDelivery(ctx, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	if delivery.EndpointID != id {
+		return nil, helper.NewNotFound("delivery", deliveryID.String())
+	}
+	return delivery, nil
+}
+
+// HandleEvent queues a delivery of event to every active endpoint
+// subscribed to it, of the accounts it's about. It's an event bus
+// subscriber, so may see an event more than once: a delivery is only
+// created once per endpoint
+func (s *WebhookService) HandleEvent(ctx context.Context, event events.Event) error {
+	recipients, err := s.recipients(ctx, event)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, recipient := range recipients {
+		payload, err := json.Marshal(webhookPayload{ID: event.ID, Type: event.Type, CreatedAt: event.OccurredAt, Data: recipient.Data})
+		if err != nil {
+			return fmt.Errorf("encoding webhook payload: %w", err)
+		}
+		endpoints, err := s.webhooks.ListEndpoints(ctx, recipient.AccountID)
+		if err != nil {
+			return err
+		}
+		for _, endpoint := range endpoints {
+			if endpoint.Status != models.WebhookActive || !endpoint.Subscribes(event.Type) {
+				continue
+			}
+			if err := s.queueDelivery(ctx, endpoint, event, payload); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// queueDelivery creates the endpoint's delivery of event and enqueues it
+func (s *WebhookService) queueDelivery(ctx context.Context, endpoint *models.WebhookEndpoint, event events.Event, payload []byte) error {
+	delivery := &models.WebhookDelivery{
+		EndpointID: endpoint.ID,
+		EventID:    event.ID,
+		EventType:  event.Type,
+		Payload:    string(payload),
+		Status:     models.DeliveryPending,
+	}
+	created, err := s.webhooks.CreateDelivery(ctx, delivery)
+	if err != nil {
+		return err
+	}
+	if !created {
+		// seen before, enqueue it again only if that may have failed last time
+		delivery, err = s.webhooks.GetDeliveryByEvent(ctx, endpoint.ID, event.ID)
+		if err != nil {
+			return err
+		}
+		if delivery.Status != models.DeliveryPending || delivery.Attempts > 0 {
+			return nil
+		}
+	}
+	return s.enqueue(ctx, delivery)
+}
+
+// enqueue has a worker post the delivery
+func (s *WebhookService) enqueue(ctx context.Context, delivery *models.WebhookDelivery) error {
+	_, err := WebhookJob.Enqueue(ctx, s.jobs, webhookJob{DeliveryID: delivery.ID}, queue.MaxAttempts(s.cfg.MaxAttempts))
+	return err
+}
+
+// HandleWebhooks has w post queued deliveries
+func (s *WebhookService) HandleWebhooks(w *queue.Worker) {
+	WebhookJob.Handle(w, func(ctx context.Context, job webhookJob) error {
+		return s.Deliver(ctx, job.DeliveryID)
+	})
+}
+
+// Deliver makes one attempt at a pending delivery and records it. An
+// error means the attempt failed and should be retried, once the
+// delivery runs out of attempts it's marked failed and nil returned
+func (s *WebhookService) Deliver(ctx context.Context, deliveryID uuid.UUID) error {
+	delivery, err := s.webhooks.GetDelivery(ctx, deliveryID)
+	if helper.Status(err) == http.StatusNotFound {
+		// its endpoint was deleted
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if delivery.Status != models.DeliveryPending {
+		return nil
+	}
+	endpoint, err := s.webhooks.GetEndpoint(ctx, delivery.EndpointID)
+	if err != nil {
+		return err
+	}
+	if endpoint.Status != models.WebhookActive {
+		delivery.Status = models.DeliveryFailed
+		delivery.LastError = "the webhook is disabled"
+		return s.webhooks.UpdateDelivery(ctx, delivery)
+	}
+
+	attempt := s.post(ctx, endpoint, delivery)
+	now := s.now()
+	delivery.Attempts++
+	delivery.LastAttemptAt = &now
+	delivery.LastStatusCode = attempt.StatusCode
+	delivery.LastError = attempt.Error
+	if attempt.Succeeded {
+		delivery.Status = models.DeliverySucceeded
+		delivery.DeliveredAt = &now
+	} else if delivery.Attempts >= s.cfg.MaxAttempts {
+		delivery.Status = models.DeliveryFailed
+	}
+	if err := s.webhooks.RecordAttempt(ctx, delivery, attempt); err != nil {
+		return err
+	}
+
+	disabled, err := s.webhooks.RecordResult(ctx, endpoint.ID, attempt.Succeeded, s.cfg.DisableAfter, now)
+	if err != nil {
+		return err
+	}
+	if disabled {
+		helper.Logger(ctx).Warn("webhook disabled after repeated failures", "webhook_id", endpoint.ID, "account_id", endpoint.AccountID)
+		err := s.notifier.Notify(ctx, Notification{
+			AccountID: endpoint.AccountID,
+			Event:     EventWebhookDisabled,
+			Data:      map[string]any{"webhook_id": endpoint.ID, "url": endpoint.URL, "failures": s.cfg.DisableAfter},
+		})
+		if err != nil {
+			helper.Logger(ctx).Error("error notifying webhook disabled", "error", err)
+		}
+	}
+	if attempt.Succeeded || delivery.Status == models.DeliveryFailed || disabled {
+		return nil
+	}
+	return fmt.Errorf("webhook delivery failed: %s", attempt.Error)
+}
+
+// post sends the delivery to the endpoint, signed with its secret
+func (s *WebhookService) post(ctx context.Context, endpoint *models.WebhookEndpoint, delivery *models.WebhookDelivery) *models.WebhookAttempt {
+	attempt := &models.WebhookAttempt{}
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		attempt.Error = truncate(err.Error(), 255)
+		return attempt
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Gopay-Webhooks/1.0")
+	req.Header.Set(WebhookEventHeader, delivery.EventType)
+	req.Header.Set(WebhookDeliveryHeader, delivery.ID.String())
+	req.Header.Set(WebhookSignatureHeader, SignWebhook(endpoint.Secret, s.now(), body))
+
+	start := time.Now()
+	resp, err := s.client.Do(req)
+	attempt.DurationMS = time.Since(start).Milliseconds()
+	if err != nil {
+		attempt.Error = truncate(err.Error(), 255)
+		return attempt
+	}
+	defer resp.Body.Close()
+
+	response, _ := io.ReadAll(io.LimitReader(resp.Body, maxWebhookResponse))
+	attempt.StatusCode = resp.StatusCode
+	attempt.Response = strings.ToValidUTF8(string(response), "")
+	attempt.Succeeded = resp.StatusCode >= 200 && resp.StatusCode < 300
+	if !attempt.Succeeded {
+		attempt.Error = fmt.Sprintf("the endpoint responded %d", resp.StatusCode)
+	}
+	return attempt
+}
+
+// validateURL checks an endpoint URL is absolute https, or http when insecure URLs are allowed
+func (s *WebhookService) validateURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" || u.User != nil || len(raw) > 2048 {
+		return helper.NewInvalidParam("url", "url", "must be an absolute URL without credentials")
+	}
+	if u.Scheme != "https" && !(s.cfg.AllowInsecure && u.Scheme == "http") {
+		return helper.NewInvalidParam("url", "https", "must be an https URL")
+	}
+	return nil
+}
+
+// validateWebhookEvents checks the event types are known, returning them without duplicates
+func validateWebhookEvents(eventTypes []string) ([]string, error) {
+	if len(eventTypes) == 0 {
+		return nil, helper.NewInvalidParam("events", "required", "must list at least one event type")
+	}
+	var valid []string
+	seen := make(map[string]bool)
+	for _, t := range eventTypes {
+		if t != "*" && !slices.Contains(WebhookEventTypes, t) {
+			return nil, helper.NewInvalidParam("events", "oneof", "must only contain * or "+strings.Join(WebhookEventTypes, ", "))
+		}
+		if !seen[t] {
+			seen[t] = true
+			valid = append(valid, t)
+		}
+	}
+	return valid, nil
+}
+
+// recipients lists the accounts event is about with the data posted to
+// each. A transfer is about both the sender and the recipient, who are
+// each sent their own side of it rather than the event's payload, which
+// names the other's account and entry
+func (s *WebhookService) recipients(ctx context.Context, event events.Event) ([]webhookRecipient, error) {
+	if event.Type != models.EventTransferCompleted {
+		return []webhookRecipient{{AccountID: event.AggregateID, Data: event.Payload}}, nil
+	}
+	transfer, err := events.Decode[models.TransferCompleted](event)
+	if err != nil {
+		return nil, err
+	}
+	from, err := s.accounts.GetByID(ctx, transfer.FromAccountID)
+	if err != nil {
+		return nil, err
+	}
+	to, err := s.accounts.GetByID(ctx, transfer.ToAccountID)
+	if err != nil {
+		return nil, err
+	}
+	sent, err := json.Marshal(webhookTransfer{Direction: "sent", Amount: transfer.Amount, EntryID: transfer.DebitEntryID, CounterpartyAccountNumber: helper.MaskAccountNumber(strconv.FormatInt(to.AccountNumber, 10))})
+	if err != nil {
+		return nil, fmt.Errorf("encoding webhook data: %w", err)
+	}
+	received, err := json.Marshal(webhookTransfer{Direction: "received", Amount: transfer.Amount, EntryID: transfer.CreditEntryID, CounterpartyAccountNumber: helper.MaskAccountNumber(strconv.FormatInt(from.AccountNumber, 10))})
+	if err != nil {
+		return nil, fmt.Errorf("encoding webhook data: %w", err)
+	}
+	return []webhookRecipient{{AccountID: from.ID, Data: sent}, {AccountID: to.ID, Data: received}}, nil
+}
+
+// SignWebhook is the signature header of a body sent at t: the unix
+// time and the hex HMAC-SHA256 of "<unix time>.<body>" keyed by the
+// endpoint's secret, as "t=<unix time>,v1=<hmac>"
+func SignWebhook(secret string, t time.Time, body []byte) string {
+	timestamp := strconv.FormatInt(t.Unix(), 10)
+	return "t=" + timestamp + ",v1=" + webhookMAC(secret, timestamp, body)
+}
+
+// VerifyWebhook checks a signature header made by SignWebhook, and that
+// it was made within tolerance of now so old deliveries can't be replayed
+func VerifyWebhook(secret string, header string, body []byte, now time.Time, tolerance time.Duration) error {
+	var timestamp, signature string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(part, "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signature = value
+		}
+	}
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || signature == "" {
+		return errors.New("webhook: malformed signature header")
+	}
+	if age := now.Sub(time.Unix(unix, 0)); age > tolerance || age < -tolerance {
+		return errors.New("webhook: signature timestamp outside the tolerance")
+	}
+	if !hmac.Equal([]byte(signature), []byte(webhookMAC(secret, timestamp, body))) {
+		return errors.New("webhook: signature mismatch")
+	}
+	return nil
+}
+
+func webhookMAC(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// newWebhookSecret returns a random signing secret
+func newWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// newWebhookClient returns the client deliveries are posted with. It
+// doesn't follow redirects and, unless insecure URLs are allowed,
+// refuses to connect to private, loopback and link local addresses
+// whatever the URL's host resolves to
+func newWebhookClient(cfg config.Webhooks) *http.Client {
+	dialer := &net.Dialer{Timeout: cfg.Timeout}
+	if !cfg.AllowInsecure {
+		dialer.Control = refuseInternal
+	}
+	return &http.Client{
+		Timeout: cfg.Timeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: cfg.Timeout,
+			MaxIdleConnsPerHost: 2,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// refuseInternal is a dialer control refusing addresses that aren't public
+func refuseInternal(network string, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return fmt.Errorf("webhook: refusing to connect to %s", host)
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Cprime50/Gopay/config"
+	"github.com/Cprime50/Gopay/events"
+	models "github.com/Cprime50/Gopay/models/account"
+	"github.com/Cprime50/Gopay/queue"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+type webhookFixture struct {
+	service  *WebhookService
+	accounts models.AccountRepository
+	webhooks models.WebhookRepository
+	jobs     *queue.Queue
+	notifier *recordingNotifier
+	endpoint *models.WebhookEndpoint
+	status   int
+}
+
+// newWebhookFixture registers an endpoint for every event, answering with f.status
+func newWebhookFixture(t *testing.T, cfg config.Webhooks) *webhookFixture {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+
+	f := &webhookFixture{
+		accounts: models.NewMemoryAccountRepository(),
+		webhooks: models.NewMemoryWebhookRepository(),
+		jobs:     queue.New(rdb, config.Default().Jobs),
+		notifier: &recordingNotifier{},
+		status:   http.StatusOK,
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(f.status)
+	}))
+	t.Cleanup(srv.Close)
+
+	f.service = NewWebhookService(f.accounts, f.webhooks, f.jobs, f.notifier, cfg)
+	f.endpoint = &models.WebhookEndpoint{AccountID: uuid.New(), URL: srv.URL, Events: []string{"*"}}
+	if _, err := f.service.Create(context.Background(), f.endpoint); err != nil {
+		t.Fatalf("creating endpoint: %v", err)
+	}
+	return f
+}
+
+// event hands the service a new event about the endpoint's account, returning its delivery
+func (f *webhookFixture) event(t *testing.T) *models.WebhookDelivery {
+	t.Helper()
+	ctx := context.Background()
+	event := events.Event{
+		ID:          uuid.New(),
+		Type:        models.EventPasswordChanged,
+		AggregateID: f.endpoint.AccountID,
+		OccurredAt:  time.Now(),
+		Payload:     json.RawMessage(`{"account_id":"` + f.endpoint.AccountID.String() + `"}`),
+	}
+	if err := f.service.HandleEvent(ctx, event); err != nil {
+		t.Fatalf("handle event: %v", err)
+	}
+	delivery, err := f.webhooks.GetDeliveryByEvent(ctx, f.endpoint.ID, event.ID)
+	if err != nil {
+		t.Fatalf("get delivery: %v", err)
+	}
+	return delivery
+}
+
+func TestWebhookSignature(t *testing.T) {
+	now := time.Now()
+	body := []byte(`{"type":"transfer.completed"}`)
+	header := SignWebhook("whsec_test", now, body)
+
+	if err := VerifyWebhook("whsec_test", header, body, now.Add(time.Minute), 5*time.Minute); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	for name, check := range map[string]func() error{
+		"wrong secret":  func() error { return VerifyWebhook("whsec_other", header, body, now, 5*time.Minute) },
+		"changed body":  func() error { return VerifyWebhook("whsec_test", header, []byte(`{}`), now, 5*time.Minute) },
+		"replayed":      func() error { return VerifyWebhook("whsec_test", header, body, now.Add(time.Hour), 5*time.Minute) },
+		"malformed":     func() error { return VerifyWebhook("whsec_test", "v1=abc", body, now, 5*time.Minute) },
+		"no signatures": func() error { return VerifyWebhook("whsec_test", "", body, now, 5*time.Minute) },
+	} {
+		if err := check(); err == nil {
+			t.Errorf("%s: verified", name)
+		}
+	}
+}
+
+func TestWebhookRetriesAndAutoDisable(t *testing.T) {
+	ctx := context.Background()
+	cfg := config.Default().Webhooks
+	cfg.AllowInsecure = true
+	cfg.MaxAttempts = 3
+	cfg.DisableAfter = 5
+	f := newWebhookFixture(t, cfg)
+	f.status = http.StatusInternalServerError
+
+	// a failed attempt is retried until the delivery runs out of attempts
+	first := f.event(t)
+	for i := 1; i <= cfg.MaxAttempts; i++ {
+		err := f.service.Deliver(ctx, first.ID)
+		if (err != nil) != (i < cfg.MaxAttempts) {
+			t.Fatalf("attempt %d: got %v", i, err)
+		}
+	}
+	delivery, _ := f.webhooks.GetDelivery(ctx, first.ID)
+	attempts, _ := f.webhooks.ListAttempts(ctx, first.ID)
+	if delivery.Status != models.DeliveryFailed || delivery.Attempts != 3 || len(attempts) != 3 || attempts[0].StatusCode != http.StatusInternalServerError {
+		t.Fatalf("failed delivery: got %+v, %d attempts", delivery, len(attempts))
+	}
+	if stats, _ := f.jobs.Stats(ctx, WebhookJob.Queue); stats.Ready != 1 {
+		t.Fatalf("queued deliveries: got %+v", stats)
+	}
+
+	// the same event again doesn't deliver it again
+	f.service.HandleEvent(ctx, events.Event{ID: first.EventID, Type: first.EventType, AggregateID: f.endpoint.AccountID, Payload: json.RawMessage(`{}`)})
+	if stats, _ := f.jobs.Stats(ctx, WebhookJob.Queue); stats.Ready != 1 {
+		t.Fatalf("queued deliveries after a duplicate: got %+v", stats)
+	}
+
+	// the fifth failure in a row disables the endpoint and tells its owner
+	second := f.event(t)
+	if err := f.service.Deliver(ctx, second.ID); err == nil {
+		t.Fatal("fourth failure: got nil")
+	}
+	if err := f.service.Deliver(ctx, second.ID); err != nil {
+		t.Fatalf("fifth failure: got %v, want nil once disabled", err)
+	}
+	endpoint, _ := f.webhooks.GetEndpoint(ctx, f.endpoint.ID)
+	if endpoint.Status != models.WebhookDisabled || endpoint.ConsecutiveFailures != 5 {
+		t.Fatalf("endpoint: got %+v", endpoint)
+	}
+	if len(f.notifier.sent) != 1 || f.notifier.sent[0].Event != EventWebhookDisabled || f.notifier.sent[0].AccountID != endpoint.AccountID {
+		t.Fatalf("notifications: got %+v", f.notifier.sent)
+	}
+	if _, err := f.service.Redeliver(ctx, endpoint.AccountID, endpoint.ID, first.ID); err == nil {
+		t.Fatal("redelivered to a disabled endpoint")
+	}
+
+	// nothing is delivered to it until it's enabled again
+	err := f.service.HandleEvent(ctx, events.Event{ID: uuid.New(), Type: models.EventPasswordChanged, AggregateID: endpoint.AccountID, Payload: json.RawMessage(`{}`)})
+	if deliveries, _ := f.webhooks.ListDeliveries(ctx, endpoint.ID, 10); err != nil || len(deliveries) != 2 {
+		t.Fatalf("deliveries to a disabled endpoint: got %d, %v", len(deliveries), err)
+	}
+}
+
+func TestWebhookRedeliver(t *testing.T) {
+	ctx := context.Background()
+	cfg := config.Default().Webhooks
+	cfg.AllowInsecure = true
+	cfg.MaxAttempts = 1
+	f := newWebhookFixture(t, cfg)
+	f.status = http.StatusBadGateway
+
+	delivery := f.event(t)
+	if err := f.service.Deliver(ctx, delivery.ID); err != nil {
+		t.Fatalf("deliver: %v", err)
+	}
+
+	f.status = http.StatusNoContent
+	redelivery, err := f.service.Redeliver(ctx, f.endpoint.AccountID, f.endpoint.ID, delivery.ID)
+	if err != nil || redelivery.Status != models.DeliveryPending || redelivery.Attempts != 0 {
+		t.Fatalf("redeliver: got %+v, %v", redelivery, err)
+	}
+	if _, err := f.service.Redeliver(ctx, f.endpoint.AccountID, f.endpoint.ID, delivery.ID); err == nil {
+		t.Fatal("redelivered a pending delivery")
+	}
+	if _, err := f.service.Redeliver(ctx, uuid.New(), f.endpoint.ID, delivery.ID); err == nil {
+		t.Fatal("redelivered another account's delivery")
+	}
+	if err := f.service.Deliver(ctx, delivery.ID); err != nil {
+		t.Fatalf("deliver again: %v", err)
+	}
+	got, _ := f.webhooks.GetDelivery(ctx, delivery.ID)
+	attempts, _ := f.webhooks.ListAttempts(ctx, delivery.ID)
+	if got.Status != models.DeliverySucceeded || got.DeliveredAt == nil || len(attempts) != 2 {
+		t.Fatalf("redelivered: got %+v, %d attempts", got, len(attempts))
+	}
+}
+
+func TestWebhookRefusesInternalAddresses(t *testing.T) {
+	ctx := context.Background()
+	cfg := config.Default().Webhooks
+	cfg.AllowInsecure = true
+	f := newWebhookFixture(t, cfg)
+
+	secure := NewWebhookService(f.accounts, f.webhooks, f.jobs, f.notifier, config.Default().Webhooks)
+	if _, err := secure.Create(ctx, &models.WebhookEndpoint{AccountID: uuid.New(), URL: "http://example.com", Events: []string{"*"}}); err == nil {
+		t.Fatal("created an http endpoint")
+	}
+
+	// the fixture's receiver is on loopback
+	delivery := f.event(t)
+	if err := secure.Deliver(ctx, delivery.ID); err == nil {
+		t.Fatal("delivered to loopback")
+	}
+	attempts, _ := f.webhooks.ListAttempts(ctx, delivery.ID)
+	if len(attempts) != 1 || !strings.Contains(attempts[0].Error, "refusing to connect") {
+		t.Fatalf("attempts: got %+v", attempts)
+	}
+}
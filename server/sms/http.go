@@ -0,0 +1,66 @@
+package sms
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/Cprime50/Gopay/config"
+)
+
+// ErrRejected is returned when the provider refuses a text, eg for a
+// number it can't reach, sending it again won't help
+var ErrRejected = errors.New("sms: the provider rejected the message")
+
+// HTTP posts texts as JSON to a provider, with the API key as a bearer token
+type HTTP struct {
+	url    string
+	apiKey string
+	client *http.Client
+}
+
+// NewHTTP returns an HTTP provider posting to cfg.URL
+func NewHTTP(cfg config.SMS) *HTTP {
+	return &HTTP{
+		url:    cfg.URL,
+		apiKey: cfg.APIKey,
+		client: &http.Client{Timeout: cfg.Timeout},
+	}
+}
+
+// Send posts msg, a 4xx response other than 429 is ErrRejected
+func (p *HTTP) Send(ctx context.Context, msg *Message) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("sms: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	reason, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("sms: the provider responded %d: %s", resp.StatusCode, strings.TrimSpace(string(reason)))
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+		return fmt.Errorf("%w: %w", ErrRejected, err)
+	}
+	return err
+}
@@ -0,0 +1,90 @@
+// Package sms sends text messages through a provider. The http driver
+// posts them as JSON to a provider's URL, StandIn is a local provider
+// for development and tests that keeps what it's sent
+package sms
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/Cprime50/Gopay/config"
+	"github.com/Cprime50/Gopay/helper"
+)
+
+// Message is a text to a phone number in E.164 format, From is the sender ID
+type Message struct {
+	To   string `json:"to"`
+	From string `json:"from"`
+	Body string `json:"body"`
+}
+
+// Provider sends texts
+type Provider interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+// NewProvider returns the provider of the configured driver
+func NewProvider(cfg config.SMS) (Provider, error) {
+	switch cfg.Driver {
+	case "http":
+		return NewHTTP(cfg), nil
+	case "log":
+		return Log{}, nil
+	}
+	return nil, fmt.Errorf("unknown sms driver %q", cfg.Driver)
+}
+
+// e164 is a + then a country code and subscriber number, 8 to 15 digits in all
+var e164 = regexp.MustCompile(`^\+[1-9][0-9]{7,14}$`)
+
+// ValidPhone reports whether phone is an E.164 number, eg +2348012345678
+func ValidPhone(phone string) bool {
+	return e164.MatchString(phone)
+}
+
+// gsm7 is the GSM 7 bit default alphabet, gsm7Extended the characters
+// that take two of its septets
+const (
+	gsm7         = "@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà"
+	gsm7Extended = "^{}\\[~]|€\f"
+)
+
+// Segments is how many messages body is billed as: 160 characters of
+// GSM 7 or 70 of UCS-2 when it has any other character, 153 and 67 per
+// segment once it's split
+func Segments(body string) int {
+	septets, isGSM := 0, true
+	for _, r := range body {
+		switch {
+		case strings.ContainsRune(gsm7, r):
+			septets++
+		case strings.ContainsRune(gsm7Extended, r):
+			septets += 2
+		default:
+			isGSM = false
+		}
+	}
+	if isGSM {
+		return segments(septets, 160, 153)
+	}
+	return segments(len(utf16.Encode([]rune(body))), 70, 67)
+}
+
+func segments(n int, single int, multi int) int {
+	if n <= single {
+		return 1
+	}
+	return (n + multi - 1) / multi
+}
+
+// Log only logs texts, for development. The number is masked and the
+// body left out, it may be a verification code
+type Log struct{}
+
+func (Log) Send(ctx context.Context, msg *Message) error {
+	helper.Logger(ctx).Info("sms", "to", helper.MaskAccountNumber(msg.To), "from", msg.From, "segments", Segments(msg.Body))
+	return nil
+}
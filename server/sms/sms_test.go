@@ -0,0 +1,130 @@
+package sms
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Cprime50/Gopay/config"
+	"github.com/Cprime50/Gopay/helper"
+)
+
+func TestValidPhone(t *testing.T) {
+	for phone, want := range map[string]bool{
+		"+2348012345678":    true,
+		"+14155552671":      true,
+		"+33612345678":      true,
+		"08012345678":       false,
+		"+0123456789":       false,
+		"+234 801 234 567":  false,
+		"+1234567":          false,
+		"+1234567890123456": false,
+		"":                  false,
+	} {
+		if got := ValidPhone(phone); got != want {
+			t.Errorf("ValidPhone(%q) = %v, want %v", phone, got, want)
+		}
+	}
+}
+
+func TestSegments(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		body string
+		want int
+	}{
+		{"empty", "", 1},
+		{"gsm", strings.Repeat("a", 160), 1},
+		{"gsm split", strings.Repeat("a", 161), 2},
+		{"gsm three", strings.Repeat("a", 307), 3},
+		// € takes two septets
+		{"gsm extended", strings.Repeat("€", 80), 1},
+		{"gsm extended split", strings.Repeat("€", 81), 2},
+		// é is in the GSM alphabet, ê isn't
+		{"accented gsm", strings.Repeat("é", 160), 1},
+		{"ucs2", strings.Repeat("ê", 70), 1},
+		{"ucs2 split", strings.Repeat("ê", 71), 2},
+		// emoji take two UTF-16 code units
+		{"surrogates", strings.Repeat("💸", 35), 1},
+		{"surrogates split", strings.Repeat("💸", 36), 2},
+	} {
+		if got := Segments(tc.body); got != tc.want {
+			t.Errorf("%s: got %d segments, want %d", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestHTTP(t *testing.T) {
+	ctx := context.Background()
+	standIn := NewStandIn("key")
+	srv := httptest.NewServer(standIn)
+	t.Cleanup(srv.Close)
+	cfg := config.SMS{URL: srv.URL, APIKey: "key", Timeout: time.Second}
+
+	msg := &Message{To: "+2348012345678", From: "Gopay", Body: "hello"}
+	if err := NewHTTP(cfg).Send(ctx, msg); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if got := standIn.Messages(); len(got) != 1 || got[0] != *msg {
+		t.Fatalf("got messages %+v", got)
+	}
+
+	if err := NewHTTP(cfg).Send(ctx, &Message{To: "08012345678", Body: "hello"}); !errors.Is(err, ErrRejected) {
+		t.Fatalf("send to invalid number: got %v, want rejected", err)
+	}
+	cfg.APIKey = "wrong"
+	if err := NewHTTP(cfg).Send(ctx, msg); !errors.Is(err, ErrRejected) {
+		t.Fatalf("send with wrong key: got %v, want rejected", err)
+	}
+
+	// server errors and throttling are worth retrying
+	for _, status := range []int{http.StatusTooManyRequests, http.StatusBadGateway} {
+		failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+		}))
+		err := NewHTTP(config.SMS{URL: failing.URL, Timeout: time.Second}).Send(ctx, msg)
+		failing.Close()
+		if err == nil || errors.Is(err, ErrRejected) {
+			t.Fatalf("status %d: got %v, want a retryable error", status, err)
+		}
+	}
+}
+
+func TestLogsMaskTexts(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	previous := slog.Default()
+	slog.SetDefault(logger)
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	msg := &Message{To: "+2348012345678", From: "Gopay", Body: "Your Gopay code is 493817"}
+	if err := (Log{}).Send(helper.ContextWithLogger(context.Background(), logger), msg); err != nil {
+		t.Fatalf("log send: %v", err)
+	}
+	srv := httptest.NewServer(NewStandIn(""))
+	t.Cleanup(srv.Close)
+	if err := NewHTTP(config.SMS{URL: srv.URL, Timeout: time.Second}).Send(context.Background(), msg); err != nil {
+		t.Fatalf("stand in send: %v", err)
+	}
+
+	// neither the code nor the whole number is logged
+	logged := buf.String()
+	if strings.Count(logged, "*5678") != 2 || strings.Contains(logged, msg.To) || strings.Contains(logged, "493817") {
+		t.Fatalf("logged %s", logged)
+	}
+}
+
+func TestNewProvider(t *testing.T) {
+	if p, err := NewProvider(config.SMS{Driver: "log"}); err != nil || p != (Log{}) {
+		t.Fatalf("log: got %v, %v", p, err)
+	}
+	if _, err := NewProvider(config.SMS{Driver: "pigeon"}); err == nil {
+		t.Fatal("unknown driver: got no error")
+	}
+}
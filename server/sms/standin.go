@@ -0,0 +1,78 @@
+package sms
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync"
+
+	"github.com/Cprime50/Gopay/helper"
+	"github.com/google/uuid"
+)
+
+// maxStandInMessages is how many of the latest texts StandIn keeps
+const maxStandInMessages = 100
+
+// StandIn is a local stand in for an SMS provider. It accepts the texts
+// the HTTP driver posts, logs them and keeps the latest, which a GET
+// lists. Run it with `gopay sms standin`
+type StandIn struct {
+	apiKey   string
+	mu       sync.Mutex
+	messages []Message
+}
+
+// NewStandIn returns a StandIn, requiring apiKey as the bearer token if not empty
+func NewStandIn(apiKey string) *StandIn {
+	return &StandIn{apiKey: apiKey}
+}
+
+func (s *StandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.apiKey != "" && r.Header.Get("Authorization") != "Bearer "+s.apiKey {
+		standInReply(w, http.StatusUnauthorized, map[string]string{"error": "invalid api key"})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		standInReply(w, http.StatusOK, map[string][]Message{"messages": s.Messages()})
+
+	case http.MethodPost:
+		var msg Message
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil || msg.Body == "" {
+			standInReply(w, http.StatusBadRequest, map[string]string{"error": "expected a JSON body with to, from and body"})
+			return
+		}
+		if !ValidPhone(msg.To) {
+			standInReply(w, http.StatusBadRequest, map[string]string{"error": "to must be an E.164 number"})
+			return
+		}
+		s.mu.Lock()
+		s.messages = append(s.messages, msg)
+		if len(s.messages) > maxStandInMessages {
+			s.messages = s.messages[len(s.messages)-maxStandInMessages:]
+		}
+		s.mu.Unlock()
+
+		// the body may be a verification code, read it from GET instead
+		slog.Info("sms received", "to", helper.MaskAccountNumber(msg.To), "from", msg.From, "segments", Segments(msg.Body))
+		standInReply(w, http.StatusAccepted, map[string]any{"id": uuid.New(), "segments": Segments(msg.Body)})
+
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		standInReply(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+	}
+}
+
+// Messages returns the texts received, oldest first
+func (s *StandIn) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message{}, s.messages...)
+}
+
+func standInReply(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,67 @@
+package tracing
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/Cprime50/Gopay/config"
+	"github.com/go-redis/redis/extra/redisotel/v8"
+	"github.com/go-redis/redis/v8"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"gorm.io/gorm"
+	gormtracing "gorm.io/plugin/opentelemetry/tracing"
+)
+
+// ServiceName identifies gopay spans in the tracing backend
+const ServiceName = "gopay"
+
+// Init sets up the global tracer provider exporting spans over OTLP/HTTP
+// to cfg.Endpoint, eg http://localhost:4318. The remaining standard
+// OTEL_EXPORTER_OTLP_* env vars (headers, timeouts) are still honoured.
+// If no endpoint is configured tracing stays a no-op.
+// The returned func flushes pending spans and must be called on shutdown
+func Init(ctx context.Context, cfg config.Tracing) (func(context.Context) error, error) {
+	if cfg.Endpoint == "" {
+		slog.Info("no OTLP endpoint configured, tracing disabled")
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(cfg.Endpoint))
+	if err != nil {
+		return nil, err
+	}
+
+	provider := NewProvider(exporter)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	slog.Info("tracing enabled")
+
+	return provider.Shutdown, nil
+}
+
+// NewProvider returns a tracer provider batching spans to exporter.
+// Tests can pass a tracetest.InMemoryExporter to inspect spans
+func NewProvider(exporter sdktrace.SpanExporter) *sdktrace.TracerProvider {
+	res := resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName(ServiceName),
+	)
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+}
+
+// InstrumentDataSources adds spans to every GORM query and redis command.
+// Query variables are left out of spans so account data doesn't leak
+func InstrumentDataSources(db *gorm.DB, rdb *redis.Client) error {
+	if err := db.Use(gormtracing.NewPlugin(gormtracing.WithoutQueryVariables(), gormtracing.WithoutMetrics())); err != nil {
+		return err
+	}
+	rdb.AddHook(redisotel.NewTracingHook())
+	return nil
+}
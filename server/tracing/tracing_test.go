@@ -0,0 +1,75 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Cprime50/Gopay/config"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+func TestRequestSpans(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	exporter := tracetest.NewInMemoryExporter()
+	provider := NewProvider(exporter)
+	t.Cleanup(func() { provider.Shutdown(context.Background()) })
+
+	router := gin.New()
+	router.Use(otelgin.Middleware(ServiceName, otelgin.WithTracerProvider(provider)))
+	router.GET("/api/schedules/:id", func(c *gin.Context) {
+		c.Status(http.StatusNotFound)
+	})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/schedules/42", nil))
+	if err := provider.ForceFlush(context.Background()); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("got %d spans, want 1", len(spans))
+	}
+	// spans are named by route so ids don't make every request unique
+	span := spans[0]
+	if span.Name != "/api/schedules/:id" {
+		t.Errorf("got span %q", span.Name)
+	}
+	attrs := attribute.NewSet(span.Attributes...)
+	for key, want := range map[attribute.Key]attribute.Value{
+		"http.method":      attribute.StringValue(http.MethodGet),
+		"http.route":       attribute.StringValue("/api/schedules/:id"),
+		"http.status_code": attribute.IntValue(http.StatusNotFound),
+	} {
+		if got, ok := attrs.Value(key); !ok || got != want {
+			t.Errorf("%s: got %v, want %v", key, got.Emit(), want.Emit())
+		}
+	}
+	if got, _ := span.Resource.Set().Value(semconv.ServiceNameKey); got.AsString() != ServiceName {
+		t.Errorf("got service name %q", got.AsString())
+	}
+}
+
+func TestInitDisabled(t *testing.T) {
+	before := otel.GetTracerProvider()
+	shutdown, err := Init(context.Background(), config.Tracing{})
+	if err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+	// without an endpoint the global provider is left a no-op
+	if provider := otel.GetTracerProvider(); provider != before {
+		t.Fatalf("init replaced the tracer provider with %T", provider)
+	}
+	if _, ok := otel.GetTracerProvider().(*sdktrace.TracerProvider); ok {
+		t.Fatal("tracing enabled without an endpoint")
+	}
+}